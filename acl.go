@@ -5,26 +5,43 @@ import (
 	"strings"
 )
 
-// IMAP4 ACL extension (RFC 2086)
+// IMAP4 ACL extension (RFC 2086, RFC 4314)
 
 // Right describes a set of operations controlled by the IMAP ACL extension.
 type Right byte
 
 const (
 	// Standard rights
-	RightLookup     = Right('l') // mailbox is visible to LIST/LSUB commands
-	RightRead       = Right('r') // SELECT the mailbox, perform CHECK, FETCH, PARTIAL, SEARCH, COPY from mailbox
-	RightSeen       = Right('s') // keep seen/unseen information across sessions (STORE SEEN flag)
-	RightWrite      = Right('w') // STORE flags other than SEEN and DELETED
-	RightInsert     = Right('i') // perform APPEND, COPY into mailbox
-	RightPost       = Right('p') // send mail to submission address for mailbox, not enforced by IMAP4 itself
-	RightCreate     = Right('c') // CREATE new sub-mailboxes in any implementation-defined hierarchy
-	RightDelete     = Right('d') // STORE DELETED flag, perform EXPUNGE
-	RightAdminister = Right('a') // perform SETACL
+	RightLookup         = Right('l') // mailbox is visible to LIST/LSUB commands
+	RightRead           = Right('r') // SELECT the mailbox, perform CHECK, FETCH, PARTIAL, SEARCH, COPY from mailbox
+	RightSeen           = Right('s') // keep seen/unseen information across sessions (STORE SEEN flag)
+	RightWrite          = Right('w') // STORE flags other than SEEN and DELETED
+	RightInsert         = Right('i') // perform APPEND, COPY into mailbox
+	RightPost           = Right('p') // send mail to submission address for mailbox, not enforced by IMAP4 itself
+	RightCreateMailbox  = Right('k') // CREATE new sub-mailboxes, RENAME to a sub-mailbox
+	RightDeleteMailbox  = Right('x') // DELETE mailbox, RENAME mailbox
+	RightDeleteMessages = Right('t') // STORE DELETED flag
+	RightExpunge        = Right('e') // perform EXPUNGE
+	RightAdminister     = Right('a') // perform SETACL
+
+	// Obsolete RFC 2086 rights, virtual rights in RFC 4314. See
+	// RightSet.Expand.
+	RightCreate = Right('c') // RightCreateMailbox and RightDeleteMailbox
+	RightDelete = Right('d') // RightDeleteMessages and RightExpunge
 )
 
+// virtualRights maps virtual rights to the rights they stand for.
+//
+// RFC 4314 section 2.1.1 lets servers tie RightDeleteMailbox to either
+// RightCreate or RightDelete. It's tied to RightCreate, since RFC 2086 required
+// it to delete mailboxes.
+var virtualRights = map[Right]RightSet{
+	RightCreate: RightSet{RightCreateMailbox, RightDeleteMailbox},
+	RightDelete: RightSet{RightDeleteMessages, RightExpunge},
+}
+
 // RightSetAll contains all standard rights.
-var RightSetAll = RightSet("lrswipcda")
+var RightSetAll = RightSet("lrswipkxteacd")
 
 // RightsIdentifier is an ACL identifier.
 type RightsIdentifier string
@@ -50,6 +67,42 @@ const (
 	RightModificationRemove  = RightModification('-')
 )
 
+// ParseRights parses a rights string, optionally prefixed with a modification
+// character, as used by the SETACL command.
+//
+// Unknown rights are preserved as-is.
+func ParseRights(s string) (RightModification, RightSet) {
+	rm := RightModificationReplace
+	if len(s) > 0 {
+		switch RightModification(s[0]) {
+		case RightModificationAdd, RightModificationRemove:
+			rm = RightModification(s[0])
+			s = s[1:]
+		}
+	}
+	return rm, RightSet(s)
+}
+
+// ParseRightSet parses and validates a rights string, as used by the MYRIGHTS
+// response for instance.
+func ParseRightSet(s string) (RightSet, error) {
+	rs := RightSet(s)
+	if err := rs.Validate(); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// FormatRights formats a rights string, prefixed with the modification
+// character if any. It's the reverse of ParseRights.
+func FormatRights(rm RightModification, rs RightSet) string {
+	s := ""
+	if rm != RightModificationReplace {
+		s = string(rm)
+	}
+	return s + string(rs)
+}
+
 // A RightSet is a set of rights.
 type RightSet []Right
 
@@ -58,6 +111,18 @@ func (r RightSet) String() string {
 	return string(r)
 }
 
+// Validate checks that the right set only contains lowercase ASCII letters and
+// digits. Rights other than the standard ones are reserved for server-defined
+// extensions and are allowed.
+func (r RightSet) Validate() error {
+	for _, right := range r {
+		if !('a' <= right && right <= 'z' || '0' <= right && right <= '9') {
+			return fmt.Errorf("imap: invalid right %q", rune(right))
+		}
+	}
+	return nil
+}
+
 // Add returns a new right set containing rights from both sets.
 func (r RightSet) Add(rights RightSet) RightSet {
 	newRights := make(RightSet, len(r), len(r)+len(rights))
@@ -72,6 +137,11 @@ func (r RightSet) Add(rights RightSet) RightSet {
 	return newRights
 }
 
+// Union is an alias for Add.
+func (r RightSet) Union(rights RightSet) RightSet {
+	return r.Add(rights)
+}
+
 // Remove returns a new right set containing all rights in r except these in
 // the provided set.
 func (r RightSet) Remove(rights RightSet) RightSet {
@@ -86,6 +156,48 @@ func (r RightSet) Remove(rights RightSet) RightSet {
 	return newRights
 }
 
+// Modify returns a new right set with the modification applied.
+func (r RightSet) Modify(rm RightModification, rights RightSet) RightSet {
+	switch rm {
+	case RightModificationAdd:
+		return r.Add(rights)
+	case RightModificationRemove:
+		return r.Remove(rights)
+	default:
+		return append(RightSet(nil), rights...)
+	}
+}
+
+// Has returns true if the right set contains the specified right.
+func (r RightSet) Has(right Right) bool {
+	return strings.ContainsRune(string(r), rune(right))
+}
+
+// Contains returns true if the right set contains all of the specified rights.
+func (r RightSet) Contains(rights RightSet) bool {
+	for _, right := range rights {
+		if !r.Has(right) {
+			return false
+		}
+	}
+	return true
+}
+
+// Expand returns a new right set with the RFC 4314 virtual rights resolved in
+// both directions: RightCreate and RightDelete imply the rights they stand
+// for, and are added when all of these rights are present.
+func (r RightSet) Expand() RightSet {
+	expanded := r.Add(nil)
+	for _, virtual := range []Right{RightCreate, RightDelete} {
+		if expanded.Has(virtual) {
+			expanded = expanded.Add(virtualRights[virtual])
+		} else if expanded.Contains(virtualRights[virtual]) {
+			expanded = expanded.Add(RightSet{virtual})
+		}
+	}
+	return expanded
+}
+
 // Equal returns true if both right sets contain exactly the same rights.
 func (rs1 RightSet) Equal(rs2 RightSet) bool {
 	for _, r := range rs1 {
@@ -1,6 +1,7 @@
 package imap
 
 import (
+	"fmt"
 	"time"
 )
 
@@ -8,11 +9,42 @@ import (
 type AppendOptions struct {
 	Flags []Flag
 	Time  time.Time
+
+	// Binary indicates that the message data is sent as a literal8, and may
+	// contain NUL bytes and bare CR/LF characters. CRLF normalization must not
+	// be applied to the message data. Requires BINARY.
+	Binary bool
+	// UTF8 indicates that the message data is sent with the UTF8 data
+	// extension, i.e. "UTF8 (~{...})": the message may contain UTF-8 header
+	// fields. Requires UTF8=ACCEPT.
+	UTF8 bool
+	// Catenate contains the parts of a message assembled by the server. It
+	// can't be used together with message data sent directly. With Binary or
+	// UTF8, text parts are sent in the same way as the message data would be.
+	// Requires CATENATE.
+	Catenate []CatenatePart
+}
+
+// Validate checks that the options can be sent together.
+func (options *AppendOptions) Validate() error {
+	if options.Binary && options.UTF8 {
+		return fmt.Errorf("imap: APPEND data can't be both binary and UTF-8")
+	}
+	for i, part := range options.Catenate {
+		if (part.Text == nil) == (part.URL == "") {
+			return fmt.Errorf("imap: CATENATE part %v: either URL or Text must be set", i)
+		}
+	}
+	return nil
 }
 
 // AppendData is the data returned by an APPEND command.
+//
+// If the server doesn't support UIDPLUS, all fields are left zero.
 type AppendData struct {
 	// requires UIDPLUS or IMAP4rev2
-	UID         UID
+	UID         UID // zero if more than one message has been appended
 	UIDValidity uint32
+	// UIDs assigned to the appended messages, in order
+	UIDs UIDSet
 }
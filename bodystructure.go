@@ -0,0 +1,247 @@
+package imap
+
+import (
+	"fmt"
+	"mime"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// BodyStructurePart is a single part of a body structure, along with its
+// path. The path can be used as FetchItemBodySection.Part.
+type BodyStructurePart struct {
+	Path []int
+	Part *BodyStructureSinglePart
+}
+
+func walkBodyStructure(bs BodyStructure, path []int, f BodyStructureWalkFunc) {
+	if !f(path, bs) {
+		return
+	}
+
+	switch bs := bs.(type) {
+	case *BodyStructureMultiPart:
+		for i, child := range bs.Children {
+			walkBodyStructure(child, appendPartNum(path, i+1), f)
+		}
+	case *BodyStructureSinglePart:
+		if bs.MessageRFC822 == nil {
+			return
+		}
+		switch body := bs.MessageRFC822.BodyStructure.(type) {
+		case *BodyStructureMultiPart:
+			walkBodyStructure(body, path, f)
+		case *BodyStructureSinglePart:
+			walkBodyStructure(body, appendPartNum(path, 1), f)
+		}
+	default:
+		panic(fmt.Errorf("unsupported body structure type %T", bs))
+	}
+}
+
+// appendPartNum returns a new path with a part number appended.
+func appendPartNum(path []int, num int) []int {
+	l := make([]int, len(path)+1)
+	copy(l, path)
+	l[len(path)] = num
+	return l
+}
+
+func bodyStructurePartAtPath(bs BodyStructure, path []int) BodyStructure {
+	for _, num := range path {
+		if num <= 0 {
+			return nil
+		}
+
+		var children []BodyStructure
+		switch part := bs.(type) {
+		case *BodyStructureMultiPart:
+			children = part.Children
+		case *BodyStructureSinglePart:
+			if part.MessageRFC822 == nil {
+				return nil
+			}
+			switch body := part.MessageRFC822.BodyStructure.(type) {
+			case *BodyStructureMultiPart:
+				children = body.Children
+			case *BodyStructureSinglePart:
+				children = []BodyStructure{body}
+			}
+		}
+		if num > len(children) {
+			return nil
+		}
+		bs = children[num-1]
+	}
+	return bs
+}
+
+func bodyStructureAttachments(bs BodyStructure) []BodyStructurePart {
+	var l []BodyStructurePart
+	bs.Walk(func(path []int, part BodyStructure) bool {
+		singlePart, ok := part.(*BodyStructureSinglePart)
+		if ok && (isAttachment(singlePart) || hasFilename(singlePart)) {
+			l = append(l, BodyStructurePart{
+				Path: append([]int(nil), path...),
+				Part: singlePart,
+			})
+		}
+		// Parts of attached messages aren't attachments of this message
+		return !ok || singlePart.MessageRFC822 == nil
+	})
+	return l
+}
+
+func isAttachment(part *BodyStructureSinglePart) bool {
+	disp := part.Disposition()
+	return disp != nil && strings.EqualFold(disp.Value, "attachment")
+}
+
+func hasFilename(part *BodyStructureSinglePart) bool {
+	_, ok := part.Filename()
+	return ok
+}
+
+func findTextPart(bs BodyStructure, path []int) ([]int, *BodyStructureSinglePart) {
+	for _, mediaType := range []string{"text/plain", "text/html"} {
+		if partPath, part := findBodyPart(bs, path, mediaType); part != nil {
+			return partPath, part
+		}
+	}
+	return nil, nil
+}
+
+// findBodyPart looks for a part with the specified media type which is
+// displayed as the message body.
+func findBodyPart(bs BodyStructure, path []int, mediaType string) ([]int, *BodyStructureSinglePart) {
+	switch bs := bs.(type) {
+	case *BodyStructureSinglePart:
+		if bs.MediaType() == mediaType && !isAttachment(bs) {
+			return path, bs
+		}
+	case *BodyStructureMultiPart:
+		findChild := func(i int) ([]int, *BodyStructureSinglePart) {
+			childPath := make([]int, len(path), len(path)+1)
+			copy(childPath, path)
+			return findBodyPart(bs.Children[i], append(childPath, i+1), mediaType)
+		}
+
+		switch strings.ToLower(bs.Subtype) {
+		case "alternative":
+			// Alternatives are ordered by increasing preference
+			for i := len(bs.Children) - 1; i >= 0; i-- {
+				if partPath, part := findChild(i); part != nil {
+					return partPath, part
+				}
+			}
+		case "related":
+			// Only the root part is displayed, the other parts are referenced
+			// by it
+			if i := relatedRootIndex(bs); i >= 0 {
+				return findChild(i)
+			}
+		default:
+			for i := range bs.Children {
+				if partPath, part := findChild(i); part != nil {
+					return partPath, part
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+// relatedRootIndex returns the index of the root part of a multipart/related
+// body structure, or -1 if there is none.
+func relatedRootIndex(bs *BodyStructureMultiPart) int {
+	if len(bs.Children) == 0 {
+		return -1
+	}
+
+	var start string
+	if bs.Extended != nil {
+		start = bs.Extended.Params["start"]
+	}
+	if start == "" {
+		return 0
+	}
+	for i, child := range bs.Children {
+		singlePart, ok := child.(*BodyStructureSinglePart)
+		if ok && trimAngleBrackets(singlePart.ID) == trimAngleBrackets(start) {
+			return i
+		}
+	}
+	return 0
+}
+
+func trimAngleBrackets(s string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(s), "<"), ">")
+}
+
+// decodeParam decodes a MIME parameter value. Parameter names in params must
+// be lower-case.
+func decodeParam(params map[string]string, name string) string {
+	if v, ok := params[name+"*"]; ok {
+		charset, value := splitExtValue(v)
+		return decodeExtValue(charset, value)
+	}
+
+	// RFC 2231 continuations: only the first section specifies the charset
+	var (
+		sb      strings.Builder
+		charset string
+	)
+	for i := 0; ; i++ {
+		section := name + "*" + strconv.Itoa(i)
+		if v, ok := params[section+"*"]; ok {
+			if i == 0 {
+				charset, v = splitExtValue(v)
+			}
+			sb.WriteString(decodeExtValue(charset, v))
+		} else if v, ok := params[section]; ok {
+			sb.WriteString(v)
+		} else {
+			break
+		}
+	}
+	if sb.Len() > 0 {
+		return sb.String()
+	}
+
+	v := params[name]
+	// Some clients use RFC 2047 encoded-words in parameters, even if it's not
+	// allowed
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(v); err == nil {
+		v = decoded
+	}
+	return v
+}
+
+// splitExtValue splits an RFC 2231 extended value into its charset and
+// encoded value. The language is discarded.
+func splitExtValue(v string) (charset, value string) {
+	parts := strings.SplitN(v, "'", 3)
+	if len(parts) != 3 {
+		return "", v
+	}
+	return parts[0], parts[2]
+}
+
+func decodeExtValue(charset, value string) string {
+	b, err := url.PathUnescape(value)
+	if err != nil {
+		return value
+	}
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1":
+		runes := make([]rune, len(b))
+		for i := 0; i < len(b); i++ {
+			runes[i] = rune(b[i])
+		}
+		return string(runes)
+	default:
+		// UTF-8 and US-ASCII, other charsets are left as-is
+		return b
+	}
+}
@@ -40,6 +40,7 @@ const (
 	CapBinary           Cap = "BINARY"             // RFC 3516
 	CapCatenate         Cap = "CATENATE"           // RFC 4469
 	CapChildren         Cap = "CHILDREN"           // RFC 3348
+	CapCompressDeflate  Cap = "COMPRESS=DEFLATE"   // RFC 4978
 	CapCondStore        Cap = "CONDSTORE"          // RFC 7162
 	CapConvert          Cap = "CONVERT"            // RFC 5259
 	CapCreateSpecialUse Cap = "CREATE-SPECIAL-USE" // RFC 6154
@@ -76,6 +77,7 @@ const (
 	CapUIDOnly          Cap = "UIDONLY"            // RFC 9586
 	CapListMetadata     Cap = "LIST-METADATA"      // RFC 9590
 	CapInProgress       Cap = "INPROGRESS"         // RFC 9585
+	CapPartial          Cap = "PARTIAL"            // RFC 9394
 )
 
 var imap4rev2Caps = CapSet{
@@ -92,6 +94,7 @@ var imap4rev2Caps = CapSet{
 	CapMove:         {},
 	CapLiteralMinus: {},
 	CapStatusSize:   {},
+	CapBinary:       {},
 }
 
 // AuthCap returns the capability name for an SASL authentication mechanism.
@@ -186,7 +189,7 @@ func (set CapSet) QuotaResourceTypes() []QuotaResourceType {
 			continue
 		}
 		t := strings.TrimPrefix(string(c), "QUOTA=RES-")
-		l = append(l, QuotaResourceType(t))
+		l = append(l, ParseQuotaResourceType(t))
 	}
 	return l
 }
@@ -0,0 +1,132 @@
+package imap
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// CatenatePart is a part of a message assembled with the CATENATE extension.
+//
+// Either URL or Text must be set.
+type CatenatePart struct {
+	// Relative IMAP URL referencing a message or a body section, see
+	// MessageURL
+	URL string
+	// Literal data, Size bytes are read from Text
+	Text io.Reader
+	Size int64
+}
+
+// CatenateText returns a part containing literal data.
+func CatenateText(b []byte) CatenatePart {
+	return CatenatePart{Text: bytes.NewReader(b), Size: int64(len(b))}
+}
+
+// CatenateURL returns a part referencing a message or a body section.
+func CatenateURL(u *MessageURL) CatenatePart {
+	return CatenatePart{URL: u.String()}
+}
+
+// MessageURL is a relative IMAP URL referencing a message or a body section of
+// a message.
+//
+// See RFC 5092 section 7.
+type MessageURL struct {
+	Mailbox     string
+	UIDValidity uint32 // optional
+	UID         UID
+	// Body section, e.g. "HEADER" or "1.2.TEXT". If empty, the whole
+	// message is referenced.
+	Section string
+}
+
+// String formats the URL, e.g. "/INBOX;UIDVALIDITY=42/;UID=1/;SECTION=TEXT".
+func (u *MessageURL) String() string {
+	var sb strings.Builder
+	sb.WriteByte('/')
+	sb.WriteString(escapeURLPart(u.Mailbox))
+	if u.UIDValidity != 0 {
+		fmt.Fprintf(&sb, ";UIDVALIDITY=%v", u.UIDValidity)
+	}
+	fmt.Fprintf(&sb, "/;UID=%v", u.UID)
+	if u.Section != "" {
+		sb.WriteString("/;SECTION=")
+		sb.WriteString(escapeURLPart(u.Section))
+	}
+	return sb.String()
+}
+
+// ParseMessageURL parses a relative IMAP URL referencing a message or a body
+// section of a message.
+func ParseMessageURL(s string) (*MessageURL, error) {
+	if !strings.HasPrefix(s, "/") {
+		return nil, fmt.Errorf("imap: message URL %q must start with a slash", s)
+	}
+	s = s[1:]
+
+	// Parameter names are case-insensitive
+	i := strings.Index(strings.ToUpper(s), "/;UID=")
+	if i < 0 {
+		return nil, fmt.Errorf("imap: message URL %q has no UID", s)
+	}
+	mailbox, rest := s[:i], s[i+len("/;UID="):]
+
+	var u MessageURL
+	if i := strings.Index(strings.ToUpper(mailbox), ";UIDVALIDITY="); i >= 0 {
+		uidValidity, err := strconv.ParseUint(mailbox[i+len(";UIDVALIDITY="):], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("imap: invalid UIDVALIDITY in message URL: %v", err)
+		}
+		u.UIDValidity = uint32(uidValidity)
+		mailbox = mailbox[:i]
+	}
+	var err error
+	if u.Mailbox, err = url.PathUnescape(mailbox); err != nil {
+		return nil, fmt.Errorf("imap: invalid mailbox in message URL: %v", err)
+	}
+
+	uid, section, hasSection := strings.Cut(rest, "/")
+	n, err := strconv.ParseUint(uid, 10, 32)
+	if err != nil || n == 0 {
+		return nil, fmt.Errorf("imap: invalid UID in message URL: %q", uid)
+	}
+	u.UID = UID(n)
+
+	if hasSection {
+		if !strings.HasPrefix(strings.ToUpper(section), ";SECTION=") {
+			return nil, fmt.Errorf("imap: unsupported message URL parameter: %q", section)
+		}
+		if u.Section, err = url.PathUnescape(section[len(";SECTION="):]); err != nil {
+			return nil, fmt.Errorf("imap: invalid section in message URL: %v", err)
+		}
+	}
+
+	return &u, nil
+}
+
+// escapeURLPart percent-encodes all characters but bchar, as defined in
+// RFC 5092.
+func escapeURLPart(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if isURLBChar(ch) {
+			sb.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", ch)
+		}
+	}
+	return sb.String()
+}
+
+func isURLBChar(ch byte) bool {
+	switch {
+	case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9':
+		return true
+	}
+	return strings.IndexByte("-._~!$'()*+,&=:@/", ch) >= 0
+}
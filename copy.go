@@ -1,9 +1,35 @@
 package imap
 
 // CopyData is the data returned by a COPY command.
+//
+// If the server doesn't support UIDPLUS, all fields are left zero.
 type CopyData struct {
 	// requires UIDPLUS or IMAP4rev2
 	UIDValidity uint32
-	SourceUIDs  UIDSet
-	DestUIDs    UIDSet
+	// UIDs of the copied messages in the source mailbox, and the UIDs of
+	// the matching copies in the destination mailbox, in the same order
+	SourceUIDs UIDSet
+	DestUIDs   UIDSet
+}
+
+// WalkUIDs calls f for each pair of source and destination UIDs, in order. If
+// f returns false, WalkUIDs stops.
+func (data *CopyData) WalkUIDs(f func(source, dest UID) bool) {
+	walkUIDPairs(data.SourceUIDs, data.DestUIDs, f)
+}
+
+func walkUIDPairs(source, dest UIDSet, f func(source, dest UID) bool) {
+	srcUIDs, ok := source.Nums()
+	if !ok {
+		return
+	}
+	destUIDs, ok := dest.Nums()
+	if !ok {
+		return
+	}
+	for i := 0; i < len(srcUIDs) && i < len(destUIDs); i++ {
+		if !f(srcUIDs[i], destUIDs[i]) {
+			return
+		}
+	}
 }
@@ -0,0 +1,250 @@
+package imap
+
+import (
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	dateTimeLayout = "_2-Jan-2006 15:04:05 -0700"
+	dateLayout     = "2-Jan-2006"
+)
+
+// FormatDateTime formats a date-time, as used by INTERNALDATE and APPEND.
+func FormatDateTime(t time.Time) string {
+	return t.Format(dateTimeLayout)
+}
+
+// FormatDate formats a date, as used by SEARCH.
+func FormatDate(t time.Time) string {
+	return t.Format(dateLayout)
+}
+
+// ParseDateTime parses a date-time, as used by INTERNALDATE and APPEND, e.g.
+// "17-Jul-1996 02:44:25 -0700". The string must not be quoted.
+//
+// In lenient mode, malformed date-times found in the wild are accepted as
+// well: two-digit years, missing seconds, zone names instead of numeric
+// offsets and a missing zone (UTC is assumed).
+func ParseDateTime(s string, lenient bool) (time.Time, error) {
+	t, err := time.Parse(dateTimeLayout, s)
+	if err == nil || !lenient {
+		return t, err
+	}
+	if t, lenientErr := parseLenientDateTime(s); lenientErr == nil {
+		return t, nil
+	}
+	return time.Time{}, err
+}
+
+// ParseDate parses a date, as used by SEARCH, e.g. "17-Jul-1996".
+func ParseDate(s string) (time.Time, error) {
+	return time.Parse(dateLayout, s)
+}
+
+// ParseHeaderDate parses the value of a Date header field.
+//
+// In addition to the RFC 5322 syntax, malformed dates found in the wild are
+// accepted: missing day of week or seconds, two-digit years, zone names
+// instead of numeric offsets, a missing zone (UTC is assumed), comments,
+// month before day and dashes between date components.
+func ParseHeaderDate(s string) (time.Time, error) {
+	// net/mail assigns a zero offset to zone names such as "PDT", so it's
+	// only used as a fallback
+	if t, err := parseLenientDateTime(s); err == nil {
+		return t, nil
+	}
+	t, err := mail.ParseDate(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("imap: malformed date %q", s)
+	}
+	return t, nil
+}
+
+// headerDateZones contains the obsolete zone names defined in RFC 5322
+// section 4.3, plus some common extras.
+var headerDateZones = map[string]int{
+	"UT":  0,
+	"UTC": 0,
+	"GMT": 0,
+	"Z":   0,
+	"EST": -5 * 60,
+	"EDT": -4 * 60,
+	"CST": -6 * 60,
+	"CDT": -5 * 60,
+	"MST": -7 * 60,
+	"MDT": -6 * 60,
+	"PST": -8 * 60,
+	"PDT": -7 * 60,
+	"CET": 1 * 60,
+	"BST": 1 * 60,
+}
+
+// parseLenientDateTime parses a date-time made of a day, a month name, a year,
+// a time and an optional zone, in a forgiving way.
+func parseLenientDateTime(s string) (time.Time, error) {
+	s = stripDateComments(s)
+	s = strings.ReplaceAll(s, ",", " ")
+
+	var fields []string
+	for i, f := range strings.Fields(s) {
+		// Split "17-Jul-1996", but not "-0700"
+		if i < 3 && strings.Count(f, "-") == 2 && !strings.HasPrefix(f, "-") {
+			fields = append(fields, strings.Split(f, "-")...)
+		} else {
+			fields = append(fields, f)
+		}
+	}
+
+	// Drop the day of week
+	if len(fields) > 0 {
+		if _, ok := parseDateWeekday(fields[0]); ok {
+			fields = fields[1:]
+		}
+	}
+	if len(fields) < 4 {
+		return time.Time{}, fmt.Errorf("imap: missing date-time components")
+	}
+
+	dayStr, monthStr := fields[0], fields[1]
+	if _, err := strconv.Atoi(dayStr); err != nil {
+		// Month before day, e.g. "Jul 17 1996"
+		dayStr, monthStr = monthStr, dayStr
+	}
+	day, err := strconv.Atoi(dayStr)
+	if err != nil || day < 1 || day > 31 {
+		return time.Time{}, fmt.Errorf("imap: invalid day %q", dayStr)
+	}
+	month, ok := parseDateMonth(monthStr)
+	if !ok {
+		return time.Time{}, fmt.Errorf("imap: invalid month %q", monthStr)
+	}
+
+	yearStr, timeStr := fields[2], fields[3]
+	if strings.Contains(yearStr, ":") {
+		// asctime order, e.g. "Jul 17 02:44:25 1996"
+		yearStr, timeStr = timeStr, yearStr
+	}
+	year, err := strconv.Atoi(yearStr)
+	if err != nil || year < 0 {
+		return time.Time{}, fmt.Errorf("imap: invalid year %q", yearStr)
+	}
+	switch {
+	case len(yearStr) <= 2 && year < 50:
+		year += 2000
+	case len(yearStr) <= 3:
+		year += 1900
+	}
+
+	hour, min, sec, err := parseDateClock(timeStr)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	loc := time.UTC
+	if len(fields) > 4 {
+		loc, err = parseDateZone(fields[4])
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	t := time.Date(year, month, day, hour, min, sec, 0, loc)
+	if t.Day() != day {
+		return time.Time{}, fmt.Errorf("imap: day %v out of range for %v", day, month)
+	}
+	return t, nil
+}
+
+func stripDateComments(s string) string {
+	var sb strings.Builder
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case ch == '(':
+			depth++
+		case ch == ')' && depth > 0:
+			depth--
+		case ch == '\\' && depth > 0:
+			i++
+		case depth == 0:
+			sb.WriteByte(ch)
+		}
+	}
+	return sb.String()
+}
+
+func parseDateWeekday(s string) (time.Weekday, bool) {
+	for wd := time.Sunday; wd <= time.Saturday; wd++ {
+		name := wd.String()
+		if strings.EqualFold(s, name) || strings.EqualFold(s, name[:3]) {
+			return wd, true
+		}
+	}
+	return 0, false
+}
+
+func parseDateMonth(s string) (time.Month, bool) {
+	for m := time.January; m <= time.December; m++ {
+		name := m.String()
+		if strings.EqualFold(s, name) || strings.EqualFold(s, name[:3]) {
+			return m, true
+		}
+	}
+	return 0, false
+}
+
+func parseDateClock(s string) (hour, min, sec int, err error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, 0, 0, fmt.Errorf("imap: invalid time %q", s)
+	}
+	if len(parts) == 3 {
+		// Drop fractional seconds
+		parts[2], _, _ = strings.Cut(parts[2], ".")
+	} else {
+		parts = append(parts, "0")
+	}
+	var nums [3]int
+	for i, p := range parts {
+		if nums[i], err = strconv.Atoi(p); err != nil || nums[i] < 0 {
+			return 0, 0, 0, fmt.Errorf("imap: invalid time %q", s)
+		}
+	}
+	if nums[0] > 23 || nums[1] > 59 || nums[2] > 60 {
+		return 0, 0, 0, fmt.Errorf("imap: invalid time %q", s)
+	}
+	return nums[0], nums[1], nums[2], nil
+}
+
+func parseDateZone(s string) (*time.Location, error) {
+	if len(s) > 0 && (s[0] == '+' || s[0] == '-') {
+		digits := strings.Replace(s[1:], ":", "", 1)
+		n, err := strconv.Atoi(digits)
+		if len(digits) != 4 || err != nil || n%100 > 59 {
+			return nil, fmt.Errorf("imap: invalid zone %q", s)
+		}
+		offset := (n/100*60 + n%100) * 60
+		if s[0] == '-' {
+			offset = -offset
+		}
+		return time.FixedZone("", offset), nil
+	}
+	if min, ok := headerDateZones[strings.ToUpper(s)]; ok {
+		if min == 0 {
+			return time.UTC, nil
+		}
+		return time.FixedZone(strings.ToUpper(s), min*60), nil
+	}
+	// Unknown zone names and military zones are treated as "-0000", as
+	// recommended by RFC 5322 section 4.3
+	for i := 0; i < len(s); i++ {
+		if ch := s[i]; !('a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z') {
+			return nil, fmt.Errorf("imap: invalid zone %q", s)
+		}
+	}
+	return time.UTC, nil
+}
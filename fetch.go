@@ -2,8 +2,11 @@ package imap
 
 import (
 	"fmt"
+	"mime"
+	"reflect"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 // FetchOptions contains options for the FETCH command.
@@ -19,8 +22,147 @@ type FetchOptions struct {
 	BinarySection     []*FetchItemBinarySection     // requires IMAP4rev2 or BINARY
 	BinarySectionSize []*FetchItemBinarySectionSize // requires IMAP4rev2 or BINARY
 	ModSeq            bool                          // requires CONDSTORE
+	SaveDate          bool                          // requires SAVEDATE
+	Preview           *FetchItemPreview             // requires PREVIEW
+	EmailID           bool                          // requires OBJECTID
+	ThreadID          bool                          // requires OBJECTID
 
-	ChangedSince uint64 // requires CONDSTORE
+	ChangedSince ModSeq // requires CONDSTORE
+
+	// Request SaveDate and Preview even if the server doesn't advertise the
+	// corresponding capability
+	Force bool
+}
+
+// FetchOptionsFast returns options equivalent to the FAST macro: FLAGS,
+// INTERNALDATE and RFC822.SIZE.
+func FetchOptionsFast() *FetchOptions {
+	return &FetchOptions{
+		Flags:        true,
+		InternalDate: true,
+		RFC822Size:   true,
+	}
+}
+
+// FetchOptionsAll returns options equivalent to the ALL macro: FLAGS,
+// INTERNALDATE, RFC822.SIZE and ENVELOPE.
+func FetchOptionsAll() *FetchOptions {
+	options := FetchOptionsFast()
+	options.Envelope = true
+	return options
+}
+
+// FetchOptionsFull returns options equivalent to the FULL macro: FLAGS,
+// INTERNALDATE, RFC822.SIZE, ENVELOPE and BODY.
+func FetchOptionsFull() *FetchOptions {
+	options := FetchOptionsAll()
+	options.BodyStructure = &FetchItemBodyStructure{}
+	return options
+}
+
+// Merge adds the items requested by other to options.
+//
+// Boolean items are combined with a logical OR. The extended body structure
+// wins over the non-extended one, and a non-lazy preview wins over a lazy
+// one. Sections already present in options are not duplicated. If both
+// options set ChangedSince, the lowest value is kept, so that the result
+// includes the messages matched by either.
+func (options *FetchOptions) Merge(other *FetchOptions) {
+	if other == nil {
+		return
+	}
+
+	if other.BodyStructure != nil {
+		extended := other.BodyStructure.Extended || (options.BodyStructure != nil && options.BodyStructure.Extended)
+		options.BodyStructure = &FetchItemBodyStructure{Extended: extended}
+	}
+	options.Envelope = options.Envelope || other.Envelope
+	options.Flags = options.Flags || other.Flags
+	options.InternalDate = options.InternalDate || other.InternalDate
+	options.RFC822Size = options.RFC822Size || other.RFC822Size
+	options.UID = options.UID || other.UID
+	options.BodySection = appendUniqueFetchItems(options.BodySection, other.BodySection)
+	options.BinarySection = appendUniqueFetchItems(options.BinarySection, other.BinarySection)
+	options.BinarySectionSize = appendUniqueFetchItems(options.BinarySectionSize, other.BinarySectionSize)
+	options.ModSeq = options.ModSeq || other.ModSeq
+	options.SaveDate = options.SaveDate || other.SaveDate
+	if other.Preview != nil {
+		lazy := other.Preview.Lazy && (options.Preview == nil || options.Preview.Lazy)
+		options.Preview = &FetchItemPreview{Lazy: lazy}
+	}
+	options.EmailID = options.EmailID || other.EmailID
+	options.ThreadID = options.ThreadID || other.ThreadID
+
+	if other.ChangedSince != 0 && (options.ChangedSince == 0 || other.ChangedSince < options.ChangedSince) {
+		options.ChangedSince = other.ChangedSince
+	}
+	options.Force = options.Force || other.Force
+}
+
+func appendUniqueFetchItems[T any](l, other []*T) []*T {
+	for _, item := range other {
+		dup := false
+		for _, existing := range l {
+			if reflect.DeepEqual(existing, item) {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			l = append(l, item)
+		}
+	}
+	return l
+}
+
+// Validate checks that the server supports all of the requested items.
+//
+// SAVEDATE and PREVIEW are not checked if Force is set.
+func (options *FetchOptions) Validate(caps CapSet) error {
+	type requirement struct {
+		requested bool
+		item      string
+		cap       Cap
+	}
+	requirements := []requirement{
+		{len(options.BinarySection) > 0, "BINARY", CapBinary},
+		{len(options.BinarySectionSize) > 0, "BINARY.SIZE", CapBinary},
+		{options.ModSeq, "MODSEQ", CapCondStore},
+		{options.ChangedSince != 0, "CHANGEDSINCE", CapCondStore},
+		{options.SaveDate && !options.Force, "SAVEDATE", CapSaveDate},
+		{options.Preview != nil && !options.Force, "PREVIEW", CapPreview},
+		{options.EmailID, "EMAILID", CapObjectID},
+		{options.ThreadID, "THREADID", CapObjectID},
+	}
+	for _, req := range requirements {
+		if req.requested && !caps.Has(req.cap) {
+			return fmt.Errorf("imap: FETCH %v requires the %v capability", req.item, req.cap)
+		}
+	}
+	return nil
+}
+
+// MarksSeen returns true if fetching these items implicitly sets the \Seen
+// flag, i.e. if a BODY[] or BINARY[] section is requested without PEEK.
+func (options *FetchOptions) MarksSeen() bool {
+	for _, bs := range options.BodySection {
+		if !bs.Peek {
+			return true
+		}
+	}
+	for _, bs := range options.BinarySection {
+		if !bs.Peek {
+			return true
+		}
+	}
+	return false
+}
+
+// FetchItemPreview contains FETCH options for the message preview.
+type FetchItemPreview struct {
+	// Only return the preview if it's readily available, instead of
+	// generating it
+	Lazy bool
 }
 
 // FetchItemBodyStructure contains FETCH options for the body structure.
@@ -29,6 +171,10 @@ type FetchItemBodyStructure struct {
 }
 
 // PartSpecifier describes whether to fetch a part's header, body, or both.
+//
+// HEADER and TEXT refer to the header and body of a message: the top-level
+// message, or a message/rfc822 part. MIME refers to the MIME header of a part,
+// and requires a part number.
 type PartSpecifier string
 
 const (
@@ -65,6 +211,17 @@ type FetchItemBodySection struct {
 	Peek            bool
 }
 
+// Validate checks that the section can be represented on the wire.
+func (section *FetchItemBodySection) Validate() error {
+	if section.Specifier == PartSpecifierMIME && len(section.Part) == 0 {
+		return fmt.Errorf("imap: MIME part specifier requires a part number")
+	}
+	if (len(section.HeaderFields) > 0 || len(section.HeaderFieldsNot) > 0) && section.Specifier != PartSpecifierHeader {
+		return fmt.Errorf("imap: header field list requires the HEADER part specifier")
+	}
+	return nil
+}
+
 // FetchItemBinarySection is a FETCH BINARY[] data item.
 type FetchItemBinarySection struct {
 	Part    []int
@@ -124,6 +281,127 @@ func (addr *Address) IsGroupEnd() bool {
 	return addr.Host == "" && addr.Mailbox == ""
 }
 
+// GroupStart returns a start of group marker. The following addresses are
+// members of the group, up to the end of group marker. See GroupEnd.
+func GroupStart(name string) Address {
+	return Address{Mailbox: name}
+}
+
+// GroupEnd returns an end of group marker. See GroupStart.
+func GroupEnd() Address {
+	return Address{}
+}
+
+// FormatAddressList formats an address list as an RFC 5322 header field
+// value, e.g. `"Doe, John" <john@example.org>, team: alice@example.org;`.
+//
+// Display names and group names are quoted if necessary, and encoded as
+// defined in RFC 2047 if they contain non-ASCII characters. Groups are
+// delimited by start and end of group markers.
+func FormatAddressList(addrs []Address) string {
+	var (
+		items   []string
+		members []string
+		group   string
+		inGroup bool
+	)
+	endGroup := func() {
+		items = append(items, formatMailPhrase(group)+": "+strings.Join(members, ", ")+";")
+		inGroup = false
+	}
+	for _, addr := range addrs {
+		switch {
+		case addr.IsGroupStart():
+			if inGroup {
+				endGroup()
+			}
+			group, inGroup, members = addr.Mailbox, true, nil
+		case addr.IsGroupEnd():
+			if inGroup {
+				endGroup()
+			}
+		default:
+			s := formatMailAddress(&addr)
+			if inGroup {
+				members = append(members, s)
+			} else {
+				items = append(items, s)
+			}
+		}
+	}
+	if inGroup {
+		// Missing end of group marker
+		endGroup()
+	}
+	return strings.Join(items, ", ")
+}
+
+func formatMailAddress(addr *Address) string {
+	mailbox := addr.Mailbox
+	if !isMailDotAtom(mailbox) {
+		mailbox = quoteMailString(mailbox)
+	}
+	s := mailbox + "@" + addr.Host
+	if addr.Name == "" {
+		return s
+	}
+	return formatMailPhrase(addr.Name) + " <" + s + ">"
+}
+
+// formatMailPhrase formats a display name, quoting or encoding it as
+// necessary.
+func formatMailPhrase(s string) string {
+	needsQuote := s == ""
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ch >= utf8.RuneSelf || ch < ' ' || ch == 0x7F {
+			return mime.QEncoding.Encode("utf-8", s)
+		} else if !isMailAtext(ch) && ch != ' ' {
+			needsQuote = true
+		}
+	}
+	if needsQuote {
+		return quoteMailString(s)
+	}
+	return s
+}
+
+func quoteMailString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(s[i])
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+func isMailDotAtom(s string) bool {
+	if s == "" || s[0] == '.' || s[len(s)-1] == '.' || strings.Contains(s, "..") {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isMailAtext(s[i]) && s[i] != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// isMailAtext returns true if ch is an atom character, as defined in RFC 5322
+// section 3.2.3.
+func isMailAtext(ch byte) bool {
+	switch {
+	case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9':
+		return true
+	default:
+		return strings.IndexByte("!#$%&'*+-/=?^_`{|}~", ch) >= 0
+	}
+}
+
 // BodyStructure describes the body structure of a message.
 //
 // A BodyStructure value is either a *BodyStructureSinglePart or a
@@ -133,9 +411,26 @@ type BodyStructure interface {
 	MediaType() string
 	// Walk walks the body structure tree, calling f for each part in the tree,
 	// including bs itself. The parts are visited in DFS pre-order.
+	//
+	// Parts are numbered as defined in RFC 9051 section 6.4.5: the single part
+	// of a non-multipart message is part 1, and the parts of a message/rfc822
+	// part's body are numbered below the message/rfc822 part. If the body of
+	// a message/rfc822 part is multipart, it's visited with the same path as
+	// the message/rfc822 part.
 	Walk(f BodyStructureWalkFunc)
+	// PartAtPath returns the part at a path, as visited by Walk. It returns
+	// nil if there is no such part.
+	//
+	// For a message/rfc822 part, the message/rfc822 part is returned rather
+	// than its multipart body.
+	PartAtPath(path []int) BodyStructure
 	// Disposition returns the body structure disposition, if available.
 	Disposition() *BodyStructureDisposition
+	// Attachments returns the parts which are attachments, in DFS pre-order.
+	Attachments() []BodyStructurePart
+	// FindText returns the preferred text body: text/plain if available,
+	// text/html otherwise. It returns a nil part if there is none.
+	FindText() (path []int, part *BodyStructureSinglePart)
 
 	bodyStructure()
 }
@@ -164,7 +459,17 @@ func (bs *BodyStructureSinglePart) MediaType() string {
 }
 
 func (bs *BodyStructureSinglePart) Walk(f BodyStructureWalkFunc) {
-	f([]int{1}, bs)
+	walkBodyStructure(bs, []int{1}, f)
+}
+
+func (bs *BodyStructureSinglePart) PartAtPath(path []int) BodyStructure {
+	// The first part of a non-multipart message refers to the message itself
+	if len(path) > 0 && path[0] == 1 {
+		path = path[1:]
+	} else if len(path) > 0 {
+		return nil
+	}
+	return bodyStructurePartAtPath(bs, path)
 }
 
 func (bs *BodyStructureSinglePart) Disposition() *BodyStructureDisposition {
@@ -174,17 +479,42 @@ func (bs *BodyStructureSinglePart) Disposition() *BodyStructureDisposition {
 	return bs.Extended.Disposition
 }
 
-// Filename decodes the body structure's filename, if any.
-func (bs *BodyStructureSinglePart) Filename() string {
-	var filename string
+// Charset returns the lower-case charset of the part, from the Content-Type
+// parameters. If unspecified, "us-ascii" is returned for text parts, as
+// defined in RFC 2045, and the empty string is returned for other parts.
+func (bs *BodyStructureSinglePart) Charset() string {
+	if charset := strings.TrimSpace(bs.Params["charset"]); charset != "" {
+		return strings.ToLower(charset)
+	}
+	if strings.EqualFold(bs.Type, "text") {
+		return "us-ascii"
+	}
+	return ""
+}
+
+// Filename decodes the body structure's filename. If the part has no filename,
+// ok is false.
+//
+// The filename parameter of the Content-Disposition header field is preferred
+// over the name parameter of the Content-Type header field. RFC 2231
+// parameter values and continuations, and RFC 2047 encoded-words are decoded.
+func (bs *BodyStructureSinglePart) Filename() (filename string, ok bool) {
 	if bs.Extended != nil && bs.Extended.Disposition != nil {
-		filename = bs.Extended.Disposition.Params["filename"]
+		filename = decodeParam(bs.Extended.Disposition.Params, "filename")
 	}
 	if filename == "" {
 		// Note: using "name" in Content-Type is discouraged
-		filename = bs.Params["name"]
+		filename = decodeParam(bs.Params, "name")
 	}
-	return filename
+	return filename, filename != ""
+}
+
+func (bs *BodyStructureSinglePart) Attachments() []BodyStructurePart {
+	return bodyStructureAttachments(bs)
+}
+
+func (bs *BodyStructureSinglePart) FindText() (path []int, part *BodyStructureSinglePart) {
+	return findTextPart(bs, []int{1})
 }
 
 func (*BodyStructureSinglePart) bodyStructure() {}
@@ -224,29 +554,11 @@ func (bs *BodyStructureMultiPart) MediaType() string {
 }
 
 func (bs *BodyStructureMultiPart) Walk(f BodyStructureWalkFunc) {
-	bs.walk(f, nil)
+	walkBodyStructure(bs, nil, f)
 }
 
-func (bs *BodyStructureMultiPart) walk(f BodyStructureWalkFunc, path []int) {
-	if !f(path, bs) {
-		return
-	}
-
-	pathBuf := make([]int, len(path))
-	copy(pathBuf, path)
-	for i, part := range bs.Children {
-		num := i + 1
-		partPath := append(pathBuf, num)
-
-		switch part := part.(type) {
-		case *BodyStructureSinglePart:
-			f(partPath, part)
-		case *BodyStructureMultiPart:
-			part.walk(f, partPath)
-		default:
-			panic(fmt.Errorf("unsupported body structure type %T", part))
-		}
-	}
+func (bs *BodyStructureMultiPart) PartAtPath(path []int) BodyStructure {
+	return bodyStructurePartAtPath(bs, path)
 }
 
 func (bs *BodyStructureMultiPart) Disposition() *BodyStructureDisposition {
@@ -256,6 +568,14 @@ func (bs *BodyStructureMultiPart) Disposition() *BodyStructureDisposition {
 	return bs.Extended.Disposition
 }
 
+func (bs *BodyStructureMultiPart) Attachments() []BodyStructurePart {
+	return bodyStructureAttachments(bs)
+}
+
+func (bs *BodyStructureMultiPart) FindText() (path []int, part *BodyStructureSinglePart) {
+	return findTextPart(bs, nil)
+}
+
 func (*BodyStructureMultiPart) bodyStructure() {}
 
 // BodyStructureMultiPartExt contains extended body structure data for
@@ -270,8 +590,8 @@ type BodyStructureMultiPartExt struct {
 // BodyStructureDisposition describes the content disposition of a part
 // (specified in the Content-Disposition header field).
 type BodyStructureDisposition struct {
-	Value  string
-	Params map[string]string
+	Value  string            // lower-case, e.g. "inline" or "attachment"
+	Params map[string]string // keys are lower-case
 }
 
 // BodyStructureWalkFunc is a function called for each body structure visited
@@ -9,6 +9,8 @@ package imap
 import (
 	"fmt"
 	"io"
+	"strings"
+	"sync"
 )
 
 // ConnState describes the connection state.
@@ -90,12 +92,93 @@ const (
 	FlagNotJunk   Flag = "$NotJunk"
 	FlagPhishing  Flag = "$Phishing"
 	FlagImportant Flag = "$Important" // RFC 8457
+	FlagLabel1    Flag = "$Label1"
+	FlagLabel2    Flag = "$Label2"
+	FlagLabel3    Flag = "$Label3"
+	FlagLabel4    Flag = "$Label4"
+	FlagLabel5    Flag = "$Label5"
 
 	// Permanent flags
 	FlagWildcard Flag = "\\*"
 )
 
+var (
+	canonFlagsOnce sync.Once
+	canonFlags     map[string]Flag
+)
+
+func canonFlagsInit() {
+	flags := []Flag{
+		FlagSeen,
+		FlagAnswered,
+		FlagFlagged,
+		FlagDeleted,
+		FlagDraft,
+		"\\Recent",
+		FlagForwarded,
+		FlagMDNSent,
+		FlagJunk,
+		FlagNotJunk,
+		FlagPhishing,
+		FlagImportant,
+		FlagLabel1,
+		FlagLabel2,
+		FlagLabel3,
+		FlagLabel4,
+		FlagLabel5,
+	}
+	canonFlags = make(map[string]Flag)
+	for _, flag := range flags {
+		canonFlags[strings.ToLower(string(flag))] = flag
+	}
+}
+
+// Canonical returns the canonical form of the flag. Flags are
+// case-insensitive: two flags are the same if their canonical forms are equal.
+//
+// The system flags and the widely used keywords defined in this package are
+// returned with their usual case, e.g. "\\seen" becomes "\\Seen". Other flags
+// are converted to lower-case.
+func (flag Flag) Canonical() Flag {
+	canonFlagsOnce.Do(canonFlagsInit)
+	lower := strings.ToLower(string(flag))
+	if canon, ok := canonFlags[lower]; ok {
+		return canon
+	}
+	return Flag(lower)
+}
+
+// IsSystem returns true if the flag is a system flag, i.e. starts with a
+// backslash. Clients can't create system flags.
+func (flag Flag) IsSystem() bool {
+	return strings.HasPrefix(string(flag), "\\")
+}
+
+// Valid returns true if the flag can be set on a message: it's a keyword or a
+// system flag, and the name is a valid atom (no spaces, parentheses, wildcards
+// or control characters).
+func (flag Flag) Valid() bool {
+	return isAtom(strings.TrimPrefix(string(flag), "\\"))
+}
+
+// Keyword returns a keyword flag. An error is returned if the name isn't a
+// valid atom or is a system flag.
+func Keyword(name string) (Flag, error) {
+	flag := Flag(name)
+	if flag.IsSystem() {
+		return "", fmt.Errorf("imap: keyword %q is a system flag", name)
+	} else if !flag.Valid() {
+		return "", fmt.Errorf("imap: invalid keyword %q", name)
+	}
+	return flag, nil
+}
+
 // LiteralReader is a reader for IMAP literals.
+//
+// Size returns the total number of bytes of the literal. Literals are streamed
+// and are never required to be held in memory.
+//
+// See NewLiteral, NewFileLiteral and NewReaderLiteral.
 type LiteralReader interface {
 	io.Reader
 	Size() int64
@@ -4,7 +4,6 @@ import (
 	"fmt"
 
 	"github.com/emersion/go-imap/v2"
-	"github.com/emersion/go-imap/v2/internal"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
@@ -23,10 +22,14 @@ func (c *Client) MyRights(mailbox string) *MyRightsCommand {
 //
 // This command requires support for the ACL extension.
 func (c *Client) SetACL(mailbox string, ri imap.RightsIdentifier, rm imap.RightModification, rs imap.RightSet) *SetACLCommand {
+	if err := rs.Validate(); err != nil {
+		return &SetACLCommand{commandBase: failedCommandBase(err)}
+	}
+
 	cmd := &SetACLCommand{}
 	enc := c.beginCommand("SETACL", cmd)
 	enc.SP().Mailbox(mailbox).SP().String(string(ri)).SP()
-	enc.String(internal.FormatRights(rm, rs))
+	enc.String(imap.FormatRights(rm, rs))
 	enc.end()
 	return cmd
 }
@@ -40,6 +43,17 @@ func (cmd *SetACLCommand) Wait() error {
 	return cmd.wait()
 }
 
+// DeleteACL sends a DELETEACL command.
+//
+// This command requires support for the ACL extension.
+func (c *Client) DeleteACL(mailbox string, ri imap.RightsIdentifier) *Command {
+	cmd := &Command{}
+	enc := c.beginCommand("DELETEACL", cmd)
+	enc.SP().Mailbox(mailbox).SP().String(string(ri))
+	enc.end()
+	return cmd
+}
+
 // GetACL sends a GETACL command.
 //
 // This command requires support for the ACL extension.
@@ -83,6 +97,17 @@ func (c *Client) handleGetACL() error {
 	return nil
 }
 
+func (c *Client) handleListRights() error {
+	data, err := readListRights(c.dec)
+	if err != nil {
+		return fmt.Errorf("in listrights-response: %v", err)
+	}
+	if cmd := findPendingCmdByType[*ListRightsCommand](c); cmd != nil {
+		cmd.data = *data
+	}
+	return nil
+}
+
 // MyRightsCommand is a MYRIGHTS command.
 type MyRightsCommand struct {
 	commandBase
@@ -136,3 +161,57 @@ func readGetACL(dec *imapwire.Decoder) (*GetACLData, error) {
 
 	return data, nil
 }
+
+// ListRights sends a LISTRIGHTS command.
+//
+// This command requires support for the ACL extension.
+func (c *Client) ListRights(mailbox string, ri imap.RightsIdentifier) *ListRightsCommand {
+	cmd := &ListRightsCommand{}
+	enc := c.beginCommand("LISTRIGHTS", cmd)
+	enc.SP().Mailbox(mailbox).SP().String(string(ri))
+	enc.end()
+	return cmd
+}
+
+// ListRightsCommand is a LISTRIGHTS command.
+type ListRightsCommand struct {
+	commandBase
+	data ListRightsData
+}
+
+func (cmd *ListRightsCommand) Wait() (*ListRightsData, error) {
+	return &cmd.data, cmd.wait()
+}
+
+// ListRightsData is the data returned by the LISTRIGHTS command.
+type ListRightsData struct {
+	Mailbox    string
+	Identifier imap.RightsIdentifier
+	// Rights always granted to the identifier
+	Required imap.RightSet
+	// Rights which can be granted to the identifier. Rights in the same set
+	// are tied together: they are granted and revoked together.
+	Optional []imap.RightSet
+}
+
+func readListRights(dec *imapwire.Decoder) (*ListRightsData, error) {
+	var (
+		data      ListRightsData
+		ri, rsStr string
+	)
+	if !dec.ExpectMailbox(&data.Mailbox) || !dec.ExpectSP() || !dec.ExpectAString(&ri) || !dec.ExpectSP() || !dec.ExpectAString(&rsStr) {
+		return nil, dec.Err()
+	}
+	data.Identifier = imap.RightsIdentifier(ri)
+	data.Required = imap.RightSet(rsStr)
+
+	for dec.SP() {
+		var rsStr string
+		if !dec.ExpectAString(&rsStr) {
+			return nil, dec.Err()
+		}
+		data.Optional = append(data.Optional, imap.RightSet(rsStr))
+	}
+
+	return &data, nil
+}
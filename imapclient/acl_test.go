@@ -1,9 +1,16 @@
 package imapclient_test
 
 import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
 	"testing"
 
 	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
 )
 
 // order matters
@@ -113,3 +120,359 @@ func TestACL(t *testing.T) {
 		}
 	})
 }
+
+// newSharedACLTestServer starts a server with two users, alice and bob. Alice
+// owns a mailbox named "Shared". The returned function logs in as a user.
+func newSharedACLTestServer(t *testing.T) (login func(username string) *imapclient.Client) {
+	memServer := imapmemserver.New()
+	alice := imapmemserver.NewUser("alice", testPassword)
+	alice.Create("INBOX", nil)
+	alice.Create("Shared", nil)
+	memServer.AddUser(alice)
+	bob := imapmemserver.NewUser("bob", testPassword)
+	bob.Create("INBOX", nil)
+	memServer.AddUser(bob)
+
+	server := imapserver.New(&imapserver.Options{
+		NewSession: func(conn *imapserver.Conn) (imapserver.Session, *imapserver.GreetingData, error) {
+			return memServer.NewSession(), nil, nil
+		},
+		InsecureAuth: true,
+		Caps: imap.CapSet{
+			imap.CapIMAP4rev1:   {},
+			imap.CapIMAP4rev2:   {},
+			imap.CapACL:         {},
+			imap.CapMultiAppend: {},
+			imap.CapLiteralPlus: {},
+		},
+	})
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("net.Listen() = %v", err)
+	}
+	go server.Serve(ln)
+	t.Cleanup(func() { server.Close() })
+
+	return func(username string) *imapclient.Client {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("net.Dial() = %v", err)
+		}
+		client := imapclient.New(conn, nil)
+		if err := client.Login(username, testPassword).Wait(); err != nil {
+			t.Fatalf("Login(%q).Wait() = %v", username, err)
+		}
+		t.Cleanup(func() { client.Close() })
+		return client
+	}
+}
+
+func TestACL_shared(t *testing.T) {
+	login := newSharedACLTestServer(t)
+	aliceClient := login("alice")
+	bobClient := login("bob")
+
+	const sharedMailbox = "Other Users/alice/Shared"
+
+	if _, err := bobClient.MyRights(sharedMailbox).Wait(); err == nil {
+		t.Errorf("MyRights() succeeded before rights were granted")
+	}
+
+	if err := aliceClient.SetACL("Shared", "bob", imap.RightModificationReplace, imap.RightSet("lr")).Wait(); err != nil {
+		t.Fatalf("SetACL().Wait() = %v", err)
+	}
+	if err := aliceClient.SetACL("Shared", "bob", imap.RightModificationAdd, imap.RightSet("si")).Wait(); err != nil {
+		t.Fatalf("SetACL().Wait() = %v", err)
+	}
+	if err := aliceClient.SetACL("Shared", "bob", imap.RightModificationRemove, imap.RightSet("i")).Wait(); err != nil {
+		t.Fatalf("SetACL().Wait() = %v", err)
+	}
+
+	aclData, err := aliceClient.GetACL("Shared").Wait()
+	if err != nil {
+		t.Fatalf("GetACL().Wait() = %v", err)
+	}
+	if rights := aclData.Rights["bob"]; !rights.Equal(imap.RightSet("lrs")) {
+		t.Errorf("GetACL() rights for bob = %v, want lrs", rights)
+	}
+	if rights := aclData.Rights["alice"]; !rights.Equal(imap.RightSetAll) {
+		t.Errorf("GetACL() rights for alice = %v, want %v", rights, imap.RightSetAll)
+	}
+
+	listRightsData, err := aliceClient.ListRights("Shared", "bob").Wait()
+	if err != nil {
+		t.Fatalf("ListRights().Wait() = %v", err)
+	}
+	wantOptional := []imap.RightSet{
+		imap.RightSet("l"), imap.RightSet("r"), imap.RightSet("s"),
+		imap.RightSet("w"), imap.RightSet("i"), imap.RightSet("p"),
+		imap.RightSet("a"), imap.RightSet("ckx"), imap.RightSet("dte"),
+	}
+	if listRightsData.Identifier != "bob" || len(listRightsData.Required) != 0 || len(listRightsData.Optional) != len(wantOptional) {
+		t.Fatalf("ListRights() = %#v", listRightsData)
+	}
+	for i, rights := range listRightsData.Optional {
+		if !rights.Equal(wantOptional[i]) {
+			t.Errorf("ListRights() optional group #%v = %q, want %q", i, rights, wantOptional[i])
+		}
+	}
+
+	myRightsData, err := bobClient.MyRights(sharedMailbox).Wait()
+	if err != nil {
+		t.Fatalf("MyRights().Wait() = %v", err)
+	}
+	if myRightsData.Mailbox != sharedMailbox || !myRightsData.Rights.Equal(imap.RightSet("lrs")) {
+		t.Errorf("MyRights() = %v %v, want %v lrs", myRightsData.Mailbox, myRightsData.Rights, sharedMailbox)
+	}
+	if _, err := bobClient.Select(sharedMailbox, nil).Wait(); err != nil {
+		t.Errorf("Select().Wait() = %v", err)
+	}
+
+	// Virtual rights are granted and revoked along with the rights they stand
+	// for
+	for _, step := range []struct {
+		rm         imap.RightModification
+		rs, expect string
+	}{
+		{imap.RightModificationAdd, "c", "lrsckx"},
+		{imap.RightModificationRemove, "k", "lrsx"},
+		{imap.RightModificationAdd, "te", "lrsxted"},
+		{imap.RightModificationRemove, "d", "lrsx"},
+		{imap.RightModificationRemove, "x", "lrs"},
+	} {
+		if err := aliceClient.SetACL("Shared", "bob", step.rm, imap.RightSet(step.rs)).Wait(); err != nil {
+			t.Fatalf("SetACL().Wait() = %v", err)
+		}
+		aclData, err := aliceClient.GetACL("Shared").Wait()
+		if err != nil {
+			t.Fatalf("GetACL().Wait() = %v", err)
+		} else if rights := aclData.Rights["bob"]; !rights.Equal(imap.RightSet(step.expect)) {
+			t.Errorf("SETACL %v: GetACL() rights for bob = %v, want %v", imap.FormatRights(step.rm, imap.RightSet(step.rs)), rights, step.expect)
+		}
+	}
+
+	if err := aliceClient.SetACL("Shared", "bob", imap.RightModificationAdd, imap.RightSet("W")).Wait(); err == nil {
+		t.Errorf("SetACL() with an invalid right succeeded")
+	}
+
+	err = bobClient.SetACL(sharedMailbox, "anyone", imap.RightModificationReplace, imap.RightSet("l")).Wait()
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeNoPerm {
+		t.Errorf("SetACL() without administer right = %v, want NOPERM", err)
+	}
+
+	if err := aliceClient.DeleteACL("Shared", "bob").Wait(); err != nil {
+		t.Fatalf("DeleteACL().Wait() = %v", err)
+	}
+	if _, err := bobClient.MyRights(sharedMailbox).Wait(); err == nil {
+		t.Errorf("MyRights() succeeded after rights were revoked")
+	}
+}
+
+func TestACL_sharedLookupOnly(t *testing.T) {
+	login := newSharedACLTestServer(t)
+	aliceClient := login("alice")
+	bobClient := login("bob")
+
+	const sharedMailbox = "Other Users/alice/Shared"
+
+	appendMessage := func(client *imapclient.Client, mailbox string) error {
+		appendCmd := client.Append(mailbox, int64(len(simpleRawMessage)), nil)
+		if _, err := appendCmd.Write([]byte(simpleRawMessage)); err != nil {
+			t.Fatalf("AppendCommand.Write() = %v", err)
+		}
+		if err := appendCmd.Close(); err != nil {
+			t.Fatalf("AppendCommand.Close() = %v", err)
+		}
+		_, err := appendCmd.Wait()
+		return err
+	}
+	if err := appendMessage(bobClient, "INBOX"); err != nil {
+		t.Fatalf("Append() = %v", err)
+	}
+	if err := aliceClient.Subscribe("Shared").Wait(); err != nil {
+		t.Fatalf("Subscribe() = %v", err)
+	}
+	if err := aliceClient.SetACL("Shared", "bob", imap.RightModificationReplace, imap.RightSet("l")).Wait(); err != nil {
+		t.Fatalf("SetACL().Wait() = %v", err)
+	}
+
+	expectNoPerm := func(name string, err error) {
+		t.Helper()
+		var imapErr *imap.Error
+		if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeNoPerm {
+			t.Errorf("%v with only the lookup right = %v, want NOPERM", name, err)
+		}
+	}
+
+	_, err := bobClient.Status(sharedMailbox, &imap.StatusOptions{NumMessages: true}).Wait()
+	expectNoPerm("Status()", err)
+	_, err = bobClient.Select(sharedMailbox, nil).Wait()
+	expectNoPerm("Select()", err)
+	_, err = bobClient.Select(sharedMailbox, &imap.SelectOptions{ReadOnly: true}).Wait()
+	expectNoPerm("Examine()", err)
+	expectNoPerm("Append()", appendMessage(bobClient, sharedMailbox))
+
+	multiAppendCmd := bobClient.MultiAppend(sharedMailbox)
+	w := multiAppendCmd.Next(int64(len(simpleRawMessage)), nil)
+	if _, err := io.WriteString(w, simpleRawMessage); err != nil {
+		t.Fatalf("MultiAppendCommand.Next().Write() = %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("MultiAppendCommand.Next().Close() = %v", err)
+	}
+	_, err = multiAppendCmd.Close()
+	expectNoPerm("MultiAppend()", err)
+
+	if _, err := bobClient.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select(INBOX) = %v", err)
+	}
+	_, err = bobClient.Copy(imap.SeqSetNum(1), sharedMailbox).Wait()
+	expectNoPerm("Copy()", err)
+	_, err = bobClient.Move(imap.SeqSetNum(1), sharedMailbox).Wait()
+	expectNoPerm("Move()", err)
+	expectNoPerm("Subscribe()", bobClient.Subscribe(sharedMailbox).Wait())
+	expectNoPerm("Unsubscribe()", bobClient.Unsubscribe(sharedMailbox).Wait())
+
+	// Read access doesn't allow changing flags or expunging
+	if err := aliceClient.SetACL("Shared", "bob", imap.RightModificationAdd, imap.RightSet("ri")).Wait(); err != nil {
+		t.Fatalf("SetACL().Wait() = %v", err)
+	}
+	if err := appendMessage(bobClient, sharedMailbox); err != nil {
+		t.Errorf("Append() with the insert right = %v", err)
+	}
+	if _, err := bobClient.Select(sharedMailbox, nil).Wait(); err != nil {
+		t.Fatalf("Select() with the read right = %v", err)
+	}
+	storeFlags := imap.StoreFlags{Op: imap.StoreFlagsAdd, Flags: []imap.Flag{imap.FlagDeleted}}
+	expectNoPerm("Store()", bobClient.Store(imap.SeqSetNum(1), &storeFlags, nil).Close())
+	expectNoPerm("Expunge()", bobClient.Expunge().Close())
+
+	// Subscriptions are per-user
+	if err := bobClient.Unsubscribe(sharedMailbox).Wait(); err != nil {
+		t.Errorf("Unsubscribe() with the read right = %v", err)
+	}
+	mailboxes, err := aliceClient.List("", "Shared", &imap.ListOptions{SelectSubscribed: true}).Collect()
+	if err != nil {
+		t.Fatalf("List() = %v", err)
+	} else if len(mailboxes) != 1 {
+		t.Errorf("List(SUBSCRIBED) = %v, want Shared to remain subscribed", mailboxes)
+	}
+}
+
+func TestClient_ACL_parse(t *testing.T) {
+	greeting := "* OK [CAPABILITY IMAP4rev1 ACL] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, _ := readScriptTaggedCommand(t, br, w)
+		io.WriteString(w, `* ACL INBOX alice lrswipkxtecda bob lr "-carol" w "dave smith" "" {3}`+"\r\n"+`eve xyz`+"\r\n")
+		io.WriteString(w, tag+" OK GETACL completed\r\n")
+
+		tag, _ = readScriptTaggedCommand(t, br, w)
+		io.WriteString(w, "* LISTRIGHTS INBOX bob la r swi cdx\r\n")
+		io.WriteString(w, tag+" OK LISTRIGHTS completed\r\n")
+	})
+
+	aclData, err := client.GetACL("INBOX").Wait()
+	if err != nil {
+		t.Fatalf("GetACL().Wait() = %v", err)
+	}
+	want := map[imap.RightsIdentifier]imap.RightSet{
+		"alice":      imap.RightSet("lrswipkxtecda"),
+		"bob":        imap.RightSet("lr"),
+		"-carol":     imap.RightSet("w"),
+		"dave smith": imap.RightSet(""),
+		"eve":        imap.RightSet("xyz"),
+	}
+	if len(aclData.Rights) != len(want) {
+		t.Errorf("GetACL() = %v, want %v", aclData.Rights, want)
+	}
+	for ri, rs := range want {
+		if got, ok := aclData.Rights[ri]; !ok || !got.Equal(rs) {
+			t.Errorf("GetACL() rights for %q = %q, want %q", ri, got, rs)
+		}
+	}
+
+	listRightsData, err := client.ListRights("INBOX", "bob").Wait()
+	if err != nil {
+		t.Fatalf("ListRights().Wait() = %v", err)
+	}
+	if !listRightsData.Required.Equal(imap.RightSet("la")) || len(listRightsData.Optional) != 3 || !listRightsData.Optional[2].Equal(imap.RightSet("cdx")) {
+		t.Errorf("ListRights() = %#v", listRightsData)
+	}
+}
+
+func TestRightSet(t *testing.T) {
+	rs, err := imap.ParseRightSet("lr0z")
+	if err != nil {
+		t.Fatalf("ParseRightSet() = %v", err)
+	} else if rs.String() != "lr0z" {
+		t.Errorf("ParseRightSet().String() = %q, want %q", rs.String(), "lr0z")
+	}
+	for _, s := range []string{"lR", "l r", "l+", "é"} {
+		if _, err := imap.ParseRightSet(s); err == nil {
+			t.Errorf("ParseRightSet(%q) succeeded", s)
+		}
+	}
+
+	if u := imap.RightSet("lr").Union(imap.RightSet("rs")); u.String() != "lrs" {
+		t.Errorf("Union() = %v, want lrs", u)
+	}
+	if !imap.RightSet("lrs").Contains(imap.RightSet("sl")) || imap.RightSet("lr").Contains(imap.RightSet("ls")) {
+		t.Errorf("Contains() returned wrong result")
+	}
+	if !imap.RightSet(nil).Contains(nil) {
+		t.Errorf("Contains() = false for an empty set")
+	}
+
+	expand := []struct {
+		in, out string
+	}{
+		{"", ""},
+		{"c", "ckx"},
+		{"d", "dte"},
+		{"kx", "kxc"},
+		{"te", "ted"},
+		{"k", "k"},
+		{"x", "x"},
+		{"t", "t"},
+		{"e", "e"},
+		{"lcd", "lcdkxte"},
+		{"lrswipkxteacd", "lrswipkxteacd"},
+	}
+	for _, tc := range expand {
+		if got := imap.RightSet(tc.in).Expand(); !got.Equal(imap.RightSet(tc.out)) {
+			t.Errorf("RightSet(%q).Expand() = %q, want %q", tc.in, got, tc.out)
+		}
+	}
+}
+
+func FuzzRightSet(f *testing.F) {
+	f.Add("lrswipkxteacd")
+	f.Add("+cd")
+	f.Add("-kx0")
+	f.Fuzz(func(t *testing.T, s string) {
+		rm, rs := imap.ParseRights(s)
+		if formatted := imap.FormatRights(rm, rs); formatted != s {
+			t.Errorf("FormatRights(ParseRights(%q)) = %q", s, formatted)
+		}
+		if _, err := imap.ParseRightSet(string(rs)); err != nil {
+			return
+		}
+
+		expanded := rs.Expand()
+		if !expanded.Contains(rs) {
+			t.Errorf("RightSet(%q).Expand() = %q, missing rights", rs, expanded)
+		}
+		if !expanded.Expand().Equal(expanded) {
+			t.Errorf("RightSet(%q).Expand() isn't idempotent", rs)
+		}
+		for virtual, implied := range map[imap.Right]imap.RightSet{
+			imap.RightCreate: {imap.RightCreateMailbox, imap.RightDeleteMailbox},
+			imap.RightDelete: {imap.RightDeleteMessages, imap.RightExpunge},
+		} {
+			if expanded.Has(virtual) != expanded.Contains(implied) {
+				t.Errorf("RightSet(%q).Expand() = %q, inconsistent %q right", rs, expanded, virtual)
+			}
+		}
+	})
+}
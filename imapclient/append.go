@@ -1,10 +1,11 @@
 package imapclient
 
 import (
+	"context"
+	"fmt"
 	"io"
 
 	"github.com/emersion/go-imap/v2"
-	"github.com/emersion/go-imap/v2/internal"
 )
 
 // Append sends an APPEND command.
@@ -12,24 +13,151 @@ import (
 // The caller must call AppendCommand.Close.
 //
 // The options are optional.
+//
+// Sending binary message data via AppendOptions.Binary requires BINARY, and
+// sending UTF-8 message data via AppendOptions.UTF8 requires UTF8=ACCEPT. If
+// the server doesn't support it, the command fails without being sent, and
+// writes return the error. AppendOptions.Catenate must be empty, see
+// AppendCatenate.
 func (c *Client) Append(mailbox string, size int64, options *imap.AppendOptions) *AppendCommand {
+	if err := c.checkAppendOptions(options); err != nil {
+		return &AppendCommand{commandBase: failedCommandBase(err)}
+	}
+	if options != nil && len(options.Catenate) > 0 {
+		err := fmt.Errorf("imapclient: CATENATE parts can't be sent along with message data")
+		return &AppendCommand{commandBase: failedCommandBase(err)}
+	}
+
 	cmd := &AppendCommand{}
 	cmd.enc = c.beginCommand("APPEND", cmd)
 	cmd.enc.SP().Mailbox(mailbox).SP()
+	cmd.wc = writeAppendMessage(cmd.enc, size, options)
+	return cmd
+}
+
+// checkAppendOptions validates APPEND options and checks that the server
+// supports them.
+func (c *Client) checkAppendOptions(options *imap.AppendOptions) error {
+	if options == nil {
+		return nil
+	}
+	if err := options.Validate(); err != nil {
+		return err
+	}
+	if options.Binary {
+		if err := c.checkCap(imap.CapBinary); err != nil {
+			return err
+		}
+	}
+	if options.UTF8 {
+		if err := c.checkCap(imap.CapUTF8Accept); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeAppendMessage(enc *commandEncoder, size int64, options *imap.AppendOptions) io.WriteCloser {
+	writeAppendOptions(enc, options)
+	return writeAppendLiteral(enc, size, options)
+}
+
+// writeAppendLiteral writes message data as a literal, a literal8 or with the
+// UTF8 data extension, depending on the options.
+func writeAppendLiteral(enc *commandEncoder, size int64, options *imap.AppendOptions) io.WriteCloser {
+	switch {
+	case options != nil && options.UTF8:
+		enc.Atom("UTF8").SP().Special('(')
+		return &utf8LiteralWriter{enc.Literal8(size), enc}
+	case options != nil && options.Binary:
+		return enc.Literal8(size)
+	default:
+		return enc.Literal(size)
+	}
+}
+
+// utf8LiteralWriter writes the closing parenthesis of the UTF8 data extension
+// once the literal has been written.
+type utf8LiteralWriter struct {
+	io.WriteCloser
+	enc *commandEncoder
+}
+
+func (w *utf8LiteralWriter) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+	w.enc.Special(')')
+	return nil
+}
+
+// writeAppendOptions writes the flags and date-time of a message, followed by
+// a space.
+func writeAppendOptions(enc *commandEncoder, options *imap.AppendOptions) {
 	if options != nil && len(options.Flags) > 0 {
-		cmd.enc.List(len(options.Flags), func(i int) {
-			cmd.enc.Flag(options.Flags[i])
+		enc.List(len(options.Flags), func(i int) {
+			enc.Flag(options.Flags[i])
 		}).SP()
 	}
 	if options != nil && !options.Time.IsZero() {
-		cmd.enc.String(options.Time.Format(internal.DateTimeLayout)).SP()
+		enc.String(imap.FormatDateTime(options.Time)).SP()
+	}
+}
+
+// AppendReader sends an APPEND command with the message data read from r.
+//
+// size must be the exact number of bytes which will be read from r. The data
+// is streamed to the connection: the whole message is never held in memory.
+// If the server supports LITERAL+, the message is sent without waiting for a
+// continuation request. If reading from r fails, the connection is closed,
+// since there is no way to abort an APPEND command in the middle of a literal.
+//
+// When ctx is done before the message has been sent, the connection is closed
+// as well, see Client.WatchContext.
+//
+// Unlike Append, the returned command has already been sent: the caller only
+// needs to call AppendCommand.Wait.
+func (c *Client) AppendReader(ctx context.Context, mailbox string, r io.Reader, size int64, options *imap.AppendOptions) *AppendCommand {
+	if ctx.Done() != nil {
+		stop := c.WatchContext(ctx)
+		defer stop()
+	}
+
+	cmd := c.Append(mailbox, size, options)
+	if cmd.wc == nil {
+		return cmd // failed without being sent
 	}
-	// TODO: literal8 for BINARY
-	// TODO: UTF8 data ext for UTF8=ACCEPT, with literal8
-	cmd.wc = cmd.enc.Literal(size)
+	if _, err := io.CopyN(cmd, r, size); err != nil {
+		c.abort(fmt.Errorf("imapclient: failed to send APPEND data: %w", err))
+	}
+	cmd.Close()
 	return cmd
 }
 
+// AppendLiteral is like AppendReader, except that the message data and size
+// are taken from lit.
+func (c *Client) AppendLiteral(ctx context.Context, mailbox string, lit imap.LiteralReader, options *imap.AppendOptions) *AppendCommand {
+	return c.AppendReader(ctx, mailbox, lit, lit.Size(), options)
+}
+
+// AppendReadSeeker is like AppendReader, except that the size of the message
+// is determined by seeking r. The message data is read from the current
+// offset.
+func (c *Client) AppendReadSeeker(ctx context.Context, mailbox string, r io.ReadSeeker, options *imap.AppendOptions) *AppendCommand {
+	cur, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return &AppendCommand{commandBase: failedCommandBase(err)}
+	}
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return &AppendCommand{commandBase: failedCommandBase(err)}
+	}
+	if _, err := r.Seek(cur, io.SeekStart); err != nil {
+		return &AppendCommand{commandBase: failedCommandBase(err)}
+	}
+	return c.AppendReader(ctx, mailbox, r, end-cur, options)
+}
+
 // AppendCommand is an APPEND command.
 //
 // Callers must write the message contents, then call Close.
@@ -41,10 +169,16 @@ type AppendCommand struct {
 }
 
 func (cmd *AppendCommand) Write(b []byte) (int, error) {
+	if cmd.wc == nil {
+		return 0, cmd.err
+	}
 	return cmd.wc.Write(b)
 }
 
 func (cmd *AppendCommand) Close() error {
+	if cmd.wc == nil {
+		return nil
+	}
 	err := cmd.wc.Close()
 	if cmd.enc != nil {
 		cmd.enc.end()
@@ -56,3 +190,141 @@ func (cmd *AppendCommand) Close() error {
 func (cmd *AppendCommand) Wait() (*imap.AppendData, error) {
 	return &cmd.data, cmd.wait()
 }
+
+// WaitContext is like Wait, but closes the connection if ctx is done before
+// the command has completed. See Client.WatchContext.
+func (cmd *AppendCommand) WaitContext(ctx context.Context) (*imap.AppendData, error) {
+	defer cmd.watchContext(ctx)()
+	return cmd.Wait()
+}
+
+// appendDataFromRespCode extracts the data from an APPENDUID response code.
+func appendDataFromRespCode(code imap.AppendUIDCode) *imap.AppendData {
+	uids := code.UIDs
+	data := &imap.AppendData{UIDValidity: code.UIDValidity, UIDs: uids}
+	// The UID set contains more than one UID with MULTIAPPEND
+	if len(uids) == 1 && uids[0].Start == uids[0].Stop {
+		data.UID = uids[0].Start
+	}
+	return data
+}
+
+// MultiAppend starts an APPEND command which appends several messages to a
+// mailbox.
+//
+// Each message is written to the io.WriteCloser returned by
+// MultiAppendCommand.Next. The caller must call MultiAppendCommand.Close once
+// all messages have been written.
+//
+// If the server supports MULTIAPPEND, all messages are sent in a single
+// command, which is atomic. Otherwise, one APPEND command is sent per message.
+// In both cases, if the server supports LITERAL+, messages are sent without
+// waiting for continuation requests.
+func (c *Client) MultiAppend(mailbox string) *MultiAppendCommand {
+	return &MultiAppendCommand{
+		client:  c,
+		mailbox: mailbox,
+		multi:   c.Caps().Has(imap.CapMultiAppend),
+	}
+}
+
+// MultiAppendCommand is an APPEND command with multiple messages.
+type MultiAppendCommand struct {
+	client  *Client
+	mailbox string
+	multi   bool // server supports MULTIAPPEND
+
+	// with MULTIAPPEND, cmds contains a single command
+	cmds []*AppendCommand
+}
+
+// Next starts a new message.
+//
+// The caller must write the message contents and close the returned writer
+// before calling Next or Close again.
+func (cmd *MultiAppendCommand) Next(size int64, options *imap.AppendOptions) io.WriteCloser {
+	if !cmd.multi {
+		appendCmd := cmd.client.Append(cmd.mailbox, size, options)
+		cmd.cmds = append(cmd.cmds, appendCmd)
+		return appendCmd
+	}
+
+	if len(cmd.cmds) == 0 {
+		appendCmd := &AppendCommand{}
+		appendCmd.enc = cmd.client.beginCommand("APPEND", appendCmd)
+		appendCmd.enc.SP().Mailbox(cmd.mailbox)
+		cmd.cmds = append(cmd.cmds, appendCmd)
+	}
+	appendCmd := cmd.cmds[0]
+	appendCmd.enc.SP()
+	appendCmd.wc = writeAppendMessage(appendCmd.enc, size, options)
+	return appendCmd.wc
+}
+
+// Close completes the command and waits for the server to store the messages.
+//
+// The returned data contains the UIDs of the stored messages, if the server
+// supports UIDPLUS. If some messages couldn't be stored, a *MultiAppendError
+// is returned along with the data of the stored messages.
+func (cmd *MultiAppendCommand) Close() (*imap.AppendData, error) {
+	if cmd.multi {
+		if len(cmd.cmds) == 0 {
+			return &imap.AppendData{}, nil
+		}
+		appendCmd := cmd.cmds[0]
+		appendCmd.enc.end()
+		appendCmd.enc = nil
+		data, err := appendCmd.Wait()
+		if err != nil {
+			return &imap.AppendData{}, &MultiAppendError{Err: err}
+		}
+		return data, nil
+	}
+
+	var (
+		data     imap.AppendData
+		stored   []int
+		firstErr error
+	)
+	for i, appendCmd := range cmd.cmds {
+		appendData, err := appendCmd.Wait()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		stored = append(stored, i)
+		if appendData.UIDValidity == 0 {
+			continue
+		}
+		data.UIDValidity = appendData.UIDValidity
+		data.UIDs.AddSet(appendData.UIDs)
+	}
+	// Same as a MULTIAPPEND command: UID is only set for a single message
+	if uids := data.UIDs; len(uids) == 1 && uids[0].Start == uids[0].Stop {
+		data.UID = uids[0].Start
+	}
+	if firstErr != nil {
+		return &data, &MultiAppendError{Stored: stored, Err: firstErr}
+	}
+	return &data, nil
+}
+
+// MultiAppendError is returned when some messages of a MultiAppendCommand
+// couldn't be stored.
+type MultiAppendError struct {
+	// Indexes of the messages which have been stored, in the order of the
+	// MultiAppendCommand.Next calls. Always empty if the server supports
+	// MULTIAPPEND, since the command is atomic.
+	Stored []int
+	Err    error
+}
+
+func (err *MultiAppendError) Error() string {
+	return fmt.Sprintf("imapclient: failed to append messages (%v stored): %v", len(err.Stored), err.Err)
+}
+
+func (err *MultiAppendError) Unwrap() error {
+	return err.Err
+}
@@ -1,9 +1,21 @@
 package imapclient_test
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
 )
 
 func TestAppend(t *testing.T) {
@@ -26,3 +38,611 @@ func TestAppend(t *testing.T) {
 
 	// TODO: fetch back message and check body
 }
+
+func TestAppend_binary(t *testing.T) {
+	client, server := newClientServerPair(t, imap.ConnStateSelected)
+	defer client.Close()
+	defer server.Close()
+
+	body := []byte("\x00\x01binary\x00data\r\n\x00")
+	var buf bytes.Buffer
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: application/octet-stream\r\n")
+	buf.WriteString("Content-Transfer-Encoding: binary\r\n")
+	buf.WriteString("\r\n")
+	buf.Write(body)
+
+	appendCmd := client.Append("INBOX", int64(buf.Len()), &imap.AppendOptions{Binary: true})
+	if _, err := appendCmd.Write(buf.Bytes()); err != nil {
+		t.Fatalf("AppendCommand.Write() = %v", err)
+	}
+	if err := appendCmd.Close(); err != nil {
+		t.Fatalf("AppendCommand.Close() = %v", err)
+	}
+	if _, err := appendCmd.Wait(); err != nil {
+		t.Fatalf("AppendCommand.Wait() = %v", err)
+	}
+
+	section := &imap.FetchItemBinarySection{Part: []int{1}, Peek: true}
+	msgs, err := client.Fetch(imap.SeqSetNum(2), &imap.FetchOptions{
+		BinarySection: []*imap.FetchItemBinarySection{section},
+	}).Collect()
+	if err != nil {
+		t.Fatalf("Fetch().Collect() = %v", err)
+	} else if len(msgs) != 1 {
+		t.Fatalf("len(msgs) = %v, want 1", len(msgs))
+	}
+	msg := msgs[0]
+	if len(msg.BinarySection) != 1 {
+		t.Fatalf("len(msg.BinarySection) = %v, want 1", len(msg.BinarySection))
+	}
+	for _, b := range msg.BinarySection {
+		if !bytes.Equal(b, body) {
+			t.Errorf("binary section mismatch: got %q but want %q", b, body)
+		}
+	}
+}
+
+func TestAppend_normalizeCRLF(t *testing.T) {
+	client, server := newClientServerPair(t, imap.ConnStateSelected)
+	defer client.Close()
+	defer server.Close()
+
+	if _, ok := server.(*dovecotServer); ok {
+		t.Skip("Dovecot doesn't normalize line endings")
+	}
+
+	raw := "Subject: Test\n\nHello,\rworld!\n"
+	want := "Subject: Test\r\n\r\nHello,\r\nworld!\r\n"
+
+	appendCmd := client.Append("INBOX", int64(len(raw)), nil)
+	if _, err := appendCmd.Write([]byte(raw)); err != nil {
+		t.Fatalf("AppendCommand.Write() = %v", err)
+	}
+	if err := appendCmd.Close(); err != nil {
+		t.Fatalf("AppendCommand.Close() = %v", err)
+	}
+	if _, err := appendCmd.Wait(); err != nil {
+		t.Fatalf("AppendCommand.Wait() = %v", err)
+	}
+
+	msgs, err := client.Fetch(imap.SeqSetNum(2), &imap.FetchOptions{
+		RFC822Size:  true,
+		BodySection: []*imap.FetchItemBodySection{{Peek: true}},
+	}).Collect()
+	if err != nil {
+		t.Fatalf("Fetch().Collect() = %v", err)
+	} else if len(msgs) != 1 {
+		t.Fatalf("len(msgs) = %v, want 1", len(msgs))
+	}
+	msg := msgs[0]
+	for _, b := range msg.BodySection {
+		if string(b) != want {
+			t.Errorf("body mismatch: got %q but want %q", b, want)
+		}
+	}
+	if msg.RFC822Size != int64(len(want)) {
+		t.Errorf("RFC822Size = %v, want %v", msg.RFC822Size, len(want))
+	}
+}
+
+func TestAppend_nul(t *testing.T) {
+	client, server := newClientServerPair(t, imap.ConnStateSelected)
+	defer client.Close()
+	defer server.Close()
+
+	raw := "Subject: Test\r\n\r\nHello\x00world!\r\n"
+
+	appendCmd := client.Append("INBOX", int64(len(raw)), nil)
+	if _, err := appendCmd.Write([]byte(raw)); err != nil {
+		t.Fatalf("AppendCommand.Write() = %v", err)
+	}
+	if err := appendCmd.Close(); err != nil {
+		t.Fatalf("AppendCommand.Close() = %v", err)
+	}
+	if _, err := appendCmd.Wait(); err == nil {
+		t.Fatalf("AppendCommand.Wait() = nil, want an error")
+	}
+
+	if err := client.Noop().Wait(); err != nil {
+		t.Errorf("Noop().Wait() = %v", err)
+	}
+}
+
+// generatedMessageReader generates a message of a given size without holding
+// it in memory.
+type generatedMessageReader struct {
+	header string
+	size   int64 // remaining
+	off    int64 // offset in the body
+}
+
+func newGeneratedMessageReader(size int64) *generatedMessageReader {
+	return &generatedMessageReader{
+		header: "Content-Type: text/plain\r\n\r\n",
+		size:   size,
+	}
+}
+
+func (r *generatedMessageReader) Read(b []byte) (int, error) {
+	if r.size == 0 {
+		return 0, io.EOF
+	}
+	if int64(len(b)) > r.size {
+		b = b[:r.size]
+	}
+	n := 0
+	if r.header != "" {
+		n = copy(b, r.header)
+		r.header = r.header[n:]
+	}
+	const line = "0123456789abcdefghijklmnopqrstuvwxyz\r\n"
+	for i := n; i < len(b); i++ {
+		b[i] = line[r.off%int64(len(line))]
+		r.off++
+	}
+	r.size -= int64(len(b))
+	return len(b), nil
+}
+
+func TestClient_AppendReader(t *testing.T) {
+	user := imapmemserver.NewUser(testUsername, testPassword)
+	user.Create("INBOX", nil)
+	dial := newCapsTestServer(t, user, imap.CapSet{imap.CapLiteralPlus: {}})
+	client := dial(nil)
+
+	const size = 10 * 1024 * 1024
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	r := newGeneratedMessageReader(size)
+	data, err := client.AppendReader(context.Background(), "INBOX", r, size, nil).Wait()
+	if err != nil {
+		t.Fatalf("AppendReader().Wait() = %v", err)
+	}
+
+	runtime.ReadMemStats(&after)
+	// The server keeps a copy of the message in memory: the client should
+	// only allocate a small fraction of the message size on top of that
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > size+size/2 {
+		t.Errorf("appending a %v bytes message allocated %v bytes", size, alloc)
+	}
+
+	if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select().Wait() = %v", err)
+	}
+	msgs, err := client.Fetch(imap.UIDSetNum(data.UID), &imap.FetchOptions{RFC822Size: true}).Collect()
+	if err != nil {
+		t.Fatalf("Fetch().Collect() = %v", err)
+	} else if len(msgs) != 1 || msgs[0].RFC822Size != size {
+		t.Errorf("Fetch().Collect() = %v, want a single message with size %v", msgs, size)
+	}
+}
+
+func TestClient_AppendReadSeeker(t *testing.T) {
+	client, server := newClientServerPair(t, imap.ConnStateSelected)
+	defer client.Close()
+	defer server.Close()
+
+	msg := strings.ReplaceAll(simpleRawMessage, "\n", "\r\n")
+	r := strings.NewReader("garbage" + msg)
+	r.Seek(int64(len("garbage")), io.SeekStart)
+	data, err := client.AppendReadSeeker(context.Background(), "INBOX", r, nil).Wait()
+	if err != nil {
+		t.Fatalf("AppendReadSeeker().Wait() = %v", err)
+	}
+
+	msgs, err := client.Fetch(imap.UIDSetNum(data.UID), &imap.FetchOptions{RFC822Size: true}).Collect()
+	if err != nil {
+		t.Fatalf("Fetch().Collect() = %v", err)
+	} else if len(msgs) != 1 || msgs[0].RFC822Size != int64(len(msg)) {
+		t.Errorf("Fetch().Collect() = %v, want a single message with size %v", msgs, len(msg))
+	}
+}
+
+// slowReader returns a few bytes at a time, forever.
+type slowReader struct{}
+
+func (slowReader) Read(b []byte) (int, error) {
+	time.Sleep(5 * time.Millisecond)
+	if len(b) > 1024 {
+		b = b[:1024]
+	}
+	for i := range b {
+		b[i] = 'a'
+	}
+	return len(b), nil
+}
+
+func TestClient_AppendReader_cancel(t *testing.T) {
+	user := imapmemserver.NewUser(testUsername, testPassword)
+	user.Create("INBOX", nil)
+	dial := newCapsTestServer(t, user, imap.CapSet{imap.CapLiteralPlus: {}})
+	client := dial(nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := client.AppendReader(ctx, "INBOX", slowReader{}, 10*1024*1024, nil).Wait()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("AppendReader().Wait() = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestClient_MultiAppend(t *testing.T) {
+	messages := []struct {
+		body  string
+		flags []imap.Flag
+	}{
+		{"Subject: One\r\n\r\nFirst message\r\n", []imap.Flag{imap.FlagSeen}},
+		{"Subject: Two\r\n\r\nSecond message\r\n", nil},
+		{"Subject: Three\r\n\r\nThird message\r\n", []imap.Flag{imap.FlagFlagged}},
+	}
+
+	for _, tc := range []struct {
+		name    string
+		caps    imap.CapSet
+		numCmds int
+	}{
+		{"multiappend", imap.CapSet{imap.CapMultiAppend: {}, imap.CapLiteralPlus: {}}, 1},
+		{"fallback", imap.CapSet{imap.CapLiteralPlus: {}}, len(messages)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			user := imapmemserver.NewUser(testUsername, testPassword)
+			user.Create("INBOX", nil)
+			dial := newCapsTestServer(t, user, tc.caps)
+
+			var debug lockedBuffer
+			client := dial(&imapclient.Options{DebugWriter: &debug})
+
+			appendCmd := client.MultiAppend("INBOX")
+			for _, msg := range messages {
+				w := appendCmd.Next(int64(len(msg.body)), &imap.AppendOptions{Flags: msg.flags})
+				if _, err := io.WriteString(w, msg.body); err != nil {
+					t.Fatalf("Write() = %v", err)
+				}
+				if err := w.Close(); err != nil {
+					t.Fatalf("Close() = %v", err)
+				}
+			}
+			data, err := appendCmd.Close()
+			if err != nil {
+				t.Fatalf("MultiAppendCommand.Close() = %v", err)
+			}
+
+			if data.UIDValidity == 0 {
+				t.Errorf("UIDValidity = 0")
+			}
+			if s := data.UIDs.String(); s != "1:3" {
+				t.Errorf("UIDs = %v, want 1:3", s)
+			}
+			if data.UID != 0 {
+				t.Errorf("UID = %v, want 0", data.UID)
+			}
+
+			numCmds := len(regexp.MustCompile(`(?m)^T[0-9]+ APPEND `).FindAllString(debug.String(), -1))
+			if numCmds != tc.numCmds {
+				t.Errorf("sent %v APPEND commands, want %v", numCmds, tc.numCmds)
+			}
+			if regexp.MustCompile(`(?m)^\+ `).MatchString(debug.String()) {
+				t.Errorf("server sent a continuation request despite LITERAL+")
+			}
+
+			if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+				t.Fatalf("Select().Wait() = %v", err)
+			}
+			msgs, err := client.Fetch(imap.SeqSetNum(1, 2, 3), &imap.FetchOptions{
+				Flags:       true,
+				BodySection: []*imap.FetchItemBodySection{{Peek: true}},
+			}).Collect()
+			if err != nil {
+				t.Fatalf("Fetch().Collect() = %v", err)
+			}
+			if len(msgs) != len(messages) {
+				t.Fatalf("got %v messages, want %v", len(msgs), len(messages))
+			}
+			for i, msg := range msgs {
+				for _, b := range msg.BodySection {
+					if body := string(b); body != messages[i].body {
+						t.Errorf("message %v: body = %q, want %q", i, body, messages[i].body)
+					}
+				}
+				for _, flag := range messages[i].flags {
+					if !containsFlag(msg.Flags, flag) {
+						t.Errorf("message %v: flags = %v, want %v", i, msg.Flags, flag)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestClient_MultiAppend_tooBig(t *testing.T) {
+	size := int64(len(simpleRawMessage))
+
+	for _, tc := range []struct {
+		name             string
+		appendLimit      uint32
+		multiAppendLimit int64
+	}{
+		{"message", uint32(size - 1), 0},
+		{"total", 0, 2*size + 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			user := imapmemserver.NewUser(testUsername, testPassword)
+			user.Create("INBOX", nil)
+			user.SetAppendLimit(tc.appendLimit)
+			user.SetMultiAppendLimit(tc.multiAppendLimit)
+			dial := newCapsTestServer(t, user, imap.CapSet{imap.CapMultiAppend: {}, imap.CapLiteralPlus: {}})
+			client := dial(nil)
+
+			appendCmd := client.MultiAppend("INBOX")
+			for i := 0; i < 3; i++ {
+				w := appendCmd.Next(size, nil)
+				io.WriteString(w, simpleRawMessage)
+				w.Close()
+			}
+			_, err := appendCmd.Close()
+
+			var imapErr *imap.Error
+			if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeTooBig {
+				t.Fatalf("MultiAppendCommand.Close() = %v, want a TOOBIG error", err)
+			}
+
+			data, err := client.Status("INBOX", &imap.StatusOptions{NumMessages: true}).Wait()
+			if err != nil {
+				t.Fatalf("Status().Wait() = %v", err)
+			}
+			if *data.NumMessages != 0 {
+				t.Errorf("MESSAGES = %v, want 0", *data.NumMessages)
+			}
+		})
+	}
+}
+
+func TestClient_MultiAppend_partialFailure(t *testing.T) {
+	greeting := "* OK [CAPABILITY IMAP4rev1 UIDPLUS] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		for i := 0; i < 3; i++ {
+			tag, _ := readScriptTaggedCommand(t, br, w)
+			if i == 1 {
+				io.WriteString(w, tag+" NO [OVERQUOTA] Quota exceeded\r\n")
+			} else {
+				io.WriteString(w, tag+" OK [APPENDUID 42 "+strconv.Itoa(i+1)+"] APPEND completed\r\n")
+			}
+		}
+	})
+
+	appendCmd := client.MultiAppend("INBOX")
+	for i := 0; i < 3; i++ {
+		w := appendCmd.Next(int64(len(simpleRawMessage)), nil)
+		io.WriteString(w, simpleRawMessage)
+		w.Close()
+	}
+	data, err := appendCmd.Close()
+
+	var multiErr *imapclient.MultiAppendError
+	if !errors.As(err, &multiErr) {
+		t.Fatalf("MultiAppendCommand.Close() = %v, want a *MultiAppendError", err)
+	}
+	if len(multiErr.Stored) != 2 || multiErr.Stored[0] != 0 || multiErr.Stored[1] != 2 {
+		t.Errorf("stored messages = %v, want [0 2]", multiErr.Stored)
+	}
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeOverQuota {
+		t.Errorf("MultiAppendCommand.Close() = %v, want an OVERQUOTA error", err)
+	}
+	if data.UIDValidity != 42 || data.UIDs.String() != "1,3" {
+		t.Errorf("data = %v %v, want 42 1,3", data.UIDValidity, data.UIDs)
+	}
+}
+
+func TestClient_Append_literalRejected(t *testing.T) {
+	greeting := "* OK [CAPABILITY IMAP4rev1] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		// Reject the synchronizing literal instead of sending a continuation
+		// request
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Errorf("ReadString() = %v", err)
+			return
+		}
+		tag, _, _ := strings.Cut(line, " ")
+		io.WriteString(w, tag+" NO [OVERQUOTA] Quota exceeded\r\n")
+	})
+
+	appendCmd := client.Append("INBOX", int64(len(simpleRawMessage)), nil)
+	_, writeErr := appendCmd.Write([]byte(simpleRawMessage))
+	appendCmd.Close()
+	_, err := appendCmd.Wait()
+	if !imapclient.IsOverQuota(err) {
+		t.Errorf("Append().Wait() = %v, want an OVERQUOTA error", err)
+	}
+	if !imapclient.IsOverQuota(writeErr) {
+		t.Errorf("Append().Write() = %v, want an OVERQUOTA error", writeErr)
+	}
+}
+
+func TestClient_Append_binaryUnsupported(t *testing.T) {
+	user := imapmemserver.NewUser(testUsername, testPassword)
+	user.Create("INBOX", nil)
+	dial := newCapsTestServer(t, user, nil)
+	var debugLog lockedBuffer
+	client := dial(&imapclient.Options{DebugLog: &debugLog})
+
+	msg := "Subject: Binary\r\n\r\n\x00"
+	appendCmd := client.Append("INBOX", int64(len(msg)), &imap.AppendOptions{Binary: true})
+	var capErr *imapclient.CapabilityError
+	if _, err := appendCmd.Write([]byte(msg)); !errors.As(err, &capErr) {
+		t.Errorf("AppendCommand.Write() = %v, want a CapabilityError", err)
+	}
+	appendCmd.Close()
+	if _, err := appendCmd.Wait(); !errors.As(err, &capErr) || capErr.Cap != imap.CapBinary {
+		t.Errorf("AppendCommand.Wait() = %v, want a CapabilityError for BINARY", err)
+	}
+
+	appendCmd = client.AppendReader(context.Background(), "INBOX", strings.NewReader(msg), int64(len(msg)), &imap.AppendOptions{Binary: true})
+	if _, err := appendCmd.Wait(); !errors.As(err, &capErr) {
+		t.Errorf("AppendReader().Wait() = %v, want a CapabilityError", err)
+	}
+
+	if strings.Contains(debugLog.String(), "APPEND") {
+		t.Errorf("APPEND command was sent")
+	}
+	// The connection is still usable
+	if err := client.Noop().Wait(); err != nil {
+		t.Errorf("Noop().Wait() = %v", err)
+	}
+}
+
+func TestClient_Append_syntax(t *testing.T) {
+	const body = "Hello"
+	date := time.Date(1996, time.July, 17, 2, 44, 25, 0, time.FixedZone("", -7*60*60))
+
+	type appendTest struct {
+		name     string
+		options  imap.AppendOptions
+		catenate bool
+		want     string
+	}
+	var tests []appendTest
+	for _, flags := range []bool{false, true} {
+		for _, withTime := range []bool{false, true} {
+			for _, data := range []string{"literal", "binary", "utf8"} {
+				for _, catenate := range []bool{false, true} {
+					tc := appendTest{
+						name:     data,
+						catenate: catenate,
+						want:     "APPEND INBOX ",
+					}
+					if flags {
+						tc.name += "_flags"
+						tc.options.Flags = []imap.Flag{imap.FlagSeen, imap.FlagDraft}
+						tc.want += `(\Seen \Draft) `
+					}
+					if withTime {
+						tc.name += "_time"
+						tc.options.Time = date
+						tc.want += `"17-Jul-1996 02:44:25 -0700" `
+					}
+
+					var lit string
+					switch data {
+					case "literal":
+						lit = "{5}\r\n" + body
+						if catenate {
+							lit = "TEXT " + lit
+						}
+					case "binary":
+						tc.options.Binary = true
+						lit = "~{5}\r\n" + body
+						if catenate {
+							lit = "TEXT " + lit
+						}
+					case "utf8":
+						tc.options.UTF8 = true
+						lit = "UTF8 (~{5}\r\n" + body + ")"
+					}
+					if catenate {
+						tc.name += "_catenate"
+						tc.want += `CATENATE (URL "/INBOX/;UID=1" ` + lit + ")"
+					} else {
+						tc.want += lit
+					}
+					tests = append(tests, tc)
+				}
+			}
+		}
+	}
+
+	commands := make(chan string, len(tests))
+	greeting := "* OK [CAPABILITY IMAP4rev1 BINARY UTF8=ACCEPT CATENATE] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		for range tests {
+			tag, args := readScriptTaggedCommand(t, br, w)
+			commands <- args
+			io.WriteString(w, tag+" OK APPEND completed\r\n")
+		}
+	})
+
+	for _, tc := range tests {
+		var err error
+		if tc.catenate {
+			parts := []imap.CatenatePart{
+				imap.CatenateURL(&imap.MessageURL{Mailbox: "INBOX", UID: 1}),
+				imap.CatenateText([]byte(body)),
+			}
+			options := tc.options
+			options.Catenate = parts
+			_, err = client.AppendCatenate("INBOX", nil, &options).Wait()
+		} else {
+			_, err = client.AppendReader(context.Background(), "INBOX", strings.NewReader(body), int64(len(body)), &tc.options).Wait()
+		}
+		if err != nil {
+			t.Fatalf("%v: Wait() = %v", tc.name, err)
+		}
+		if cmd := <-commands; cmd != tc.want {
+			t.Errorf("%v: sent %q, want %q", tc.name, cmd, tc.want)
+		}
+	}
+}
+
+func TestClient_Append_invalidOptions(t *testing.T) {
+	greeting := "* OK [CAPABILITY IMAP4rev1 BINARY CATENATE] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {})
+
+	const msg = "Subject: Test\r\n\r\nHello"
+	for _, tc := range []struct {
+		name    string
+		options imap.AppendOptions
+	}{
+		{"binary_utf8", imap.AppendOptions{Binary: true, UTF8: true}},
+		{"catenate", imap.AppendOptions{Catenate: []imap.CatenatePart{imap.CatenateText([]byte(msg))}}},
+		{"utf8_unsupported", imap.AppendOptions{UTF8: true}},
+	} {
+		_, err := client.AppendReader(context.Background(), "INBOX", strings.NewReader(msg), int64(len(msg)), &tc.options).Wait()
+		if err == nil {
+			t.Errorf("%v: AppendReader().Wait() succeeded", tc.name)
+		}
+	}
+
+	options := &imap.AppendOptions{Binary: true, UTF8: true}
+	if _, err := client.AppendCatenate("INBOX", []imap.CatenatePart{imap.CatenateText([]byte(msg))}, options).Wait(); err == nil {
+		t.Errorf("AppendCatenate().Wait() succeeded with binary UTF-8 data")
+	}
+}
+
+func TestClient_Append_utf8(t *testing.T) {
+	user := imapmemserver.NewUser(testUsername, testPassword)
+	user.Create("INBOX", nil)
+	dial := newCapsTestServer(t, user, imap.CapSet{imap.CapUTF8Accept: {}})
+	client := dial(nil)
+
+	msg := "Subject: Grüße\r\n\r\nHello\r\n"
+	data, err := client.AppendReader(context.Background(), "INBOX", strings.NewReader(msg), int64(len(msg)), &imap.AppendOptions{UTF8: true}).Wait()
+	if err != nil {
+		t.Fatalf("AppendReader().Wait() = %v", err)
+	}
+
+	if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select().Wait() = %v", err)
+	}
+	msgs, err := client.Fetch(imap.UIDSetNum(data.UID), &imap.FetchOptions{
+		BodySection: []*imap.FetchItemBodySection{{Peek: true}},
+	}).Collect()
+	if err != nil {
+		t.Fatalf("Fetch().Collect() = %v", err)
+	} else if len(msgs) != 1 {
+		t.Fatalf("Fetch().Collect() returned %v messages, want 1", len(msgs))
+	}
+	if len(msgs[0].BodySection) != 1 {
+		t.Fatalf("got %v body sections, want 1", len(msgs[0].BodySection))
+	}
+	for _, b := range msgs[0].BodySection {
+		if string(b) != msg {
+			t.Errorf("body = %q, want %q", b, msg)
+		}
+	}
+}
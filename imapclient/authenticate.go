@@ -1,6 +1,7 @@
 package imapclient
 
 import (
+	"encoding/base64"
 	"fmt"
 
 	"github.com/emersion/go-sasl"
@@ -12,7 +13,15 @@ import (
 // Authenticate sends an AUTHENTICATE command.
 //
 // Unlike other commands, this method blocks until the SASL exchange completes.
+//
+// An error is returned without sending any command if the client is already
+// authenticated.
 func (c *Client) Authenticate(saslClient sasl.Client) error {
+	switch c.State() {
+	case imap.ConnStateAuthenticated, imap.ConnStateSelected:
+		return fmt.Errorf("imapclient: already authenticated")
+	}
+
 	mech, initialResp, err := saslClient.Start()
 	if err != nil {
 		return err
@@ -61,6 +70,11 @@ func (c *Client) Authenticate(saslClient sasl.Client) error {
 
 		resp, err := saslClient.Next(challenge)
 		if err != nil {
+			// Cancel the exchange, and wait for the server to acknowledge it
+			if err := c.writeSASLCancel(); err != nil {
+				return err
+			}
+			cmd.wait()
 			return err
 		}
 
@@ -76,7 +90,8 @@ type authenticateCommand struct {
 }
 
 func (c *Client) writeSASLResp(resp []byte) error {
-	respStr := internal.EncodeSASL(resp)
+	// Unlike initial responses, empty responses are sent as empty lines
+	respStr := base64.StdEncoding.EncodeToString(resp)
 	if _, err := c.bw.WriteString(respStr + "\r\n"); err != nil {
 		return err
 	}
@@ -86,6 +101,13 @@ func (c *Client) writeSASLResp(resp []byte) error {
 	return nil
 }
 
+func (c *Client) writeSASLCancel() error {
+	if _, err := c.bw.WriteString("*\r\n"); err != nil {
+		return err
+	}
+	return c.bw.Flush()
+}
+
 // Unauthenticate sends an UNAUTHENTICATE command.
 //
 // This command requires support for the UNAUTHENTICATE extension.
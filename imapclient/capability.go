@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
@@ -38,18 +39,49 @@ func (cmd *CapabilityCommand) Wait() (imap.CapSet, error) {
 }
 
 func readCapabilities(dec *imapwire.Decoder) (imap.CapSet, error) {
+	l, err := internal.ReadCapList(dec)
 	caps := make(imap.CapSet)
-	for dec.SP() {
-		// Some IMAP servers send multiple SP between caps:
-		// https://github.com/emersion/go-imap/pull/652
-		for dec.SP() {
-		}
-
-		var name string
-		if !dec.ExpectAtom(&name) {
-			return caps, fmt.Errorf("in capability-data: %v", dec.Err())
-		}
-		caps[imap.Cap(name)] = struct{}{}
+	for _, c := range l {
+		caps[c] = struct{}{}
 	}
-	return caps, nil
+	return caps, err
+}
+
+// capSetFromCapabilityCode builds a capability set from a CAPABILITY response
+// code.
+func capSetFromCapabilityCode(code imap.CapabilityCode) imap.CapSet {
+	caps := make(imap.CapSet)
+	for _, c := range code.Caps {
+		caps[c] = struct{}{}
+	}
+	return caps
+}
+
+// CapabilityError is returned when a command requires a capability which
+// isn't advertised by the server.
+type CapabilityError struct {
+	Cap imap.Cap
+}
+
+func (err *CapabilityError) Error() string {
+	return fmt.Sprintf("imapclient: server doesn't support %v", err.Cap)
+}
+
+// checkCap returns an error if the server doesn't advertise a capability.
+func (c *Client) checkCap(name imap.Cap) error {
+	caps := c.Caps()
+	if caps == nil {
+		return fmt.Errorf("imapclient: failed to fetch capabilities")
+	}
+	if !caps.Has(name) {
+		return &CapabilityError{Cap: name}
+	}
+	return nil
+}
+
+// failedCommandBase returns a command which has failed without being sent.
+func failedCommandBase(err error) commandBase {
+	done := make(chan error)
+	close(done)
+	return commandBase{done: done, err: err}
 }
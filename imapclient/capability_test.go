@@ -0,0 +1,63 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+func TestClient_Caps_login(t *testing.T) {
+	commands := make(chan string, 8)
+	greeting := "* OK [CAPABILITY IMAP4rev1 AUTH=PLAIN] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		for i := 0; i < 3; i++ {
+			tag, args := readScriptTaggedCommand(t, br, w)
+			commands <- args
+			verb, _, _ := strings.Cut(args, " ")
+			switch verb {
+			case "LOGIN":
+				io.WriteString(w, tag+" OK [CAPABILITY IMAP4rev1 IDLE MOVE UNAUTHENTICATE] Logged in\r\n")
+			case "UNAUTHENTICATE":
+				io.WriteString(w, tag+" OK Unauthenticated\r\n")
+			case "CAPABILITY":
+				io.WriteString(w, "* CAPABILITY IMAP4rev1 AUTH=PLAIN\r\n"+tag+" OK CAPABILITY completed\r\n")
+			}
+		}
+	})
+
+	if !client.HasCap(imap.CapAuthPlain) || client.HasCap(imap.CapMove) {
+		t.Errorf("Caps() = %v before login, want AUTH=PLAIN without MOVE", client.Caps())
+	}
+
+	if err := client.Login(testUsername, testPassword).Wait(); err != nil {
+		t.Fatalf("Login().Wait() = %v", err)
+	}
+	if !client.HasCap(imap.CapMove) || client.HasCap(imap.CapAuthPlain) {
+		t.Errorf("Caps() = %v after login, want MOVE without AUTH=PLAIN", client.Caps())
+	}
+	if verb := <-commands; !strings.HasPrefix(verb, "LOGIN ") {
+		t.Errorf("got command %q, want LOGIN", verb)
+	}
+	select {
+	case cmd := <-commands:
+		t.Errorf("got unexpected command %q", cmd)
+	default:
+	}
+
+	// The tagged OK doesn't contain the capabilities: they are requested
+	// with a CAPABILITY command
+	if err := client.Unauthenticate().Wait(); err != nil {
+		t.Fatalf("Unauthenticate().Wait() = %v", err)
+	}
+	if !client.HasCap(imap.CapAuthPlain) || client.HasCap(imap.CapMove) {
+		t.Errorf("Caps() = %v after UNAUTHENTICATE, want AUTH=PLAIN without MOVE", client.Caps())
+	}
+	for _, want := range []string{"UNAUTHENTICATE", "CAPABILITY"} {
+		if cmd := <-commands; cmd != want {
+			t.Errorf("got command %q, want %q", cmd, want)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package imapclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// AppendCatenate sends an APPEND command with a message assembled from
+// several parts.
+//
+// Text parts are sent as literals, URL parts reference messages or body
+// sections already stored on the server. If the server doesn't support
+// CATENATE, the referenced sections are fetched by the client and the message
+// is sent with a regular APPEND command. In that case, URL parts must
+// reference the currently selected mailbox.
+//
+// If parts is nil, AppendOptions.Catenate is used instead. Text parts are sent
+// as literal8 with AppendOptions.Binary, and with the UTF8 data extension with
+// AppendOptions.UTF8.
+//
+// Errors caused by a specific part are reported as a *CatenateError.
+//
+// Like AppendReader, the returned command has already been sent: the caller
+// only needs to call CatenateCommand.Wait.
+func (c *Client) AppendCatenate(mailbox string, parts []imap.CatenatePart, options *imap.AppendOptions) *CatenateCommand {
+	var opts imap.AppendOptions
+	if options != nil {
+		opts = *options
+	}
+	if parts == nil {
+		parts = opts.Catenate
+	}
+	opts.Catenate = nil
+
+	for i, part := range parts {
+		if (part.Text == nil) == (part.URL == "") {
+			err := &CatenateError{Part: i, Err: fmt.Errorf("imapclient: either URL or Text must be set")}
+			return &CatenateCommand{cmd: &AppendCommand{commandBase: failedCommandBase(err)}}
+		}
+	}
+	if err := c.checkAppendOptions(&opts); err != nil {
+		return &CatenateCommand{cmd: &AppendCommand{commandBase: failedCommandBase(err)}}
+	}
+
+	if !c.Caps().Has(imap.CapCatenate) {
+		return c.appendCatenateFallback(mailbox, parts, &opts)
+	}
+
+	cmd := &CatenateCommand{parts: parts, rejectedPart: -1}
+	cmd.cmd = &AppendCommand{}
+	enc := c.beginCommand("APPEND", cmd.cmd)
+	enc.SP().Mailbox(mailbox).SP()
+	writeAppendOptions(enc, &opts)
+	enc.Atom("CATENATE").SP().Special('(')
+	for i, part := range parts {
+		if i > 0 {
+			enc.SP()
+		}
+		if part.Text == nil {
+			enc.Atom("URL").SP().String(part.URL)
+			continue
+		}
+
+		if !opts.UTF8 {
+			enc.Atom("TEXT").SP()
+		}
+		wc := writeAppendLiteral(enc, part.Size, &opts)
+		if _, err := wc.Write(nil); err != nil {
+			// The server has rejected the literal
+			cmd.rejectedPart = i
+			break
+		}
+		_, err := io.CopyN(wc, part.Text, part.Size)
+		if err == nil {
+			err = wc.Close()
+		}
+		if err != nil {
+			c.abort(fmt.Errorf("imapclient: failed to send CATENATE part %v: %w", i, err))
+			break
+		}
+	}
+	enc.Special(')')
+	enc.end()
+	return cmd
+}
+
+func (c *Client) appendCatenateFallback(mailbox string, parts []imap.CatenatePart, options *imap.AppendOptions) *CatenateCommand {
+	cmd := &CatenateCommand{parts: parts, rejectedPart: -1}
+
+	readers := make([]io.Reader, len(parts))
+	var size int64
+	for i, part := range parts {
+		if part.Text != nil {
+			readers[i] = io.LimitReader(part.Text, part.Size)
+			size += part.Size
+			continue
+		}
+
+		b, err := c.fetchMessageURL(part.URL)
+		if err != nil {
+			cmd.cmd = &AppendCommand{commandBase: failedCommandBase(&CatenateError{Part: i, Err: err})}
+			return cmd
+		}
+		readers[i] = bytes.NewReader(b)
+		size += int64(len(b))
+	}
+
+	cmd.cmd = c.AppendReader(context.Background(), mailbox, io.MultiReader(readers...), size, options)
+	return cmd
+}
+
+// fetchMessageURL fetches the data referenced by a message URL in the
+// currently selected mailbox.
+func (c *Client) fetchMessageURL(s string) ([]byte, error) {
+	u, err := imap.ParseMessageURL(s)
+	if err != nil {
+		return nil, err
+	}
+
+	mbox := c.Mailbox()
+	if mbox == nil || notifyHandlerKey(mbox.Name) != notifyHandlerKey(u.Mailbox) {
+		return nil, fmt.Errorf("imapclient: mailbox %q referenced by URL isn't selected", u.Mailbox)
+	}
+	if u.UIDValidity != 0 && u.UIDValidity != mbox.UIDValidity {
+		return nil, fmt.Errorf("imapclient: URL UIDVALIDITY %v doesn't match mailbox UIDVALIDITY %v", u.UIDValidity, mbox.UIDValidity)
+	}
+
+	section, err := parseURLSection(u.Section)
+	if err != nil {
+		return nil, err
+	}
+	section.Peek = true
+	msgs, err := c.Fetch(imap.UIDSetNum(u.UID), &imap.FetchOptions{
+		UID:         true,
+		BodySection: []*imap.FetchItemBodySection{section},
+	}).Collect()
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range msgs {
+		for _, b := range msg.BodySection {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("imapclient: message referenced by URL not found")
+}
+
+// parseURLSection parses the section of an IMAP URL, e.g. "1.2.HEADER".
+func parseURLSection(s string) (*imap.FetchItemBodySection, error) {
+	var section imap.FetchItemBodySection
+	for s != "" {
+		part, rest, _ := strings.Cut(s, ".")
+		n, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			break
+		}
+		section.Part = append(section.Part, int(n))
+		s = rest
+	}
+
+	spec, fields, hasFields := strings.Cut(s, " ")
+	switch spec := imap.PartSpecifier(strings.ToUpper(spec)); spec {
+	case imap.PartSpecifierNone, imap.PartSpecifierHeader, imap.PartSpecifierMIME, imap.PartSpecifierText:
+		section.Specifier = spec
+	case "HEADER.FIELDS", "HEADER.FIELDS.NOT":
+		fields = strings.TrimSuffix(strings.TrimPrefix(fields, "("), ")")
+		if !hasFields || fields == "" {
+			return nil, fmt.Errorf("imapclient: missing header fields in URL section")
+		}
+		section.Specifier = imap.PartSpecifierHeader
+		if spec == "HEADER.FIELDS" {
+			section.HeaderFields = strings.Fields(fields)
+		} else {
+			section.HeaderFieldsNot = strings.Fields(fields)
+		}
+		return &section, nil
+	default:
+		return nil, fmt.Errorf("imapclient: unsupported URL section %q", s)
+	}
+	if hasFields {
+		return nil, fmt.Errorf("imapclient: unsupported URL section %q", s)
+	}
+	return &section, nil
+}
+
+// CatenateCommand is an APPEND command with the CATENATE extension.
+type CatenateCommand struct {
+	cmd          *AppendCommand
+	parts        []imap.CatenatePart
+	rejectedPart int // text part being sent when the server failed the command
+}
+
+func (cmd *CatenateCommand) Wait() (*imap.AppendData, error) {
+	data, err := cmd.cmd.Wait()
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) {
+		return data, err
+	}
+
+	switch imapErr.Code {
+	case imap.ResponseCodeBadURL:
+		codeData, _ := (*imap.StatusResponse)(imapErr).CodeData()
+		if badURL, ok := codeData.(imap.BadURLCode); ok {
+			url := strings.Trim(badURL.URL, `"`)
+			for i, part := range cmd.parts {
+				if part.Text == nil && part.URL == url {
+					return data, &CatenateError{Part: i, Err: err}
+				}
+			}
+		}
+		return data, &CatenateError{Part: -1, Err: err}
+	case imap.ResponseCodeTooBig:
+		return data, &CatenateError{Part: cmd.rejectedPart, Err: err}
+	}
+	return data, err
+}
+
+// CatenateError is an error caused by a part of a CATENATE command.
+type CatenateError struct {
+	// Index of the offending part, or -1 if unknown
+	Part int
+	Err  error
+}
+
+func (err *CatenateError) Error() string {
+	if err.Part < 0 {
+		return fmt.Sprintf("imapclient: CATENATE failed: %v", err.Err)
+	}
+	return fmt.Sprintf("imapclient: CATENATE part %v failed: %v", err.Part, err.Err)
+}
+
+func (err *CatenateError) Unwrap() error {
+	return err.Err
+}
@@ -0,0 +1,142 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+func TestClient_AppendCatenate_fallback(t *testing.T) {
+	user := imapmemserver.NewUser(testUsername, testPassword)
+	user.Create("INBOX", nil)
+	user.Create("Sent", nil)
+	dial := newCapsTestServer(t, user, nil)
+	client := dial(nil)
+
+	uid := appendTestMessage(t, client)
+	selectData, err := client.Select("INBOX", nil).Wait()
+	if err != nil {
+		t.Fatalf("Select().Wait() = %v", err)
+	}
+
+	u := &imap.MessageURL{
+		Mailbox:     "INBOX",
+		UIDValidity: selectData.UIDValidity,
+		UID:         uid,
+		Section:     "TEXT",
+	}
+	if s, err := imap.ParseMessageURL(u.String()); err != nil || *s != *u {
+		t.Fatalf("ParseMessageURL(%q) = %v, %v, want %v", u.String(), s, err, u)
+	}
+
+	parts := []imap.CatenatePart{
+		imap.CatenateText([]byte("Subject: Fwd\r\n\r\n")),
+		imap.CatenateURL(u),
+		{Text: strings.NewReader("\r\n-- \r\nSignature\r\n"), Size: 18},
+	}
+	if _, err := client.AppendCatenate("Sent", parts, nil).Wait(); err != nil {
+		t.Fatalf("AppendCatenate().Wait() = %v", err)
+	}
+
+	if _, err := client.Select("Sent", nil).Wait(); err != nil {
+		t.Fatalf("Select().Wait() = %v", err)
+	}
+	msgs, err := client.Fetch(imap.SeqSetNum(1), &imap.FetchOptions{
+		BodySection: []*imap.FetchItemBodySection{{Peek: true}},
+	}).Collect()
+	if err != nil {
+		t.Fatalf("Fetch().Collect() = %v", err)
+	} else if len(msgs) != 1 {
+		t.Fatalf("got %v messages, want 1", len(msgs))
+	}
+	want := "Subject: Fwd\r\n\r\nThis is my letter!\r\n-- \r\nSignature\r\n"
+	for _, b := range msgs[0].BodySection {
+		if string(b) != want {
+			t.Errorf("body = %q, want %q", b, want)
+		}
+	}
+}
+
+func TestClient_AppendCatenate_fallbackNotSelected(t *testing.T) {
+	user := imapmemserver.NewUser(testUsername, testPassword)
+	user.Create("INBOX", nil)
+	dial := newCapsTestServer(t, user, nil)
+	client := dial(nil)
+
+	parts := []imap.CatenatePart{
+		imap.CatenateText([]byte("Subject: Fwd\r\n\r\n")),
+		imap.CatenateURL(&imap.MessageURL{Mailbox: "INBOX", UID: 1}),
+	}
+	_, err := client.AppendCatenate("INBOX", parts, nil).Wait()
+	var catErr *imapclient.CatenateError
+	if !errors.As(err, &catErr) || catErr.Part != 1 {
+		t.Errorf("AppendCatenate().Wait() = %v, want a *CatenateError for part 1", err)
+	}
+}
+
+func TestClient_AppendCatenate_badURL(t *testing.T) {
+	commands := make(chan string, 1)
+	greeting := "* OK [CAPABILITY IMAP4rev1 CATENATE] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, args := readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, tag+" NO [BADURL /Drafts;UIDVALIDITY=7/;UID=20/;SECTION=TEXT] Unknown message\r\n")
+	})
+
+	parts := []imap.CatenatePart{
+		imap.CatenateText([]byte("Subject: Hi\r\n\r\n")),
+		imap.CatenateURL(&imap.MessageURL{Mailbox: "INBOX", UID: 3}),
+		imap.CatenateURL(&imap.MessageURL{Mailbox: "Drafts", UIDValidity: 7, UID: 20, Section: "TEXT"}),
+	}
+	_, err := client.AppendCatenate("Sent", parts, &imap.AppendOptions{Flags: []imap.Flag{imap.FlagSeen}}).Wait()
+
+	want := "APPEND \"Sent\" (\\Seen) CATENATE (TEXT {15}\r\nSubject: Hi\r\n\r\n URL \"/INBOX/;UID=3\" URL \"/Drafts;UIDVALIDITY=7/;UID=20/;SECTION=TEXT\")"
+	if cmd := <-commands; cmd != want {
+		t.Errorf("command = %q, want %q", cmd, want)
+	}
+
+	var catErr *imapclient.CatenateError
+	if !errors.As(err, &catErr) {
+		t.Fatalf("AppendCatenate().Wait() = %v, want a *CatenateError", err)
+	}
+	if catErr.Part != 2 {
+		t.Errorf("CatenateError.Part = %v, want 2", catErr.Part)
+	}
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeBadURL {
+		t.Errorf("AppendCatenate().Wait() = %v, want a BADURL error", err)
+	}
+}
+
+func TestClient_AppendCatenate_tooBig(t *testing.T) {
+	greeting := "* OK [CAPABILITY IMAP4rev1 CATENATE] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Errorf("ReadString() = %v", err)
+			return
+		}
+		tag, _, _ := strings.Cut(line, " ")
+		io.WriteString(w, tag+" NO [TOOBIG] Message too big\r\n")
+	})
+
+	parts := []imap.CatenatePart{
+		imap.CatenateURL(&imap.MessageURL{Mailbox: "INBOX", UID: 3}),
+		imap.CatenateText(make([]byte, 4096)),
+	}
+	_, err := client.AppendCatenate("Sent", parts, nil).Wait()
+
+	var catErr *imapclient.CatenateError
+	if !errors.As(err, &catErr) {
+		t.Fatalf("AppendCatenate().Wait() = %v, want a *CatenateError", err)
+	}
+	if catErr.Part != 1 {
+		t.Errorf("CatenateError.Part = %v, want 1", catErr.Part)
+	}
+}
@@ -3,9 +3,10 @@
 // # Charset decoding
 //
 // By default, only basic charset decoding is performed. For non-UTF-8 decoding
-// of message subjects and e-mail address names, users can set
-// Options.WordDecoder. For instance, to use go-message's collection of
-// charsets:
+// of message subjects, e-mail address names and body structure parameters,
+// users can set Options.WordDecoder, without registering charsets globally.
+// Encoded-words using an unknown charset are left undecoded. For instance, to
+// use go-message's collection of charsets:
 //
 //	import (
 //		"mime"
@@ -17,16 +18,35 @@
 //		WordDecoder: &mime.WordDecoder{CharsetReader: charset.Reader},
 //	}
 //	client, err := imapclient.DialTLS("imap.example.org:993", options)
+//
+// # Mailbox names
+//
+// Mailbox names are always UTF-8 strings. They are transparently encoded to
+// and decoded from modified UTF-7, unless the server is in UTF-8 mode: after
+// IMAP4rev2 or UTF8=ACCEPT has been enabled with Client.Enable.
+//
+// # Errors
+//
+// Commands failed by the server return an *imap.Error, which can be extracted
+// with errors.As. It contains the status (NO or BAD), the response code and
+// its arguments, and the human-readable text sent by the server. Helpers such
+// as IsTryCreate and IsOverQuota check for common response codes.
+//
+// If the server closes the connection with an untagged BYE response, pending
+// commands fail with an *imap.Error whose type is BYE.
 package imapclient
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"mime"
 	"net"
+	"os"
+	"regexp"
 	"runtime/debug"
 	"strconv"
 	"strings"
@@ -45,18 +65,30 @@ const (
 
 	cmdWriteTimeout     = 30 * time.Second
 	literalWriteTimeout = 5 * time.Minute
+
+	tlsHandshakeTimeout = 30 * time.Second
 )
 
-var dialer = &net.Dialer{
+var defaultDialer = &net.Dialer{
 	Timeout: 30 * time.Second,
 }
 
+// ContextDialer dials network connections.
+//
+// *net.Dialer and the dialers returned by golang.org/x/net/proxy implement
+// this interface.
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
 // SelectedMailbox contains metadata for the currently selected mailbox.
 type SelectedMailbox struct {
 	Name           string
+	UIDValidity    uint32
 	NumMessages    uint32
 	Flags          []imap.Flag
 	PermanentFlags []imap.Flag
+	ReadOnly       bool
 }
 
 func (mbox *SelectedMailbox) copy() *SelectedMailbox {
@@ -68,18 +100,82 @@ func (mbox *SelectedMailbox) copy() *SelectedMailbox {
 type Options struct {
 	// TLS configuration for use by DialTLS and DialStartTLS. If nil, the
 	// default configuration is used.
+	//
+	// VerifyPeerCertificate and VerifyConnection can be used to pin the
+	// server certificate.
 	TLSConfig *tls.Config
+	// TLSHandshakeTimeout is the maximum amount of time to wait for the TLS
+	// handshake performed by DialTLS and STARTTLS. It doesn't include the
+	// time needed to establish the TCP connection. If zero, 30 seconds is
+	// used.
+	TLSHandshakeTimeout time.Duration
+	// Dialer is used by DialInsecure, DialTLS and DialStartTLS to connect to
+	// the server, e.g. through a SOCKS5 proxy. If nil, a net.Dialer with a
+	// 30 seconds timeout is used.
+	Dialer ContextDialer
+	// ReadTimeout is the maximum amount of time to wait for data from the
+	// server while a command is pending. It doesn't apply while no command is
+	// pending or while idling. If the server doesn't send anything in time,
+	// the connection is closed and pending commands fail with an error
+	// wrapping ErrConnStale. If zero, there is no timeout.
+	//
+	// Since it also applies while a command is being sent, it needs to be
+	// larger than the time needed to send large literals.
+	ReadTimeout time.Duration
+	// KeepAlive is the interval of inactivity after which a NOOP command is
+	// sent to check that the connection is still alive. No NOOP is sent while
+	// idling: IDLE already keeps the connection active. If the NOOP isn't
+	// answered within ReadTimeout (or KeepAlive if ReadTimeout is zero), the
+	// connection is closed and pending commands fail with an error wrapping
+	// ErrConnStale. If zero, no NOOP is sent.
+	KeepAlive time.Duration
+	// MaxPipelinedCommands is the maximum number of commands sent to the
+	// server and waiting for a reply. Additional commands are queued until a
+	// reply is received, see Client.WithPriority. APPEND, AUTHENTICATE and
+	// IDLE commands are never pipelined with other commands. If zero, the
+	// number of commands in flight is unlimited.
+	MaxPipelinedCommands int
 	// Raw ingress and egress data will be written to this writer, if any.
 	// Note, this may include sensitive information such as credentials used
 	// during authentication.
 	DebugWriter io.Writer
+	// A human-readable log of the data exchanged with the server will be
+	// written to this writer, if any. Each line is prefixed with a timestamp
+	// and "C: " or "S: " depending on the direction. Unlike DebugWriter,
+	// the LOGIN password, the AUTHENTICATE responses and authorization
+	// tokens sent with ID are redacted, and literals are truncated.
+	DebugLog io.Writer
+	// DebugLogLiteralSize is the maximum number of bytes of each literal
+	// written to DebugLog. If zero, 256 is used. If negative, literals are
+	// not truncated.
+	DebugLogLiteralSize int
 	// Unilateral data handler.
 	UnilateralDataHandler *UnilateralDataHandler
 	// Decoder for RFC 2047 words.
 	WordDecoder *mime.WordDecoder
+	// SpecialUseNames is used by Client.SpecialUseMailboxes to guess the
+	// special-use mailboxes by name. Names are compared case-insensitively,
+	// and the first existing mailbox wins. If nil, DefaultSpecialUseNames is
+	// used.
+	SpecialUseNames map[imap.MailboxAttr][]string
+	// StatusConcurrency is the maximum number of STATUS commands sent in
+	// parallel by Client.Statuses when the server doesn't support
+	// LIST-STATUS. If zero, 16 is used.
+	StatusConcurrency int
 }
 
-func (options *Options) wrapReadWriter(rw io.ReadWriter) io.ReadWriter {
+func (options *Options) wrapReadWriter(rw io.ReadWriter, log *debugLog) io.ReadWriter {
+	if log != nil {
+		rw = struct {
+			io.Reader
+			io.Writer
+		}{
+			Reader: io.TeeReader(rw, &log.server),
+			// Log before sending, so that the log isn't reordered with
+			// the server's reply
+			Writer: io.MultiWriter(&log.client, rw),
+		}
+	}
 	if options.DebugWriter == nil {
 		return rw
 	}
@@ -92,6 +188,8 @@ func (options *Options) wrapReadWriter(rw io.ReadWriter) io.ReadWriter {
 	}
 }
 
+// decodeText decodes RFC 2047 encoded-words. On error, the words which can't
+// be decoded, e.g. because their charset is unknown, are left as-is.
 func (options *Options) decodeText(s string) (string, error) {
 	wordDecoder := options.WordDecoder
 	if wordDecoder == nil {
@@ -99,11 +197,41 @@ func (options *Options) decodeText(s string) (string, error) {
 	}
 	out, err := wordDecoder.DecodeHeader(s)
 	if err != nil {
-		return s, err
+		return decodeWords(wordDecoder, s), err
 	}
 	return out, nil
 }
 
+var encodedWordRegexp = regexp.MustCompile(`=\?[^?\s]+\?[bBqQ]\?[^?\s]*\?=`)
+
+// decodeWords decodes the encoded-words of s one by one.
+func decodeWords(wordDecoder *mime.WordDecoder, s string) string {
+	var (
+		sb          strings.Builder
+		prevDecoded bool
+		last        int
+	)
+	for _, loc := range encodedWordRegexp.FindAllStringIndex(s, -1) {
+		between := s[last:loc[0]]
+		word := s[loc[0]:loc[1]]
+		last = loc[1]
+
+		decoded, err := wordDecoder.Decode(word)
+		// White space between adjacent encoded-words is ignored
+		if !prevDecoded || err != nil || strings.TrimSpace(between) != "" {
+			sb.WriteString(between)
+		}
+		if err != nil {
+			sb.WriteString(word)
+		} else {
+			sb.WriteString(decoded)
+		}
+		prevDecoded = err == nil
+	}
+	sb.WriteString(s[last:])
+	return sb.String()
+}
+
 func (options *Options) unilateralDataHandler() *UnilateralDataHandler {
 	if options.UnilateralDataHandler == nil {
 		return &UnilateralDataHandler{}
@@ -111,6 +239,28 @@ func (options *Options) unilateralDataHandler() *UnilateralDataHandler {
 	return options.UnilateralDataHandler
 }
 
+func (options *Options) statusConcurrency() int {
+	if options.StatusConcurrency > 0 {
+		return options.StatusConcurrency
+	}
+	return 16
+}
+
+func (options *Options) tlsHandshakeTimeout() time.Duration {
+	if options != nil && options.TLSHandshakeTimeout > 0 {
+		return options.TLSHandshakeTimeout
+	}
+	return tlsHandshakeTimeout
+}
+
+func (options *Options) dial(ctx context.Context, address string) (net.Conn, error) {
+	var d ContextDialer = defaultDialer
+	if options != nil && options.Dialer != nil {
+		d = options.Dialer
+	}
+	return d.DialContext(ctx, "tcp", address)
+}
+
 func (options *Options) tlsConfig() *tls.Config {
 	if options != nil && options.TLSConfig != nil {
 		return options.TLSConfig.Clone()
@@ -132,8 +282,18 @@ func (options *Options) tlsConfig() *tls.Config {
 // pipelining (see above). Additionally, some commands (e.g. StartTLS,
 // Authenticate, Idle) block the client during their execution.
 type Client struct {
+	*clientState
+
+	priority CommandPriority // see Client.WithPriority
+}
+
+// clientState is the state of a connection, shared by the Client values
+// returned by Client.WithPriority.
+type clientState struct {
 	conn     net.Conn
 	options  Options
+	rw       io.ReadWriter // transport below the debug writer and compression
+	debugLog *debugLog
 	br       *bufio.Reader
 	bw       *bufio.Writer
 	dec      *imapwire.Decoder
@@ -145,22 +305,54 @@ type Client struct {
 
 	decCh  chan struct{}
 	decErr error
+	byeErr error // untagged BYE received after the greeting
 
 	mutex        sync.Mutex
 	state        imap.ConnState
 	caps         imap.CapSet
 	enabled      imap.CapSet
 	pendingCapCh chan struct{}
+	capsGen      uint64 // incremented each time caps are invalidated
 	mailbox      *SelectedMailbox
 	cmdTag       uint64
 	pendingCmds  []command
 	contReqs     []continuationRequest
+	idler        *Idler
+	tlsConn      *tls.Conn
+	serverID     *imap.IDData
+	cmdTimeout   time.Duration
+	lastActive   time.Time // last time a command was sent or a response was received
+	pipeline     pipeline
+	abortErr     error
+	compressed   bool
 	closed       bool
+
+	// Send the CONDSTORE parameter with SELECT, see Client.EnableCondStore
+	selectCondStore bool
+
+	// A search result has been saved in the selected mailbox with SEARCH
+	// SAVE. searchResDone is closed once the last SEARCH SAVE command has
+	// completed.
+	searchRes     bool
+	searchResDone chan struct{}
+
+	// Number of commands sent which aren't idempotent, see
+	// ResilientClient.Do
+	numNonIdempotent uint64
+
+	notifyHandlers map[string]*NotifyHandler
+
+	handlers updateHandlers
+	updates  *updateQueue
+	view     *MailboxView
 }
 
 // New creates a new IMAP client.
 //
-// This function doesn't perform I/O.
+// This function doesn't perform I/O. The server greeting is read in the
+// background: WaitGreeting returns an error if the server rejected the
+// connection with a BYE greeting. If the server sent a PREAUTH greeting, the
+// client starts in the authenticated state.
 //
 // A nil options pointer is equivalent to a zero options value.
 func New(conn net.Conn, options *Options) *Client {
@@ -168,22 +360,34 @@ func New(conn net.Conn, options *Options) *Client {
 		options = &Options{}
 	}
 
-	rw := options.wrapReadWriter(conn)
+	debugLog := newDebugLog(options)
+	rw := options.wrapReadWriter(conn, debugLog)
 	br := bufio.NewReader(rw)
 	bw := bufio.NewWriter(rw)
 
-	client := &Client{
+	client := &Client{clientState: &clientState{
 		conn:       conn,
 		options:    *options,
+		rw:         conn,
+		debugLog:   debugLog,
 		br:         br,
 		bw:         bw,
 		dec:        imapwire.NewDecoder(br, imapwire.ConnSideClient),
 		greetingCh: make(chan struct{}),
 		decCh:      make(chan struct{}),
+		updates:    newUpdateQueue(),
 		state:      imap.ConnStateNone,
 		enabled:    make(imap.CapSet),
+		lastActive: time.Now(),
+	}}
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		client.tlsConn = tlsConn
 	}
 	go client.read()
+	go client.updates.run()
+	if options.KeepAlive > 0 {
+		go client.keepAlive(options.KeepAlive)
+	}
 	return client
 }
 
@@ -191,12 +395,23 @@ func New(conn net.Conn, options *Options) *Client {
 //
 // A nil options pointer is equivalent to a zero options value.
 func NewStartTLS(conn net.Conn, options *Options) (*Client, error) {
+	return newStartTLS(context.Background(), conn, options)
+}
+
+func newStartTLS(ctx context.Context, conn net.Conn, options *Options) (*Client, error) {
 	if options == nil {
 		options = &Options{}
 	}
 
 	client := New(conn, options)
-	if err := client.startTLS(options.TLSConfig); err != nil {
+	stop := client.WatchContext(ctx)
+	err := client.startTLS(options.TLSConfig, options.tlsHandshakeTimeout())
+	stop()
+	if err == nil {
+		// The context may have been cancelled right after the handshake
+		err = ctx.Err()
+	}
+	if err != nil {
 		conn.Close()
 		return nil, err
 	}
@@ -211,30 +426,84 @@ func NewStartTLS(conn net.Conn, options *Options) (*Client, error) {
 }
 
 // DialInsecure connects to an IMAP server without any encryption at all.
+//
+// An error is returned if the server rejects the connection with a BYE
+// greeting.
 func DialInsecure(address string, options *Options) (*Client, error) {
-	conn, err := net.Dial("tcp", address)
+	conn, err := options.dial(context.Background(), address)
 	if err != nil {
 		return nil, err
 	}
-	return New(conn, options), nil
+	return newAndWaitGreeting(context.Background(), conn, options)
 }
 
 // DialTLS connects to an IMAP server with implicit TLS.
+//
+// An error is returned if the server rejects the connection with a BYE
+// greeting.
 func DialTLS(address string, options *Options) (*Client, error) {
+	return DialTLSContext(context.Background(), address, options)
+}
+
+// DialTLSContext connects to an IMAP server with implicit TLS.
+//
+// The context is used to dial and to perform the TLS handshake. Once the
+// client is returned, the context has no effect.
+func DialTLSContext(ctx context.Context, address string, options *Options) (*Client, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
 	tlsConfig := options.tlsConfig()
 	if tlsConfig.NextProtos == nil {
 		tlsConfig.NextProtos = []string{"imap"}
 	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = host
+	}
+
+	conn, err := options.dial(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := handshakeTLSContext(ctx, tlsConn, conn, options.tlsHandshakeTimeout()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return newAndWaitGreeting(ctx, tlsConn, options)
+}
 
-	conn, err := tls.DialWithDialer(dialer, "tcp", address, tlsConfig)
+// newAndWaitGreeting creates a new client and waits for the server greeting.
+// An error is returned if the server rejects the connection with a BYE
+// greeting.
+func newAndWaitGreeting(ctx context.Context, conn net.Conn, options *Options) (*Client, error) {
+	client := New(conn, options)
+	stop := client.WatchContext(ctx)
+	err := client.WaitGreeting()
+	stop()
+	if err == nil {
+		err = ctx.Err()
+	}
 	if err != nil {
+		client.Close()
 		return nil, err
 	}
-	return New(conn, options), nil
+	return client, nil
 }
 
 // DialStartTLS connects to an IMAP server with STARTTLS.
 func DialStartTLS(address string, options *Options) (*Client, error) {
+	return DialStartTLSContext(context.Background(), address, options)
+}
+
+// DialStartTLSContext connects to an IMAP server with STARTTLS.
+//
+// The context is used to dial, to send the STARTTLS command and to perform the
+// TLS handshake. Once the client is returned, the context has no effect.
+func DialStartTLSContext(ctx context.Context, address string, options *Options) (*Client, error) {
 	if options == nil {
 		options = &Options{}
 	}
@@ -244,7 +513,7 @@ func DialStartTLS(address string, options *Options) (*Client, error) {
 		return nil, err
 	}
 
-	conn, err := dialer.Dial("tcp", address)
+	conn, err := options.dial(ctx, address)
 	if err != nil {
 		return nil, err
 	}
@@ -255,7 +524,33 @@ func DialStartTLS(address string, options *Options) (*Client, error) {
 	}
 	newOptions := *options
 	newOptions.TLSConfig = tlsConfig
-	return NewStartTLS(conn, &newOptions)
+	return newStartTLS(ctx, conn, &newOptions)
+}
+
+// handshakeTLS performs a TLS handshake with a timeout. The deadline is set on
+// the underlying connection.
+func handshakeTLS(tlsConn *tls.Conn, conn net.Conn, timeout time.Duration) error {
+	return handshakeTLSContext(context.Background(), tlsConn, conn, timeout)
+}
+
+func handshakeTLSContext(ctx context.Context, tlsConn *tls.Conn, conn net.Conn, timeout time.Duration) error {
+	conn.SetDeadline(time.Now().Add(timeout))
+	defer conn.SetDeadline(time.Time{})
+	return tlsConn.HandshakeContext(ctx)
+}
+
+// TLSConnectionState returns the state of the TLS connection, if any.
+//
+// ok is false if the connection doesn't use TLS, e.g. before STARTTLS.
+func (c *Client) TLSConnectionState() (state tls.ConnectionState, ok bool) {
+	c.mutex.Lock()
+	tlsConn := c.tlsConn
+	c.mutex.Unlock()
+
+	if tlsConn == nil {
+		return tls.ConnectionState{}, false
+	}
+	return tlsConn.ConnectionState(), true
 }
 
 func (c *Client) setReadTimeout(dur time.Duration) {
@@ -266,6 +561,22 @@ func (c *Client) setReadTimeout(dur time.Duration) {
 	}
 }
 
+// resetReadTimeoutLocked sets the read deadline used while waiting for the
+// next response: Options.ReadTimeout applies if a command other than IDLE is
+// pending. It must be called with the mutex locked.
+func (c *Client) resetReadTimeoutLocked() {
+	dur := idleReadTimeout
+	if c.options.ReadTimeout > 0 {
+		for _, cmd := range c.pendingCmds {
+			if _, ok := cmd.(*idleCommand); !ok {
+				dur = c.options.ReadTimeout
+				break
+			}
+		}
+	}
+	c.setReadTimeout(dur)
+}
+
 func (c *Client) setWriteTimeout(dur time.Duration) {
 	if dur > 0 {
 		c.conn.SetWriteDeadline(time.Now().Add(dur))
@@ -283,78 +594,125 @@ func (c *Client) State() imap.ConnState {
 
 func (c *Client) setState(state imap.ConnState) {
 	c.mutex.Lock()
+	unselected := c.state == imap.ConnStateSelected && state != imap.ConnStateSelected
 	c.state = state
 	if c.state != imap.ConnStateSelected {
 		c.mailbox = nil
+		c.searchRes = false
 	}
+	view := c.view
 	c.mutex.Unlock()
+
+	if unselected && view != nil {
+		view.handleUnselect()
+	}
+}
+
+// mailboxView returns the attached MailboxView, if any.
+func (c *Client) mailboxView() *MailboxView {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.view
 }
 
 // Caps returns the capabilities advertised by the server.
 //
-// When the server hasn't sent the capability list, this method will request it
-// and block until it's received. If the capabilities cannot be fetched, nil is
-// returned.
+// The capabilities are updated whenever the server sends them: in the
+// greeting, in an untagged CAPABILITY response or in a CAPABILITY response
+// code (e.g. in the reply to LOGIN). They are invalidated when they may
+// change, after STARTTLS, LOGIN, AUTHENTICATE and UNAUTHENTICATE. When the
+// capabilities are unknown, this method will request them with a CAPABILITY
+// command and block until the reply is received. If the capabilities cannot be
+// fetched, nil is returned.
+//
+// The returned set must not be modified. This method is safe for concurrent
+// use.
 func (c *Client) Caps() imap.CapSet {
 	if err := c.WaitGreeting(); err != nil {
 		return nil
 	}
 
-	c.mutex.Lock()
-	caps := c.caps
-	capCh := c.pendingCapCh
-	c.mutex.Unlock()
+	timer := time.NewTimer(respReadTimeout)
+	defer timer.Stop()
+	for {
+		c.mutex.Lock()
+		caps := c.caps
+		capCh := c.pendingCapCh
+		gen := c.capsGen
+		fetch := caps == nil && capCh == nil
+		if fetch {
+			capCh = make(chan struct{})
+			c.pendingCapCh = capCh
+		}
+		c.mutex.Unlock()
 
-	if caps != nil {
-		return caps
-	}
+		if caps != nil {
+			return caps
+		}
+
+		if fetch {
+			capCmd := c.Capability()
+			go func() {
+				capCmd.Wait()
+				c.mutex.Lock()
+				if c.pendingCapCh == capCh {
+					c.pendingCapCh = nil
+				}
+				c.mutex.Unlock()
+				close(capCh)
+			}()
+		}
+
+		select {
+		case <-timer.C:
+			return nil
+		case <-capCh:
+			// ok
+		}
 
-	if capCh == nil {
-		capCmd := c.Capability()
-		capCh := make(chan struct{})
-		go func() {
-			capCmd.Wait()
-			close(capCh)
-		}()
 		c.mutex.Lock()
-		c.pendingCapCh = capCh
+		caps = c.caps
+		invalidated := c.capsGen != gen
 		c.mutex.Unlock()
-	}
 
-	timer := time.NewTimer(respReadTimeout)
-	defer timer.Stop()
-	select {
-	case <-timer.C:
-		return nil
-	case <-capCh:
-		// ok
+		if caps != nil || !invalidated {
+			return caps
+		}
+		// The capabilities have been invalidated while we were waiting for
+		// the reply, try again
 	}
+}
 
-	// TODO: this is racy if caps are reset before we get the reply
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-	return c.caps
+// HasCap checks whether the server advertises a capability.
+//
+// See Caps for details.
+func (c *Client) HasCap(cap imap.Cap) bool {
+	return c.Caps().Has(cap)
 }
 
+// setCaps updates the capabilities. A nil set invalidates the capabilities:
+// they will be requested the next time Caps is called.
 func (c *Client) setCaps(caps imap.CapSet) {
-	// If the capabilities are being reset, request the updated capabilities
-	// from the server
-	var capCh chan struct{}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.caps = caps
 	if caps == nil {
-		capCh = make(chan struct{})
-
-		// We need to send the CAPABILITY command in a separate goroutine:
-		// setCaps might be called with Client.encMutex locked
-		go func() {
-			c.Capability().Wait()
-			close(capCh)
-		}()
+		c.capsGen++
+		c.pendingCapCh = nil
 	}
+	c.dec.MailboxUTF8 = c.mailboxUTF8Locked()
+}
 
-	c.mutex.Lock()
-	c.caps = caps
-	c.pendingCapCh = capCh
-	c.mutex.Unlock()
+// mailboxUTF8Locked reports whether mailbox names are exchanged as UTF-8
+// rather than modified UTF-7. Servers supporting both IMAP4rev1 and IMAP4rev2
+// use modified UTF-7 until IMAP4rev2 or UTF8=ACCEPT is enabled.
+//
+// The caller must hold c.mutex.
+func (c *Client) mailboxUTF8Locked() bool {
+	if c.enabled.Has(imap.CapIMAP4rev2) || c.enabled.Has(imap.CapUTF8Accept) {
+		return true
+	}
+	return c.caps.Has(imap.CapIMAP4rev2) && !c.caps.Has(imap.CapIMAP4rev1)
 }
 
 // Mailbox returns the state of the currently selected mailbox.
@@ -391,12 +749,80 @@ func (c *Client) Close() error {
 	return nil
 }
 
+// SetCommandTimeout sets the maximum duration a command may take to complete,
+// from the moment it starts being sent. Zero means no timeout.
+//
+// IMAP has no way to abort a running command: on timeout, the connection is
+// closed and all pending commands fail with an error wrapping
+// os.ErrDeadlineExceeded. IDLE commands are not subject to the timeout.
+func (c *Client) SetCommandTimeout(d time.Duration) {
+	c.mutex.Lock()
+	c.cmdTimeout = d
+	c.mutex.Unlock()
+}
+
+// WatchContext closes the connection when ctx is done, until the returned
+// stop function is called.
+//
+// IMAP has no way to abort a running command: when ctx is done, the
+// connection is closed and all pending commands fail with an error wrapping
+// ctx.Err(). The client cannot be used afterwards.
+//
+// The stop function must be called to release associated resources.
+//
+// To bound a single command, use the WaitContext or CollectContext method of
+// the command instead, e.g. FetchCommand.CollectContext.
+func (c *Client) WatchContext(ctx context.Context) (stop func()) {
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		select {
+		case <-ctx.Done():
+			c.abort(fmt.Errorf("imapclient: connection closed: %w", ctx.Err()))
+		case <-stopCh:
+		case <-c.decCh:
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stopCh)
+		})
+		<-done
+	}
+}
+
+// abort closes the connection. Pending commands fail with err.
+func (c *Client) abort(err error) {
+	c.mutex.Lock()
+	if c.abortErr == nil {
+		c.abortErr = err
+	}
+	c.mutex.Unlock()
+
+	c.conn.Close()
+}
+
 // beginCommand starts sending a command to the server.
 //
 // The command name and a space are written.
 //
 // The caller must call commandEncoder.end.
 func (c *Client) beginCommand(name string, cmd command) *commandEncoder {
+	// Stop IDLE if an Idler is running, it'll be resumed when the command
+	// completes
+	var pausedIdler *Idler
+	if _, ok := cmd.(*idleCommand); !ok {
+		pausedIdler = c.activeIdler()
+		if pausedIdler != nil {
+			pausedIdler.pause()
+		}
+	}
+
+	pipelined := c.acquirePipelineSlot(name)
+
 	c.encMutex.Lock() // unlocked by commandEncoder.end
 
 	c.mutex.Lock()
@@ -406,12 +832,25 @@ func (c *Client) beginCommand(name string, cmd command) *commandEncoder {
 
 	baseCmd := cmd.base()
 	*baseCmd = commandBase{
-		tag:  tag,
-		done: make(chan error, 1),
+		client:      c,
+		tag:         tag,
+		done:        make(chan error, 1),
+		pausedIdler: pausedIdler,
+		pipelined:   pipelined,
 	}
 
 	c.pendingCmds = append(c.pendingCmds, cmd)
-	quotedUTF8 := c.caps.Has(imap.CapIMAP4rev2) || c.enabled.Has(imap.CapUTF8Accept)
+	c.lastActive = time.Now()
+	if !isIdempotentCommand(name) {
+		c.numNonIdempotent++
+	}
+	c.resetReadTimeoutLocked()
+	if _, ok := cmd.(*idleCommand); !ok && c.cmdTimeout > 0 {
+		baseCmd.timer = time.AfterFunc(c.cmdTimeout, func() {
+			c.abort(fmt.Errorf("imapclient: %v command timed out: %w", name, os.ErrDeadlineExceeded))
+		})
+	}
+	quotedUTF8 := c.mailboxUTF8Locked()
 	literalMinus := c.caps.Has(imap.CapLiteralMinus)
 	literalPlus := c.caps.Has(imap.CapLiteralPlus)
 
@@ -476,6 +915,17 @@ func findPendingCmdByType[T command](c *Client) T {
 }
 
 func (c *Client) completeCommand(cmd command, err error) {
+	if timer := cmd.base().timer; timer != nil {
+		timer.Stop()
+	}
+
+	// Populate the MailboxView before SelectCommand.Wait returns
+	if cmd, ok := cmd.(*SelectCommand); ok && err == nil {
+		if view := c.mailboxView(); view != nil {
+			cmd.viewDone = view.handleSelect(cmd.mailbox, cmd.data.UIDValidity, cmd.data.NumMessages)
+		}
+	}
+
 	done := cmd.base().done
 	done <- err
 	close(done)
@@ -493,6 +943,14 @@ func (c *Client) completeCommand(cmd command, err error) {
 	c.contReqs = filtered
 	c.mutex.Unlock()
 
+	if cmd.base().pipelined {
+		c.releasePipelineSlot()
+	}
+
+	if idler := cmd.base().pausedIdler; idler != nil {
+		idler.resume()
+	}
+
 	switch cmd := cmd.(type) {
 	case *authenticateCommand, *loginCommand:
 		if err == nil {
@@ -500,10 +958,11 @@ func (c *Client) completeCommand(cmd command, err error) {
 		}
 	case *unauthenticateCommand:
 		if err == nil {
+			c.setState(imap.ConnStateNotAuthenticated)
 			c.mutex.Lock()
-			c.state = imap.ConnStateNotAuthenticated
-			c.mailbox = nil
 			c.enabled = make(imap.CapSet)
+			c.selectCondStore = false
+			c.dec.MailboxUTF8 = c.mailboxUTF8Locked()
 			c.mutex.Unlock()
 		}
 	case *SelectCommand:
@@ -512,12 +971,18 @@ func (c *Client) completeCommand(cmd command, err error) {
 			c.state = imap.ConnStateSelected
 			c.mailbox = &SelectedMailbox{
 				Name:           cmd.mailbox,
+				UIDValidity:    cmd.data.UIDValidity,
 				NumMessages:    cmd.data.NumMessages,
 				Flags:          cmd.data.Flags,
 				PermanentFlags: cmd.data.PermanentFlags,
+				ReadOnly:       cmd.data.ReadOnly,
 			}
 			c.mutex.Unlock()
 		}
+	case *SearchCommand:
+		if cmd.saveDone != nil {
+			close(cmd.saveDone)
+		}
 	case *unselectCommand:
 		if err == nil {
 			c.setState(imap.ConnStateAuthenticated)
@@ -571,13 +1036,23 @@ func (c *Client) closeWithError(err error) {
 // to pending commands.
 func (c *Client) read() {
 	defer close(c.decCh)
+	defer c.updates.close()
 	defer func() {
 		if v := recover(); v != nil {
 			c.decErr = fmt.Errorf("imapclient: panic reading response: %v\n%s", v, debug.Stack())
 		}
 
+		c.mutex.Lock()
+		abortErr := c.abortErr
+		c.mutex.Unlock()
+
 		cmdErr := c.decErr
-		if cmdErr == nil {
+		if abortErr != nil {
+			cmdErr = abortErr
+		} else if c.byeErr != nil {
+			// The server announced it was closing the connection
+			cmdErr = c.byeErr
+		} else if cmdErr == nil {
 			cmdErr = io.ErrUnexpectedEOF
 		}
 		c.closeWithError(cmdErr)
@@ -589,7 +1064,17 @@ func (c *Client) read() {
 		if c.dec.EOF() || errors.Is(c.dec.Err(), net.ErrClosed) || errors.Is(c.dec.Err(), io.ErrClosedPipe) {
 			break
 		}
-		if err := c.readResponse(); err != nil {
+		var err error
+		if decErr := c.dec.Err(); decErr != nil {
+			// The error happened while waiting for the next response
+			err = fmt.Errorf("in response: %w", decErr)
+		} else {
+			err = c.readResponse()
+		}
+		if err != nil {
+			if c.options.ReadTimeout > 0 && errors.Is(c.dec.Err(), os.ErrDeadlineExceeded) {
+				err = fmt.Errorf("imapclient: no data received from server: %v: %w", err, ErrConnStale)
+			}
 			c.decErr = err
 			break
 		}
@@ -601,7 +1086,12 @@ func (c *Client) read() {
 
 func (c *Client) readResponse() error {
 	c.setReadTimeout(respReadTimeout)
-	defer c.setReadTimeout(idleReadTimeout)
+	defer func() {
+		c.mutex.Lock()
+		c.lastActive = time.Now()
+		c.resetReadTimeoutLocked()
+		c.mutex.Unlock()
+	}()
 
 	if c.dec.Special('+') {
 		if err := c.readContinueReq(); err != nil {
@@ -625,13 +1115,13 @@ func (c *Client) readResponse() error {
 	typ = strings.ToUpper(typ)
 
 	var (
-		token    string
-		err      error
-		startTLS *startTLSCommand
+		token   string
+		err     error
+		upgrade command
 	)
 	if tag != "" {
 		token = "response-tagged"
-		startTLS, err = c.readResponseTagged(tag, typ)
+		upgrade, err = c.readResponseTagged(tag, typ)
 	} else {
 		token = "response-data"
 		err = c.readResponseData(typ)
@@ -644,8 +1134,11 @@ func (c *Client) readResponse() error {
 		return fmt.Errorf("in response: %v", c.dec.Err())
 	}
 
-	if startTLS != nil {
-		c.upgradeStartTLS(startTLS)
+	switch cmd := upgrade.(type) {
+	case *startTLSCommand:
+		c.upgradeStartTLS(cmd)
+	case *compressCommand:
+		c.upgradeCompress(cmd)
 	}
 
 	return nil
@@ -676,7 +1169,9 @@ func (c *Client) readContinueReq() error {
 	return nil
 }
 
-func (c *Client) readResponseTagged(tag, typ string) (startTLS *startTLSCommand, err error) {
+// readResponseTagged reads a tagged response. If the command requires the
+// connection to be upgraded (e.g. STARTTLS), it's returned.
+func (c *Client) readResponseTagged(tag, typ string) (upgrade command, err error) {
 	cmd := c.deletePendingCmdByTag(tag)
 	if cmd == nil {
 		return nil, fmt.Errorf("received tagged response with unknown tag %q", tag)
@@ -694,54 +1189,61 @@ func (c *Client) readResponseTagged(tag, typ string) (startTLS *startTLSCommand,
 	// see #500 and #502
 	hasSP := c.dec.SP()
 
-	var code string
+	var codeData imap.ResponseCodeData
 	if hasSP && c.dec.Special('[') { // resp-text-code
-		if !c.dec.ExpectAtom(&code) {
-			return nil, fmt.Errorf("in resp-text-code: %v", c.dec.Err())
+		kind := imapwire.NumKindSeq
+		if cmd, ok := cmd.(*FetchCommand); ok {
+			kind = imapwire.NumSetKind(cmd.numSet)
 		}
-		// TODO: LONGENTRIES and MAXSIZE from METADATA
-		switch code {
-		case "CAPABILITY": // capability-data
-			caps, err := readCapabilities(c.dec)
-			if err != nil {
-				return nil, fmt.Errorf("in capability-data: %v", err)
-			}
-			c.setCaps(caps)
-		case "APPENDUID":
-			var (
-				uidValidity uint32
-				uid         imap.UID
-			)
-			if !c.dec.ExpectSP() || !c.dec.ExpectNumber(&uidValidity) || !c.dec.ExpectSP() || !c.dec.ExpectUID(&uid) {
-				return nil, fmt.Errorf("in resp-code-apnd: %v", c.dec.Err())
-			}
-			if cmd, ok := cmd.(*AppendCommand); ok {
-				cmd.data.UID = uid
-				cmd.data.UIDValidity = uidValidity
-			}
-		case "COPYUID":
-			if !c.dec.ExpectSP() {
-				return nil, c.dec.Err()
-			}
-			uidValidity, srcUIDs, dstUIDs, err := readRespCodeCopyUID(c.dec)
-			if err != nil {
-				return nil, fmt.Errorf("in resp-code-copy: %v", err)
+		codeData, err = internal.ReadRespCode(c.dec, kind)
+		if err != nil {
+			return nil, err
+		}
+		switch data := codeData.(type) {
+		case imap.CapabilityCode:
+			c.setCaps(capSetFromCapabilityCode(data))
+		case imap.AppendUIDCode:
+			appendData := appendDataFromRespCode(data)
+			switch cmd := cmd.(type) {
+			case *AppendCommand:
+				cmd.data = *appendData
+			case *ReplaceCommand:
+				cmd.data = *appendData
 			}
+		case imap.CopyUIDCode:
 			switch cmd := cmd.(type) {
 			case *CopyCommand:
-				cmd.data.UIDValidity = uidValidity
-				cmd.data.SourceUIDs = srcUIDs
-				cmd.data.DestUIDs = dstUIDs
+				cmd.data.UIDValidity, cmd.data.SourceUIDs, cmd.data.DestUIDs = data.UIDValidity, data.SourceUIDs, data.DestUIDs
 			case *MoveCommand:
 				// This can happen when Client.Move falls back to COPY +
 				// STORE + EXPUNGE
-				cmd.data.UIDValidity = uidValidity
-				cmd.data.SourceUIDs = srcUIDs
-				cmd.data.DestUIDs = dstUIDs
+				cmd.data.UIDValidity, cmd.data.SourceUIDs, cmd.data.DestUIDs = data.UIDValidity, data.SourceUIDs, data.DestUIDs
+			}
+		case imap.MailboxIDCode:
+			switch cmd := cmd.(type) {
+			case *CreateCommand:
+				cmd.mailboxID = data.MailboxID
+			case *SelectCommand:
+				cmd.data.MailboxID = data.MailboxID
+			}
+		case imap.ModifiedCode:
+			if cmd, ok := cmd.(*FetchCommand); ok {
+				cmd.modified = data.NumSet
 			}
-		default: // [SP 1*<any TEXT-CHAR except "]">]
-			if c.dec.SP() {
-				c.dec.DiscardUntilByte(']')
+		case imap.LongEntriesCode:
+			if cmd, ok := cmd.(*GetMetadataCommand); ok {
+				cmd.data.LongEntries = data.Size
+			}
+		case imap.ResponseCode:
+			switch data {
+			case imap.ResponseCodeReadOnly:
+				if cmd, ok := cmd.(*SelectCommand); ok {
+					cmd.data.ReadOnly = true
+				}
+			case imap.ResponseCodeUIDNotSticky:
+				if cmd, ok := cmd.(*SelectCommand); ok {
+					cmd.data.UIDNotSticky = true
+				}
 			}
 		}
 		if !c.dec.ExpectSpecial(']') {
@@ -759,30 +1261,42 @@ func (c *Client) readResponseTagged(tag, typ string) (startTLS *startTLSCommand,
 	case "OK":
 		// nothing to do
 	case "NO", "BAD":
-		cmdErr = &imap.Error{
-			Type: imap.StatusResponseType(typ),
-			Code: imap.ResponseCode(code),
-			Text: text,
-		}
+		cmdErr = newStatusError(imap.StatusResponseType(typ), codeData, text)
 	default:
 		return nil, fmt.Errorf("in resp-cond-state: expected OK, NO or BAD status condition, but got %v", typ)
 	}
 
 	c.completeCommand(cmd, cmdErr)
 
-	if cmd, ok := cmd.(*startTLSCommand); ok && cmdErr == nil {
-		startTLS = cmd
+	if cmdErr == nil {
+		switch cmd.(type) {
+		case *startTLSCommand, *compressCommand:
+			upgrade = cmd
+		}
 	}
 
-	if cmdErr == nil && code != "CAPABILITY" {
+	if cmdErr == nil {
 		switch cmd.(type) {
-		case *startTLSCommand, *loginCommand, *authenticateCommand, *unauthenticateCommand:
-			// These commands invalidate the capabilities
+		case *startTLSCommand:
+			// Capabilities received before the TLS handshake can't be
+			// trusted, even if sent in the tagged response
 			c.setCaps(nil)
+		case *loginCommand, *authenticateCommand, *unauthenticateCommand:
+			// These commands invalidate the capabilities
+			if _, ok := codeData.(imap.CapabilityCode); !ok {
+				c.setCaps(nil)
+			}
 		}
 	}
 
-	return startTLS, nil
+	return upgrade, nil
+}
+
+// newStatusError creates an error from a status response.
+func newStatusError(typ imap.StatusResponseType, codeData imap.ResponseCodeData, text string) *imap.Error {
+	resp := &imap.StatusResponse{Type: typ, Text: text}
+	resp.SetCodeData(codeData)
+	return (*imap.Error)(resp)
 }
 
 func (c *Client) readResponseData(typ string) error {
@@ -801,32 +1315,32 @@ func (c *Client) readResponseData(typ string) error {
 	}
 
 	// All response type are case insensitive
-	switch strings.ToUpper(typ) {
+	typ = strings.ToUpper(typ)
+
+	if !stateRespTypes[typ] {
+		if cmd := c.findRawCmd(typ, true); cmd != nil {
+			return c.handleRaw(cmd, num, typ)
+		}
+	}
+
+	switch typ {
 	case "OK", "PREAUTH", "NO", "BAD", "BYE": // resp-cond-state / resp-cond-bye / resp-cond-auth
 		// Some servers don't provide a text even if the RFC requires it,
 		// see #500 and #502
 		hasSP := c.dec.SP()
 
-		var code string
+		var codeData imap.ResponseCodeData
 		if hasSP && c.dec.Special('[') { // resp-text-code
-			if !c.dec.ExpectAtom(&code) {
-				return fmt.Errorf("in resp-text-code: %v", c.dec.Err())
+			var err error
+			codeData, err = internal.ReadRespCode(c.dec, imapwire.NumKindSeq)
+			if err != nil {
+				return err
 			}
-			switch code {
-			case "CAPABILITY": // capability-data
-				caps, err := readCapabilities(c.dec)
-				if err != nil {
-					return fmt.Errorf("in capability-data: %v", err)
-				}
-				c.setCaps(caps)
-			case "PERMANENTFLAGS":
-				if !c.dec.ExpectSP() {
-					return c.dec.Err()
-				}
-				flags, err := internal.ExpectFlagList(c.dec)
-				if err != nil {
-					return err
-				}
+			switch data := codeData.(type) {
+			case imap.CapabilityCode:
+				c.setCaps(capSetFromCapabilityCode(data))
+			case imap.PermanentFlagsCode:
+				flags := data.Flags
 
 				c.mutex.Lock()
 				if c.state == imap.ConnStateSelected {
@@ -837,51 +1351,48 @@ func (c *Client) readResponseData(typ string) error {
 
 				if cmd := findPendingCmdByType[*SelectCommand](c); cmd != nil {
 					cmd.data.PermanentFlags = flags
-				} else if handler := c.options.unilateralDataHandler().Mailbox; handler != nil {
-					handler(&UnilateralDataMailbox{PermanentFlags: flags})
-				}
-			case "UIDNEXT":
-				var uidNext imap.UID
-				if !c.dec.ExpectSP() || !c.dec.ExpectUID(&uidNext) {
-					return c.dec.Err()
+				} else {
+					if handler := c.options.unilateralDataHandler().Mailbox; handler != nil {
+						handler(&UnilateralDataMailbox{PermanentFlags: flags})
+					}
+					c.handleIdleEvent(&IdleMailboxStatus{PermanentFlags: flags})
 				}
+			case imap.UIDNextCode:
 				if cmd := findPendingCmdByType[*SelectCommand](c); cmd != nil {
-					cmd.data.UIDNext = uidNext
-				}
-			case "UIDVALIDITY":
-				var uidValidity uint32
-				if !c.dec.ExpectSP() || !c.dec.ExpectNumber(&uidValidity) {
-					return c.dec.Err()
+					cmd.data.UIDNext = data.UIDNext
 				}
+			case imap.UnseenCode:
 				if cmd := findPendingCmdByType[*SelectCommand](c); cmd != nil {
-					cmd.data.UIDValidity = uidValidity
-				}
-			case "COPYUID":
-				if !c.dec.ExpectSP() {
-					return c.dec.Err()
+					cmd.data.FirstUnseen = data.SeqNum
 				}
-				uidValidity, srcUIDs, dstUIDs, err := readRespCodeCopyUID(c.dec)
-				if err != nil {
-					return fmt.Errorf("in resp-code-copy: %v", err)
+			case imap.UIDValidityCode:
+				if cmd := findPendingCmdByType[*SelectCommand](c); cmd != nil {
+					cmd.data.UIDValidity = data.UIDValidity
+				} else if view := c.mailboxView(); view != nil {
+					view.handleUIDValidity(data.UIDValidity)
 				}
+			case imap.CopyUIDCode:
 				if cmd := findPendingCmdByType[*MoveCommand](c); cmd != nil {
-					cmd.data.UIDValidity = uidValidity
-					cmd.data.SourceUIDs = srcUIDs
-					cmd.data.DestUIDs = dstUIDs
+					cmd.data.UIDValidity, cmd.data.SourceUIDs, cmd.data.DestUIDs = data.UIDValidity, data.SourceUIDs, data.DestUIDs
+				}
+			case imap.AppendUIDCode:
+				// Sent by REPLACE, before the EXPUNGE response
+				if cmd := findPendingCmdByType[*ReplaceCommand](c); cmd != nil {
+					cmd.data = *appendDataFromRespCode(data)
 				}
-			case "HIGHESTMODSEQ":
-				var modSeq uint64
-				if !c.dec.ExpectSP() || !c.dec.ExpectModSeq(&modSeq) {
-					return c.dec.Err()
+			case imap.HighestModSeqCode:
+				if cmd := findPendingCmdByType[*SelectCommand](c); cmd != nil {
+					cmd.data.HighestModSeq = data.HighestModSeq
 				}
+			case imap.MailboxIDCode:
 				if cmd := findPendingCmdByType[*SelectCommand](c); cmd != nil {
-					cmd.data.HighestModSeq = modSeq
+					cmd.data.MailboxID = data.MailboxID
 				}
-			case "NOMODSEQ":
-				// ignore
-			default: // [SP 1*<any TEXT-CHAR except "]">]
-				if c.dec.SP() {
-					c.dec.DiscardUntilByte(']')
+			case imap.ResponseCode:
+				if data == imap.ResponseCodeUIDNotSticky {
+					if cmd := findPendingCmdByType[*SelectCommand](c); cmd != nil {
+						cmd.data.UIDNotSticky = true
+					}
 				}
 			}
 			if !c.dec.ExpectSpecial(']') {
@@ -895,10 +1406,17 @@ func (c *Client) readResponseData(typ string) error {
 			return fmt.Errorf("in resp-text: %v", c.dec.Err())
 		}
 
-		if code == "CLOSED" {
+		if codeData == imap.ResponseCodeClosed {
 			c.setState(imap.ConnStateAuthenticated)
 		}
 
+		if c.greetingRecv && strings.EqualFold(typ, "BYE") {
+			c.byeErr = newStatusError(imap.StatusResponseTypeBye, codeData, text)
+			queueUpdate(c, &c.handlers.bye, func(f func(string)) {
+				f(text)
+			})
+		}
+
 		if !c.greetingRecv {
 			switch typ {
 			case "OK":
@@ -907,15 +1425,11 @@ func (c *Client) readResponseData(typ string) error {
 				c.setState(imap.ConnStateAuthenticated)
 			default:
 				c.setState(imap.ConnStateLogout)
-				c.greetingErr = &imap.Error{
-					Type: imap.StatusResponseType(typ),
-					Code: imap.ResponseCode(code),
-					Text: text,
-				}
+				c.greetingErr = newStatusError(imap.StatusResponseType(typ), codeData, text)
 			}
 			c.greetingRecv = true
-			if c.greetingErr == nil && code != "CAPABILITY" {
-				c.setCaps(nil) // request initial capabilities
+			if _, ok := codeData.(imap.CapabilityCode); !ok && c.greetingErr == nil {
+				c.setCaps(nil) // capabilities will be requested lazily
 			}
 			close(c.greetingCh)
 		}
@@ -939,7 +1453,7 @@ func (c *Client) readResponseData(typ string) error {
 		return c.handleExists(num)
 	case "RECENT":
 		// ignore
-	case "LIST":
+	case "LIST", "XLIST":
 		if !c.dec.ExpectSP() {
 			return c.dec.Err()
 		}
@@ -956,6 +1470,11 @@ func (c *Client) readResponseData(typ string) error {
 		return c.handleFetch(num)
 	case "EXPUNGE":
 		return c.handleExpunge(num)
+	case "VANISHED":
+		if !c.dec.ExpectSP() {
+			return c.dec.Err()
+		}
+		return c.handleVanished()
 	case "SEARCH":
 		return c.handleSearch()
 	case "ESEARCH":
@@ -989,7 +1508,19 @@ func (c *Client) readResponseData(typ string) error {
 			return c.dec.Err()
 		}
 		return c.handleGetACL()
+	case "LISTRIGHTS":
+		if !c.dec.ExpectSP() {
+			return c.dec.Err()
+		}
+		return c.handleListRights()
+	case "GENURLAUTH":
+		return c.handleGenURLAuth()
+	case "URLFETCH":
+		return c.handleURLFetch()
 	default:
+		if cmd := c.findRawCmd(typ, false); cmd != nil {
+			return c.handleRaw(cmd, num, typ)
+		}
 		return fmt.Errorf("unsupported response type %q", typ)
 	}
 
@@ -1002,6 +1533,12 @@ func (c *Client) WaitGreeting() error {
 	case <-c.greetingCh:
 		return c.greetingErr
 	case <-c.decCh:
+		// The server may close the connection right after a BYE greeting
+		select {
+		case <-c.greetingCh:
+			return c.greetingErr
+		default:
+		}
 		if c.decErr != nil {
 			return fmt.Errorf("got error before greeting: %v", c.decErr)
 		}
@@ -1026,7 +1563,16 @@ func (c *Client) Logout() *Command {
 }
 
 // Login sends a LOGIN command.
+//
+// An error is returned without sending any command if the server greeted the
+// client with PREAUTH, if the client is already authenticated, or if the
+// server advertises LOGINDISABLED. In the latter case, the error is a
+// *LoginDisabledError.
 func (c *Client) Login(username, password string) *Command {
+	if err := c.checkLogin(); err != nil {
+		return &Command{commandBase: failedCommandBase(err)}
+	}
+
 	cmd := &loginCommand{}
 	enc := c.beginCommand("LOGIN", cmd)
 	enc.SP().String(username).SP().String(password)
@@ -1034,6 +1580,21 @@ func (c *Client) Login(username, password string) *Command {
 	return &cmd.Command
 }
 
+func (c *Client) checkLogin() error {
+	if err := c.WaitGreeting(); err != nil {
+		return err
+	}
+	switch c.State() {
+	case imap.ConnStateAuthenticated, imap.ConnStateSelected:
+		return fmt.Errorf("imapclient: already authenticated")
+	}
+	// Don't send the password in the clear
+	if c.Caps().Has(imap.CapLoginDisabled) {
+		return &LoginDisabledError{}
+	}
+	return nil
+}
+
 // Delete sends a DELETE command.
 func (c *Client) Delete(mailbox string) *Command {
 	cmd := &Command{}
@@ -1113,16 +1674,33 @@ func (ce *commandEncoder) flush() {
 
 // Literal encodes a literal.
 func (ce *commandEncoder) Literal(size int64) io.WriteCloser {
+	return ce.literal(size, false)
+}
+
+// Literal8 encodes a literal8.
+func (ce *commandEncoder) Literal8(size int64) io.WriteCloser {
+	return ce.literal(size, true)
+}
+
+func (ce *commandEncoder) literal(size int64, binary bool) io.WriteCloser {
 	var contReq *imapwire.ContinuationRequest
 	ce.client.mutex.Lock()
 	hasCapLiteralMinus := ce.client.caps.Has(imap.CapLiteralMinus)
+	hasCapLiteralPlus := ce.client.caps.Has(imap.CapLiteralPlus)
 	ce.client.mutex.Unlock()
-	if size > 4096 || !hasCapLiteralMinus {
+	// LITERAL- only allows non-synchronizing literals up to 4096 bytes
+	if !hasCapLiteralPlus && (size > 4096 || !hasCapLiteralMinus) {
 		contReq = ce.client.registerContReq(ce.cmd)
 	}
 	ce.client.setWriteTimeout(literalWriteTimeout)
+	var wc io.WriteCloser
+	if binary {
+		wc = ce.Encoder.Literal8(size, contReq)
+	} else {
+		wc = ce.Encoder.Literal(size, contReq)
+	}
 	return literalWriter{
-		WriteCloser: ce.Encoder.Literal(size, contReq),
+		WriteCloser: wc,
 		client:      ce.client,
 	}
 }
@@ -1160,6 +1738,9 @@ type UnilateralDataMailbox struct {
 //
 // The handler will be invoked in an arbitrary goroutine.
 //
+// Client.OnExpunge and similar methods can be used instead to register
+// multiple handlers which don't block the client.
+//
 // See Options.UnilateralDataHandler.
 type UnilateralDataHandler struct {
 	Expunge func(seqNum uint32)
@@ -1168,6 +1749,9 @@ type UnilateralDataHandler struct {
 
 	// requires ENABLE METADATA or ENABLE SERVER-METADATA
 	Metadata func(mailbox string, entries []string)
+
+	// requires ENABLE QRESYNC, replaces Expunge
+	Vanished func(uids imap.UIDSet)
 }
 
 // command is an interface for IMAP commands.
@@ -1179,9 +1763,14 @@ type command interface {
 }
 
 type commandBase struct {
-	tag  string
-	done chan error
-	err  error
+	client *Client
+	tag    string
+	done   chan error
+	err    error
+
+	pausedIdler *Idler
+	timer       *time.Timer // command timeout
+	pipelined   bool        // the command holds a pipeline slot
 }
 
 func (cmd *commandBase) base() *commandBase {
@@ -1195,6 +1784,17 @@ func (cmd *commandBase) wait() error {
 	return cmd.err
 }
 
+// watchContext closes the connection when ctx is done, until the returned
+// stop function is called. It's used by the WaitContext and CollectContext
+// methods of commands.
+func (cmd *commandBase) watchContext(ctx context.Context) (stop func()) {
+	// The client is nil if the command has failed without being sent
+	if cmd.client == nil || ctx.Done() == nil {
+		return func() {}
+	}
+	return cmd.client.WatchContext(ctx)
+}
+
 // Command is a basic IMAP command.
 type Command struct {
 	commandBase
@@ -1205,6 +1805,13 @@ func (cmd *Command) Wait() error {
 	return cmd.wait()
 }
 
+// WaitContext is like Wait, but closes the connection if ctx is done before
+// the command has completed. See Client.WatchContext.
+func (cmd *Command) WaitContext(ctx context.Context) error {
+	defer cmd.watchContext(ctx)()
+	return cmd.Wait()
+}
+
 type loginCommand struct {
 	Command
 }
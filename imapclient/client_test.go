@@ -1,12 +1,16 @@
 package imapclient_test
 
 import (
+	"bufio"
+	"context"
 	"crypto/tls"
+	"errors"
 	"io"
 	"net"
 	"os"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/imapclient"
@@ -100,8 +104,9 @@ func newMemClientServerPair(t *testing.T) (net.Conn, io.Closer) {
 		},
 		InsecureAuth: true,
 		Caps: imap.CapSet{
-			imap.CapIMAP4rev1: {},
-			imap.CapIMAP4rev2: {},
+			imap.CapIMAP4rev1:       {},
+			imap.CapIMAP4rev2:       {},
+			imap.CapCompressDeflate: {},
 		},
 	})
 
@@ -124,6 +129,48 @@ func newMemClientServerPair(t *testing.T) (net.Conn, io.Closer) {
 	return conn, server
 }
 
+// newCapsTestServer starts a memserver advertising IMAP4rev1 and extraCaps,
+// and returns a function to create new logged-in clients.
+func newCapsTestServer(t *testing.T, user *imapmemserver.User, extraCaps imap.CapSet) (dial func(options *imapclient.Options) *imapclient.Client) {
+	memServer := imapmemserver.New()
+	memServer.AddUser(user)
+
+	caps := imap.CapSet{imap.CapIMAP4rev1: {}}
+	for c := range extraCaps {
+		caps[c] = struct{}{}
+	}
+	server := imapserver.New(&imapserver.Options{
+		NewSession: func(conn *imapserver.Conn) (imapserver.Session, *imapserver.GreetingData, error) {
+			return memServer.NewSession(), nil, nil
+		},
+		InsecureAuth: true,
+		Caps:         caps,
+	})
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("net.Listen() = %v", err)
+	}
+	go server.Serve(ln)
+	t.Cleanup(func() {
+		server.Close()
+	})
+
+	return func(options *imapclient.Options) *imapclient.Client {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("net.Dial() = %v", err)
+		}
+		client := imapclient.New(conn, options)
+		t.Cleanup(func() {
+			client.Close()
+		})
+		if err := client.Login(testUsername, testPassword).Wait(); err != nil {
+			t.Fatalf("Login().Wait() = %v", err)
+		}
+		return client
+	}
+}
+
 func newClientServerPair(t *testing.T, initialState imap.ConnState) (*imapclient.Client, io.Closer) {
 	var useDovecot bool
 	switch os.Getenv("GOIMAP_TEST_DOVECOT") {
@@ -275,3 +322,150 @@ func TestWaitGreeting_eof(t *testing.T) {
 		t.Fatalf("WaitGreeting() should fail")
 	}
 }
+
+// newStalledClient returns a client connected to a server which sends a
+// greeting and then never replies to commands.
+func newStalledClient(t *testing.T) *imapclient.Client {
+	clientConn, serverConn := net.Pipe()
+	go func() {
+		io.WriteString(serverConn, "* OK [CAPABILITY IMAP4rev1] Server ready\r\n")
+		io.Copy(io.Discard, serverConn)
+	}()
+	t.Cleanup(func() { serverConn.Close() })
+
+	client := imapclient.New(clientConn, nil)
+	if err := client.WaitGreeting(); err != nil {
+		t.Fatalf("WaitGreeting() = %v", err)
+	}
+	return client
+}
+
+func waitCommandErrors(t *testing.T, cmds []*imapclient.Command, target error) {
+	for i, cmd := range cmds {
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- cmd.Wait()
+		}()
+		select {
+		case err := <-errCh:
+			if !errors.Is(err, target) {
+				t.Errorf("command #%v: Wait() = %v, want %v", i, err, target)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("command #%v: Wait() didn't return", i)
+		}
+	}
+}
+
+func TestClient_WatchContext(t *testing.T) {
+	client := newStalledClient(t)
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := client.WatchContext(ctx)
+	defer stop()
+
+	cmds := []*imapclient.Command{client.Noop(), client.Noop()}
+	cancel()
+	waitCommandErrors(t, cmds, context.Canceled)
+}
+
+func TestClient_WatchContext_stop(t *testing.T) {
+	client, server := newClientServerPair(t, imap.ConnStateAuthenticated)
+	defer client.Close()
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := client.WatchContext(ctx)
+	if err := client.Noop().Wait(); err != nil {
+		t.Fatalf("Noop().Wait() = %v", err)
+	}
+	stop()
+	cancel()
+
+	if err := client.Noop().Wait(); err != nil {
+		t.Errorf("Noop().Wait() after stop = %v", err)
+	}
+}
+
+func TestCommand_WaitContext(t *testing.T) {
+	client := newStalledClient(t)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	cmd := client.Noop()
+	other := client.Noop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- cmd.WaitContext(ctx)
+	}()
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("WaitContext() = %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("WaitContext() didn't return")
+	}
+
+	// Other pending commands fail with the same error
+	waitCommandErrors(t, []*imapclient.Command{other}, context.DeadlineExceeded)
+}
+
+func TestFetchCommand_CollectContext(t *testing.T) {
+	client, server := newClientServerPair(t, imap.ConnStateSelected)
+	defer client.Close()
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	msgs, err := client.Fetch(imap.SeqSetNum(1), &imap.FetchOptions{UID: true}).CollectContext(ctx)
+	if err != nil {
+		t.Fatalf("CollectContext() = %v", err)
+	} else if len(msgs) != 1 {
+		t.Errorf("len(msgs) = %v, want 1", len(msgs))
+	}
+	cancel()
+
+	// The context has no effect once the command has completed
+	if err := client.Noop().Wait(); err != nil {
+		t.Errorf("Noop().Wait() after cancel = %v", err)
+	}
+}
+
+func TestClient_SetCommandTimeout(t *testing.T) {
+	client := newStalledClient(t)
+	defer client.Close()
+
+	client.SetCommandTimeout(50 * time.Millisecond)
+
+	start := time.Now()
+	cmds := []*imapclient.Command{client.Noop(), client.Noop()}
+	waitCommandErrors(t, cmds, os.ErrDeadlineExceeded)
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("commands failed after %v, want about 50ms", d)
+	}
+}
+
+func TestClient_bye(t *testing.T) {
+	greeting := "* OK [CAPABILITY IMAP4rev1] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		readScriptTaggedCommand(t, br, w)
+		io.WriteString(w, "* BYE [UNAVAILABLE] Server shutting down\r\n")
+		w.(net.Conn).Close()
+	})
+
+	err := client.Noop().Wait()
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) {
+		t.Fatalf("Noop().Wait() = %v, want an *imap.Error", err)
+	}
+	if imapErr.Type != imap.StatusResponseTypeBye || imapErr.Code != imap.ResponseCodeUnavailable || imapErr.Text != "Server shutting down" {
+		t.Errorf("Noop().Wait() = %#v, want BYE [UNAVAILABLE]", imapErr)
+	}
+	if !imapclient.IsBye(err) {
+		t.Errorf("IsBye() = false, want true")
+	}
+}
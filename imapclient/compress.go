@@ -0,0 +1,112 @@
+package imapclient
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// Compress sends a COMPRESS DEFLATE command.
+//
+// Once the server has accepted the command, all data sent and received on the
+// connection is compressed. If STARTTLS is used, it must be issued before
+// Compress.
+//
+// Unlike other commands, this method blocks until the command completes.
+//
+// This requires support for the COMPRESS=DEFLATE extension.
+func (c *Client) Compress() error {
+	caps := c.Caps()
+	if caps == nil {
+		return fmt.Errorf("imapclient: failed to fetch capabilities")
+	}
+	if !caps.Has(imap.CapCompressDeflate) {
+		return fmt.Errorf("imapclient: server doesn't support COMPRESS=DEFLATE")
+	}
+
+	c.mutex.Lock()
+	compressed := c.compressed
+	c.mutex.Unlock()
+	if compressed {
+		return fmt.Errorf("imapclient: compression is already active")
+	}
+
+	upgradeDone := make(chan struct{})
+	cmd := &compressCommand{upgradeDone: upgradeDone}
+	enc := c.beginCommand("COMPRESS", cmd)
+	enc.SP().Atom("DEFLATE")
+	enc.flush()
+	defer enc.end()
+
+	// Don't send any other command until the compression layer is in place
+
+	if err := cmd.wait(); err != nil {
+		return err
+	}
+
+	// The decoder goroutine will invoke Client.upgradeCompress
+	<-upgradeDone
+
+	return nil
+}
+
+// upgradeCompress installs the compression layer after the server has sent an
+// OK response. It runs in the decoder goroutine.
+func (c *Client) upgradeCompress(compress *compressCommand) {
+	defer close(compress.upgradeDone)
+
+	// Data buffered after the OK response is already compressed
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, c.br, int64(c.br.Buffered())); err != nil {
+		panic(err) // unreachable
+	}
+
+	var r io.Reader = c.rw
+	if buf.Len() > 0 {
+		r = io.MultiReader(&buf, c.rw)
+	}
+
+	fw, err := flate.NewWriter(c.rw, flate.DefaultCompression)
+	if err != nil {
+		panic(err) // unreachable
+	}
+
+	rw := c.options.wrapReadWriter(struct {
+		io.Reader
+		io.Writer
+	}{
+		Reader: flate.NewReader(r),
+		Writer: &flushWriter{fw},
+	}, c.debugLog)
+
+	c.br.Reset(rw)
+	c.bw = bufio.NewWriter(rw)
+
+	c.mutex.Lock()
+	c.compressed = true
+	c.mutex.Unlock()
+}
+
+type compressCommand struct {
+	commandBase
+	upgradeDone chan<- struct{}
+}
+
+// flushWriter flushes the compressed stream after each write. Writes happen
+// when the bufio.Writer is flushed, ie. on command boundaries, or when its
+// buffer is full.
+type flushWriter struct {
+	w *flate.Writer
+}
+
+func (fw *flushWriter) Write(b []byte) (int, error) {
+	n, err := fw.w.Write(b)
+	if err != nil {
+		return n, err
+	}
+	return n, fw.w.Flush()
+}
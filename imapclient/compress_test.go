@@ -0,0 +1,81 @@
+package imapclient_test
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestCompress(t *testing.T) {
+	conn, server := newMemClientServerPair(t)
+	defer conn.Close()
+	defer server.Close()
+
+	options := imapclient.Options{
+		TLSConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	client, err := imapclient.NewStartTLS(conn, &options)
+	if err != nil {
+		t.Fatalf("NewStartTLS() = %v", err)
+	}
+	defer client.Close()
+
+	if err := client.Login(testUsername, testPassword).Wait(); err != nil {
+		t.Fatalf("Login().Wait() = %v", err)
+	}
+	if err := client.Compress(); err != nil {
+		t.Fatalf("Compress() = %v", err)
+	}
+	if err := client.Compress(); err == nil {
+		t.Errorf("Compress() succeeded twice")
+	}
+
+	// Random data doesn't compress well, and spans many flate blocks
+	var sb strings.Builder
+	sb.WriteString("From: <contact@example.org>\r\nSubject: Large message\r\n\r\n")
+	rnd := rand.New(rand.NewSource(42))
+	line := make([]byte, 57)
+	for sb.Len() < 2*1024*1024 {
+		rnd.Read(line)
+		sb.WriteString(base64.StdEncoding.EncodeToString(line))
+		sb.WriteString("\r\n")
+	}
+	rawMessage := sb.String()
+
+	appendCmd := client.Append("INBOX", int64(len(rawMessage)), nil)
+	appendCmd.Write([]byte(rawMessage))
+	appendCmd.Close()
+	appendData, err := appendCmd.Wait()
+	if err != nil {
+		t.Fatalf("Append().Wait() = %v", err)
+	}
+
+	if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select().Wait() = %v", err)
+	}
+
+	section := &imap.FetchItemBodySection{Peek: true}
+	fetchOptions := &imap.FetchOptions{BodySection: []*imap.FetchItemBodySection{section}}
+	msgs, err := client.Fetch(imap.UIDSetNum(appendData.UID), fetchOptions).Collect()
+	if err != nil {
+		t.Fatalf("Fetch().Collect() = %v", err)
+	}
+	if len(msgs) != 1 || len(msgs[0].BodySection) != 1 {
+		t.Fatalf("Fetch() = %v messages, want 1 message with 1 body section", len(msgs))
+	}
+	for _, body := range msgs[0].BodySection {
+		if !bytes.Equal(body, []byte(rawMessage)) {
+			t.Errorf("body mismatch: got %v bytes, want %v bytes", len(body), len(rawMessage))
+		}
+	}
+
+	if err := client.Noop().Wait(); err != nil {
+		t.Fatalf("Noop().Wait() = %v", err)
+	}
+}
@@ -1,7 +1,7 @@
 package imapclient
 
 import (
-	"fmt"
+	"context"
 
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
@@ -9,6 +9,10 @@ import (
 
 // Copy sends a COPY command.
 func (c *Client) Copy(numSet imap.NumSet, mailbox string) *CopyCommand {
+	if err := c.checkSearchRes(numSet); err != nil {
+		return &CopyCommand{commandBase: failedCommandBase(err)}
+	}
+
 	cmd := &CopyCommand{}
 	enc := c.beginCommand(uidCmdName("COPY", imapwire.NumSetKind(numSet)), cmd)
 	enc.SP().NumSet(numSet).SP().Mailbox(mailbox)
@@ -26,12 +30,9 @@ func (cmd *CopyCommand) Wait() (*imap.CopyData, error) {
 	return &cmd.data, cmd.wait()
 }
 
-func readRespCodeCopyUID(dec *imapwire.Decoder) (uidValidity uint32, srcUIDs, dstUIDs imap.UIDSet, err error) {
-	if !dec.ExpectNumber(&uidValidity) || !dec.ExpectSP() || !dec.ExpectUIDSet(&srcUIDs) || !dec.ExpectSP() || !dec.ExpectUIDSet(&dstUIDs) {
-		return 0, nil, nil, dec.Err()
-	}
-	if srcUIDs.Dynamic() || dstUIDs.Dynamic() {
-		return 0, nil, nil, fmt.Errorf("imapclient: server returned dynamic number set in COPYUID response")
-	}
-	return uidValidity, srcUIDs, dstUIDs, nil
+// WaitContext is like Wait, but closes the connection if ctx is done before
+// the command has completed. See Client.WatchContext.
+func (cmd *CopyCommand) WaitContext(ctx context.Context) (*imap.CopyData, error) {
+	defer cmd.watchContext(ctx)()
+	return cmd.Wait()
 }
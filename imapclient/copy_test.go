@@ -0,0 +1,113 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestClient_Copy_uidPlus(t *testing.T) {
+	greeting := "* OK [CAPABILITY IMAP4rev1 UIDPLUS] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, _ := readScriptTaggedCommand(t, br, w)
+		io.WriteString(w, tag+" OK [COPYUID 42 1:3,5 9:11,20] COPY completed\r\n")
+		tag, _ = readScriptTaggedCommand(t, br, w)
+		io.WriteString(w, tag+" OK COPY completed\r\n")
+	})
+
+	data, err := client.Copy(imap.SeqSetNum(1, 2, 3, 5), "Archive").Wait()
+	if err != nil {
+		t.Fatalf("Copy().Wait() = %v", err)
+	}
+	if data.UIDValidity != 42 {
+		t.Errorf("UIDValidity = %v, want 42", data.UIDValidity)
+	}
+
+	type pair struct{ source, dest imap.UID }
+	var pairs []pair
+	data.WalkUIDs(func(source, dest imap.UID) bool {
+		pairs = append(pairs, pair{source, dest})
+		return true
+	})
+	want := []pair{{1, 9}, {2, 10}, {3, 11}, {5, 20}}
+	if len(pairs) != len(want) {
+		t.Fatalf("WalkUIDs() = %v, want %v", pairs, want)
+	}
+	for i := range want {
+		if pairs[i] != want[i] {
+			t.Errorf("WalkUIDs() pair #%v = %v, want %v", i, pairs[i], want[i])
+		}
+	}
+
+	// Servers without UIDPLUS don't send COPYUID
+	data, err = client.Copy(imap.SeqSetNum(1), "Archive").Wait()
+	if err != nil {
+		t.Fatalf("Copy().Wait() = %v", err)
+	} else if data.UIDValidity != 0 || data.SourceUIDs != nil || data.DestUIDs != nil {
+		t.Errorf("Copy().Wait() = %#v, want zero data", data)
+	}
+}
+
+func TestClient_Copy_tryCreate(t *testing.T) {
+	greeting := "* OK [CAPABILITY IMAP4rev1] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, _ := readScriptTaggedCommand(t, br, w)
+		io.WriteString(w, tag+" NO [TRYCREATE] Mailbox doesn't exist\r\n")
+	})
+
+	_, err := client.Copy(imap.SeqSetNum(1), "Archive").Wait()
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) {
+		t.Fatalf("Copy().Wait() = %v, want an *imap.Error", err)
+	}
+	if imapErr.Type != imap.StatusResponseTypeNo || imapErr.Code != imap.ResponseCodeTryCreate || imapErr.Text != "Mailbox doesn't exist" {
+		t.Errorf("Copy().Wait() = %#v, want NO [TRYCREATE]", imapErr)
+	}
+	if !imapclient.IsTryCreate(err) {
+		t.Errorf("IsTryCreate() = false, want true")
+	}
+	if imapclient.IsOverQuota(err) || imapclient.IsBye(err) {
+		t.Errorf("IsOverQuota() or IsBye() = true, want false")
+	}
+}
+
+func TestClient_Append_uidPlusRange(t *testing.T) {
+	greeting := "* OK [CAPABILITY IMAP4rev1 UIDPLUS] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, _ := readScriptTaggedCommand(t, br, w)
+		io.WriteString(w, tag+" OK [APPENDUID 7 12:13] APPEND completed\r\n")
+	})
+
+	appendCmd := client.Append("INBOX", int64(len(simpleRawMessage)), nil)
+	appendCmd.Write([]byte(simpleRawMessage))
+	appendCmd.Close()
+	data, err := appendCmd.Wait()
+	if err != nil {
+		t.Fatalf("Append().Wait() = %v", err)
+	}
+	if data.UIDValidity != 7 || data.UID != 0 || data.UIDs.String() != "12:13" {
+		t.Errorf("Append().Wait() = %#v, want UIDVALIDITY 7 and UIDs 12:13", data)
+	}
+}
+
+func TestClient_Select_uidNotSticky(t *testing.T) {
+	greeting := "* OK [CAPABILITY IMAP4rev1 UIDPLUS] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, _ := readScriptTaggedCommand(t, br, w)
+		io.WriteString(w, "* 3 EXISTS\r\n")
+		io.WriteString(w, "* OK [UIDVALIDITY 1] UIDs valid\r\n")
+		io.WriteString(w, "* OK [UIDNOTSTICKY] Non-persistent UIDs\r\n")
+		io.WriteString(w, tag+" OK [READ-WRITE] SELECT completed\r\n")
+	})
+
+	data, err := client.Select("Temp", nil).Wait()
+	if err != nil {
+		t.Fatalf("Select().Wait() = %v", err)
+	} else if !data.UIDNotSticky {
+		t.Errorf("UIDNotSticky = false, want true")
+	}
+}
@@ -9,6 +9,20 @@ import (
 // A nil options pointer is equivalent to a zero options value.
 func (c *Client) Create(mailbox string, options *imap.CreateOptions) *Command {
 	cmd := &Command{}
+	c.create(cmd, mailbox, options)
+	return cmd
+}
+
+// CreateWithID sends a CREATE command, like Create. The returned command
+// reports the identifier of the created mailbox, if the server supports
+// OBJECTID.
+func (c *Client) CreateWithID(mailbox string, options *imap.CreateOptions) *CreateCommand {
+	cmd := &CreateCommand{}
+	c.create(cmd, mailbox, options)
+	return cmd
+}
+
+func (c *Client) create(cmd command, mailbox string, options *imap.CreateOptions) {
 	enc := c.beginCommand("CREATE", cmd)
 	enc.SP().Mailbox(mailbox)
 	if options != nil && len(options.SpecialUse) > 0 {
@@ -17,5 +31,18 @@ func (c *Client) Create(mailbox string, options *imap.CreateOptions) *Command {
 		}).Special(')')
 	}
 	enc.end()
-	return cmd
+}
+
+// CreateCommand is a CREATE command sent with Client.CreateWithID.
+type CreateCommand struct {
+	Command
+	mailboxID string
+}
+
+// MailboxID returns the identifier of the created mailbox, if returned by the
+// server. It must be called after Wait.
+//
+// This requires OBJECTID.
+func (cmd *CreateCommand) MailboxID() string {
+	return cmd.mailboxID
 }
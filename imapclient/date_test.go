@@ -0,0 +1,160 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+func TestParseHeaderDate(t *testing.T) {
+	utc := func(year int, month time.Month, day, hour, min, sec int) time.Time {
+		return time.Date(year, month, day, hour, min, sec, 0, time.UTC)
+	}
+	zone := func(t time.Time, hours int) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.FixedZone("", hours*60*60))
+	}
+
+	tests := []struct {
+		in   string
+		want time.Time // zero if the date can't be parsed
+	}{
+		// Well-formed
+		{"Tue, 1 Jul 2003 10:52:37 +0200", zone(utc(2003, time.July, 1, 10, 52, 37), 2)},
+		{"Fri, 21 Nov 1997 09:55:06 -0600", zone(utc(1997, time.November, 21, 9, 55, 6), -6)},
+		// Malformed, observed in the wild
+		{"1 Jul 2003 10:52:37 +0200", zone(utc(2003, time.July, 1, 10, 52, 37), 2)},
+		{"Tue, 01 Jul 03 10:52:37 +0200", zone(utc(2003, time.July, 1, 10, 52, 37), 2)},
+		{"Thu, 13 Feb 97 23:32 -0330 (Newfoundland Time)", utc(1997, time.February, 14, 3, 2, 0)},
+		{"Mon, 3 Jun 2019 09:15:00 GMT", utc(2019, time.June, 3, 9, 15, 0)},
+		{"Mon, 3 Jun 2019 09:15:00 UT", utc(2019, time.June, 3, 9, 15, 0)},
+		{"Wed, 17 Jul 1996 02:44:25 PDT", zone(utc(1996, time.July, 17, 2, 44, 25), -7)},
+		{"Wed, 17 Jul 1996 02:44:25 -0700 (PDT)", zone(utc(1996, time.July, 17, 2, 44, 25), -7)},
+		{"Wed, 17 Jul 1996 02:44:25", utc(1996, time.July, 17, 2, 44, 25)},
+		{"Wed, 17 Jul 1996 02:44:25 +02:00", zone(utc(1996, time.July, 17, 2, 44, 25), 2)},
+		{"Wed,17 Jul 1996 02:44:25 -0700", zone(utc(1996, time.July, 17, 2, 44, 25), -7)},
+		{"wednesday, 17 july 1996 02:44:25 -0700", zone(utc(1996, time.July, 17, 2, 44, 25), -7)},
+		{"17-Jul-1996 02:44:25 -0700", zone(utc(1996, time.July, 17, 2, 44, 25), -7)},
+		{"Wed Jul 17 02:44:25 1996", utc(1996, time.July, 17, 2, 44, 25)},
+		{"Jul 17 1996 02:44:25 -0700", zone(utc(1996, time.July, 17, 2, 44, 25), -7)},
+		{"Wed, 17 Jul 1996 02:44:25.123 +0000", utc(1996, time.July, 17, 2, 44, 25)},
+		{"Wed, 17 Jul 1996 02:44:25 X", utc(1996, time.July, 17, 2, 44, 25)},
+		{"Wed, 17 Jul 1996 02:44:25 Europe/Paris", time.Time{}},
+		{"Sun, 31 Feb 2019 12:00:00 +0000", time.Time{}},
+		{"Wed, 17 Jul 1996 25:44:25 +0000", time.Time{}},
+		{"Wed, 17 Foo 1996 02:44:25 +0000", time.Time{}},
+		{"yesterday", time.Time{}},
+		{"", time.Time{}},
+	}
+	for _, tc := range tests {
+		got, err := imap.ParseHeaderDate(tc.in)
+		if tc.want.IsZero() {
+			if err == nil {
+				t.Errorf("ParseHeaderDate(%q) = %v, want an error", tc.in, got)
+			}
+		} else if err != nil {
+			t.Errorf("ParseHeaderDate(%q) = %v", tc.in, err)
+		} else if !got.Equal(tc.want) {
+			t.Errorf("ParseHeaderDate(%q) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestParseDateTime(t *testing.T) {
+	want := time.Date(1996, time.July, 17, 9, 44, 25, 0, time.UTC)
+	tests := []struct {
+		in             string
+		strict, loose  bool
+		wantLenientUTC time.Time
+	}{
+		{"17-Jul-1996 02:44:25 -0700", true, true, want},
+		{" 7-Jul-1996 02:44:25 -0700", true, true, want.AddDate(0, 0, -10)},
+		{"7-Jul-1996 02:44:25 -0700", true, true, want.AddDate(0, 0, -10)},
+		{"17-jul-1996 02:44:25 -0700", true, true, want},
+		{"17-Jul-96 02:44:25 -0700", false, true, want},
+		{"17-Jul-1996 02:44 -0700", false, true, want.Add(-25 * time.Second)},
+		{"17-Jul-1996 09:44:25 GMT", false, true, want},
+		{"17-Jul-1996 09:44:25 UT", false, true, want},
+		{"17-Jul-1996 09:44:25", false, true, want},
+		{"17 Jul 1996 02:44:25 -0700", false, true, want},
+		{"17-Jul-1996", false, false, time.Time{}},
+		{"32-Jul-1996 02:44:25 -0700", false, false, time.Time{}},
+	}
+	for _, tc := range tests {
+		if _, err := imap.ParseDateTime(tc.in, false); (err == nil) != tc.strict {
+			t.Errorf("ParseDateTime(%q, false) = %v, want ok = %v", tc.in, err, tc.strict)
+		}
+		got, err := imap.ParseDateTime(tc.in, true)
+		if (err == nil) != tc.loose {
+			t.Errorf("ParseDateTime(%q, true) = %v, want ok = %v", tc.in, err, tc.loose)
+		} else if err == nil && !got.Equal(tc.wantLenientUTC) {
+			t.Errorf("ParseDateTime(%q, true) = %v, want %v", tc.in, got, tc.wantLenientUTC)
+		}
+	}
+
+	// Formatting round-trips
+	s := imap.FormatDateTime(want)
+	if got, err := imap.ParseDateTime(s, false); err != nil || !got.Equal(want) {
+		t.Errorf("ParseDateTime(FormatDateTime()) = %v, %v, want %v", got, err, want)
+	}
+	if got, err := imap.ParseDate(imap.FormatDate(want)); err != nil || got != time.Date(1996, time.July, 17, 0, 0, 0, 0, time.UTC) {
+		t.Errorf("ParseDate(FormatDate()) = %v, %v", got, err)
+	}
+}
+
+func TestClient_Fetch_lenientInternalDate(t *testing.T) {
+	greeting := "* PREAUTH [CAPABILITY IMAP4rev1] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, _ := readScriptTaggedCommand(t, br, w)
+		io.WriteString(w, `* 1 FETCH (INTERNALDATE "17-Jul-96 09:44 GMT" ENVELOPE ("17 Jul 96 09:44 GMT" NIL NIL NIL NIL NIL NIL NIL NIL NIL))`+"\r\n")
+		io.WriteString(w, tag+" OK FETCH completed\r\n")
+	})
+
+	msgs, err := client.Fetch(imap.SeqSetNum(1), &imap.FetchOptions{
+		InternalDate: true,
+		Envelope:     true,
+	}).Collect()
+	if err != nil {
+		t.Fatalf("Fetch().Collect() = %v", err)
+	}
+	want := time.Date(1996, time.July, 17, 9, 44, 0, 0, time.UTC)
+	if len(msgs) != 1 || !msgs[0].InternalDate.Equal(want) || msgs[0].Envelope == nil || !msgs[0].Envelope.Date.Equal(want) {
+		t.Errorf("Fetch().Collect() = %v, want INTERNALDATE and envelope date %v", msgs, want)
+	}
+}
+
+func TestSearch_sentDateFallback_memserver(t *testing.T) {
+	user := imapmemserver.NewUser(testUsername, testPassword)
+	user.Create("INBOX", nil)
+	internalDate := time.Date(2020, time.March, 10, 12, 0, 0, 0, time.UTC)
+	user.Append("INBOX", strings.NewReader("Date: Thu, 13 Feb 97 23:32 -0330 (Newfoundland Time)\r\n\r\nHi\r\n"), &imap.AppendOptions{Time: internalDate})
+	user.Append("INBOX", strings.NewReader("Date: not a date\r\n\r\nHi\r\n"), &imap.AppendOptions{Time: internalDate})
+	dial := newCapsTestServer(t, user, nil)
+	client := dial(nil)
+	if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select().Wait() = %v", err)
+	}
+
+	tests := []struct {
+		criteria imap.SearchCriteria
+		want     string
+	}{
+		// The time zone of the Date header field is ignored
+		{imap.SearchSentOn(time.Date(1997, time.February, 13, 0, 0, 0, 0, time.UTC)), "1"},
+		{imap.SearchSentOn(internalDate), "2"},
+		{imap.SearchCriteria{SentBefore: time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)}, "1"},
+	}
+	for _, tc := range tests {
+		data, err := client.Search(&tc.criteria, nil).Wait()
+		if err != nil {
+			t.Fatalf("Search().Wait() = %v", err)
+		}
+		if got := data.All.String(); got != tc.want {
+			t.Errorf("Search(%v) = %v, want %v", &tc.criteria, got, tc.want)
+		}
+	}
+}
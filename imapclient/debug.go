@@ -0,0 +1,285 @@
+package imapclient
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultDebugLogLiteralSize = 256
+
+// debugLog writes a human-readable log of the data exchanged with the server
+// to Options.DebugLog.
+//
+// Each direction is tracked by a debugStream, which splits the data into
+// lines and literals. Credentials sent by the client are redacted.
+type debugLog struct {
+	w          io.Writer
+	literalMax int // negative for no limit
+
+	mutex   sync.Mutex
+	authTag string // tag of the pending AUTHENTICATE command
+	client  debugStream
+	server  debugStream
+}
+
+func newDebugLog(options *Options) *debugLog {
+	if options.DebugLog == nil {
+		return nil
+	}
+	l := &debugLog{
+		w:          options.DebugLog,
+		literalMax: options.DebugLogLiteralSize,
+	}
+	if l.literalMax == 0 {
+		l.literalMax = defaultDebugLogLiteralSize
+	}
+	l.client = debugStream{log: l, prefix: "C: ", client: true}
+	l.server = debugStream{log: l, prefix: "S: "}
+	return l
+}
+
+// print writes a log entry. It must be called with the mutex locked.
+func (l *debugLog) print(prefix, text string) {
+	// Errors are ignored: logging must not break the connection
+	fmt.Fprintf(l.w, "%v %v%v\n", time.Now().Format("15:04:05.000"), prefix, text)
+}
+
+type debugStream struct {
+	log    *debugLog
+	prefix string
+	client bool
+
+	line []byte
+	cmd  *debugCommand // command being sent by the client
+
+	litLeft     int64
+	litSize     int64
+	lit         []byte
+	litRedacted bool
+}
+
+var _ io.Writer = (*debugStream)(nil)
+
+func (s *debugStream) Write(b []byte) (int, error) {
+	s.log.mutex.Lock()
+	defer s.log.mutex.Unlock()
+
+	n := len(b)
+	for len(b) > 0 {
+		if s.litLeft > 0 {
+			chunk := b
+			if int64(len(chunk)) > s.litLeft {
+				chunk = chunk[:s.litLeft]
+			}
+			b = b[len(chunk):]
+			s.litLeft -= int64(len(chunk))
+
+			keep := chunk
+			if s.litRedacted {
+				keep = nil
+			} else if max := s.log.literalMax; max >= 0 && len(s.lit)+len(keep) > max {
+				keep = keep[:max-len(s.lit)]
+			}
+			s.lit = append(s.lit, keep...)
+
+			if s.litLeft == 0 {
+				s.writeLiteral()
+			}
+			continue
+		}
+
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			s.line = append(s.line, b...)
+			break
+		}
+		s.line = append(s.line, b[:i]...)
+		b = b[i+1:]
+		s.writeLine(strings.TrimSuffix(string(s.line), "\r"))
+		s.line = s.line[:0]
+	}
+	return n, nil
+}
+
+func (s *debugStream) writeLine(text string) {
+	litSize, hasLit := parseDebugLiteral(text)
+
+	redactLit := false
+	if s.client {
+		text, redactLit = s.redactClientLine(text)
+		if !hasLit {
+			s.cmd = nil
+		}
+	} else if tag := s.log.authTag; tag != "" && strings.HasPrefix(text, tag+" ") {
+		s.log.authTag = ""
+	}
+
+	s.log.print(s.prefix, text)
+
+	if hasLit && litSize > 0 {
+		s.litLeft = litSize
+		s.litSize = litSize
+		s.lit = s.lit[:0]
+		s.litRedacted = redactLit
+	}
+}
+
+func (s *debugStream) writeLiteral() {
+	if s.litRedacted {
+		s.log.print(s.prefix, fmt.Sprintf("<redacted %v bytes>", s.litSize))
+		return
+	}
+
+	lines := strings.Split(string(s.lit), "\n")
+	if len(lines) > 1 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for _, line := range lines {
+		s.log.print(s.prefix, strings.TrimSuffix(line, "\r"))
+	}
+	if truncated := s.litSize - int64(len(s.lit)); truncated > 0 {
+		s.log.print(s.prefix, fmt.Sprintf("<%v more bytes>", truncated))
+	}
+}
+
+// redactClientLine redacts credentials from a line sent by the client. It
+// also returns whether the literal at the end of the line, if any, needs to be
+// redacted.
+func (s *debugStream) redactClientLine(text string) (string, bool) {
+	if s.cmd == nil {
+		if s.log.authTag != "" && !strings.Contains(text, " ") {
+			// SASL response
+			if text == "" || text == "*" {
+				return text, false
+			}
+			return "<redacted>", false
+		}
+		s.cmd = &debugCommand{log: s.log}
+	}
+
+	var (
+		sb        strings.Builder
+		redactLit bool
+	)
+	for i := 0; i < len(text); {
+		switch ch := text[i]; {
+		case ch == ' ' || ch == '(' || ch == ')':
+			sb.WriteByte(ch)
+			i++
+		case ch == '"':
+			j := i + 1
+			var value strings.Builder
+			for j < len(text) && text[j] != '"' {
+				if text[j] == '\\' && j+1 < len(text) {
+					j++
+				}
+				value.WriteByte(text[j])
+				j++
+			}
+			if j < len(text) {
+				j++ // closing quote
+			}
+			if s.cmd.redact(value.String()) {
+				sb.WriteString(`"<redacted>"`)
+			} else {
+				sb.WriteString(text[i:j])
+			}
+			i = j
+		default:
+			j := i
+			for j < len(text) && text[j] != ' ' && text[j] != '(' && text[j] != ')' {
+				j++
+			}
+			tok := text[i:j]
+			if _, ok := parseDebugLiteral(tok); ok && j == len(text) {
+				// The value is sent in the literal
+				redactLit = s.cmd.redact("")
+				sb.WriteString(tok)
+			} else if s.cmd.redact(tok) {
+				sb.WriteString("<redacted>")
+			} else {
+				sb.WriteString(tok)
+			}
+			i = j
+		}
+	}
+	return sb.String(), redactLit
+}
+
+// debugCommand keeps track of the tokens of a command sent by the client.
+type debugCommand struct {
+	log   *debugLog
+	n     int
+	tag   string
+	name  string
+	idKey string
+}
+
+// redact processes the next token of the command, and returns true if it
+// needs to be redacted.
+func (cmd *debugCommand) redact(tok string) bool {
+	i := cmd.n
+	cmd.n++
+
+	switch i {
+	case 0:
+		cmd.tag = tok
+		return false
+	case 1:
+		cmd.name = strings.ToUpper(tok)
+		if cmd.name == "AUTHENTICATE" {
+			cmd.log.authTag = cmd.tag
+		}
+		return false
+	}
+
+	switch cmd.name {
+	case "LOGIN":
+		// Only the user name is logged
+		return i > 2
+	case "AUTHENTICATE":
+		// Only the mechanism name is logged, not the initial response
+		return i > 2
+	case "ID":
+		if (i-2)%2 == 0 {
+			cmd.idKey = tok
+			return false
+		}
+		return isSensitiveIDField(cmd.idKey)
+	default:
+		return false
+	}
+}
+
+func isSensitiveIDField(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range []string{"auth", "token", "password", "secret"} {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDebugLiteral checks whether a line ends with a literal, and returns
+// its size.
+func parseDebugLiteral(text string) (int64, bool) {
+	if !strings.HasSuffix(text, "}") {
+		return 0, false
+	}
+	i := strings.LastIndexByte(text, '{')
+	if i < 0 {
+		return 0, false
+	}
+	s := strings.TrimSuffix(text[i+1:len(text)-1], "+")
+	size, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || size < 0 {
+		return 0, false
+	}
+	return size, true
+}
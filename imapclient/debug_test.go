@@ -0,0 +1,87 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-sasl"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+func TestClient_DebugLog(t *testing.T) {
+	user := imapmemserver.NewUser(testUsername, testPassword)
+	user.Create("INBOX", nil)
+	dial := newCapsTestServer(t, user, nil)
+
+	var debug lockedBuffer
+	client := dial(&imapclient.Options{
+		DebugLog:            &debug,
+		DebugLogLiteralSize: 12,
+	})
+	appendTestMessage(t, client)
+	if err := client.Noop().Wait(); err != nil {
+		t.Fatalf("Noop().Wait() = %v", err)
+	}
+
+	log := debug.String()
+	if strings.Contains(log, testPassword) {
+		t.Errorf("password found in log:\n%v", log)
+	}
+	for _, s := range []string{
+		" C: ",
+		" S: * OK ",
+		` LOGIN "` + testUsername + `" "<redacted>"`,
+		" C: MIME-Version",
+		" more bytes>",
+		" NOOP\n",
+	} {
+		if !strings.Contains(log, s) {
+			t.Errorf("log doesn't contain %q:\n%v", s, log)
+		}
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(log, "\n"), "\n") {
+		if !strings.Contains(line, " C: ") && !strings.Contains(line, " S: ") {
+			t.Errorf("invalid log line %q", line)
+		}
+	}
+}
+
+func TestClient_DebugLog_authenticate(t *testing.T) {
+	greeting := "* OK [CAPABILITY IMAP4rev1 AUTH=PLAIN] Server ready"
+	var debug lockedBuffer
+	client := newScriptedClientWithOptions(t, greeting, &imapclient.Options{
+		DebugLog: &debug,
+	}, func(br *bufio.Reader, w io.Writer) {
+		tag, _ := readScriptTaggedCommand(t, br, w)
+		io.WriteString(w, "+ \r\n")
+		readScriptLine(t, br)
+		io.WriteString(w, tag+" OK [CAPABILITY IMAP4rev1 ID] Authenticated\r\n")
+
+		tag, _ = readScriptTaggedCommand(t, br, w)
+		io.WriteString(w, "* ID NIL\r\n"+tag+" OK ID completed\r\n")
+	})
+
+	if err := client.Authenticate(sasl.NewPlainClient("", testUsername, testPassword)); err != nil {
+		t.Fatalf("Authenticate() = %v", err)
+	}
+	if _, err := client.ID(&imap.IDData{Name: "go-imap", Vendor: "X-Authorization-Token"}).Wait(); err != nil {
+		t.Fatalf("ID().Wait() = %v", err)
+	}
+
+	log := debug.String()
+	resp := base64.StdEncoding.EncodeToString([]byte("\x00" + testUsername + "\x00" + testPassword))
+	if strings.Contains(log, resp) {
+		t.Errorf("SASL response found in log:\n%v", log)
+	}
+	for _, s := range []string{"AUTHENTICATE PLAIN\n", "C: <redacted>\n", "Authenticated\n", `"go-imap"`} {
+		if !strings.Contains(log, s) {
+			t.Errorf("log doesn't contain %q:\n%v", s, log)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+type dialerFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+func (f dialerFunc) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return f(ctx, network, address)
+}
+
+func TestDialTLSContext_pipe(t *testing.T) {
+	cert, err := tls.X509KeyPair([]byte(rsaCertPEM), []byte(rsaKeyPEM))
+	if err != nil {
+		t.Fatalf("tls.X509KeyPair() = %v", err)
+	}
+
+	serverNames := make(chan string, 1)
+	done := make(chan struct{})
+	dialer := dialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+		if address != "imap.example.org:993" {
+			t.Errorf("dialed %q, want imap.example.org:993", address)
+		}
+		clientConn, serverConn := net.Pipe()
+		go func() {
+			defer close(done)
+			tlsConn := tls.Server(serverConn, &tls.Config{
+				Certificates: []tls.Certificate{cert},
+				GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+					serverNames <- hello.ServerName
+					return nil, nil
+				},
+			})
+			defer tlsConn.Close()
+			io.WriteString(tlsConn, "* OK [CAPABILITY IMAP4rev1] Server ready\r\n")
+			br := bufio.NewReader(tlsConn)
+			tag, _ := readScriptTaggedCommand(t, br, tlsConn)
+			io.WriteString(tlsConn, tag+" OK NOOP completed\r\n")
+		}()
+		return clientConn, nil
+	})
+
+	client, err := imapclient.DialTLSContext(context.Background(), "imap.example.org:993", &imapclient.Options{
+		TLSConfig: &tls.Config{InsecureSkipVerify: true},
+		Dialer:    dialer,
+	})
+	if err != nil {
+		t.Fatalf("DialTLSContext() = %v", err)
+	}
+	defer func() {
+		client.Close()
+		<-done
+	}()
+
+	if name := <-serverNames; name != "imap.example.org" {
+		t.Errorf("TLS server name = %q, want imap.example.org", name)
+	}
+	if err := client.Noop().Wait(); err != nil {
+		t.Fatalf("Noop().Wait() = %v", err)
+	}
+}
+
+func TestDialStartTLSContext_canceled(t *testing.T) {
+	dialer := dialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+		return nil, ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := imapclient.DialStartTLSContext(ctx, "imap.example.org:143", &imapclient.Options{Dialer: dialer})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("DialStartTLSContext() = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestDialInsecure_socks5(t *testing.T) {
+	memServer := imapmemserver.New()
+	memServer.AddUser(imapmemserver.NewUser(testUsername, testPassword))
+	server := imapserver.New(&imapserver.Options{
+		NewSession: func(conn *imapserver.Conn) (imapserver.Session, *imapserver.GreetingData, error) {
+			return memServer.NewSession(), nil, nil
+		},
+		InsecureAuth: true,
+		Caps:         imap.CapSet{imap.CapIMAP4rev1: {}},
+	})
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("net.Listen() = %v", err)
+	}
+	go server.Serve(ln)
+	defer server.Close()
+
+	proxyLn, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("net.Listen() = %v", err)
+	}
+	defer proxyLn.Close()
+	targets := make(chan string, 1)
+	go serveSOCKS5(proxyLn, ln.Addr().String(), targets)
+
+	client, err := imapclient.DialInsecure("imap.example.org:143", &imapclient.Options{
+		Dialer: &socks5Dialer{proxy: proxyLn.Addr().String()},
+	})
+	if err != nil {
+		t.Fatalf("DialInsecure() = %v", err)
+	}
+	defer client.Close()
+
+	if target := <-targets; target != "imap.example.org:143" {
+		t.Errorf("proxy target = %q, want imap.example.org:143", target)
+	}
+	if err := client.Login(testUsername, testPassword).Wait(); err != nil {
+		t.Fatalf("Login().Wait() = %v", err)
+	}
+}
+
+// socks5Dialer is a minimal SOCKS5 client, without authentication.
+type socks5Dialer struct {
+	proxy string
+}
+
+func (d *socks5Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, err
+	}
+
+	var netDialer net.Dialer
+	conn, err := netDialer.DialContext(ctx, network, d.proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	req := []byte{5, 1, 0} // version, 1 method, no authentication
+	req = append(req, 5, 1, 0, 3, byte(len(host)))
+	req = append(req, host...)
+	req = append(req, byte(port>>8), byte(port))
+	if _, err := conn.Write(req); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// Method selection (2 bytes), then reply with an IPv4 address (10 bytes)
+	var resp [12]byte
+	if _, err := io.ReadFull(conn, resp[:]); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp[1] != 0 || resp[3] != 0 {
+		conn.Close()
+		return nil, errors.New("SOCKS5 connection failed")
+	}
+	return conn, nil
+}
+
+// serveSOCKS5 accepts SOCKS5 connections, and forwards them to dest. The
+// requested addresses are sent to targets.
+func serveSOCKS5(ln net.Listener, dest string, targets chan<- string) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+
+			br := bufio.NewReader(conn)
+			var hdr [2]byte
+			if _, err := io.ReadFull(br, hdr[:]); err != nil {
+				return
+			}
+			if _, err := br.Discard(int(hdr[1])); err != nil {
+				return
+			}
+			var req [5]byte // version, command, reserved, address type, length
+			if _, err := io.ReadFull(br, req[:]); err != nil || req[3] != 3 {
+				return
+			}
+			addr := make([]byte, int(req[4])+2)
+			if _, err := io.ReadFull(br, addr); err != nil {
+				return
+			}
+			port := binary.BigEndian.Uint16(addr[len(addr)-2:])
+			targets <- net.JoinHostPort(string(addr[:len(addr)-2]), strconv.Itoa(int(port)))
+
+			destConn, err := net.Dial("tcp", dest)
+			if err != nil {
+				return
+			}
+			defer destConn.Close()
+
+			conn.Write([]byte{5, 0, 5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+			go io.Copy(destConn, br)
+			io.Copy(conn, destConn)
+		}()
+	}
+}
@@ -0,0 +1,153 @@
+package imapclient
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime/quotedprintable"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// DownloadPartOptions contains options for Client.DownloadPart.
+type DownloadPartOptions struct {
+	// Body structure of the message. If nil, it's fetched from the server.
+	BodyStructure imap.BodyStructure
+	// Maximum number of bytes fetched by a single command. If zero, the part
+	// is fetched with a single command.
+	MaxChunk int64
+}
+
+// PartInfo contains metadata about a part downloaded with
+// Client.DownloadPart.
+type PartInfo struct {
+	MediaType string
+	Filename  string
+	// Size of the decoded part
+	Size int64
+}
+
+// DownloadPart downloads a part of a message, decodes its
+// Content-Transfer-Encoding and writes it to w.
+//
+// The path is the part path, as returned by BodyStructure.Walk. If the server
+// supports BINARY, the part is decoded by the server. Otherwise, base64 and
+// quoted-printable parts are decoded by the client.
+//
+// The \Seen flag is never set.
+func (c *Client) DownloadPart(uid imap.UID, path []int, w io.Writer, options *DownloadPartOptions) (*PartInfo, error) {
+	if options == nil {
+		options = new(DownloadPartOptions)
+	}
+
+	bs := options.BodyStructure
+	if bs == nil {
+		var err error
+		bs, err = c.fetchBodyStructure(uid)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	part := findBodyStructurePart(bs, path)
+	if part == nil {
+		return nil, fmt.Errorf("imapclient: no single part %v in message with UID %v", path, uid)
+	}
+	filename, _ := part.Filename()
+	info := &PartInfo{
+		MediaType: part.MediaType(),
+		Filename:  filename,
+	}
+
+	if c.Caps().Has(imap.CapBinary) {
+		var err error
+		info.Size, err = c.fetchChunksTo(uid, w, options.MaxChunk, func(partial *imap.SectionPartial) *imap.FetchOptions {
+			return &imap.FetchOptions{
+				BinarySection: []*imap.FetchItemBinarySection{{Part: path, Partial: partial, Peek: true}},
+			}
+		})
+		if err == nil || info.Size > 0 || !IsUnknownCTE(err) {
+			return info, err
+		}
+		// The server doesn't know how to decode the part, try to decode it
+		// ourselves
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		info.Size, err = io.Copy(w, newTransferDecoder(pr, part.Encoding))
+		if err == nil {
+			// Ignore any trailing data after the end of the encoded data
+			_, err = io.Copy(io.Discard, pr)
+		}
+		pr.CloseWithError(err)
+		done <- err
+	}()
+
+	_, err := c.fetchChunksTo(uid, pw, options.MaxChunk, func(partial *imap.SectionPartial) *imap.FetchOptions {
+		return &imap.FetchOptions{
+			BodySection: []*imap.FetchItemBodySection{{Part: path, Partial: partial, Peek: true}},
+		}
+	})
+	pw.CloseWithError(err)
+	decodeErr := <-done
+	if err != nil {
+		return info, err
+	} else if decodeErr != nil {
+		return info, fmt.Errorf("imapclient: failed to decode part: %w", decodeErr)
+	}
+	return info, nil
+}
+
+func (c *Client) fetchBodyStructure(uid imap.UID) (imap.BodyStructure, error) {
+	options := &imap.FetchOptions{
+		BodyStructure: &imap.FetchItemBodyStructure{Extended: true},
+	}
+	msgs, err := c.Fetch(imap.UIDSetNum(uid), options).Collect()
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range msgs {
+		if msg.BodyStructure != nil {
+			return msg.BodyStructure, nil
+		}
+	}
+	return nil, fmt.Errorf("imapclient: server didn't return body structure for UID %v", uid)
+}
+
+// fetchChunksTo fetches a section and writes it to w. If maxChunk is
+// non-zero, the section is fetched in chunks of at most maxChunk bytes.
+func (c *Client) fetchChunksTo(uid imap.UID, w io.Writer, maxChunk int64, fetchOptions func(partial *imap.SectionPartial) *imap.FetchOptions) (int64, error) {
+	if maxChunk <= 0 {
+		return c.fetchSectionTo(uid, fetchOptions(nil), w)
+	}
+
+	var total int64
+	for {
+		partial := &imap.SectionPartial{Offset: total, Size: maxChunk}
+		n, err := c.fetchSectionTo(uid, fetchOptions(partial), w)
+		total += n
+		if err != nil || n < maxChunk {
+			return total, err
+		}
+	}
+}
+
+func findBodyStructurePart(bs imap.BodyStructure, path []int) *imap.BodyStructureSinglePart {
+	part, _ := bs.PartAtPath(path).(*imap.BodyStructureSinglePart)
+	return part
+}
+
+func newTransferDecoder(r io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(encoding) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	default:
+		return r
+	}
+}
@@ -0,0 +1,118 @@
+package imapclient_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+// newAttachmentMessage returns a message with a base64-encoded attachment at
+// part path 2.
+func newAttachmentMessage(attachment []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(attachment)
+	var sb strings.Builder
+	sb.WriteString("MIME-Version: 1.0\r\n" +
+		"Subject: Attachment\r\n" +
+		"Content-Type: multipart/mixed; boundary=mixed\r\n" +
+		"\r\n" +
+		"--mixed\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"See attached.\r\n" +
+		"--mixed\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		"Content-Disposition: attachment; filename=data.bin\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n")
+	for len(encoded) > 0 {
+		n := 76
+		if n > len(encoded) {
+			n = len(encoded)
+		}
+		sb.WriteString(encoded[:n] + "\r\n")
+		encoded = encoded[n:]
+	}
+	sb.WriteString("--mixed--\r\n")
+	return sb.String()
+}
+
+func TestClient_DownloadPart(t *testing.T) {
+	attachment := make([]byte, 200*1024+17)
+	rand.New(rand.NewSource(42)).Read(attachment)
+	rawMsg := newAttachmentMessage(attachment)
+	wantSum := sha256.Sum256(attachment)
+
+	for _, tc := range []struct {
+		name     string
+		caps     imap.CapSet
+		maxChunk int64
+		wantItem string
+	}{
+		{"binary", imap.CapSet{imap.CapBinary: {}}, 0, "BINARY.PEEK[2]"},
+		{"binary-chunked", imap.CapSet{imap.CapBinary: {}}, 64 * 1024, "BINARY.PEEK[2]<65536.65536>"},
+		{"fallback", nil, 0, "BODY.PEEK[2]"},
+		{"fallback-chunked", nil, 64 * 1024, "BODY.PEEK[2]<65536.65536>"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			user := imapmemserver.NewUser(testUsername, testPassword)
+			user.Create("INBOX", nil)
+			dial := newCapsTestServer(t, user, tc.caps)
+			var debugLog lockedBuffer
+			client := dial(&imapclient.Options{DebugLog: &debugLog})
+
+			uid := appendRawMessage(t, client, rawMsg)
+			if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+				t.Fatalf("Select().Wait() = %v", err)
+			}
+
+			var buf bytes.Buffer
+			options := &imapclient.DownloadPartOptions{MaxChunk: tc.maxChunk}
+			info, err := client.DownloadPart(uid, []int{2}, &buf, options)
+			if err != nil {
+				t.Fatalf("DownloadPart() = %v", err)
+			}
+
+			if sum := sha256.Sum256(buf.Bytes()); sum != wantSum {
+				t.Errorf("downloaded %v bytes with SHA-256 %x, want %v bytes with SHA-256 %x", buf.Len(), sum, len(attachment), wantSum)
+			}
+			if info.Size != int64(len(attachment)) {
+				t.Errorf("PartInfo.Size = %v, want %v", info.Size, len(attachment))
+			}
+			if info.MediaType != "application/octet-stream" || info.Filename != "data.bin" {
+				t.Errorf("PartInfo = %v %q, want application/octet-stream %q", info.MediaType, info.Filename, "data.bin")
+			}
+			if !strings.Contains(debugLog.String(), tc.wantItem) {
+				t.Errorf("%v wasn't sent", tc.wantItem)
+			}
+
+			fetchOptions := &imap.FetchOptions{Flags: true}
+			msgs, err := client.Fetch(imap.UIDSetNum(uid), fetchOptions).Collect()
+			if err != nil {
+				t.Fatalf("Fetch().Collect() = %v", err)
+			} else if len(msgs) != 1 {
+				t.Fatalf("len(msgs) = %v, want 1", len(msgs))
+			}
+			if containsFlag(msgs[0].Flags, imap.FlagSeen) {
+				t.Errorf("message has been marked as seen")
+			}
+		})
+	}
+}
+
+func appendRawMessage(t *testing.T, client *imapclient.Client, rawMsg string) imap.UID {
+	appendCmd := client.Append("INBOX", int64(len(rawMsg)), nil)
+	appendCmd.Write([]byte(rawMsg))
+	appendCmd.Close()
+	data, err := appendCmd.Wait()
+	if err != nil {
+		t.Fatalf("Append().Wait() = %v", err)
+	}
+	return data.UID
+}
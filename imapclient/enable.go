@@ -8,31 +8,86 @@ import (
 
 // Enable sends an ENABLE command.
 //
+// Capabilities not advertised by the server are filtered out. If none are
+// left, no command is sent. The capabilities granted by the server are
+// recorded, see Client.Enabled.
+//
 // This command requires support for IMAP4rev2 or the ENABLE extension.
 func (c *Client) Enable(caps ...imap.Cap) *EnableCommand {
 	// Enabling an extension may change the IMAP syntax, so only allow the
 	// extensions we support here
 	for _, name := range caps {
 		switch name {
-		case imap.CapIMAP4rev2, imap.CapUTF8Accept, imap.CapMetadata, imap.CapMetadataServer:
+		case imap.CapIMAP4rev2, imap.CapUTF8Accept, imap.CapMetadata, imap.CapMetadataServer, imap.CapCondStore, imap.CapQResync:
 			// ok
 		default:
-			done := make(chan error)
-			close(done)
 			err := fmt.Errorf("imapclient: cannot enable %q: not supported", name)
-			return &EnableCommand{commandBase: commandBase{done: done, err: err}}
+			return &EnableCommand{commandBase: failedCommandBase(err)}
+		}
+	}
+
+	var requested, filtered []imap.Cap
+	serverCaps := c.Caps()
+	for _, name := range caps {
+		if serverCaps.Has(name) {
+			requested = append(requested, name)
+		} else {
+			filtered = append(filtered, name)
 		}
 	}
 
-	cmd := &EnableCommand{}
+	cmd := &EnableCommand{
+		requested: requested,
+		data:      EnableData{Caps: make(imap.CapSet), Filtered: filtered},
+	}
+	if len(requested) == 0 {
+		cmd.commandBase = failedCommandBase(nil)
+		return cmd
+	}
+
 	enc := c.beginCommand("ENABLE", cmd)
-	for _, c := range caps {
+	for _, c := range requested {
 		enc.SP().Atom(string(c))
 	}
 	enc.end()
 	return cmd
 }
 
+// Enabled returns the capabilities enabled with the ENABLE command.
+func (c *Client) Enabled() imap.CapSet {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	enabled := make(imap.CapSet, len(c.enabled))
+	for name := range c.enabled {
+		enabled[name] = struct{}{}
+	}
+	return enabled
+}
+
+// EnableCondStore enables the CONDSTORE extension.
+//
+// If the server supports ENABLE, an ENABLE command is sent. Otherwise, the
+// CONDSTORE parameter is sent with subsequent SELECT and EXAMINE commands.
+//
+// Unlike other commands, this method blocks until the command completes.
+//
+// This requires support for the CONDSTORE extension.
+func (c *Client) EnableCondStore() error {
+	if err := c.checkCap(imap.CapCondStore); err != nil {
+		return err
+	}
+
+	if c.Caps().Has(imap.CapEnable) {
+		_, err := c.Enable(imap.CapCondStore).Wait()
+		return err
+	}
+
+	c.mutex.Lock()
+	c.selectCondStore = true
+	c.mutex.Unlock()
+	return nil
+}
+
 func (c *Client) handleEnabled() error {
 	caps, err := readCapabilities(c.dec)
 	if err != nil {
@@ -43,10 +98,17 @@ func (c *Client) handleEnabled() error {
 	for name := range caps {
 		c.enabled[name] = struct{}{}
 	}
+	// Enabling QRESYNC implies enabling CONDSTORE
+	if caps.Has(imap.CapQResync) {
+		c.enabled[imap.CapCondStore] = struct{}{}
+	}
+	c.dec.MailboxUTF8 = c.mailboxUTF8Locked()
 	c.mutex.Unlock()
 
 	if cmd := findPendingCmdByType[*EnableCommand](c); cmd != nil {
-		cmd.data.Caps = caps
+		for name := range caps {
+			cmd.data.Caps[name] = struct{}{}
+		}
 	}
 
 	return nil
@@ -55,15 +117,30 @@ func (c *Client) handleEnabled() error {
 // EnableCommand is an ENABLE command.
 type EnableCommand struct {
 	commandBase
-	data EnableData
+	requested []imap.Cap
+	data      EnableData
 }
 
 func (cmd *EnableCommand) Wait() (*EnableData, error) {
-	return &cmd.data, cmd.wait()
+	if err := cmd.wait(); err != nil {
+		return &cmd.data, err
+	}
+	if cmd.data.Ignored == nil {
+		for _, name := range cmd.requested {
+			if !cmd.data.Caps.Has(name) {
+				cmd.data.Ignored = append(cmd.data.Ignored, name)
+			}
+		}
+	}
+	return &cmd.data, nil
 }
 
 // EnableData is the data returned by the ENABLE command.
 type EnableData struct {
 	// Capabilities that were successfully enabled
 	Caps imap.CapSet
+	// Capabilities not advertised by the server, which weren't sent
+	Filtered []imap.Cap
+	// Capabilities sent to the server, but not enabled
+	Ignored []imap.Cap
 }
@@ -0,0 +1,124 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+func TestClient_Enable(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		caps         string
+		granted      string
+		wantCmd      string
+		wantFiltered []imap.Cap
+		wantIgnored  []imap.Cap
+		wantSelect   string
+	}{
+		{
+			name:        "none",
+			caps:        "QRESYNC UTF8=ACCEPT",
+			wantCmd:     "ENABLE QRESYNC UTF8=ACCEPT",
+			wantIgnored: []imap.Cap{imap.CapQResync, imap.CapUTF8Accept},
+			wantSelect:  `SELECT "&AOk-t&AOk-"`,
+		},
+		{
+			name:        "one",
+			caps:        "QRESYNC UTF8=ACCEPT",
+			granted:     "QRESYNC",
+			wantCmd:     "ENABLE QRESYNC UTF8=ACCEPT",
+			wantIgnored: []imap.Cap{imap.CapUTF8Accept},
+			wantSelect:  `SELECT "&AOk-t&AOk-"`,
+		},
+		{
+			name:       "both",
+			caps:       "QRESYNC UTF8=ACCEPT",
+			granted:    "QRESYNC UTF8=ACCEPT",
+			wantCmd:    "ENABLE QRESYNC UTF8=ACCEPT",
+			wantSelect: `SELECT "été"`,
+		},
+		{
+			name:         "filtered",
+			caps:         "QRESYNC",
+			granted:      "QRESYNC",
+			wantCmd:      "ENABLE QRESYNC",
+			wantFiltered: []imap.Cap{imap.CapUTF8Accept},
+			wantSelect:   `SELECT "&AOk-t&AOk-"`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			commands := make(chan string, 2)
+			greeting := "* OK [CAPABILITY IMAP4rev1 ENABLE CONDSTORE " + tc.caps + "] Server ready"
+			client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+				tag, args := readScriptTaggedCommand(t, br, w)
+				commands <- args
+				io.WriteString(w, "* ENABLED "+tc.granted+"\r\n")
+				io.WriteString(w, tag+" OK ENABLE completed\r\n")
+
+				tag, args = readScriptTaggedCommand(t, br, w)
+				commands <- args
+				io.WriteString(w, tag+" OK [READ-WRITE] SELECT completed\r\n")
+			})
+
+			data, err := client.Enable(imap.CapQResync, imap.CapUTF8Accept).Wait()
+			if err != nil {
+				t.Fatalf("Enable().Wait() = %v", err)
+			}
+			if cmd := <-commands; cmd != tc.wantCmd {
+				t.Errorf("command = %q, want %q", cmd, tc.wantCmd)
+			}
+			if !reflect.DeepEqual(data.Filtered, tc.wantFiltered) {
+				t.Errorf("EnableData.Filtered = %v, want %v", data.Filtered, tc.wantFiltered)
+			}
+			if !reflect.DeepEqual(data.Ignored, tc.wantIgnored) {
+				t.Errorf("EnableData.Ignored = %v, want %v", data.Ignored, tc.wantIgnored)
+			}
+
+			enabled := client.Enabled()
+			for _, name := range strings.Fields(tc.granted) {
+				if !data.Caps.Has(imap.Cap(name)) {
+					t.Errorf("EnableData.Caps doesn't contain %v", name)
+				}
+				if !enabled.Has(imap.Cap(name)) {
+					t.Errorf("Client.Enabled() doesn't contain %v", name)
+				}
+			}
+			if len(data.Caps) != len(strings.Fields(tc.granted)) {
+				t.Errorf("EnableData.Caps = %v, want %v", data.Caps, tc.granted)
+			}
+			// QRESYNC implies CONDSTORE
+			if wantCondStore := data.Caps.Has(imap.CapQResync); enabled.Has(imap.CapCondStore) != wantCondStore {
+				t.Errorf("Client.Enabled().Has(CONDSTORE) = %v, want %v", !wantCondStore, wantCondStore)
+			}
+
+			if _, err := client.Select("été", nil).Wait(); err != nil {
+				t.Fatalf("Select().Wait() = %v", err)
+			}
+			if cmd := <-commands; cmd != tc.wantSelect {
+				t.Errorf("command = %q, want %q", cmd, tc.wantSelect)
+			}
+		})
+	}
+}
+
+func TestClient_Enable_allFiltered(t *testing.T) {
+	greeting := "* OK [CAPABILITY IMAP4rev1 ENABLE] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {})
+
+	data, err := client.Enable(imap.CapQResync, imap.CapUTF8Accept).Wait()
+	if err != nil {
+		t.Fatalf("Enable().Wait() = %v", err)
+	}
+	want := []imap.Cap{imap.CapQResync, imap.CapUTF8Accept}
+	if !reflect.DeepEqual(data.Filtered, want) {
+		t.Errorf("EnableData.Filtered = %v, want %v", data.Filtered, want)
+	}
+	if len(data.Caps) != 0 || len(data.Ignored) != 0 {
+		t.Errorf("EnableData = %+v, want nothing enabled", data)
+	}
+}
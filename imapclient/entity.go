@@ -0,0 +1,101 @@
+package imapclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/emersion/go-imap/v2"
+	gomessage "github.com/emersion/go-message"
+	"github.com/emersion/go-message/mail"
+)
+
+// AppendEntity sends an APPEND command with a message created with
+// go-message.
+//
+// The message is serialized in memory first, to compute its size. Bare LF
+// line endings are converted to CRLF, as required by IMAP.
+//
+// Like AppendReader, the returned command has already been sent: the caller
+// only needs to call AppendCommand.Wait.
+func (c *Client) AppendEntity(mailbox string, e *gomessage.Entity, options *imap.AppendOptions) *AppendCommand {
+	var buf bytes.Buffer
+	if err := e.WriteTo(&crlfWriter{w: &buf}); err != nil {
+		return &AppendCommand{commandBase: failedCommandBase(fmt.Errorf("imapclient: failed to serialize message: %w", err))}
+	}
+	return c.AppendReader(context.Background(), mailbox, &buf, int64(buf.Len()), options)
+}
+
+// crlfWriter converts bare LF line endings to CRLF.
+type crlfWriter struct {
+	w  io.Writer
+	cr bool // the last byte written was CR
+}
+
+func (cw *crlfWriter) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			n, err := cw.w.Write(b)
+			written += n
+			if n > 0 {
+				cw.cr = b[n-1] == '\r'
+			}
+			return written, err
+		}
+
+		bare := (i == 0 && !cw.cr) || (i > 0 && b[i-1] != '\r')
+		n, err := cw.w.Write(b[:i])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if bare {
+			if _, err := cw.w.Write([]byte("\r\n")); err != nil {
+				return written, err
+			}
+		} else if _, err := cw.w.Write([]byte("\n")); err != nil {
+			return written, err
+		}
+		written++
+		cw.cr = false
+		b = b[i+1:]
+	}
+	return written, nil
+}
+
+// MailReader returns a reader for the message in a BODY[] section.
+//
+// The section must contain the whole message: sections of message parts,
+// header-only sections and partial sections are rejected.
+func (item FetchItemDataBodySection) MailReader() (*mail.Reader, error) {
+	if !isWholeMessageSection(item.Section) {
+		return nil, fmt.Errorf("imapclient: body section doesn't contain the whole message")
+	} else if item.Literal == nil {
+		return nil, fmt.Errorf("imapclient: body section is NIL")
+	}
+	return mail.CreateReader(item.Literal)
+}
+
+// MailReader returns a reader for the message in the BODY[] section of the
+// buffer, if any.
+func (buf *FetchMessageBuffer) MailReader() (*mail.Reader, error) {
+	for section, b := range buf.BodySection {
+		if isWholeMessageSection(section) {
+			return mail.CreateReader(bytes.NewReader(b))
+		}
+	}
+	for section, f := range buf.BodySectionFile {
+		if isWholeMessageSection(section) {
+			return mail.CreateReader(io.NewSectionReader(f, 0, math.MaxInt64))
+		}
+	}
+	return nil, fmt.Errorf("imapclient: no BODY[] section fetched")
+}
+
+func isWholeMessageSection(section *imap.FetchItemBodySection) bool {
+	return section != nil && section.Specifier == imap.PartSpecifierNone && len(section.Part) == 0 && section.Partial == nil
+}
@@ -0,0 +1,121 @@
+package imapclient_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+	gomessage "github.com/emersion/go-message"
+	"github.com/emersion/go-message/mail"
+)
+
+func newTestEntity(t *testing.T) *gomessage.Entity {
+	var textHeader gomessage.Header
+	textHeader.SetContentType("text/plain", map[string]string{"charset": "utf-8"})
+	text, err := gomessage.New(textHeader, strings.NewReader("Hello,\nthis uses bare LF line endings.\n"))
+	if err != nil {
+		t.Fatalf("message.New() = %v", err)
+	}
+
+	var attachmentHeader gomessage.Header
+	attachmentHeader.SetContentType("application/octet-stream", nil)
+	attachmentHeader.SetContentDisposition("attachment", map[string]string{"filename": "data.bin"})
+	attachment, err := gomessage.New(attachmentHeader, bytes.NewReader([]byte{0, 1, 2, '\n', 0xFF}))
+	if err != nil {
+		t.Fatalf("message.New() = %v", err)
+	}
+	// The body is encoded when the entity is written
+	attachment.Header.Set("Content-Transfer-Encoding", "base64")
+
+	var h gomessage.Header
+	h.Set("Subject", "Round-trip")
+	h.Set("From", "alice@example.org")
+	h.SetContentType("multipart/mixed", nil)
+	e, err := gomessage.NewMultipart(h, []*gomessage.Entity{text, attachment})
+	if err != nil {
+		t.Fatalf("message.NewMultipart() = %v", err)
+	}
+	return e
+}
+
+func TestClient_AppendEntity(t *testing.T) {
+	user := imapmemserver.NewUser(testUsername, testPassword)
+	user.Create("INBOX", nil)
+	dial := newCapsTestServer(t, user, imap.CapSet{imap.CapUIDPlus: {}})
+	client := dial(nil)
+
+	appendData, err := client.AppendEntity("INBOX", newTestEntity(t), nil).Wait()
+	if err != nil {
+		t.Fatalf("AppendEntity().Wait() = %v", err)
+	}
+	if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select().Wait() = %v", err)
+	}
+
+	msgs, err := client.Fetch(imap.UIDSetNum(appendData.UID), &imap.FetchOptions{
+		BodySection: []*imap.FetchItemBodySection{{Peek: true}},
+	}).Collect()
+	if err != nil {
+		t.Fatalf("Fetch().Collect() = %v", err)
+	} else if len(msgs) != 1 {
+		t.Fatalf("Fetch().Collect() returned %v messages, want 1", len(msgs))
+	}
+	for _, b := range msgs[0].BodySection {
+		if n := bytes.Count(b, []byte("\n")); n != bytes.Count(b, []byte("\r\n")) {
+			t.Errorf("stored message contains bare LF line endings:\n%v", string(b))
+		}
+	}
+
+	mr, err := msgs[0].MailReader()
+	if err != nil {
+		t.Fatalf("FetchMessageBuffer.MailReader() = %v", err)
+	}
+	if subject, _ := mr.Header.Subject(); subject != "Round-trip" {
+		t.Errorf("Subject = %q, want %q", subject, "Round-trip")
+	}
+
+	var parts []string
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("NextPart() = %v", err)
+		}
+		b, err := io.ReadAll(p.Body)
+		if err != nil {
+			t.Fatalf("ReadAll() = %v", err)
+		}
+		switch h := p.Header.(type) {
+		case *mail.InlineHeader:
+			if want := "Hello,\r\nthis uses bare LF line endings.\r\n"; string(b) != want {
+				t.Errorf("text = %q, want %q", b, want)
+			}
+			parts = append(parts, "inline")
+		case *mail.AttachmentHeader:
+			if filename, _ := h.Filename(); filename != "data.bin" {
+				t.Errorf("filename = %q, want %q", filename, "data.bin")
+			}
+			// Base64 protects the binary content from line ending conversion
+			if want := []byte{0, 1, 2, '\n', 0xFF}; !bytes.Equal(b, want) {
+				t.Errorf("attachment = %v, want %v", b, want)
+			}
+			parts = append(parts, "attachment")
+		}
+	}
+	if strings.Join(parts, ",") != "inline,attachment" {
+		t.Errorf("parts = %v, want [inline attachment]", parts)
+	}
+
+	item := imapclient.FetchItemDataBodySection{
+		Section: &imap.FetchItemBodySection{Part: []int{1}},
+		Literal: strings.NewReader("Hello"),
+	}
+	if _, err := item.MailReader(); err == nil {
+		t.Errorf("FetchItemDataBodySection.MailReader() with a part section = nil, want an error")
+	}
+}
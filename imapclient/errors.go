@@ -0,0 +1,61 @@
+package imapclient
+
+import (
+	"errors"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// IsTryCreate reports whether a command failed because the target mailbox
+// doesn't exist, but could be created. This is returned by APPEND, COPY and
+// MOVE.
+func IsTryCreate(err error) bool {
+	return hasResponseCode(err, imap.ResponseCodeTryCreate)
+}
+
+// IsOverQuota reports whether a command failed because the user is over
+// quota.
+func IsOverQuota(err error) bool {
+	return hasResponseCode(err, imap.ResponseCodeOverQuota)
+}
+
+// IsAuthFailed reports whether a command failed because of invalid
+// credentials.
+func IsAuthFailed(err error) bool {
+	return hasResponseCode(err, imap.ResponseCodeAuthenticationFailed)
+}
+
+// IsNonExistent reports whether a command failed because the mailbox or the
+// message it refers to doesn't exist.
+func IsNonExistent(err error) bool {
+	return hasResponseCode(err, imap.ResponseCodeNonExistent)
+}
+
+// IsUnknownCTE reports whether a FETCH BINARY command failed because the
+// server can't decode the content-transfer-encoding of a message part. The
+// part can still be fetched with a regular BODY section and decoded by the
+// client.
+func IsUnknownCTE(err error) bool {
+	return hasResponseCode(err, imap.ResponseCodeUnknownCTE)
+}
+
+// IsBye reports whether a command failed because the server closed the
+// connection with a BYE response.
+func IsBye(err error) bool {
+	var imapErr *imap.Error
+	return errors.As(err, &imapErr) && imapErr.Type == imap.StatusResponseTypeBye
+}
+
+// LoginDisabledError is returned by Client.Login when the server advertises
+// LOGINDISABLED. The password isn't sent to the server. STARTTLS or
+// AUTHENTICATE should be used instead.
+type LoginDisabledError struct{}
+
+func (err *LoginDisabledError) Error() string {
+	return "imapclient: LOGIN is disabled by the server, use STARTTLS or AUTHENTICATE instead"
+}
+
+func hasResponseCode(err error, code imap.ResponseCode) bool {
+	var imapErr *imap.Error
+	return errors.As(err, &imapErr) && imapErr.Code == code
+}
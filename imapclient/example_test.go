@@ -302,7 +302,11 @@ func ExampleClient_Search() {
 	if err != nil {
 		log.Fatalf("UID SEARCH command failed: %v", err)
 	}
-	log.Fatalf("UIDs matching the search criteria: %v", data.AllUIDs())
+	uids, err := data.AllUIDs()
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("UIDs matching the search criteria: %v", uids)
 }
 
 func ExampleClient_Idle() {
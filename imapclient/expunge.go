@@ -1,6 +1,10 @@
 package imapclient
 
 import (
+	"context"
+	"fmt"
+	"strings"
+
 	"github.com/emersion/go-imap/v2"
 )
 
@@ -15,6 +19,12 @@ func (c *Client) Expunge() *ExpungeCommand {
 //
 // This command requires support for IMAP4rev2 or the UIDPLUS extension.
 func (c *Client) UIDExpunge(uids imap.UIDSet) *ExpungeCommand {
+	if err := c.checkSearchRes(uids); err != nil {
+		seqNums := make(chan uint32)
+		close(seqNums)
+		return &ExpungeCommand{commandBase: failedCommandBase(err), seqNums: seqNums}
+	}
+
 	cmd := &ExpungeCommand{seqNums: make(chan uint32, 128)}
 	enc := c.beginCommand("UID EXPUNGE", cmd)
 	enc.SP().NumSet(uids)
@@ -30,13 +40,73 @@ func (c *Client) handleExpunge(seqNum uint32) error {
 	}
 	c.mutex.Unlock()
 
+	if view := c.mailboxView(); view != nil {
+		view.handleExpunge(seqNum)
+	}
+
 	cmd := findPendingCmdByType[*ExpungeCommand](c)
 	if cmd != nil {
 		cmd.seqNums <- seqNum
-	} else if handler := c.options.unilateralDataHandler().Expunge; handler != nil {
-		handler(seqNum)
+	} else {
+		if h := c.notifyHandler(""); h != nil && h.Expunge != nil {
+			h.Expunge(seqNum)
+		}
+		if handler := c.options.unilateralDataHandler().Expunge; handler != nil {
+			handler(seqNum)
+		}
+		queueUpdate(c, &c.handlers.expunge, func(f func(uint32)) {
+			f(seqNum)
+		})
+		c.handleIdleEvent(&IdleExpunge{SeqNum: seqNum})
+	}
+
+	return nil
+}
+
+func (c *Client) handleVanished() error {
+	earlier := false
+	if c.dec.Special('(') {
+		var tag string
+		if !c.dec.ExpectAtom(&tag) || !c.dec.ExpectSpecial(')') || !c.dec.ExpectSP() {
+			return c.dec.Err()
+		}
+		if !strings.EqualFold(tag, "EARLIER") {
+			return fmt.Errorf("in vanished: unknown tag %q", tag)
+		}
+		earlier = true
 	}
+	var uids imap.UIDSet
+	if !c.dec.ExpectUIDSet(&uids) {
+		return c.dec.Err()
+	}
+
+	// VANISHED (EARLIER) responses don't affect the number of messages,
+	// they are replies to SELECT or FETCH commands
+	if earlier {
+		if cmd := findPendingCmdByType[*SelectCommand](c); cmd != nil && cmd.resync != nil {
+			cmd.resync.addVanished(uids)
+		}
+		return nil
+	}
+
+	nums, _ := uids.Nums()
+	c.mutex.Lock()
+	if c.state == imap.ConnStateSelected {
+		c.mailbox = c.mailbox.copy()
+		if n := uint32(len(nums)); n < c.mailbox.NumMessages {
+			c.mailbox.NumMessages -= n
+		} else {
+			c.mailbox.NumMessages = 0
+		}
+	}
+	c.mutex.Unlock()
 
+	if view := c.mailboxView(); view != nil {
+		view.handleVanished(uids)
+	}
+	if handler := c.options.unilateralDataHandler().Vanished; handler != nil {
+		handler(uids)
+	}
 	return nil
 }
 
@@ -82,3 +152,10 @@ func (cmd *ExpungeCommand) Collect() ([]uint32, error) {
 	}
 	return l, cmd.Close()
 }
+
+// CollectContext is like Collect, but closes the connection if ctx is done
+// before the command has completed. See Client.WatchContext.
+func (cmd *ExpungeCommand) CollectContext(ctx context.Context) ([]uint32, error) {
+	defer cmd.watchContext(ctx)()
+	return cmd.Collect()
+}
@@ -1,9 +1,12 @@
 package imapclient
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	netmail "net/mail"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -24,6 +27,27 @@ func (c *Client) Fetch(numSet imap.NumSet, options *imap.FetchOptions) *FetchCom
 		options = new(imap.FetchOptions)
 	}
 
+	if !options.Force {
+		var err error
+		if options.SaveDate {
+			err = c.checkCap(imap.CapSaveDate)
+		}
+		if err == nil && options.Preview != nil {
+			err = c.checkCap(imap.CapPreview)
+		}
+		if err != nil {
+			return failedFetchCommand(err)
+		}
+	}
+	if err := c.checkSearchRes(numSet); err != nil {
+		return failedFetchCommand(err)
+	}
+	for _, section := range options.BodySection {
+		if err := section.Validate(); err != nil {
+			return failedFetchCommand(err)
+		}
+	}
+
 	numKind := imapwire.NumSetKind(numSet)
 
 	cmd := &FetchCommand{
@@ -40,6 +64,72 @@ func (c *Client) Fetch(numSet imap.NumSet, options *imap.FetchOptions) *FetchCom
 	return cmd
 }
 
+func failedFetchCommand(err error) *FetchCommand {
+	msgs := make(chan *FetchMessageData)
+	close(msgs)
+	return &FetchCommand{commandBase: failedCommandBase(err), msgs: msgs}
+}
+
+// FetchBodySectionTo fetches a body section of a message and writes it to w.
+//
+// The section is streamed from the connection to w, without being buffered in
+// memory. Large messages can be downloaded in chunks by setting
+// section.Partial. The number of bytes written is returned.
+func (c *Client) FetchBodySectionTo(uid imap.UID, section *imap.FetchItemBodySection, w io.Writer) (int64, error) {
+	return c.fetchSectionTo(uid, &imap.FetchOptions{
+		BodySection: []*imap.FetchItemBodySection{section},
+	}, w)
+}
+
+// fetchSectionTo fetches a single body or binary section of a message and
+// writes it to w.
+func (c *Client) fetchSectionTo(uid imap.UID, options *imap.FetchOptions, w io.Writer) (int64, error) {
+	cmd := c.Fetch(imap.UIDSetNum(uid), options)
+
+	var (
+		n     int64
+		found bool
+	)
+	for {
+		msg := cmd.Next()
+		if msg == nil {
+			break
+		}
+		for {
+			item := msg.Next()
+			if item == nil {
+				break
+			}
+			var lit imap.LiteralReader
+			switch item := item.(type) {
+			case FetchItemDataBodySection:
+				lit = item.Literal
+			case FetchItemDataBinarySection:
+				lit = item.Literal
+			}
+			if found || lit == nil {
+				continue
+			}
+			found = true
+
+			var err error
+			n, err = io.Copy(w, lit)
+			if err != nil {
+				cmd.Close()
+				return n, err
+			}
+		}
+	}
+
+	if err := cmd.Close(); err != nil {
+		return n, err
+	}
+	if !found {
+		return 0, fmt.Errorf("imapclient: server didn't return body section for UID %v", uid)
+	}
+	return n, nil
+}
+
 func writeFetchItems(enc *imapwire.Encoder, numKind imapwire.NumKind, options *imap.FetchOptions) {
 	listEnc := enc.BeginList()
 
@@ -57,6 +147,9 @@ func writeFetchItems(enc *imapwire.Encoder, numKind imapwire.NumKind, options *i
 		"INTERNALDATE":  options.InternalDate,
 		"RFC822.SIZE":   options.RFC822Size,
 		"MODSEQ":        options.ModSeq,
+		"SAVEDATE":      options.SaveDate,
+		"EMAILID":       options.EmailID,
+		"THREADID":      options.ThreadID,
 	}
 	for k, req := range m {
 		if req {
@@ -64,6 +157,14 @@ func writeFetchItems(enc *imapwire.Encoder, numKind imapwire.NumKind, options *i
 		}
 	}
 
+	if preview := options.Preview; preview != nil {
+		enc := listEnc.Item().Atom("PREVIEW")
+		if preview.Lazy {
+			enc.SP().List(1, func(i int) {
+				enc.Atom("LAZY")
+			})
+		}
+	}
 	for _, bs := range options.BodySection {
 		writeFetchItemBodySection(listEnc.Item(), bs)
 	}
@@ -156,6 +257,8 @@ type FetchCommand struct {
 
 	msgs chan *FetchMessageData
 	prev *FetchMessageData
+
+	modified imap.NumSet
 }
 
 func (cmd *FetchCommand) recvSeqNum(seqNum uint32) bool {
@@ -209,6 +312,18 @@ func (cmd *FetchCommand) Close() error {
 	return cmd.wait()
 }
 
+// Modified returns the messages which failed the UNCHANGEDSINCE test of a
+// STORE command, as reported by the server in the MODIFIED response code. The
+// number set has the same kind as the one passed to Client.Store.
+//
+// Modified returns nil if all messages have been updated. It must be called
+// after Close or Collect.
+//
+// This requires support for the CONDSTORE extension.
+func (cmd *FetchCommand) Modified() imap.NumSet {
+	return cmd.modified
+}
+
 // Collect accumulates message data into a list.
 //
 // This method will read and store message contents in memory. This is
@@ -217,8 +332,98 @@ func (cmd *FetchCommand) Close() error {
 //
 // This is equivalent to calling Next repeatedly and then Close.
 func (cmd *FetchCommand) Collect() ([]*FetchMessageBuffer, error) {
+	return cmd.CollectWithOptions(nil)
+}
+
+// CollectContext is like Collect, but closes the connection if ctx is done
+// before the command has completed. See Client.WatchContext.
+func (cmd *FetchCommand) CollectContext(ctx context.Context) ([]*FetchMessageBuffer, error) {
+	defer cmd.watchContext(ctx)()
+	return cmd.Collect()
+}
+
+// ErrTooLarge is returned by FetchCommand.CollectWithOptions when the fetched
+// sections exceed the memory budget. The streaming API (FetchCommand.Next)
+// should be used instead.
+var ErrTooLarge = errors.New("imapclient: fetched sections exceed the memory budget")
+
+// CollectOptions contains options for FetchCommand.CollectWithOptions.
+type CollectOptions struct {
+	// MaxMemory is the maximum number of bytes of body and binary sections
+	// kept in memory for the whole command. If zero, there is no limit.
+	MaxMemory int64
+	// If SpillToDisk is true, sections which don't fit in MaxMemory are
+	// written to temporary files, see FetchMessageBuffer.BodySectionFile.
+	// Otherwise, ErrTooLarge is returned before reading such a section.
+	SpillToDisk bool
+	// TempDir is the directory of the temporary files. If empty, the
+	// default directory for temporary files is used.
+	TempDir string
+}
+
+// collectBudget keeps track of the memory used by a collect operation.
+type collectBudget struct {
+	options *CollectOptions
+	used    int64
+}
+
+// readLiteral reads a literal either in memory or to a temporary file.
+func (budget *collectBudget) readLiteral(lit imap.LiteralReader) ([]byte, *os.File, error) {
+	if budget != nil && budget.options.MaxMemory > 0 {
+		if budget.used+lit.Size() > budget.options.MaxMemory {
+			if !budget.options.SpillToDisk {
+				return nil, nil, ErrTooLarge
+			}
+			f, err := spillLiteral(lit, budget.options.TempDir)
+			return nil, f, err
+		}
+		budget.used += lit.Size()
+	}
+	b, err := io.ReadAll(lit)
+	return b, nil, err
+}
+
+// spillLiteral writes a literal to a temporary file. The returned file is
+// positioned at its start.
+func spillLiteral(lit imap.LiteralReader, dir string) (*os.File, error) {
+	f, err := os.CreateTemp(dir, "imapclient-*")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(f, lit); err != nil {
+		removeFile(f)
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		removeFile(f)
+		return nil, err
+	}
+	return f, nil
+}
+
+func removeFile(f *os.File) error {
+	closeErr := f.Close()
+	removeErr := os.Remove(f.Name())
+	if closeErr != nil {
+		return closeErr
+	}
+	return removeErr
+}
+
+// CollectWithOptions accumulates message data into a list, like Collect, but
+// with a bounded amount of memory.
+//
+// If options is nil, it's equivalent to Collect. Buffers containing sections
+// spilled to temporary files must be closed with FetchMessageBuffer.Close,
+// including when an error is returned.
+func (cmd *FetchCommand) CollectWithOptions(options *CollectOptions) ([]*FetchMessageBuffer, error) {
 	defer cmd.Close()
 
+	var budget *collectBudget
+	if options != nil {
+		budget = &collectBudget{options: options}
+	}
+
 	var l []*FetchMessageBuffer
 	for {
 		msg := cmd.Next()
@@ -226,8 +431,9 @@ func (cmd *FetchCommand) Collect() ([]*FetchMessageBuffer, error) {
 			break
 		}
 
-		buf, err := msg.Collect()
+		buf, err := msg.collect(budget)
 		if err != nil {
+			buf.Close()
 			return l, err
 		}
 
@@ -272,6 +478,10 @@ func (data *FetchMessageData) discard() {
 // acceptable when the message contents have a reasonable size, but may not be
 // suitable when fetching e.g. attachments.
 func (data *FetchMessageData) Collect() (*FetchMessageBuffer, error) {
+	return data.collect(nil)
+}
+
+func (data *FetchMessageData) collect(budget *collectBudget) (*FetchMessageBuffer, error) {
 	defer data.discard()
 
 	buf := &FetchMessageBuffer{SeqNum: data.SeqNum}
@@ -280,7 +490,7 @@ func (data *FetchMessageData) Collect() (*FetchMessageBuffer, error) {
 		if item == nil {
 			break
 		}
-		if err := buf.populateItemData(item); err != nil {
+		if err := buf.populateItemData(item, budget); err != nil {
 			return buf, err
 		}
 	}
@@ -314,7 +524,9 @@ var (
 
 // FetchItemDataBodySection holds data returned by FETCH BODY[].
 //
-// Literal might be nil.
+// Literal might be nil. Literal reads directly from the connection, without
+// buffering the whole section in memory: it must be consumed before the next
+// item is read, otherwise it is discarded.
 type FetchItemDataBodySection struct {
 	Section *imap.FetchItemBodySection
 	Literal imap.LiteralReader
@@ -365,6 +577,36 @@ type FetchItemDataInternalDate struct {
 
 func (FetchItemDataInternalDate) fetchItemData() {}
 
+// FetchItemDataSaveDate holds data returned by FETCH SAVEDATE.
+type FetchItemDataSaveDate struct {
+	Time time.Time // zero if the server doesn't support save dates
+}
+
+func (FetchItemDataSaveDate) fetchItemData() {}
+
+// FetchItemDataPreview holds data returned by FETCH PREVIEW.
+type FetchItemDataPreview struct {
+	// Nil if no preview is available, e.g. when the preview isn't readily
+	// available and FetchItemPreview.Lazy is set
+	Preview *string
+}
+
+func (FetchItemDataPreview) fetchItemData() {}
+
+// FetchItemDataEmailID holds data returned by FETCH EMAILID.
+type FetchItemDataEmailID struct {
+	EmailID string
+}
+
+func (FetchItemDataEmailID) fetchItemData() {}
+
+// FetchItemDataThreadID holds data returned by FETCH THREADID.
+type FetchItemDataThreadID struct {
+	ThreadID string // empty if the server doesn't support threads
+}
+
+func (FetchItemDataThreadID) fetchItemData() {}
+
 // FetchItemDataRFC822Size holds data returned by FETCH RFC822.SIZE.
 type FetchItemDataRFC822Size struct {
 	Size int64
@@ -400,7 +642,7 @@ func (FetchItemDataBinarySectionSize) fetchItemData() {}
 //
 // This requires the CONDSTORE extension.
 type FetchItemDataModSeq struct {
-	ModSeq uint64
+	ModSeq imap.ModSeq
 }
 
 func (FetchItemDataModSeq) fetchItemData() {}
@@ -419,33 +661,81 @@ type FetchMessageBuffer struct {
 	BodySection       map[*imap.FetchItemBodySection][]byte
 	BinarySection     map[*imap.FetchItemBinarySection][]byte
 	BinarySectionSize []FetchItemDataBinarySectionSize
-	ModSeq            uint64 // requires CONDSTORE
+	ModSeq            imap.ModSeq // requires CONDSTORE
+	SaveDate          time.Time   // requires SAVEDATE
+	Preview           *string     // requires PREVIEW
+	EmailID           string      // requires OBJECTID
+	ThreadID          string      // requires OBJECTID
+
+	// Sections which have been written to temporary files by
+	// FetchCommand.CollectWithOptions, instead of being stored in
+	// BodySection and BinarySection. The files are removed by Close.
+	BodySectionFile   map[*imap.FetchItemBodySection]*os.File
+	BinarySectionFile map[*imap.FetchItemBinarySection]*os.File
 }
 
-func (buf *FetchMessageBuffer) populateItemData(item FetchItemData) error {
+// Close removes the temporary files of the buffer, if any.
+func (buf *FetchMessageBuffer) Close() error {
+	var firstErr error
+	for section, f := range buf.BodySectionFile {
+		if err := removeFile(f); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(buf.BodySectionFile, section)
+	}
+	for section, f := range buf.BinarySectionFile {
+		if err := removeFile(f); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(buf.BinarySectionFile, section)
+	}
+	return firstErr
+}
+
+func (buf *FetchMessageBuffer) populateItemData(item FetchItemData, budget *collectBudget) error {
 	switch item := item.(type) {
 	case FetchItemDataBodySection:
-		var b []byte
+		var (
+			b []byte
+			f *os.File
+		)
 		if item.Literal != nil {
 			var err error
-			b, err = io.ReadAll(item.Literal)
+			b, f, err = budget.readLiteral(item.Literal)
 			if err != nil {
 				return err
 			}
 		}
+		if f != nil {
+			if buf.BodySectionFile == nil {
+				buf.BodySectionFile = make(map[*imap.FetchItemBodySection]*os.File)
+			}
+			buf.BodySectionFile[item.Section] = f
+			break
+		}
 		if buf.BodySection == nil {
 			buf.BodySection = make(map[*imap.FetchItemBodySection][]byte)
 		}
 		buf.BodySection[item.Section] = b
 	case FetchItemDataBinarySection:
-		var b []byte
+		var (
+			b []byte
+			f *os.File
+		)
 		if item.Literal != nil {
 			var err error
-			b, err = io.ReadAll(item.Literal)
+			b, f, err = budget.readLiteral(item.Literal)
 			if err != nil {
 				return err
 			}
 		}
+		if f != nil {
+			if buf.BinarySectionFile == nil {
+				buf.BinarySectionFile = make(map[*imap.FetchItemBinarySection]*os.File)
+			}
+			buf.BinarySectionFile[item.Section] = f
+			break
+		}
 		if buf.BinarySection == nil {
 			buf.BinarySection = make(map[*imap.FetchItemBinarySection][]byte)
 		}
@@ -466,6 +756,14 @@ func (buf *FetchMessageBuffer) populateItemData(item FetchItemData) error {
 		buf.BinarySectionSize = append(buf.BinarySectionSize, item)
 	case FetchItemDataModSeq:
 		buf.ModSeq = item.ModSeq
+	case FetchItemDataSaveDate:
+		buf.SaveDate = item.Time
+	case FetchItemDataPreview:
+		buf.Preview = item.Preview
+	case FetchItemDataEmailID:
+		buf.EmailID = item.EmailID
+	case FetchItemDataThreadID:
+		buf.ThreadID = item.ThreadID
 	default:
 		panic(fmt.Errorf("unsupported fetch item data %T", item))
 	}
@@ -485,7 +783,14 @@ func (c *Client) handleFetch(seqNum uint32) error {
 	// the response data. But the response data comes in in a streaming
 	// fashion: it can contain literals. Assume that the UID will be returned
 	// before any literal.
-	var uid imap.UID
+	var (
+		uid         imap.UID
+		flags       []imap.Flag
+		hasFlags    bool
+		unsolicited bool
+		rawCmd      *RawCommand
+		rawItems    imap.RawList // items passed to rawCmd
+	)
 	handled := false
 	handleMsg := func() {
 		if handled {
@@ -508,9 +813,21 @@ func (c *Client) handleFetch(seqNum uint32) error {
 		if cmd != nil {
 			cmd := cmd.(*FetchCommand)
 			cmd.msgs <- msg
+		} else if cmd := findPendingCmdByType[*SelectCommand](c); cmd != nil && cmd.resync != nil {
+			// Changes reported by SELECT with the QRESYNC parameter
+			cmd.resync.wg.Add(1)
+			go cmd.resync.collect(msg)
+		} else if h := c.notifyHandler(""); h != nil && h.Fetch != nil {
+			unsolicited = true
+			go h.Fetch(msg)
+		} else if idler := c.activeIdler(); idler != nil && idler.options.EventHandler != nil {
+			unsolicited = true
+			go idler.handleFetch(msg)
 		} else if handler := c.options.unilateralDataHandler().Fetch; handler != nil {
+			unsolicited = true
 			go handler(msg)
 		} else {
+			unsolicited = true
 			go msg.discard()
 		}
 
@@ -519,7 +836,7 @@ func (c *Client) handleFetch(seqNum uint32) error {
 	defer handleMsg()
 
 	numAtts := 0
-	return dec.ExpectList(func() error {
+	err := dec.ExpectList(func() error {
 		var attName string
 		if !dec.Expect(dec.Func(&attName, isMsgAttNameChar), "msg-att name") {
 			return dec.Err()
@@ -536,11 +853,13 @@ func (c *Client) handleFetch(seqNum uint32) error {
 				return dec.Err()
 			}
 
-			flags, err := internal.ExpectFlagList(dec)
+			var err error
+			flags, err = internal.ExpectFlagList(dec)
 			if err != nil {
 				return err
 			}
 
+			hasFlags = true
 			item = FetchItemDataFlags{Flags: flags}
 		case "ENVELOPE":
 			if !dec.ExpectSP() {
@@ -558,7 +877,7 @@ func (c *Client) handleFetch(seqNum uint32) error {
 				return dec.Err()
 			}
 
-			t, err := internal.ExpectDateTime(dec)
+			t, err := internal.ExpectDateTime(dec, true)
 			if err != nil {
 				return err
 			}
@@ -672,13 +991,76 @@ func (c *Client) handleFetch(seqNum uint32) error {
 				Size: size,
 			}
 		case "MODSEQ":
-			var modSeq uint64
+			var modSeq imap.ModSeq
 			if !dec.ExpectSP() || !dec.ExpectSpecial('(') || !dec.ExpectModSeq(&modSeq) || !dec.ExpectSpecial(')') {
 				return dec.Err()
 			}
 			item = FetchItemDataModSeq{ModSeq: modSeq}
+		case "SAVEDATE":
+			if !dec.ExpectSP() {
+				return dec.Err()
+			}
+
+			t, err := internal.DecodeDateTime(dec, true)
+			if err != nil {
+				return err
+			} else if t.IsZero() && !dec.ExpectNIL() {
+				return dec.Err()
+			}
+			item = FetchItemDataSaveDate{Time: t}
+		case "PREVIEW":
+			if !dec.ExpectSP() {
+				return dec.Err()
+			}
+
+			var (
+				preview *string
+				s       string
+			)
+			if dec.String(&s) {
+				preview = &s
+			} else if !dec.ExpectNIL() {
+				return dec.Err()
+			}
+			item = FetchItemDataPreview{Preview: preview}
+		case "EMAILID":
+			var id string
+			if !dec.ExpectSP() || !readObjectID(dec, &id) {
+				return dec.Err()
+			}
+			item = FetchItemDataEmailID{EmailID: id}
+		case "THREADID":
+			var id string
+			if !dec.ExpectSP() {
+				return dec.Err()
+			}
+			if !dec.Special('(') {
+				if !dec.ExpectNIL() {
+					return dec.Err()
+				}
+			} else if !dec.ExpectAtom(&id) || !dec.ExpectSpecial(')') {
+				return dec.Err()
+			}
+			item = FetchItemDataThreadID{ThreadID: id}
 		default:
-			return fmt.Errorf("unsupported msg-att name: %q", attName)
+			if rawCmd == nil {
+				rawCmd = c.findRawCmd("FETCH", true)
+			}
+			if rawCmd == nil {
+				rawCmd = c.findRawCmd("FETCH", false)
+			}
+			if rawCmd == nil {
+				return fmt.Errorf("unsupported msg-att name: %q", attName)
+			}
+			if !dec.ExpectSP() {
+				return dec.Err()
+			}
+			value, err := readRawArg(dec)
+			if err != nil {
+				return err
+			}
+			rawItems = append(rawItems, imap.RawAtom(attName), value)
+			return nil
 		}
 
 		numAtts++
@@ -698,6 +1080,31 @@ func (c *Client) handleFetch(seqNum uint32) error {
 		}
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	handleMsg()
+	if rawCmd != nil {
+		var args imap.RawList
+		if uid != 0 {
+			args = append(args, imap.RawAtom("UID"), imap.RawAtom(strconv.FormatUint(uint64(uid), 10)))
+		}
+		rawCmd.handle(&RawResponse{
+			Num:  seqNum,
+			Type: "FETCH",
+			Args: []imap.RawArg{append(args, rawItems...)},
+		})
+	}
+	if view := c.mailboxView(); view != nil && findPendingCmdByType[*SelectCommand](c) == nil {
+		view.handleFetch(seqNum, uid, flags, hasFlags)
+	}
+	if unsolicited && hasFlags {
+		queueUpdate(c, &c.handlers.flags, func(f func(uint32, imap.UID, []imap.Flag)) {
+			f(seqNum, uid, flags)
+		})
+	}
+	return nil
 }
 
 func isMsgAttNameChar(ch byte) bool {
@@ -716,7 +1123,7 @@ func readEnvelope(dec *imapwire.Decoder, options *Options) (*imap.Envelope, erro
 		return nil, dec.Err()
 	}
 	// TODO: handle error
-	envelope.Date, _ = netmail.ParseDate(date)
+	envelope.Date, _ = imap.ParseHeaderDate(date)
 	envelope.Subject, _ = options.decodeText(subject)
 
 	addrLists := []struct {
@@ -1027,6 +1434,7 @@ func readBodyFldDsp(dec *imapwire.Decoder, options *Options) (*imap.BodyStructur
 	if !dec.ExpectString(&disp.Value) || !dec.ExpectSP() {
 		return nil, dec.Err()
 	}
+	disp.Value = strings.ToLower(disp.Value)
 
 	var err error
 	disp.Params, err = readBodyFldParam(dec, options)
@@ -1142,18 +1550,18 @@ func readSectionSpec(dec *imapwire.Decoder) (*imap.FetchItemBodySection, error)
 		return nil, err
 	}
 	if offset != nil {
-		section.Partial = &imap.SectionPartial{Offset: int64(*offset)}
+		section.Partial = &imap.SectionPartial{Offset: *offset}
 	}
 
 	return &section, nil
 }
 
-func readPartialOffset(dec *imapwire.Decoder) (*uint32, error) {
+func readPartialOffset(dec *imapwire.Decoder) (*int64, error) {
 	if !dec.Special('<') {
 		return nil, nil
 	}
-	var offset uint32
-	if !dec.ExpectNumber(&offset) || !dec.ExpectSpecial('>') {
+	var offset int64
+	if !dec.ExpectNumber64(&offset) || !dec.ExpectSpecial('>') {
 		return nil, dec.Err()
 	}
 	return &offset, nil
@@ -1200,3 +1608,9 @@ func (lit *fetchLiteralReader) Read(b []byte) (int, error) {
 	}
 	return n, err
 }
+
+// readObjectID reads a parenthesized object identifier, as defined in
+// RFC 8474. Object identifiers are case-sensitive.
+func readObjectID(dec *imapwire.Decoder, ptr *string) bool {
+	return dec.ExpectSpecial('(') && dec.ExpectAtom(ptr) && dec.ExpectSpecial(')')
+}
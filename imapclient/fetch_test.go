@@ -1,10 +1,20 @@
 package imapclient_test
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"reflect"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
 )
 
 func TestFetch(t *testing.T) {
@@ -36,6 +46,51 @@ func TestFetch(t *testing.T) {
 	}
 }
 
+func TestFetch_mimeSpecifier(t *testing.T) {
+	client, server := newClientServerPair(t, imap.ConnStateSelected)
+	defer client.Close()
+	defer server.Close()
+
+	const rawMsg = "Subject: Forward\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"See attached\r\n" +
+		"--b\r\n" +
+		"Content-Type: message/rfc822\r\n" +
+		"\r\n" +
+		"Subject: Original\r\n" +
+		"\r\n" +
+		"Original body\r\n" +
+		"--b--\r\n"
+	uid := appendRawMessage(t, client, rawMsg)
+
+	tests := []struct {
+		section *imap.FetchItemBodySection
+		want    string
+	}{
+		{&imap.FetchItemBodySection{Part: []int{2}, Specifier: imap.PartSpecifierMIME}, "Content-Type: message/rfc822\r\n\r\n"},
+		{&imap.FetchItemBodySection{Part: []int{2}, Specifier: imap.PartSpecifierHeader}, "Subject: Original\r\n\r\n"},
+	}
+	for _, tc := range tests {
+		tc.section.Peek = true
+		var sb strings.Builder
+		if _, err := client.FetchBodySectionTo(uid, tc.section, &sb); err != nil {
+			t.Errorf("FetchBodySectionTo(%v) = %v", tc.section, err)
+		} else if sb.String() != tc.want {
+			t.Errorf("FetchBodySectionTo(%v) = %q, want %q", tc.section, sb.String(), tc.want)
+		}
+	}
+
+	// MIME doesn't apply to the top-level message
+	section := &imap.FetchItemBodySection{Specifier: imap.PartSpecifierMIME}
+	if _, err := client.FetchBodySectionTo(uid, section, io.Discard); err == nil {
+		t.Errorf("FetchBodySectionTo(%v) = nil, want an error", section)
+	}
+}
+
 func TestFetch_closedConn(t *testing.T) {
 	client, server := newClientServerPair(t, imap.ConnStateSelected)
 	defer client.Close()
@@ -54,3 +109,815 @@ func TestFetch_closedConn(t *testing.T) {
 		t.Errorf("FetchCommand.Collect() = nil, want an error")
 	}
 }
+
+func TestFetchBodySectionTo(t *testing.T) {
+	client, server := newClientServerPair(t, imap.ConnStateSelected)
+	defer client.Close()
+	defer server.Close()
+
+	const bodySize = 8 * 1024 * 1024
+	header := "Subject: Large message\r\n\r\n"
+	line := strings.Repeat("a", 98) + "\r\n"
+	body := strings.Repeat(line, bodySize/len(line))
+	rawMsg := header + body
+
+	appendCmd := client.Append("INBOX", int64(len(rawMsg)), nil)
+	io.WriteString(appendCmd, rawMsg)
+	appendCmd.Close()
+	appendData, err := appendCmd.Wait()
+	if err != nil {
+		t.Fatalf("AppendCommand.Wait() = %v", err)
+	}
+	uid := appendData.UID
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	var w countingWriter
+	n, err := client.FetchBodySectionTo(uid, &imap.FetchItemBodySection{Peek: true}, &w)
+	if err != nil {
+		t.Fatalf("FetchBodySectionTo() = %v", err)
+	}
+
+	runtime.ReadMemStats(&after)
+	if n != int64(len(rawMsg)) || w.n != n {
+		t.Errorf("FetchBodySectionTo() = %v (wrote %v), want %v", n, w.n, len(rawMsg))
+	}
+	// The server shares the same process, leave some room for its own
+	// allocations
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > bodySize/4 {
+		t.Errorf("FetchBodySectionTo() allocated %v bytes, want less than %v", alloc, bodySize/4)
+	}
+
+	// Download the message in chunks
+	var buf strings.Builder
+	const chunkSize = 3 * 1024 * 1024
+	for offset := int64(0); ; offset += chunkSize {
+		section := &imap.FetchItemBodySection{
+			Peek:    true,
+			Partial: &imap.SectionPartial{Offset: offset, Size: chunkSize},
+		}
+		n, err := client.FetchBodySectionTo(uid, section, &buf)
+		if err != nil {
+			t.Fatalf("FetchBodySectionTo() with offset %v = %v", offset, err)
+		}
+		if n < chunkSize {
+			break
+		}
+	}
+	if buf.String() != rawMsg {
+		t.Errorf("chunked download mismatch: got %v bytes, want %v", buf.Len(), len(rawMsg))
+	}
+}
+
+const nestedRawMessage = "MIME-Version: 1.0\r\n" +
+	"Subject: Nested\r\n" +
+	"Content-Type: multipart/mixed; boundary=mixed\r\n" +
+	"\r\n" +
+	"--mixed\r\n" +
+	"Content-Type: multipart/related; boundary=related\r\n" +
+	"\r\n" +
+	"--related\r\n" +
+	"Content-Type: multipart/alternative; boundary=alternative\r\n" +
+	"\r\n" +
+	"--alternative\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Hello plain\r\n" +
+	"--alternative\r\n" +
+	"Content-Type: text/html\r\n" +
+	"\r\n" +
+	"<p>Hello HTML</p>\r\n" +
+	"--alternative--\r\n" +
+	"--related\r\n" +
+	"Content-Type: image/png; name=\"=?utf-8?q?logo=C3=A9.png?=\"\r\n" +
+	"Content-Disposition: inline\r\n" +
+	"Content-Id: <logo>\r\n" +
+	"\r\n" +
+	"PNG\r\n" +
+	"--related--\r\n" +
+	"--mixed\r\n" +
+	"Content-Type: application/pdf\r\n" +
+	"Content-Disposition: attachment; filename*=utf-8''r%C3%A9sum%C3%A9.pdf\r\n" +
+	"\r\n" +
+	"PDF\r\n" +
+	"--mixed--\r\n"
+
+func TestFetch_bodyStructureHelpers(t *testing.T) {
+	client, server := newClientServerPair(t, imap.ConnStateSelected)
+	defer client.Close()
+	defer server.Close()
+
+	appendCmd := client.Append("INBOX", int64(len(nestedRawMessage)), nil)
+	io.WriteString(appendCmd, nestedRawMessage)
+	appendCmd.Close()
+	appendData, err := appendCmd.Wait()
+	if err != nil {
+		t.Fatalf("AppendCommand.Wait() = %v", err)
+	}
+	uid := appendData.UID
+
+	fetchOptions := &imap.FetchOptions{
+		BodyStructure: &imap.FetchItemBodyStructure{Extended: true},
+	}
+	messages, err := client.Fetch(imap.UIDSetNum(uid), fetchOptions).Collect()
+	if err != nil {
+		t.Fatalf("Fetch().Collect() = %v", err)
+	} else if len(messages) != 1 {
+		t.Fatalf("len(messages) = %v, want 1", len(messages))
+	}
+	bs := messages[0].BodyStructure
+
+	path, part := bs.FindText()
+	if part == nil || part.MediaType() != "text/plain" || !reflect.DeepEqual(path, []int{1, 1, 1}) {
+		t.Errorf("FindText() = %v, %v, want text/plain at [1 1 1]", path, part)
+	}
+
+	var (
+		attachmentPaths [][]int
+		filenames       []string
+	)
+	for _, att := range bs.Attachments() {
+		attachmentPaths = append(attachmentPaths, att.Path)
+		filename, _ := att.Part.Filename()
+		filenames = append(filenames, filename)
+	}
+	if want := [][]int{{1, 2}, {2}}; !reflect.DeepEqual(attachmentPaths, want) {
+		t.Errorf("Attachments() paths = %v, want %v", attachmentPaths, want)
+	}
+	if want := []string{"logoé.png", "résumé.pdf"}; !reflect.DeepEqual(filenames, want) {
+		t.Errorf("Attachments() filenames = %v, want %v", filenames, want)
+	}
+
+	// The paths can be used to fetch the parts
+	var buf strings.Builder
+	section := &imap.FetchItemBodySection{Part: path, Peek: true}
+	if _, err := client.FetchBodySectionTo(uid, section, &buf); err != nil {
+		t.Fatalf("FetchBodySectionTo() = %v", err)
+	}
+	if got := strings.TrimSpace(buf.String()); got != "Hello plain" {
+		t.Errorf("text body = %q, want %q", got, "Hello plain")
+	}
+
+	// Without a text/plain alternative, text/html is used
+	mixed := bs.(*imap.BodyStructureMultiPart)
+	related := mixed.Children[0].(*imap.BodyStructureMultiPart)
+	alternative := related.Children[0].(*imap.BodyStructureMultiPart)
+	alternative.Children = alternative.Children[1:]
+	path, part = bs.FindText()
+	if part == nil || part.MediaType() != "text/html" || !reflect.DeepEqual(path, []int{1, 1, 1}) {
+		t.Errorf("FindText() = %v, %v, want text/html at [1 1 1]", path, part)
+	}
+}
+
+func TestBodyStructureSinglePart_Filename(t *testing.T) {
+	testCases := []struct {
+		params map[string]string
+		want   string
+	}{
+		{map[string]string{"filename": "a.txt"}, "a.txt"},
+		{map[string]string{"filename*": "iso-8859-1'fr'caf%E9.txt"}, "café.txt"},
+		{map[string]string{"filename*0*": "utf-8''r%C3%A9", "filename*1": "sum", "filename*2*": "%C3%A9.pdf"}, "résumé.pdf"},
+		{map[string]string{"filename": "=?utf-8?b?w6kudHh0?="}, "é.txt"},
+		{map[string]string{"size": "42"}, ""},
+	}
+	for _, tc := range testCases {
+		bs := &imap.BodyStructureSinglePart{
+			Type:    "application",
+			Subtype: "octet-stream",
+			Extended: &imap.BodyStructureSinglePartExt{
+				Disposition: &imap.BodyStructureDisposition{Value: "attachment", Params: tc.params},
+			},
+		}
+		if got, ok := bs.Filename(); got != tc.want || ok != (tc.want != "") {
+			t.Errorf("Filename() with params %v = %q, %v, want %q", tc.params, got, ok, tc.want)
+		}
+	}
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	w.n += int64(len(b))
+	return len(b), nil
+}
+
+func TestClient_Fetch_unsolicitedModSeq(t *testing.T) {
+	greeting := "* OK [CAPABILITY IMAP4rev1 ENABLE CONDSTORE] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, _ := readScriptTaggedCommand(t, br, w)
+		// Unsolicited flag updates for the same and other messages
+		io.WriteString(w, "* 2 FETCH (MODSEQ (12) FLAGS (\\Seen))\r\n")
+		io.WriteString(w, "* 1 FETCH (UID 7 MODSEQ (10) FLAGS ())\r\n")
+		io.WriteString(w, "* 1 FETCH (MODSEQ (11) FLAGS (\\Deleted))\r\n")
+		io.WriteString(w, tag+" OK FETCH completed\r\n")
+	})
+
+	msgs, err := client.Fetch(imap.UIDSetNum(7), &imap.FetchOptions{Flags: true}).Collect()
+	if err != nil {
+		t.Fatalf("Fetch().Collect() = %v", err)
+	} else if len(msgs) != 1 {
+		t.Fatalf("len(msgs) = %v, want 1", len(msgs))
+	}
+	if msg := msgs[0]; msg.UID != 7 || msg.ModSeq != 10 || len(msg.Flags) != 0 {
+		t.Errorf("msg = %v, want UID 7 with MODSEQ 10 and no flags", msg)
+	}
+}
+
+// gb2312Reader decodes the few GB2312 characters used in tests.
+func gb2312Reader(charset string, input io.Reader) (io.Reader, error) {
+	if !strings.EqualFold(charset, "gb2312") {
+		return nil, fmt.Errorf("unhandled charset %q", charset)
+	}
+	b, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	table := map[string]string{"\xc4\xe3": "你", "\xba\xc3": "好"}
+	var sb strings.Builder
+	for i := 0; i+1 < len(b); i += 2 {
+		r, ok := table[string(b[i:i+2])]
+		if !ok {
+			return nil, fmt.Errorf("unsupported GB2312 character %x", b[i:i+2])
+		}
+		sb.WriteString(r)
+	}
+	return strings.NewReader(sb.String()), nil
+}
+
+func TestClient_Fetch_envelopeCharset(t *testing.T) {
+	const subject = "=?utf-8?q?Re:?= =?GB2312?B?xOO6ww==?="
+	for _, tc := range []struct {
+		name        string
+		wordDecoder *mime.WordDecoder
+		want        string
+	}{
+		{"default", nil, "Re: =?GB2312?B?xOO6ww==?="},
+		{"charset-reader", &mime.WordDecoder{CharsetReader: gb2312Reader}, "Re:你好"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			greeting := "* OK [CAPABILITY IMAP4rev1] Server ready"
+			options := &imapclient.Options{WordDecoder: tc.wordDecoder}
+			client := newScriptedClientWithOptions(t, greeting, options, func(br *bufio.Reader, w io.Writer) {
+				tag, _ := readScriptTaggedCommand(t, br, w)
+				io.WriteString(w, `* 1 FETCH (UID 1 ENVELOPE (NIL "`+subject+`" NIL NIL NIL NIL NIL NIL NIL NIL))`+"\r\n")
+				io.WriteString(w, tag+" OK FETCH completed\r\n")
+			})
+
+			msgs, err := client.Fetch(imap.UIDSetNum(1), &imap.FetchOptions{Envelope: true}).Collect()
+			if err != nil {
+				t.Fatalf("Fetch().Collect() = %v", err)
+			} else if len(msgs) != 1 || msgs[0].Envelope == nil {
+				t.Fatalf("Fetch().Collect() = %v, want one message with an envelope", msgs)
+			}
+			if got := msgs[0].Envelope.Subject; got != tc.want {
+				t.Errorf("Envelope.Subject = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestClient_Fetch_saveDatePreview(t *testing.T) {
+	commands := make(chan string, 1)
+	greeting := "* OK [CAPABILITY IMAP4rev1 SAVEDATE PREVIEW] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, args := readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, `* 1 FETCH (UID 1 SAVEDATE "17-Jul-1996 02:44:25 -0700" PREVIEW "Hello")`+"\r\n")
+		io.WriteString(w, `* 2 FETCH (UID 2 SAVEDATE NIL PREVIEW NIL)`+"\r\n")
+		io.WriteString(w, `* 3 FETCH (UID 3 SAVEDATE NIL PREVIEW "")`+"\r\n")
+		io.WriteString(w, tag+" OK FETCH completed\r\n")
+	})
+
+	options := &imap.FetchOptions{
+		SaveDate: true,
+		Preview:  &imap.FetchItemPreview{Lazy: true},
+	}
+	msgs, err := client.Fetch(imap.UIDSetNum(1, 2, 3), options).Collect()
+	if err != nil {
+		t.Fatalf("Fetch().Collect() = %v", err)
+	} else if len(msgs) != 3 {
+		t.Fatalf("len(msgs) = %v, want 3", len(msgs))
+	}
+
+	cmd := <-commands
+	if !strings.Contains(cmd, "SAVEDATE") || !strings.Contains(cmd, "PREVIEW (LAZY)") {
+		t.Errorf("command = %q, want SAVEDATE and PREVIEW (LAZY)", cmd)
+	}
+
+	wantDate := time.Date(1996, time.July, 17, 2, 44, 25, 0, time.FixedZone("", -7*60*60))
+	if !msgs[0].SaveDate.Equal(wantDate) {
+		t.Errorf("msgs[0].SaveDate = %v, want %v", msgs[0].SaveDate, wantDate)
+	}
+	if p := msgs[0].Preview; p == nil || *p != "Hello" {
+		t.Errorf("msgs[0].Preview = %v, want %q", p, "Hello")
+	}
+	if !msgs[1].SaveDate.IsZero() || msgs[1].Preview != nil {
+		t.Errorf("msgs[1] = %v %v, want zero save date and nil preview", msgs[1].SaveDate, msgs[1].Preview)
+	}
+	if p := msgs[2].Preview; p == nil || *p != "" {
+		t.Errorf("msgs[2].Preview = %v, want empty string", p)
+	}
+}
+
+func TestClient_Fetch_saveDatePreviewUnsupported(t *testing.T) {
+	commands := make(chan string, 1)
+	greeting := "* OK [CAPABILITY IMAP4rev1] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, args := readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, `* 1 FETCH (UID 1 PREVIEW "Hello")`+"\r\n")
+		io.WriteString(w, tag+" OK FETCH completed\r\n")
+	})
+
+	options := &imap.FetchOptions{Preview: &imap.FetchItemPreview{}}
+	_, err := client.Fetch(imap.UIDSetNum(1), options).Collect()
+	var capErr *imapclient.CapabilityError
+	if !errors.As(err, &capErr) || capErr.Cap != imap.CapPreview {
+		t.Errorf("Fetch().Collect() = %v, want a PREVIEW CapabilityError", err)
+	}
+
+	options.Force = true
+	msgs, err := client.Fetch(imap.UIDSetNum(1), options).Collect()
+	if err != nil {
+		t.Fatalf("Fetch().Collect() with Force = %v", err)
+	}
+	if cmd := <-commands; cmd != "UID FETCH 1 (UID PREVIEW)" {
+		t.Errorf("command = %q, want %q", cmd, "UID FETCH 1 (UID PREVIEW)")
+	}
+	if len(msgs) != 1 || msgs[0].Preview == nil || *msgs[0].Preview != "Hello" {
+		t.Errorf("Fetch().Collect() = %v, want one message with preview %q", msgs, "Hello")
+	}
+}
+
+func TestClient_Fetch_unknownCTE(t *testing.T) {
+	greeting := "* OK [CAPABILITY IMAP4rev1 BINARY] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, _ := readScriptTaggedCommand(t, br, w)
+		io.WriteString(w, tag+" NO [UNKNOWN-CTE] Can't decode x-uuencode\r\n")
+		tag, _ = readScriptTaggedCommand(t, br, w)
+		io.WriteString(w, "* 1 FETCH (UID 1 BODY[1] {5}\r\nhello)\r\n")
+		io.WriteString(w, tag+" OK FETCH completed\r\n")
+	})
+
+	section := &imap.FetchItemBinarySection{Part: []int{1}, Peek: true}
+	_, err := client.Fetch(imap.UIDSetNum(1), &imap.FetchOptions{
+		BinarySection: []*imap.FetchItemBinarySection{section},
+	}).Collect()
+	if !imapclient.IsUnknownCTE(err) {
+		t.Fatalf("Fetch(BINARY.PEEK[1]) = %v, want UNKNOWN-CTE", err)
+	}
+
+	// Retry with a plain BODY fetch
+	bodySection := &imap.FetchItemBodySection{Part: []int{1}, Peek: true}
+	msgs, err := client.Fetch(imap.UIDSetNum(1), &imap.FetchOptions{
+		BodySection: []*imap.FetchItemBodySection{bodySection},
+	}).Collect()
+	if err != nil {
+		t.Fatalf("Fetch(BODY.PEEK[1]) = %v", err)
+	} else if len(msgs) != 1 || len(msgs[0].BodySection) != 1 {
+		t.Fatalf("Fetch(BODY.PEEK[1]) = %v, want one message with one section", msgs)
+	}
+	for _, b := range msgs[0].BodySection {
+		if string(b) != "hello" {
+			t.Errorf("BODY[1] = %q, want %q", b, "hello")
+		}
+	}
+}
+
+// rfc822RawMessage has the same structure as the example in RFC 9051 section
+// 6.4.5, plus a message/rfc822 part with a non-multipart body.
+const rfc822RawMessage = "MIME-Version: 1.0\r\n" +
+	"Subject: Part numbers\r\n" +
+	"Content-Type: multipart/mixed; boundary=b1\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Part 1\r\n" +
+	"--b1\r\n" +
+	"Content-Type: application/octet-stream\r\n" +
+	"\r\n" +
+	"Part 2\r\n" +
+	"--b1\r\n" +
+	"Content-Type: message/rfc822\r\n" +
+	"\r\n" +
+	"Subject: Part 3\r\n" +
+	"Content-Type: multipart/mixed; boundary=b3\r\n" +
+	"\r\n" +
+	"--b3\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Part 3.1\r\n" +
+	"--b3\r\n" +
+	"Content-Type: application/octet-stream\r\n" +
+	"\r\n" +
+	"Part 3.2\r\n" +
+	"--b3--\r\n" +
+	"--b1\r\n" +
+	"Content-Type: multipart/mixed; boundary=b4\r\n" +
+	"\r\n" +
+	"--b4\r\n" +
+	"Content-Type: image/gif\r\n" +
+	"\r\n" +
+	"Part 4.1\r\n" +
+	"--b4\r\n" +
+	"Content-Type: message/rfc822\r\n" +
+	"\r\n" +
+	"Subject: Part 4.2\r\n" +
+	"Content-Type: multipart/mixed; boundary=b42\r\n" +
+	"\r\n" +
+	"--b42\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Part 4.2.1\r\n" +
+	"--b42\r\n" +
+	"Content-Type: multipart/alternative; boundary=b422\r\n" +
+	"\r\n" +
+	"--b422\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Part 4.2.2.1\r\n" +
+	"--b422\r\n" +
+	"Content-Type: text/richtext\r\n" +
+	"\r\n" +
+	"Part 4.2.2.2\r\n" +
+	"--b422--\r\n" +
+	"--b42--\r\n" +
+	"--b4--\r\n" +
+	"--b1\r\n" +
+	"Content-Type: message/rfc822\r\n" +
+	"\r\n" +
+	"Subject: Part 5\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Part 5.1\r\n" +
+	"--b1--\r\n"
+
+func TestBodyStructure_Walk(t *testing.T) {
+	client, server := newClientServerPair(t, imap.ConnStateSelected)
+	defer client.Close()
+	defer server.Close()
+
+	uid := appendRawMessage(t, client, rfc822RawMessage)
+	messages, err := client.Fetch(imap.UIDSetNum(uid), &imap.FetchOptions{
+		BodyStructure: &imap.FetchItemBodyStructure{},
+	}).Collect()
+	if err != nil {
+		t.Fatalf("Fetch().Collect() = %v", err)
+	}
+	bs := messages[0].BodyStructure
+
+	// Part numbers from the RFC example. The parts are fetched below, which
+	// checks them against Dovecot when GOIMAP_TEST_DOVECOT is set.
+	type walkedPart struct {
+		path      string
+		mediaType string
+	}
+	want := []walkedPart{
+		{"", "multipart/mixed"},
+		{"1", "text/plain"},
+		{"2", "application/octet-stream"},
+		{"3", "message/rfc822"},
+		{"3", "multipart/mixed"},
+		{"3.1", "text/plain"},
+		{"3.2", "application/octet-stream"},
+		{"4", "multipart/mixed"},
+		{"4.1", "image/gif"},
+		{"4.2", "message/rfc822"},
+		{"4.2", "multipart/mixed"},
+		{"4.2.1", "text/plain"},
+		{"4.2.2", "multipart/alternative"},
+		{"4.2.2.1", "text/plain"},
+		{"4.2.2.2", "text/richtext"},
+		{"5", "message/rfc822"},
+		{"5.1", "text/plain"},
+	}
+	var (
+		got   []walkedPart
+		paths = make(map[string][]int)
+	)
+	bs.Walk(func(path []int, part imap.BodyStructure) bool {
+		s := strings.Trim(strings.Join(strings.Fields(fmt.Sprint(path)), "."), "[]")
+		got = append(got, walkedPart{s, part.MediaType()})
+		if _, ok := part.(*imap.BodyStructureSinglePart); ok {
+			paths[s] = path
+		}
+		return true
+	})
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Walk() visited %v, want %v", got, want)
+	}
+
+	for s, path := range paths {
+		part := bs.PartAtPath(path)
+		if part == nil {
+			t.Errorf("PartAtPath(%v) = nil", s)
+			continue
+		}
+
+		// The server uses the same part numbers
+		section := &imap.FetchItemBodySection{Specifier: imap.PartSpecifierMIME, Part: path, Peek: true}
+		var buf strings.Builder
+		if _, err := client.FetchBodySectionTo(uid, section, &buf); err != nil {
+			t.Fatalf("FetchBodySectionTo(%v.MIME) = %v", s, err)
+		}
+		if !strings.Contains(strings.ToLower(buf.String()), "content-type: "+part.MediaType()) {
+			t.Errorf("BODY[%v.MIME] = %q, want %v", s, buf.String(), part.MediaType())
+		}
+	}
+
+	if part := bs.PartAtPath([]int{4, 2}); part == nil || part.MediaType() != "message/rfc822" {
+		t.Errorf("PartAtPath(4.2) = %v, want message/rfc822", part)
+	}
+	for _, path := range [][]int{{6}, {0}, {1, 1}, {5, 2}, {4, 2, 3}} {
+		if part := bs.PartAtPath(path); part != nil {
+			t.Errorf("PartAtPath(%v) = %v, want nil", path, part)
+		}
+	}
+
+	// The single part of a non-multipart message is part 1
+	single := &imap.BodyStructureSinglePart{Type: "text", Subtype: "plain"}
+	var singlePaths [][]int
+	single.Walk(func(path []int, part imap.BodyStructure) bool {
+		singlePaths = append(singlePaths, path)
+		return true
+	})
+	if want := [][]int{{1}}; !reflect.DeepEqual(singlePaths, want) {
+		t.Errorf("Walk() visited %v, want %v", singlePaths, want)
+	}
+	if single.PartAtPath([]int{1}) != single || single.PartAtPath([]int{2}) != nil {
+		t.Errorf("PartAtPath() on a non-multipart message returned the wrong part")
+	}
+}
+
+func TestBodyStructureSinglePart_Charset(t *testing.T) {
+	testCases := []struct {
+		typ    string
+		params map[string]string
+		want   string
+	}{
+		{"text", map[string]string{"charset": "UTF-8"}, "utf-8"},
+		{"TEXT", nil, "us-ascii"},
+		{"application", nil, ""},
+		{"application", map[string]string{"charset": "iso-8859-1"}, "iso-8859-1"},
+	}
+	for _, tc := range testCases {
+		bs := &imap.BodyStructureSinglePart{Type: tc.typ, Subtype: "plain", Params: tc.params}
+		if got := bs.Charset(); got != tc.want {
+			t.Errorf("Charset() for %v with params %v = %q, want %q", tc.typ, tc.params, got, tc.want)
+		}
+	}
+}
+
+func TestClient_Fetch_bodyStructureDisposition(t *testing.T) {
+	const bodyStructure = `(` +
+		`("TEXT" "PLAIN" ("CHARSET" "ISO-8859-1") NIL NIL "7BIT" 5 1 NIL ("INLINE" NIL) NIL NIL)` +
+		`("APPLICATION" "PDF" ("NAME" "=?utf-8?q?CV_r=C3=A9sum=C3=A9.pdf?=") NIL NIL "BASE64" 4 NIL ` +
+		`("ATTACHMENT" ("FILENAME*0*" "utf-8''r%C3%A9" "FILENAME*1*" "sum%C3%A9.pdf")) NIL NIL)` +
+		`("APPLICATION" "PDF" ("NAME" "=?utf-8?q?CV_r=C3=A9sum=C3=A9.pdf?=") NIL NIL "BASE64" 4 NIL NIL NIL NIL)` +
+		` "MIXED" ("BOUNDARY" "b") NIL NIL NIL)`
+	client := newScriptedClient(t, "* PREAUTH [CAPABILITY IMAP4rev1] Server ready", func(br *bufio.Reader, w io.Writer) {
+		tag, _ := readScriptTaggedCommand(t, br, w)
+		io.WriteString(w, "* 1 FETCH (UID 1 BODYSTRUCTURE "+bodyStructure+")\r\n")
+		io.WriteString(w, tag+" OK FETCH completed\r\n")
+	})
+
+	msgs, err := client.Fetch(imap.UIDSetNum(1), &imap.FetchOptions{
+		BodyStructure: &imap.FetchItemBodyStructure{Extended: true},
+	}).Collect()
+	if err != nil {
+		t.Fatalf("Fetch().Collect() = %v", err)
+	}
+	parts := msgs[0].BodyStructure.(*imap.BodyStructureMultiPart).Children
+
+	text := parts[0].(*imap.BodyStructureSinglePart)
+	if disp := text.Disposition(); disp == nil || disp.Value != "inline" {
+		t.Errorf("Disposition() = %v, want inline", disp)
+	}
+	if charset := text.Charset(); charset != "iso-8859-1" {
+		t.Errorf("Charset() = %q, want %q", charset, "iso-8859-1")
+	}
+
+	// The Content-Disposition filename is preferred over the Content-Type name
+	attachment := parts[1].(*imap.BodyStructureSinglePart)
+	if disp := attachment.Disposition(); disp == nil || disp.Value != "attachment" {
+		t.Errorf("Disposition() = %v, want attachment", disp)
+	}
+	if filename, _ := attachment.Filename(); filename != "résumé.pdf" {
+		t.Errorf("Filename() = %q, want %q", filename, "résumé.pdf")
+	}
+
+	noDisp := parts[2].(*imap.BodyStructureSinglePart)
+	if filename, _ := noDisp.Filename(); filename != "CV résumé.pdf" {
+		t.Errorf("Filename() = %q, want %q", filename, "CV résumé.pdf")
+	}
+	if charset := noDisp.Charset(); charset != "" {
+		t.Errorf("Charset() = %q, want none", charset)
+	}
+}
+
+func TestFetchOptions_macros(t *testing.T) {
+	tests := []struct {
+		name string
+		got  *imap.FetchOptions
+		want imap.FetchOptions
+	}{
+		{"FAST", imap.FetchOptionsFast(), imap.FetchOptions{
+			Flags:        true,
+			InternalDate: true,
+			RFC822Size:   true,
+		}},
+		{"ALL", imap.FetchOptionsAll(), imap.FetchOptions{
+			Flags:        true,
+			InternalDate: true,
+			RFC822Size:   true,
+			Envelope:     true,
+		}},
+		{"FULL", imap.FetchOptionsFull(), imap.FetchOptions{
+			Flags:         true,
+			InternalDate:  true,
+			RFC822Size:    true,
+			Envelope:      true,
+			BodyStructure: &imap.FetchItemBodyStructure{Extended: false},
+		}},
+	}
+	for _, tc := range tests {
+		if !reflect.DeepEqual(*tc.got, tc.want) {
+			t.Errorf("FetchOptions%v() = %#v, want %#v", tc.name, tc.got, tc.want)
+		}
+	}
+}
+
+func TestFetchOptions_Merge(t *testing.T) {
+	header := &imap.FetchItemBodySection{Specifier: imap.PartSpecifierHeader, Peek: true}
+	options := imap.FetchOptionsFull()
+	options.BodySection = []*imap.FetchItemBodySection{header}
+	options.Preview = &imap.FetchItemPreview{Lazy: true}
+	options.ChangedSince = 42
+	full := options.BodyStructure
+
+	options.Merge(&imap.FetchOptions{
+		UID:           true,
+		BodyStructure: &imap.FetchItemBodyStructure{Extended: true},
+		BodySection: []*imap.FetchItemBodySection{
+			{Specifier: imap.PartSpecifierHeader, Peek: true},
+			{Part: []int{1}},
+		},
+		Preview:      &imap.FetchItemPreview{},
+		ChangedSince: 12,
+	})
+	want := &imap.FetchOptions{
+		Flags:         true,
+		InternalDate:  true,
+		RFC822Size:    true,
+		Envelope:      true,
+		UID:           true,
+		BodyStructure: &imap.FetchItemBodyStructure{Extended: true},
+		BodySection:   []*imap.FetchItemBodySection{header, {Part: []int{1}}},
+		Preview:       &imap.FetchItemPreview{},
+		ChangedSince:  12,
+	}
+	if !reflect.DeepEqual(options, want) {
+		t.Errorf("Merge() = %#v, want %#v", options, want)
+	}
+	if full.Extended {
+		t.Errorf("Merge() modified the body structure item of the receiver in place")
+	}
+}
+
+func TestFetchOptions_Validate(t *testing.T) {
+	rev1 := imap.CapSet{imap.CapIMAP4rev1: {}}
+	tests := []struct {
+		options *imap.FetchOptions
+		caps    imap.CapSet
+		ok      bool
+	}{
+		{imap.FetchOptionsFull(), rev1, true},
+		{&imap.FetchOptions{BinarySection: []*imap.FetchItemBinarySection{{}}}, rev1, false},
+		{&imap.FetchOptions{BinarySection: []*imap.FetchItemBinarySection{{}}}, imap.CapSet{imap.CapIMAP4rev2: {}}, true},
+		{&imap.FetchOptions{BinarySectionSize: []*imap.FetchItemBinarySectionSize{{}}}, imap.CapSet{imap.CapBinary: {}}, true},
+		{&imap.FetchOptions{ModSeq: true}, rev1, false},
+		{&imap.FetchOptions{ChangedSince: 1}, imap.CapSet{imap.CapQResync: {}}, true},
+		{&imap.FetchOptions{Preview: &imap.FetchItemPreview{}}, rev1, false},
+		{&imap.FetchOptions{Preview: &imap.FetchItemPreview{}}, imap.CapSet{imap.CapPreview: {}}, true},
+		{&imap.FetchOptions{Preview: &imap.FetchItemPreview{}, Force: true}, rev1, true},
+		{&imap.FetchOptions{EmailID: true}, rev1, false},
+	}
+	for _, tc := range tests {
+		if err := tc.options.Validate(tc.caps); (err == nil) != tc.ok {
+			t.Errorf("Validate(%v) for %#v = %v, want ok = %v", tc.caps, tc.options, err, tc.ok)
+		}
+	}
+}
+
+func TestFetchOptions_MarksSeen(t *testing.T) {
+	tests := []struct {
+		options *imap.FetchOptions
+		want    bool
+	}{
+		{imap.FetchOptionsFull(), false},
+		{&imap.FetchOptions{BodySection: []*imap.FetchItemBodySection{{Peek: true}}}, false},
+		{&imap.FetchOptions{BodySection: []*imap.FetchItemBodySection{{Peek: true}, {Specifier: imap.PartSpecifierText}}}, true},
+		{&imap.FetchOptions{BinarySection: []*imap.FetchItemBinarySection{{Part: []int{1}}}}, true},
+		{&imap.FetchOptions{BinarySectionSize: []*imap.FetchItemBinarySectionSize{{}}}, false},
+	}
+	for _, tc := range tests {
+		if got := tc.options.MarksSeen(); got != tc.want {
+			t.Errorf("MarksSeen() for %#v = %v, want %v", tc.options, got, tc.want)
+		}
+	}
+}
+
+func TestFetchCommand_CollectWithOptions(t *testing.T) {
+	const (
+		numMessages = 20
+		msgSize     = 5 * 1024 * 1024
+		maxMemory   = 10 * 1024 * 1024
+	)
+
+	client, server := newClientServerPair(t, imap.ConnStateSelected)
+	defer client.Close()
+	defer server.Close()
+
+	var sb strings.Builder
+	for sb.Len() < msgSize {
+		sb.WriteString("The quick brown fox jumps over the lazy dog.\r\n")
+	}
+	body := sb.String()
+
+	rawMsgs := make(map[imap.UID]string)
+	for i := 0; i < numMessages; i++ {
+		rawMsg := fmt.Sprintf("Subject: Message %v\r\n\r\n", i) + body
+		rawMsgs[appendRawMessage(t, client, rawMsg)] = rawMsg
+	}
+
+	fetchOptions := &imap.FetchOptions{
+		UID:         true,
+		BodySection: []*imap.FetchItemBodySection{{Peek: true}},
+	}
+
+	_, err := client.Fetch(imap.UIDSetNum(2, 3, 4), fetchOptions).CollectWithOptions(&imapclient.CollectOptions{
+		MaxMemory: maxMemory,
+	})
+	if !errors.Is(err, imapclient.ErrTooLarge) {
+		t.Errorf("CollectWithOptions() without spilling = %v, want %v", err, imapclient.ErrTooLarge)
+	}
+
+	tempDir := t.TempDir()
+	msgs, err := client.Fetch(imap.SeqSet{{Start: 1, Stop: 0}}, fetchOptions).CollectWithOptions(&imapclient.CollectOptions{
+		MaxMemory:   maxMemory,
+		SpillToDisk: true,
+		TempDir:     tempDir,
+	})
+	if err != nil {
+		t.Fatalf("CollectWithOptions() = %v", err)
+	}
+
+	// The first INBOX message was appended by newClientServerPair
+	if len(msgs) != numMessages+1 {
+		t.Fatalf("CollectWithOptions() returned %v messages, want %v", len(msgs), numMessages+1)
+	}
+	var inMemory, spilled int
+	for _, msg := range msgs {
+		want, ok := rawMsgs[msg.UID]
+		if !ok {
+			continue
+		}
+		if len(msg.BodySection)+len(msg.BodySectionFile) != 1 {
+			t.Fatalf("message %v: got %v body sections, want 1", msg.UID, len(msg.BodySection)+len(msg.BodySectionFile))
+		}
+		var got []byte
+		for _, b := range msg.BodySection {
+			inMemory++
+			got = b
+		}
+		for _, f := range msg.BodySectionFile {
+			spilled++
+			if got, err = io.ReadAll(f); err != nil {
+				t.Fatalf("ReadAll() = %v", err)
+			}
+		}
+		if string(got) != want {
+			t.Errorf("message %v: body section doesn't match", msg.UID)
+		}
+	}
+	if inMemory > maxMemory/msgSize || spilled == 0 {
+		t.Errorf("%v sections in memory and %v spilled, want at most %v in memory", inMemory, spilled, maxMemory/msgSize)
+	}
+
+	if entries, _ := os.ReadDir(tempDir); len(entries) != spilled {
+		t.Errorf("%v temporary files, want %v", len(entries), spilled)
+	}
+	for _, msg := range msgs {
+		if err := msg.Close(); err != nil {
+			t.Errorf("FetchMessageBuffer.Close() = %v", err)
+		}
+	}
+	if entries, _ := os.ReadDir(tempDir); len(entries) != 0 {
+		t.Errorf("%v temporary files left after Close", len(entries))
+	}
+}
@@ -0,0 +1,98 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestClient_greetingPreAuth(t *testing.T) {
+	commands := make(chan string, 1)
+	greeting := "* PREAUTH [CAPABILITY IMAP4rev1] Logged in as fred"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, args := readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, tag+" OK NOOP completed\r\n")
+	})
+
+	if err := client.WaitGreeting(); err != nil {
+		t.Fatalf("WaitGreeting() = %v", err)
+	}
+	if state := client.State(); state != imap.ConnStateAuthenticated {
+		t.Errorf("State() = %v, want %v", state, imap.ConnStateAuthenticated)
+	}
+
+	if err := client.Login(testUsername, testPassword).Wait(); err == nil {
+		t.Errorf("Login().Wait() = nil, want an error")
+	}
+
+	if err := client.Noop().Wait(); err != nil {
+		t.Fatalf("Noop().Wait() = %v", err)
+	}
+	if cmd := <-commands; cmd != "NOOP" {
+		t.Errorf("command = %q, want NOOP", cmd)
+	}
+}
+
+func TestClient_greetingLoginDisabled(t *testing.T) {
+	commands := make(chan string, 1)
+	greeting := "* OK [CAPABILITY IMAP4rev1 STARTTLS LOGINDISABLED] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, args := readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, tag+" OK NOOP completed\r\n")
+	})
+
+	err := client.Login(testUsername, testPassword).Wait()
+	var loginDisabledErr *imapclient.LoginDisabledError
+	if !errors.As(err, &loginDisabledErr) {
+		t.Errorf("Login().Wait() = %v, want a LoginDisabledError", err)
+	}
+
+	// The password must not have been sent
+	if err := client.Noop().Wait(); err != nil {
+		t.Fatalf("Noop().Wait() = %v", err)
+	}
+	if cmd := <-commands; cmd != "NOOP" {
+		t.Errorf("command = %q, want NOOP", cmd)
+	}
+}
+
+func TestClient_greetingBye(t *testing.T) {
+	const byeText = "Too many connections"
+	dialer := dialerFunc(func(ctx context.Context, network, address string) (net.Conn, error) {
+		clientConn, serverConn := net.Pipe()
+		go func() {
+			io.WriteString(serverConn, "* BYE "+byeText+"\r\n")
+			serverConn.Close()
+		}()
+		return clientConn, nil
+	})
+
+	client, err := imapclient.DialInsecure("imap.example.org:143", &imapclient.Options{Dialer: dialer})
+	if err == nil {
+		client.Close()
+		t.Fatalf("DialInsecure() = nil, want an error")
+	}
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) || imapErr.Type != imap.StatusResponseTypeBye {
+		t.Errorf("DialInsecure() = %v, want a BYE error", err)
+	} else if !strings.Contains(err.Error(), byeText) {
+		t.Errorf("DialInsecure() = %v, want the BYE text %q", err, byeText)
+	}
+
+	client = newScriptedClient(t, "* BYE "+byeText, func(br *bufio.Reader, w io.Writer) {})
+	if err := client.WaitGreeting(); !imapclient.IsBye(err) {
+		t.Errorf("WaitGreeting() = %v, want a BYE error", err)
+	}
+	if err := client.Login(testUsername, testPassword).Wait(); !imapclient.IsBye(err) {
+		t.Errorf("Login().Wait() = %v, want a BYE error", err)
+	}
+}
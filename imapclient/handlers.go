@@ -0,0 +1,175 @@
+package imapclient
+
+import (
+	"sync"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// updateQueue is an unbounded FIFO queue of calls to handlers registered with
+// Client.OnExpunge and similar methods.
+//
+// The queue never blocks the goroutine reading responses: a slow handler only
+// delays the handlers queued after it.
+type updateQueue struct {
+	mutex  sync.Mutex
+	l      []func()
+	closed bool
+	ready  chan struct{} // signaled when l is non-empty or the queue is closed
+}
+
+func newUpdateQueue() *updateQueue {
+	return &updateQueue{ready: make(chan struct{}, 1)}
+}
+
+func (q *updateQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (q *updateQueue) push(f func()) {
+	q.mutex.Lock()
+	q.l = append(q.l, f)
+	q.mutex.Unlock()
+	q.signal()
+}
+
+// close stops the queue once all queued calls have been made.
+func (q *updateQueue) close() {
+	q.mutex.Lock()
+	q.closed = true
+	q.mutex.Unlock()
+	q.signal()
+}
+
+// run makes the queued calls until the queue is closed.
+func (q *updateQueue) run() {
+	for {
+		q.mutex.Lock()
+		l, closed := q.l, q.closed
+		q.l = nil
+		q.mutex.Unlock()
+
+		for i, f := range l {
+			l[i] = nil
+			f()
+		}
+		if len(l) > 0 {
+			continue
+		} else if closed {
+			return
+		}
+		<-q.ready
+	}
+}
+
+// updateHandlers holds the handlers registered with Client.OnExpunge and
+// similar methods.
+//
+// The lists are copied on write, so that a snapshot can be used without
+// holding the lock.
+type updateHandlers struct {
+	mutex        sync.Mutex
+	expunge      []*func(seqNum uint32)
+	messageCount []*func(n uint32)
+	flags        []*func(seqNum uint32, uid imap.UID, flags []imap.Flag)
+	status       []*func(data *imap.StatusData)
+	list         []*func(data *imap.ListData)
+	bye          []*func(reason string)
+}
+
+func addUpdateHandler[T any](h *updateHandlers, l *[]*T, f T) (remove func()) {
+	ptr := &f
+
+	h.mutex.Lock()
+	*l = append(*l, ptr)
+	h.mutex.Unlock()
+
+	return func() {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		for i, p := range *l {
+			if p == ptr {
+				*l = append((*l)[:i:i], (*l)[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// queueUpdate queues a call to each handler of a list. It must only be called
+// from the goroutine reading responses.
+func queueUpdate[T any](c *Client, l *[]*T, call func(f T)) {
+	c.handlers.mutex.Lock()
+	handlers := *l
+	c.handlers.mutex.Unlock()
+
+	if len(handlers) == 0 {
+		return
+	}
+	c.updates.push(func() {
+		for _, f := range handlers {
+			call(*f)
+		}
+	})
+}
+
+// OnExpunge registers a handler for unsolicited EXPUNGE responses.
+//
+// Handlers registered with OnExpunge, OnMessageCount, OnFlagsUpdate,
+// OnMailboxStatus, OnListUpdate and OnBye are called on a dedicated goroutine,
+// one at a time, in the order the server sent the updates. In particular,
+// expunged sequence numbers are delivered in order, and each one is relative
+// to the mailbox state after the previous one.
+//
+// Updates are queued while handlers are running, without limit: reading
+// responses is never paused by a slow handler. Handlers may wait for the
+// completion of a command, but the queue grows until they return.
+//
+// Multiple handlers can be registered. The returned function unregisters the
+// handler.
+func (c *Client) OnExpunge(f func(seqNum uint32)) (remove func()) {
+	return addUpdateHandler(&c.handlers, &c.handlers.expunge, f)
+}
+
+// OnMessageCount registers a handler for unsolicited EXISTS responses, which
+// report the number of messages in the selected mailbox.
+//
+// See OnExpunge for details about how handlers are called.
+func (c *Client) OnMessageCount(f func(n uint32)) (remove func()) {
+	return addUpdateHandler(&c.handlers, &c.handlers.messageCount, f)
+}
+
+// OnFlagsUpdate registers a handler for unsolicited FETCH responses containing
+// message flags. uid is zero if the server didn't include it.
+//
+// See OnExpunge for details about how handlers are called.
+func (c *Client) OnFlagsUpdate(f func(seqNum uint32, uid imap.UID, flags []imap.Flag)) (remove func()) {
+	return addUpdateHandler(&c.handlers, &c.handlers.flags, f)
+}
+
+// OnMailboxStatus registers a handler for unsolicited STATUS responses, e.g.
+// sent because of a NOTIFY command.
+//
+// See OnExpunge for details about how handlers are called.
+func (c *Client) OnMailboxStatus(f func(data *imap.StatusData)) (remove func()) {
+	return addUpdateHandler(&c.handlers, &c.handlers.status, f)
+}
+
+// OnListUpdate registers a handler for unsolicited LIST responses, e.g. sent
+// because of a NOTIFY command.
+//
+// See OnExpunge for details about how handlers are called.
+func (c *Client) OnListUpdate(f func(data *imap.ListData)) (remove func()) {
+	return addUpdateHandler(&c.handlers, &c.handlers.list, f)
+}
+
+// OnBye registers a handler for BYE responses sent after the greeting, which
+// indicate that the server is about to close the connection.
+//
+// See OnExpunge for details about how handlers are called.
+func (c *Client) OnBye(f func(reason string)) (remove func()) {
+	return addUpdateHandler(&c.handlers, &c.handlers.bye, f)
+}
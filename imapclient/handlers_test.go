@@ -0,0 +1,167 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestClient_OnExpunge(t *testing.T) {
+	greeting := "* OK [CAPABILITY IMAP4rev1] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, _ := readScriptTaggedCommand(t, br, w)
+		io.WriteString(w, "* 3 EXPUNGE\r\n"+
+			"* 4 EXISTS\r\n"+
+			"* 1 FETCH (UID 7 FLAGS (\\Seen))\r\n"+
+			"* 2 FETCH (FLAGS ())\r\n"+
+			"* STATUS INBOX (MESSAGES 4)\r\n"+
+			"* LIST () \"/\" Archive\r\n"+
+			"* 1 EXPUNGE\r\n"+
+			"* 2 EXPUNGE\r\n"+
+			tag+" OK NOOP completed\r\n")
+		readScriptTaggedCommand(t, br, w)
+		io.WriteString(w, "* BYE Server shutting down\r\n")
+	})
+
+	var (
+		mutex  sync.Mutex
+		events []string
+	)
+	record := func(format string, args ...interface{}) {
+		mutex.Lock()
+		events = append(events, fmt.Sprintf(format, args...))
+		mutex.Unlock()
+	}
+
+	var otherExpunges []uint32
+	byeCh := make(chan struct{})
+	client.OnExpunge(func(seqNum uint32) {
+		record("expunge %v", seqNum)
+	})
+	removeSecond := client.OnExpunge(func(seqNum uint32) {
+		t.Errorf("removed handler called")
+	})
+	removeSecond()
+	client.OnMessageCount(func(n uint32) {
+		record("exists %v", n)
+	})
+	client.OnFlagsUpdate(func(seqNum uint32, uid imap.UID, flags []imap.Flag) {
+		record("flags %v %v %v", seqNum, uid, flags)
+	})
+	client.OnMailboxStatus(func(data *imap.StatusData) {
+		record("status %v %v", data.Mailbox, *data.NumMessages)
+	})
+	client.OnListUpdate(func(data *imap.ListData) {
+		record("list %v", data.Mailbox)
+	})
+	client.OnBye(func(reason string) {
+		record("bye %v", reason)
+		close(byeCh)
+	})
+	client.OnExpunge(func(seqNum uint32) {
+		otherExpunges = append(otherExpunges, seqNum)
+	})
+
+	if err := client.Noop().Wait(); err != nil {
+		t.Fatalf("Noop().Wait() = %v", err)
+	}
+	client.Noop()
+
+	select {
+	case <-byeCh:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for BYE")
+	}
+
+	want := []string{
+		"expunge 3",
+		"exists 4",
+		"flags 1 7 [\\Seen]",
+		"flags 2 0 []",
+		"status INBOX 4",
+		"list Archive",
+		"expunge 1",
+		"expunge 2",
+		"bye Server shutting down",
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %q, want %q", events, want)
+	}
+	if want := []uint32{3, 1, 2}; !reflect.DeepEqual(otherExpunges, want) {
+		t.Errorf("second expunge handler got %v, want %v", otherExpunges, want)
+	}
+}
+
+func TestClient_OnExpunge_unilateralDataHandler(t *testing.T) {
+	expunges := make(chan uint32, 1)
+	greeting := "* OK [CAPABILITY IMAP4rev1] Server ready"
+	client := newScriptedClientWithOptions(t, greeting, &imapclient.Options{
+		UnilateralDataHandler: &imapclient.UnilateralDataHandler{
+			Expunge: func(seqNum uint32) {
+				expunges <- seqNum
+			},
+		},
+	}, func(br *bufio.Reader, w io.Writer) {
+		tag, _ := readScriptTaggedCommand(t, br, w)
+		io.WriteString(w, "* 5 EXPUNGE\r\n"+tag+" OK NOOP completed\r\n")
+	})
+
+	handlerCh := make(chan uint32, 1)
+	client.OnExpunge(func(seqNum uint32) {
+		handlerCh <- seqNum
+	})
+
+	if err := client.Noop().Wait(); err != nil {
+		t.Fatalf("Noop().Wait() = %v", err)
+	}
+	if seqNum := <-expunges; seqNum != 5 {
+		t.Errorf("UnilateralDataHandler.Expunge got %v, want 5", seqNum)
+	}
+	if seqNum := <-handlerCh; seqNum != 5 {
+		t.Errorf("OnExpunge handler got %v, want 5", seqNum)
+	}
+}
+
+func TestClient_OnExpunge_slowHandler(t *testing.T) {
+	// More updates than fit in a small fixed-size queue
+	const n = 1000
+
+	greeting := "* OK [CAPABILITY IMAP4rev1] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, _ := readScriptTaggedCommand(t, br, w)
+		var sb strings.Builder
+		for i := n; i > 0; i-- {
+			fmt.Fprintf(&sb, "* %v EXPUNGE\r\n", i)
+		}
+		io.WriteString(w, sb.String()+tag+" OK NOOP completed\r\n")
+	})
+
+	unblock := make(chan struct{})
+	seqNums := make(chan uint32, n)
+	client.OnExpunge(func(seqNum uint32) {
+		<-unblock
+		seqNums <- seqNum
+	})
+
+	// The handler is blocked, but responses are still read
+	if err := client.Noop().Wait(); err != nil {
+		t.Fatalf("Noop().Wait() = %v", err)
+	}
+	close(unblock)
+
+	for want := uint32(n); want > 0; want-- {
+		if seqNum := <-seqNums; seqNum != want {
+			t.Fatalf("got expunge %v, want %v", seqNum, want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package imapclient
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
@@ -15,6 +16,10 @@ import (
 // An example ID command:
 //
 //	ID ("name" "go-imap" "version" "1.0" "os" "Linux" "os-version" "7.9.4" "vendor" "Yahoo")
+//
+// If idData is nil, NIL is sent instead of a parameter list. The server
+// information is also available via Client.ServerID once the command has
+// completed.
 func (c *Client) ID(idData *imap.IDData) *IDCommand {
 	cmd := &IDCommand{}
 	enc := c.beginCommand("ID", cmd)
@@ -70,10 +75,11 @@ func addIDKeyValue(enc *commandEncoder, isFirstKey *bool, key, value string) {
 	if isFirstKey == nil {
 		panic("isFirstKey cannot be nil")
 	} else if !*isFirstKey {
-		enc.SP().Quoted(key).SP().Quoted(value)
-	} else {
-		enc.Quoted(key).SP().Quoted(value)
+		enc.SP()
 	}
+	// Keys and values may contain characters which can't be sent as a quoted
+	// string
+	enc.String(key).SP().String(value)
 	*isFirstKey = false
 }
 
@@ -83,6 +89,10 @@ func (c *Client) handleID() error {
 		return fmt.Errorf("in id: %v", err)
 	}
 
+	c.mutex.Lock()
+	c.serverID = data
+	c.mutex.Unlock()
+
 	if cmd := findPendingCmdByType[*IDCommand](c); cmd != nil {
 		cmd.data = *data
 	}
@@ -90,6 +100,18 @@ func (c *Client) handleID() error {
 	return nil
 }
 
+// ServerID returns the server information sent in the last ID response, or
+// nil if none has been received.
+func (c *Client) ServerID() *imap.IDData {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.serverID == nil {
+		return nil
+	}
+	data := *c.serverID
+	return &data
+}
+
 func (c *Client) readID(dec *imapwire.Decoder) (*imap.IDData, error) {
 	var data = imap.IDData{}
 
@@ -97,23 +119,24 @@ func (c *Client) readID(dec *imapwire.Decoder) (*imap.IDData, error) {
 		return nil, dec.Err()
 	}
 
-	if dec.ExpectNIL() {
-		return &data, nil
-	}
-
 	currKey := ""
-	err := dec.ExpectList(func() error {
+	err := dec.ExpectNList(func() error {
 		var keyOrValue string
-		if !dec.String(&keyOrValue) {
-			return fmt.Errorf("in id key-val list: %v", dec.Err())
-		}
-
 		if currKey == "" {
+			if !dec.ExpectString(&keyOrValue) {
+				return fmt.Errorf("in id key-val list: %v", dec.Err())
+			}
 			currKey = keyOrValue
 			return nil
 		}
 
-		switch currKey {
+		// Values may be NIL
+		if !dec.ExpectNString(&keyOrValue) {
+			return fmt.Errorf("in id key-val list: %v", dec.Err())
+		}
+
+		// Field names are case-insensitive
+		switch strings.ToLower(currKey) {
 		case "name":
 			data.Name = keyOrValue
 		case "version":
@@ -0,0 +1,98 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// readScriptCommand reads a command sent by the client, accepting
+// synchronizing literals.
+func readScriptCommand(t *testing.T, br *bufio.Reader, w io.Writer) string {
+	var sb strings.Builder
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Errorf("ReadString() = %v", err)
+			return ""
+		}
+		line = strings.TrimSuffix(line, "\r\n")
+		sb.WriteString(line)
+
+		i := strings.LastIndexByte(line, '{')
+		if !strings.HasSuffix(line, "}") || i < 0 {
+			return sb.String()
+		}
+		n, err := strconv.Atoi(line[i+1 : len(line)-1])
+		if err != nil {
+			t.Errorf("invalid literal size in %q", line)
+			return ""
+		}
+		io.WriteString(w, "+ Ready\r\n")
+		lit := make([]byte, n)
+		if _, err := io.ReadFull(br, lit); err != nil {
+			t.Errorf("ReadFull() = %v", err)
+			return ""
+		}
+		sb.WriteString("\r\n")
+		sb.Write(lit)
+	}
+}
+
+// readScriptTaggedCommand reads a command sent by the client, and splits the
+// tag from the rest of the command.
+func readScriptTaggedCommand(t *testing.T, br *bufio.Reader, w io.Writer) (tag, args string) {
+	tag, args, _ = strings.Cut(readScriptCommand(t, br, w), " ")
+	return tag, args
+}
+
+func TestClient_ID(t *testing.T) {
+	commands := make(chan string, 3)
+	greeting := "* OK [CAPABILITY IMAP4rev1 ID] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		for i := 0; i < 3; i++ {
+			tag, args := readScriptTaggedCommand(t, br, w)
+			commands <- args
+			io.WriteString(w, `* ID ("NAME" "Dovecot" "version" NIL)`+"\r\n"+tag+" OK ID completed\r\n")
+		}
+	})
+
+	if client.ServerID() != nil {
+		t.Errorf("ServerID() = %v before ID command, want nil", client.ServerID())
+	}
+
+	for _, tc := range []struct {
+		name   string
+		idData *imap.IDData
+		want   string
+	}{
+		{"nil", nil, "ID NIL"},
+		{"empty", &imap.IDData{}, "ID ()"},
+		{
+			"literal",
+			&imap.IDData{Name: "go-imap", Vendor: "Ünicode \"vendor\""},
+			"ID (\"name\" \"go-imap\" \"vendor\" {17}\r\nÜnicode \"vendor\")",
+		},
+	} {
+		data, err := client.ID(tc.idData).Wait()
+		if err != nil {
+			t.Fatalf("%v: ID().Wait() = %v", tc.name, err)
+		}
+		if cmd := <-commands; cmd != tc.want {
+			t.Errorf("%v: sent %q, want %q", tc.name, cmd, tc.want)
+		}
+		want := &imap.IDData{Name: "Dovecot"}
+		if !reflect.DeepEqual(data, want) {
+			t.Errorf("%v: ID().Wait() = %+v, want %+v", tc.name, data, want)
+		}
+	}
+
+	if data := client.ServerID(); data == nil || data.Name != "Dovecot" {
+		t.Errorf("ServerID() = %+v, want Dovecot", data)
+	}
+}
@@ -0,0 +1,357 @@
+package imapclient
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+const defaultIdlerPollInterval = time.Minute
+
+// IdleEvent is an event delivered by an Idler.
+//
+// It is one of *IdleNewMessages, *IdleExpunge, *IdleFlagUpdate or
+// *IdleMailboxStatus.
+type IdleEvent interface {
+	idleEvent()
+}
+
+// IdleNewMessages is delivered when new messages are added to the selected
+// mailbox.
+type IdleNewMessages struct {
+	// Number of new messages
+	Count uint32
+	// Total number of messages in the mailbox
+	NumMessages uint32
+}
+
+// IdleExpunge is delivered when a message is removed from the selected
+// mailbox.
+type IdleExpunge struct {
+	SeqNum uint32
+}
+
+// IdleFlagUpdate is delivered when the flags of a message change.
+type IdleFlagUpdate struct {
+	SeqNum uint32
+	UID    imap.UID // may be zero if the server didn't send it
+	Flags  []imap.Flag
+}
+
+// IdleMailboxStatus is delivered when the flags defined in the selected
+// mailbox change. Only non-nil fields have been updated.
+type IdleMailboxStatus struct {
+	Flags          []imap.Flag
+	PermanentFlags []imap.Flag
+}
+
+func (*IdleNewMessages) idleEvent()   {}
+func (*IdleExpunge) idleEvent()       {}
+func (*IdleFlagUpdate) idleEvent()    {}
+func (*IdleMailboxStatus) idleEvent() {}
+
+// IdlerOptions contains options for Client.StartIdler.
+type IdlerOptions struct {
+	// EventHandler is called when an event is received. It is called with
+	// events in the order in which they are received, except for
+	// IdleFlagUpdate which may be delivered slightly later. Like
+	// UnilateralDataHandler, it blocks the client while running.
+	EventHandler func(IdleEvent)
+	// RestartInterval is the interval after which IDLE is stopped and
+	// re-issued, to avoid getting disconnected by the server. If zero, 28
+	// minutes is used.
+	RestartInterval time.Duration
+	// PollInterval is the interval at which NOOP commands are sent if the
+	// server doesn't support IDLE. If zero, one minute is used.
+	PollInterval time.Duration
+}
+
+// Idler keeps the connection in IDLE whenever no other command is running.
+//
+// Commands can be sent while the Idler is running: IDLE is stopped before the
+// command is sent, and re-issued once all commands have completed. The Idle
+// method must not be used while an Idler is running.
+//
+// If the server doesn't support IDLE, the Idler periodically sends NOOP
+// commands instead.
+//
+// While an Idler is running, unilateral FETCH responses are delivered as
+// IdleFlagUpdate events instead of being passed to
+// UnilateralDataHandler.Fetch, if an EventHandler is set.
+type Idler struct {
+	client  *Client
+	options IdlerOptions
+
+	stop chan struct{}
+	done chan struct{}
+	wake chan struct{}
+	err  error
+
+	mutex  sync.Mutex
+	paused int
+	child  *idleCommand // running IDLE command, if any
+
+	eventMutex sync.Mutex
+}
+
+// StartIdler starts keeping the connection in IDLE.
+//
+// A nil options pointer is equivalent to a zero options value. The caller
+// must invoke Idler.Close to stop the Idler.
+func (c *Client) StartIdler(options *IdlerOptions) (*Idler, error) {
+	if options == nil {
+		options = &IdlerOptions{}
+	}
+
+	caps := c.Caps()
+	if caps == nil {
+		return nil, fmt.Errorf("imapclient: failed to fetch capabilities")
+	}
+
+	idler := &Idler{
+		client:  c,
+		options: *options,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		wake:    make(chan struct{}, 1),
+	}
+
+	c.mutex.Lock()
+	if c.idler != nil {
+		c.mutex.Unlock()
+		return nil, fmt.Errorf("imapclient: an Idler is already running")
+	}
+	c.idler = idler
+	c.mutex.Unlock()
+
+	if caps.Has(imap.CapIdle) {
+		go idler.run()
+	} else {
+		go idler.poll()
+	}
+	return idler, nil
+}
+
+// Close stops the Idler.
+//
+// If IDLE is running, this method blocks until the server has acknowledged
+// the end of the command.
+func (idler *Idler) Close() error {
+	select {
+	case <-idler.stop:
+		return fmt.Errorf("imapclient: Idler already closed")
+	default:
+		close(idler.stop)
+	}
+	<-idler.done
+
+	c := idler.client
+	c.mutex.Lock()
+	if c.idler == idler {
+		c.idler = nil
+	}
+	c.mutex.Unlock()
+
+	return idler.err
+}
+
+func (idler *Idler) run() {
+	defer close(idler.done)
+
+	c := idler.client
+
+	restartInterval := idler.options.RestartInterval
+	if restartInterval <= 0 {
+		restartInterval = idleRestartInterval
+	}
+
+	for {
+		if !idler.waitUnpaused() {
+			return
+		}
+
+		// Discard stale wake-ups
+		select {
+		case <-idler.wake:
+		default:
+		}
+
+		child, err := c.idle()
+		if err != nil {
+			idler.err = err
+			return
+		}
+
+		// A command may have been started while IDLE was being sent
+		idler.mutex.Lock()
+		paused := idler.paused > 0
+		if paused {
+			err = child.Close()
+		} else {
+			idler.child = child
+		}
+		idler.mutex.Unlock()
+
+		stopped := false
+		if !paused {
+			timer := time.NewTimer(restartInterval)
+			select {
+			case <-timer.C:
+			case <-idler.wake:
+			case <-idler.stop:
+				stopped = true
+			case <-c.decCh:
+				stopped = true
+			}
+			timer.Stop()
+
+			err = idler.closeChild()
+		}
+		if err == nil {
+			err = child.Wait()
+		}
+		if err != nil {
+			idler.err = err
+			return
+		}
+		if stopped {
+			return
+		}
+	}
+}
+
+// waitUnpaused blocks until no other command is running. It returns false if
+// the Idler has been stopped.
+func (idler *Idler) waitUnpaused() bool {
+	for {
+		select {
+		case <-idler.stop:
+			return false
+		case <-idler.client.decCh:
+			return false
+		default:
+		}
+
+		idler.mutex.Lock()
+		paused := idler.paused > 0
+		idler.mutex.Unlock()
+		if !paused {
+			return true
+		}
+
+		select {
+		case <-idler.wake:
+		case <-idler.stop:
+			return false
+		case <-idler.client.decCh:
+			return false
+		}
+	}
+}
+
+func (idler *Idler) closeChild() error {
+	idler.mutex.Lock()
+	defer idler.mutex.Unlock()
+
+	if idler.child == nil {
+		return nil
+	}
+	err := idler.child.Close()
+	idler.child = nil
+	return err
+}
+
+func (idler *Idler) poll() {
+	defer close(idler.done)
+
+	c := idler.client
+
+	pollInterval := idler.options.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = defaultIdlerPollInterval
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.Noop().Wait(); err != nil {
+				idler.err = err
+				return
+			}
+		case <-idler.stop:
+			return
+		case <-c.decCh:
+			return
+		}
+	}
+}
+
+// pause stops IDLE before another command is sent.
+func (idler *Idler) pause() {
+	idler.mutex.Lock()
+	idler.paused++
+	idler.mutex.Unlock()
+
+	// Closing the IDLE command releases the encoder, so that the other
+	// command can be sent right away. Write errors will be reported by the
+	// other command.
+	idler.closeChild()
+	idler.notify()
+}
+
+// resume is called when a command sent while the Idler was paused completes.
+func (idler *Idler) resume() {
+	idler.mutex.Lock()
+	idler.paused--
+	idler.mutex.Unlock()
+
+	idler.notify()
+}
+
+func (idler *Idler) notify() {
+	select {
+	case idler.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (idler *Idler) handleEvent(ev IdleEvent) {
+	if idler.options.EventHandler == nil {
+		return
+	}
+
+	idler.eventMutex.Lock()
+	defer idler.eventMutex.Unlock()
+
+	idler.options.EventHandler(ev)
+}
+
+func (idler *Idler) handleFetch(msg *FetchMessageData) {
+	buf, err := msg.Collect()
+	if err != nil || buf.Flags == nil {
+		return
+	}
+	idler.handleEvent(&IdleFlagUpdate{
+		SeqNum: buf.SeqNum,
+		UID:    buf.UID,
+		Flags:  buf.Flags,
+	})
+}
+
+// activeIdler returns the running Idler, if any.
+func (c *Client) activeIdler() *Idler {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.idler
+}
+
+func (c *Client) handleIdleEvent(ev IdleEvent) {
+	if idler := c.activeIdler(); idler != nil {
+		idler.handleEvent(ev)
+	}
+}
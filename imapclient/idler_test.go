@@ -0,0 +1,202 @@
+package imapclient_test
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use.
+type lockedBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+// newIdlerTestServer starts a server and returns a function to create new
+// clients in the selected state.
+func newIdlerTestServer(t *testing.T) (dial func(*imapclient.Options) *imapclient.Client, closeServer func()) {
+	memServer := imapmemserver.New()
+	user := imapmemserver.NewUser(testUsername, testPassword)
+	user.Create("INBOX", nil)
+	memServer.AddUser(user)
+
+	server := imapserver.New(&imapserver.Options{
+		NewSession: func(conn *imapserver.Conn) (imapserver.Session, *imapserver.GreetingData, error) {
+			return memServer.NewSession(), nil, nil
+		},
+		InsecureAuth: true,
+		Caps: imap.CapSet{
+			imap.CapIMAP4rev1: {},
+			imap.CapIMAP4rev2: {},
+		},
+	})
+
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("net.Listen() = %v", err)
+	}
+	go server.Serve(ln)
+
+	dial = func(options *imapclient.Options) *imapclient.Client {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("net.Dial() = %v", err)
+		}
+		client := imapclient.New(conn, options)
+		if err := client.Login(testUsername, testPassword).Wait(); err != nil {
+			t.Fatalf("Login().Wait() = %v", err)
+		}
+		if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+			t.Fatalf("Select().Wait() = %v", err)
+		}
+		return client
+	}
+	return dial, func() { server.Close() }
+}
+
+func nextIdleEvent(t *testing.T, events <-chan imapclient.IdleEvent) imapclient.IdleEvent {
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for idle event")
+		return nil
+	}
+}
+
+func TestIdler(t *testing.T) {
+	dial, closeServer := newIdlerTestServer(t)
+	defer closeServer()
+
+	events := make(chan imapclient.IdleEvent, 16)
+	client := dial(nil)
+	defer client.Close()
+	idler, err := client.StartIdler(&imapclient.IdlerOptions{
+		EventHandler: func(ev imapclient.IdleEvent) {
+			events <- ev
+		},
+	})
+	if err != nil {
+		t.Fatalf("StartIdler() = %v", err)
+	}
+
+	other := dial(nil)
+	defer other.Close()
+
+	appendCmd := other.Append("INBOX", int64(len(simpleRawMessage)), nil)
+	if _, err := appendCmd.Write([]byte(simpleRawMessage)); err != nil {
+		t.Fatalf("AppendCommand.Write() = %v", err)
+	}
+	if err := appendCmd.Close(); err != nil {
+		t.Fatalf("AppendCommand.Close() = %v", err)
+	}
+	if _, err := appendCmd.Wait(); err != nil {
+		t.Fatalf("Append().Wait() = %v", err)
+	}
+
+	ev, ok := nextIdleEvent(t, events).(*imapclient.IdleNewMessages)
+	if !ok || ev.Count != 1 || ev.NumMessages != 1 {
+		t.Errorf("got event %#v, want IdleNewMessages with Count = 1 and NumMessages = 1", ev)
+	}
+
+	// Commands sent on the idling client pause IDLE
+	if err := client.Noop().Wait(); err != nil {
+		t.Fatalf("Noop().Wait() = %v", err)
+	}
+
+	if _, err := other.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select().Wait() = %v", err)
+	}
+	storeFlags := imap.StoreFlags{
+		Op:     imap.StoreFlagsAdd,
+		Silent: true,
+		Flags:  []imap.Flag{imap.FlagFlagged},
+	}
+	if err := other.Store(imap.SeqSetNum(1), &storeFlags, nil).Close(); err != nil {
+		t.Fatalf("Store().Close() = %v", err)
+	}
+
+	flagEv, ok := nextIdleEvent(t, events).(*imapclient.IdleFlagUpdate)
+	if !ok || flagEv.SeqNum != 1 || !containsFlag(flagEv.Flags, imap.FlagFlagged) {
+		t.Errorf("got event %#v, want IdleFlagUpdate for message 1 with \\Flagged", flagEv)
+	}
+
+	storeFlags.Flags = []imap.Flag{imap.FlagDeleted}
+	if err := other.Store(imap.SeqSetNum(1), &storeFlags, nil).Close(); err != nil {
+		t.Fatalf("Store().Close() = %v", err)
+	}
+	if err := other.Expunge().Close(); err != nil {
+		t.Fatalf("Expunge().Close() = %v", err)
+	}
+
+	for {
+		ev := nextIdleEvent(t, events)
+		if _, ok := ev.(*imapclient.IdleFlagUpdate); ok {
+			continue // \Deleted flag update
+		}
+		if expungeEv, ok := ev.(*imapclient.IdleExpunge); !ok || expungeEv.SeqNum != 1 {
+			t.Errorf("got event %#v, want IdleExpunge for message 1", ev)
+		}
+		break
+	}
+
+	if err := idler.Close(); err != nil {
+		t.Errorf("Idler.Close() = %v", err)
+	}
+	if err := client.Noop().Wait(); err != nil {
+		t.Errorf("Noop().Wait() after Idler.Close() = %v", err)
+	}
+}
+
+func TestIdler_restart(t *testing.T) {
+	dial, closeServer := newIdlerTestServer(t)
+	defer closeServer()
+
+	var debug lockedBuffer
+	client := dial(&imapclient.Options{DebugWriter: &debug})
+	defer client.Close()
+
+	idler, err := client.StartIdler(&imapclient.IdlerOptions{
+		RestartInterval: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("StartIdler() = %v", err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if err := idler.Close(); err != nil {
+		t.Fatalf("Idler.Close() = %v", err)
+	}
+
+	if n := strings.Count(debug.String(), " IDLE\r\n"); n < 3 {
+		t.Errorf("IDLE sent %v times, want at least 3", n)
+	}
+}
+
+func containsFlag(flags []imap.Flag, flag imap.Flag) bool {
+	for _, f := range flags {
+		if strings.EqualFold(string(f), string(flag)) {
+			return true
+		}
+	}
+	return false
+}
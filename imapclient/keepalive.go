@@ -0,0 +1,78 @@
+package imapclient
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// ErrConnStale is wrapped by the error returned by commands when the server
+// has stopped responding, see Options.ReadTimeout and Options.KeepAlive.
+var ErrConnStale = errors.New("imapclient: connection is stale")
+
+// keepAlive sends a NOOP command after each interval of inactivity, until the
+// connection is closed.
+func (c *Client) keepAlive(interval time.Duration) {
+	if err := c.WaitGreeting(); err != nil {
+		return
+	}
+
+	timeout := c.options.ReadTimeout
+	if timeout <= 0 {
+		timeout = interval
+	}
+
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-c.decCh:
+			return
+		}
+
+		c.mutex.Lock()
+		inactive := time.Since(c.lastActive)
+		busy := len(c.pendingCmds) > 0 || c.state == imap.ConnStateLogout
+		c.mutex.Unlock()
+
+		// Pending commands include IDLE, and commands whose literal is being
+		// sent: the NOOP would be delayed until they complete
+		if busy {
+			timer.Reset(interval)
+			continue
+		} else if inactive < interval {
+			timer.Reset(interval - inactive)
+			continue
+		}
+
+		if err := c.ping(timeout); err != nil {
+			return
+		}
+		timer.Reset(interval)
+	}
+}
+
+// ping sends a NOOP command, and closes the connection if the server doesn't
+// reply in time.
+func (c *Client) ping(timeout time.Duration) error {
+	cmd := c.Noop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- cmd.Wait()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-errCh:
+		return err
+	case <-timer.C:
+		err := fmt.Errorf("imapclient: NOOP unanswered after %v: %w", timeout, ErrConnStale)
+		c.abort(err)
+		return err
+	}
+}
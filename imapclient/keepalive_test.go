@@ -0,0 +1,65 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestClient_ReadTimeout(t *testing.T) {
+	greeting := "* OK [CAPABILITY IMAP4rev1] Server ready"
+	client := newScriptedClientWithOptions(t, greeting, &imapclient.Options{
+		ReadTimeout: 100 * time.Millisecond,
+	}, func(br *bufio.Reader, w io.Writer) {
+		tag, _ := readScriptTaggedCommand(t, br, w)
+		io.WriteString(w, tag+" OK NOOP completed\r\n")
+		// Stop responding
+	})
+
+	if err := client.Noop().Wait(); err != nil {
+		t.Fatalf("Noop().Wait() = %v", err)
+	}
+
+	// No command is pending: the timeout doesn't apply
+	time.Sleep(200 * time.Millisecond)
+
+	start := time.Now()
+	cmds := []*imapclient.Command{client.Noop(), client.Noop()}
+	waitCommandErrors(t, cmds, imapclient.ErrConnStale)
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("commands failed after %v, want about 100ms", d)
+	}
+}
+
+func TestClient_KeepAlive(t *testing.T) {
+	pings := make(chan string, 2)
+	greeting := "* OK [CAPABILITY IMAP4rev1] Server ready"
+	client := newScriptedClientWithOptions(t, greeting, &imapclient.Options{
+		KeepAlive: 200 * time.Millisecond,
+	}, func(br *bufio.Reader, w io.Writer) {
+		tag, args := readScriptTaggedCommand(t, br, w)
+		pings <- args
+		io.WriteString(w, tag+" OK NOOP completed\r\n")
+
+		// Stop responding to the next ping
+		_, args = readScriptTaggedCommand(t, br, w)
+		pings <- args
+	})
+
+	for i := 0; i < 2; i++ {
+		select {
+		case args := <-pings:
+			if args != "NOOP" {
+				t.Fatalf("got command %q, want NOOP", args)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for ping #%v", i)
+		}
+	}
+
+	// The unanswered ping fails pending commands
+	waitCommandErrors(t, []*imapclient.Command{client.Noop()}, imapclient.ErrConnStale)
+}
@@ -1,6 +1,7 @@
 package imapclient
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"unicode/utf8"
@@ -62,17 +63,30 @@ func getReturnOpts(options *imap.ListOptions) []string {
 // A non-zero options value requires support for IMAP4rev2 or the LIST-EXTENDED
 // extension.
 func (c *Client) List(ref, pattern string, options *imap.ListOptions) *ListCommand {
+	return c.list("LIST", ref, []string{pattern}, options)
+}
+
+// list sends a LIST or XLIST command. More than one pattern requires support
+// for IMAP4rev2 or the LIST-EXTENDED extension.
+func (c *Client) list(name, ref string, patterns []string, options *imap.ListOptions) *ListCommand {
 	cmd := &ListCommand{
 		mailboxes:    make(chan *imap.ListData, 64),
 		returnStatus: options != nil && options.ReturnStatus != nil,
 	}
-	enc := c.beginCommand("LIST", cmd)
+	enc := c.beginCommand(name, cmd)
 	if selectOpts := getSelectOpts(options); len(selectOpts) > 0 {
 		enc.SP().List(len(selectOpts), func(i int) {
 			enc.Atom(selectOpts[i])
 		})
 	}
-	enc.SP().Mailbox(ref).SP().Mailbox(pattern)
+	enc.SP().Mailbox(ref).SP()
+	if len(patterns) == 1 {
+		enc.Mailbox(patterns[0])
+	} else {
+		enc.List(len(patterns), func(i int) {
+			enc.Mailbox(patterns[i])
+		})
+	}
 	if returnOpts := getReturnOpts(options); len(returnOpts) > 0 {
 		enc.SP().Atom("RETURN").SP().List(len(returnOpts), func(i int) {
 			opt := returnOpts[i]
@@ -117,6 +131,13 @@ func (c *Client) handleList() error {
 		}
 	case *SelectCommand:
 		cmd.data.List = data
+	default:
+		if h := c.notifyHandler(data.Mailbox); h != nil && h.List != nil {
+			h.List(data)
+		}
+		queueUpdate(c, &c.handlers.list, func(f func(*imap.ListData)) {
+			f(data)
+		})
 	}
 
 	return nil
@@ -165,6 +186,13 @@ func (cmd *ListCommand) Collect() ([]*imap.ListData, error) {
 	return l, cmd.Close()
 }
 
+// CollectContext is like Collect, but closes the connection if ctx is done
+// before the command has completed. See Client.WatchContext.
+func (cmd *ListCommand) CollectContext(ctx context.Context) ([]*imap.ListData, error) {
+	defer cmd.watchContext(ctx)()
+	return cmd.Collect()
+}
+
 func readList(dec *imapwire.Decoder) (*imap.ListData, error) {
 	var data imap.ListData
 
@@ -1,10 +1,15 @@
 package imapclient_test
 
 import (
+	"bufio"
+	"io"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
 )
 
 func TestList(t *testing.T) {
@@ -40,3 +45,108 @@ func TestList(t *testing.T) {
 		t.Errorf("got %#v but want %#v", mbox, want)
 	}
 }
+
+func TestClient_SpecialUseMailboxes(t *testing.T) {
+	user := imapmemserver.NewUser(testUsername, testPassword)
+	user.Create("INBOX", nil)
+	user.Create("Sent", nil)
+	user.Create("Outbox/Sent", &imap.CreateOptions{SpecialUse: []imap.MailboxAttr{imap.MailboxAttrSent}})
+	user.Create("Corbeille", &imap.CreateOptions{SpecialUse: []imap.MailboxAttr{imap.MailboxAttrTrash}})
+	user.Create("Drafts", nil)
+	dial := newCapsTestServer(t, user, imap.CapSet{
+		imap.CapListExtended: {},
+		imap.CapSpecialUse:   {},
+	})
+
+	var debug lockedBuffer
+	client := dial(&imapclient.Options{DebugWriter: &debug})
+	mailboxes, err := client.SpecialUseMailboxes()
+	if err != nil {
+		t.Fatalf("SpecialUseMailboxes() = %v", err)
+	}
+
+	want := map[imap.MailboxAttr]imapclient.SpecialUseMailbox{
+		imap.MailboxAttrSent:   {Name: "Outbox/Sent"},
+		imap.MailboxAttrTrash:  {Name: "Corbeille"},
+		imap.MailboxAttrDrafts: {Name: "Drafts", Guessed: true},
+	}
+	if !reflect.DeepEqual(mailboxes, want) {
+		t.Errorf("SpecialUseMailboxes() = %v, want %v", mailboxes, want)
+	}
+	if !strings.Contains(debug.String(), " RETURN (SPECIAL-USE)") {
+		t.Errorf("LIST command without RETURN (SPECIAL-USE):\n%v", debug.String())
+	}
+}
+
+func TestClient_SpecialUseMailboxes_heuristics(t *testing.T) {
+	user := imapmemserver.NewUser(testUsername, testPassword)
+	user.Create("INBOX", nil)
+	user.Create("Sent Items", nil)
+	user.Create("[Gmail]/Spam", nil)
+	user.Create("Deleted Items", nil)
+	user.Create("Brouillons", nil)
+	dial := newCapsTestServer(t, user, nil)
+
+	client := dial(nil)
+	mailboxes, err := client.SpecialUseMailboxes()
+	if err != nil {
+		t.Fatalf("SpecialUseMailboxes() = %v", err)
+	}
+	want := map[imap.MailboxAttr]imapclient.SpecialUseMailbox{
+		imap.MailboxAttrSent:   {Name: "Sent Items", Guessed: true},
+		imap.MailboxAttrJunk:   {Name: "[Gmail]/Spam", Guessed: true},
+		imap.MailboxAttrTrash:  {Name: "Deleted Items", Guessed: true},
+		imap.MailboxAttrDrafts: {Name: "Brouillons", Guessed: true},
+	}
+	if !reflect.DeepEqual(mailboxes, want) {
+		t.Errorf("SpecialUseMailboxes() = %v, want %v", mailboxes, want)
+	}
+
+	// Custom table
+	client = dial(&imapclient.Options{
+		SpecialUseNames: map[imap.MailboxAttr][]string{
+			imap.MailboxAttrArchive: {"brouillons"},
+		},
+	})
+	mailboxes, err = client.SpecialUseMailboxes()
+	if err != nil {
+		t.Fatalf("SpecialUseMailboxes() = %v", err)
+	}
+	want = map[imap.MailboxAttr]imapclient.SpecialUseMailbox{
+		imap.MailboxAttrArchive: {Name: "Brouillons", Guessed: true},
+	}
+	if !reflect.DeepEqual(mailboxes, want) {
+		t.Errorf("SpecialUseMailboxes() = %v, want %v", mailboxes, want)
+	}
+}
+
+func TestClient_SpecialUseMailboxes_xlist(t *testing.T) {
+	commands := make(chan string, 1)
+	greeting := "* OK [CAPABILITY IMAP4rev1 XLIST] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, args := readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, `* XLIST (\HasNoChildren \Inbox) "/" "INBOX"`+"\r\n")
+		io.WriteString(w, `* XLIST (\Noselect \HasChildren) "/" "[Gmail]"`+"\r\n")
+		io.WriteString(w, `* XLIST (\HasNoChildren \AllMail) "/" "[Gmail]/All Mail"`+"\r\n")
+		io.WriteString(w, `* XLIST (\HasNoChildren \Sent) "/" "[Gmail]/Sent Mail"`+"\r\n")
+		io.WriteString(w, `* XLIST (\HasNoChildren \Spam) "/" "[Gmail]/Spam"`+"\r\n")
+		io.WriteString(w, tag+" OK XLIST completed\r\n")
+	})
+
+	mailboxes, err := client.SpecialUseMailboxes()
+	if err != nil {
+		t.Fatalf("SpecialUseMailboxes() = %v", err)
+	}
+	if cmd := <-commands; cmd != `XLIST "" "*"` {
+		t.Errorf("command = %q, want XLIST", cmd)
+	}
+	want := map[imap.MailboxAttr]imapclient.SpecialUseMailbox{
+		imap.MailboxAttrAll:  {Name: "[Gmail]/All Mail"},
+		imap.MailboxAttrSent: {Name: "[Gmail]/Sent Mail"},
+		imap.MailboxAttrJunk: {Name: "[Gmail]/Spam"},
+	}
+	if !reflect.DeepEqual(mailboxes, want) {
+		t.Errorf("SpecialUseMailboxes() = %v, want %v", mailboxes, want)
+	}
+}
@@ -0,0 +1,157 @@
+package imapclient_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestLiteral(t *testing.T) {
+	const data = "Subject: Hi\r\n\r\nHello\r\n"
+
+	readAll := func(lit imap.LiteralReader) string {
+		t.Helper()
+		b, err := io.ReadAll(lit)
+		if err != nil {
+			t.Fatalf("ReadAll() = %v", err)
+		}
+		if int64(len(b)) != lit.Size() {
+			t.Errorf("read %v bytes, want Size() = %v", len(b), lit.Size())
+		}
+		return string(b)
+	}
+
+	lit := imap.NewLiteral([]byte(data))
+	if s := readAll(lit); s != data {
+		t.Errorf("NewLiteral() read %q, want %q", s, data)
+	}
+	if rewound, ok := imap.RewindLiteral(lit); !ok {
+		t.Errorf("RewindLiteral(NewLiteral()) = false")
+	} else if s := readAll(rewound); s != data {
+		t.Errorf("RewindLiteral(NewLiteral()) read %q, want %q", s, data)
+	}
+
+	// Data after the declared size is left unread
+	r := strings.NewReader(data + "extra")
+	lit = imap.NewReaderLiteral(r, int64(len(data)))
+	if s := readAll(lit); s != data {
+		t.Errorf("NewReaderLiteral() read %q, want %q", s, data)
+	}
+	if r.Len() != len("extra") {
+		t.Errorf("NewReaderLiteral() consumed %v extra bytes", len("extra")-r.Len())
+	}
+	if _, ok := imap.RewindLiteral(lit); ok {
+		t.Errorf("RewindLiteral(NewReaderLiteral()) = true")
+	}
+
+	lit = imap.NewReaderLiteral(strings.NewReader(data), int64(len(data))+1)
+	if _, err := io.ReadAll(lit); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("NewReaderLiteral() with short reader: ReadAll() = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "msg.eml"))
+	if err != nil {
+		t.Fatalf("os.Create() = %v", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString("skipped" + data); err != nil {
+		t.Fatalf("WriteString() = %v", err)
+	}
+	if _, err := f.Seek(int64(len("skipped")), io.SeekStart); err != nil {
+		t.Fatalf("Seek() = %v", err)
+	}
+	lit, err = imap.NewFileLiteral(f)
+	if err != nil {
+		t.Fatalf("NewFileLiteral() = %v", err)
+	}
+	if s := readAll(lit); s != data {
+		t.Errorf("NewFileLiteral() read %q, want %q", s, data)
+	}
+	if rewound, ok := imap.RewindLiteral(lit); !ok {
+		t.Errorf("RewindLiteral(NewFileLiteral()) = false")
+	} else if s := readAll(rewound); s != data {
+		t.Errorf("RewindLiteral(NewFileLiteral()) read %q, want %q", s, data)
+	}
+}
+
+func TestClient_AppendLiteral_pipe(t *testing.T) {
+	client, server := newClientServerPair(t, imap.ConnStateSelected)
+	defer client.Close()
+	defer server.Close()
+
+	var buf bytes.Buffer
+	buf.WriteString("Subject: Streamed\r\n\r\n")
+	for buf.Len() < 256*1024 {
+		buf.WriteString("The quick brown fox jumps over the lazy dog.\r\n")
+	}
+	msg := buf.Bytes()
+
+	// The message is only available through a pipe, in small chunks
+	pr, pw := io.Pipe()
+	go func() {
+		b := msg
+		for len(b) > 0 {
+			n := 1000
+			if n > len(b) {
+				n = len(b)
+			}
+			if _, err := pw.Write(b[:n]); err != nil {
+				return
+			}
+			b = b[n:]
+		}
+		pw.Close()
+	}()
+
+	lit := imap.NewReaderLiteral(pr, int64(len(msg)))
+	appendData, err := client.AppendLiteral(context.Background(), "INBOX", lit, nil).Wait()
+	if err != nil {
+		t.Fatalf("AppendLiteral().Wait() = %v", err)
+	}
+
+	fetchOptions := &imap.FetchOptions{
+		BodySection: []*imap.FetchItemBodySection{{Peek: true}},
+	}
+	fetchCmd := client.Fetch(imap.UIDSetNum(appendData.UID), fetchOptions)
+	defer fetchCmd.Close()
+
+	msgData := fetchCmd.Next()
+	if msgData == nil {
+		t.Fatalf("FETCH returned no message")
+	}
+	var found bool
+	for {
+		item := msgData.Next()
+		if item == nil {
+			break
+		}
+		bodySection, ok := item.(imapclient.FetchItemDataBodySection)
+		if !ok {
+			continue
+		}
+		found = true
+		if bodySection.Literal.Size() != int64(len(msg)) {
+			t.Errorf("Literal.Size() = %v, want %v", bodySection.Literal.Size(), len(msg))
+		}
+		b, err := io.ReadAll(bodySection.Literal)
+		if err != nil {
+			t.Fatalf("ReadAll() = %v", err)
+		} else if !bytes.Equal(b, msg) {
+			t.Errorf("fetched body doesn't match the appended message")
+		}
+	}
+	if !found {
+		t.Errorf("FETCH didn't return a body section")
+	}
+	if err := fetchCmd.Close(); err != nil {
+		t.Errorf("FetchCommand.Close() = %v", err)
+	}
+}
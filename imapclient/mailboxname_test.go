@@ -0,0 +1,271 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+func TestClient_mailboxNameEncoding(t *testing.T) {
+	const (
+		parent  = "Входящие"
+		name    = "Входящие/Архив"
+		renamed = "Входящие/Архив & Co"
+	)
+
+	for _, mode := range []struct {
+		name     string
+		utf8     bool
+		wantWire string
+	}{
+		{"utf7", false, `CREATE "&BBIERQQ+BDQETwRJBDgENQ-/&BBAEQARFBDgEMg-"`},
+		{"utf8", true, `CREATE "` + name + `"`},
+	} {
+		t.Run(mode.name, func(t *testing.T) {
+			user := imapmemserver.NewUser(testUsername, testPassword)
+			user.Create("INBOX", nil)
+			dial := newCapsTestServer(t, user, nil)
+
+			connect := func(utf8 bool, options *imapclient.Options) *imapclient.Client {
+				client := dial(options)
+				if utf8 {
+					data, err := client.Enable(imap.CapUTF8Accept).Wait()
+					if err != nil {
+						t.Fatalf("Enable().Wait() = %v", err)
+					} else if !data.Caps.Has(imap.CapUTF8Accept) {
+						t.Fatalf("UTF8=ACCEPT not enabled")
+					}
+				}
+				return client
+			}
+
+			var debugLog lockedBuffer
+			client := connect(mode.utf8, &imapclient.Options{DebugLog: &debugLog})
+
+			if err := client.Create(name, nil).Wait(); err != nil {
+				t.Fatalf("Create().Wait() = %v", err)
+			}
+			if !strings.Contains(debugLog.String(), mode.wantWire) {
+				t.Errorf("%v wasn't sent", mode.wantWire)
+			}
+
+			uid := appendRawMessage(t, client, "Subject: Test\r\n\r\nHello\r\n")
+			if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+				t.Fatalf("Select().Wait() = %v", err)
+			}
+			if _, err := client.Copy(imap.UIDSetNum(uid), name).Wait(); err != nil {
+				t.Fatalf("Copy().Wait() = %v", err)
+			}
+			if err := client.Subscribe(name).Wait(); err != nil {
+				t.Fatalf("Subscribe().Wait() = %v", err)
+			}
+
+			// A name containing the modified UTF-7 shift character
+			if err := client.Rename(name, renamed).Wait(); err != nil {
+				t.Fatalf("Rename().Wait() = %v", err)
+			}
+			listData, err := client.List("", parent+"/*", nil).Collect()
+			if err != nil {
+				t.Fatalf("List().Collect() = %v", err)
+			} else if len(listData) != 1 || listData[0].Mailbox != renamed {
+				t.Errorf("List() = %v, want %q", listData, renamed)
+			}
+			if err := client.Rename(renamed, name).Wait(); err != nil {
+				t.Fatalf("Rename().Wait() = %v", err)
+			}
+
+			statusData, err := client.Status(name, &imap.StatusOptions{NumMessages: true}).Wait()
+			if err != nil {
+				t.Fatalf("Status().Wait() = %v", err)
+			} else if statusData.Mailbox != name || statusData.NumMessages == nil || *statusData.NumMessages != 1 {
+				t.Errorf("Status() = %q %v, want %q 1", statusData.Mailbox, statusData.NumMessages, name)
+			}
+
+			// The same folder is addressable from a client in the other mode
+			other := connect(!mode.utf8, nil)
+			selectData, err := other.Select(name, nil).Wait()
+			if err != nil {
+				t.Fatalf("Select().Wait() = %v", err)
+			} else if selectData.NumMessages != 1 {
+				t.Errorf("SelectData.NumMessages = %v, want 1", selectData.NumMessages)
+			}
+			listData, err = other.List("", "*", &imap.ListOptions{SelectSubscribed: true}).Collect()
+			if err != nil {
+				t.Fatalf("List().Collect() = %v", err)
+			} else if len(listData) != 1 || listData[0].Mailbox != name {
+				t.Errorf("List(SUBSCRIBED) = %v, want %q", listData, name)
+			}
+		})
+	}
+}
+
+func TestMailboxName(t *testing.T) {
+	tests := []struct {
+		decoded, encoded string
+	}{
+		// RFC 3501 section 5.1.3
+		{"~peter/mail/台北/日本語", "~peter/mail/&U,BTFw-/&ZeVnLIqe-"},
+		{"Tom & Jerry", "Tom &- Jerry"},
+		{"Entwürfe", "Entw&APw-rfe"},
+		{"😊 smiley", "&2D3eCg- smiley"},
+		{"INBOX", "INBOX"},
+		{"", ""},
+	}
+	for _, tc := range tests {
+		if encoded, err := imap.EncodeMailboxName(tc.decoded); err != nil || encoded != tc.encoded {
+			t.Errorf("EncodeMailboxName(%q) = %q, %v, want %q", tc.decoded, encoded, err, tc.encoded)
+		}
+		if decoded, err := imap.DecodeMailboxName(tc.encoded); err != nil || decoded != tc.decoded {
+			t.Errorf("DecodeMailboxName(%q) = %q, %v, want %q", tc.encoded, decoded, err, tc.decoded)
+		}
+	}
+
+	for _, encoded := range []string{
+		"&U,BTFw-&ZeVnLIqe-", // null shift
+		"&Jjo!",              // implicit shift
+		"&AGE-",              // ASCII in base64
+		"&AOl-",              // non-zero trailing bits
+		"&2AA-",              // lone surrogate
+		"&AAAAHw=-",          // padding
+	} {
+		if decoded, err := imap.DecodeMailboxName(encoded); err == nil || decoded != encoded {
+			t.Errorf("DecodeMailboxName(%q) = %q, %v, want the input unchanged and an error", encoded, decoded, err)
+		}
+	}
+
+	if _, err := imap.EncodeMailboxName("\xff"); err == nil {
+		t.Errorf("EncodeMailboxName() = nil error for invalid UTF-8")
+	}
+}
+
+func FuzzMailboxName(f *testing.F) {
+	f.Add("~peter/mail/台北/日本語")
+	f.Add("~peter/mail/&U,BTFw-/&ZeVnLIqe-")
+	f.Add("&-\x00😊")
+	f.Fuzz(func(t *testing.T, s string) {
+		if encoded, err := imap.EncodeMailboxName(s); err != nil {
+			if utf8.ValidString(s) {
+				t.Errorf("EncodeMailboxName(%q) = %v", s, err)
+			}
+		} else if decoded, err := imap.DecodeMailboxName(encoded); err != nil || decoded != s {
+			t.Errorf("DecodeMailboxName(EncodeMailboxName(%q)) = %q, %v", s, decoded, err)
+		}
+
+		// Encodings are canonical: a decoded ASCII name is encoded back to
+		// the same string
+		decoded, err := imap.DecodeMailboxName(s)
+		if err != nil || !isPrintableASCII(s) {
+			return
+		}
+		if encoded, err := imap.EncodeMailboxName(decoded); err != nil || encoded != s {
+			t.Errorf("EncodeMailboxName(DecodeMailboxName(%q)) = %q, %v", s, encoded, err)
+		}
+	})
+}
+
+func isPrintableASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7E {
+			return false
+		}
+	}
+	return true
+}
+
+func TestClient_List_utf7(t *testing.T) {
+	commands := make(chan string, 2)
+	greeting := "* PREAUTH [CAPABILITY IMAP4rev1] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, args := readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, `* LIST () "/" "~peter/mail/&U,BTFw-/&ZeVnLIqe-"`+"\r\n")
+		io.WriteString(w, tag+" OK LIST completed\r\n")
+
+		tag, args = readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, `* LIST () "/" "&U,BTFw-&ZeVnLIqe-"`+"\r\n")
+		io.WriteString(w, tag+" OK LIST completed\r\n")
+	})
+
+	mailboxes, err := client.List("", "~peter/mail/台北/*", nil).Collect()
+	if err != nil {
+		t.Fatalf("List().Collect() = %v", err)
+	}
+	if cmd, want := <-commands, `LIST "" "~peter/mail/&U,BTFw-/*"`; cmd != want {
+		t.Errorf("sent %q, want %q", cmd, want)
+	}
+	if len(mailboxes) != 1 || mailboxes[0].Mailbox != "~peter/mail/台北/日本語" {
+		t.Errorf("List().Collect() = %v, want ~peter/mail/台北/日本語", mailboxes)
+	}
+
+	if _, err := client.List("", "*", nil).Collect(); err == nil {
+		t.Errorf("List().Collect() = nil error for an invalid mailbox name")
+	}
+	<-commands
+}
+
+func TestClient_mailboxNameQuoting(t *testing.T) {
+	names := []struct {
+		name, wantWire string
+	}{
+		{`a"b\c`, `CREATE "a\"b\\c"`},
+		{"trailing ", `CREATE "trailing "`},
+		{`Архив "2024"`, `CREATE "&BBAEQARFBDgEMg- \"2024\""`},
+	}
+
+	for _, utf8Mode := range []bool{false, true} {
+		user := imapmemserver.NewUser(testUsername, testPassword)
+		user.Create("INBOX", nil)
+		dial := newCapsTestServer(t, user, nil)
+
+		var debugLog lockedBuffer
+		client := dial(&imapclient.Options{DebugLog: &debugLog})
+		if utf8Mode {
+			if _, err := client.Enable(imap.CapUTF8Accept).Wait(); err != nil {
+				t.Fatalf("Enable().Wait() = %v", err)
+			}
+		}
+
+		for _, tc := range names {
+			if err := client.Create(tc.name, nil).Wait(); err != nil {
+				t.Fatalf("Create(%q).Wait() = %v", tc.name, err)
+			}
+			if !utf8Mode && !strings.Contains(debugLog.String(), tc.wantWire) {
+				t.Errorf("%v wasn't sent", tc.wantWire)
+			}
+
+			listData, err := client.List("", tc.name, nil).Collect()
+			if err != nil {
+				t.Fatalf("List(%q).Collect() = %v", tc.name, err)
+			} else if len(listData) != 1 || listData[0].Mailbox != tc.name {
+				t.Errorf("List(%q) = %v, want a single mailbox", tc.name, listData)
+			}
+
+			statusData, err := client.Status(tc.name, &imap.StatusOptions{NumMessages: true}).Wait()
+			if err != nil {
+				t.Fatalf("Status(%q).Wait() = %v", tc.name, err)
+			} else if statusData.Mailbox != tc.name {
+				t.Errorf("Status(%q) returned mailbox %q", tc.name, statusData.Mailbox)
+			}
+
+			if _, err := client.Select(tc.name, nil).Wait(); err != nil {
+				t.Fatalf("Select(%q).Wait() = %v", tc.name, err)
+			}
+			if err := client.Unselect().Wait(); err != nil {
+				t.Fatalf("Unselect().Wait() = %v", err)
+			}
+
+			if err := client.Delete(tc.name).Wait(); err != nil {
+				t.Fatalf("Delete(%q).Wait() = %v", tc.name, err)
+			}
+		}
+
+		client.Close()
+	}
+}
@@ -0,0 +1,329 @@
+package imapclient
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// MailboxViewHandler handles MailboxView events. Fields may be nil.
+//
+// Handlers are called like the ones registered with Client.OnExpunge: on a
+// dedicated goroutine, in the order the server sent the updates.
+type MailboxViewHandler struct {
+	// A new message has been added to the mailbox
+	MessageAdded func(uid imap.UID)
+	// A message has been removed from the mailbox
+	MessageRemoved func(uid imap.UID)
+	// The flags of a message have changed
+	FlagsChanged func(uid imap.UID, flags []imap.Flag)
+	// The view has been reset, because a mailbox has been selected or
+	// deselected, or because the UIDVALIDITY of the mailbox has changed.
+	// Cached UIDs must be discarded.
+	Invalidated func()
+}
+
+// MailboxView tracks the state of the selected mailbox: the UID of each
+// message sequence number, and the flags of each message.
+//
+// The view consumes all EXISTS, EXPUNGE, VANISHED and FETCH responses,
+// including the ones sent in reply to commands. When a mailbox is selected,
+// the view is populated with a UID FETCH command, and SelectCommand.Wait
+// returns once it's done. The UIDs and flags of new messages are fetched
+// automatically.
+//
+// Flags changed with STORE .SILENT aren't reported by the server, thus aren't
+// reflected in the view.
+type MailboxView struct {
+	client  *Client
+	handler MailboxViewHandler
+
+	mutex       sync.Mutex
+	mailbox     string // empty if no mailbox is selected
+	uidValidity uint32
+	msgs        []viewMessage // indexed by sequence number minus one
+}
+
+type viewMessage struct {
+	uid      imap.UID // zero if unknown
+	flags    []imap.Flag
+	hasFlags bool
+	added    bool // the message has been added after the mailbox was selected
+}
+
+// NewMailboxView attaches a new MailboxView to the client. Any previously
+// attached view is detached.
+//
+// If a mailbox is already selected, the view is populated before
+// NewMailboxView returns.
+//
+// A nil handler is equivalent to a zero handler.
+func (c *Client) NewMailboxView(handler *MailboxViewHandler) (*MailboxView, error) {
+	v := &MailboxView{client: c}
+	if handler != nil {
+		v.handler = *handler
+	}
+
+	c.mutex.Lock()
+	c.view = v
+	mbox := c.mailbox
+	c.mutex.Unlock()
+
+	if mbox == nil {
+		return v, nil
+	}
+	v.reset(mbox.Name, mbox.UIDValidity, mbox.NumMessages)
+	return v, v.fetch(1)
+}
+
+// Close detaches the view from the client.
+func (v *MailboxView) Close() {
+	v.client.mutex.Lock()
+	if v.client.view == v {
+		v.client.view = nil
+	}
+	v.client.mutex.Unlock()
+}
+
+// Mailbox returns the name of the selected mailbox, or an empty string if no
+// mailbox is selected.
+func (v *MailboxView) Mailbox() string {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return v.mailbox
+}
+
+// UIDValidity returns the UIDVALIDITY of the selected mailbox.
+func (v *MailboxView) UIDValidity() uint32 {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return v.uidValidity
+}
+
+// NumMessages returns the number of messages in the selected mailbox.
+func (v *MailboxView) NumMessages() uint32 {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return uint32(len(v.msgs))
+}
+
+// UIDForSeqNum returns the UID of a message. false is returned if the message
+// doesn't exist or its UID isn't known yet.
+func (v *MailboxView) UIDForSeqNum(seqNum uint32) (imap.UID, bool) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if seqNum == 0 || seqNum > uint32(len(v.msgs)) {
+		return 0, false
+	}
+	uid := v.msgs[seqNum-1].uid
+	return uid, uid != 0
+}
+
+// SeqNumForUID returns the sequence number of a message. false is returned if
+// the message isn't in the view.
+func (v *MailboxView) SeqNumForUID(uid imap.UID) (uint32, bool) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	i := v.indexLocked(uid)
+	return uint32(i + 1), i >= 0
+}
+
+// Flags returns the flags of a message. false is returned if the message isn't
+// in the view, or if its flags aren't known yet.
+func (v *MailboxView) Flags(uid imap.UID) ([]imap.Flag, bool) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	i := v.indexLocked(uid)
+	if i < 0 || !v.msgs[i].hasFlags {
+		return nil, false
+	}
+	return v.msgs[i].flags, true
+}
+
+func (v *MailboxView) indexLocked(uid imap.UID) int {
+	if uid == 0 {
+		return -1
+	}
+	// UIDs are strictly ascending, but some may be unknown
+	i := sort.Search(len(v.msgs), func(i int) bool {
+		return v.msgs[i].uid != 0 && v.msgs[i].uid >= uid
+	})
+	if i < len(v.msgs) && v.msgs[i].uid == uid {
+		return i
+	}
+	for i, msg := range v.msgs {
+		if msg.uid == uid {
+			return i
+		}
+	}
+	return -1
+}
+
+func (v *MailboxView) maxUIDLocked() imap.UID {
+	for i := len(v.msgs) - 1; i >= 0; i-- {
+		if uid := v.msgs[i].uid; uid != 0 {
+			return uid
+		}
+	}
+	return 0
+}
+
+func (v *MailboxView) reset(mailbox string, uidValidity, numMessages uint32) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.mailbox = mailbox
+	v.uidValidity = uidValidity
+	v.msgs = make([]viewMessage, numMessages)
+}
+
+// fetch fetches the UIDs and flags of the messages starting from a UID.
+func (v *MailboxView) fetch(start imap.UID) error {
+	uids := imap.UIDSet{imap.UIDRange{Start: start, Stop: 0}}
+	return v.client.Fetch(uids, &imap.FetchOptions{UID: true, Flags: true}).Close()
+}
+
+// The following methods are called from the goroutine reading responses.
+
+// handleSelect resets the view after a successful SELECT or EXAMINE command.
+// The returned channel is closed once the view has been populated.
+func (v *MailboxView) handleSelect(mailbox string, uidValidity, numMessages uint32) <-chan struct{} {
+	v.reset(mailbox, uidValidity, numMessages)
+	v.queue(v.handler.Invalidated)
+
+	done := make(chan struct{})
+	if numMessages == 0 {
+		close(done)
+		return done
+	}
+	go func() {
+		defer close(done)
+		v.fetch(1)
+	}()
+	return done
+}
+
+func (v *MailboxView) handleUnselect() {
+	v.reset("", 0, 0)
+	v.queue(v.handler.Invalidated)
+}
+
+func (v *MailboxView) handleUIDValidity(uidValidity uint32) {
+	v.mutex.Lock()
+	changed := v.mailbox != "" && v.uidValidity != uidValidity
+	mailbox, numMessages := v.mailbox, uint32(len(v.msgs))
+	v.mutex.Unlock()
+
+	if changed {
+		v.handleSelect(mailbox, uidValidity, numMessages)
+	}
+}
+
+func (v *MailboxView) handleExists(numMessages uint32) {
+	v.mutex.Lock()
+	n := uint32(len(v.msgs))
+	if v.mailbox == "" || numMessages <= n {
+		v.mutex.Unlock()
+		return
+	}
+	for i := n; i < numMessages; i++ {
+		v.msgs = append(v.msgs, viewMessage{added: true})
+	}
+	start := v.maxUIDLocked() + 1
+	v.mutex.Unlock()
+
+	go v.fetch(start)
+}
+
+func (v *MailboxView) handleExpunge(seqNum uint32) {
+	v.mutex.Lock()
+	if seqNum == 0 || seqNum > uint32(len(v.msgs)) {
+		v.mutex.Unlock()
+		return
+	}
+	uid := v.msgs[seqNum-1].uid
+	v.msgs = append(v.msgs[:seqNum-1], v.msgs[seqNum:]...)
+	v.mutex.Unlock()
+
+	if uid != 0 && v.handler.MessageRemoved != nil {
+		v.queue(func() {
+			v.handler.MessageRemoved(uid)
+		})
+	}
+}
+
+func (v *MailboxView) handleVanished(uids imap.UIDSet) {
+	v.mutex.Lock()
+	var removed []imap.UID
+	msgs := v.msgs[:0]
+	for _, msg := range v.msgs {
+		if msg.uid != 0 && uids.Contains(msg.uid) {
+			removed = append(removed, msg.uid)
+		} else {
+			msgs = append(msgs, msg)
+		}
+	}
+	v.msgs = msgs
+	v.mutex.Unlock()
+
+	if len(removed) > 0 && v.handler.MessageRemoved != nil {
+		v.queue(func() {
+			for _, uid := range removed {
+				v.handler.MessageRemoved(uid)
+			}
+		})
+	}
+}
+
+func (v *MailboxView) handleFetch(seqNum uint32, uid imap.UID, flags []imap.Flag, hasFlags bool) {
+	v.mutex.Lock()
+	if seqNum == 0 || seqNum > uint32(len(v.msgs)) {
+		v.mutex.Unlock()
+		return
+	}
+	msg := &v.msgs[seqNum-1]
+	added := uid != 0 && msg.uid == 0 && msg.added
+	if uid != 0 {
+		msg.uid = uid
+	}
+	flagsChanged := hasFlags && msg.hasFlags && msg.uid != 0 && !equalFlags(msg.flags, flags)
+	if hasFlags {
+		msg.flags = flags
+		msg.hasFlags = true
+	}
+	uid = msg.uid
+	v.mutex.Unlock()
+
+	if added && v.handler.MessageAdded != nil {
+		v.queue(func() {
+			v.handler.MessageAdded(uid)
+		})
+	}
+	if flagsChanged && v.handler.FlagsChanged != nil {
+		v.queue(func() {
+			v.handler.FlagsChanged(uid, flags)
+		})
+	}
+}
+
+func (v *MailboxView) queue(f func()) {
+	if f != nil {
+		v.client.updates.push(f)
+	}
+}
+
+func equalFlags(a, b []imap.Flag) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	m := make(map[imap.Flag]struct{}, len(a))
+	for _, flag := range a {
+		m[flag] = struct{}{}
+	}
+	for _, flag := range b {
+		if _, ok := m[flag]; !ok {
+			return false
+		}
+	}
+	return true
+}
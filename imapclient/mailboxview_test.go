@@ -0,0 +1,145 @@
+package imapclient_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+func TestMailboxView(t *testing.T) {
+	user := imapmemserver.NewUser(testUsername, testPassword)
+	user.Create("INBOX", nil)
+	dial := newCapsTestServer(t, user, nil)
+
+	other := dial(nil)
+	for i := 0; i < 5; i++ {
+		appendTestMessage(t, other)
+	}
+
+	client := dial(nil)
+	added := make(chan imap.UID, 16)
+	removed := make(chan imap.UID, 16)
+	flagsChanged := make(chan imap.UID, 16)
+	view, err := client.NewMailboxView(&imapclient.MailboxViewHandler{
+		MessageAdded: func(uid imap.UID) {
+			added <- uid
+		},
+		MessageRemoved: func(uid imap.UID) {
+			removed <- uid
+		},
+		FlagsChanged: func(uid imap.UID, flags []imap.Flag) {
+			flagsChanged <- uid
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewMailboxView() = %v", err)
+	}
+	defer view.Close()
+
+	if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select().Wait() = %v", err)
+	}
+	checkView := func(want []imap.UID) {
+		t.Helper()
+		if n := view.NumMessages(); n != uint32(len(want)) {
+			t.Errorf("NumMessages() = %v, want %v", n, len(want))
+		}
+		for i, wantUID := range want {
+			seqNum := uint32(i + 1)
+			if uid, ok := view.UIDForSeqNum(seqNum); !ok || uid != wantUID {
+				t.Errorf("UIDForSeqNum(%v) = %v, %v, want %v", seqNum, uid, ok, wantUID)
+			}
+			if n, ok := view.SeqNumForUID(wantUID); !ok || n != seqNum {
+				t.Errorf("SeqNumForUID(%v) = %v, %v, want %v", wantUID, n, ok, seqNum)
+			}
+		}
+	}
+	checkView([]imap.UID{1, 2, 3, 4, 5})
+
+	// Expunge messages 2 and 4 from another connection
+	if _, err := other.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select().Wait() = %v", err)
+	}
+	storeFlags := imap.StoreFlags{
+		Op:     imap.StoreFlagsAdd,
+		Silent: true,
+		Flags:  []imap.Flag{imap.FlagDeleted},
+	}
+	if err := other.Store(imap.UIDSetNum(2, 4), &storeFlags, nil).Close(); err != nil {
+		t.Fatalf("Store().Close() = %v", err)
+	}
+	if err := other.Expunge().Close(); err != nil {
+		t.Fatalf("Expunge().Close() = %v", err)
+	}
+
+	if err := client.Noop().Wait(); err != nil {
+		t.Fatalf("Noop().Wait() = %v", err)
+	}
+	checkView([]imap.UID{1, 3, 5})
+	if _, ok := view.SeqNumForUID(4); ok {
+		t.Errorf("SeqNumForUID(4) succeeded after expunge")
+	}
+	// The server expunges messages in descending order
+	for _, want := range []imap.UID{4, 2} {
+		select {
+		case uid := <-removed:
+			if uid != want {
+				t.Errorf("MessageRemoved(%v), want %v", uid, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for MessageRemoved")
+		}
+	}
+
+	// Interleave a new message and an expunge
+	appendTestMessage(t, other)
+	if err := other.Store(imap.UIDSetNum(1), &storeFlags, nil).Close(); err != nil {
+		t.Fatalf("Store().Close() = %v", err)
+	}
+	if err := other.Expunge().Close(); err != nil {
+		t.Fatalf("Expunge().Close() = %v", err)
+	}
+	if err := client.Noop().Wait(); err != nil {
+		t.Fatalf("Noop().Wait() = %v", err)
+	}
+	select {
+	case uid := <-added:
+		if uid != 6 {
+			t.Errorf("MessageAdded(%v), want 6", uid)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for MessageAdded")
+	}
+	checkView([]imap.UID{3, 5, 6})
+
+	// Flag changes from another connection
+	if err := other.Store(imap.UIDSetNum(5), &imap.StoreFlags{
+		Op:    imap.StoreFlagsAdd,
+		Flags: []imap.Flag{imap.FlagFlagged},
+	}, nil).Close(); err != nil {
+		t.Fatalf("Store().Close() = %v", err)
+	}
+	if err := client.Noop().Wait(); err != nil {
+		t.Fatalf("Noop().Wait() = %v", err)
+	}
+	for uid := imap.UID(0); uid != 5; {
+		select {
+		case uid = <-flagsChanged:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for FlagsChanged")
+		}
+	}
+	if flags, ok := view.Flags(5); !ok || !containsFlag(flags, imap.FlagFlagged) {
+		t.Errorf("Flags(5) = %v, %v, want \\Flagged", flags, ok)
+	}
+
+	if err := client.Unselect().Wait(); err != nil {
+		t.Fatalf("Unselect().Wait() = %v", err)
+	}
+	if view.Mailbox() != "" || view.NumMessages() != 0 {
+		t.Errorf("view not reset after UNSELECT")
+	}
+}
@@ -0,0 +1,224 @@
+package imapclient
+
+import (
+	"fmt"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// maxUIDSetLen is the maximum length of a UID set sent by the high-level
+// message operations below. Servers commonly reject command lines longer than
+// 8192 bytes, see RFC 7162 section 4.
+const maxUIDSetLen = 4000
+
+// ReadOnlyError is returned by the high-level message operations when the
+// mailbox has been selected in read-only mode. No command is sent to the
+// server.
+type ReadOnlyError struct {
+	Mailbox string
+}
+
+func (err *ReadOnlyError) Error() string {
+	return fmt.Sprintf("imapclient: mailbox %q is read-only", err.Mailbox)
+}
+
+// MarkSeen adds or removes the \Seen flag on messages in the selected
+// mailbox.
+//
+// Like the other high-level message operations, it returns a *ReadOnlyError
+// if the selected mailbox is read-only, uses silent STORE commands, and
+// splits large UID sets into multiple commands.
+func (c *Client) MarkSeen(uids imap.UIDSet, seen bool) error {
+	return c.storeFlagsBatched(uids, seen, []imap.Flag{imap.FlagSeen})
+}
+
+// SetFlagged adds or removes the \Flagged flag on messages in the selected
+// mailbox.
+func (c *Client) SetFlagged(uids imap.UIDSet, flagged bool) error {
+	return c.storeFlagsBatched(uids, flagged, []imap.Flag{imap.FlagFlagged})
+}
+
+// AddKeywords adds keywords to messages in the selected mailbox.
+func (c *Client) AddKeywords(uids imap.UIDSet, keywords ...imap.Flag) error {
+	return c.storeFlagsBatched(uids, true, keywords)
+}
+
+// RemoveKeywords removes keywords from messages in the selected mailbox.
+func (c *Client) RemoveKeywords(uids imap.UIDSet, keywords ...imap.Flag) error {
+	return c.storeFlagsBatched(uids, false, keywords)
+}
+
+// DeleteToTrash moves messages from the selected mailbox to the trash
+// mailbox.
+//
+// If trash is empty, the trash mailbox is discovered with
+// Client.SpecialUseMailboxes. If there is no trash mailbox, or if the selected
+// mailbox is the trash mailbox, the messages are permanently deleted: they
+// are flagged as \Deleted, then expunged with UID EXPUNGE. Permanent deletion
+// requires UIDPLUS, so that other messages flagged as \Deleted are left
+// untouched. See Client.Move for the caveats of servers without UIDPLUS.
+func (c *Client) DeleteToTrash(uids imap.UIDSet, trash string) error {
+	if err := c.checkWritable(); err != nil {
+		return err
+	}
+
+	if trash == "" {
+		mailboxes, err := c.SpecialUseMailboxes()
+		if err != nil {
+			return err
+		}
+		trash = mailboxes[imap.MailboxAttrTrash].Name
+	}
+	if mbox := c.Mailbox(); trash != "" && (mbox == nil || trash != mbox.Name) {
+		err := c.moveBatched(uids, trash)
+		if err == nil || !(IsTryCreate(err) || IsNonExistent(err)) {
+			return err
+		}
+	}
+
+	return c.deleteBatched(uids)
+}
+
+// EmptyMailbox permanently deletes all messages in a mailbox.
+//
+// If the mailbox isn't the selected mailbox, it's selected, and unselected
+// once emptied if the server supports UNSELECT: afterwards, no mailbox is
+// selected. Without UNSELECT, the mailbox remains selected.
+func (c *Client) EmptyMailbox(name string) error {
+	if mbox := c.Mailbox(); mbox != nil && mbox.Name == name {
+		if err := c.checkWritable(); err != nil {
+			return err
+		}
+		return c.expungeAll()
+	}
+
+	data, err := c.Select(name, nil).Wait()
+	if err != nil {
+		return err
+	} else if data.ReadOnly {
+		return &ReadOnlyError{Mailbox: name}
+	}
+	if data.NumMessages > 0 {
+		if err := c.expungeAll(); err != nil {
+			return err
+		}
+	}
+	if !c.Caps().Has(imap.CapUnselect) {
+		return nil
+	}
+	return c.Unselect().Wait()
+}
+
+// expungeAll permanently deletes all messages in the selected mailbox.
+//
+// Since no message is kept, a plain EXPUNGE is used if the server doesn't
+// support UIDPLUS.
+func (c *Client) expungeAll() error {
+	all := imap.UIDSet{imap.UIDRange{Start: 1, Stop: 0}}
+	if c.Caps().Has(imap.CapUIDPlus) {
+		return c.deleteBatched(all)
+	}
+	if err := c.storeFlagsBatched(all, true, []imap.Flag{imap.FlagDeleted}); err != nil {
+		return err
+	}
+	return c.Expunge().Close()
+}
+
+func (c *Client) checkWritable() error {
+	if mbox := c.Mailbox(); mbox != nil && mbox.ReadOnly {
+		return &ReadOnlyError{Mailbox: mbox.Name}
+	}
+	return nil
+}
+
+func (c *Client) storeFlagsBatched(uids imap.UIDSet, add bool, flags []imap.Flag) error {
+	if err := c.checkWritable(); err != nil {
+		return err
+	}
+
+	op := imap.StoreFlagsDel
+	if add {
+		op = imap.StoreFlagsAdd
+	}
+	var cmds []*FetchCommand
+	for _, batch := range splitUIDSet(uids, maxUIDSetLen) {
+		cmds = append(cmds, c.Store(batch, &imap.StoreFlags{
+			Op:     op,
+			Silent: true,
+			Flags:  flags,
+		}, nil))
+	}
+	return closeCommands(cmds)
+}
+
+func (c *Client) moveBatched(uids imap.UIDSet, mailbox string) error {
+	for _, batch := range splitUIDSet(uids, maxUIDSetLen) {
+		if _, err := c.Move(batch, mailbox).Wait(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteBatched flags messages as \Deleted and expunges them with UID
+// EXPUNGE. A plain EXPUNGE would remove other messages flagged as \Deleted,
+// so UIDPLUS is required.
+func (c *Client) deleteBatched(uids imap.UIDSet) error {
+	if len(uids) == 0 && !imap.IsSearchRes(uids) {
+		return nil
+	}
+	if err := c.checkCap(imap.CapUIDPlus); err != nil {
+		return err
+	}
+	if err := c.storeFlagsBatched(uids, true, []imap.Flag{imap.FlagDeleted}); err != nil {
+		return err
+	}
+
+	var cmds []*ExpungeCommand
+	for _, batch := range splitUIDSet(uids, maxUIDSetLen) {
+		cmds = append(cmds, c.UIDExpunge(batch))
+	}
+	return closeCommands(cmds)
+}
+
+// closeCommands waits for pipelined commands to complete, and returns the
+// first error.
+func closeCommands[T interface{ Close() error }](cmds []T) error {
+	var firstErr error
+	for _, cmd := range cmds {
+		if err := cmd.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// splitUIDSet splits a UID set into sets whose string representation is at
+// most maxLen bytes long. Ranges are never split.
+func splitUIDSet(uids imap.UIDSet, maxLen int) []imap.UIDSet {
+	if imap.IsSearchRes(uids) {
+		return []imap.UIDSet{uids}
+	}
+
+	var (
+		sets []imap.UIDSet
+		cur  imap.UIDSet
+		n    int
+	)
+	for _, r := range uids {
+		l := len(imap.UIDSet{r}.String())
+		if len(cur) > 0 && n+1+l > maxLen {
+			sets = append(sets, cur)
+			cur, n = nil, 0
+		}
+		if len(cur) > 0 {
+			n++ // comma
+		}
+		cur = append(cur, r)
+		n += l
+	}
+	if len(cur) > 0 {
+		sets = append(sets, cur)
+	}
+	return sets
+}
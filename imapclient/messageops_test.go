@@ -0,0 +1,202 @@
+package imapclient_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+const messageOpsTestMsg = "Subject: Test\r\n\r\nHello\r\n"
+
+func fetchMessageFlags(t *testing.T, client *imapclient.Client, uid imap.UID) []imap.Flag {
+	msgs, err := client.Fetch(imap.UIDSetNum(uid), &imap.FetchOptions{Flags: true}).Collect()
+	if err != nil {
+		t.Fatalf("Fetch().Collect() = %v", err)
+	} else if len(msgs) != 1 {
+		t.Fatalf("Fetch().Collect() returned %v messages, want 1", len(msgs))
+	}
+	return msgs[0].Flags
+}
+
+func numMessages(t *testing.T, client *imapclient.Client, mailbox string) uint32 {
+	data, err := client.Status(mailbox, &imap.StatusOptions{NumMessages: true}).Wait()
+	if err != nil {
+		t.Fatalf("Status(%q).Wait() = %v", mailbox, err)
+	}
+	return *data.NumMessages
+}
+
+func TestClient_MessageOps(t *testing.T) {
+	user := imapmemserver.NewUser(testUsername, testPassword)
+	user.Create("INBOX", nil)
+	dial := newCapsTestServer(t, user, imap.CapSet{imap.CapUIDPlus: {}})
+	var debugLog lockedBuffer
+	client := dial(&imapclient.Options{DebugLog: &debugLog})
+
+	uid := appendRawMessage(t, client, messageOpsTestMsg)
+	if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select().Wait() = %v", err)
+	}
+	uids := imap.UIDSetNum(uid)
+
+	if err := client.MarkSeen(uids, true); err != nil {
+		t.Fatalf("MarkSeen() = %v", err)
+	}
+	if err := client.SetFlagged(uids, true); err != nil {
+		t.Fatalf("SetFlagged() = %v", err)
+	}
+	if err := client.AddKeywords(uids, "$Important", "Work"); err != nil {
+		t.Fatalf("AddKeywords() = %v", err)
+	}
+	flags := fetchMessageFlags(t, client, uid)
+	for _, flag := range []imap.Flag{imap.FlagSeen, imap.FlagFlagged, "$Important", "Work"} {
+		if !containsFlag(flags, flag) {
+			t.Errorf("flags = %v, want %v", flags, flag)
+		}
+	}
+
+	if err := client.MarkSeen(uids, false); err != nil {
+		t.Fatalf("MarkSeen() = %v", err)
+	}
+	if err := client.RemoveKeywords(uids, "Work"); err != nil {
+		t.Fatalf("RemoveKeywords() = %v", err)
+	}
+	flags = fetchMessageFlags(t, client, uid)
+	if containsFlag(flags, imap.FlagSeen) || containsFlag(flags, "Work") || !containsFlag(flags, "$Important") {
+		t.Errorf("flags = %v, want \\Flagged and $Important only", flags)
+	}
+
+	// Large UID sets are split into multiple commands
+	var many imap.UIDSet
+	for i := imap.UID(1); i <= 2000; i++ {
+		many.AddNum(2*i + 1000)
+	}
+	many.AddNum(uid)
+	before := strings.Count(debugLog.String(), "UID STORE")
+	if err := client.SetFlagged(many, false); err != nil {
+		t.Fatalf("SetFlagged() = %v", err)
+	}
+	if n := strings.Count(debugLog.String(), "UID STORE") - before; n < 2 {
+		t.Errorf("sent %v UID STORE commands, want at least 2", n)
+	}
+	if containsFlag(fetchMessageFlags(t, client, uid), imap.FlagFlagged) {
+		t.Errorf("message still flagged")
+	}
+	if !strings.Contains(debugLog.String(), "-FLAGS.SILENT") {
+		t.Errorf("STORE commands aren't silent")
+	}
+
+	// Read-only mailboxes are rejected without sending anything
+	if _, err := client.Select("INBOX", &imap.SelectOptions{ReadOnly: true}).Wait(); err != nil {
+		t.Fatalf("Select().Wait() = %v", err)
+	}
+	before = strings.Count(debugLog.String(), "UID STORE")
+	var readOnlyErr *imapclient.ReadOnlyError
+	if err := client.MarkSeen(uids, true); !errors.As(err, &readOnlyErr) {
+		t.Errorf("MarkSeen() = %v, want a ReadOnlyError", err)
+	}
+	if err := client.DeleteToTrash(uids, ""); !errors.As(err, &readOnlyErr) {
+		t.Errorf("DeleteToTrash() = %v, want a ReadOnlyError", err)
+	}
+	if n := strings.Count(debugLog.String(), "UID STORE") - before; n != 0 {
+		t.Errorf("sent %v UID STORE commands in read-only mailbox", n)
+	}
+}
+
+func TestClient_DeleteToTrash(t *testing.T) {
+	user := imapmemserver.NewUser(testUsername, testPassword)
+	user.Create("INBOX", nil)
+	dial := newCapsTestServer(t, user, imap.CapSet{imap.CapUIDPlus: {}, imap.CapUnselect: {}})
+	client := dial(nil)
+
+	// Without any trash mailbox, messages are permanently deleted
+	uid := appendRawMessage(t, client, messageOpsTestMsg)
+	other := appendRawMessage(t, client, messageOpsTestMsg)
+	if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select().Wait() = %v", err)
+	}
+	if err := client.DeleteToTrash(imap.UIDSetNum(uid), ""); err != nil {
+		t.Fatalf("DeleteToTrash() = %v", err)
+	}
+	if n := client.Mailbox().NumMessages; n != 1 {
+		t.Errorf("INBOX has %v messages, want 1", n)
+	}
+
+	// An explicit trash mailbox which doesn't exist falls back too
+	if err := client.DeleteToTrash(imap.UIDSetNum(other), "Missing"); err != nil {
+		t.Fatalf("DeleteToTrash() = %v", err)
+	}
+	if n := client.Mailbox().NumMessages; n != 0 {
+		t.Errorf("INBOX has %v messages, want 0", n)
+	}
+
+	// The trash mailbox is discovered by name
+	if err := client.Create("Trash", nil).Wait(); err != nil {
+		t.Fatalf("Create().Wait() = %v", err)
+	}
+	uid = appendRawMessage(t, client, messageOpsTestMsg)
+	appendRawMessage(t, client, messageOpsTestMsg)
+	if err := client.DeleteToTrash(imap.UIDSetNum(uid), ""); err != nil {
+		t.Fatalf("DeleteToTrash() = %v", err)
+	}
+	if n := numMessages(t, client, "Trash"); n != 1 {
+		t.Errorf("Trash has %v messages, want 1", n)
+	}
+
+	if err := client.EmptyMailbox("Trash"); err != nil {
+		t.Fatalf("EmptyMailbox() = %v", err)
+	}
+	if n := numMessages(t, client, "Trash"); n != 0 {
+		t.Errorf("Trash has %v messages after EmptyMailbox, want 0", n)
+	}
+	if client.Mailbox() != nil {
+		t.Errorf("a mailbox is still selected after EmptyMailbox")
+	}
+	if n := numMessages(t, client, "INBOX"); n != 1 {
+		t.Errorf("INBOX has %v messages, want 1", n)
+	}
+}
+
+func TestClient_DeleteToTrash_noUIDPlus(t *testing.T) {
+	user := imapmemserver.NewUser(testUsername, testPassword)
+	user.Create("INBOX", nil)
+	dial := newCapsTestServer(t, user, nil)
+	var debugLog lockedBuffer
+	client := dial(&imapclient.Options{DebugLog: &debugLog})
+
+	uid := appendRawMessage(t, client, messageOpsTestMsg)
+	other := appendRawMessage(t, client, messageOpsTestMsg)
+	if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select().Wait() = %v", err)
+	}
+	if err := client.AddKeywords(imap.UIDSetNum(other), imap.FlagDeleted); err != nil {
+		t.Fatalf("AddKeywords() = %v", err)
+	}
+
+	var capErr *imapclient.CapabilityError
+	if err := client.DeleteToTrash(imap.UIDSetNum(uid), ""); !errors.As(err, &capErr) || capErr.Cap != imap.CapUIDPlus {
+		t.Errorf("DeleteToTrash() = %v, want a UIDPLUS CapabilityError", err)
+	}
+
+	if containsFlag(fetchMessageFlags(t, client, uid), imap.FlagDeleted) {
+		t.Errorf("message flagged as \\Deleted despite the error")
+	}
+	if strings.Contains(debugLog.String(), "EXPUNGE") {
+		t.Errorf("EXPUNGE command was sent")
+	}
+	if n := client.Mailbox().NumMessages; n != 2 {
+		t.Errorf("INBOX has %v messages, want 2", n)
+	}
+
+	// Every message is deleted, so EmptyMailbox falls back to EXPUNGE
+	if err := client.EmptyMailbox("INBOX"); err != nil {
+		t.Fatalf("EmptyMailbox() = %v", err)
+	}
+	if n := client.Mailbox().NumMessages; n != 0 {
+		t.Errorf("INBOX has %v messages after EmptyMailbox, want 0", n)
+	}
+}
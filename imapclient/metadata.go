@@ -2,10 +2,13 @@ package imapclient
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
+// GetMetadataDepth is the depth of a GETMETADATA command: it indicates
+// whether children of the requested entries are returned.
 type GetMetadataDepth int
 
 const (
@@ -29,6 +32,9 @@ func (depth GetMetadataDepth) String() string {
 
 // GetMetadataOptions contains options for the GETMETADATA command.
 type GetMetadataOptions struct {
+	// Only return entries whose value is smaller than or equal to this size
+	// in bytes. The size of the biggest omitted value is returned in
+	// GetMetadataData.LongEntries.
 	MaxSize *uint32
 	Depth   GetMetadataDepth
 }
@@ -49,6 +55,8 @@ func (options *GetMetadataOptions) names() []string {
 
 // GetMetadata sends a GETMETADATA command.
 //
+// Server annotations can be retrieved by using an empty mailbox name.
+//
 // This command requires support for the METADATA or METADATA-SERVER extension.
 func (c *Client) GetMetadata(mailbox string, entries []string, options *GetMetadataOptions) *GetMetadataCommand {
 	cmd := &GetMetadataCommand{mailbox: mailbox}
@@ -77,27 +85,30 @@ func (c *Client) GetMetadata(mailbox string, entries []string, options *GetMetad
 
 // SetMetadata sends a SETMETADATA command.
 //
-// To remove an entry, set it to nil.
+// To remove an entry, set it to nil. Values are always sent as literals,
+// since they may contain CRLF and 8-bit data. They must not contain NUL bytes.
+//
+// Server annotations can be set by using an empty mailbox name.
 //
 // This command requires support for the METADATA or METADATA-SERVER extension.
 func (c *Client) SetMetadata(mailbox string, entries map[string]*[]byte) *Command {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
 	cmd := &Command{}
 	enc := c.beginCommand("SETMETADATA", cmd)
-	enc.SP().Mailbox(mailbox).SP().Special('(')
-	i := 0
-	for k, v := range entries {
-		if i > 0 {
-			enc.SP()
-		}
-		enc.String(k).SP()
-		if v == nil {
+	enc.SP().Mailbox(mailbox).SP().List(len(names), func(i int) {
+		name := names[i]
+		enc.String(name).SP()
+		if v := entries[name]; v == nil {
 			enc.NIL()
 		} else {
-			enc.String(string(*v)) // TODO: use literals if required
+			enc.StringLiteral(string(*v))
 		}
-		i++
-	}
-	enc.Special(')')
+	})
 	enc.end()
 	return cmd
 }
@@ -144,7 +155,11 @@ func (cmd *GetMetadataCommand) Wait() (*GetMetadataData, error) {
 // GetMetadataData is the data returned by the GETMETADATA command.
 type GetMetadataData struct {
 	Mailbox string
+	// Entry values. A nil value indicates that the entry doesn't exist.
 	Entries map[string]*[]byte
+	// If non-zero, some entries have been omitted because they were bigger
+	// than GetMetadataOptions.MaxSize. This is the size of the biggest one.
+	LongEntries uint32
 }
 
 type metadataResp struct {
@@ -166,12 +181,11 @@ func readMetadataResp(dec *imapwire.Decoder) (*metadataResp, error) {
 			return dec.Err()
 		}
 
-		// TODO: decode as []byte
 		var (
 			value *[]byte
 			s     string
 		)
-		if dec.String(&s) || dec.Literal(&s) {
+		if dec.String(&s) {
 			b := []byte(s)
 			value = &b
 		} else if !dec.ExpectNIL() {
@@ -0,0 +1,86 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestClient_Metadata(t *testing.T) {
+	binaryValue := "\x01\x7f\xff\xfe\r\nsecond line \x80"
+
+	commands := make(chan string, 3)
+	greeting := "* OK [CAPABILITY IMAP4rev1 METADATA] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, args := readScriptTaggedCommand(t, br, w)
+		commands <- args
+		fmt.Fprintf(w, "* METADATA INBOX (/private/comment {%v}\r\n%v /shared/comment \"\" /private/missing NIL)\r\n", len(binaryValue), binaryValue)
+		io.WriteString(w, tag+" OK [METADATA LONGENTRIES 2199] GETMETADATA completed\r\n")
+
+		tag, args = readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, "* METADATA \"\" (/shared/admin \"mailto:admin@example.org\")\r\n")
+		io.WriteString(w, tag+" OK GETMETADATA completed\r\n")
+
+		tag, args = readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, "* METADATA INBOX /shared/comment /private/comment\r\n")
+		io.WriteString(w, tag+" NO [METADATA MAXSIZE 1024] Annotation too large\r\n")
+	})
+
+	maxSize := uint32(1024)
+	data, err := client.GetMetadata("INBOX", []string{"/private/comment", "/shared/comment", "/private/missing"}, &imapclient.GetMetadataOptions{
+		MaxSize: &maxSize,
+		Depth:   imapclient.GetMetadataDepthInfinity,
+	}).Wait()
+	if err != nil {
+		t.Fatalf("GetMetadata().Wait() = %v", err)
+	}
+	want := `GETMETADATA INBOX (MAXSIZE 1024 DEPTH infinity) ("/private/comment" "/shared/comment" "/private/missing")`
+	if cmd := <-commands; cmd != want {
+		t.Errorf("sent %q, want %q", cmd, want)
+	}
+	if v := data.Entries["/private/comment"]; v == nil || string(*v) != binaryValue {
+		t.Errorf("/private/comment = %v, want %q", v, binaryValue)
+	}
+	if v := data.Entries["/shared/comment"]; v == nil || len(*v) != 0 {
+		t.Errorf("/shared/comment = %v, want empty value", v)
+	}
+	if v, ok := data.Entries["/private/missing"]; !ok || v != nil {
+		t.Errorf("/private/missing = %v, want nil", v)
+	}
+	if data.LongEntries != 2199 {
+		t.Errorf("LongEntries = %v, want 2199", data.LongEntries)
+	}
+
+	data, err = client.GetMetadata("", []string{"/shared/admin"}, nil).Wait()
+	if err != nil {
+		t.Fatalf("GetMetadata().Wait() = %v", err)
+	}
+	want = `GETMETADATA "" ("/shared/admin")`
+	if cmd := <-commands; cmd != want {
+		t.Errorf("sent %q, want %q", cmd, want)
+	}
+	if v := data.Entries["/shared/admin"]; v == nil || string(*v) != "mailto:admin@example.org" {
+		t.Errorf("/shared/admin = %v, want mailto:admin@example.org", v)
+	}
+
+	value := []byte(binaryValue)
+	err = client.SetMetadata("INBOX", map[string]*[]byte{
+		"/shared/comment":  nil,
+		"/private/comment": &value,
+	}).Wait()
+	want = fmt.Sprintf("SETMETADATA INBOX (\"/private/comment\" {%v}\r\n%v \"/shared/comment\" NIL)", len(binaryValue), binaryValue)
+	if cmd := <-commands; cmd != want {
+		t.Errorf("sent %q, want %q", cmd, want)
+	}
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeMaxSize || len(imapErr.CodeArgs) != 1 || imapErr.CodeArgs[0] != uint32(1024) {
+		t.Errorf("SetMetadata().Wait() = %v, want MAXSIZE 1024 error", err)
+	}
+}
@@ -1,6 +1,9 @@
 package imapclient
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
@@ -8,10 +11,20 @@ import (
 // Move sends a MOVE command.
 //
 // If the server doesn't support IMAP4rev2 nor the MOVE extension, a fallback
-// with COPY + STORE + EXPUNGE commands is used.
+// with COPY + STORE + EXPUNGE commands is used. The STORE command is only sent
+// once the COPY command has succeeded. If the server supports UIDPLUS, UID
+// EXPUNGE is used to only remove the copied messages. Otherwise, a plain
+// EXPUNGE command is sent: it also removes any other message flagged as
+// \Deleted in the selected mailbox.
+//
+// If the fallback fails after the messages have been copied, the returned
+// error indicates that the messages haven't been removed from the selected
+// mailbox.
 func (c *Client) Move(numSet imap.NumSet, mailbox string) *MoveCommand {
-	// If the server doesn't support MOVE, fallback to [UID] COPY,
-	// [UID] STORE +FLAGS.SILENT \Deleted and [UID] EXPUNGE
+	if err := c.checkSearchRes(numSet); err != nil {
+		return &MoveCommand{commandBase: failedCommandBase(err)}
+	}
+
 	cmdName := "MOVE"
 	if !c.Caps().Has(imap.CapMove) {
 		cmdName = "COPY"
@@ -23,48 +36,93 @@ func (c *Client) Move(numSet imap.NumSet, mailbox string) *MoveCommand {
 	enc.end()
 
 	if cmdName == "COPY" {
-		cmd.store = c.Store(numSet, &imap.StoreFlags{
-			Op:     imap.StoreFlagsAdd,
-			Silent: true,
-			Flags:  []imap.Flag{imap.FlagDeleted},
-		}, nil)
-		if uidSet, ok := numSet.(imap.UIDSet); ok && c.Caps().Has(imap.CapUIDPlus) {
-			cmd.expunge = c.UIDExpunge(uidSet)
-		} else {
-			cmd.expunge = c.Expunge()
-		}
+		cmd.fallbackDone = make(chan struct{})
+		go cmd.fallback(c, numSet, mailbox)
 	}
 
 	return cmd
 }
 
+// UIDMove is like Move, but the messages are identified by their UIDs.
+func (c *Client) UIDMove(uids imap.UIDSet, mailbox string) *MoveCommand {
+	return c.Move(uids, mailbox)
+}
+
 // MoveCommand is a MOVE command.
 type MoveCommand struct {
 	commandBase
 	data MoveData
 
-	// Fallback
-	store   *FetchCommand
-	expunge *ExpungeCommand
+	// Fallback, closed once the COPY + STORE + EXPUNGE sequence is over
+	fallbackDone chan struct{}
+	fallbackErr  error
 }
 
-func (cmd *MoveCommand) Wait() (*MoveData, error) {
+// fallback removes the messages from the selected mailbox once the COPY
+// command has completed: [UID] STORE +FLAGS.SILENT \Deleted, then
+// [UID] EXPUNGE.
+func (cmd *MoveCommand) fallback(c *Client, numSet imap.NumSet, mailbox string) {
+	defer close(cmd.fallbackDone)
+
 	if err := cmd.wait(); err != nil {
-		return nil, err
+		cmd.fallbackErr = err
+		return
 	}
-	if cmd.store != nil {
-		if err := cmd.store.Close(); err != nil {
-			return nil, err
+
+	err := c.Store(numSet, &imap.StoreFlags{
+		Op:     imap.StoreFlagsAdd,
+		Silent: true,
+		Flags:  []imap.Flag{imap.FlagDeleted},
+	}, nil).Close()
+	if err != nil {
+		cmd.fallbackErr = moveNotRemovedError(mailbox, err)
+		return
+	}
+
+	// Prefer the source UIDs returned by COPYUID, they only contain the
+	// messages which have actually been copied
+	var expunge *ExpungeCommand
+	if c.Caps().Has(imap.CapUIDPlus) {
+		if uids, ok := cmd.data.SourceUIDs.(imap.UIDSet); ok && len(uids) > 0 {
+			expunge = c.UIDExpunge(uids)
+		} else if uids, ok := numSet.(imap.UIDSet); ok {
+			expunge = c.UIDExpunge(uids)
 		}
 	}
-	if cmd.expunge != nil {
-		if err := cmd.expunge.Close(); err != nil {
-			return nil, err
+	if expunge == nil {
+		expunge = c.Expunge()
+	}
+	if err := expunge.Close(); err != nil {
+		cmd.fallbackErr = moveNotRemovedError(mailbox, err)
+	}
+}
+
+func moveNotRemovedError(mailbox string, err error) error {
+	return fmt.Errorf("imapclient: messages copied to %q but not removed from the selected mailbox: %w", mailbox, err)
+}
+
+func (cmd *MoveCommand) Wait() (*MoveData, error) {
+	if cmd.fallbackDone != nil {
+		// The fallback goroutine waits for the COPY command
+		<-cmd.fallbackDone
+		if cmd.fallbackErr != nil {
+			return nil, cmd.fallbackErr
 		}
+		return &cmd.data, nil
+	}
+	if err := cmd.wait(); err != nil {
+		return nil, err
 	}
 	return &cmd.data, nil
 }
 
+// WaitContext is like Wait, but closes the connection if ctx is done before
+// the command has completed. See Client.WatchContext.
+func (cmd *MoveCommand) WaitContext(ctx context.Context) (*MoveData, error) {
+	defer cmd.watchContext(ctx)()
+	return cmd.Wait()
+}
+
 // MoveData contains the data returned by a MOVE command.
 type MoveData struct {
 	// requires UIDPLUS or IMAP4rev2
@@ -72,3 +130,12 @@ type MoveData struct {
 	SourceUIDs  imap.NumSet
 	DestUIDs    imap.NumSet
 }
+
+// WalkUIDs calls f for each pair of source and destination UIDs, in order. If
+// f returns false, WalkUIDs stops.
+func (data *MoveData) WalkUIDs(f func(source, dest imap.UID) bool) {
+	sourceUIDs, _ := data.SourceUIDs.(imap.UIDSet)
+	destUIDs, _ := data.DestUIDs.(imap.UIDSet)
+	copyData := imap.CopyData{SourceUIDs: sourceUIDs, DestUIDs: destUIDs}
+	copyData.WalkUIDs(f)
+}
@@ -0,0 +1,189 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+// noMoveConn hides the MOVE capability advertised by the server.
+type noMoveConn struct {
+	net.Conn
+	br      *bufio.Reader
+	pending string
+}
+
+func (conn *noMoveConn) Read(b []byte) (int, error) {
+	if conn.pending == "" {
+		line, err := conn.br.ReadString('\n')
+		if line == "" {
+			return 0, err
+		}
+		if strings.Contains(line, "CAPABILITY") {
+			line = strings.Replace(line, " MOVE", "", 1)
+		}
+		conn.pending = line
+	}
+	n := copy(b, conn.pending)
+	conn.pending = conn.pending[n:]
+	return n, nil
+}
+
+func TestClient_Move_fallback(t *testing.T) {
+	tests := []struct {
+		name        string
+		caps        imap.CapSet
+		wantExpunge string
+	}{
+		{"UIDPLUS", imap.CapSet{imap.CapUIDPlus: {}}, " UID EXPUNGE 1:2\r\n"},
+		{"none", imap.CapSet{}, " EXPUNGE\r\n"},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			testMoveFallback(t, tc.caps, tc.wantExpunge)
+		})
+	}
+}
+
+func testMoveFallback(t *testing.T, extraCaps imap.CapSet, wantExpunge string) {
+	memServer := imapmemserver.New()
+	user := imapmemserver.NewUser(testUsername, testPassword)
+	user.Create("INBOX", nil)
+	user.Create("Archive", nil)
+	memServer.AddUser(user)
+
+	caps := imap.CapSet{imap.CapIMAP4rev1: {}}
+	for c := range extraCaps {
+		caps[c] = struct{}{}
+	}
+	server := imapserver.New(&imapserver.Options{
+		NewSession: func(conn *imapserver.Conn) (imapserver.Session, *imapserver.GreetingData, error) {
+			return memServer.NewSession(), nil, nil
+		},
+		InsecureAuth: true,
+		Caps:         caps,
+	})
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("net.Listen() = %v", err)
+	}
+	go server.Serve(ln)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("net.Dial() = %v", err)
+	}
+	var debug lockedBuffer
+	client := imapclient.New(&noMoveConn{Conn: conn, br: bufio.NewReader(conn)}, &imapclient.Options{
+		DebugWriter: &debug,
+	})
+	defer client.Close()
+
+	if err := client.Login(testUsername, testPassword).Wait(); err != nil {
+		t.Fatalf("Login().Wait() = %v", err)
+	}
+	if client.Caps().Has(imap.CapMove) {
+		t.Fatalf("MOVE capability hasn't been stripped")
+	}
+	for i := 0; i < 3; i++ {
+		appendTestMessage(t, client)
+	}
+	if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select().Wait() = %v", err)
+	}
+
+	// Flag the last message as deleted: a plain EXPUNGE removes it as well
+	storeFlags := imap.StoreFlags{
+		Op:     imap.StoreFlagsAdd,
+		Silent: true,
+		Flags:  []imap.Flag{imap.FlagDeleted},
+	}
+	if err := client.Store(imap.SeqSetNum(3), &storeFlags, nil).Close(); err != nil {
+		t.Fatalf("Store().Close() = %v", err)
+	}
+
+	data, err := client.Move(imap.SeqSetNum(1, 2), "Archive").Wait()
+	if err != nil {
+		t.Fatalf("Move().Wait() = %v", err)
+	}
+
+	wire := debug.String()
+	wantSeq := []string{
+		" COPY 1:2 \"Archive\"\r\n",
+		" STORE 1:2 +FLAGS.SILENT (\\Deleted)\r\n",
+		wantExpunge,
+	}
+	i := 0
+	for _, want := range wantSeq {
+		j := strings.Index(wire[i:], want)
+		if j < 0 {
+			t.Fatalf("%q not found in order on the wire:\n%v", want, wire)
+		}
+		i += j + len(want)
+	}
+	if strings.Contains(wire, " MOVE ") {
+		t.Errorf("MOVE command sent despite missing capability")
+	}
+
+	if _, ok := extraCaps[imap.CapUIDPlus]; ok && (data.UIDValidity == 0 || data.DestUIDs == nil) {
+		t.Errorf("Move().Wait() = %#v, want COPYUID data", data)
+	}
+
+	status, err := client.Status("Archive", &imap.StatusOptions{NumMessages: true}).Wait()
+	if err != nil {
+		t.Fatalf("Status().Wait() = %v", err)
+	} else if *status.NumMessages != 2 {
+		t.Errorf("Archive has %v messages, want 2", *status.NumMessages)
+	}
+}
+
+func TestClient_Move_fallbackPartialFailure(t *testing.T) {
+	commands := make(chan string, 3)
+	greeting := "* OK [CAPABILITY IMAP4rev1 UIDPLUS] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		// COPY fails: nothing else is sent
+		tag, args := readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, tag+" NO [TRYCREATE] No such mailbox\r\n")
+
+		tag, args = readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, tag+" OK [COPYUID 1 4 8] COPY completed\r\n")
+		tag, args = readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, tag+" NO Permission denied\r\n")
+	})
+
+	if _, err := client.Move(imap.SeqSetNum(1), "Nonexistent").Wait(); err == nil {
+		t.Errorf("Move().Wait() = nil, want an error")
+	} else if strings.Contains(err.Error(), "not removed") {
+		t.Errorf("Move().Wait() = %v, want the COPY error", err)
+	}
+	if cmd := <-commands; !strings.HasPrefix(cmd, "COPY ") {
+		t.Errorf("command = %q, want COPY", cmd)
+	}
+
+	_, err := client.Move(imap.SeqSetNum(1), "Archive").Wait()
+	var imapErr *imap.Error
+	if err == nil || !strings.Contains(err.Error(), "not removed") {
+		t.Errorf("Move().Wait() = %v, want an error about messages not removed", err)
+	} else if !errors.As(err, &imapErr) {
+		t.Errorf("Move().Wait() = %v, want a wrapped *imap.Error", err)
+	}
+	if cmd := <-commands; !strings.HasPrefix(cmd, "COPY ") {
+		t.Errorf("command = %q, want COPY", cmd)
+	}
+	if cmd := <-commands; !strings.HasPrefix(cmd, "STORE ") {
+		t.Errorf("command = %q, want STORE", cmd)
+	}
+}
@@ -85,7 +85,7 @@ func readNamespace(dec *imapwire.Decoder) ([]imap.NamespaceDescriptor, error) {
 func readNamespaceDescr(dec *imapwire.Decoder) (*imap.NamespaceDescriptor, error) {
 	var descr imap.NamespaceDescriptor
 
-	if !dec.ExpectSpecial('(') || !dec.ExpectString(&descr.Prefix) || !dec.ExpectSP() {
+	if !dec.ExpectSpecial('(') || !dec.ExpectMailbox(&descr.Prefix) || !dec.ExpectSP() {
 		return nil, dec.Err()
 	}
 
@@ -95,11 +95,24 @@ func readNamespaceDescr(dec *imapwire.Decoder) (*imap.NamespaceDescriptor, error
 		return nil, err
 	}
 
-	// Skip namespace-response-extensions
 	for dec.SP() {
-		if !dec.DiscardValue() {
-			return nil, dec.Err()
+		var name string
+		if !dec.String(&name) {
+			// Unknown extension data
+			if !dec.DiscardValue() {
+				return nil, dec.Err()
+			}
+			continue
+		}
+
+		values, err := readNamespaceExtensionValues(dec)
+		if err != nil {
+			return nil, fmt.Errorf("in namespace-response-extension: %v", err)
 		}
+		descr.Extensions = append(descr.Extensions, imap.NamespaceExtension{
+			Name:   name,
+			Values: values,
+		})
 	}
 
 	if !dec.ExpectSpecial(')') {
@@ -108,3 +121,28 @@ func readNamespaceDescr(dec *imapwire.Decoder) (*imap.NamespaceDescriptor, error
 
 	return &descr, nil
 }
+
+func readNamespaceExtensionValues(dec *imapwire.Decoder) ([]string, error) {
+	if !dec.ExpectSP() {
+		return nil, dec.Err()
+	}
+
+	var values []string
+	isList, err := dec.List(func() error {
+		var v string
+		if !dec.ExpectString(&v) {
+			return dec.Err()
+		}
+		values = append(values, v)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	} else if !isList {
+		// Not a list of strings as specified by the RFC, ignore the value
+		if !dec.DiscardValue() {
+			return nil, dec.Err()
+		}
+	}
+	return values, nil
+}
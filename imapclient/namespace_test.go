@@ -0,0 +1,168 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+func TestClient_Namespace(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     imap.NamespaceData
+	}{
+		{
+			name:     "shared only",
+			response: `* NAMESPACE NIL NIL (("" "."))`,
+			want: imap.NamespaceData{
+				Shared: []imap.NamespaceDescriptor{{Prefix: "", Delim: '.'}},
+			},
+		},
+		{
+			name:     "multiple shared",
+			response: `* NAMESPACE (("" "/")) (("~" "/")) (("#shared/" "/")("#public/" "/")("#ftp/" "/")("#news." "."))`,
+			want: imap.NamespaceData{
+				Personal: []imap.NamespaceDescriptor{{Prefix: "", Delim: '/'}},
+				Other:    []imap.NamespaceDescriptor{{Prefix: "~", Delim: '/'}},
+				Shared: []imap.NamespaceDescriptor{
+					{Prefix: "#shared/", Delim: '/'},
+					{Prefix: "#public/", Delim: '/'},
+					{Prefix: "#ftp/", Delim: '/'},
+					{Prefix: "#news.", Delim: '.'},
+				},
+			},
+		},
+		{
+			name:     "extension",
+			response: `* NAMESPACE (("" "/")("#mh/" "/" "X-PARAM" ("FLAG1" "FLAG2"))) NIL NIL`,
+			want: imap.NamespaceData{
+				Personal: []imap.NamespaceDescriptor{
+					{Prefix: "", Delim: '/'},
+					{
+						Prefix: "#mh/",
+						Delim:  '/',
+						Extensions: []imap.NamespaceExtension{
+							{Name: "X-PARAM", Values: []string{"FLAG1", "FLAG2"}},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:     "backslash and NIL delimiters",
+			response: `* NAMESPACE (("INBOX\\" "\\")) (("Other Users" NIL)) NIL`,
+			want: imap.NamespaceData{
+				Personal: []imap.NamespaceDescriptor{{Prefix: `INBOX\`, Delim: '\\'}},
+				Other:    []imap.NamespaceDescriptor{{Prefix: "Other Users", Delim: 0}},
+			},
+		},
+		{
+			name:     "non-standard extension",
+			response: `* NAMESPACE (("" "/" X-UNKNOWN 42 "X-NOLIST" "value")) NIL NIL`,
+			want: imap.NamespaceData{
+				Personal: []imap.NamespaceDescriptor{{
+					Prefix:     "",
+					Delim:      '/',
+					Extensions: []imap.NamespaceExtension{{Name: "X-NOLIST"}},
+				}},
+			},
+		},
+	}
+
+	greeting := "* OK [CAPABILITY IMAP4rev1 NAMESPACE] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		for _, tc := range tests {
+			fields := readScriptLine(t, br)
+			if len(fields) != 2 || fields[1] != "NAMESPACE" {
+				t.Errorf("got command %q, want NAMESPACE", fields)
+				return
+			}
+			io.WriteString(w, tc.response+"\r\n"+fields[0]+" OK NAMESPACE completed\r\n")
+		}
+	})
+
+	for _, tc := range tests {
+		data, err := client.Namespace().Wait()
+		if err != nil {
+			t.Fatalf("%v: Namespace().Wait() = %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(data, &tc.want) {
+			t.Errorf("%v: Namespace().Wait() = %#v, want %#v", tc.name, data, &tc.want)
+		}
+	}
+
+	data := imap.NamespaceData{Personal: []imap.NamespaceDescriptor{{Prefix: "INBOX.", Delim: '.'}}}
+	if prefix := data.PersonalPrefix(); prefix != "INBOX." {
+		t.Errorf("PersonalPrefix() = %q, want %q", prefix, "INBOX.")
+	}
+	if prefix := (&imap.NamespaceData{}).PersonalPrefix(); prefix != "" {
+		t.Errorf("PersonalPrefix() = %q, want empty", prefix)
+	}
+}
+
+func TestNamespaceData_MatchPrefix(t *testing.T) {
+	// Cyrus-style configuration
+	data := imap.NamespaceData{
+		Personal: []imap.NamespaceDescriptor{{Prefix: "", Delim: '/'}},
+		Other:    []imap.NamespaceDescriptor{{Prefix: "Other Users/", Delim: '/'}},
+		Shared:   []imap.NamespaceDescriptor{{Prefix: "Shared Folders/", Delim: '/'}},
+	}
+
+	tests := []struct {
+		mailbox string
+		want    *imap.NamespaceDescriptor
+	}{
+		{"INBOX", &data.Personal[0]},
+		{"INBOX/Sent", &data.Personal[0]},
+		{"Archive", &data.Personal[0]},
+		{"Other Users/alice/INBOX", &data.Other[0]},
+		{"Other Users", &data.Other[0]},
+		{"Other UsersX", &data.Personal[0]},
+		{"Shared Folders/Sales", &data.Shared[0]},
+		{"Shared Folders", &data.Shared[0]},
+	}
+	for _, tc := range tests {
+		if descr, ok := data.MatchPrefix(tc.mailbox); !ok || descr != tc.want {
+			t.Errorf("MatchPrefix(%q) = %+v, %v, want %+v", tc.mailbox, descr, ok, tc.want)
+		}
+	}
+
+	noPersonal := imap.NamespaceData{Shared: data.Shared}
+	if descr, ok := noPersonal.MatchPrefix("INBOX"); ok {
+		t.Errorf("MatchPrefix(INBOX) = %+v, want no match", descr)
+	}
+}
+
+func TestNamespaceDescriptor_Join(t *testing.T) {
+	tests := []struct {
+		descr imap.NamespaceDescriptor
+		name  string
+		want  string
+	}{
+		{imap.NamespaceDescriptor{Prefix: "", Delim: '/'}, "Archive", "Archive"},
+		{imap.NamespaceDescriptor{Prefix: "Shared Folders/", Delim: '/'}, "Sales", "Shared Folders/Sales"},
+		{imap.NamespaceDescriptor{Prefix: "INBOX", Delim: '.'}, "Sent", "INBOX.Sent"},
+		{imap.NamespaceDescriptor{Prefix: "#news", Delim: 0}, "comp", "#newscomp"},
+	}
+	for _, tc := range tests {
+		if got := tc.descr.Join(tc.name); got != tc.want {
+			t.Errorf("NamespaceDescriptor{%q, %q}.Join(%q) = %q, want %q", tc.descr.Prefix, tc.descr.Delim, tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestNamespaceDescriptor_Extension(t *testing.T) {
+	descr := imap.NamespaceDescriptor{
+		Extensions: []imap.NamespaceExtension{{Name: "X-PARAM", Values: []string{"FLAG1"}}},
+	}
+	if values, ok := descr.Extension("x-param"); !ok || !reflect.DeepEqual(values, []string{"FLAG1"}) {
+		t.Errorf("Extension(x-param) = %v, %v, want [FLAG1]", values, ok)
+	}
+	if _, ok := descr.Extension("X-OTHER"); ok {
+		t.Errorf("Extension(X-OTHER) succeeded")
+	}
+}
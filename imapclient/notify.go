@@ -0,0 +1,153 @@
+package imapclient
+
+import (
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+// Notify sends a NOTIFY SET command.
+//
+// Updates are delivered to the handlers registered with
+// Client.SetNotifyHandler. If the server doesn't support some of the requested
+// events, the command fails with an *imap.Error with the BADEVENT response
+// code, and the unsupported events are available as a []imap.NotifyEvent
+// response code argument.
+//
+// This command requires support for the NOTIFY extension.
+func (c *Client) Notify(filter *imap.NotifyFilter) *Command {
+	if err := c.checkCap(imap.CapNotify); err != nil {
+		return &Command{commandBase: failedCommandBase(err)}
+	}
+
+	cmd := &Command{}
+	enc := c.beginCommand("NOTIFY", cmd)
+	enc.SP().Atom("SET")
+	if filter.Status {
+		enc.SP().Atom("STATUS")
+	}
+	for _, group := range filter.Groups {
+		enc.SP()
+		writeNotifyGroup(enc.Encoder, &group)
+	}
+	enc.end()
+	return cmd
+}
+
+// NotifyNone sends a NOTIFY NONE command, which stops all notifications.
+//
+// This command requires support for the NOTIFY extension.
+func (c *Client) NotifyNone() *Command {
+	if err := c.checkCap(imap.CapNotify); err != nil {
+		return &Command{commandBase: failedCommandBase(err)}
+	}
+
+	cmd := &Command{}
+	enc := c.beginCommand("NOTIFY", cmd)
+	enc.SP().Atom("NONE")
+	enc.end()
+	return cmd
+}
+
+func writeNotifyGroup(enc *imapwire.Encoder, group *imap.NotifyGroup) {
+	enc.Special('(').Atom(string(group.Kind))
+	switch group.Kind {
+	case imap.NotifyMailboxesSubtree, imap.NotifyMailboxesMailboxes:
+		enc.SP().List(len(group.Mailboxes), func(i int) {
+			enc.Mailbox(group.Mailboxes[i])
+		})
+	}
+	enc.SP()
+	if len(group.Events) == 0 {
+		enc.Atom("NONE")
+	} else {
+		enc.List(len(group.Events), func(i int) {
+			ev := group.Events[i]
+			enc.Atom(string(ev))
+			if ev == imap.NotifyEventMessageNew && group.MessageNewFetch != nil {
+				enc.SP()
+				writeFetchItems(enc, imapwire.NumKindSeq, group.MessageNewFetch)
+			}
+		})
+	}
+	enc.Special(')')
+}
+
+func readNotifyEventList(dec *imapwire.Decoder) ([]imap.NotifyEvent, error) {
+	var events []imap.NotifyEvent
+	err := dec.ExpectList(func() error {
+		var ev string
+		if !dec.ExpectAtom(&ev) {
+			return dec.Err()
+		}
+		events = append(events, imap.NotifyEvent(ev))
+		return nil
+	})
+	return events, err
+}
+
+// NotifyHandler handles updates for a mailbox.
+//
+// Since NOTIFY delivers updates for mailboxes which aren't selected, these
+// are dispatched according to the mailbox they refer to: STATUS and LIST
+// responses carry a mailbox name, FETCH and EXPUNGE responses refer to the
+// selected mailbox.
+//
+// Status, List and Expunge are called from the goroutine reading responses,
+// they must not block. Fetch is called from a separate goroutine.
+type NotifyHandler struct {
+	Status  func(data *imap.StatusData)
+	List    func(data *imap.ListData)
+	Fetch   func(msg *FetchMessageData)
+	Expunge func(seqNum uint32)
+}
+
+// SetNotifyHandler registers a handler for unsolicited updates about a
+// mailbox.
+//
+// If mailbox is empty, the handler is used for mailboxes without a handler.
+// If handler is nil, the handler for the mailbox is unregistered.
+//
+// Handlers take precedence over UnilateralDataHandler and Idler for FETCH
+// responses.
+func (c *Client) SetNotifyHandler(mailbox string, handler *NotifyHandler) {
+	mailbox = notifyHandlerKey(mailbox)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if handler == nil {
+		delete(c.notifyHandlers, mailbox)
+		return
+	}
+	if c.notifyHandlers == nil {
+		c.notifyHandlers = make(map[string]*NotifyHandler)
+	}
+	c.notifyHandlers[mailbox] = handler
+}
+
+// notifyHandler returns the handler for a mailbox, or nil. If mailbox is
+// empty, the selected mailbox is used.
+func (c *Client) notifyHandler(mailbox string) *NotifyHandler {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if mailbox == "" {
+		if c.state != imap.ConnStateSelected {
+			return nil
+		}
+		mailbox = c.mailbox.Name
+	}
+	if h := c.notifyHandlers[notifyHandlerKey(mailbox)]; h != nil {
+		return h
+	}
+	return c.notifyHandlers[""]
+}
+
+func notifyHandlerKey(mailbox string) string {
+	// INBOX is case-insensitive
+	if strings.EqualFold(mailbox, "INBOX") {
+		return "INBOX"
+	}
+	return mailbox
+}
@@ -0,0 +1,226 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+func TestClient_Notify(t *testing.T) {
+	user := imapmemserver.NewUser(testUsername, testPassword)
+	user.Create("INBOX", nil)
+	user.Create("Archive", nil)
+	dial := newCapsTestServer(t, user, imap.CapSet{imap.CapNotify: {}})
+
+	client := dial(nil)
+
+	statusCh := make(chan *imap.StatusData, 1)
+	client.SetNotifyHandler("Archive", &imapclient.NotifyHandler{
+		Status: func(data *imap.StatusData) {
+			statusCh <- data
+		},
+	})
+	if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select().Wait() = %v", err)
+	}
+	err := client.Notify(&imap.NotifyFilter{
+		Groups: []imap.NotifyGroup{{
+			Kind:   imap.NotifyMailboxesPersonal,
+			Events: []imap.NotifyEvent{imap.NotifyEventMessageNew, imap.NotifyEventMessageExpunge},
+		}},
+	}).Wait()
+	if err != nil {
+		t.Fatalf("Notify().Wait() = %v", err)
+	}
+
+	other := dial(nil)
+	appendCmd := other.Append("Archive", int64(len(simpleRawMessage)), nil)
+	appendCmd.Write([]byte(simpleRawMessage))
+	appendCmd.Close()
+	if _, err := appendCmd.Wait(); err != nil {
+		t.Fatalf("Append().Wait() = %v", err)
+	}
+
+	select {
+	case data := <-statusCh:
+		if data.Mailbox != "Archive" {
+			t.Errorf("STATUS mailbox = %q, want %q", data.Mailbox, "Archive")
+		}
+		if data.NumMessages == nil || *data.NumMessages != 1 {
+			t.Errorf("STATUS MESSAGES = %v, want 1", data.NumMessages)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for STATUS update")
+	}
+
+	if err := client.NotifyNone().Wait(); err != nil {
+		t.Fatalf("NotifyNone().Wait() = %v", err)
+	}
+}
+
+func TestClient_Notify_mailboxEvents(t *testing.T) {
+	user := imapmemserver.NewUser(testUsername, testPassword)
+	user.Create("INBOX", nil)
+	dial := newCapsTestServer(t, user, imap.CapSet{imap.CapNotify: {}})
+
+	client := dial(nil)
+
+	listCh := make(chan *imap.ListData, 1)
+	statusCh := make(chan *imap.StatusData, 1)
+	client.SetNotifyHandler("", &imapclient.NotifyHandler{
+		List: func(data *imap.ListData) {
+			listCh <- data
+		},
+		Status: func(data *imap.StatusData) {
+			statusCh <- data
+		},
+	})
+	err := client.Notify(&imap.NotifyFilter{
+		Groups: []imap.NotifyGroup{{
+			Kind: imap.NotifyMailboxesPersonal,
+			Events: []imap.NotifyEvent{
+				imap.NotifyEventMessageNew,
+				imap.NotifyEventMessageExpunge,
+				imap.NotifyEventFlagChange,
+				imap.NotifyEventMailboxName,
+				imap.NotifyEventSubscriptionChange,
+			},
+		}},
+	}).Wait()
+	if err != nil {
+		t.Fatalf("Notify().Wait() = %v", err)
+	}
+
+	nextList := func() *imap.ListData {
+		select {
+		case data := <-listCh:
+			return data
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for LIST update")
+			return nil
+		}
+	}
+	nextStatus := func() *imap.StatusData {
+		select {
+		case data := <-statusCh:
+			return data
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for STATUS update")
+			return nil
+		}
+	}
+	hasAttr := func(data *imap.ListData, attr imap.MailboxAttr) bool {
+		for _, a := range data.Attrs {
+			if a == attr {
+				return true
+			}
+		}
+		return false
+	}
+
+	other := dial(nil)
+
+	if err := other.Create("Drafts", nil).Wait(); err != nil {
+		t.Fatalf("Create().Wait() = %v", err)
+	}
+	if data := nextList(); data.Mailbox != "Drafts" || hasAttr(data, imap.MailboxAttrNonExistent) {
+		t.Errorf("LIST after CREATE = %v", data)
+	}
+
+	if err := other.Subscribe("Drafts").Wait(); err != nil {
+		t.Fatalf("Subscribe().Wait() = %v", err)
+	}
+	if data := nextList(); data.Mailbox != "Drafts" || !hasAttr(data, imap.MailboxAttrSubscribed) {
+		t.Errorf("LIST after SUBSCRIBE = %v", data)
+	}
+
+	if err := other.Rename("Drafts", "Templates").Wait(); err != nil {
+		t.Fatalf("Rename().Wait() = %v", err)
+	}
+	if data := nextList(); data.Mailbox != "Templates" || data.OldName != "Drafts" {
+		t.Errorf("LIST after RENAME = %v", data)
+	}
+
+	appendCmd := other.Append("Templates", int64(len(simpleRawMessage)), nil)
+	appendCmd.Write([]byte(simpleRawMessage))
+	appendCmd.Close()
+	if _, err := appendCmd.Wait(); err != nil {
+		t.Fatalf("Append().Wait() = %v", err)
+	}
+	nextStatus()
+
+	if _, err := other.Select("Templates", nil).Wait(); err != nil {
+		t.Fatalf("Select().Wait() = %v", err)
+	}
+	storeFlags := imap.StoreFlags{
+		Op:     imap.StoreFlagsAdd,
+		Silent: true,
+		Flags:  []imap.Flag{imap.FlagSeen},
+	}
+	if err := other.Store(imap.SeqSetNum(1), &storeFlags, nil).Close(); err != nil {
+		t.Fatalf("Store().Close() = %v", err)
+	}
+	if data := nextStatus(); data.Mailbox != "Templates" || data.NumUnseen == nil || *data.NumUnseen != 0 {
+		t.Errorf("STATUS after STORE = %v", data)
+	}
+	if err := other.Unselect().Wait(); err != nil {
+		t.Fatalf("Unselect().Wait() = %v", err)
+	}
+
+	if err := other.Delete("Templates").Wait(); err != nil {
+		t.Fatalf("Delete().Wait() = %v", err)
+	}
+	if data := nextList(); data.Mailbox != "Templates" || !hasAttr(data, imap.MailboxAttrNonExistent) {
+		t.Errorf("LIST after DELETE = %v", data)
+	}
+}
+
+func TestClient_Notify_badEvent(t *testing.T) {
+	commands := make(chan string, 1)
+	greeting := "* OK [CAPABILITY IMAP4rev1 NOTIFY] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, args := readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, tag+" NO [BADEVENT (MessageNew MessageExpunge FlagChange)] Unsupported event\r\n")
+	})
+
+	err := client.Notify(&imap.NotifyFilter{
+		Status: true,
+		Groups: []imap.NotifyGroup{
+			{
+				Kind:            imap.NotifyMailboxesSelected,
+				Events:          []imap.NotifyEvent{imap.NotifyEventMessageNew, imap.NotifyEventFlagChange},
+				MessageNewFetch: &imap.FetchOptions{UID: true, Flags: true},
+			},
+			{
+				Kind:      imap.NotifyMailboxesMailboxes,
+				Mailboxes: []string{"INBOX", "Sent"},
+			},
+		},
+	}).Wait()
+
+	want := "NOTIFY SET STATUS (SELECTED (MessageNew (UID FLAGS) FlagChange)) (MAILBOXES (INBOX \"Sent\") NONE)"
+	if cmd := <-commands; cmd != want {
+		t.Errorf("command = %q, want %q", cmd, want)
+	}
+
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) {
+		t.Fatalf("Notify().Wait() = %v, want an *imap.Error", err)
+	} else if imapErr.Code != imap.ResponseCodeBadEvent {
+		t.Errorf("response code = %v, want %v", imapErr.Code, imap.ResponseCodeBadEvent)
+	}
+	if len(imapErr.CodeArgs) != 1 {
+		t.Fatalf("response code args = %v, want a single argument", imapErr.CodeArgs)
+	}
+	events, ok := imapErr.CodeArgs[0].([]imap.NotifyEvent)
+	if !ok || len(events) != 3 || events[2] != imap.NotifyEventFlagChange {
+		t.Errorf("unsupported events = %v, want [MessageNew MessageExpunge FlagChange]", imapErr.CodeArgs[0])
+	}
+}
@@ -0,0 +1,113 @@
+package imapclient
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/emersion/go-sasl"
+)
+
+// OAuthError is returned when the server rejects an OAuth token during an
+// OAUTHBEARER or XOAUTH2 exchange.
+//
+// It contains the error details sent by the server, as defined in RFC 7628
+// section 3.2.2.
+type OAuthError struct {
+	Mechanism string `json:"-"`
+
+	Status              string `json:"status"`
+	Schemes             string `json:"schemes,omitempty"`
+	Scope               string `json:"scope,omitempty"`
+	OpenIDConfiguration string `json:"openid-configuration,omitempty"`
+
+	// Err is the error contained in the final server response, if any.
+	Err error `json:"-"`
+}
+
+func (err *OAuthError) Error() string {
+	s := fmt.Sprintf("imapclient: %v authentication failed (status %q)", err.Mechanism, err.Status)
+	if err.Err != nil {
+		s += ": " + err.Err.Error()
+	}
+	return s
+}
+
+func (err *OAuthError) Unwrap() error {
+	return err.Err
+}
+
+// AuthenticateOAuthBearer authenticates with the OAUTHBEARER mechanism, as
+// defined in RFC 7628.
+//
+// The host and port are optional and are sent to the server if non-zero. If
+// the server rejects the token, an *OAuthError is returned.
+func (c *Client) AuthenticateOAuthBearer(username, token string, host string, port int) error {
+	inner := sasl.NewOAuthBearerClient(&sasl.OAuthBearerOptions{
+		Username: username,
+		Token:    token,
+		Host:     host,
+		Port:     port,
+	})
+	_, initialResp, err := inner.Start()
+	if err != nil {
+		return err
+	}
+
+	return c.authenticateOAuth(&oauthClient{
+		mech:        sasl.OAuthBearer,
+		initialResp: initialResp,
+		// RFC 7628 section 3.2.3: the client responds with a single %x01
+		dummyResp: []byte{0x01},
+	})
+}
+
+// AuthenticateXOAuth2 authenticates with the XOAUTH2 mechanism, used by
+// Gmail and Office 365.
+//
+// If the server rejects the token, an *OAuthError is returned.
+func (c *Client) AuthenticateXOAuth2(username, token string) error {
+	initialResp := "user=" + username + "\x01auth=Bearer " + token + "\x01\x01"
+	return c.authenticateOAuth(&oauthClient{
+		mech:        "XOAUTH2",
+		initialResp: []byte(initialResp),
+		dummyResp:   []byte{},
+	})
+}
+
+func (c *Client) authenticateOAuth(saslClient *oauthClient) error {
+	err := c.Authenticate(saslClient)
+	if saslClient.err != nil {
+		saslClient.err.Err = err
+		return saslClient.err
+	}
+	return err
+}
+
+// oauthClient is a SASL client for OAuth mechanisms.
+//
+// When the token is rejected, servers send error details as a challenge and
+// expect a dummy response before failing the command.
+type oauthClient struct {
+	mech        string
+	initialResp []byte
+	dummyResp   []byte
+
+	err *OAuthError
+}
+
+var _ sasl.Client = (*oauthClient)(nil)
+
+func (oc *oauthClient) Start() (mech string, ir []byte, err error) {
+	return oc.mech, oc.initialResp, nil
+}
+
+func (oc *oauthClient) Next(challenge []byte) ([]byte, error) {
+	if oc.err != nil {
+		return nil, fmt.Errorf("imapclient: unexpected %v challenge", oc.mech)
+	}
+
+	// Keep going even if the challenge is malformed, to complete the exchange
+	oc.err = &OAuthError{Mechanism: oc.mech}
+	json.Unmarshal(challenge, oc.err)
+	return oc.dummyResp, nil
+}
@@ -0,0 +1,145 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+// newScriptedClient creates a client connected to a fake server. The script
+// function is called with the server side of the connection after the
+// greeting has been sent.
+func newScriptedClient(t *testing.T, greeting string, script func(br *bufio.Reader, w io.Writer)) *imapclient.Client {
+	return newScriptedClientWithOptions(t, greeting, nil, script)
+}
+
+func newScriptedClientWithOptions(t *testing.T, greeting string, options *imapclient.Options, script func(br *bufio.Reader, w io.Writer)) *imapclient.Client {
+	clientConn, serverConn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer serverConn.Close()
+		io.WriteString(serverConn, greeting+"\r\n")
+		script(bufio.NewReader(serverConn), serverConn)
+		io.Copy(io.Discard, serverConn)
+	}()
+	t.Cleanup(func() {
+		clientConn.Close()
+		<-done
+	})
+	return imapclient.New(clientConn, options)
+}
+
+// readScriptLine reads a line sent by the client, and returns its fields.
+func readScriptLine(t *testing.T, br *bufio.Reader) []string {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		t.Errorf("ReadString() = %v", err)
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(line, "\r\n"), " ")
+}
+
+func decodeScriptSASL(t *testing.T, s string) string {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		t.Errorf("invalid base64 %q: %v", s, err)
+	}
+	return string(b)
+}
+
+const oauthErrorJSON = `{"status":"401","schemes":"bearer","scope":"https://mail.google.com/","openid-configuration":"https://accounts.google.com/.well-known/openid-configuration"}`
+
+func TestClient_AuthenticateOAuthBearer(t *testing.T) {
+	greeting := "* OK [CAPABILITY IMAP4rev1 SASL-IR AUTH=OAUTHBEARER] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		fields := readScriptLine(t, br)
+		if len(fields) != 4 || fields[2] != "OAUTHBEARER" {
+			t.Errorf("got command %q, want AUTHENTICATE OAUTHBEARER with initial response", fields)
+			return
+		}
+		want := "n,a=user@example.org,\x01host=imap.example.org\x01port=993\x01auth=Bearer token\x01\x01"
+		if ir := decodeScriptSASL(t, fields[3]); ir != want {
+			t.Errorf("initial response = %q, want %q", ir, want)
+		}
+		io.WriteString(w, fields[0]+" OK Success\r\n")
+	})
+
+	if err := client.AuthenticateOAuthBearer("user@example.org", "token", "imap.example.org", 993); err != nil {
+		t.Fatalf("AuthenticateOAuthBearer() = %v", err)
+	}
+	if state := client.State(); state != imap.ConnStateAuthenticated {
+		t.Errorf("State() = %v, want %v", state, imap.ConnStateAuthenticated)
+	}
+
+	// The fake server doesn't reply anymore: this must fail locally
+	if err := client.AuthenticateOAuthBearer("user@example.org", "token", "", 0); err == nil {
+		t.Errorf("AuthenticateOAuthBearer() succeeded on an authenticated client")
+	}
+}
+
+func TestClient_AuthenticateOAuthBearer_error(t *testing.T) {
+	greeting := "* OK [CAPABILITY IMAP4rev1 SASL-IR AUTH=OAUTHBEARER] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		fields := readScriptLine(t, br)
+		if len(fields) != 4 {
+			t.Errorf("got command %q, want AUTHENTICATE with initial response", fields)
+			return
+		}
+		io.WriteString(w, "+ "+base64.StdEncoding.EncodeToString([]byte(oauthErrorJSON))+"\r\n")
+		if resp := readScriptLine(t, br); len(resp) != 1 || decodeScriptSASL(t, resp[0]) != "\x01" {
+			t.Errorf("got response %q, want %%x01", resp)
+		}
+		io.WriteString(w, fields[0]+" NO [AUTHENTICATIONFAILED] Invalid credentials\r\n")
+	})
+
+	err := client.AuthenticateOAuthBearer("user@example.org", "token", "", 0)
+	checkOAuthError(t, err, "OAUTHBEARER")
+}
+
+func TestClient_AuthenticateXOAuth2_error(t *testing.T) {
+	// No SASL-IR: the initial response is sent after an empty challenge
+	greeting := "* OK [CAPABILITY IMAP4rev1 AUTH=XOAUTH2] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		fields := readScriptLine(t, br)
+		if len(fields) != 3 || fields[2] != "XOAUTH2" {
+			t.Errorf("got command %q, want AUTHENTICATE XOAUTH2 without initial response", fields)
+			return
+		}
+		io.WriteString(w, "+ \r\n")
+		want := "user=user@example.org\x01auth=Bearer token\x01\x01"
+		if resp := readScriptLine(t, br); len(resp) != 1 || decodeScriptSASL(t, resp[0]) != want {
+			t.Errorf("got initial response %q, want %q", resp, want)
+		}
+		io.WriteString(w, "+ "+base64.StdEncoding.EncodeToString([]byte(oauthErrorJSON))+"\r\n")
+		if resp := readScriptLine(t, br); len(resp) != 1 || resp[0] != "" {
+			t.Errorf("got response %q, want an empty line", resp)
+		}
+		io.WriteString(w, fields[0]+" NO [AUTHENTICATIONFAILED] Invalid credentials\r\n")
+	})
+
+	err := client.AuthenticateXOAuth2("user@example.org", "token")
+	checkOAuthError(t, err, "XOAUTH2")
+}
+
+func checkOAuthError(t *testing.T, err error, mech string) {
+	var oauthErr *imapclient.OAuthError
+	if !errors.As(err, &oauthErr) {
+		t.Fatalf("got error %v, want an OAuthError", err)
+	}
+	if oauthErr.Mechanism != mech || oauthErr.Status != "401" || oauthErr.Scope != "https://mail.google.com/" || oauthErr.OpenIDConfiguration != "https://accounts.google.com/.well-known/openid-configuration" {
+		t.Errorf("got OAuthError %+v", oauthErr)
+	}
+
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeAuthenticationFailed {
+		t.Errorf("got error %v, want an AUTHENTICATIONFAILED imap.Error", err)
+	}
+}
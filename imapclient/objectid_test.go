@@ -0,0 +1,136 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+func TestClient_objectID(t *testing.T) {
+	const (
+		emailID   = "M6d99aC3275bb4e"
+		threadID  = "T64b478a75b7ea9"
+		inboxID   = "F2212ea87-6097-4256-9d51-71338625"
+		archiveID = "Fa4b7c1ee-Archive"
+	)
+
+	commands := make(chan string, 16)
+	greeting := "* OK [CAPABILITY IMAP4rev1 OBJECTID UIDPLUS] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		for i := 0; i < 9; i++ {
+			tag, args := readScriptTaggedCommand(t, br, w)
+			commands <- args
+
+			var resp string
+			switch {
+			case strings.HasPrefix(args, "CREATE "):
+				resp = tag + " OK [MAILBOXID (" + archiveID + ")] Completed\r\n"
+			case args == "SELECT INBOX":
+				resp = "* OK [MAILBOXID (" + inboxID + ")] Ok\r\n" +
+					"* 1 EXISTS\r\n" +
+					tag + " OK [READ-WRITE] Completed\r\n"
+			case args == `SELECT "Archive"`:
+				resp = "* OK [MAILBOXID (" + archiveID + ")] Ok\r\n" +
+					"* 1 EXISTS\r\n" +
+					tag + " OK [READ-WRITE] Completed\r\n"
+			case strings.HasPrefix(args, "UID FETCH 1 "):
+				resp = "* 1 FETCH (UID 1 EMAILID (" + emailID + ") THREADID (" + threadID + "))\r\n" +
+					tag + " OK Completed\r\n"
+			case strings.HasPrefix(args, "UID COPY "):
+				resp = tag + " OK [COPYUID 1 1 7] Completed\r\n"
+			case strings.HasPrefix(args, "UID FETCH 7 "):
+				resp = "* 1 FETCH (UID 7 EMAILID (" + emailID + ") THREADID NIL)\r\n" +
+					tag + " OK Completed\r\n"
+			case strings.HasPrefix(args, "RENAME "):
+				resp = tag + " OK Completed\r\n"
+			case strings.HasPrefix(args, "STATUS "):
+				resp = "* STATUS Old (MAILBOXID (" + archiveID + "))\r\n" +
+					tag + " OK Completed\r\n"
+			case strings.HasPrefix(args, "UID SEARCH "):
+				resp = "* SEARCH 7\r\n" + tag + " OK Completed\r\n"
+			default:
+				resp = tag + " BAD Unexpected command\r\n"
+			}
+			io.WriteString(w, resp)
+		}
+	})
+
+	createCmd := client.CreateWithID("Archive", nil)
+	if err := createCmd.Wait(); err != nil {
+		t.Fatalf("CreateWithID().Wait() = %v", err)
+	} else if id := createCmd.MailboxID(); id != archiveID {
+		t.Errorf("CreateCommand.MailboxID() = %q, want %q", id, archiveID)
+	}
+
+	selectData, err := client.Select("INBOX", nil).Wait()
+	if err != nil {
+		t.Fatalf("Select().Wait() = %v", err)
+	} else if selectData.MailboxID != inboxID {
+		t.Errorf("SelectData.MailboxID = %q, want %q", selectData.MailboxID, inboxID)
+	}
+
+	fetchOptions := &imap.FetchOptions{EmailID: true, ThreadID: true}
+	before, err := client.Fetch(imap.UIDSetNum(1), fetchOptions).Collect()
+	if err != nil {
+		t.Fatalf("Fetch().Collect() = %v", err)
+	} else if len(before) != 1 {
+		t.Fatalf("len(msgs) = %v, want 1", len(before))
+	}
+	if before[0].EmailID != emailID || before[0].ThreadID != threadID {
+		t.Errorf("EMAILID, THREADID = %q, %q, want %q, %q", before[0].EmailID, before[0].ThreadID, emailID, threadID)
+	}
+
+	copyData, err := client.Copy(imap.UIDSetNum(1), "Archive").Wait()
+	if err != nil {
+		t.Fatalf("Copy().Wait() = %v", err)
+	}
+	if _, err := client.Select("Archive", nil).Wait(); err != nil {
+		t.Fatalf("Select().Wait() = %v", err)
+	}
+	after, err := client.Fetch(copyData.DestUIDs, fetchOptions).Collect()
+	if err != nil {
+		t.Fatalf("Fetch().Collect() = %v", err)
+	} else if len(after) != 1 {
+		t.Fatalf("len(msgs) = %v, want 1", len(after))
+	}
+	// The EMAILID is preserved by COPY
+	if after[0].EmailID != before[0].EmailID {
+		t.Errorf("EMAILID after COPY = %q, want %q", after[0].EmailID, before[0].EmailID)
+	}
+	if after[0].ThreadID != "" {
+		t.Errorf("THREADID = %q, want empty for NIL", after[0].ThreadID)
+	}
+
+	// The MAILBOXID is preserved by RENAME
+	if err := client.Rename("Archive", "Old").Wait(); err != nil {
+		t.Fatalf("Rename().Wait() = %v", err)
+	}
+	statusData, err := client.Status("Old", &imap.StatusOptions{MailboxID: true}).Wait()
+	if err != nil {
+		t.Fatalf("Status().Wait() = %v", err)
+	} else if statusData.MailboxID != archiveID {
+		t.Errorf("StatusData.MailboxID = %q, want %q", statusData.MailboxID, archiveID)
+	}
+
+	criteria := &imap.SearchCriteria{EmailID: []string{emailID}}
+	searchData, err := client.UIDSearch(criteria, nil).Wait()
+	if err != nil {
+		t.Fatalf("UIDSearch().Wait() = %v", err)
+	} else if uids, _ := searchData.AllUIDs(); len(uids) != 1 || uids[0] != 7 {
+		t.Errorf("UIDSearch() = %v, want [7]", uids)
+	}
+
+	close(commands)
+	var searchCmd string
+	for cmd := range commands {
+		if strings.HasPrefix(cmd, "UID SEARCH ") {
+			searchCmd = cmd
+		}
+	}
+	if want := "UID SEARCH EMAILID " + emailID; searchCmd != want {
+		t.Errorf("search command = %q, want %q", searchCmd, want)
+	}
+}
@@ -0,0 +1,106 @@
+package imapclient
+
+import (
+	"sort"
+)
+
+// CommandPriority is the priority of commands waiting to be sent to the
+// server, see Options.MaxPipelinedCommands.
+type CommandPriority int
+
+const (
+	PriorityLow    CommandPriority = -1
+	PriorityNormal CommandPriority = 0
+	PriorityHigh   CommandPriority = 1
+)
+
+// WithPriority returns a Client sending commands with the specified priority.
+//
+// The returned Client shares its connection and state with c. Priorities only
+// have an effect when Options.MaxPipelinedCommands is set: commands waiting
+// for a free slot are sent in priority order. Commands already sent to the
+// server are never reordered.
+func (c *Client) WithPriority(priority CommandPriority) *Client {
+	return &Client{clientState: c.clientState, priority: priority}
+}
+
+// pipelineWaiter is a command waiting for a pipeline slot.
+type pipelineWaiter struct {
+	priority CommandPriority
+	barrier  bool
+	ready    chan struct{}
+}
+
+// pipeline limits the number of commands in flight.
+type pipeline struct {
+	inFlight int
+	barrier  bool              // a barrier command is in flight
+	queue    []*pipelineWaiter // sorted by priority, then FIFO
+}
+
+// isPipelineBarrier returns true if a command needs to be the only command in
+// flight. Commands involving continuation requests can't be pipelined safely.
+func isPipelineBarrier(name string) bool {
+	switch name {
+	case "APPEND", "AUTHENTICATE", "IDLE", "REPLACE", "UID REPLACE":
+		return true
+	default:
+		return false
+	}
+}
+
+// acquirePipelineSlot blocks until a command can be sent. It returns false if
+// the number of commands in flight is unlimited, in which case
+// releasePipelineSlot must not be called.
+func (c *Client) acquirePipelineSlot(name string) bool {
+	max := c.options.MaxPipelinedCommands
+	if max <= 0 {
+		return false
+	}
+
+	w := &pipelineWaiter{
+		priority: c.priority,
+		barrier:  isPipelineBarrier(name),
+		ready:    make(chan struct{}),
+	}
+
+	c.mutex.Lock()
+	p := &c.pipeline
+	i := sort.Search(len(p.queue), func(i int) bool {
+		return p.queue[i].priority < w.priority
+	})
+	p.queue = append(p.queue, nil)
+	copy(p.queue[i+1:], p.queue[i:])
+	p.queue[i] = w
+	c.dispatchPipelineLocked()
+	c.mutex.Unlock()
+
+	<-w.ready
+	return true
+}
+
+func (c *Client) releasePipelineSlot() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	p := &c.pipeline
+	p.inFlight--
+	p.barrier = false
+	c.dispatchPipelineLocked()
+}
+
+// dispatchPipelineLocked starts as many queued commands as possible. It must
+// be called with the mutex locked.
+func (c *Client) dispatchPipelineLocked() {
+	p := &c.pipeline
+	for len(p.queue) > 0 && !p.barrier && p.inFlight < c.options.MaxPipelinedCommands {
+		w := p.queue[0]
+		if w.barrier && p.inFlight > 0 {
+			break
+		}
+		p.queue = p.queue[1:]
+		p.inFlight++
+		p.barrier = w.barrier
+		close(w.ready)
+	}
+}
@@ -0,0 +1,124 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestClient_MaxPipelinedCommands(t *testing.T) {
+	received := make(chan string, 3)
+	release := make(chan struct{})
+	greeting := "* OK [CAPABILITY IMAP4rev1] Server ready"
+	client := newScriptedClientWithOptions(t, greeting, &imapclient.Options{
+		MaxPipelinedCommands: 2,
+	}, func(br *bufio.Reader, w io.Writer) {
+		var tags []string
+		for i := 0; i < 2; i++ {
+			tag, args := readScriptTaggedCommand(t, br, w)
+			tags = append(tags, tag)
+			received <- args
+		}
+		<-release
+		io.WriteString(w, tags[0]+" OK NOOP completed\r\n")
+
+		tag, args := readScriptTaggedCommand(t, br, w)
+		tags = append(tags, tag)
+		received <- args
+		for _, tag := range tags[1:] {
+			io.WriteString(w, tag+" OK NOOP completed\r\n")
+		}
+	})
+
+	errCh := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			errCh <- client.Noop().Wait()
+		}()
+	}
+
+	for i := 0; i < 2; i++ {
+		<-received
+	}
+	select {
+	case args := <-received:
+		t.Fatalf("got command %q while the window is full", args)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for the queued command")
+	}
+	for i := 0; i < 3; i++ {
+		if err := <-errCh; err != nil {
+			t.Errorf("Noop().Wait() = %v", err)
+		}
+	}
+}
+
+func TestClient_WithPriority(t *testing.T) {
+	received := make(chan string, 4)
+	release := make(chan struct{})
+	greeting := "* OK [CAPABILITY IMAP4rev1] Server ready"
+	client := newScriptedClientWithOptions(t, greeting, &imapclient.Options{
+		MaxPipelinedCommands: 1,
+	}, func(br *bufio.Reader, w io.Writer) {
+		tag, args := readScriptTaggedCommand(t, br, w)
+		received <- args
+		<-release
+		io.WriteString(w, tag+" OK NOOP completed\r\n")
+
+		for i := 0; i < 3; i++ {
+			tag, args := readScriptTaggedCommand(t, br, w)
+			received <- args
+			io.WriteString(w, tag+" OK completed\r\n")
+		}
+	})
+
+	// This command is sent right away
+	noopCmd := client.Noop()
+
+	errCh := make(chan error, 3)
+	background := client.WithPriority(imapclient.PriorityLow)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := background.UIDSearch(&imap.SearchCriteria{}, nil).Wait()
+			errCh <- err
+		}()
+		time.Sleep(50 * time.Millisecond) // wait for the command to be queued
+	}
+	go func() {
+		foreground := client.WithPriority(imapclient.PriorityHigh)
+		errCh <- foreground.Fetch(imap.SeqSetNum(1), &imap.FetchOptions{Flags: true}).Close()
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	close(release)
+	if err := noopCmd.Wait(); err != nil {
+		t.Fatalf("Noop().Wait() = %v", err)
+	}
+
+	var got []string
+	for i := 0; i < 4; i++ {
+		args := <-received
+		name, _, _ := strings.Cut(args, " ")
+		got = append(got, name)
+	}
+	want := []string{"NOOP", "FETCH", "UID", "UID"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("commands = %v, want %v", got, want)
+	}
+	for i := 0; i < 3; i++ {
+		if err := <-errCh; err != nil {
+			t.Errorf("command failed: %v", err)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package imapclient
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
@@ -9,8 +10,13 @@ import (
 
 // GetQuota sends a GETQUOTA command.
 //
-// This command requires support for the QUOTA extension.
+// This command requires support for the QUOTA extension. If the server doesn't
+// advertise it, the command fails with a *CapabilityError.
 func (c *Client) GetQuota(root string) *GetQuotaCommand {
+	if err := c.checkCap(imap.CapQuota); err != nil {
+		return &GetQuotaCommand{commandBase: failedCommandBase(err)}
+	}
+
 	cmd := &GetQuotaCommand{root: root}
 	enc := c.beginCommand("GETQUOTA", cmd)
 	enc.SP().String(root)
@@ -20,8 +26,13 @@ func (c *Client) GetQuota(root string) *GetQuotaCommand {
 
 // GetQuotaRoot sends a GETQUOTAROOT command.
 //
-// This command requires support for the QUOTA extension.
+// This command requires support for the QUOTA extension. If the server doesn't
+// advertise it, the command fails with a *CapabilityError.
 func (c *Client) GetQuotaRoot(mailbox string) *GetQuotaRootCommand {
+	if err := c.checkCap(imap.CapQuota); err != nil {
+		return &GetQuotaRootCommand{commandBase: failedCommandBase(err)}
+	}
+
 	cmd := &GetQuotaRootCommand{mailbox: mailbox}
 	enc := c.beginCommand("GETQUOTAROOT", cmd)
 	enc.SP().Mailbox(mailbox)
@@ -31,19 +42,28 @@ func (c *Client) GetQuotaRoot(mailbox string) *GetQuotaRootCommand {
 
 // SetQuota sends a SETQUOTA command.
 //
-// This command requires support for the SETQUOTA extension.
+// This command requires support for the QUOTASET extension. If the server
+// doesn't advertise it, the command fails with a *CapabilityError.
 func (c *Client) SetQuota(root string, limits map[imap.QuotaResourceType]int64) *Command {
+	if err := c.checkCap(imap.CapQuotaSet); err != nil {
+		return &Command{commandBase: failedCommandBase(err)}
+	}
+
+	types := make([]string, 0, len(limits))
+	for typ := range limits {
+		types = append(types, string(typ))
+	}
+	sort.Strings(types)
+
 	// TODO: consider returning the QUOTA response data?
 	cmd := &Command{}
 	enc := c.beginCommand("SETQUOTA", cmd)
 	enc.SP().String(root).SP().Special('(')
-	i := 0
-	for typ, limit := range limits {
+	for i, typ := range types {
 		if i > 0 {
 			enc.SP()
 		}
-		enc.Atom(string(typ)).SP().Number64(limit)
-		i++
+		enc.Atom(typ).SP().Number64(limits[imap.QuotaResourceType(typ)])
 	}
 	enc.Special(')')
 	enc.end()
@@ -104,10 +124,10 @@ func (c *Client) handleQuotaRoot() error {
 type GetQuotaCommand struct {
 	commandBase
 	root string
-	data *QuotaData
+	data *imap.QuotaData
 }
 
-func (cmd *GetQuotaCommand) Wait() (*QuotaData, error) {
+func (cmd *GetQuotaCommand) Wait() (*imap.QuotaData, error) {
 	if err := cmd.wait(); err != nil {
 		return nil, err
 	}
@@ -119,43 +139,51 @@ type GetQuotaRootCommand struct {
 	commandBase
 	mailbox string
 	roots   []string
-	data    []QuotaData
+	data    []imap.QuotaData
 }
 
-func (cmd *GetQuotaRootCommand) Wait() ([]QuotaData, error) {
+// Wait blocks until the command has completed, and returns the QUOTA
+// responses sent by the server for the mailbox's quota roots.
+func (cmd *GetQuotaRootCommand) Wait() ([]imap.QuotaData, error) {
 	if err := cmd.wait(); err != nil {
 		return nil, err
 	}
 	return cmd.data, nil
 }
 
-// QuotaData is the data returned by a QUOTA response.
-type QuotaData struct {
-	Root      string
-	Resources map[imap.QuotaResourceType]QuotaResourceData
+// Roots returns the quota roots of the mailbox. It must be called after Wait.
+//
+// Some roots may have no matching QuotaData, if the server hasn't sent any
+// QUOTA response for them.
+func (cmd *GetQuotaRootCommand) Roots() []string {
+	return cmd.roots
 }
 
+// QuotaData is the data returned by a QUOTA response.
+//
+// Deprecated: use imap.QuotaData instead.
+type QuotaData = imap.QuotaData
+
 // QuotaResourceData contains the usage and limit for a quota resource.
-type QuotaResourceData struct {
-	Usage int64
-	Limit int64
-}
+//
+// Deprecated: use imap.QuotaResource instead.
+type QuotaResourceData = imap.QuotaResource
 
-func readQuotaResponse(dec *imapwire.Decoder) (*QuotaData, error) {
-	var data QuotaData
+func readQuotaResponse(dec *imapwire.Decoder) (*imap.QuotaData, error) {
+	var data imap.QuotaData
 	if !dec.ExpectAString(&data.Root) || !dec.ExpectSP() {
 		return nil, dec.Err()
 	}
-	data.Resources = make(map[imap.QuotaResourceType]QuotaResourceData)
+	data.Resources = make(map[imap.QuotaResourceType]imap.QuotaResource)
 	err := dec.ExpectList(func() error {
 		var (
 			name    string
-			resData QuotaResourceData
+			resData imap.QuotaResource
 		)
 		if !dec.ExpectAtom(&name) || !dec.ExpectSP() || !dec.ExpectNumber64(&resData.Usage) || !dec.ExpectSP() || !dec.ExpectNumber64(&resData.Limit) {
 			return fmt.Errorf("in quota-resource: %v", dec.Err())
 		}
-		data.Resources[imap.QuotaResourceType(name)] = resData
+		data.Resources[imap.ParseQuotaResourceType(name)] = resData
 		return nil
 	})
 	return &data, err
@@ -0,0 +1,175 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestClient_Quota(t *testing.T) {
+	commands := make(chan string, 3)
+	greeting := "* OK [CAPABILITY IMAP4rev1 QUOTA QUOTA=RES-STORAGE QUOTASET] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		responses := []string{
+			"* QUOTAROOT INBOX \"\" \"user\"\r\n" +
+				"* QUOTA \"\" (STORAGE 10 512)\r\n" +
+				"* QUOTA \"user\" (X-UNKNOWN 1 2 message 9223372036854775806 9223372036854775807)\r\n",
+			"* QUOTA \"\" (STORAGE 128 512)\r\n",
+			"",
+		}
+		for _, resp := range responses {
+			tag, args := readScriptTaggedCommand(t, br, w)
+			commands <- args
+			io.WriteString(w, resp+tag+" OK Completed\r\n")
+		}
+	})
+
+	getRootCmd := client.GetQuotaRoot("INBOX")
+	data, err := getRootCmd.Wait()
+	if err != nil {
+		t.Fatalf("GetQuotaRoot().Wait() = %v", err)
+	}
+	if cmd := <-commands; cmd != "GETQUOTAROOT INBOX" {
+		t.Errorf("sent %q, want GETQUOTAROOT INBOX", cmd)
+	}
+	if roots := getRootCmd.Roots(); !reflect.DeepEqual(roots, []string{"", "user"}) {
+		t.Errorf("Roots() = %q, want [\"\" \"user\"]", roots)
+	}
+	want := []imap.QuotaData{
+		{
+			Root: "",
+			Resources: map[imap.QuotaResourceType]imap.QuotaResource{
+				imap.QuotaResourceStorage: {Usage: 10, Limit: 512},
+			},
+		},
+		{
+			Root: "user",
+			Resources: map[imap.QuotaResourceType]imap.QuotaResource{
+				"X-UNKNOWN":               {Usage: 1, Limit: 2},
+				imap.QuotaResourceMessage: {Usage: math.MaxInt64 - 1, Limit: math.MaxInt64},
+			},
+		},
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("GetQuotaRoot().Wait() = %+v, want %+v", data, want)
+	}
+
+	quota, err := client.GetQuota("").Wait()
+	if err != nil {
+		t.Fatalf("GetQuota().Wait() = %v", err)
+	}
+	if cmd := <-commands; cmd != `GETQUOTA ""` {
+		t.Errorf("sent %q, want GETQUOTA \"\"", cmd)
+	}
+	if percent, ok := quota.UsagePercent(imap.QuotaResourceStorage); !ok || percent != 25 {
+		t.Errorf("UsagePercent(STORAGE) = %v, %v, want 25", percent, ok)
+	}
+	if _, ok := quota.UsagePercent(imap.QuotaResourceMessage); ok {
+		t.Errorf("UsagePercent(MESSAGE) succeeded for a missing resource")
+	}
+
+	limits := map[imap.QuotaResourceType]int64{
+		imap.QuotaResourceStorage: 1024,
+		imap.QuotaResourceMessage: 100,
+	}
+	if err := client.SetQuota("", limits).Wait(); err != nil {
+		t.Fatalf("SetQuota().Wait() = %v", err)
+	}
+	if cmd, want := <-commands, `SETQUOTA "" (MESSAGE 100 STORAGE 1024)`; cmd != want {
+		t.Errorf("sent %q, want %q", cmd, want)
+	}
+}
+
+func TestClient_Quota_unsupported(t *testing.T) {
+	greeting := "* OK [CAPABILITY IMAP4rev1] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {})
+
+	var capErr *imapclient.CapabilityError
+	if _, err := client.GetQuota("").Wait(); !errors.As(err, &capErr) || capErr.Cap != imap.CapQuota {
+		t.Errorf("GetQuota().Wait() = %v, want CapabilityError for QUOTA", err)
+	}
+	if _, err := client.GetQuotaRoot("INBOX").Wait(); !errors.As(err, &capErr) {
+		t.Errorf("GetQuotaRoot().Wait() = %v, want CapabilityError", err)
+	}
+	if err := client.SetQuota("", nil).Wait(); !errors.As(err, &capErr) {
+		t.Errorf("SetQuota().Wait() = %v, want CapabilityError", err)
+	}
+}
+
+func TestClient_SetQuota_noQuotaSet(t *testing.T) {
+	greeting := "* OK [CAPABILITY IMAP4rev1 QUOTA] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {})
+
+	var capErr *imapclient.CapabilityError
+	if err := client.SetQuota("", nil).Wait(); !errors.As(err, &capErr) || capErr.Cap != imap.CapQuotaSet {
+		t.Errorf("SetQuota().Wait() = %v, want CapabilityError for QUOTASET", err)
+	}
+}
+
+func TestParseQuotaResourceType(t *testing.T) {
+	tests := []struct {
+		in   string
+		want imap.QuotaResourceType
+	}{
+		{"STORAGE", imap.QuotaResourceStorage},
+		{"storage", imap.QuotaResourceStorage},
+		{"Message", imap.QuotaResourceMessage},
+		{"mailbox", imap.QuotaResourceMailbox},
+		{"annotation-storage", imap.QuotaResourceAnnotationStorage},
+		{"X-Unknown", "X-Unknown"},
+	}
+	for _, tc := range tests {
+		if got := imap.ParseQuotaResourceType(tc.in); got != tc.want {
+			t.Errorf("ParseQuotaResourceType(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+
+	caps := imap.CapSet{"QUOTA=RES-storage": {}, "QUOTA=RES-X-Unknown": {}}
+	types := caps.QuotaResourceTypes()
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	if want := []imap.QuotaResourceType{imap.QuotaResourceStorage, "X-Unknown"}; !reflect.DeepEqual(types, want) {
+		t.Errorf("QuotaResourceTypes() = %v, want %v", types, want)
+	}
+}
+
+func TestQuotaStorage(t *testing.T) {
+	fromBytes := []struct {
+		bytes, kib int64
+	}{
+		{-1, 0},
+		{0, 0},
+		{1, 1},
+		{1023, 1},
+		{1024, 1},
+		{1025, 2},
+		{math.MaxInt64, math.MaxInt64/1024 + 1},
+	}
+	for _, tc := range fromBytes {
+		if kib := imap.QuotaStorageFromBytes(tc.bytes); kib != tc.kib {
+			t.Errorf("QuotaStorageFromBytes(%v) = %v, want %v", tc.bytes, kib, tc.kib)
+		}
+	}
+
+	toBytes := []struct {
+		kib, bytes int64
+	}{
+		{-1, 0},
+		{0, 0},
+		{1, 1024},
+		{math.MaxInt64 / 1024, math.MaxInt64 / 1024 * 1024},
+		{math.MaxInt64/1024 + 1, math.MaxInt64},
+		{math.MaxInt64, math.MaxInt64},
+	}
+	for _, tc := range toBytes {
+		if bytes := imap.QuotaStorageToBytes(tc.kib); bytes != tc.bytes {
+			t.Errorf("QuotaStorageToBytes(%v) = %v, want %v", tc.kib, bytes, tc.bytes)
+		}
+	}
+}
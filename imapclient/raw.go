@@ -0,0 +1,255 @@
+package imapclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+// Execute sends a raw command.
+//
+// This is an escape hatch for vendor extensions which aren't supported by
+// this package. The command name may contain multiple atoms, e.g.
+// "UID FETCH". Arguments are encoded as quoted strings or literals as needed.
+// An error is returned without sending any command if an argument is invalid.
+//
+// While the command is pending, untagged responses whose type matches the
+// command name (ignoring any "UID" prefix) and untagged responses which aren't
+// recognized by the client are passed to the handler.
+//
+// Responses which update the client state, such as EXISTS, EXPUNGE or FETCH,
+// are always processed normally and never diverted to the handler. For FETCH
+// responses, the items which aren't recognized by the client are passed to
+// the handler, as a single list argument preceded by the UID if the server
+// included it.
+//
+// The handler is called from the goroutine reading responses: it must not
+// call Client methods, and should not block. If the handler returns an error,
+// it isn't called anymore and the error is returned by RawCommand.Wait.
+func (c *Client) Execute(name string, args []imap.RawArg, handler func(resp *RawResponse) error) *RawCommand {
+	if err := checkRawCommand(name, args); err != nil {
+		return &RawCommand{commandBase: failedCommandBase(err)}
+	}
+
+	fields := strings.Fields(name)
+	if len(fields) > 1 && strings.EqualFold(fields[0], "UID") {
+		fields = fields[1:]
+	}
+
+	cmd := &RawCommand{
+		respType: strings.ToUpper(fields[0]),
+		handler:  handler,
+	}
+	enc := c.beginCommand(name, cmd)
+	for _, arg := range args {
+		enc.SP()
+		writeRawArg(enc.Encoder, arg)
+	}
+	enc.end()
+	return cmd
+}
+
+func checkRawCommand(name string, args []imap.RawArg) error {
+	fields := strings.Fields(name)
+	if len(fields) == 0 || strings.Join(fields, " ") != name {
+		return fmt.Errorf("imapclient: invalid raw command name %q", name)
+	}
+	for _, s := range fields {
+		if !isRawAtom(s) {
+			return fmt.Errorf("imapclient: invalid raw command name %q", name)
+		}
+	}
+	return checkRawArgs(args)
+}
+
+func checkRawArgs(args []imap.RawArg) error {
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case imap.RawAtom:
+			if !isRawAtom(string(arg)) {
+				return fmt.Errorf("imapclient: invalid raw atom %q", arg)
+			}
+		case imap.RawString:
+			if strings.IndexByte(string(arg), 0) >= 0 {
+				return fmt.Errorf("imapclient: raw string contains NUL")
+			}
+		case imap.RawList:
+			if err := checkRawArgs(arg); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("imapclient: unsupported raw argument %T", arg)
+		}
+	}
+	return nil
+}
+
+// rawAtomFunc returns a function checking characters of a raw atom. Any
+// character but CTL is allowed in bracketed sections.
+func rawAtomFunc() func(ch byte) bool {
+	depth := 0
+	return func(ch byte) bool {
+		if ch < ' ' || ch >= 0x7F {
+			return false
+		}
+		switch ch {
+		case '[':
+			depth++
+			return true
+		case ']':
+			if depth > 0 {
+				depth--
+			}
+			return true
+		}
+		if depth > 0 {
+			return true
+		}
+		switch ch {
+		case ' ', '(', ')', '{', '"':
+			return false
+		}
+		return true
+	}
+}
+
+func isRawAtom(s string) bool {
+	valid := rawAtomFunc()
+	for i := 0; i < len(s); i++ {
+		if !valid(s[i]) {
+			return false
+		}
+	}
+	return len(s) > 0
+}
+
+func writeRawArg(enc *imapwire.Encoder, arg imap.RawArg) {
+	switch arg := arg.(type) {
+	case imap.RawAtom:
+		enc.Atom(string(arg))
+	case imap.RawString:
+		enc.String(string(arg))
+	case imap.RawList:
+		enc.List(len(arg), func(i int) {
+			writeRawArg(enc, arg[i])
+		})
+	}
+}
+
+func readRawArg(dec *imapwire.Decoder) (imap.RawArg, error) {
+	var list imap.RawList
+	isList, err := dec.List(func() error {
+		arg, err := readRawArg(dec)
+		if err != nil {
+			return err
+		}
+		list = append(list, arg)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	} else if isList {
+		if list == nil {
+			list = imap.RawList{}
+		}
+		return list, nil
+	}
+
+	var s string
+	if dec.String(&s) {
+		return imap.RawString(s), nil
+	}
+	if !dec.Expect(dec.Func(&s, rawAtomFunc()), "raw value") {
+		return nil, dec.Err()
+	}
+	return imap.RawAtom(s), nil
+}
+
+// stateRespTypes are untagged response types which may be sent at any time and
+// update the client state. They are never diverted to a raw command.
+var stateRespTypes = map[string]bool{
+	"OK":         true,
+	"NO":         true,
+	"BAD":        true,
+	"BYE":        true,
+	"PREAUTH":    true,
+	"CAPABILITY": true,
+	"ENABLED":    true,
+	"FLAGS":      true,
+	"EXISTS":     true,
+	"RECENT":     true,
+	"EXPUNGE":    true,
+	"VANISHED":   true,
+	"FETCH":      true,
+	"STATUS":     true,
+	"LIST":       true,
+	"METADATA":   true,
+}
+
+// findRawCmd returns the pending raw command which should receive an untagged
+// response of the given type, if any. If known is false, any raw command is
+// returned.
+func (c *Client) findRawCmd(typ string, known bool) *RawCommand {
+	cmd := c.findPendingCmdFunc(func(cmd command) bool {
+		rawCmd, ok := cmd.(*RawCommand)
+		return ok && (!known || rawCmd.respType == typ)
+	})
+	rawCmd, _ := cmd.(*RawCommand)
+	return rawCmd
+}
+
+func (c *Client) handleRaw(cmd *RawCommand, num uint32, typ string) error {
+	resp := &RawResponse{Num: num, Type: typ}
+	for c.dec.SP() {
+		arg, err := readRawArg(c.dec)
+		if err != nil {
+			return err
+		}
+		resp.Args = append(resp.Args, arg)
+	}
+
+	cmd.handle(resp)
+	return nil
+}
+
+func (cmd *RawCommand) handle(resp *RawResponse) {
+	if cmd.handlerErr == nil && cmd.handler != nil {
+		cmd.handlerErr = cmd.handler(resp)
+	}
+}
+
+// RawCommand is a command sent with Client.Execute.
+type RawCommand struct {
+	commandBase
+	respType   string
+	handler    func(resp *RawResponse) error
+	handlerErr error
+}
+
+// Wait blocks until the command has completed.
+func (cmd *RawCommand) Wait() error {
+	if err := cmd.wait(); err != nil {
+		return err
+	}
+	return cmd.handlerErr
+}
+
+// WaitContext is like Wait, but closes the connection if ctx is done before
+// the command has completed. See Client.WatchContext.
+func (cmd *RawCommand) WaitContext(ctx context.Context) error {
+	defer cmd.watchContext(ctx)()
+	return cmd.Wait()
+}
+
+// RawResponse is an untagged response passed to a Client.Execute handler.
+type RawResponse struct {
+	// Number preceding the response type, e.g. the message sequence number
+	// of a FETCH response, or zero
+	Num uint32
+	// Response type, in upper case
+	Type string
+	Args []imap.RawArg
+}
@@ -0,0 +1,176 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"io"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+// fetchGmailLabels fetches Gmail's X-GM-LABELS via Client.Execute.
+func fetchGmailLabels(client *imapclient.Client, uids imap.UIDSet) (map[imap.UID][]string, error) {
+	labels := make(map[imap.UID][]string)
+	args := []imap.RawArg{imap.RawAtom(uids.String()), imap.RawList{imap.RawAtom("X-GM-LABELS")}}
+	err := client.Execute("UID FETCH", args, func(resp *imapclient.RawResponse) error {
+		if resp.Type != "FETCH" || len(resp.Args) != 1 {
+			return nil
+		}
+		items, _ := resp.Args[0].(imap.RawList)
+		var (
+			uid       imap.UID
+			msgLabels []string
+		)
+		for i := 0; i+1 < len(items); i += 2 {
+			name, _ := items[i].(imap.RawAtom)
+			switch name {
+			case "UID":
+				v, _ := items[i+1].(imap.RawAtom)
+				n, err := strconv.ParseUint(string(v), 10, 32)
+				if err != nil {
+					return err
+				}
+				uid = imap.UID(n)
+			case "X-GM-LABELS":
+				list, _ := items[i+1].(imap.RawList)
+				for _, label := range list {
+					switch label := label.(type) {
+					case imap.RawAtom:
+						msgLabels = append(msgLabels, string(label))
+					case imap.RawString:
+						msgLabels = append(msgLabels, string(label))
+					}
+				}
+			}
+		}
+		labels[uid] = msgLabels
+		return nil
+	}).Wait()
+	return labels, err
+}
+
+func TestClient_Execute(t *testing.T) {
+	commands := make(chan string, 3)
+	greeting := "* OK [CAPABILITY IMAP4rev1 X-GM-EXT-1] Gimap ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, args := readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, `* 1 FETCH (X-GM-LABELS (\Inbox \Sent "Important") UID 42)`+"\r\n")
+		io.WriteString(w, "* 2 FETCH (UID 43 X-GM-LABELS ({8}\r\nMy\r\nWork \"Ünïcode\"))\r\n")
+		io.WriteString(w, "* X-VENDOR-NOTE [BODY[HEADER.FIELDS (From)]] 1\r\n")
+		io.WriteString(w, tag+" OK Success\r\n")
+
+		tag, args = readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, "* SEARCH 42 43\r\n")
+		io.WriteString(w, tag+" OK SEARCH completed\r\n")
+
+		tag, args = readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, tag+" OK NOOP completed\r\n")
+	})
+
+	labels, err := fetchGmailLabels(client, imap.UIDSet{imap.UIDRange{Start: 42, Stop: 43}})
+	if err != nil {
+		t.Fatalf("Execute().Wait() = %v", err)
+	}
+	if cmd := <-commands; cmd != "UID FETCH 42:43 (X-GM-LABELS)" {
+		t.Errorf("command = %q", cmd)
+	}
+	want := map[imap.UID][]string{
+		42: {`\Inbox`, `\Sent`, "Important"},
+		43: {"My\r\nWork", "Ünïcode"},
+	}
+	if !reflect.DeepEqual(labels, want) {
+		t.Errorf("labels = %q, want %q", labels, want)
+	}
+
+	var results []imap.RawArg
+	searchArgs := []imap.RawArg{imap.RawAtom("X-GM-RAW"), imap.RawString("has:attachment in:unread")}
+	err = client.Execute("UID SEARCH", searchArgs, func(resp *imapclient.RawResponse) error {
+		results = append(results, resp.Args...)
+		return nil
+	}).Wait()
+	if err != nil {
+		t.Fatalf("Execute().Wait() = %v", err)
+	}
+	if cmd := <-commands; cmd != `UID SEARCH X-GM-RAW "has:attachment in:unread"` {
+		t.Errorf("command = %q", cmd)
+	}
+	if want := []imap.RawArg{imap.RawAtom("42"), imap.RawAtom("43")}; !reflect.DeepEqual(results, want) {
+		t.Errorf("search results = %v, want %v", results, want)
+	}
+
+	// Misuse is rejected without sending anything
+	for _, args := range [][]imap.RawArg{
+		{imap.RawAtom("INBOX\r\nA1 LOGOUT")},
+		{imap.RawList{imap.RawAtom("a b")}},
+		{imap.RawString("a\x00b")},
+	} {
+		if err := client.Execute("X-FOO", args, nil).Wait(); err == nil {
+			t.Errorf("Execute(%q) = nil, want an error", args)
+		}
+	}
+	if err := client.Execute("X-FOO\r\nA1 LOGOUT", nil, nil).Wait(); err == nil {
+		t.Errorf("Execute() with CRLF in the name = nil, want an error")
+	}
+	if err := client.Noop().Wait(); err != nil {
+		t.Fatalf("Noop().Wait() = %v", err)
+	}
+	if cmd := <-commands; cmd != "NOOP" {
+		t.Errorf("command = %q, want NOOP", cmd)
+	}
+}
+
+func TestClient_Execute_stateResponses(t *testing.T) {
+	greeting := "* OK [CAPABILITY IMAP4rev1 X-GM-EXT-1] Gimap ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, _ := readScriptTaggedCommand(t, br, w)
+		io.WriteString(w, "* 4 EXISTS\r\n")
+		io.WriteString(w, "* 2 EXPUNGE\r\n")
+		io.WriteString(w, `* 1 FETCH (UID 42 FLAGS (\Seen) X-GM-LABELS (\Inbox))`+"\r\n")
+		io.WriteString(w, tag+" OK Success\r\n")
+	})
+
+	events := make(chan string, 3)
+	client.OnMessageCount(func(n uint32) {
+		events <- "exists " + strconv.Itoa(int(n))
+	})
+	client.OnExpunge(func(seqNum uint32) {
+		events <- "expunge " + strconv.Itoa(int(seqNum))
+	})
+	client.OnFlagsUpdate(func(seqNum uint32, uid imap.UID, flags []imap.Flag) {
+		events <- "flags " + strconv.Itoa(int(seqNum)) + " " + strconv.Itoa(int(uid))
+	})
+
+	var responses []*imapclient.RawResponse
+	args := []imap.RawArg{imap.RawAtom("1:*"), imap.RawList{imap.RawAtom("FLAGS"), imap.RawAtom("X-GM-LABELS")}}
+	err := client.Execute("UID FETCH", args, func(resp *imapclient.RawResponse) error {
+		responses = append(responses, resp)
+		return nil
+	}).Wait()
+	if err != nil {
+		t.Fatalf("Execute().Wait() = %v", err)
+	}
+
+	want := []*imapclient.RawResponse{{
+		Num:  1,
+		Type: "FETCH",
+		Args: []imap.RawArg{imap.RawList{
+			imap.RawAtom("UID"), imap.RawAtom("42"),
+			imap.RawAtom("X-GM-LABELS"), imap.RawList{imap.RawAtom(`\Inbox`)},
+		}},
+	}}
+	if !reflect.DeepEqual(responses, want) {
+		t.Errorf("raw responses = %v, want %v", responses, want)
+	}
+
+	for _, want := range []string{"exists 4", "expunge 2", "flags 1 42"} {
+		if ev := <-events; ev != want {
+			t.Errorf("got update %q, want %q", ev, want)
+		}
+	}
+}
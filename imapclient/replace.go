@@ -0,0 +1,180 @@
+package imapclient
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+// Replace sends a REPLACE command, which atomically appends a new message to
+// a mailbox and expunges a message from the selected mailbox. This is useful
+// to save an updated draft.
+//
+// The caller must write the new message and call ReplaceCommand.Close, as
+// with Append.
+//
+// If the server doesn't support the REPLACE extension, a fallback with APPEND
+// + UID STORE + UID EXPUNGE commands is used, which requires UIDPLUS. The old
+// message is only flagged as \Deleted once the new message has been stored,
+// and other messages flagged as \Deleted are left untouched. If the old
+// message is identified by its sequence number, its UID is fetched before the
+// APPEND command is sent, so that expunges processed meanwhile don't change
+// which message is removed.
+//
+// If the fallback fails after the new message has been stored, a
+// *ReplaceError is returned.
+func (c *Client) Replace(seqNum uint32, mailbox string, size int64, options *imap.AppendOptions) *ReplaceCommand {
+	return c.replace(imap.SeqSetNum(seqNum), mailbox, size, options)
+}
+
+// UIDReplace is like Replace, but the old message is identified by its UID.
+func (c *Client) UIDReplace(uid imap.UID, mailbox string, size int64, options *imap.AppendOptions) *ReplaceCommand {
+	return c.replace(imap.UIDSetNum(uid), mailbox, size, options)
+}
+
+func (c *Client) replace(numSet imap.NumSet, mailbox string, size int64, options *imap.AppendOptions) *ReplaceCommand {
+	if !c.Caps().Has(imap.CapReplace) {
+		// A plain EXPUNGE would remove other messages flagged as \Deleted
+		if err := c.checkCap(imap.CapUIDPlus); err != nil {
+			return &ReplaceCommand{commandBase: failedCommandBase(err)}
+		}
+		uids, err := c.replaceFallbackUID(numSet)
+		if err != nil {
+			return &ReplaceCommand{commandBase: failedCommandBase(err)}
+		}
+		cmd := &ReplaceCommand{
+			appendCmd:    c.Append(mailbox, size, options),
+			fallbackDone: make(chan struct{}),
+		}
+		go cmd.fallback(c, uids)
+		return cmd
+	}
+
+	if options != nil && options.Binary {
+		if err := c.checkCap(imap.CapBinary); err != nil {
+			return &ReplaceCommand{commandBase: failedCommandBase(err)}
+		}
+	}
+
+	cmd := &ReplaceCommand{}
+	cmd.enc = c.beginCommand(uidCmdName("REPLACE", imapwire.NumSetKind(numSet)), cmd)
+	cmd.enc.SP().NumSet(numSet).SP().Mailbox(mailbox).SP()
+	cmd.wc = writeAppendMessage(cmd.enc, size, options)
+	return cmd
+}
+
+// ReplaceCommand is a REPLACE command.
+type ReplaceCommand struct {
+	commandBase
+	enc  *commandEncoder
+	wc   io.WriteCloser
+	data imap.AppendData
+
+	// Fallback, closed once the APPEND + STORE + EXPUNGE sequence is over
+	appendCmd    *AppendCommand
+	fallbackDone chan struct{}
+	fallbackErr  error
+}
+
+// replaceFallbackUID returns the UID of the old message for the REPLACE
+// fallback. Sequence numbers can change once other commands are sent, so the
+// UID is fetched right away.
+func (c *Client) replaceFallbackUID(numSet imap.NumSet) (imap.UIDSet, error) {
+	if uids, ok := numSet.(imap.UIDSet); ok {
+		return uids, nil
+	}
+	msgs, err := c.Fetch(numSet, &imap.FetchOptions{UID: true}).Collect()
+	if err != nil {
+		return nil, err
+	} else if len(msgs) != 1 || msgs[0].UID == 0 {
+		return nil, fmt.Errorf("imapclient: failed to fetch the UID of the old message")
+	}
+	return imap.UIDSetNum(msgs[0].UID), nil
+}
+
+// fallback removes the old message once the APPEND command has completed:
+// UID STORE +FLAGS.SILENT \Deleted, then UID EXPUNGE.
+func (cmd *ReplaceCommand) fallback(c *Client, uids imap.UIDSet) {
+	defer close(cmd.fallbackDone)
+
+	data, err := cmd.appendCmd.Wait()
+	if err != nil {
+		cmd.fallbackErr = err
+		return
+	}
+	cmd.data = *data
+
+	err = c.Store(uids, &imap.StoreFlags{
+		Op:     imap.StoreFlagsAdd,
+		Silent: true,
+		Flags:  []imap.Flag{imap.FlagDeleted},
+	}, nil).Close()
+	if err != nil {
+		cmd.fallbackErr = &ReplaceError{Err: err}
+		return
+	}
+
+	if err := c.UIDExpunge(uids).Close(); err != nil {
+		cmd.fallbackErr = &ReplaceError{Err: err}
+	}
+}
+
+func (cmd *ReplaceCommand) Write(b []byte) (int, error) {
+	if cmd.appendCmd != nil {
+		return cmd.appendCmd.Write(b)
+	} else if cmd.wc == nil {
+		return 0, cmd.err
+	}
+	return cmd.wc.Write(b)
+}
+
+func (cmd *ReplaceCommand) Close() error {
+	if cmd.appendCmd != nil {
+		return cmd.appendCmd.Close()
+	} else if cmd.wc == nil {
+		return nil
+	}
+	err := cmd.wc.Close()
+	if cmd.enc != nil {
+		cmd.enc.end()
+		cmd.enc = nil
+	}
+	return err
+}
+
+// Wait blocks until the command has completed.
+//
+// If the server supports UIDPLUS, the returned data contains the UID of the
+// new message. If a *ReplaceError is returned, the data is returned as well.
+func (cmd *ReplaceCommand) Wait() (*imap.AppendData, error) {
+	if cmd.fallbackDone != nil {
+		// The fallback goroutine waits for the APPEND command
+		<-cmd.fallbackDone
+		if _, ok := cmd.fallbackErr.(*ReplaceError); ok {
+			return &cmd.data, cmd.fallbackErr
+		} else if cmd.fallbackErr != nil {
+			return nil, cmd.fallbackErr
+		}
+		return &cmd.data, nil
+	}
+	if err := cmd.wait(); err != nil {
+		return nil, err
+	}
+	return &cmd.data, nil
+}
+
+// ReplaceError is returned when the REPLACE fallback has stored the new
+// message, but failed to remove the old one.
+type ReplaceError struct {
+	Err error
+}
+
+func (err *ReplaceError) Error() string {
+	return fmt.Sprintf("imapclient: new message stored but old message not removed: %v", err.Err)
+}
+
+func (err *ReplaceError) Unwrap() error {
+	return err.Err
+}
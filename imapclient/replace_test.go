@@ -0,0 +1,207 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+func replaceMessage(t *testing.T, cmd *imapclient.ReplaceCommand, msg string) (*imap.AppendData, error) {
+	if _, err := cmd.Write([]byte(msg)); err != nil {
+		t.Fatalf("ReplaceCommand.Write() = %v", err)
+	}
+	if err := cmd.Close(); err != nil {
+		t.Fatalf("ReplaceCommand.Close() = %v", err)
+	}
+	return cmd.Wait()
+}
+
+func TestClient_UIDReplace(t *testing.T) {
+	const draft = "Subject: Draft v2\r\n\r\nHello world\r\n"
+
+	commands := make(chan string, 1)
+	greeting := "* OK [CAPABILITY IMAP4rev1 REPLACE UIDPLUS] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, args := readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, "* OK [APPENDUID 38505 3955] Replacement Message ready\r\n")
+		io.WriteString(w, "* 1 EXPUNGE\r\n")
+		io.WriteString(w, tag+" OK REPLACE completed\r\n")
+	})
+
+	data, err := replaceMessage(t, client.UIDReplace(3954, "Drafts", int64(len(draft)), nil), draft)
+	if err != nil {
+		t.Fatalf("UIDReplace().Wait() = %v", err)
+	}
+	want := `UID REPLACE 3954 "Drafts" {` + strconv.Itoa(len(draft)) + "}\r\n" + draft
+	if cmd := <-commands; cmd != want {
+		t.Errorf("command = %q, want %q", cmd, want)
+	}
+	if data.UID != 3955 || data.UIDValidity != 38505 {
+		t.Errorf("AppendData = %+v, want UID 3955 and UIDVALIDITY 38505", data)
+	}
+}
+
+func TestClient_UIDReplace_fallback(t *testing.T) {
+	user := imapmemserver.NewUser(testUsername, testPassword)
+	user.Create("INBOX", nil)
+	user.Create("Drafts", nil)
+	dial := newCapsTestServer(t, user, imap.CapSet{imap.CapUIDPlus: {}})
+	var debugLog lockedBuffer
+	client := dial(&imapclient.Options{DebugLog: &debugLog})
+
+	appendCmd := client.Append("Drafts", int64(len("Subject: Draft v1\r\n\r\n")), nil)
+	appendCmd.Write([]byte("Subject: Draft v1\r\n\r\n"))
+	appendCmd.Close()
+	appendData, err := appendCmd.Wait()
+	if err != nil {
+		t.Fatalf("Append().Wait() = %v", err)
+	}
+	if _, err := client.Select("Drafts", nil).Wait(); err != nil {
+		t.Fatalf("Select().Wait() = %v", err)
+	}
+
+	const draft = "Subject: Draft v2\r\n\r\nHello world\r\n"
+	data, err := replaceMessage(t, client.UIDReplace(appendData.UID, "Drafts", int64(len(draft)), nil), draft)
+	if err != nil {
+		t.Fatalf("UIDReplace().Wait() = %v", err)
+	}
+	if data.UID == 0 || data.UID == appendData.UID {
+		t.Errorf("AppendData.UID = %v, want a new UID", data.UID)
+	}
+
+	searchData, err := client.UIDSearch(&imap.SearchCriteria{}, nil).Wait()
+	if err != nil {
+		t.Fatalf("UIDSearch().Wait() = %v", err)
+	} else if uids, _ := searchData.AllUIDs(); len(uids) != 1 || uids[0] != data.UID {
+		t.Errorf("UIDs after REPLACE = %v, want [%v]", uids, data.UID)
+	}
+
+	log := debugLog.String()
+	if strings.Contains(log, "REPLACE") {
+		t.Errorf("REPLACE command was sent")
+	}
+	if !strings.Contains(log, "UID EXPUNGE") {
+		t.Errorf("UID EXPUNGE command wasn't sent")
+	}
+}
+
+func TestClient_Replace_fallbackNotRemoved(t *testing.T) {
+	greeting := "* OK [CAPABILITY IMAP4rev1 UIDPLUS] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, _ := readScriptTaggedCommand(t, br, w)
+		io.WriteString(w, "* 1 FETCH (UID 7)\r\n")
+		io.WriteString(w, tag+" OK FETCH completed\r\n")
+		tag, _ = readScriptTaggedCommand(t, br, w)
+		io.WriteString(w, tag+" OK [APPENDUID 1 12] APPEND completed\r\n")
+		tag, _ = readScriptTaggedCommand(t, br, w)
+		io.WriteString(w, tag+" NO Permission denied\r\n")
+	})
+
+	const draft = "Subject: Draft\r\n\r\n"
+	data, err := replaceMessage(t, client.Replace(1, "Drafts", int64(len(draft)), nil), draft)
+	var replaceErr *imapclient.ReplaceError
+	if !errors.As(err, &replaceErr) {
+		t.Fatalf("Replace().Wait() = %v, want a ReplaceError", err)
+	}
+	if data == nil || data.UID != 12 {
+		t.Errorf("AppendData = %+v, want UID 12", data)
+	}
+}
+
+func TestClient_Replace_fallbackExpunge(t *testing.T) {
+	commands := make(chan string, 4)
+	greeting := "* OK [CAPABILITY IMAP4rev1 UIDPLUS] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, args := readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, "* 1 FETCH (UID 7)\r\n")
+		io.WriteString(w, tag+" OK FETCH completed\r\n")
+		tag, _ = readScriptTaggedCommand(t, br, w)
+		// Renumbers the mailbox before the old message is removed
+		io.WriteString(w, "* 1 EXPUNGE\r\n")
+		io.WriteString(w, tag+" OK [APPENDUID 1 12] APPEND completed\r\n")
+		for i := 0; i < 2; i++ {
+			tag, args = readScriptTaggedCommand(t, br, w)
+			commands <- args
+			io.WriteString(w, tag+" OK Done\r\n")
+		}
+	})
+
+	const draft = "Subject: Draft\r\n\r\n"
+	if _, err := replaceMessage(t, client.Replace(1, "Drafts", int64(len(draft)), nil), draft); err != nil {
+		t.Fatalf("Replace().Wait() = %v", err)
+	}
+	for _, want := range []string{"FETCH 1 (UID)", `UID STORE 7 +FLAGS.SILENT (\Deleted)`, "UID EXPUNGE 7"} {
+		if cmd := <-commands; cmd != want {
+			t.Errorf("command = %q, want %q", cmd, want)
+		}
+	}
+}
+
+func TestClient_Replace_fallbackKeepsDeleted(t *testing.T) {
+	user := imapmemserver.NewUser(testUsername, testPassword)
+	user.Create("INBOX", nil)
+	user.Create("Drafts", nil)
+	dial := newCapsTestServer(t, user, imap.CapSet{imap.CapUIDPlus: {}})
+	client := dial(nil)
+
+	for _, flags := range [][]imap.Flag{nil, {imap.FlagDeleted}} {
+		appendCmd := client.Append("Drafts", int64(len(simpleRawMessage)), &imap.AppendOptions{Flags: flags})
+		appendCmd.Write([]byte(simpleRawMessage))
+		appendCmd.Close()
+		if _, err := appendCmd.Wait(); err != nil {
+			t.Fatalf("Append().Wait() = %v", err)
+		}
+	}
+	if _, err := client.Select("Drafts", nil).Wait(); err != nil {
+		t.Fatalf("Select().Wait() = %v", err)
+	}
+
+	const draft = "Subject: Draft v2\r\n\r\nHello world\r\n"
+	data, err := replaceMessage(t, client.Replace(1, "Drafts", int64(len(draft)), nil), draft)
+	if err != nil {
+		t.Fatalf("Replace().Wait() = %v", err)
+	}
+
+	// The other message flagged as \Deleted must not be expunged
+	searchData, err := client.UIDSearch(&imap.SearchCriteria{}, nil).Wait()
+	if err != nil {
+		t.Fatalf("UIDSearch().Wait() = %v", err)
+	} else if uids, _ := searchData.AllUIDs(); len(uids) != 2 || uids[0] != 2 || uids[1] != data.UID {
+		t.Errorf("UIDs after REPLACE = %v, want [2 %v]", uids, data.UID)
+	}
+}
+
+func TestClient_Replace_fallbackNoUIDPlus(t *testing.T) {
+	greeting := "* OK [CAPABILITY IMAP4rev1] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, args := readScriptTaggedCommand(t, br, w)
+		if args != "NOOP" {
+			t.Errorf("command = %q, want NOOP", args)
+		}
+		io.WriteString(w, tag+" OK NOOP completed\r\n")
+	})
+
+	const draft = "Subject: Draft\r\n\r\n"
+	cmd := client.Replace(1, "Drafts", int64(len(draft)), nil)
+	if _, err := cmd.Write([]byte(draft)); err == nil {
+		t.Errorf("ReplaceCommand.Write() = nil, want an error")
+	}
+	cmd.Close()
+	var capErr *imapclient.CapabilityError
+	if _, err := cmd.Wait(); !errors.As(err, &capErr) || capErr.Cap != imap.CapUIDPlus {
+		t.Errorf("Replace().Wait() = %v, want a UIDPLUS CapabilityError", err)
+	}
+
+	if err := client.Noop().Wait(); err != nil {
+		t.Fatalf("Noop().Wait() = %v", err)
+	}
+}
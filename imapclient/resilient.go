@@ -0,0 +1,505 @@
+package imapclient
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-sasl"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+const (
+	defaultResilientMinBackoff = time.Second
+	defaultResilientMaxBackoff = 5 * time.Minute
+)
+
+// ErrDisconnected is returned by ResilientClient.Do when the connection is
+// down and the command cannot be queued.
+var ErrDisconnected = errors.New("imapclient: disconnected")
+
+// ResilientOptions contains options for NewResilient.
+type ResilientOptions struct {
+	// SASLClient returns a new SASL client used to authenticate after each
+	// connection. If nil, the dial function is responsible for
+	// authentication.
+	SASLClient func() sasl.Client
+	// MinBackoff and MaxBackoff bound the delay between reconnection
+	// attempts. The delay doubles after each failed attempt, and a random
+	// jitter is applied. If zero, 1s and 5min are used.
+	MinBackoff, MaxBackoff time.Duration
+	// PingInterval is the interval at which NOOP commands are sent to detect
+	// dead connections. If zero, no NOOP command is sent.
+	PingInterval time.Duration
+	// MaxQueued is the maximum number of calls to Do waiting for the
+	// connection to be restored. If zero, Do fails immediately with
+	// ErrDisconnected while disconnected.
+	MaxQueued int
+	// UIDValidityChanged is called when the UIDVALIDITY of the selected
+	// mailbox has changed after a reconnection. Cached UIDs for the mailbox
+	// are no longer valid.
+	UIDValidityChanged func(mailbox string, prev, cur uint32)
+	// SelectFailed is called when the selected mailbox can't be selected
+	// again after a reconnection, e.g. because it has been deleted or
+	// renamed. No mailbox is selected afterwards.
+	SelectFailed func(mailbox string, err error)
+	// Disconnected is called when the connection is lost.
+	Disconnected func()
+	// Reconnected is called after the connection has been restored.
+	Reconnected func(*Client)
+	// Retry enables automatic retries in ResilientClient.Do. If nil, failed
+	// calls aren't retried.
+	Retry *RetryPolicy
+}
+
+// ResilientClient maintains a connection to an IMAP server, and transparently
+// reconnects when the connection is lost.
+//
+// After a reconnection, the client is re-authenticated, capabilities enabled
+// with ResilientClient.Enable are enabled again, and the mailbox selected
+// with ResilientClient.Select is selected again.
+//
+// Commands which were running when the connection was lost fail. They are only
+// retried if ResilientOptions.Retry is set, see ResilientClient.Do.
+//
+// If the server rejects the authentication or the ENABLE command after a
+// reconnection, the client stops reconnecting: ResilientClient.Do fails with
+// the error from then on.
+type ResilientClient struct {
+	dial    func() (*Client, error)
+	options ResilientOptions
+
+	closing chan struct{}
+	done    chan struct{}
+
+	mutex   sync.Mutex
+	cond    *sync.Cond
+	client  *Client // nil while disconnected
+	queued  int
+	closed  bool
+	err     error // permanent failure to restore the session
+	enabled imap.CapSet
+
+	// Selected mailbox, if any
+	mailbox       string
+	selectOptions *imap.SelectOptions
+	uidValidity   uint32
+}
+
+// NewResilient creates a new ResilientClient.
+//
+// The dial function is called to establish each connection. The first
+// connection is established before NewResilient returns: if it fails, an
+// error is returned.
+//
+// A nil options pointer is equivalent to a zero options value.
+func NewResilient(dial func() (*Client, error), options *ResilientOptions) (*ResilientClient, error) {
+	if options == nil {
+		options = &ResilientOptions{}
+	}
+
+	rc := &ResilientClient{
+		dial:    dial,
+		options: *options,
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	rc.cond = sync.NewCond(&rc.mutex)
+
+	client, err := rc.connect()
+	if err != nil {
+		return nil, err
+	}
+	rc.client = client
+
+	go rc.run(client)
+	return rc, nil
+}
+
+// Do calls f with the current connection.
+//
+// If the connection is down, Do waits until it's restored if fewer than
+// MaxQueued calls are already waiting. Otherwise, ErrDisconnected is
+// returned.
+//
+// If f fails and only sent idempotent commands (e.g. FETCH, SEARCH, STATUS,
+// LIST or NOOP), f is called again according to ResilientOptions.Retry. If the
+// connection has been lost, Do waits for it to be restored before retrying.
+// f may be called concurrently with other calls to Do: commands sent by these
+// calls are taken into account, so f may not be retried even if it only sends
+// idempotent commands.
+//
+// If f sent commands which aren't idempotent (e.g. APPEND, STORE, EXPUNGE or
+// COPY) and the connection has been lost, f isn't retried and an
+// *UnknownOutcomeError is returned.
+func (rc *ResilientClient) Do(f func(*Client) error) error {
+	client, err := rc.waitClient(nil)
+	if err != nil {
+		return err
+	}
+
+	policy := rc.options.Retry
+	for retry := 0; ; retry++ {
+		before := client.nonIdempotentCommands()
+		err := f(client)
+		if err == nil {
+			return nil
+		}
+
+		idempotent := client.nonIdempotentCommands() == before
+		// The client switches to the logout state before failing pending
+		// commands when the connection is lost
+		connLost := client.State() == imap.ConnStateLogout && !isStatusError(err)
+		if connLost && !idempotent {
+			return &UnknownOutcomeError{Err: err}
+		}
+		if policy == nil || !idempotent || retry >= policy.MaxRetries || !policy.retryable(err) {
+			return err
+		}
+
+		timer := time.NewTimer(policy.backoff(retry))
+		select {
+		case <-timer.C:
+		case <-rc.closing:
+			timer.Stop()
+			return err
+		}
+
+		if client.State() == imap.ConnStateLogout {
+			if client, err = rc.waitClient(client); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// waitClient returns the current connection, waiting for it to be restored if
+// necessary. If prev is non-nil, it's a lost connection: Do is retrying a
+// call, so MaxQueued doesn't apply.
+//
+// A connection in the logout state is lost, even if the run goroutine hasn't
+// noticed yet.
+func (rc *ResilientClient) waitClient(prev *Client) (*Client, error) {
+	rc.mutex.Lock()
+	for (rc.client == nil || rc.client == prev || rc.client.State() == imap.ConnStateLogout) && !rc.closed && rc.err == nil {
+		if prev == nil && rc.queued >= rc.options.MaxQueued {
+			rc.mutex.Unlock()
+			return nil, ErrDisconnected
+		}
+		rc.queued++
+		rc.cond.Wait()
+		rc.queued--
+	}
+	client := rc.client
+	closed := rc.closed
+	err := rc.err
+	rc.mutex.Unlock()
+
+	if closed {
+		return nil, fmt.Errorf("imapclient: resilient client closed")
+	} else if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// isStatusError returns true if err is a NO or BAD response.
+func isStatusError(err error) bool {
+	var imapErr *imap.Error
+	return errors.As(err, &imapErr) && imapErr.Type != imap.StatusResponseTypeBye
+}
+
+// Enable sends an ENABLE command. The capabilities granted by the server are
+// enabled again after each reconnection.
+func (rc *ResilientClient) Enable(caps ...imap.Cap) (*EnableData, error) {
+	var data *EnableData
+	err := rc.Do(func(c *Client) error {
+		var err error
+		data, err = c.Enable(caps...).Wait()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rc.mutex.Lock()
+	if rc.enabled == nil {
+		rc.enabled = make(imap.CapSet)
+	}
+	for name := range data.Caps {
+		rc.enabled[name] = struct{}{}
+	}
+	rc.mutex.Unlock()
+	return data, nil
+}
+
+// Select sends a SELECT or EXAMINE command. The mailbox is selected again
+// after each reconnection.
+func (rc *ResilientClient) Select(mailbox string, options *imap.SelectOptions) (*imap.SelectData, error) {
+	var data *imap.SelectData
+	err := rc.Do(func(c *Client) error {
+		var err error
+		data, err = c.Select(mailbox, options).Wait()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rc.mutex.Lock()
+	rc.mailbox = mailbox
+	rc.selectOptions = options
+	rc.uidValidity = data.UIDValidity
+	rc.mutex.Unlock()
+	return data, nil
+}
+
+// Unselect sends an UNSELECT command. No mailbox is selected after
+// reconnections anymore.
+func (rc *ResilientClient) Unselect() error {
+	err := rc.Do(func(c *Client) error {
+		return c.Unselect().Wait()
+	})
+	if err != nil {
+		return err
+	}
+
+	rc.mutex.Lock()
+	rc.mailbox = ""
+	rc.selectOptions = nil
+	rc.uidValidity = 0
+	rc.mutex.Unlock()
+	return nil
+}
+
+// Close closes the connection and stops reconnecting.
+func (rc *ResilientClient) Close() error {
+	rc.mutex.Lock()
+	if rc.closed {
+		rc.mutex.Unlock()
+		return fmt.Errorf("imapclient: resilient client already closed")
+	}
+	rc.closed = true
+	client := rc.client
+	rc.cond.Broadcast()
+	rc.mutex.Unlock()
+
+	close(rc.closing)
+	var err error
+	if client != nil {
+		err = client.Close()
+	}
+	<-rc.done
+	return err
+}
+
+func (rc *ResilientClient) run(client *Client) {
+	defer close(rc.done)
+
+	for {
+		rc.watch(client)
+
+		rc.mutex.Lock()
+		rc.client = nil
+		closed := rc.closed
+		rc.mutex.Unlock()
+
+		if closed {
+			// The connection may have been restored concurrently with Close
+			client.Close()
+			return
+		}
+		if rc.options.Disconnected != nil {
+			rc.options.Disconnected()
+		}
+
+		var err error
+		client, err = rc.reconnect()
+		if err != nil {
+			rc.mutex.Lock()
+			rc.err = err
+			rc.cond.Broadcast()
+			rc.mutex.Unlock()
+			return
+		} else if client == nil {
+			return
+		}
+
+		rc.mutex.Lock()
+		rc.client = client
+		rc.cond.Broadcast()
+		rc.mutex.Unlock()
+
+		if rc.options.Reconnected != nil {
+			rc.options.Reconnected(client)
+		}
+	}
+}
+
+// watch blocks until the connection is lost or the client is closed.
+func (rc *ResilientClient) watch(client *Client) {
+	var tick <-chan time.Time
+	if rc.options.PingInterval > 0 {
+		ticker := time.NewTicker(rc.options.PingInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-client.decCh:
+			return
+		case <-rc.closing:
+			return
+		case <-tick:
+			if err := client.Noop().Wait(); err != nil {
+				client.Close()
+				return
+			}
+		}
+	}
+}
+
+// reconnect redials until a connection is established. It returns nil if the
+// client is closed, and an error if the session can't be restored.
+func (rc *ResilientClient) reconnect() (*Client, error) {
+	minBackoff := rc.options.MinBackoff
+	if minBackoff <= 0 {
+		minBackoff = defaultResilientMinBackoff
+	}
+	maxBackoff := rc.options.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultResilientMaxBackoff
+	}
+
+	backoff := minBackoff
+	for {
+		select {
+		case <-rc.closing:
+			return nil, nil
+		default:
+		}
+
+		client, err := rc.connect()
+		var restoreErr *restoreError
+		if err == nil {
+			return client, nil
+		} else if errors.As(err, &restoreErr) {
+			return nil, restoreErr.err
+		}
+
+		// Wait between half and the full backoff duration
+		delay := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-rc.closing:
+			timer.Stop()
+			return nil, nil
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// connect dials a new connection and restores the session state.
+func (rc *ResilientClient) connect() (*Client, error) {
+	client, err := rc.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rc.restore(client); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// restoreError is returned by restore when the server rejects a command:
+// reconnecting again won't help.
+type restoreError struct {
+	err error
+}
+
+func newRestoreError(err error) error {
+	if isStatusError(err) {
+		return &restoreError{err}
+	}
+	return err
+}
+
+func (err *restoreError) Error() string {
+	return err.err.Error()
+}
+
+func (err *restoreError) Unwrap() error {
+	return err.err
+}
+
+// restore authenticates, enables capabilities and selects the mailbox again.
+// NO and BAD responses are returned as a *restoreError. If the mailbox can't be
+// selected, it's forgotten and ResilientOptions.SelectFailed is called.
+func (rc *ResilientClient) restore(client *Client) error {
+	if rc.options.SASLClient != nil {
+		if err := client.Authenticate(rc.options.SASLClient()); err != nil {
+			return newRestoreError(fmt.Errorf("imapclient: failed to authenticate: %w", err))
+		}
+	}
+
+	rc.mutex.Lock()
+	enabled := make([]imap.Cap, 0, len(rc.enabled))
+	for name := range rc.enabled {
+		enabled = append(enabled, name)
+	}
+	mailbox := rc.mailbox
+	selectOptions := rc.selectOptions
+	prevUIDValidity := rc.uidValidity
+	rc.mutex.Unlock()
+
+	if len(enabled) > 0 {
+		sort.Slice(enabled, func(i, j int) bool {
+			return enabled[i] < enabled[j]
+		})
+		if _, err := client.Enable(enabled...).Wait(); err != nil {
+			return newRestoreError(fmt.Errorf("imapclient: failed to enable capabilities: %w", err))
+		}
+	}
+
+	if mailbox == "" {
+		return nil
+	}
+	data, err := client.Select(mailbox, selectOptions).Wait()
+	if err != nil && isStatusError(err) {
+		rc.mutex.Lock()
+		if rc.mailbox == mailbox {
+			rc.mailbox = ""
+			rc.selectOptions = nil
+			rc.uidValidity = 0
+		}
+		rc.mutex.Unlock()
+
+		if rc.options.SelectFailed != nil {
+			rc.options.SelectFailed(mailbox, err)
+		}
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("imapclient: failed to select mailbox: %w", err)
+	}
+
+	rc.mutex.Lock()
+	rc.uidValidity = data.UIDValidity
+	rc.mutex.Unlock()
+
+	if data.UIDValidity != prevUIDValidity && rc.options.UIDValidityChanged != nil {
+		rc.options.UIDValidityChanged(mailbox, prevUIDValidity, data.UIDValidity)
+	}
+	return nil
+}
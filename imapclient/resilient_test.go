@@ -0,0 +1,362 @@
+package imapclient_test
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-sasl"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+type resilientTest struct {
+	t           *testing.T
+	user        *imapmemserver.User
+	server      *imapserver.Server
+	ln          net.Listener
+	serverConns chan *imapserver.Conn
+
+	mutex    sync.Mutex
+	dialErr  error
+	debugLog []*lockedBuffer
+}
+
+func newResilientTest(t *testing.T) *resilientTest {
+	rt := &resilientTest{
+		t:           t,
+		user:        imapmemserver.NewUser(testUsername, testPassword),
+		serverConns: make(chan *imapserver.Conn, 16),
+	}
+	rt.user.Create("INBOX", nil)
+	rt.user.Create("Archive", nil)
+
+	memServer := imapmemserver.New()
+	memServer.AddUser(rt.user)
+
+	rt.server = imapserver.New(&imapserver.Options{
+		NewSession: func(conn *imapserver.Conn) (imapserver.Session, *imapserver.GreetingData, error) {
+			rt.serverConns <- conn
+			return memServer.NewSession(), nil, nil
+		},
+		InsecureAuth: true,
+		Caps: imap.CapSet{
+			imap.CapIMAP4rev1: {},
+			imap.CapIMAP4rev2: {},
+		},
+	})
+
+	var err error
+	rt.ln, err = net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("net.Listen() = %v", err)
+	}
+	go rt.server.Serve(rt.ln)
+	return rt
+}
+
+func (rt *resilientTest) Close() {
+	rt.server.Close()
+}
+
+func (rt *resilientTest) dial() (*imapclient.Client, error) {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	if rt.dialErr != nil {
+		return nil, rt.dialErr
+	}
+	conn, err := net.Dial("tcp", rt.ln.Addr().String())
+	if err != nil {
+		return nil, err
+	}
+	debug := &lockedBuffer{}
+	rt.debugLog = append(rt.debugLog, debug)
+	return imapclient.New(conn, &imapclient.Options{DebugWriter: debug}), nil
+}
+
+func (rt *resilientTest) setDialErr(err error) {
+	rt.mutex.Lock()
+	rt.dialErr = err
+	rt.mutex.Unlock()
+}
+
+func (rt *resilientTest) lastDebugLog() string {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+	return rt.debugLog[len(rt.debugLog)-1].String()
+}
+
+// killConn closes the server side of the current connection.
+func (rt *resilientTest) killConn() {
+	select {
+	case conn := <-rt.serverConns:
+		conn.NetConn().Close()
+	case <-time.After(5 * time.Second):
+		rt.t.Fatalf("timeout waiting for server connection")
+	}
+}
+
+func waitReconnected(t *testing.T, reconnected <-chan struct{}) {
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for reconnection")
+	}
+}
+
+func TestResilientClient(t *testing.T) {
+	rt := newResilientTest(t)
+	defer rt.Close()
+
+	type uidValidityChange struct {
+		mailbox   string
+		prev, cur uint32
+	}
+	uidValidityChanges := make(chan uidValidityChange, 1)
+	reconnected := make(chan struct{}, 1)
+	rc, err := imapclient.NewResilient(rt.dial, &imapclient.ResilientOptions{
+		SASLClient: func() sasl.Client {
+			return sasl.NewPlainClient("", testUsername, testPassword)
+		},
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 50 * time.Millisecond,
+		UIDValidityChanged: func(mailbox string, prev, cur uint32) {
+			uidValidityChanges <- uidValidityChange{mailbox, prev, cur}
+		},
+		Reconnected: func(*imapclient.Client) {
+			reconnected <- struct{}{}
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewResilient() = %v", err)
+	}
+	defer rc.Close()
+
+	// Capabilities enabled twice are enabled once after reconnections
+	for i := 0; i < 2; i++ {
+		if _, err := rc.Enable(imap.CapIMAP4rev2); err != nil {
+			t.Fatalf("Enable() = %v", err)
+		}
+	}
+	selectData, err := rc.Select("Archive", nil)
+	if err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+
+	rt.killConn()
+	waitReconnected(t, reconnected)
+
+	err = rc.Do(func(c *imapclient.Client) error {
+		if mbox := c.Mailbox(); mbox == nil || mbox.Name != "Archive" {
+			t.Errorf("Mailbox() = %v, want Archive", mbox)
+		}
+		return c.Noop().Wait()
+	})
+	if err != nil {
+		t.Fatalf("Do() = %v", err)
+	}
+	if log := rt.lastDebugLog(); !strings.Contains(log, " ENABLE IMAP4rev2\r\n") {
+		t.Errorf("IMAP4rev2 not enabled again after reconnection")
+	}
+	select {
+	case change := <-uidValidityChanges:
+		t.Errorf("unexpected UIDValidityChanged(%q, %v, %v)", change.mailbox, change.prev, change.cur)
+	default:
+	}
+
+	// Re-create the mailbox to change its UIDVALIDITY
+	if err := rt.user.Delete("Archive"); err != nil {
+		t.Fatalf("Delete() = %v", err)
+	}
+	rt.user.Create("Archive", nil)
+
+	rt.killConn()
+	waitReconnected(t, reconnected)
+
+	select {
+	case change := <-uidValidityChanges:
+		if change.mailbox != "Archive" || change.prev != selectData.UIDValidity || change.cur == change.prev {
+			t.Errorf("UIDValidityChanged(%q, %v, %v), want Archive with prev = %v and a different cur", change.mailbox, change.prev, change.cur, selectData.UIDValidity)
+		}
+	default:
+		t.Errorf("UIDValidityChanged not called")
+	}
+}
+
+func TestResilientClient_queue(t *testing.T) {
+	rt := newResilientTest(t)
+	defer rt.Close()
+
+	disconnected := make(chan struct{}, 1)
+	rc, err := imapclient.NewResilient(rt.dial, &imapclient.ResilientOptions{
+		SASLClient: func() sasl.Client {
+			return sasl.NewPlainClient("", testUsername, testPassword)
+		},
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 20 * time.Millisecond,
+		MaxQueued:  1,
+		Disconnected: func() {
+			disconnected <- struct{}{}
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewResilient() = %v", err)
+	}
+	defer rc.Close()
+
+	rt.setDialErr(errors.New("network is down"))
+	rt.killConn()
+	select {
+	case <-disconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for disconnection")
+	}
+
+	// One call is queued, the other one fails immediately
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			errs <- rc.Do(func(c *imapclient.Client) error {
+				return c.Noop().Wait()
+			})
+		}()
+	}
+	select {
+	case err := <-errs:
+		if !errors.Is(err, imapclient.ErrDisconnected) {
+			t.Errorf("Do() = %v, want ErrDisconnected", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for Do() to fail")
+	}
+
+	rt.setDialErr(nil)
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Errorf("queued Do() = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for queued Do()")
+	}
+}
+
+func TestResilientClient_selectFailed(t *testing.T) {
+	rt := newResilientTest(t)
+	defer rt.Close()
+
+	type selectFailure struct {
+		mailbox string
+		err     error
+	}
+	selectFailures := make(chan selectFailure, 1)
+	reconnected := make(chan struct{}, 1)
+	rc, err := imapclient.NewResilient(rt.dial, &imapclient.ResilientOptions{
+		SASLClient: func() sasl.Client {
+			return sasl.NewPlainClient("", testUsername, testPassword)
+		},
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 50 * time.Millisecond,
+		SelectFailed: func(mailbox string, err error) {
+			selectFailures <- selectFailure{mailbox, err}
+		},
+		Reconnected: func(*imapclient.Client) {
+			reconnected <- struct{}{}
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewResilient() = %v", err)
+	}
+	defer rc.Close()
+
+	if _, err := rc.Select("Archive", nil); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+	if err := rt.user.Delete("Archive"); err != nil {
+		t.Fatalf("Delete() = %v", err)
+	}
+
+	rt.killConn()
+	waitReconnected(t, reconnected)
+
+	select {
+	case failure := <-selectFailures:
+		if failure.mailbox != "Archive" || failure.err == nil {
+			t.Errorf("SelectFailed(%q, %v), want Archive and an error", failure.mailbox, failure.err)
+		}
+	default:
+		t.Errorf("SelectFailed not called")
+	}
+
+	err = rc.Do(func(c *imapclient.Client) error {
+		if mbox := c.Mailbox(); mbox != nil {
+			t.Errorf("Mailbox() = %v, want nil", mbox)
+		}
+		return c.Noop().Wait()
+	})
+	if err != nil {
+		t.Fatalf("Do() = %v", err)
+	}
+}
+
+func TestResilientClient_authFailed(t *testing.T) {
+	rt := newResilientTest(t)
+	defer rt.Close()
+
+	var (
+		mutex    sync.Mutex
+		password = testPassword
+	)
+	disconnected := make(chan struct{}, 1)
+	rc, err := imapclient.NewResilient(rt.dial, &imapclient.ResilientOptions{
+		SASLClient: func() sasl.Client {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return sasl.NewPlainClient("", testUsername, password)
+		},
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 50 * time.Millisecond,
+		MaxQueued:  1,
+		Disconnected: func() {
+			disconnected <- struct{}{}
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewResilient() = %v", err)
+	}
+	defer rc.Close()
+
+	mutex.Lock()
+	password = "wrong"
+	mutex.Unlock()
+	rt.killConn()
+	select {
+	case <-disconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for disconnection")
+	}
+
+	// The client must stop reconnecting instead of blocking Do forever
+	done := make(chan error, 1)
+	go func() {
+		done <- rc.Do(func(c *imapclient.Client) error {
+			return c.Noop().Wait()
+		})
+	}()
+	select {
+	case err := <-done:
+		var imapErr *imap.Error
+		if !errors.As(err, &imapErr) || imapErr.Type != imap.StatusResponseTypeNo {
+			t.Errorf("Do() = %v, want a NO response", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout waiting for Do() to fail")
+	}
+}
@@ -0,0 +1,255 @@
+package imapclient
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// MailboxSyncState is the state of a mailbox cached by the client, as
+// returned by a previous synchronization.
+type MailboxSyncState struct {
+	UIDValidity uint32
+	// Zero if unknown, e.g. because the server doesn't support CONDSTORE
+	HighestModSeq imap.ModSeq
+	// UIDs of the messages known to the client
+	UIDs imap.UIDSet
+}
+
+// MailboxSyncData is the data returned by Client.ResyncMailbox.
+type MailboxSyncData struct {
+	// If true, the UIDVALIDITY of the mailbox has changed: the cached state
+	// must be discarded and the mailbox must be downloaded again. Expunged
+	// and Changed are left empty.
+	FullResyncRequired bool
+
+	UIDValidity   uint32
+	UIDNext       imap.UID
+	HighestModSeq imap.ModSeq // zero if the server doesn't support CONDSTORE
+
+	// UIDs of the cached messages which have been expunged
+	Expunged imap.UIDSet
+	// Messages which have been added or changed since the cached state. If
+	// the server supports neither QRESYNC nor CONDSTORE, all messages are
+	// returned.
+	Changed []MailboxSyncMessage
+}
+
+// MailboxSyncMessage describes a message returned by Client.ResyncMailbox.
+type MailboxSyncMessage struct {
+	UID    imap.UID
+	Flags  []imap.Flag
+	ModSeq imap.ModSeq // requires CONDSTORE
+}
+
+// ResyncMailbox selects a mailbox and computes the changes since the cached
+// state.
+//
+// If the server supports QRESYNC, it is enabled and the changes are fetched
+// with a single SELECT command. If the server only supports CONDSTORE, the
+// changed messages are fetched with the CHANGEDSINCE modifier and the
+// expunged messages are found by searching the cached UIDs. Otherwise, the
+// flags of all messages are fetched.
+//
+// If cached is nil or cached.HighestModSeq is zero, the flags of all messages
+// are fetched.
+//
+// Unlike other commands, this method blocks until the synchronization
+// completes. The mailbox is left selected.
+func (c *Client) ResyncMailbox(name string, cached *MailboxSyncState) (*MailboxSyncData, error) {
+	if cached == nil {
+		cached = new(MailboxSyncState)
+	}
+	if cached.UIDs.Dynamic() {
+		return nil, fmt.Errorf("imapclient: cached UID set must not be dynamic")
+	}
+
+	caps := c.Caps()
+	if caps == nil {
+		return nil, fmt.Errorf("imapclient: failed to fetch capabilities")
+	}
+
+	incremental := cached.UIDValidity != 0 && cached.HighestModSeq != 0
+	if incremental && caps.Has(imap.CapQResync) {
+		return c.resyncQResync(name, cached)
+	}
+
+	selectData, err := c.Select(name, &imap.SelectOptions{
+		CondStore: caps.Has(imap.CapCondStore),
+	}).Wait()
+	if err != nil {
+		return nil, err
+	}
+	data := newMailboxSyncData(selectData, cached)
+	if data.FullResyncRequired {
+		return data, nil
+	}
+
+	// NOMODSEQ mailboxes don't support mod-sequences
+	if incremental && selectData.HighestModSeq != 0 {
+		err = c.resyncCondStore(data, cached)
+	} else {
+		err = c.resyncFull(data, cached)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (c *Client) resyncQResync(name string, cached *MailboxSyncState) (*MailboxSyncData, error) {
+	if !c.Enabled().Has(imap.CapQResync) {
+		data, err := c.Enable(imap.CapQResync).Wait()
+		if err != nil {
+			return nil, err
+		} else if !data.Caps.Has(imap.CapQResync) {
+			return nil, fmt.Errorf("imapclient: server refused to enable QRESYNC")
+		}
+	}
+
+	resync := &selectResync{}
+	cmd := c.sendSelect(name, &imap.SelectOptions{
+		QResync: &imap.SelectQResync{
+			UIDValidity: cached.UIDValidity,
+			ModSeq:      cached.HighestModSeq,
+			KnownUIDs:   cached.UIDs,
+		},
+	}, resync)
+	selectData, err := cmd.Wait()
+	resync.wg.Wait()
+	if err != nil {
+		return nil, err
+	} else if resync.err != nil {
+		return nil, resync.err
+	}
+
+	data := newMailboxSyncData(selectData, cached)
+	if data.FullResyncRequired {
+		return data, nil
+	}
+	// Without known UIDs, the server may include UIDs we've never seen
+	for _, uid := range uidSetNums(resync.vanished) {
+		if len(cached.UIDs) == 0 || cached.UIDs.Contains(uid) {
+			data.Expunged.AddNum(uid)
+		}
+	}
+	data.Changed = resync.changed
+	return data, nil
+}
+
+func (c *Client) resyncCondStore(data *MailboxSyncData, cached *MailboxSyncState) error {
+	changed, err := c.Fetch(imap.UIDSet{{Start: 1, Stop: 0}}, &imap.FetchOptions{
+		UID:          true,
+		Flags:        true,
+		ModSeq:       true,
+		ChangedSince: cached.HighestModSeq,
+	}).Collect()
+	if err != nil {
+		return err
+	}
+	for _, msg := range changed {
+		data.Changed = append(data.Changed, newMailboxSyncMessage(msg))
+	}
+
+	if len(cached.UIDs) == 0 {
+		return nil
+	}
+	searchData, err := c.UIDSearch(&imap.SearchCriteria{
+		UID: []imap.UIDSet{cached.UIDs},
+	}, nil).Wait()
+	if err != nil {
+		return err
+	}
+	uids, err := searchData.AllUIDs()
+	if err != nil {
+		return err
+	}
+	data.Expunged = uidSetDiff(cached.UIDs, imap.UIDSetNum(uids...))
+	return nil
+}
+
+func (c *Client) resyncFull(data *MailboxSyncData, cached *MailboxSyncState) error {
+	msgs, err := c.Fetch(imap.UIDSet{{Start: 1, Stop: 0}}, &imap.FetchOptions{
+		UID:    true,
+		Flags:  true,
+		ModSeq: data.HighestModSeq != 0,
+	}).Collect()
+	if err != nil {
+		return err
+	}
+
+	var present imap.UIDSet
+	for _, msg := range msgs {
+		present.AddNum(msg.UID)
+		data.Changed = append(data.Changed, newMailboxSyncMessage(msg))
+	}
+	data.Expunged = uidSetDiff(cached.UIDs, present)
+	return nil
+}
+
+func newMailboxSyncData(selectData *imap.SelectData, cached *MailboxSyncState) *MailboxSyncData {
+	return &MailboxSyncData{
+		FullResyncRequired: cached.UIDValidity != 0 && selectData.UIDValidity != cached.UIDValidity,
+		UIDValidity:        selectData.UIDValidity,
+		UIDNext:            selectData.UIDNext,
+		HighestModSeq:      selectData.HighestModSeq,
+	}
+}
+
+func newMailboxSyncMessage(msg *FetchMessageBuffer) MailboxSyncMessage {
+	return MailboxSyncMessage{
+		UID:    msg.UID,
+		Flags:  msg.Flags,
+		ModSeq: msg.ModSeq,
+	}
+}
+
+// uidSetDiff returns the UIDs in a which aren't in b.
+func uidSetDiff(a, b imap.UIDSet) imap.UIDSet {
+	var diff imap.UIDSet
+	for _, uid := range uidSetNums(a) {
+		if !b.Contains(uid) {
+			diff.AddNum(uid)
+		}
+	}
+	return diff
+}
+
+func uidSetNums(uids imap.UIDSet) []imap.UID {
+	nums, _ := uids.Nums()
+	return nums
+}
+
+// selectResync collects the responses to a SELECT command with the QRESYNC
+// parameter.
+type selectResync struct {
+	wg sync.WaitGroup
+
+	mutex    sync.Mutex
+	vanished imap.UIDSet
+	changed  []MailboxSyncMessage
+	err      error
+}
+
+func (resync *selectResync) addVanished(uids imap.UIDSet) {
+	resync.mutex.Lock()
+	resync.vanished.AddSet(uids)
+	resync.mutex.Unlock()
+}
+
+func (resync *selectResync) collect(msg *FetchMessageData) {
+	defer resync.wg.Done()
+
+	buf, err := msg.Collect()
+
+	resync.mutex.Lock()
+	defer resync.mutex.Unlock()
+	if err != nil {
+		if resync.err == nil {
+			resync.err = err
+		}
+		return
+	}
+	resync.changed = append(resync.changed, newMailboxSyncMessage(buf))
+}
@@ -0,0 +1,149 @@
+package imapclient_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+func TestClient_ResyncMailbox(t *testing.T) {
+	tests := []struct {
+		name string
+		caps imap.CapSet
+	}{
+		{"QRESYNC", imap.CapSet{imap.CapQResync: {}}},
+		{"CONDSTORE", imap.CapSet{imap.CapCondStore: {}}},
+		{"none", imap.CapSet{}},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			testResyncMailbox(t, tc.caps)
+		})
+	}
+}
+
+func testResyncMailbox(t *testing.T, extraCaps imap.CapSet) {
+	user := imapmemserver.NewUser(testUsername, testPassword)
+	user.Create("INBOX", nil)
+	dial := newCapsTestServer(t, user, extraCaps)
+
+	client := dial(nil)
+
+	var uids []imap.UID
+	for i := 0; i < 4; i++ {
+		uids = append(uids, appendTestMessage(t, client))
+	}
+
+	// Initial synchronization
+	data, err := client.ResyncMailbox("INBOX", nil)
+	if err != nil {
+		t.Fatalf("ResyncMailbox() = %v", err)
+	} else if data.FullResyncRequired || len(data.Changed) != len(uids) || len(data.Expunged) != 0 {
+		t.Fatalf("ResyncMailbox() = %#v, want %v changed messages", data, len(uids))
+	}
+	state := imapclient.MailboxSyncState{
+		UIDValidity:   data.UIDValidity,
+		HighestModSeq: data.HighestModSeq,
+		UIDs:          imap.UIDSetNum(uids...),
+	}
+	if err := client.Unselect().Wait(); err != nil {
+		t.Fatalf("Unselect().Wait() = %v", err)
+	}
+
+	// Another client flags a message, expunges another one and appends a
+	// new one
+	other := dial(nil)
+	if _, err := other.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select().Wait() = %v", err)
+	}
+	storeFlags := imap.StoreFlags{
+		Op:     imap.StoreFlagsAdd,
+		Silent: true,
+		Flags:  []imap.Flag{imap.FlagFlagged},
+	}
+	if err := other.Store(imap.UIDSetNum(uids[1]), &storeFlags, nil).Close(); err != nil {
+		t.Fatalf("Store().Close() = %v", err)
+	}
+	storeFlags.Flags = []imap.Flag{imap.FlagDeleted}
+	if err := other.Store(imap.UIDSetNum(uids[2]), &storeFlags, nil).Close(); err != nil {
+		t.Fatalf("Store().Close() = %v", err)
+	}
+	if err := other.Expunge().Close(); err != nil {
+		t.Fatalf("Expunge().Close() = %v", err)
+	}
+	newUID := appendTestMessage(t, other)
+
+	client = dial(nil)
+	data, err = client.ResyncMailbox("INBOX", &state)
+	if err != nil {
+		t.Fatalf("ResyncMailbox() = %v", err)
+	}
+	if data.FullResyncRequired {
+		t.Fatalf("ResyncMailbox() requires a full resync")
+	}
+	if want := imap.UIDSetNum(uids[2]).String(); data.Expunged.String() != want {
+		t.Errorf("Expunged = %v, want %v", data.Expunged, want)
+	}
+
+	changed := make(map[imap.UID]imapclient.MailboxSyncMessage)
+	var changedUIDs []imap.UID
+	for _, msg := range data.Changed {
+		changed[msg.UID] = msg
+		changedUIDs = append(changedUIDs, msg.UID)
+	}
+	sort.Slice(changedUIDs, func(i, j int) bool {
+		return changedUIDs[i] < changedUIDs[j]
+	})
+	wantChanged := []imap.UID{uids[1], newUID}
+	if len(extraCaps) == 0 {
+		// Without mod-sequences, all messages are returned
+		wantChanged = []imap.UID{uids[0], uids[1], uids[3], newUID}
+	}
+	if imap.UIDSetNum(changedUIDs...).String() != imap.UIDSetNum(wantChanged...).String() {
+		t.Errorf("changed UIDs = %v, want %v", changedUIDs, wantChanged)
+	}
+	if msg := changed[uids[1]]; !containsFlag(msg.Flags, imap.FlagFlagged) {
+		t.Errorf("flags of message %v = %v, want \\Flagged", uids[1], msg.Flags)
+	}
+	if len(extraCaps) > 0 && data.HighestModSeq <= state.HighestModSeq {
+		t.Errorf("HighestModSeq = %v, want more than %v", data.HighestModSeq, state.HighestModSeq)
+	}
+	if data.UIDNext != newUID+1 {
+		t.Errorf("UIDNext = %v, want %v", data.UIDNext, newUID+1)
+	}
+
+	// Re-create the mailbox to change its UIDVALIDITY
+	if err := other.Unselect().Wait(); err != nil {
+		t.Fatalf("Unselect().Wait() = %v", err)
+	}
+	if err := client.Unselect().Wait(); err != nil {
+		t.Fatalf("Unselect().Wait() = %v", err)
+	}
+	if err := user.Delete("INBOX"); err != nil {
+		t.Fatalf("Delete() = %v", err)
+	}
+	user.Create("INBOX", nil)
+
+	state.HighestModSeq = data.HighestModSeq
+	data, err = client.ResyncMailbox("INBOX", &state)
+	if err != nil {
+		t.Fatalf("ResyncMailbox() = %v", err)
+	} else if !data.FullResyncRequired {
+		t.Errorf("ResyncMailbox() doesn't require a full resync after UIDVALIDITY change")
+	}
+}
+
+func appendTestMessage(t *testing.T, client *imapclient.Client) imap.UID {
+	appendCmd := client.Append("INBOX", int64(len(simpleRawMessage)), nil)
+	appendCmd.Write([]byte(simpleRawMessage))
+	appendCmd.Close()
+	data, err := appendCmd.Wait()
+	if err != nil {
+		t.Fatalf("Append().Wait() = %v", err)
+	}
+	return data.UID
+}
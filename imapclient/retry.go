@@ -0,0 +1,129 @@
+package imapclient
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+const (
+	defaultRetryBackoff    = 100 * time.Millisecond
+	defaultRetryMaxBackoff = time.Minute
+)
+
+// RetryPolicy describes how ResilientClient.Do retries transient failures.
+type RetryPolicy struct {
+	// MaxRetries is the maximum number of times a failed call is retried.
+	MaxRetries int
+	// Backoff is the delay before the first retry. It doubles after each
+	// retry. If zero, 100ms is used.
+	Backoff time.Duration
+	// MaxBackoff is the maximum delay between retries. If zero, one minute is
+	// used.
+	MaxBackoff time.Duration
+	// Retryable reports whether an error is transient. If nil, IsRetryable
+	// is used.
+	Retryable func(err error) bool
+}
+
+func (policy *RetryPolicy) retryable(err error) bool {
+	if policy.Retryable != nil {
+		return policy.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+func (policy *RetryPolicy) backoff(retry int) time.Duration {
+	d := policy.Backoff
+	if d <= 0 {
+		d = defaultRetryBackoff
+	}
+	max := policy.MaxBackoff
+	if max <= 0 {
+		max = defaultRetryMaxBackoff
+	}
+	// Double the delay step by step: shifting by retry would overflow
+	for i := 0; i < retry && d < max; i++ {
+		if d > max/2 {
+			return max
+		}
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// IsRetryable reports whether a command failed because of a transient error,
+// which may not happen again if the command is retried: the server replied
+// NO or BYE with the UNAVAILABLE response code, NO with the SERVERBUG response
+// code, or the connection was lost.
+func IsRetryable(err error) bool {
+	var imapErr *imap.Error
+	if errors.As(err, &imapErr) {
+		switch imapErr.Type {
+		case imap.StatusResponseTypeNo:
+			return imapErr.Code == imap.ResponseCodeUnavailable || imapErr.Code == imap.ResponseCodeServerBug
+		case imap.StatusResponseTypeBye:
+			return imapErr.Code == imap.ResponseCodeUnavailable
+		default:
+			return false
+		}
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	case errors.Is(err, net.ErrClosed), errors.Is(err, io.ErrClosedPipe):
+		return true
+	case errors.Is(err, ErrConnStale), errors.As(err, &netErr):
+		return true
+	default:
+		return false
+	}
+}
+
+// UnknownOutcomeError is returned by ResilientClient.Do when the connection
+// was lost while a command which isn't idempotent was running, e.g. APPEND,
+// STORE, EXPUNGE or COPY. The server may or may not have executed the
+// command. Such commands are never retried.
+type UnknownOutcomeError struct {
+	Err error
+}
+
+func (err *UnknownOutcomeError) Error() string {
+	return fmt.Sprintf("imapclient: connection lost, command outcome unknown: %v", err.Err)
+}
+
+func (err *UnknownOutcomeError) Unwrap() error {
+	return err.Err
+}
+
+// isIdempotentCommand returns true if sending a command multiple times has
+// the same effect as sending it once.
+func isIdempotentCommand(name string) bool {
+	switch strings.TrimPrefix(name, "UID ") {
+	case "CAPABILITY", "NOOP", "FETCH", "SEARCH", "SORT", "THREAD", "STATUS",
+		"LIST", "LSUB", "XLIST", "NAMESPACE", "SELECT", "EXAMINE", "ID",
+		"GETQUOTA", "GETQUOTAROOT", "GETACL", "LISTRIGHTS", "MYRIGHTS",
+		"GETMETADATA", "IDLE":
+		return true
+	default:
+		return false
+	}
+}
+
+// nonIdempotentCommands returns the number of commands which aren't
+// idempotent sent so far.
+func (c *Client) nonIdempotentCommands() uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.numNonIdempotent
+}
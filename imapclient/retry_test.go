@@ -0,0 +1,210 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+// newScriptedResilient returns a ResilientClient whose successive connections
+// run the scripts.
+func newScriptedResilient(t *testing.T, scripts ...func(br *bufio.Reader, w io.Writer)) *imapclient.ResilientClient {
+	var (
+		mutex sync.Mutex
+		n     int
+	)
+	dial := func() (*imapclient.Client, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if n >= len(scripts) {
+			return nil, errors.New("no more scripted connections")
+		}
+		script := scripts[n]
+		n++
+		return newScriptedClient(t, "* PREAUTH [CAPABILITY IMAP4rev1] Server ready", script), nil
+	}
+
+	rc, err := imapclient.NewResilient(dial, &imapclient.ResilientOptions{
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 10 * time.Millisecond,
+		MaxQueued:  1,
+		Retry: &imapclient.RetryPolicy{
+			MaxRetries: 2,
+			Backoff:    time.Millisecond,
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewResilient() = %v", err)
+	}
+	t.Cleanup(func() {
+		rc.Close()
+	})
+	return rc
+}
+
+func fetchFlags(rc *imapclient.ResilientClient) ([]imap.Flag, error) {
+	var flags []imap.Flag
+	err := rc.Do(func(c *imapclient.Client) error {
+		msgs, err := c.Fetch(imap.UIDSetNum(1), &imap.FetchOptions{Flags: true}).Collect()
+		if len(msgs) > 0 {
+			flags = msgs[0].Flags
+		}
+		return err
+	})
+	return flags, err
+}
+
+func TestResilientClient_retry(t *testing.T) {
+	attempts := make(chan string, 2)
+	rc := newScriptedResilient(t, func(br *bufio.Reader, w io.Writer) {
+		tag, args := readScriptTaggedCommand(t, br, w)
+		attempts <- args
+		io.WriteString(w, tag+" NO [UNAVAILABLE] Try later\r\n")
+
+		tag, args = readScriptTaggedCommand(t, br, w)
+		attempts <- args
+		io.WriteString(w, "* 1 FETCH (UID 1 FLAGS (\\Seen))\r\n")
+		io.WriteString(w, tag+" OK FETCH completed\r\n")
+	})
+
+	flags, err := fetchFlags(rc)
+	if err != nil {
+		t.Fatalf("Do() = %v", err)
+	}
+	if len(flags) != 1 || flags[0] != imap.FlagSeen {
+		t.Errorf("flags = %v, want [\\Seen]", flags)
+	}
+	for i := 0; i < 2; i++ {
+		if cmd, want := <-attempts, "UID FETCH 1 (UID FLAGS)"; cmd != want {
+			t.Errorf("attempt %v = %q, want %q", i+1, cmd, want)
+		}
+	}
+}
+
+func TestResilientClient_retryReconnect(t *testing.T) {
+	rc := newScriptedResilient(t, func(br *bufio.Reader, w io.Writer) {
+		// The connection is lost while the FETCH command is running
+		readScriptTaggedCommand(t, br, w)
+		w.(io.Closer).Close()
+	}, func(br *bufio.Reader, w io.Writer) {
+		tag, _ := readScriptTaggedCommand(t, br, w)
+		io.WriteString(w, "* 1 FETCH (UID 1 FLAGS (\\Flagged))\r\n")
+		io.WriteString(w, tag+" OK FETCH completed\r\n")
+	})
+
+	flags, err := fetchFlags(rc)
+	if err != nil {
+		t.Fatalf("Do() = %v", err)
+	}
+	if len(flags) != 1 || flags[0] != imap.FlagFlagged {
+		t.Errorf("flags = %v, want [\\Flagged]", flags)
+	}
+}
+
+func TestResilientClient_unknownOutcome(t *testing.T) {
+	stores := make(chan string, 2)
+	rc := newScriptedResilient(t, func(br *bufio.Reader, w io.Writer) {
+		_, args := readScriptTaggedCommand(t, br, w)
+		stores <- args
+		w.(io.Closer).Close()
+	}, func(br *bufio.Reader, w io.Writer) {
+		tag, args := readScriptTaggedCommand(t, br, w)
+		stores <- args
+		io.WriteString(w, tag+" OK NOOP completed\r\n")
+	})
+
+	err := rc.Do(func(c *imapclient.Client) error {
+		return c.Store(imap.UIDSetNum(1), &imap.StoreFlags{
+			Op:     imap.StoreFlagsAdd,
+			Silent: true,
+			Flags:  []imap.Flag{imap.FlagDeleted},
+		}, nil).Close()
+	})
+	var unknownErr *imapclient.UnknownOutcomeError
+	if !errors.As(err, &unknownErr) {
+		t.Fatalf("Do() = %v, want an UnknownOutcomeError", err)
+	}
+	<-stores
+
+	// The STORE command isn't sent again after reconnecting
+	err = rc.Do(func(c *imapclient.Client) error {
+		return c.Noop().Wait()
+	})
+	if err != nil {
+		t.Fatalf("Do() = %v", err)
+	}
+	if cmd := <-stores; cmd != "NOOP" {
+		t.Errorf("command after reconnection = %q, want NOOP", cmd)
+	}
+}
+
+func TestResilientClient_retryIdle(t *testing.T) {
+	rc := newScriptedResilient(t, func(br *bufio.Reader, w io.Writer) {
+		tag, _ := readScriptTaggedCommand(t, br, w)
+		io.WriteString(w, tag+" NO [UNAVAILABLE] Try later\r\n")
+
+		tag, _ = readScriptTaggedCommand(t, br, w)
+		io.WriteString(w, "+ idling\r\n")
+		if line := readScriptCommand(t, br, w); line != "DONE" {
+			t.Errorf("got %q, want DONE", line)
+		}
+		io.WriteString(w, tag+" OK IDLE terminated\r\n")
+	})
+
+	err := rc.Do(func(c *imapclient.Client) error {
+		idleCmd, err := c.Idle()
+		if err != nil {
+			return err
+		}
+		if err := idleCmd.Close(); err != nil {
+			return err
+		}
+		return idleCmd.Wait()
+	})
+	if err != nil {
+		t.Fatalf("Do() = %v", err)
+	}
+}
+
+func TestResilientClient_retryMaxBackoff(t *testing.T) {
+	const maxRetries = 12
+
+	dial := func() (*imapclient.Client, error) {
+		return newScriptedClient(t, "* PREAUTH [CAPABILITY IMAP4rev1] Server ready", func(br *bufio.Reader, w io.Writer) {
+			for i := 0; i < maxRetries; i++ {
+				tag, _ := readScriptTaggedCommand(t, br, w)
+				io.WriteString(w, tag+" NO [UNAVAILABLE] Try later\r\n")
+			}
+			tag, _ := readScriptTaggedCommand(t, br, w)
+			io.WriteString(w, tag+" OK NOOP completed\r\n")
+		}), nil
+	}
+	rc, err := imapclient.NewResilient(dial, &imapclient.ResilientOptions{
+		Retry: &imapclient.RetryPolicy{
+			MaxRetries: maxRetries,
+			Backoff:    time.Millisecond,
+			MaxBackoff: time.Millisecond,
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewResilient() = %v", err)
+	}
+	defer rc.Close()
+
+	// Without MaxBackoff, the delays would add up to about 4s
+	start := time.Now()
+	if err := rc.Do(func(c *imapclient.Client) error {
+		return c.Noop().Wait()
+	}); err != nil {
+		t.Fatalf("Do() = %v", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("Do() took %v, want the backoff to be capped", d)
+	}
+}
@@ -0,0 +1,388 @@
+package imapclient
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-sasl"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// SCRAM mechanism names, as defined in RFC 5802 and RFC 7677.
+const (
+	SCRAMSHA1       = "SCRAM-SHA-1"
+	SCRAMSHA1Plus   = "SCRAM-SHA-1-PLUS"
+	SCRAMSHA256     = "SCRAM-SHA-256"
+	SCRAMSHA256Plus = "SCRAM-SHA-256-PLUS"
+)
+
+// SCRAMOptions contains options for NewSCRAMClient.
+type SCRAMOptions struct {
+	Username string
+	Password string
+	// TLS connection state, used for channel binding. It's required for the
+	// -PLUS mechanisms.
+	TLSConnectionState *tls.ConnectionState
+	// Nonce returns a new client nonce. If nil, a random nonce is generated.
+	Nonce func() (string, error)
+}
+
+// NewSCRAMClient creates a new SASL client for a SCRAM mechanism.
+//
+// The username and password are prepared with SASLprep, however Unicode
+// normalization isn't performed: they must already be in NFKC form.
+//
+// The client returns an error if the server signature doesn't match. The
+// caller must ensure the server has sent its signature by checking that the
+// exchange didn't succeed early, Client.AuthenticateSCRAM takes care of this.
+func NewSCRAMClient(mech string, options *SCRAMOptions) (sasl.Client, error) {
+	return newSCRAMClient(mech, options)
+}
+
+func newSCRAMClient(mech string, options *SCRAMOptions) (*scramClient, error) {
+	var newHash func() hash.Hash
+	switch strings.TrimSuffix(mech, "-PLUS") {
+	case SCRAMSHA1:
+		newHash = sha1.New
+	case SCRAMSHA256:
+		newHash = sha256.New
+	default:
+		return nil, fmt.Errorf("imapclient: unsupported SCRAM mechanism %q", mech)
+	}
+
+	username, err := saslPrep(options.Username)
+	if err != nil {
+		return nil, fmt.Errorf("imapclient: invalid SCRAM username: %v", err)
+	}
+	password, err := saslPrep(options.Password)
+	if err != nil {
+		return nil, fmt.Errorf("imapclient: invalid SCRAM password: %v", err)
+	}
+
+	client := &scramClient{
+		mech:     mech,
+		newHash:  newHash,
+		username: username,
+		password: password,
+		nonce:    options.Nonce,
+	}
+
+	if strings.HasSuffix(mech, "-PLUS") {
+		if options.TLSConnectionState == nil {
+			return nil, fmt.Errorf("imapclient: %v requires TLS", mech)
+		}
+		cbType, cbData, err := tlsChannelBinding(options.TLSConnectionState)
+		if err != nil {
+			return nil, err
+		}
+		client.gs2Header = "p=" + cbType + ",,"
+		client.cbData = cbData
+	} else if options.TLSConnectionState != nil {
+		// We support channel binding, but the server doesn't
+		client.gs2Header = "y,,"
+	} else {
+		client.gs2Header = "n,,"
+	}
+
+	return client, nil
+}
+
+// AuthenticateSCRAM authenticates with the best SCRAM mechanism supported by
+// the server.
+//
+// The -PLUS mechanisms are preferred when TLS is active, and SHA-256 is
+// preferred over SHA-1.
+func (c *Client) AuthenticateSCRAM(username, password string) error {
+	caps := c.Caps()
+	if caps == nil {
+		return fmt.Errorf("imapclient: failed to fetch capabilities")
+	}
+
+	options := SCRAMOptions{
+		Username: username,
+		Password: password,
+	}
+	if tlsState, ok := c.TLSConnectionState(); ok {
+		options.TLSConnectionState = &tlsState
+	}
+
+	mech := chooseSCRAMMechanism(caps, options.TLSConnectionState != nil)
+	if mech == "" {
+		return fmt.Errorf("imapclient: server doesn't support SCRAM")
+	}
+
+	saslClient, err := newSCRAMClient(mech, &options)
+	if err != nil {
+		return err
+	}
+	if err := c.Authenticate(saslClient); err != nil {
+		return err
+	}
+	if !saslClient.verified {
+		// The server sent a successful response without proving it knows
+		// the password
+		c.Close()
+		return fmt.Errorf("imapclient: %v server signature missing", mech)
+	}
+	return nil
+}
+
+func chooseSCRAMMechanism(caps imap.CapSet, hasTLS bool) string {
+	var mechs []string
+	if hasTLS {
+		mechs = append(mechs, SCRAMSHA256Plus, SCRAMSHA1Plus)
+	}
+	mechs = append(mechs, SCRAMSHA256, SCRAMSHA1)
+
+	for _, mech := range mechs {
+		if caps.Has(imap.AuthCap(mech)) {
+			return mech
+		}
+	}
+	return ""
+}
+
+// tlsChannelBinding returns the channel binding type and data for a TLS
+// connection: tls-exporter (RFC 9266) for TLS 1.3 and tls-unique (RFC 5929)
+// for earlier versions.
+func tlsChannelBinding(state *tls.ConnectionState) (cbType string, data []byte, err error) {
+	if state.Version >= tls.VersionTLS13 {
+		data, err := state.ExportKeyingMaterial("EXPORTER-Channel-Binding", nil, 32)
+		if err != nil {
+			return "", nil, fmt.Errorf("imapclient: failed to export TLS keying material: %v", err)
+		}
+		return "tls-exporter", data, nil
+	}
+	if len(state.TLSUnique) == 0 {
+		return "", nil, fmt.Errorf("imapclient: TLS channel binding unavailable")
+	}
+	return "tls-unique", state.TLSUnique, nil
+}
+
+type scramClient struct {
+	mech               string
+	newHash            func() hash.Hash
+	username, password string
+	nonce              func() (string, error)
+	gs2Header          string
+	cbData             []byte
+
+	step            int
+	clientNonce     string
+	clientFirstBare string
+	serverSignature []byte
+	verified        bool
+}
+
+var _ sasl.Client = (*scramClient)(nil)
+
+func (sc *scramClient) Start() (mech string, ir []byte, err error) {
+	if sc.nonce != nil {
+		sc.clientNonce, err = sc.nonce()
+	} else {
+		sc.clientNonce, err = randomSCRAMNonce()
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	sc.clientFirstBare = "n=" + escapeSCRAMName(sc.username) + ",r=" + sc.clientNonce
+	return sc.mech, []byte(sc.gs2Header + sc.clientFirstBare), nil
+}
+
+func (sc *scramClient) Next(challenge []byte) ([]byte, error) {
+	sc.step++
+	switch sc.step {
+	case 1:
+		return sc.handleServerFirst(string(challenge))
+	case 2:
+		return nil, sc.handleServerFinal(string(challenge))
+	default:
+		return nil, fmt.Errorf("imapclient: unexpected SCRAM challenge")
+	}
+}
+
+func (sc *scramClient) handleServerFirst(serverFirst string) ([]byte, error) {
+	attrs, err := parseSCRAMAttrs(serverFirst)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := attrs['m']; ok {
+		return nil, fmt.Errorf("imapclient: unsupported SCRAM mandatory extension")
+	}
+
+	nonce := attrs['r']
+	if len(nonce) <= len(sc.clientNonce) || !strings.HasPrefix(nonce, sc.clientNonce) {
+		return nil, fmt.Errorf("imapclient: invalid SCRAM server nonce")
+	}
+	salt, err := base64.StdEncoding.DecodeString(attrs['s'])
+	if err != nil || len(salt) == 0 {
+		return nil, fmt.Errorf("imapclient: invalid SCRAM salt")
+	}
+	iter, err := strconv.Atoi(attrs['i'])
+	if err != nil || iter <= 0 {
+		return nil, fmt.Errorf("imapclient: invalid SCRAM iteration count")
+	}
+
+	cbInput := append([]byte(sc.gs2Header), sc.cbData...)
+	clientFinalWithoutProof := "c=" + base64.StdEncoding.EncodeToString(cbInput) + ",r=" + nonce
+	authMessage := []byte(sc.clientFirstBare + "," + serverFirst + "," + clientFinalWithoutProof)
+
+	saltedPassword := pbkdf2(sc.newHash, []byte(sc.password), salt, iter)
+	clientKey := sc.hmac(saltedPassword, []byte("Client Key"))
+	h := sc.newHash()
+	h.Write(clientKey)
+	storedKey := h.Sum(nil)
+	clientSignature := sc.hmac(storedKey, authMessage)
+
+	proof := make([]byte, len(clientKey))
+	for i := range proof {
+		proof[i] = clientKey[i] ^ clientSignature[i]
+	}
+
+	serverKey := sc.hmac(saltedPassword, []byte("Server Key"))
+	sc.serverSignature = sc.hmac(serverKey, authMessage)
+
+	clientFinal := clientFinalWithoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof)
+	return []byte(clientFinal), nil
+}
+
+func (sc *scramClient) handleServerFinal(serverFinal string) error {
+	attrs, err := parseSCRAMAttrs(serverFinal)
+	if err != nil {
+		return err
+	}
+	if e, ok := attrs['e']; ok {
+		return fmt.Errorf("imapclient: SCRAM server error: %v", e)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(attrs['v'])
+	if err != nil || !hmac.Equal(sig, sc.serverSignature) {
+		return fmt.Errorf("imapclient: invalid SCRAM server signature")
+	}
+	sc.verified = true
+	return nil
+}
+
+func (sc *scramClient) hmac(key, b []byte) []byte {
+	mac := hmac.New(sc.newHash, key)
+	mac.Write(b)
+	return mac.Sum(nil)
+}
+
+func parseSCRAMAttrs(s string) (map[byte]string, error) {
+	attrs := make(map[byte]string)
+	for _, kv := range strings.Split(s, ",") {
+		if len(kv) < 2 || kv[1] != '=' {
+			return nil, fmt.Errorf("imapclient: malformed SCRAM message")
+		}
+		attrs[kv[0]] = kv[2:]
+	}
+	return attrs, nil
+}
+
+func escapeSCRAMName(s string) string {
+	s = strings.ReplaceAll(s, "=", "=3D")
+	return strings.ReplaceAll(s, ",", "=2C")
+}
+
+func randomSCRAMNonce() (string, error) {
+	var b [18]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b[:]), nil
+}
+
+// pbkdf2 implements PBKDF2 (RFC 8018) with a derived key as long as the hash
+// output, as required by SCRAM's Hi function.
+func pbkdf2(newHash func() hash.Hash, password, salt []byte, iter int) []byte {
+	mac := hmac.New(newHash, password)
+	mac.Write(salt)
+	var blockIndex [4]byte
+	binary.BigEndian.PutUint32(blockIndex[:], 1)
+	mac.Write(blockIndex[:])
+	u := mac.Sum(nil)
+
+	out := append([]byte(nil), u...)
+	for i := 1; i < iter; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range out {
+			out[j] ^= u[j]
+		}
+	}
+	return out
+}
+
+// saslPrep prepares a string with the SASLprep profile (RFC 4013).
+//
+// Unicode normalization and bidirectional checks aren't performed.
+func saslPrep(s string) (string, error) {
+	var sb strings.Builder
+	for _, r := range s {
+		switch {
+		case isSASLPrepNonASCIISpace(r):
+			sb.WriteRune(' ')
+		case isSASLPrepMappedToNothing(r):
+			// skip
+		case isSASLPrepProhibited(r):
+			return "", fmt.Errorf("prohibited character %U", r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String(), nil
+}
+
+// RFC 3454 table C.1.2
+func isSASLPrepNonASCIISpace(r rune) bool {
+	switch r {
+	case 0x00A0, 0x1680, 0x202F, 0x205F, 0x3000:
+		return true
+	}
+	return r >= 0x2000 && r <= 0x200B
+}
+
+// RFC 3454 table B.1
+func isSASLPrepMappedToNothing(r rune) bool {
+	switch r {
+	case 0x00AD, 0x034F, 0x1806, 0x2060, 0xFEFF:
+		return true
+	}
+	return (r >= 0x180B && r <= 0x180D) || (r >= 0x200C && r <= 0x200D) || (r >= 0xFE00 && r <= 0xFE0F)
+}
+
+// RFC 3454 tables C.2 to C.9
+func isSASLPrepProhibited(r rune) bool {
+	switch {
+	case r < 0x20 || (r >= 0x7F && r <= 0x9F): // control characters
+		return true
+	case r == 0x06DD || r == 0x070F || r == 0x180E || (r >= 0x2028 && r <= 0x2029) || (r >= 0x2061 && r <= 0x2063) || (r >= 0x206A && r <= 0x206F) || (r >= 0xFFF9 && r <= 0xFFFD) || (r >= 0x1D173 && r <= 0x1D17A):
+		return true // other control characters, inappropriate for plain text
+	case (r >= 0xE000 && r <= 0xF8FF) || r >= 0xF0000: // private use
+		return true
+	case (r >= 0xFDD0 && r <= 0xFDEF) || r&0xFFFE == 0xFFFE: // non-characters
+		return true
+	case r >= 0xD800 && r <= 0xDFFF: // surrogates
+		return true
+	case r >= 0x2FF0 && r <= 0x2FFB: // ideographic description characters
+		return true
+	case r == 0x0340 || r == 0x0341 || r == 0x200E || r == 0x200F || (r >= 0x202A && r <= 0x202E):
+		return true // change display properties or deprecated
+	case r == 0xE0001 || (r >= 0xE0020 && r <= 0xE007F): // tagging characters
+		return true
+	}
+	return false
+}
@@ -0,0 +1,243 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+var scramTestVectors = []struct {
+	mech                     string
+	clientNonce              string
+	clientFirst, serverFirst string
+	clientFinal, serverFinal string
+}{
+	// RFC 5802 section 5
+	{
+		mech:        imapclient.SCRAMSHA1,
+		clientNonce: "fyko+d2lbbFgONRv9qkxdawL",
+		clientFirst: "n,,n=user,r=fyko+d2lbbFgONRv9qkxdawL",
+		serverFirst: "r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,s=QSXCR+Q6sek8bf92,i=4096",
+		clientFinal: "c=biws,r=fyko+d2lbbFgONRv9qkxdawL3rfcNHYJY1ZVvWVs7j,p=v0X8v3Bz2T0CJGbJQyF0X+HI4Ts=",
+		serverFinal: "v=rmF9pqV8S7suAoZWja4dJRkFsKQ=",
+	},
+	// RFC 7677 section 3
+	{
+		mech:        imapclient.SCRAMSHA256,
+		clientNonce: "rOprNGfwEbeRWgbNEkqO",
+		clientFirst: "n,,n=user,r=rOprNGfwEbeRWgbNEkqO",
+		serverFirst: "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+		clientFinal: "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=",
+		serverFinal: "v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=",
+	},
+}
+
+func TestSCRAMClient(t *testing.T) {
+	for _, tc := range scramTestVectors {
+		tc := tc
+		t.Run(tc.mech, func(t *testing.T) {
+			saslClient, err := imapclient.NewSCRAMClient(tc.mech, &imapclient.SCRAMOptions{
+				Username: "user",
+				Password: "pencil",
+				Nonce: func() (string, error) {
+					return tc.clientNonce, nil
+				},
+			})
+			if err != nil {
+				t.Fatalf("NewSCRAMClient() = %v", err)
+			}
+
+			mech, ir, err := saslClient.Start()
+			if err != nil {
+				t.Fatalf("Start() = %v", err)
+			} else if mech != tc.mech || string(ir) != tc.clientFirst {
+				t.Errorf("Start() = %q, %q, want %q, %q", mech, ir, tc.mech, tc.clientFirst)
+			}
+
+			resp, err := saslClient.Next([]byte(tc.serverFirst))
+			if err != nil {
+				t.Fatalf("Next(server-first) = %v", err)
+			} else if string(resp) != tc.clientFinal {
+				t.Errorf("Next(server-first) = %q, want %q", resp, tc.clientFinal)
+			}
+
+			if _, err := saslClient.Next([]byte(tc.serverFinal)); err != nil {
+				t.Errorf("Next(server-final) = %v", err)
+			}
+		})
+	}
+}
+
+func TestSCRAMClient_invalidServerSignature(t *testing.T) {
+	tc := scramTestVectors[1]
+	saslClient, err := imapclient.NewSCRAMClient(tc.mech, &imapclient.SCRAMOptions{
+		Username: "user",
+		Password: "not pencil",
+		Nonce: func() (string, error) {
+			return tc.clientNonce, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewSCRAMClient() = %v", err)
+	}
+	if _, _, err := saslClient.Start(); err != nil {
+		t.Fatalf("Start() = %v", err)
+	}
+	if _, err := saslClient.Next([]byte(tc.serverFirst)); err != nil {
+		t.Fatalf("Next(server-first) = %v", err)
+	}
+	if _, err := saslClient.Next([]byte(tc.serverFinal)); err == nil {
+		t.Errorf("Next(server-final) succeeded with a wrong password")
+	}
+}
+
+func TestSCRAMClient_saslPrep(t *testing.T) {
+	// U+00A0 NO-BREAK SPACE is mapped to a space, U+00AD SOFT HYPHEN to
+	// nothing
+	saslClient, err := imapclient.NewSCRAMClient(imapclient.SCRAMSHA256, &imapclient.SCRAMOptions{
+		Username: "us\u00ader\u00a0name,=",
+		Password: "pencil",
+		Nonce: func() (string, error) {
+			return "nonce", nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewSCRAMClient() = %v", err)
+	}
+	_, ir, err := saslClient.Start()
+	if want := "n,,n=user name=2C=3D,r=nonce"; err != nil || string(ir) != want {
+		t.Errorf("Start() = %q, %v, want %q", ir, err, want)
+	}
+
+	_, err = imapclient.NewSCRAMClient(imapclient.SCRAMSHA256, &imapclient.SCRAMOptions{
+		Username: "user",
+		Password: "pen\x07cil",
+	})
+	if err == nil {
+		t.Errorf("NewSCRAMClient() accepted a password with a control character")
+	}
+}
+
+func TestClient_AuthenticateSCRAM_exchange(t *testing.T) {
+	tc := scramTestVectors[1]
+	greeting := "* OK [CAPABILITY IMAP4rev1 SASL-IR AUTH=SCRAM-SHA-256] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		fields := readScriptLine(t, br)
+		if len(fields) != 4 || fields[2] != tc.mech || decodeScriptSASL(t, fields[3]) != tc.clientFirst {
+			t.Errorf("got command %q, want AUTHENTICATE %v with client-first", fields, tc.mech)
+			return
+		}
+		io.WriteString(w, "+ "+base64.StdEncoding.EncodeToString([]byte(tc.serverFirst))+"\r\n")
+		if resp := readScriptLine(t, br); len(resp) != 1 || decodeScriptSASL(t, resp[0]) != tc.clientFinal {
+			t.Errorf("got client-final %q, want %q", resp, tc.clientFinal)
+		}
+		io.WriteString(w, "+ "+base64.StdEncoding.EncodeToString([]byte(tc.serverFinal))+"\r\n")
+		if resp := readScriptLine(t, br); len(resp) != 1 || resp[0] != "" {
+			t.Errorf("got response %q, want an empty line", resp)
+		}
+		io.WriteString(w, fields[0]+" OK Success\r\n")
+	})
+
+	saslClient, err := imapclient.NewSCRAMClient(tc.mech, &imapclient.SCRAMOptions{
+		Username: "user",
+		Password: "pencil",
+		Nonce: func() (string, error) {
+			return tc.clientNonce, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewSCRAMClient() = %v", err)
+	}
+	if err := client.Authenticate(saslClient); err != nil {
+		t.Fatalf("Authenticate() = %v", err)
+	}
+}
+
+func TestClient_AuthenticateSCRAM_missingServerSignature(t *testing.T) {
+	greeting := "* OK [CAPABILITY IMAP4rev1 SASL-IR AUTH=SCRAM-SHA-1 AUTH=SCRAM-SHA-256 AUTH=SCRAM-SHA-256-PLUS] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		fields := readScriptLine(t, br)
+		if len(fields) != 4 || fields[2] != imapclient.SCRAMSHA256 {
+			t.Errorf("got command %q, want AUTHENTICATE SCRAM-SHA-256 without TLS", fields)
+			return
+		}
+		clientFirst := decodeScriptSASL(t, fields[3])
+		nonce := clientFirst[strings.Index(clientFirst, ",r=")+3:]
+		if !strings.HasPrefix(clientFirst, "n,,") {
+			t.Errorf("client-first = %q, want no channel binding", clientFirst)
+		}
+		serverFirst := "r=" + nonce + "server,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"
+		io.WriteString(w, "+ "+base64.StdEncoding.EncodeToString([]byte(serverFirst))+"\r\n")
+		readScriptLine(t, br)
+		// Succeed without sending the server signature
+		io.WriteString(w, fields[0]+" OK Success\r\n")
+	})
+
+	if err := client.AuthenticateSCRAM("user", "pencil"); err == nil {
+		t.Errorf("AuthenticateSCRAM() succeeded without server signature")
+	}
+}
+
+func TestClient_AuthenticateSCRAM_channelBinding(t *testing.T) {
+	cert, err := tls.X509KeyPair([]byte(rsaCertPEM), []byte(rsaKeyPEM))
+	if err != nil {
+		t.Fatalf("tls.X509KeyPair() = %v", err)
+	}
+
+	clientConn, serverConn := net.Pipe()
+	tlsServerConn := tls.Server(serverConn, &tls.Config{Certificates: []tls.Certificate{cert}})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer tlsServerConn.Close()
+
+		io.WriteString(tlsServerConn, "* OK [CAPABILITY IMAP4rev1 SASL-IR AUTH=SCRAM-SHA-256 AUTH=SCRAM-SHA-256-PLUS] Server ready\r\n")
+		br := bufio.NewReader(tlsServerConn)
+		fields := readScriptLine(t, br)
+		if len(fields) != 4 || fields[2] != imapclient.SCRAMSHA256Plus {
+			t.Errorf("got command %q, want AUTHENTICATE SCRAM-SHA-256-PLUS", fields)
+			return
+		}
+		clientFirst := decodeScriptSASL(t, fields[3])
+		const gs2Header = "p=tls-exporter,,"
+		if !strings.HasPrefix(clientFirst, gs2Header) {
+			t.Errorf("client-first = %q, want tls-exporter channel binding", clientFirst)
+		}
+		nonce := clientFirst[strings.Index(clientFirst, ",r=")+3:]
+		serverFirst := "r=" + nonce + "server,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"
+		io.WriteString(tlsServerConn, "+ "+base64.StdEncoding.EncodeToString([]byte(serverFirst))+"\r\n")
+
+		state := tlsServerConn.ConnectionState()
+		cbData, err := state.ExportKeyingMaterial("EXPORTER-Channel-Binding", nil, 32)
+		if err != nil {
+			t.Errorf("ExportKeyingMaterial() = %v", err)
+		}
+		wantC := "c=" + base64.StdEncoding.EncodeToString(append([]byte(gs2Header), cbData...)) + ","
+		if resp := readScriptLine(t, br); len(resp) != 1 || !strings.HasPrefix(decodeScriptSASL(t, resp[0]), wantC) {
+			t.Errorf("got client-final %q, want prefix %q", resp, wantC)
+		}
+		io.WriteString(tlsServerConn, fields[0]+" NO [AUTHENTICATIONFAILED] Invalid credentials\r\n")
+		io.Copy(io.Discard, tlsServerConn)
+	}()
+	defer func() {
+		clientConn.Close()
+		<-done
+	}()
+
+	client := imapclient.New(tls.Client(clientConn, &tls.Config{InsecureSkipVerify: true}), nil)
+	defer client.Close()
+
+	err = client.AuthenticateSCRAM("user", "pencil")
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeAuthenticationFailed {
+		t.Errorf("AuthenticateSCRAM() = %v, want AUTHENTICATIONFAILED", err)
+	}
+}
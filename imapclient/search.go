@@ -1,13 +1,14 @@
 package imapclient
 
 import (
+	"context"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 	"unicode"
 
 	"github.com/emersion/go-imap/v2"
-	"github.com/emersion/go-imap/v2/internal"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
@@ -16,18 +17,24 @@ func returnSearchOptions(options *imap.SearchOptions) []string {
 		return nil
 	}
 
-	m := map[string]bool{
-		"MIN":   options.ReturnMin,
-		"MAX":   options.ReturnMax,
-		"ALL":   options.ReturnAll,
-		"COUNT": options.ReturnCount,
-	}
-
 	var l []string
-	for k, ret := range m {
-		if ret {
-			l = append(l, k)
-		}
+	if options.ReturnMin {
+		l = append(l, "MIN")
+	}
+	if options.ReturnMax {
+		l = append(l, "MAX")
+	}
+	if options.ReturnAll {
+		l = append(l, "ALL")
+	}
+	if options.ReturnCount {
+		l = append(l, "COUNT")
+	}
+	if options.ReturnSave {
+		l = append(l, "SAVE")
+	}
+	if r := options.ReturnPartial; r != nil {
+		l = append(l, "PARTIAL "+r.String())
 	}
 	return l
 }
@@ -43,10 +50,36 @@ func (c *Client) search(numKind imapwire.NumKind, criteria *imap.SearchCriteria,
 	// decode encoded headers and Content-Transfer-Encoding before matching the
 	// criteria.
 	var charset string
-	if !c.Caps().Has(imap.CapIMAP4rev2) && !c.enabled.Has(imap.CapUTF8Accept) && !searchCriteriaIsASCII(criteria) {
+	if !c.Caps().Has(imap.CapIMAP4rev2) && !c.Enabled().Has(imap.CapUTF8Accept) && !searchCriteriaIsASCII(criteria) {
 		charset = "UTF-8"
 	}
 
+	if options != nil && options.ReturnPartial != nil {
+		if err := c.checkCap(imap.CapPartial); err != nil {
+			return &SearchCommand{commandBase: failedCommandBase(err)}
+		}
+	}
+
+	if options != nil && options.ReturnSave {
+		if err := c.checkCap(imap.CapSearchRes); err != nil {
+			return &SearchCommand{commandBase: failedCommandBase(err)}
+		}
+	}
+	if searchCriteriaUsesSearchRes(criteria) {
+		if err := c.checkSearchRes(imap.SearchRes()); err != nil {
+			return &SearchCommand{commandBase: failedCommandBase(err)}
+		}
+	}
+
+	// Without ESEARCH, return options are computed by the client. The saved
+	// result can't be emulated.
+	returnOpts := returnSearchOptions(options)
+	var fallbackOptions *imap.SearchOptions
+	if len(returnOpts) > 0 && !c.Caps().Has(imap.CapIMAP4rev2) && !c.Caps().Has(imap.CapESearch) {
+		fallbackOptions = options
+		returnOpts = nil
+	}
+
 	var all imap.NumSet
 	switch numKind {
 	case imapwire.NumKindSeq:
@@ -55,24 +88,47 @@ func (c *Client) search(numKind imapwire.NumKind, criteria *imap.SearchCriteria,
 		all = imap.UIDSet(nil)
 	}
 
-	cmd := &SearchCommand{}
+	cmd := &SearchCommand{
+		fallbackOptions: fallbackOptions,
+		// SAVE is dropped along with the other return options
+		save: options != nil && options.ReturnSave && fallbackOptions == nil,
+	}
 	cmd.data.All = all
+	if cmd.save {
+		cmd.saveDone = make(chan struct{})
+	}
 	enc := c.beginCommand(uidCmdName("SEARCH", numKind), cmd)
-	if returnOpts := returnSearchOptions(options); len(returnOpts) > 0 {
+	if cmd.save {
+		c.mutex.Lock()
+		c.searchRes = true
+		c.searchResDone = cmd.saveDone
+		c.mutex.Unlock()
+	}
+	if len(returnOpts) > 0 {
 		enc.SP().Atom("RETURN").SP().List(len(returnOpts), func(i int) {
 			enc.Atom(returnOpts[i])
 		})
 	}
 	enc.SP()
 	if charset != "" {
-		enc.Atom("CHARSET").SP().Atom(charset).SP()
+		enc.Atom("CHARSET").SP().AString(charset).SP()
 	}
-	writeSearchKey(enc.Encoder, criteria)
+	writeSearchKey(enc.Encoder, criteria, c.Caps().Has(imap.CapWithin))
 	enc.end()
 	return cmd
 }
 
 // Search sends a SEARCH command.
+//
+// Return options require IMAP4rev2 or ESEARCH. If the server supports
+// neither, a regular SEARCH command is sent and the requested results are
+// computed by the client, except ReturnSave which requires SEARCHRES: the
+// result isn't saved and SearchData.Saved is false.
+//
+// With ReturnSave, the result can be referred to with imap.SearchRes in
+// subsequent commands on the selected mailbox. These commands wait for the
+// SEARCH command to complete before being sent, and fail without being sent
+// if no result has been saved.
 func (c *Client) Search(criteria *imap.SearchCriteria, options *imap.SearchOptions) *SearchCommand {
 	return c.search(imapwire.NumKindSeq, criteria, options)
 }
@@ -92,7 +148,7 @@ func (c *Client) handleSearch() error {
 			} else if strings.ToUpper(name) != "MODSEQ" {
 				return fmt.Errorf("in search-sort-mod-seq: expected %q, got %q", "MODSEQ", name)
 			}
-			var modSeq uint64
+			var modSeq imap.ModSeq
 			if !c.dec.ExpectModSeq(&modSeq) || !c.dec.ExpectSpecial(')') {
 				return c.dec.Err()
 			}
@@ -124,24 +180,45 @@ func (c *Client) handleESearch() error {
 	if !c.dec.ExpectSP() {
 		return c.dec.Err()
 	}
-	tag, data, err := readESearchResponse(c.dec)
+	tag, err := readSearchCorrelator(c.dec)
 	if err != nil {
 		return err
 	}
 	cmd := c.findPendingCmdFunc(func(anyCmd command) bool {
-		cmd, ok := anyCmd.(*SearchCommand)
-		if !ok {
+		switch cmd := anyCmd.(type) {
+		case *SearchCommand:
+			// ok
+		case *SortCommand:
+			if !cmd.esort {
+				return false
+			}
+		default:
 			return false
 		}
-		if tag != "" {
-			return cmd.tag == tag
-		} else {
-			return true
-		}
+		return tag == "" || anyCmd.base().tag == tag
 	})
-	if cmd != nil {
-		cmd := cmd.(*SearchCommand)
+
+	// ESORT results are ordered
+	sortCmd, _ := cmd.(*SortCommand)
+	var sortedAll *[]uint32
+	if sortCmd != nil {
+		sortedAll = &sortCmd.nums
+	}
+
+	data, err := readESearchResponse(c.dec, sortedAll)
+	if err != nil {
+		return err
+	}
+	switch cmd := cmd.(type) {
+	case *SearchCommand:
+		if data.All == nil {
+			// Preserve the kind of number set
+			data.All = cmd.data.All
+		}
+		data.Tag = tag
 		cmd.data = *data
+	case *SortCommand:
+		cmd.esearch = *data
 	}
 	return nil
 }
@@ -149,217 +226,313 @@ func (c *Client) handleESearch() error {
 // SearchCommand is a SEARCH command.
 type SearchCommand struct {
 	commandBase
-	data imap.SearchData
-}
-
-func (cmd *SearchCommand) Wait() (*imap.SearchData, error) {
-	return &cmd.data, cmd.wait()
+	data            imap.SearchData
+	fallbackOptions *imap.SearchOptions
+	save            bool
+	saveDone        chan struct{} // closed when a SEARCH SAVE command completes
 }
 
-func writeSearchKey(enc *imapwire.Encoder, criteria *imap.SearchCriteria) {
-	firstItem := true
-	encodeItem := func() *imapwire.Encoder {
-		if !firstItem {
-			enc.SP()
-		}
-		firstItem = false
-		return enc
+// checkSearchRes checks that a search result has been saved if the sequence
+// set refers to it, see imap.SearchRes.
+//
+// It waits for the last SEARCH SAVE command to complete, so that commands
+// queued for the pipeline can't be sent before it.
+func (c *Client) checkSearchRes(numSet imap.NumSet) error {
+	if !imap.IsSearchRes(numSet) {
+		return nil
 	}
 
-	for _, seqSet := range criteria.SeqNum {
-		encodeItem().NumSet(seqSet)
+	c.mutex.Lock()
+	saved, done := c.searchRes, c.searchResDone
+	c.mutex.Unlock()
+	if !saved {
+		return fmt.Errorf("imapclient: no search result saved in the selected mailbox, see SearchOptions.ReturnSave")
 	}
-	for _, uidSet := range criteria.UID {
-		encodeItem().Atom("UID").SP().NumSet(uidSet)
+	<-done
+	return nil
+}
+
+func (cmd *SearchCommand) Wait() (*imap.SearchData, error) {
+	err := cmd.wait()
+	if err != nil {
+		return &cmd.data, err
 	}
 
-	if !criteria.Since.IsZero() && !criteria.Before.IsZero() && criteria.Before.Sub(criteria.Since) == 24*time.Hour {
-		encodeItem().Atom("ON").SP().String(criteria.Since.Format(internal.DateLayout))
-	} else {
-		if !criteria.Since.IsZero() {
-			encodeItem().Atom("SINCE").SP().String(criteria.Since.Format(internal.DateLayout))
+	cmd.data.Saved = cmd.save
+	if cmd.data.All != nil {
+		cmd.data.UID = isUIDSet(cmd.data.All)
+	}
+	if options := cmd.fallbackOptions; options != nil {
+		nums, err := searchDataNums(&cmd.data)
+		if err != nil {
+			return &cmd.data, err
 		}
-		if !criteria.Before.IsZero() {
-			encodeItem().Atom("BEFORE").SP().String(criteria.Before.Format(internal.DateLayout))
+		if options.ReturnMin && len(nums) > 0 {
+			cmd.data.Min = nums[0]
 		}
-	}
-	if !criteria.SentSince.IsZero() && !criteria.SentBefore.IsZero() && criteria.SentBefore.Sub(criteria.SentSince) == 24*time.Hour {
-		encodeItem().Atom("SENTON").SP().String(criteria.SentSince.Format(internal.DateLayout))
-	} else {
-		if !criteria.SentSince.IsZero() {
-			encodeItem().Atom("SENTSINCE").SP().String(criteria.SentSince.Format(internal.DateLayout))
+		if options.ReturnMax && len(nums) > 0 {
+			cmd.data.Max = nums[len(nums)-1]
 		}
-		if !criteria.SentBefore.IsZero() {
-			encodeItem().Atom("SENTBEFORE").SP().String(criteria.SentBefore.Format(internal.DateLayout))
+		if options.ReturnCount {
+			count := uint32(len(nums))
+			cmd.data.Count = &count
 		}
-	}
-
-	for _, kv := range criteria.Header {
-		switch k := strings.ToUpper(kv.Key); k {
-		case "BCC", "CC", "FROM", "SUBJECT", "TO":
-			encodeItem().Atom(k)
-		default:
-			encodeItem().Atom("HEADER").SP().String(kv.Key)
+		if !options.ReturnAll {
+			cmd.data.All = emptyNumSetLike(cmd.data.All)
 		}
-		enc.SP().String(kv.Value)
+		cmd.fallbackOptions = nil
 	}
+	return &cmd.data, nil
+}
 
-	for _, s := range criteria.Body {
-		encodeItem().Atom("BODY").SP().String(s)
-	}
-	for _, s := range criteria.Text {
-		encodeItem().Atom("TEXT").SP().String(s)
+// WaitContext is like Wait, but closes the connection if ctx is done before
+// the command has completed. See Client.WatchContext.
+func (cmd *SearchCommand) WaitContext(ctx context.Context) (*imap.SearchData, error) {
+	defer cmd.watchContext(ctx)()
+	return cmd.Wait()
+}
+
+func isUIDSet(numSet imap.NumSet) bool {
+	_, ok := numSet.(imap.UIDSet)
+	return ok
+}
+
+func emptyNumSetLike(numSet imap.NumSet) imap.NumSet {
+	if isUIDSet(numSet) {
+		return imap.UIDSet(nil)
 	}
+	return imap.SeqSet(nil)
+}
 
-	for _, flag := range criteria.Flag {
-		if k := flagSearchKey(flag); k != "" {
-			encodeItem().Atom(k)
-		} else {
-			encodeItem().Atom("KEYWORD").SP().Flag(flag)
-		}
+// searchDataNums returns the numbers in SearchData.All, in increasing order.
+func searchDataNums(data *imap.SearchData) ([]uint32, error) {
+	if !isUIDSet(data.All) {
+		return data.AllSeqNums()
 	}
-	for _, flag := range criteria.NotFlag {
-		if k := flagSearchKey(flag); k != "" {
-			encodeItem().Atom("UN" + k)
-		} else {
-			encodeItem().Atom("UNKEYWORD").SP().Flag(flag)
-		}
+	uids, err := data.AllUIDs()
+	if err != nil {
+		return nil, err
 	}
-
-	if criteria.Larger > 0 {
-		encodeItem().Atom("LARGER").SP().Number64(criteria.Larger)
+	nums := make([]uint32, len(uids))
+	for i, uid := range uids {
+		nums[i] = uint32(uid)
 	}
-	if criteria.Smaller > 0 {
-		encodeItem().Atom("SMALLER").SP().Number64(criteria.Smaller)
+	return nums, nil
+}
+
+// writeSearchKey encodes a search criteria. If within is false, Younger and
+// Older are converted to SINCE and BEFORE.
+func writeSearchKey(enc *imapwire.Encoder, criteria *imap.SearchCriteria, within bool) {
+	if !within {
+		criteria = searchCriteriaWithoutWithin(criteria, time.Now())
 	}
+	imap.WriteSearchKey(searchKeyEncoder{enc}, criteria)
+}
 
-	if modSeq := criteria.ModSeq; modSeq != nil {
-		encodeItem().Atom("MODSEQ")
-		if modSeq.MetadataName != "" && modSeq.MetadataType != "" {
-			enc.SP().Quoted(modSeq.MetadataName).SP().Atom(string(modSeq.MetadataType))
+// searchCriteriaWithoutWithin replaces Younger and Older with Since and
+// Before, for servers which don't support WITHIN.
+func searchCriteriaWithoutWithin(criteria *imap.SearchCriteria, now time.Time) *imap.SearchCriteria {
+	c := *criteria
+	if c.Younger > 0 {
+		if t := searchWithinDate(now, c.Younger); c.Since.IsZero() || t.After(c.Since) {
+			c.Since = t
 		}
-		enc.SP()
-		if modSeq.ModSeq != 0 {
-			enc.ModSeq(modSeq.ModSeq)
-		} else {
-			enc.Atom("0")
+	}
+	if c.Older > 0 {
+		if t := searchWithinDate(now, c.Older); c.Before.IsZero() || t.Before(c.Before) {
+			c.Before = t
 		}
 	}
+	c.Younger, c.Older = 0, 0
 
-	for _, not := range criteria.Not {
-		encodeItem().Atom("NOT").SP()
-		enc.Special('(')
-		writeSearchKey(enc, &not)
-		enc.Special(')')
+	c.Not = make([]imap.SearchCriteria, len(criteria.Not))
+	for i := range criteria.Not {
+		c.Not[i] = *searchCriteriaWithoutWithin(&criteria.Not[i], now)
 	}
-	for _, or := range criteria.Or {
-		encodeItem().Atom("OR").SP()
-		enc.Special('(')
-		writeSearchKey(enc, &or[0])
-		enc.Special(')')
-		enc.SP()
-		enc.Special('(')
-		writeSearchKey(enc, &or[1])
-		enc.Special(')')
+	c.Or = make([][2]imap.SearchCriteria, len(criteria.Or))
+	for i := range criteria.Or {
+		for j := range c.Or[i] {
+			c.Or[i][j] = *searchCriteriaWithoutWithin(&criteria.Or[i][j], now)
+		}
 	}
+	return &c
+}
 
-	if firstItem {
-		enc.Atom("ALL")
-	}
+// searchKeyEncoder writes search keys with an imapwire.Encoder.
+type searchKeyEncoder struct {
+	enc *imapwire.Encoder
 }
 
-func flagSearchKey(flag imap.Flag) string {
-	switch flag {
-	case imap.FlagAnswered, imap.FlagDeleted, imap.FlagDraft, imap.FlagFlagged, imap.FlagSeen:
-		return strings.ToUpper(strings.TrimPrefix(string(flag), "\\"))
-	default:
-		return ""
+func (e searchKeyEncoder) SP()                     { e.enc.SP() }
+func (e searchKeyEncoder) Special(ch byte)         { e.enc.Special(ch) }
+func (e searchKeyEncoder) Atom(s string)           { e.enc.Atom(s) }
+func (e searchKeyEncoder) Flag(s string)           { e.enc.Flag(imap.Flag(s)) }
+func (e searchKeyEncoder) NumSet(set fmt.Stringer) { e.enc.NumSet(set.(imap.NumSet)) }
+func (e searchKeyEncoder) Quoted(s string)         { e.enc.Quoted(s) }
+func (e searchKeyEncoder) String(s string)         { e.enc.String(s) }
+
+func readSearchCorrelator(dec *imapwire.Decoder) (tag string, err error) {
+	if !dec.Special('(') {
+		return "", nil
+	}
+	var correlator string
+	if !dec.ExpectAtom(&correlator) || !dec.ExpectSP() || !dec.ExpectAString(&tag) || !dec.ExpectSpecial(')') {
+		return "", dec.Err()
 	}
+	if correlator != "TAG" {
+		return "", fmt.Errorf("in search-correlator: name must be TAG, but got %q", correlator)
+	}
+	return tag, nil
 }
 
-func readESearchResponse(dec *imapwire.Decoder) (tag string, data *imap.SearchData, err error) {
+// readESearchResponse reads an ESEARCH response after the search correlator.
+// If sortedAll is non-nil, the ALL return data item is stored there in order
+// instead of being stored in SearchData.All.
+func readESearchResponse(dec *imapwire.Decoder, sortedAll *[]uint32) (data *imap.SearchData, err error) {
 	data = &imap.SearchData{}
-	if dec.Special('(') { // search-correlator
-		var correlator string
-		if !dec.ExpectAtom(&correlator) || !dec.ExpectSP() || !dec.ExpectAString(&tag) || !dec.ExpectSpecial(')') {
-			return "", nil, dec.Err()
-		}
-		if correlator != "TAG" {
-			return "", nil, fmt.Errorf("in search-correlator: name must be TAG, but got %q", correlator)
-		}
-	}
 
 	var name string
 	if !dec.SP() {
-		return tag, data, nil
+		return data, nil
 	} else if !dec.ExpectAtom(&name) {
-		return "", nil, dec.Err()
+		return nil, dec.Err()
 	}
 	data.UID = name == "UID"
 
 	if data.UID {
 		if !dec.SP() {
-			return tag, data, nil
+			return data, nil
 		} else if !dec.ExpectAtom(&name) {
-			return "", nil, dec.Err()
+			return nil, dec.Err()
 		}
 	}
 
 	for {
 		if !dec.ExpectSP() {
-			return "", nil, dec.Err()
+			return nil, dec.Err()
 		}
 
 		switch strings.ToUpper(name) {
 		case "MIN":
 			var num uint32
 			if !dec.ExpectNumber(&num) {
-				return "", nil, dec.Err()
+				return nil, dec.Err()
 			}
 			data.Min = num
 		case "MAX":
 			var num uint32
 			if !dec.ExpectNumber(&num) {
-				return "", nil, dec.Err()
+				return nil, dec.Err()
 			}
 			data.Max = num
 		case "ALL":
+			if sortedAll != nil {
+				if !dec.ExpectNumList(sortedAll) {
+					return nil, dec.Err()
+				}
+				break
+			}
 			numKind := imapwire.NumKindSeq
 			if data.UID {
 				numKind = imapwire.NumKindUID
 			}
 			if !dec.ExpectNumSet(numKind, &data.All) {
-				return "", nil, dec.Err()
+				return nil, dec.Err()
 			}
 			if data.All.Dynamic() {
-				return "", nil, fmt.Errorf("imapclient: server returned a dynamic ALL number set in SEARCH response")
+				return nil, fmt.Errorf("imapclient: server returned a dynamic ALL number set in SEARCH response")
 			}
 		case "COUNT":
 			var num uint32
 			if !dec.ExpectNumber(&num) {
-				return "", nil, dec.Err()
+				return nil, dec.Err()
 			}
-			data.Count = num
+			data.Count = &num
 		case "MODSEQ":
-			var modSeq uint64
+			var modSeq imap.ModSeq
 			if !dec.ExpectModSeq(&modSeq) {
-				return "", nil, dec.Err()
+				return nil, dec.Err()
 			}
 			data.ModSeq = modSeq
+		case "PARTIAL":
+			numKind := imapwire.NumKindSeq
+			if data.UID {
+				numKind = imapwire.NumKindUID
+			}
+			partial, err := readSearchPartialData(dec, numKind)
+			if err != nil {
+				return nil, err
+			}
+			data.Partial = partial
 		default:
 			if !dec.DiscardValue() {
-				return "", nil, dec.Err()
+				return nil, dec.Err()
 			}
 		}
 
 		if !dec.SP() {
 			break
 		} else if !dec.ExpectAtom(&name) {
-			return "", nil, dec.Err()
+			return nil, dec.Err()
+		}
+	}
+
+	return data, nil
+}
+
+func readSearchPartialData(dec *imapwire.Decoder, numKind imapwire.NumKind) (*imap.SearchPartialData, error) {
+	var rangeStr string
+	if !dec.ExpectSpecial('(') || !dec.ExpectAtom(&rangeStr) || !dec.ExpectSP() {
+		return nil, dec.Err()
+	}
+	r, err := parseSearchPartialRange(rangeStr)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &imap.SearchPartialData{Range: r}
+	var all imap.NumSet
+	if dec.NumSet(numKind, &all) {
+		data.All = all
+	} else if !dec.ExpectNIL() {
+		return nil, dec.Err()
+	}
+	if !dec.ExpectSpecial(')') {
+		return nil, dec.Err()
+	}
+	if data.All != nil && data.All.Dynamic() {
+		return nil, fmt.Errorf("imapclient: server returned a dynamic PARTIAL number set in SEARCH response")
+	}
+	return data, nil
+}
+
+func parseSearchPartialRange(s string) (imap.SearchPartialRange, error) {
+	var r imap.SearchPartialRange
+	first, last, ok := strings.Cut(s, ":")
+	if !ok {
+		return r, fmt.Errorf("in partial-range: missing ':' in %q", s)
+	}
+	for _, item := range []struct {
+		s   string
+		ptr *int32
+	}{{first, &r.First}, {last, &r.Last}} {
+		n, err := strconv.ParseInt(item.s, 10, 32)
+		if err != nil || n == 0 {
+			return r, fmt.Errorf("in partial-range: invalid position %q", item.s)
 		}
+		*item.ptr = int32(n)
+	}
+	if (r.First < 0) != (r.Last < 0) {
+		return r, fmt.Errorf("in partial-range: positions must have the same sign in %q", s)
 	}
+	return r, nil
+}
 
-	return tag, data, nil
+// searchWithinDate returns the date of now minus d, used instead of WITHIN
+// search keys.
+func searchWithinDate(now time.Time, d time.Duration) time.Time {
+	y, m, day := now.Add(-d).Date()
+	return time.Date(y, m, day, 0, 0, 0, 0, time.UTC)
 }
 
 func searchCriteriaIsASCII(criteria *imap.SearchCriteria) bool {
@@ -391,6 +564,25 @@ func searchCriteriaIsASCII(criteria *imap.SearchCriteria) bool {
 	return true
 }
 
+func searchCriteriaUsesSearchRes(criteria *imap.SearchCriteria) bool {
+	for _, uids := range criteria.UID {
+		if imap.IsSearchRes(uids) {
+			return true
+		}
+	}
+	for _, not := range criteria.Not {
+		if searchCriteriaUsesSearchRes(&not) {
+			return true
+		}
+	}
+	for _, or := range criteria.Or {
+		if searchCriteriaUsesSearchRes(&or[0]) || searchCriteriaUsesSearchRes(&or[1]) {
+			return true
+		}
+	}
+	return false
+}
+
 func isASCII(s string) bool {
 	for i := 0; i < len(s); i++ {
 		if s[i] > unicode.MaxASCII {
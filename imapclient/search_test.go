@@ -1,10 +1,15 @@
 package imapclient_test
 
 import (
+	"bufio"
+	"io"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
 )
 
 func TestSearch(t *testing.T) {
@@ -55,7 +60,586 @@ func TestESearch(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Search().Wait() = %v", err)
 	}
-	if want := uint32(1); data.Count != want {
+	if want := uint32(1); data.Count == nil || *data.Count != want {
 		t.Errorf("Count = %v, want %v", data.Count, want)
 	}
 }
+
+func TestClient_ESearch_pipelined(t *testing.T) {
+	commands := make(chan string, 2)
+	greeting := "* OK [CAPABILITY IMAP4rev1 ESEARCH SEARCHRES] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag1, args1 := readScriptTaggedCommand(t, br, w)
+		tag2, args2 := readScriptTaggedCommand(t, br, w)
+		commands <- args1
+		commands <- args2
+		// Reply to the second command first
+		io.WriteString(w, `* ESEARCH (TAG "`+tag2+`") UID MIN 7 MAX 3800 COUNT 15`+"\r\n")
+		io.WriteString(w, `* ESEARCH (TAG "`+tag1+`") ALL 2,10:11`+"\r\n")
+		io.WriteString(w, tag1+" OK SEARCH completed\r\n")
+		io.WriteString(w, tag2+" OK SEARCH completed\r\n")
+	})
+
+	criteria := &imap.SearchCriteria{Flag: []imap.Flag{imap.FlagSeen}}
+	cmd1 := client.Search(criteria, &imap.SearchOptions{ReturnAll: true})
+	cmd2 := client.UIDSearch(criteria, &imap.SearchOptions{
+		ReturnMin:   true,
+		ReturnMax:   true,
+		ReturnCount: true,
+		ReturnSave:  true,
+	})
+
+	data1, err := cmd1.Wait()
+	if err != nil {
+		t.Fatalf("Search().Wait() = %v", err)
+	}
+	data2, err := cmd2.Wait()
+	if err != nil {
+		t.Fatalf("UIDSearch().Wait() = %v", err)
+	}
+
+	if cmd, want := <-commands, "SEARCH RETURN (ALL) SEEN"; cmd != want {
+		t.Errorf("sent %q, want %q", cmd, want)
+	}
+	if cmd, want := <-commands, "UID SEARCH RETURN (MIN MAX COUNT SAVE) SEEN"; cmd != want {
+		t.Errorf("sent %q, want %q", cmd, want)
+	}
+
+	if nums, err := data1.AllSeqNums(); err != nil || !reflect.DeepEqual(nums, []uint32{2, 10, 11}) || data1.UID || data1.Count != nil || data1.Saved {
+		t.Errorf("first search = %#v", data1)
+	}
+	if _, ok := data2.All.(imap.UIDSet); !ok || !data2.UID || data2.Min != 7 || data2.Max != 3800 || data2.Count == nil || *data2.Count != 15 || !data2.Saved {
+		t.Errorf("second search = %#v", data2)
+	}
+}
+
+func TestClient_ESearch_data(t *testing.T) {
+	tags := make(chan string, 2)
+	greeting := "* OK [CAPABILITY IMAP4rev1 ESEARCH CONDSTORE] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, _ := readScriptTaggedCommand(t, br, w)
+		tags <- tag
+		io.WriteString(w, `* ESEARCH (TAG "`+tag+`") UID COUNT 0`+"\r\n")
+		io.WriteString(w, tag+" OK SEARCH completed\r\n")
+
+		tag, _ = readScriptTaggedCommand(t, br, w)
+		tags <- tag
+		io.WriteString(w, `* ESEARCH (TAG "`+tag+`") ALL 4:6,9 MODSEQ 917162500`+"\r\n")
+		io.WriteString(w, tag+" OK SEARCH completed\r\n")
+	})
+
+	criteria := &imap.SearchCriteria{Flag: []imap.Flag{imap.FlagSeen}}
+	data, err := client.UIDSearch(criteria, &imap.SearchOptions{ReturnCount: true}).Wait()
+	if err != nil {
+		t.Fatalf("UIDSearch().Wait() = %v", err)
+	}
+	if tag := <-tags; data.Tag != tag {
+		t.Errorf("Tag = %q, want %q", data.Tag, tag)
+	}
+	if data.Count == nil || *data.Count != 0 || !data.UID || data.Min != 0 || data.Max != 0 {
+		t.Errorf("UIDSearch().Wait() = %#v, want UID COUNT 0", data)
+	}
+	if uids, err := data.AllUIDs(); err != nil || len(uids) != 0 {
+		t.Errorf("AllUIDs() = %v, %v, want no UIDs", uids, err)
+	}
+	if _, err := data.AllSeqNums(); err == nil {
+		t.Errorf("AllSeqNums() = nil error for UID SEARCH data")
+	}
+
+	criteria.ModSeq = &imap.SearchCriteriaModSeq{ModSeq: 620162338}
+	data, err = client.Search(criteria, &imap.SearchOptions{ReturnAll: true}).Wait()
+	if err != nil {
+		t.Fatalf("Search().Wait() = %v", err)
+	}
+	if tag := <-tags; data.Tag != tag {
+		t.Errorf("Tag = %q, want %q", data.Tag, tag)
+	}
+	if data.UID || data.Count != nil || data.ModSeq != 917162500 {
+		t.Errorf("Search().Wait() = %#v, want ALL 4:6,9 MODSEQ 917162500", data)
+	}
+	if nums, err := data.AllSeqNums(); err != nil || !reflect.DeepEqual(nums, []uint32{4, 5, 6, 9}) {
+		t.Errorf("AllSeqNums() = %v, %v, want [4 5 6 9]", nums, err)
+	}
+	if _, err := data.AllUIDs(); err == nil {
+		t.Errorf("AllUIDs() = nil error for SEARCH data")
+	}
+}
+
+func TestClient_ESearch_fallback(t *testing.T) {
+	commands := make(chan string, 2)
+	greeting := "* OK [CAPABILITY IMAP4rev1] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, args := readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, "* SEARCH 9 2 5\r\n")
+		io.WriteString(w, tag+" OK SEARCH completed\r\n")
+	})
+
+	criteria := &imap.SearchCriteria{Flag: []imap.Flag{imap.FlagSeen}}
+	data, err := client.UIDSearch(criteria, &imap.SearchOptions{
+		ReturnMin:   true,
+		ReturnMax:   true,
+		ReturnCount: true,
+	}).Wait()
+	if err != nil {
+		t.Fatalf("UIDSearch().Wait() = %v", err)
+	}
+	if cmd, want := <-commands, "UID SEARCH SEEN"; cmd != want {
+		t.Errorf("sent %q, want %q", cmd, want)
+	}
+	if uids, err := data.AllUIDs(); err != nil || len(uids) != 0 || !data.UID || data.Min != 2 || data.Max != 9 || data.Count == nil || *data.Count != 3 {
+		t.Errorf("UIDSearch().Wait() = %#v", data)
+	}
+
+	_, err = client.Search(criteria, &imap.SearchOptions{ReturnSave: true}).Wait()
+	if err == nil || !strings.Contains(err.Error(), "SEARCHRES") {
+		t.Errorf("Search() with ReturnSave = %v, want SEARCHRES capability error", err)
+	}
+}
+
+func TestClient_ESearch_fallbackSave(t *testing.T) {
+	commands := make(chan string, 1)
+	greeting := "* OK [CAPABILITY IMAP4rev1 SEARCHRES] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, args := readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, "* SEARCH 2\r\n")
+		io.WriteString(w, tag+" OK SEARCH completed\r\n")
+	})
+
+	criteria := &imap.SearchCriteria{Flag: []imap.Flag{imap.FlagSeen}}
+	data, err := client.Search(criteria, &imap.SearchOptions{ReturnSave: true}).Wait()
+	if err != nil {
+		t.Fatalf("Search().Wait() = %v", err)
+	}
+	if cmd, want := <-commands, "SEARCH SEEN"; cmd != want {
+		t.Errorf("sent %q, want %q", cmd, want)
+	}
+	if data.Saved {
+		t.Errorf("SearchData.Saved = true, want false without ESEARCH")
+	}
+	_, err = client.Fetch(imap.SearchRes(), &imap.FetchOptions{Flags: true}).Collect()
+	if err == nil || !strings.Contains(err.Error(), "no search result saved") {
+		t.Errorf("Fetch($) = %v, want an error", err)
+	}
+}
+
+func TestClient_SearchPages_partial(t *testing.T) {
+	commands := make(chan string, 8)
+	greeting := "* OK [CAPABILITY IMAP4rev2 PARTIAL] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		replies := []string{
+			`UID MAX 9 PARTIAL (1:2 1:2)`,
+			// Message 4 has been expunged since the first page
+			`UID PARTIAL (1:2 5,7)`,
+			// Message 10 has been added, but is out of the pinned range
+			`UID PARTIAL (1:2 9)`,
+		}
+		for _, reply := range replies {
+			tag, args := readScriptTaggedCommand(t, br, w)
+			commands <- args
+			io.WriteString(w, `* ESEARCH (TAG "`+tag+`") `+reply+"\r\n")
+			io.WriteString(w, tag+" OK UID SEARCH completed\r\n")
+		}
+	})
+
+	criteria := imap.SearchCriteria{Flag: []imap.Flag{imap.FlagSeen}}
+	pager := client.SearchPages(&criteria, 2)
+	var pages []string
+	for page := pager.Next(); page != nil; page = pager.Next() {
+		pages = append(pages, page.String())
+	}
+	if err := pager.Close(); err != nil {
+		t.Fatalf("SearchPager.Close() = %v", err)
+	}
+
+	wantPages := []string{"1:2", "5,7", "9"}
+	if !reflect.DeepEqual(pages, wantPages) {
+		t.Errorf("pages = %v, want %v", pages, wantPages)
+	}
+	wantCommands := []string{
+		"UID SEARCH RETURN (MAX PARTIAL 1:2) SEEN",
+		"UID SEARCH RETURN (PARTIAL 1:2) UID 3:9 SEEN",
+		"UID SEARCH RETURN (PARTIAL 1:2) UID 8:9 SEEN",
+	}
+	for _, want := range wantCommands {
+		if cmd := <-commands; cmd != want {
+			t.Errorf("got command %q, want %q", cmd, want)
+		}
+	}
+}
+
+func TestClient_SearchPages_fallback(t *testing.T) {
+	client, server := newClientServerPair(t, imap.ConnStateSelected)
+	defer client.Close()
+	defer server.Close()
+
+	if client.Caps().Has(imap.CapPartial) {
+		t.Skip("server supports PARTIAL")
+	}
+
+	var want []imap.UID
+	data, err := client.UIDSearch(&imap.SearchCriteria{}, nil).Wait()
+	if err != nil {
+		t.Fatalf("UIDSearch().Wait() = %v", err)
+	}
+	uids, err := data.AllUIDs()
+	if err != nil {
+		t.Fatalf("AllUIDs() = %v", err)
+	}
+	want = append(want, uids...)
+	for i := 0; i < 4; i++ {
+		want = append(want, appendTestMessage(t, client))
+	}
+
+	pager := client.SearchPages(nil, 2)
+	var got []imap.UID
+	var sizes []int
+	for page := pager.Next(); page != nil; page = pager.Next() {
+		uids, _ := page.Nums()
+		got = append(got, uids...)
+		sizes = append(sizes, len(uids))
+	}
+	if err := pager.Close(); err != nil {
+		t.Fatalf("SearchPager.Close() = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("UIDs = %v, want %v", got, want)
+	}
+	if wantSizes := []int{2, 2, 1}; !reflect.DeepEqual(sizes, wantSizes) {
+		t.Errorf("page sizes = %v, want %v", sizes, wantSizes)
+	}
+}
+
+func TestClient_SearchRes(t *testing.T) {
+	client, server := newClientServerPair(t, imap.ConnStateSelected)
+	defer client.Close()
+	defer server.Close()
+
+	storeFlagged := &imap.StoreFlags{
+		Op:     imap.StoreFlagsAdd,
+		Silent: true,
+		Flags:  []imap.Flag{imap.FlagFlagged},
+	}
+
+	// Using $ before any SEARCH SAVE fails locally
+	if err := client.Store(imap.SearchRes(), storeFlagged, nil).Close(); err == nil {
+		t.Errorf("Store($) before SEARCH SAVE = nil, want an error")
+	}
+
+	// Pipeline the SEARCH SAVE and the STORE $ commands
+	criteria := &imap.SearchCriteria{
+		Header: []imap.SearchCriteriaHeaderField{{
+			Key:   "Message-Id",
+			Value: "<191101702316132@example.com>",
+		}},
+	}
+	searchCmd := client.UIDSearch(criteria, &imap.SearchOptions{ReturnSave: true})
+	storeCmd := client.Store(imap.SearchRes(), storeFlagged, nil)
+	if data, err := searchCmd.Wait(); err != nil {
+		t.Fatalf("UIDSearch().Wait() = %v", err)
+	} else if !data.Saved {
+		t.Errorf("SearchData.Saved = false, want true")
+	}
+	if err := storeCmd.Close(); err != nil {
+		t.Fatalf("Store($).Close() = %v", err)
+	}
+
+	msgs, err := client.Fetch(imap.SeqSetNum(1), &imap.FetchOptions{Flags: true}).Collect()
+	if err != nil {
+		t.Fatalf("Fetch().Collect() = %v", err)
+	} else if len(msgs) != 1 || !containsFlag(msgs[0].Flags, imap.FlagFlagged) {
+		t.Errorf("message isn't flagged after STORE $")
+	}
+
+	// The saved result is reset when a mailbox is selected
+	if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select().Wait() = %v", err)
+	}
+	if _, err := client.Copy(imap.SearchRes(), "INBOX").Wait(); err == nil {
+		t.Errorf("Copy($) after SELECT = nil, want an error")
+	}
+}
+
+// sentSearchCommand returns the SEARCH command sent by the client for a
+// criteria.
+func sentSearchCommand(t *testing.T, greeting string, criteria imap.SearchCriteria) string {
+	commands := make(chan string, 1)
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, args := readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, tag+" OK SEARCH completed\r\n")
+	})
+	if _, err := client.Search(&criteria, nil).Wait(); err != nil {
+		t.Fatalf("Search().Wait() = %v", err)
+	}
+	return <-commands
+}
+
+func TestClient_Search_within(t *testing.T) {
+	criteria := imap.SearchAnd(imap.SearchYoungerThan(90*time.Minute), imap.SearchOlderThan(1500*time.Millisecond))
+
+	greeting := "* OK [CAPABILITY IMAP4rev1 WITHIN] Server ready"
+	if cmd, want := sentSearchCommand(t, greeting, criteria), "SEARCH OLDER 2 YOUNGER 5400"; cmd != want {
+		t.Errorf("sent %q, want %q", cmd, want)
+	}
+
+	// Without WITHIN, the cutoff is truncated to the date
+	criteria = imap.SearchAnd(imap.SearchYoungerThan(72*time.Hour), imap.SearchOlderThan(24*time.Hour))
+	before := time.Now()
+	cmd := sentSearchCommand(t, "* OK [CAPABILITY IMAP4rev1] Server ready", criteria)
+	after := time.Now()
+	var wants []string
+	for _, now := range []time.Time{before, after} {
+		since := now.Add(-72 * time.Hour).Format("2-Jan-2006")
+		before := now.Add(-24 * time.Hour).Format("2-Jan-2006")
+		wants = append(wants, `SEARCH SINCE "`+since+`" BEFORE "`+before+`"`)
+	}
+	if cmd != wants[0] && cmd != wants[1] {
+		t.Errorf("sent %q, want %q", cmd, wants[0])
+	}
+}
+
+func TestClient_Search_on(t *testing.T) {
+	// Late in the evening east of UTC: the date is already the next day in UTC
+	loc := time.FixedZone("", 2*60*60)
+	t1 := time.Date(2024, time.March, 30, 23, 30, 0, 0, loc)
+	greeting := "* OK [CAPABILITY IMAP4rev1] Server ready"
+
+	if cmd, want := sentSearchCommand(t, greeting, imap.SearchOn(t1)), `SEARCH ON "30-Mar-2024"`; cmd != want {
+		t.Errorf("sent %q, want %q", cmd, want)
+	}
+	if cmd, want := sentSearchCommand(t, greeting, imap.SearchSentOn(t1.UTC())), `SEARCH SENTON "30-Mar-2024"`; cmd != want {
+		t.Errorf("sent %q, want %q", cmd, want)
+	}
+
+	// Midnight belongs to the day it starts
+	criteria := imap.SearchOn(time.Date(2024, time.March, 31, 0, 0, 0, 0, loc))
+	if criteria.Since.Day() != 31 || criteria.Before.Day() != 1 || criteria.Before.Month() != time.April {
+		t.Errorf("SearchOn() = %v to %v, want 31-Mar-2024 to 1-Apr-2024", criteria.Since, criteria.Before)
+	}
+
+	// Ranges which aren't exactly one day aren't encoded as ON
+	criteria = imap.SearchOn(t1)
+	criteria.Before = criteria.Before.AddDate(0, 0, 1)
+	if cmd, want := sentSearchCommand(t, greeting, criteria), `SEARCH SINCE "30-Mar-2024" BEFORE "1-Apr-2024"`; cmd != want {
+		t.Errorf("sent %q, want %q", cmd, want)
+	}
+}
+
+func TestSearchCombinators(t *testing.T) {
+	greeting := "* OK [CAPABILITY IMAP4rev1] Server ready"
+	for _, tc := range []struct {
+		criteria imap.SearchCriteria
+		want     string
+	}{
+		{
+			criteria: imap.SearchAnd(imap.SearchFrom("alice"), imap.SearchUnseen(), imap.SearchFrom("alice")),
+			want:     `SEARCH FROM "alice" UNSEEN`,
+		},
+		{
+			criteria: imap.SearchAnd(
+				imap.SearchCriteria{Larger: 10, Smaller: 1000},
+				imap.SearchCriteria{Larger: 100},
+				imap.SearchCriteria{Smaller: 500},
+			),
+			want: `SEARCH LARGER 100 SMALLER 500`,
+		},
+		{
+			criteria: imap.SearchOr(imap.SearchSubject("a"), imap.SearchSubject("b"), imap.SearchSubject("c")),
+			want:     `SEARCH OR (SUBJECT "a") (OR (SUBJECT "b") (SUBJECT "c"))`,
+		},
+		{
+			criteria: imap.SearchNot(imap.SearchAnd(imap.SearchTo("bob"), imap.SearchFlag(imap.FlagFlagged))),
+			want:     `SEARCH NOT (TO "bob" FLAGGED)`,
+		},
+		{
+			criteria: imap.SearchHeader("List-Id", ""),
+			want:     `SEARCH HEADER "List-Id" ""`,
+		},
+	} {
+		if cmd := sentSearchCommand(t, greeting, tc.criteria); cmd != tc.want {
+			t.Errorf("sent %q, want %q", cmd, tc.want)
+		}
+	}
+}
+
+func TestSearchCombinators_memserver(t *testing.T) {
+	user := imapmemserver.NewUser(testUsername, testPassword)
+	user.Create("INBOX", nil)
+	dial := newCapsTestServer(t, user, nil)
+	client := dial(nil)
+
+	alice := appendRawMessage(t, client, "From: alice@example.org\r\nTo: bob@example.org\r\nSubject: Lunch\r\n\r\nHi\r\n")
+	appendRawMessage(t, client, "From: carol@example.org\r\nTo: bob@example.org\r\nSubject: Report\r\n\r\nHi\r\n")
+	dave := appendRawMessage(t, client, "From: dave@example.org\r\nTo: erin@example.org\r\nSubject: Lunch\r\n\r\nHi\r\n")
+	if _, err := client.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select().Wait() = %v", err)
+	}
+	if err := client.MarkSeen(imap.UIDSetNum(alice), true); err != nil {
+		t.Fatalf("MarkSeen() = %v", err)
+	}
+	if err := client.SetFlagged(imap.UIDSetNum(dave), true); err != nil {
+		t.Fatalf("SetFlagged() = %v", err)
+	}
+
+	search := func(criteria imap.SearchCriteria) string {
+		data, err := client.UIDSearch(&criteria, nil).Wait()
+		if err != nil {
+			t.Fatalf("UIDSearch().Wait() = %v", err)
+		}
+		return data.All.String()
+	}
+
+	for _, tc := range []struct {
+		built, manual imap.SearchCriteria
+	}{
+		{
+			built: imap.SearchAnd(imap.SearchSubject("Lunch"), imap.SearchUnseen()),
+			manual: imap.SearchCriteria{
+				Header:  []imap.SearchCriteriaHeaderField{{Key: "Subject", Value: "Lunch"}},
+				NotFlag: []imap.Flag{imap.FlagSeen},
+			},
+		},
+		{
+			built: imap.SearchOr(imap.SearchFrom("alice"), imap.SearchFrom("carol"), imap.SearchFlag(imap.FlagFlagged)),
+			manual: imap.SearchCriteria{Or: [][2]imap.SearchCriteria{{
+				{Header: []imap.SearchCriteriaHeaderField{{Key: "From", Value: "alice"}}},
+				{Or: [][2]imap.SearchCriteria{{
+					{Header: []imap.SearchCriteriaHeaderField{{Key: "From", Value: "carol"}}},
+					{Flag: []imap.Flag{imap.FlagFlagged}},
+				}}},
+			}}},
+		},
+		{
+			built: imap.SearchNot(imap.SearchTo("bob")),
+			manual: imap.SearchCriteria{Not: []imap.SearchCriteria{{
+				Header: []imap.SearchCriteriaHeaderField{{Key: "To", Value: "bob"}},
+			}}},
+		},
+	} {
+		got, want := search(tc.built), search(tc.manual)
+		if got != want {
+			t.Errorf("combinators matched %q, hand-built criteria matched %q", got, want)
+		}
+		if got == "" {
+			t.Errorf("criteria %+v didn't match any message", tc.built)
+		}
+	}
+
+	if got := search(imap.SearchOr()); got != "" {
+		t.Errorf("SearchOr() matched %q, want no message", got)
+	}
+}
+
+func TestSearchCriteria_String(t *testing.T) {
+	for _, tc := range []struct {
+		criteria imap.SearchCriteria
+		want     string
+	}{
+		{imap.SearchCriteria{}, "ALL"},
+		{
+			criteria: imap.SearchAnd(imap.SearchUnseen(), imap.SearchFrom("bob"), imap.SearchCriteria{
+				Since: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC),
+			}),
+			want: `SINCE "1-Feb-2024" FROM "bob" UNSEEN`,
+		},
+		{
+			criteria: imap.SearchCriteria{
+				UID:     []imap.UIDSet{imap.UIDSetNum(1, 2, 3, 7)},
+				Header:  []imap.SearchCriteriaHeaderField{{Key: "List-Id", Value: `say "hi"`}},
+				Flag:    []imap.Flag{"$Important"},
+				Younger: 90 * time.Second,
+				ModSeq: &imap.SearchCriteriaModSeq{
+					ModSeq:       42,
+					MetadataName: "/flags/\\draft",
+					MetadataType: imap.SearchCriteriaMetadataAll,
+				},
+				Not: []imap.SearchCriteria{imap.SearchFlag(imap.FlagDeleted)},
+			},
+			want: `UID 1:3,7 YOUNGER 90 HEADER "List-Id" "say \"hi\"" KEYWORD $Important MODSEQ "/flags/\\draft" all 42 NOT (DELETED)`,
+		},
+	} {
+		if s := tc.criteria.String(); s != tc.want {
+			t.Errorf("String() = %q, want %q", s, tc.want)
+		}
+		// The client uses the same representation
+		greeting := "* OK [CAPABILITY IMAP4rev1 WITHIN] Server ready"
+		if cmd := sentSearchCommand(t, greeting, tc.criteria); cmd != "SEARCH "+tc.want {
+			t.Errorf("client sent %q, want %q", cmd, "SEARCH "+tc.want)
+		}
+	}
+
+	criteria := imap.SearchCriteria{Body: []string{"two\r\nlines"}}
+	if _, err := criteria.AppendIMAP(nil); err == nil {
+		t.Errorf("AppendIMAP() with a multi-line string = nil, want an error")
+	}
+	if s, want := criteria.String(), "BODY {10}\r\ntwo\r\nlines"; s != want {
+		t.Errorf("String() = %q, want %q", s, want)
+	}
+}
+
+func TestParseSearchCriteria(t *testing.T) {
+	criteria, err := imap.ParseSearchCriteria(`UNSEEN FROM "bob" SINCE 1-Feb-2024 OR SUBJECT hi SUBJECT hello`)
+	if err != nil {
+		t.Fatalf("ParseSearchCriteria() = %v", err)
+	}
+	want := imap.SearchAnd(imap.SearchUnseen(), imap.SearchFrom("bob"), imap.SearchCriteria{
+		Since: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC),
+	}, imap.SearchOr(imap.SearchSubject("hi"), imap.SearchSubject("hello")))
+	if !reflect.DeepEqual(criteria, &want) {
+		t.Errorf("ParseSearchCriteria() = %#v, want %#v", criteria, want)
+	}
+
+	criteria, err = imap.ParseSearchCriteria(`1:* uid $ (new header from "") not (modseq "/flags/x" PRIV 3 younger 60) emailid M123`)
+	if err != nil {
+		t.Fatalf("ParseSearchCriteria() = %v", err)
+	}
+	const wantString = `1:* UID $ FROM "" RECENT UNSEEN EMAILID M123 NOT (YOUNGER 60 MODSEQ "/flags/x" priv 3)`
+	if s := criteria.String(); s != wantString {
+		t.Errorf("String() = %q, want %q", s, wantString)
+	}
+
+	for _, s := range []string{
+		"",
+		"UNSEEN ",
+		"FROOM bob",
+		"SUBJECT {5}\r\nhello",
+		`BODY "unterminated`,
+		"SINCE 31-Foo-2024",
+		"OR SEEN",
+		"(SEEN",
+		"SEEN)",
+		"KEYWORD \\Seen",
+		"MODSEQ \"/flags/x\" other 1",
+	} {
+		if _, err := imap.ParseSearchCriteria(s); err == nil {
+			t.Errorf("ParseSearchCriteria(%q) = nil, want an error", s)
+		}
+	}
+}
+
+func FuzzParseSearchCriteria(f *testing.F) {
+	f.Add(`UNSEEN FROM "bob" SINCE 1-Feb-2024 OR SUBJECT hi SUBJECT hello`)
+	f.Add(`1,3:5 UID 2:* NOT (DELETED KEYWORD foo) LARGER 10 SMALLER 100`)
+	f.Add(`HEADER X-Foo "a \"b\"" ON 2-Mar-2024 SENTBEFORE "3-Mar-2024" OLDER 5`)
+	f.Add(`MODSEQ "/flags/\\seen" shared 7 MODSEQ 3 THREADID T1 $`)
+	f.Fuzz(func(t *testing.T, s string) {
+		criteria, err := imap.ParseSearchCriteria(s)
+		if err != nil {
+			return
+		}
+		b, err := criteria.AppendIMAP(nil)
+		if err != nil {
+			t.Fatalf("AppendIMAP() = %v", err)
+		}
+		again, err := imap.ParseSearchCriteria(string(b))
+		if err != nil {
+			t.Fatalf("ParseSearchCriteria(%q) = %v", b, err)
+		}
+		if s2 := again.String(); s2 != string(b) {
+			t.Errorf("ParseSearchCriteria(%q).String() = %q", b, s2)
+		}
+	})
+}
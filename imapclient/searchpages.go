@@ -0,0 +1,156 @@
+package imapclient
+
+import (
+	"fmt"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// SearchPager iterates over the result of a UID SEARCH command, page by page.
+//
+// See Client.SearchPages.
+type SearchPager struct {
+	client   *Client
+	criteria imap.SearchCriteria
+	pageSize int
+
+	started bool
+	done    bool
+	err     error
+
+	// PARTIAL state
+	partial bool
+	last    imap.UID // last UID returned
+	max     imap.UID // pinned upper bound
+
+	// Fallback state: remaining UIDs
+	uids []imap.UID
+}
+
+// SearchPages returns a pager for the messages matching the criteria in the
+// selected mailbox, in increasing UID order, at most pageSize at a time.
+//
+// If the server supports PARTIAL, each page is requested with a UID SEARCH
+// command. Otherwise, a single UID SEARCH command is sent on the first call
+// to Next and its result is sliced by the client.
+//
+// With PARTIAL, page boundaries are pinned by UID so that they remain stable
+// when the mailbox changes between pages. The first page also requests the
+// highest matching UID, and each following page is restricted to the UIDs
+// between the last one returned and that upper bound. Messages expunged in
+// the meantime are skipped without shifting the next pages, and messages
+// added afterwards aren't returned.
+func (c *Client) SearchPages(criteria *imap.SearchCriteria, pageSize int) *SearchPager {
+	p := &SearchPager{client: c, pageSize: pageSize}
+	if criteria != nil {
+		p.criteria = *criteria
+	}
+	if pageSize <= 0 || pageSize > 1<<31-1 {
+		p.err = fmt.Errorf("imapclient: invalid search page size %v", pageSize)
+		p.done = true
+	}
+	return p
+}
+
+// Next returns the UIDs of the next page.
+//
+// On error or if there are no more pages, nil is returned. To check the error
+// value, use Close.
+func (p *SearchPager) Next() imap.UIDSet {
+	if p.done {
+		return nil
+	}
+	if !p.started {
+		p.started = true
+		p.partial = p.client.Caps().Has(imap.CapPartial)
+		if !p.partial {
+			p.fetchAll()
+		}
+	}
+
+	var uids []imap.UID
+	if p.partial {
+		uids = p.nextPartial()
+	} else {
+		uids = p.nextFallback()
+	}
+	if len(uids) == 0 {
+		p.done = true
+		return nil
+	}
+	return imap.UIDSetNum(uids...)
+}
+
+// Close releases the pager and returns the first error encountered, if any.
+//
+// Next will always return nil after Close.
+func (p *SearchPager) Close() error {
+	p.done = true
+	p.uids = nil
+	return p.err
+}
+
+func (p *SearchPager) fetchAll() {
+	data, err := p.client.UIDSearch(&p.criteria, nil).Wait()
+	if err != nil {
+		p.err = err
+		p.done = true
+		return
+	}
+	p.uids, p.err = data.AllUIDs()
+	if p.err != nil {
+		p.done = true
+	}
+}
+
+func (p *SearchPager) nextFallback() []imap.UID {
+	n := p.pageSize
+	if n > len(p.uids) {
+		n = len(p.uids)
+	}
+	uids := p.uids[:n]
+	p.uids = p.uids[n:]
+	return uids
+}
+
+func (p *SearchPager) nextPartial() []imap.UID {
+	criteria := imap.SearchCriteria{}
+	if p.max != 0 {
+		criteria.UID = []imap.UIDSet{{imap.UIDRange{Start: p.last + 1, Stop: p.max}}}
+	}
+	criteria.And(&p.criteria)
+
+	options := imap.SearchOptions{
+		ReturnPartial: &imap.SearchPartialRange{First: 1, Last: int32(p.pageSize)},
+		// Pin the upper bound on the first page
+		ReturnMax: p.max == 0,
+	}
+	data, err := p.client.UIDSearch(&criteria, &options).Wait()
+	if err != nil {
+		p.err = err
+		return nil
+	}
+	if p.max == 0 {
+		p.max = imap.UID(data.Max)
+	}
+	if data.Partial == nil || data.Partial.All == nil {
+		return nil
+	}
+
+	uidSet, ok := data.Partial.All.(imap.UIDSet)
+	if !ok {
+		p.err = fmt.Errorf("imapclient: server returned sequence numbers in UID SEARCH PARTIAL response")
+		return nil
+	}
+	uids, _ := uidSet.Nums()
+	if len(uids) == 0 {
+		return nil
+	}
+
+	p.last = uids[len(uids)-1]
+	if len(uids) < p.pageSize || p.last >= p.max {
+		// Last page: don't send another command for nothing
+		p.done = true
+	}
+	return uids
+}
@@ -1,6 +1,8 @@
 package imapclient
 
 import (
+	"context"
+
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/internal"
 )
@@ -9,16 +11,44 @@ import (
 //
 // A nil options pointer is equivalent to a zero options value.
 func (c *Client) Select(mailbox string, options *imap.SelectOptions) *SelectCommand {
+	return c.sendSelect(mailbox, options, nil)
+}
+
+func (c *Client) sendSelect(mailbox string, options *imap.SelectOptions, resync *selectResync) *SelectCommand {
+	c.mutex.Lock()
+	condStore := c.selectCondStore
+	// The saved search result is reset when a mailbox is selected
+	c.searchRes = false
+	c.mutex.Unlock()
+
 	cmdName := "SELECT"
-	if options != nil && options.ReadOnly {
-		cmdName = "EXAMINE"
+	var qresync *imap.SelectQResync
+	if options != nil {
+		if options.ReadOnly {
+			cmdName = "EXAMINE"
+		}
+		condStore = condStore || options.CondStore
+		qresync = options.QResync
 	}
 
-	cmd := &SelectCommand{mailbox: mailbox}
+	cmd := &SelectCommand{mailbox: mailbox, resync: resync}
 	enc := c.beginCommand(cmdName, cmd)
 	enc.SP().Mailbox(mailbox)
-	if options != nil && options.CondStore {
-		enc.SP().Special('(').Atom("CONDSTORE").Special(')')
+	if condStore || qresync != nil {
+		enc.SP()
+		listEnc := enc.BeginList()
+		if condStore {
+			listEnc.Item().Atom("CONDSTORE")
+		}
+		if qresync != nil {
+			enc := listEnc.Item()
+			enc.Atom("QRESYNC").SP().Special('(').Number(qresync.UIDValidity).SP().ModSeq(qresync.ModSeq)
+			if len(qresync.KnownUIDs) > 0 {
+				enc.SP().NumSet(qresync.KnownUIDs)
+			}
+			enc.Special(')')
+		}
+		listEnc.End()
 	}
 	enc.end()
 	return cmd
@@ -58,8 +88,11 @@ func (c *Client) handleFlags() error {
 	cmd := findPendingCmdByType[*SelectCommand](c)
 	if cmd != nil {
 		cmd.data.Flags = flags
-	} else if handler := c.options.unilateralDataHandler().Mailbox; handler != nil {
-		handler(&UnilateralDataMailbox{Flags: flags})
+	} else {
+		if handler := c.options.unilateralDataHandler().Mailbox; handler != nil {
+			handler(&UnilateralDataMailbox{Flags: flags})
+		}
+		c.handleIdleEvent(&IdleMailboxStatus{Flags: flags})
 	}
 
 	return nil
@@ -70,16 +103,28 @@ func (c *Client) handleExists(num uint32) error {
 	if cmd != nil {
 		cmd.data.NumMessages = num
 	} else {
+		var prev uint32
 		c.mutex.Lock()
-		if c.state == imap.ConnStateSelected {
+		selected := c.state == imap.ConnStateSelected
+		if selected {
+			prev = c.mailbox.NumMessages
 			c.mailbox = c.mailbox.copy()
 			c.mailbox.NumMessages = num
 		}
 		c.mutex.Unlock()
 
+		if view := c.mailboxView(); view != nil && selected {
+			view.handleExists(num)
+		}
 		if handler := c.options.unilateralDataHandler().Mailbox; handler != nil {
 			handler(&UnilateralDataMailbox{NumMessages: &num})
 		}
+		queueUpdate(c, &c.handlers.messageCount, func(f func(uint32)) {
+			f(num)
+		})
+		if selected && num > prev {
+			c.handleIdleEvent(&IdleNewMessages{Count: num - prev, NumMessages: num})
+		}
 	}
 	return nil
 }
@@ -89,10 +134,24 @@ type SelectCommand struct {
 	commandBase
 	mailbox string
 	data    imap.SelectData
+	resync  *selectResync // collects QRESYNC responses, may be nil
+
+	viewDone <-chan struct{} // closed once the MailboxView is populated
 }
 
 func (cmd *SelectCommand) Wait() (*imap.SelectData, error) {
-	return &cmd.data, cmd.wait()
+	err := cmd.wait()
+	if err == nil && cmd.viewDone != nil {
+		<-cmd.viewDone
+	}
+	return &cmd.data, err
+}
+
+// WaitContext is like Wait, but closes the connection if ctx is done before
+// the command has completed. See Client.WatchContext.
+func (cmd *SelectCommand) WaitContext(ctx context.Context) (*imap.SelectData, error) {
+	defer cmd.watchContext(ctx)()
+	return cmd.Wait()
 }
 
 type unselectCommand struct {
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
 )
 
 func TestSelect(t *testing.T) {
@@ -18,3 +19,60 @@ func TestSelect(t *testing.T) {
 		t.Errorf("SelectData.NumMessages = %v, want %v", data.NumMessages, 1)
 	}
 }
+
+func TestSelect_readOnly(t *testing.T) {
+	client, server := newClientServerPair(t, imap.ConnStateAuthenticated)
+	defer client.Close()
+	defer server.Close()
+
+	data, err := client.Select("INBOX", &imap.SelectOptions{ReadOnly: true}).Wait()
+	if err != nil {
+		t.Fatalf("Select() = %v", err)
+	} else if !data.ReadOnly {
+		t.Errorf("SelectData.ReadOnly = %v, want %v", data.ReadOnly, true)
+	}
+}
+
+func testUnselectDeleted(t *testing.T, readOnly bool, unselect func(client *imapclient.Client) *imapclient.Command, wantNumMessages uint32) {
+	client, server := newClientServerPair(t, imap.ConnStateSelected)
+	defer client.Close()
+	defer server.Close()
+
+	storeFlags := imap.StoreFlags{
+		Op:     imap.StoreFlagsAdd,
+		Silent: true,
+		Flags:  []imap.Flag{imap.FlagDeleted},
+	}
+	if err := client.Store(imap.SeqSetNum(1), &storeFlags, nil).Close(); err != nil {
+		t.Fatalf("Store() = %v", err)
+	}
+
+	if readOnly {
+		if _, err := client.Select("INBOX", &imap.SelectOptions{ReadOnly: true}).Wait(); err != nil {
+			t.Fatalf("Select() = %v", err)
+		}
+	}
+
+	if err := unselect(client).Wait(); err != nil {
+		t.Fatalf("unselect = %v", err)
+	}
+
+	data, err := client.Select("INBOX", nil).Wait()
+	if err != nil {
+		t.Fatalf("Select() = %v", err)
+	} else if data.NumMessages != wantNumMessages {
+		t.Errorf("SelectData.NumMessages = %v, want %v", data.NumMessages, wantNumMessages)
+	}
+}
+
+func TestUnselectAndExpunge(t *testing.T) {
+	testUnselectDeleted(t, false, (*imapclient.Client).UnselectAndExpunge, 0)
+}
+
+func TestUnselectAndExpunge_readOnly(t *testing.T) {
+	testUnselectDeleted(t, true, (*imapclient.Client).UnselectAndExpunge, 1)
+}
+
+func TestUnselect(t *testing.T) {
+	testUnselectDeleted(t, false, (*imapclient.Client).Unselect, 1)
+}
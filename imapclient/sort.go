@@ -1,36 +1,73 @@
 package imapclient
 
 import (
+	"context"
+
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
-type SortKey string
+// SortKey is an alias for imap.SortKey.
+//
+// Deprecated: use imap.SortKey instead.
+type SortKey = imap.SortKey
 
+// Deprecated: use the imap.SortKey constants instead.
 const (
-	SortKeyArrival SortKey = "ARRIVAL"
-	SortKeyCc      SortKey = "CC"
-	SortKeyDate    SortKey = "DATE"
-	SortKeyFrom    SortKey = "FROM"
-	SortKeySize    SortKey = "SIZE"
-	SortKeySubject SortKey = "SUBJECT"
-	SortKeyTo      SortKey = "TO"
+	SortKeyArrival = imap.SortKeyArrival
+	SortKeyCc      = imap.SortKeyCc
+	SortKeyDate    = imap.SortKeyDate
+	SortKeyFrom    = imap.SortKeyFrom
+	SortKeySize    = imap.SortKeySize
+	SortKeySubject = imap.SortKeySubject
+	SortKeyTo      = imap.SortKeyTo
 )
 
-type SortCriterion struct {
-	Key     SortKey
-	Reverse bool
-}
+// SortCriterion is an alias for imap.SortCriterion.
+//
+// Deprecated: use imap.SortCriterion instead.
+type SortCriterion = imap.SortCriterion
 
 // SortOptions contains options for the SORT command.
 type SortOptions struct {
 	SearchCriteria *imap.SearchCriteria
-	SortCriteria   []SortCriterion
+	SortCriteria   []imap.SortCriterion
+	// Charset of the search criteria. If empty, UTF-8 is used.
+	Charset string
+	// Return options. If the server supports ESORT, they are sent to the
+	// server. Otherwise, a regular SORT command is sent and the results are
+	// computed by the client.
+	Return *imap.SearchOptions
 }
 
 func (c *Client) sort(numKind imapwire.NumKind, options *SortOptions) *SortCommand {
-	cmd := &SortCommand{}
+	if err := c.checkCap(imap.CapSort); err != nil {
+		return &SortCommand{commandBase: failedCommandBase(err)}
+	}
+	for _, criterion := range options.SortCriteria {
+		switch criterion.Key {
+		case imap.SortKeyDisplayFrom, imap.SortKeyDisplayTo:
+			if err := c.checkCap(imap.CapSortDisplay); err != nil {
+				return &SortCommand{commandBase: failedCommandBase(err)}
+			}
+		}
+	}
+
+	charset := options.Charset
+	if charset == "" {
+		charset = "UTF-8"
+	}
+
+	cmd := &SortCommand{returnOptions: options.Return}
+	returnOpts := returnSearchOptions(options.Return)
+	cmd.esort = len(returnOpts) > 0 && c.Caps().Has(imap.CapESort)
+
 	enc := c.beginCommand(uidCmdName("SORT", numKind), cmd)
+	if cmd.esort {
+		enc.SP().Atom("RETURN").SP().List(len(returnOpts), func(i int) {
+			enc.Atom(returnOpts[i])
+		})
+	}
 	enc.SP().List(len(options.SortCriteria), func(i int) {
 		criterion := options.SortCriteria[i]
 		if criterion.Reverse {
@@ -38,8 +75,8 @@ func (c *Client) sort(numKind imapwire.NumKind, options *SortOptions) *SortComma
 		}
 		enc.Atom(string(criterion.Key))
 	})
-	enc.SP().Atom("UTF-8").SP()
-	writeSearchKey(enc.Encoder, options.SearchCriteria)
+	enc.SP().AString(charset).SP()
+	writeSearchKey(enc.Encoder, options.SearchCriteria, c.Caps().Has(imap.CapWithin))
 	enc.end()
 	return cmd
 }
@@ -47,20 +84,36 @@ func (c *Client) sort(numKind imapwire.NumKind, options *SortOptions) *SortComma
 func (c *Client) handleSort() error {
 	cmd := findPendingCmdByType[*SortCommand](c)
 	for c.dec.SP() {
+		if c.dec.Special('(') { // search-sort-mod-seq
+			var (
+				name   string
+				modSeq imap.ModSeq
+			)
+			if !c.dec.ExpectAtom(&name) || !c.dec.ExpectSP() || !c.dec.ExpectModSeq(&modSeq) || !c.dec.ExpectSpecial(')') {
+				return c.dec.Err()
+			}
+			if cmd != nil {
+				cmd.esearch.ModSeq = modSeq
+			}
+			break
+		}
+
+		// Some servers send a trailing space when there are no results
 		var num uint32
-		if !c.dec.ExpectNumber(&num) {
-			return c.dec.Err()
+		if !c.dec.Number(&num) {
+			break
 		}
 		if cmd != nil {
 			cmd.nums = append(cmd.nums, num)
 		}
 	}
-	return nil
+	return c.dec.Err()
 }
 
 // Sort sends a SORT command.
 //
-// This command requires support for the SORT extension.
+// This command requires support for the SORT extension. If the server doesn't
+// advertise it, the command fails with a *CapabilityError.
 func (c *Client) Sort(options *SortOptions) *SortCommand {
 	return c.sort(imapwire.NumKindSeq, options)
 }
@@ -75,10 +128,77 @@ func (c *Client) UIDSort(options *SortOptions) *SortCommand {
 // SortCommand is a SORT command.
 type SortCommand struct {
 	commandBase
-	nums []uint32
+	returnOptions *imap.SearchOptions
+	esort         bool
+	nums          []uint32
+	esearch       imap.SearchData
 }
 
+// Wait blocks until the command has completed, and returns the message
+// numbers in sort order.
+//
+// If return options have been specified, only the numbers returned by the
+// ALL return data item are returned.
 func (cmd *SortCommand) Wait() ([]uint32, error) {
+	data, err := cmd.WaitData()
+	return data.All, err
+}
+
+// WaitContext is like Wait, but closes the connection if ctx is done before
+// the command has completed. See Client.WatchContext.
+func (cmd *SortCommand) WaitContext(ctx context.Context) ([]uint32, error) {
+	defer cmd.watchContext(ctx)()
+	return cmd.Wait()
+}
+
+// WaitData blocks until the command has completed, and returns the sort
+// results.
+func (cmd *SortCommand) WaitData() (*SortData, error) {
 	err := cmd.wait()
-	return cmd.nums, err
+
+	if cmd.esort {
+		data := SortData{
+			All:    cmd.nums,
+			Min:    cmd.esearch.Min,
+			Max:    cmd.esearch.Max,
+			ModSeq: cmd.esearch.ModSeq,
+		}
+		if cmd.esearch.Count != nil {
+			data.Count = *cmd.esearch.Count
+		}
+		return &data, err
+	}
+
+	data := SortData{ModSeq: cmd.esearch.ModSeq}
+	options := cmd.returnOptions
+	if options == nil || options.ReturnAll || len(returnSearchOptions(options)) == 0 {
+		data.All = cmd.nums
+	}
+	if options != nil && len(cmd.nums) > 0 {
+		if options.ReturnMin {
+			data.Min = cmd.nums[0]
+		}
+		if options.ReturnMax {
+			data.Max = cmd.nums[len(cmd.nums)-1]
+		}
+	}
+	if options != nil && options.ReturnCount {
+		data.Count = uint32(len(cmd.nums))
+	}
+	return &data, err
+}
+
+// SortData is the data returned by the SORT command.
+type SortData struct {
+	// Message numbers in sort order
+	All []uint32
+
+	// Requires SortOptions.Return. Min and Max are the first and last
+	// messages in sort order.
+	Min   uint32
+	Max   uint32
+	Count uint32
+
+	// requires CONDSTORE
+	ModSeq imap.ModSeq
 }
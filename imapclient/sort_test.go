@@ -0,0 +1,132 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestClient_Sort(t *testing.T) {
+	var nums []uint32
+	var sb strings.Builder
+	sb.WriteString("* SORT")
+	for i := uint32(10000); i > 0; i-- {
+		nums = append(nums, i)
+		sb.WriteString(" " + strconv.FormatUint(uint64(i), 10))
+	}
+	sb.WriteString("\r\n")
+
+	commands := make(chan string, 3)
+	greeting := "* OK [CAPABILITY IMAP4rev1 SORT] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, args := readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, sb.String())
+		io.WriteString(w, tag+" OK SORT completed\r\n")
+
+		tag, args = readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, "* SORT \r\n")
+		io.WriteString(w, tag+" OK SORT completed\r\n")
+
+		tag, args = readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, tag+" NO [BADCHARSET (UTF-8 US-ASCII)] Unsupported charset\r\n")
+	})
+
+	options := imapclient.SortOptions{
+		SearchCriteria: &imap.SearchCriteria{},
+		SortCriteria: []imap.SortCriterion{
+			{Key: imap.SortKeyDate, Reverse: true},
+			{Key: imap.SortKeySubject},
+		},
+	}
+	got, err := client.Sort(&options).Wait()
+	if err != nil {
+		t.Fatalf("Sort().Wait() = %v", err)
+	}
+	if cmd, want := <-commands, "SORT (REVERSE DATE SUBJECT) UTF-8 ALL"; cmd != want {
+		t.Errorf("sent %q, want %q", cmd, want)
+	}
+	if !reflect.DeepEqual(got, nums) {
+		t.Errorf("Sort().Wait() returned %v numbers, want %v", len(got), len(nums))
+	}
+
+	// Return options are computed by the client without ESORT
+	options.Return = &imap.SearchOptions{ReturnMin: true, ReturnCount: true}
+	data, err := client.Sort(&options).WaitData()
+	if err != nil {
+		t.Fatalf("Sort().WaitData() = %v", err)
+	}
+	if cmd, want := <-commands, "SORT (REVERSE DATE SUBJECT) UTF-8 ALL"; cmd != want {
+		t.Errorf("sent %q, want %q", cmd, want)
+	}
+	if !reflect.DeepEqual(data, &imapclient.SortData{}) {
+		t.Errorf("Sort().WaitData() = %#v, want empty data", data)
+	}
+
+	options.Return = nil
+	options.Charset = "ISO-8859-1"
+	_, err = client.Sort(&options).Wait()
+	if cmd, want := <-commands, "SORT (REVERSE DATE SUBJECT) ISO-8859-1 ALL"; cmd != want {
+		t.Errorf("sent %q, want %q", cmd, want)
+	}
+	var imapErr *imap.Error
+	wantArgs := []interface{}{[]string{"UTF-8", "US-ASCII"}}
+	if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeBadCharset || !reflect.DeepEqual(imapErr.CodeArgs, wantArgs) {
+		t.Errorf("Sort().Wait() = %v, want BADCHARSET error", err)
+	}
+}
+
+func TestClient_Sort_esort(t *testing.T) {
+	commands := make(chan string, 1)
+	greeting := "* OK [CAPABILITY IMAP4rev1 SORT ESORT] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, args := readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, "* ESEARCH (TAG \""+tag+"\") UID MIN 7 MAX 3 ALL 7,5:4,1,3 COUNT 5\r\n")
+		io.WriteString(w, tag+" OK SORT completed\r\n")
+	})
+
+	data, err := client.UIDSort(&imapclient.SortOptions{
+		SearchCriteria: &imap.SearchCriteria{Flag: []imap.Flag{imap.FlagSeen}},
+		SortCriteria:   []imap.SortCriterion{{Key: imap.SortKeyArrival}},
+		Return:         &imap.SearchOptions{ReturnMin: true, ReturnMax: true, ReturnAll: true, ReturnCount: true},
+	}).WaitData()
+	if err != nil {
+		t.Fatalf("UIDSort().WaitData() = %v", err)
+	}
+	if cmd, want := <-commands, `UID SORT RETURN (MIN MAX ALL COUNT) (ARRIVAL) UTF-8 SEEN`; cmd != want {
+		t.Errorf("sent %q, want %q", cmd, want)
+	}
+	want := &imapclient.SortData{
+		All:   []uint32{7, 5, 4, 1, 3},
+		Min:   7,
+		Max:   3,
+		Count: 5,
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("UIDSort().WaitData() = %#v, want %#v", data, want)
+	}
+}
+
+func TestClient_Sort_unsupported(t *testing.T) {
+	greeting := "* OK [CAPABILITY IMAP4rev1] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {})
+
+	_, err := client.Sort(&imapclient.SortOptions{
+		SearchCriteria: &imap.SearchCriteria{},
+		SortCriteria:   []imap.SortCriterion{{Key: imap.SortKeyArrival}},
+	}).Wait()
+	var capErr *imapclient.CapabilityError
+	if !errors.As(err, &capErr) || capErr.Cap != imap.CapSort {
+		t.Errorf("Sort().Wait() = %v, want CapabilityError for SORT", err)
+	}
+}
@@ -0,0 +1,143 @@
+package imapclient
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// capXList is the legacy Gmail XLIST capability, superseded by SPECIAL-USE.
+const capXList imap.Cap = "XLIST"
+
+// DefaultSpecialUseNames contains well-known names of special-use mailboxes,
+// by order of preference.
+var DefaultSpecialUseNames = map[imap.MailboxAttr][]string{
+	imap.MailboxAttrSent: {
+		"Sent", "Sent Items", "Sent Messages", "Sent Mail", "[Gmail]/Sent Mail",
+		"INBOX.Sent", "INBOX/Sent", "Gesendet", "Gesendete Objekte", "Envoyés",
+		"Elementos enviados",
+	},
+	imap.MailboxAttrDrafts: {
+		"Drafts", "Draft", "[Gmail]/Drafts", "INBOX.Drafts", "INBOX/Drafts",
+		"Entwürfe", "Brouillons", "Borradores",
+	},
+	imap.MailboxAttrTrash: {
+		"Trash", "Deleted Items", "Deleted Messages", "Bin", "[Gmail]/Trash",
+		"[Gmail]/Bin", "INBOX.Trash", "INBOX/Trash", "Papierkorb",
+		"Gelöschte Objekte", "Corbeille", "Papelera",
+	},
+	imap.MailboxAttrJunk: {
+		"Junk", "Spam", "Junk E-mail", "Junk Email", "[Gmail]/Spam", "INBOX.Junk",
+		"INBOX.Spam", "INBOX/Junk", "INBOX/Spam",
+	},
+	imap.MailboxAttrArchive: {
+		"Archive", "Archives", "INBOX.Archive", "INBOX/Archive", "Archiv",
+	},
+	imap.MailboxAttrAll: {
+		"[Gmail]/All Mail", "All Mail",
+	},
+	imap.MailboxAttrFlagged: {
+		"[Gmail]/Starred", "Starred", "Flagged",
+	},
+}
+
+// SpecialUseMailbox is a mailbox returned by Client.SpecialUseMailboxes.
+type SpecialUseMailbox struct {
+	Name string
+	// If true, the mailbox has been found by name, see
+	// Options.SpecialUseNames. Otherwise, the server has reported it with a
+	// special-use attribute.
+	Guessed bool
+}
+
+// SpecialUseMailboxes discovers the special-use mailboxes, e.g. the mailbox
+// holding sent messages.
+//
+// If the server supports SPECIAL-USE, the special-use attributes are requested
+// in a LIST command. If the server only supports XLIST, it is used instead.
+// Special-use attributes which aren't reported by the server are guessed from
+// the mailbox names.
+func (c *Client) SpecialUseMailboxes() (map[imap.MailboxAttr]SpecialUseMailbox, error) {
+	caps := c.Caps()
+	if caps == nil {
+		return nil, fmt.Errorf("imapclient: failed to fetch capabilities")
+	}
+
+	var cmd *ListCommand
+	switch {
+	case caps.Has(imap.CapSpecialUse) && caps.Has(imap.CapListExtended):
+		cmd = c.List("", "*", &imap.ListOptions{ReturnSpecialUse: true})
+	case !caps.Has(imap.CapSpecialUse) && caps.Has(capXList):
+		cmd = c.list("XLIST", "", []string{"*"}, nil)
+	default:
+		// SPECIAL-USE servers include the attributes in regular LIST
+		// responses
+		cmd = c.List("", "*", nil)
+	}
+	mailboxes, err := cmd.Collect()
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[imap.MailboxAttr]SpecialUseMailbox)
+	names := make(map[string]string) // lowercase name → name
+	for _, data := range mailboxes {
+		if hasMailboxAttr(data.Attrs, imap.MailboxAttrNoSelect) || hasMailboxAttr(data.Attrs, imap.MailboxAttrNonExistent) {
+			continue
+		}
+		names[strings.ToLower(data.Mailbox)] = data.Mailbox
+		for _, attr := range data.Attrs {
+			attr = specialUseAttr(attr)
+			if attr == "" {
+				continue
+			}
+			if _, ok := m[attr]; !ok {
+				m[attr] = SpecialUseMailbox{Name: data.Mailbox}
+			}
+		}
+	}
+
+	table := c.options.SpecialUseNames
+	if table == nil {
+		table = DefaultSpecialUseNames
+	}
+	for attr, candidates := range table {
+		if _, ok := m[attr]; ok {
+			continue
+		}
+		for _, candidate := range candidates {
+			if name, ok := names[strings.ToLower(candidate)]; ok {
+				m[attr] = SpecialUseMailbox{Name: name, Guessed: true}
+				break
+			}
+		}
+	}
+
+	return m, nil
+}
+
+// specialUseAttr returns the canonical special-use attribute for a LIST or
+// XLIST mailbox attribute, or an empty string.
+func specialUseAttr(attr imap.MailboxAttr) imap.MailboxAttr {
+	switch strings.ToLower(string(attr)) {
+	case `\all`, `\allmail`:
+		return imap.MailboxAttrAll
+	case `\archive`:
+		return imap.MailboxAttrArchive
+	case `\drafts`:
+		return imap.MailboxAttrDrafts
+	case `\flagged`, `\starred`:
+		return imap.MailboxAttrFlagged
+	case `\junk`, `\spam`:
+		return imap.MailboxAttrJunk
+	case `\sent`:
+		return imap.MailboxAttrSent
+	case `\trash`:
+		return imap.MailboxAttrTrash
+	case `\important`:
+		return imap.MailboxAttrImportant
+	default:
+		return ""
+	}
+}
@@ -2,20 +2,19 @@ package imapclient
 
 import (
 	"bufio"
-	"bytes"
 	"crypto/tls"
-	"io"
-	"net"
+	"time"
 )
 
 // startTLS sends a STARTTLS command.
 //
 // Unlike other commands, this method blocks until the command completes.
-func (c *Client) startTLS(config *tls.Config) error {
+func (c *Client) startTLS(config *tls.Config, handshakeTimeout time.Duration) error {
 	upgradeDone := make(chan struct{})
 	cmd := &startTLSCommand{
-		tlsConfig:   config,
-		upgradeDone: upgradeDone,
+		tlsConfig:        config,
+		handshakeTimeout: handshakeTimeout,
+		upgradeDone:      upgradeDone,
 	}
 	enc := c.beginCommand("STARTTLS", cmd)
 	enc.flush()
@@ -32,7 +31,7 @@ func (c *Client) startTLS(config *tls.Config) error {
 	// The decoder goroutine will invoke Client.upgradeStartTLS
 	<-upgradeDone
 
-	return cmd.tlsConn.Handshake()
+	return cmd.handshakeErr
 }
 
 // upgradeStartTLS finishes the STARTTLS upgrade after the server has sent an
@@ -40,44 +39,39 @@ func (c *Client) startTLS(config *tls.Config) error {
 func (c *Client) upgradeStartTLS(startTLS *startTLSCommand) {
 	defer close(startTLS.upgradeDone)
 
-	// Drain buffered data from our bufio.Reader
-	var buf bytes.Buffer
-	if _, err := io.CopyN(&buf, c.br, int64(c.br.Buffered())); err != nil {
+	// Discard data buffered after the OK response: it has been sent in
+	// cleartext, and may have been injected by an attacker
+	if _, err := c.br.Discard(c.br.Buffered()); err != nil {
 		panic(err) // unreachable
 	}
 
-	var cleartextConn net.Conn
-	if buf.Len() > 0 {
-		r := io.MultiReader(&buf, c.conn)
-		cleartextConn = startTLSConn{c.conn, r}
-	} else {
-		cleartextConn = c.conn
-	}
-
-	tlsConn := tls.Client(cleartextConn, startTLS.tlsConfig)
-	rw := c.options.wrapReadWriter(tlsConn)
+	tlsConn := tls.Client(c.conn, startTLS.tlsConfig)
+	rw := c.options.wrapReadWriter(tlsConn, c.debugLog)
 
+	c.rw = tlsConn
 	c.br.Reset(rw)
 	// Unfortunately we can't re-use the bufio.Writer here, it races with
 	// Client.StartTLS
 	c.bw = bufio.NewWriter(rw)
 
-	startTLS.tlsConn = tlsConn
+	// Perform the handshake here rather than in Client.startTLS, so that the
+	// decoder goroutine doesn't start it without a timeout when reading the
+	// next response
+	startTLS.handshakeErr = handshakeTLS(tlsConn, c.conn, startTLS.handshakeTimeout)
+	if startTLS.handshakeErr != nil {
+		return
+	}
+
+	c.mutex.Lock()
+	c.tlsConn = tlsConn
+	c.mutex.Unlock()
 }
 
 type startTLSCommand struct {
 	commandBase
-	tlsConfig *tls.Config
-
-	upgradeDone chan<- struct{}
-	tlsConn     *tls.Conn
-}
-
-type startTLSConn struct {
-	net.Conn
-	r io.Reader
-}
+	tlsConfig        *tls.Config
+	handshakeTimeout time.Duration
 
-func (conn startTLSConn) Read(b []byte) (int, error) {
-	return conn.r.Read(b)
+	upgradeDone  chan<- struct{}
+	handshakeErr error
 }
@@ -1,9 +1,18 @@
 package imapclient_test
 
 import (
+	"bufio"
+	"bytes"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/imapclient"
 )
 
@@ -25,3 +34,152 @@ func TestStartTLS(t *testing.T) {
 		t.Fatalf("Noop().Wait() = %v", err)
 	}
 }
+
+func TestStartTLS_pinning(t *testing.T) {
+	cert, err := tls.X509KeyPair([]byte(rsaCertPEM), []byte(rsaKeyPEM))
+	if err != nil {
+		t.Fatalf("tls.X509KeyPair() = %v", err)
+	}
+	pinned := cert.Certificate[0]
+
+	for _, tc := range []struct {
+		name   string
+		pinned []byte
+		ok     bool
+	}{
+		{"match", pinned, true},
+		{"mismatch", []byte("invalid"), false},
+	} {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			conn, server := newMemClientServerPair(t)
+			defer conn.Close()
+			defer server.Close()
+
+			errPinMismatch := errors.New("certificate doesn't match pinned certificate")
+			options := imapclient.Options{
+				TLSConfig: &tls.Config{
+					InsecureSkipVerify: true,
+					VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+						if len(rawCerts) == 0 || !bytes.Equal(rawCerts[0], tc.pinned) {
+							return errPinMismatch
+						}
+						return nil
+					},
+				},
+			}
+			client, err := imapclient.NewStartTLS(conn, &options)
+			if !tc.ok {
+				if !errors.Is(err, errPinMismatch) {
+					t.Errorf("NewStartTLS() = %v, want %v", err, errPinMismatch)
+				}
+				if client != nil {
+					client.Close()
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewStartTLS() = %v", err)
+			}
+			defer client.Close()
+
+			state, ok := client.TLSConnectionState()
+			if !ok || !state.HandshakeComplete || state.Version == 0 {
+				t.Errorf("TLSConnectionState() = %v, %v, want a complete handshake", state, ok)
+			}
+			if caps := client.Caps(); caps.Has(imap.CapStartTLS) {
+				t.Errorf("STARTTLS advertised after TLS handshake")
+			}
+		})
+	}
+}
+
+// serveFakeStartTLS emulates a server which injects cleartext data after its
+// STARTTLS response.
+func serveFakeStartTLS(t *testing.T, conn net.Conn, handshake bool) {
+	defer conn.Close()
+
+	io.WriteString(conn, "* OK [CAPABILITY IMAP4rev1 STARTTLS LOGINDISABLED] Server ready\r\n")
+
+	br := bufio.NewReader(conn)
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return
+	}
+	tag := strings.Fields(line)[0]
+	io.WriteString(conn, tag+" OK [CAPABILITY IMAP4rev1 AUTH=INJECTED] Begin TLS negotiation now\r\n"+
+		"* CAPABILITY IMAP4rev1 AUTH=INJECTED\r\n")
+
+	if !handshake {
+		io.Copy(io.Discard, conn)
+		return
+	}
+
+	cert, err := tls.X509KeyPair([]byte(rsaCertPEM), []byte(rsaKeyPEM))
+	if err != nil {
+		t.Errorf("tls.X509KeyPair() = %v", err)
+		return
+	}
+	tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+	br = bufio.NewReader(tlsConn)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return
+		}
+		tag := fields[0]
+		switch strings.ToUpper(fields[1]) {
+		case "CAPABILITY":
+			io.WriteString(tlsConn, "* CAPABILITY IMAP4rev1 AUTH=PLAIN\r\n"+tag+" OK CAPABILITY completed\r\n")
+		default:
+			io.WriteString(tlsConn, tag+" OK Completed\r\n")
+		}
+	}
+}
+
+func TestStartTLS_capsAfterHandshake(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	go serveFakeStartTLS(t, serverConn, true)
+
+	options := imapclient.Options{
+		TLSConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	client, err := imapclient.NewStartTLS(clientConn, &options)
+	if err != nil {
+		t.Fatalf("NewStartTLS() = %v", err)
+	}
+	defer client.Close()
+
+	caps := client.Caps()
+	if !caps.Has(imap.AuthCap("PLAIN")) {
+		t.Errorf("Caps() = %v, want AUTH=PLAIN", caps)
+	}
+	for _, c := range []imap.Cap{imap.AuthCap("INJECTED"), imap.CapStartTLS, imap.CapLoginDisabled} {
+		if caps.Has(c) {
+			t.Errorf("Caps() = %v, pre-TLS capability %v must not be trusted", caps, c)
+		}
+	}
+}
+
+func TestStartTLS_handshakeTimeout(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	go serveFakeStartTLS(t, serverConn, false)
+
+	options := imapclient.Options{
+		TLSConfig:           &tls.Config{InsecureSkipVerify: true},
+		TLSHandshakeTimeout: 50 * time.Millisecond,
+	}
+	start := time.Now()
+	client, err := imapclient.NewStartTLS(clientConn, &options)
+	if err == nil {
+		client.Close()
+		t.Fatalf("NewStartTLS() succeeded without a TLS handshake")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("NewStartTLS() took %v, want it to time out", d)
+	}
+}
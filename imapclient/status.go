@@ -1,6 +1,7 @@
 package imapclient
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -19,6 +20,7 @@ func statusItems(options *imap.StatusOptions) []string {
 		"APPENDLIMIT":     options.AppendLimit,
 		"DELETED-STORAGE": options.DeletedStorage,
 		"HIGHESTMODSEQ":   options.HighestModSeq,
+		"MAILBOXID":       options.MailboxID,
 	}
 
 	var l []string
@@ -72,6 +74,13 @@ func (c *Client) handleStatus() error {
 		cmd.pendingData.Status = data
 		cmd.mailboxes <- cmd.pendingData
 		cmd.pendingData = nil
+	default:
+		if h := c.notifyHandler(data.Mailbox); h != nil && h.Status != nil {
+			h.Status(data)
+		}
+		queueUpdate(c, &c.handlers.status, func(f func(*imap.StatusData)) {
+			f(data)
+		})
 	}
 
 	return nil
@@ -88,6 +97,13 @@ func (cmd *StatusCommand) Wait() (*imap.StatusData, error) {
 	return &cmd.data, cmd.wait()
 }
 
+// WaitContext is like Wait, but closes the connection if ctx is done before
+// the command has completed. See Client.WatchContext.
+func (cmd *StatusCommand) WaitContext(ctx context.Context) (*imap.StatusData, error) {
+	defer cmd.watchContext(ctx)()
+	return cmd.Wait()
+}
+
 func readStatus(dec *imapwire.Decoder) (*imap.StatusData, error) {
 	var data imap.StatusData
 
@@ -149,13 +165,118 @@ func readStatusAttVal(dec *imapwire.Decoder, data *imap.StatusData) error {
 		data.DeletedStorage = &storage
 	case "HIGHESTMODSEQ":
 		ok = dec.ExpectModSeq(&data.HighestModSeq)
+	case "MAILBOXID":
+		ok = readObjectID(dec, &data.MailboxID)
 	default:
-		if !dec.DiscardValue() {
-			return dec.Err()
-		}
+		// Skip unknown items, e.g. vendor extensions
+		ok = dec.DiscardValue()
 	}
 	if !ok {
 		return dec.Err()
 	}
 	return nil
 }
+
+// MailboxStatus is the result of Client.Statuses for a single mailbox.
+type MailboxStatus struct {
+	Data *imap.StatusData
+	// Err is non-nil if the server has refused to return the status of the
+	// mailbox, e.g. with a NO response.
+	Err error
+}
+
+// Statuses returns the status of all selectable mailboxes matching the
+// provided LIST patterns, keyed by mailbox name.
+//
+// If the server supports LIST-STATUS, a single LIST command is sent. Otherwise,
+// the mailboxes are listed and STATUS commands are pipelined, see
+// Options.StatusConcurrency.
+//
+// Per-mailbox failures are reported in MailboxStatus.Err, the returned error
+// is only non-nil if the mailboxes couldn't be listed.
+//
+// Unlike other commands, this method blocks until all responses have been
+// received.
+func (c *Client) Statuses(patterns []string, options *imap.StatusOptions) (map[string]*MailboxStatus, error) {
+	if options == nil {
+		options = new(imap.StatusOptions)
+	}
+
+	if len(patterns) == 0 {
+		return make(map[string]*MailboxStatus), nil
+	}
+
+	caps := c.Caps()
+	if caps == nil {
+		return nil, fmt.Errorf("imapclient: failed to fetch capabilities")
+	}
+
+	var listOptions *imap.ListOptions
+	if caps.Has(imap.CapListStatus) {
+		listOptions = &imap.ListOptions{ReturnStatus: options}
+	}
+
+	var mailboxes []*imap.ListData
+	if listOptions != nil || len(patterns) == 1 || caps.Has(imap.CapListExtended) {
+		var err error
+		mailboxes, err = c.list("LIST", "", patterns, listOptions).Collect()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		for _, pattern := range patterns {
+			l, err := c.List("", pattern, nil).Collect()
+			if err != nil {
+				return nil, err
+			}
+			mailboxes = append(mailboxes, l...)
+		}
+	}
+
+	statuses := make(map[string]*MailboxStatus)
+	var pending []string
+	for _, data := range mailboxes {
+		if _, ok := statuses[data.Mailbox]; ok || hasMailboxAttr(data.Attrs, imap.MailboxAttrNoSelect) || hasMailboxAttr(data.Attrs, imap.MailboxAttrNonExistent) {
+			continue
+		}
+		statuses[data.Mailbox] = &MailboxStatus{Data: data.Status}
+		// The server may omit the STATUS response if it fails to look it up
+		if data.Status == nil {
+			pending = append(pending, data.Mailbox)
+		}
+	}
+
+	// Pipeline STATUS commands, with at most window commands in flight
+	window := c.options.statusConcurrency()
+	var inflight []*StatusCommand
+	wait := func() {
+		cmd := inflight[0]
+		inflight = inflight[1:]
+		data, err := cmd.Wait()
+		if err != nil {
+			statuses[cmd.mailbox].Err = err
+		} else {
+			statuses[cmd.mailbox].Data = data
+		}
+	}
+	for _, mailbox := range pending {
+		if len(inflight) >= window {
+			wait()
+		}
+		inflight = append(inflight, c.Status(mailbox, options))
+	}
+	for len(inflight) > 0 {
+		wait()
+	}
+
+	return statuses, nil
+}
+
+func hasMailboxAttr(attrs []imap.MailboxAttr, attr imap.MailboxAttr) bool {
+	for _, a := range attrs {
+		if strings.EqualFold(string(a), string(attr)) {
+			return true
+		}
+	}
+	return false
+}
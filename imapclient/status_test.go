@@ -1,10 +1,17 @@
 package imapclient_test
 
 import (
+	"bufio"
+	"errors"
+	"io"
 	"reflect"
+	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
 )
 
 func TestStatus(t *testing.T) {
@@ -32,3 +39,163 @@ func TestStatus(t *testing.T) {
 		t.Errorf("Status() = %#v but want %#v", data, want)
 	}
 }
+
+func TestClient_Statuses(t *testing.T) {
+	tests := []struct {
+		name string
+		caps imap.CapSet
+	}{
+		{"LIST-STATUS", imap.CapSet{imap.CapListExtended: {}, imap.CapListStatus: {}}},
+		{"none", imap.CapSet{}},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			testStatuses(t, tc.caps)
+		})
+	}
+}
+
+func testStatuses(t *testing.T, extraCaps imap.CapSet) {
+	user := imapmemserver.NewUser(testUsername, testPassword)
+	user.Create("INBOX", nil)
+	user.Create("Entwürfe", nil)
+	user.Create("Archive", nil)
+	user.Create("Archive/2023", nil)
+	dial := newCapsTestServer(t, user, extraCaps)
+
+	var debug lockedBuffer
+	client := dial(&imapclient.Options{
+		DebugWriter:       &debug,
+		StatusConcurrency: 2,
+	})
+	appendTestMessage(t, client)
+
+	statuses, err := client.Statuses([]string{"INBOX", "Entw*", "Archive*"}, &imap.StatusOptions{
+		NumMessages: true,
+		NumUnseen:   true,
+	})
+	if err != nil {
+		t.Fatalf("Statuses() = %v", err)
+	}
+
+	want := map[string]uint32{
+		"INBOX":        1,
+		"Entwürfe":     0,
+		"Archive":      0,
+		"Archive/2023": 0,
+	}
+	if len(statuses) != len(want) {
+		t.Errorf("Statuses() returned %v mailboxes, want %v", len(statuses), len(want))
+	}
+	for name, numMessages := range want {
+		status := statuses[name]
+		if status == nil {
+			t.Errorf("missing status for mailbox %q", name)
+		} else if status.Err != nil {
+			t.Errorf("status for mailbox %q: %v", name, status.Err)
+		} else if status.Data.NumMessages == nil || *status.Data.NumMessages != numMessages {
+			t.Errorf("status for mailbox %q: MESSAGES = %v, want %v", name, status.Data.NumMessages, numMessages)
+		}
+	}
+
+	wire := debug.String()
+	listCmds := regexp.MustCompile(`(?m)^T[0-9]+ LIST .*$`).FindAllString(wire, -1)
+	statusCmds := regexp.MustCompile(`(?m)^T[0-9]+ STATUS .*$`).FindAllString(wire, -1)
+	if _, ok := extraCaps[imap.CapListStatus]; ok {
+		if len(listCmds) != 1 || !strings.Contains(listCmds[0], " RETURN (STATUS (") {
+			t.Errorf("LIST commands = %q, want a single one with RETURN STATUS", listCmds)
+		}
+		if len(statusCmds) != 0 {
+			t.Errorf("unexpected STATUS commands: %q", statusCmds)
+		}
+	} else if len(statusCmds) != len(want) || !strings.Contains(wire, " STATUS \"Entw&APw-rfe\" (") {
+		t.Errorf("expected a STATUS command for the UTF-7 mailbox:\n%v", wire)
+	}
+}
+
+func TestClient_Statuses_no(t *testing.T) {
+	greeting := "* OK [CAPABILITY IMAP4rev1] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, _ := readScriptTaggedCommand(t, br, w)
+		io.WriteString(w, `* LIST () "/" INBOX`+"\r\n")
+		io.WriteString(w, `* LIST () "/" Broken`+"\r\n")
+		io.WriteString(w, `* LIST (\Noselect) "/" Folder`+"\r\n")
+		io.WriteString(w, tag+" OK LIST completed\r\n")
+
+		for i := 0; i < 2; i++ {
+			tag, args := readScriptTaggedCommand(t, br, w)
+			if strings.Contains(args, "Broken") {
+				io.WriteString(w, tag+" NO Mailbox is broken\r\n")
+			} else {
+				io.WriteString(w, "* STATUS INBOX (MESSAGES 42)\r\n")
+				io.WriteString(w, tag+" OK STATUS completed\r\n")
+			}
+		}
+	})
+
+	statuses, err := client.Statuses([]string{"*"}, &imap.StatusOptions{NumMessages: true})
+	if err != nil {
+		t.Fatalf("Statuses() = %v", err)
+	}
+	if len(statuses) != 2 {
+		t.Errorf("Statuses() returned %v mailboxes, want 2", len(statuses))
+	}
+	if status := statuses["INBOX"]; status == nil || status.Err != nil || *status.Data.NumMessages != 42 {
+		t.Errorf("status for INBOX = %#v, want 42 messages", status)
+	}
+	var imapErr *imap.Error
+	if status := statuses["Broken"]; status == nil || !errors.As(status.Err, &imapErr) {
+		t.Errorf("status for Broken = %#v, want an *imap.Error", status)
+	}
+}
+
+func TestStatus_unknownItems(t *testing.T) {
+	greeting := "* PREAUTH [CAPABILITY IMAP4rev2 LIST-STATUS APPENDLIMIT CONDSTORE OBJECTID] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, _ := readScriptTaggedCommand(t, br, w)
+		io.WriteString(w, `* STATUS blurdybloop (MESSAGES 231 X-VENDOR (1 "two" (3 NIL)) UIDNEXT 44292 X-GUID 0123abc APPENDLIMIT NIL `+
+			`MAILBOXID (F2212ea87-6097-4256-9d51-71338625) X-EMPTY () HIGHESTMODSEQ 7011231777 SIZE 3210)`+"\r\n")
+		io.WriteString(w, tag+" OK STATUS completed\r\n")
+
+		tag, _ = readScriptTaggedCommand(t, br, w)
+		io.WriteString(w, `* LIST () "/" blurdybloop`+"\r\n")
+		io.WriteString(w, `* STATUS blurdybloop (X-VENDOR {3}`+"\r\nabc"+` UNSEEN 2 X-FOO 12)`+"\r\n")
+		io.WriteString(w, tag+" OK LIST completed\r\n")
+	})
+
+	data, err := client.Status("blurdybloop", &imap.StatusOptions{
+		NumMessages:   true,
+		UIDNext:       true,
+		AppendLimit:   true,
+		MailboxID:     true,
+		HighestModSeq: true,
+		Size:          true,
+	}).Wait()
+	if err != nil {
+		t.Fatalf("Status().Wait() = %v", err)
+	}
+	numMessages, appendLimit, size := uint32(231), ^uint32(0), int64(3210)
+	want := &imap.StatusData{
+		Mailbox:       "blurdybloop",
+		NumMessages:   &numMessages,
+		UIDNext:       44292,
+		AppendLimit:   &appendLimit,
+		MailboxID:     "F2212ea87-6097-4256-9d51-71338625",
+		HighestModSeq: 7011231777,
+		Size:          &size,
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("Status().Wait() = %#v, want %#v", data, want)
+	}
+
+	mailboxes, err := client.List("", "blurdybloop", &imap.ListOptions{
+		ReturnStatus: &imap.StatusOptions{NumUnseen: true},
+	}).Collect()
+	if err != nil {
+		t.Fatalf("List().Collect() = %v", err)
+	}
+	if len(mailboxes) != 1 || mailboxes[0].Status == nil || mailboxes[0].Status.NumUnseen == nil || *mailboxes[0].Status.NumUnseen != 2 {
+		t.Errorf("List().Collect() = %#v, want blurdybloop with UNSEEN 2", mailboxes)
+	}
+}
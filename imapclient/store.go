@@ -11,8 +11,15 @@ import (
 //
 // Unless StoreFlags.Silent is set, the server will return the updated values.
 //
+// If StoreOptions.UnchangedSince is set, messages modified since then are left
+// untouched. They can be retrieved with FetchCommand.Modified.
+//
 // A nil options pointer is equivalent to a zero options value.
 func (c *Client) Store(numSet imap.NumSet, store *imap.StoreFlags, options *imap.StoreOptions) *FetchCommand {
+	if err := c.checkSearchRes(numSet); err != nil {
+		return failedFetchCommand(err)
+	}
+
 	cmd := &FetchCommand{
 		numSet: numSet,
 		msgs:   make(chan *FetchMessageData, 128),
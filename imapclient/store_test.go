@@ -1,9 +1,16 @@
 package imapclient_test
 
 import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
 	"testing"
 
 	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
 )
 
 func TestStore(t *testing.T) {
@@ -38,3 +45,369 @@ func TestStore(t *testing.T) {
 		t.Errorf("msg.Flags is missing deleted flag: %v", msg.Flags)
 	}
 }
+
+func TestStore_unchangedSince(t *testing.T) {
+	memServer := imapmemserver.New()
+	user := imapmemserver.NewUser(testUsername, testPassword)
+	user.Create("INBOX", nil)
+	memServer.AddUser(user)
+
+	server := imapserver.New(&imapserver.Options{
+		NewSession: func(conn *imapserver.Conn) (imapserver.Session, *imapserver.GreetingData, error) {
+			return memServer.NewSession(), nil, nil
+		},
+		InsecureAuth: true,
+		Caps: imap.CapSet{
+			imap.CapIMAP4rev1: {},
+			imap.CapIMAP4rev2: {},
+			imap.CapCondStore: {},
+		},
+	})
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("net.Listen() = %v", err)
+	}
+	go server.Serve(ln)
+	defer server.Close()
+
+	dial := func() *imapclient.Client {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("net.Dial() = %v", err)
+		}
+		client := imapclient.New(conn, nil)
+		if err := client.Login(testUsername, testPassword).Wait(); err != nil {
+			t.Fatalf("Login().Wait() = %v", err)
+		}
+		if err := client.EnableCondStore(); err != nil {
+			t.Fatalf("EnableCondStore() = %v", err)
+		}
+		return client
+	}
+
+	client := dial()
+	defer client.Close()
+	other := dial()
+	defer other.Close()
+
+	for i := 0; i < 2; i++ {
+		appendCmd := client.Append("INBOX", int64(len(simpleRawMessage)), nil)
+		appendCmd.Write([]byte(simpleRawMessage))
+		appendCmd.Close()
+		if _, err := appendCmd.Wait(); err != nil {
+			t.Fatalf("Append().Wait() = %v", err)
+		}
+	}
+
+	selectData, err := client.Select("INBOX", nil).Wait()
+	if err != nil {
+		t.Fatalf("Select().Wait() = %v", err)
+	} else if selectData.HighestModSeq == 0 {
+		t.Fatalf("Select().Wait() returned zero HighestModSeq")
+	}
+	highestModSeq := selectData.HighestModSeq
+
+	msgs, err := client.Fetch(imap.SeqSetNum(1, 2), &imap.FetchOptions{UID: true, ModSeq: true}).Collect()
+	if err != nil {
+		t.Fatalf("Fetch().Collect() = %v", err)
+	} else if len(msgs) != 2 {
+		t.Fatalf("len(msgs) = %v, want 2", len(msgs))
+	}
+	for _, msg := range msgs {
+		if msg.ModSeq == 0 || msg.ModSeq > highestModSeq {
+			t.Errorf("msg.ModSeq = %v, want between 1 and %v", msg.ModSeq, highestModSeq)
+		}
+	}
+	uid := msgs[1].UID
+
+	// Another client changes the second message
+	if _, err := other.Select("INBOX", nil).Wait(); err != nil {
+		t.Fatalf("Select().Wait() = %v", err)
+	}
+	storeFlags := imap.StoreFlags{
+		Op:     imap.StoreFlagsAdd,
+		Silent: true,
+		Flags:  []imap.Flag{imap.FlagFlagged},
+	}
+	if err := other.Store(imap.UIDSetNum(uid), &storeFlags, nil).Close(); err != nil {
+		t.Fatalf("Store().Close() = %v", err)
+	}
+
+	statusData, err := other.Status("INBOX", &imap.StatusOptions{HighestModSeq: true}).Wait()
+	if err != nil {
+		t.Fatalf("Status().Wait() = %v", err)
+	} else if statusData.HighestModSeq <= highestModSeq {
+		t.Errorf("statusData.HighestModSeq = %v, want more than %v", statusData.HighestModSeq, highestModSeq)
+	}
+
+	// The conditional STORE only updates the first message
+	storeFlags = imap.StoreFlags{
+		Op:    imap.StoreFlagsAdd,
+		Flags: []imap.Flag{imap.FlagSeen},
+	}
+	storeCmd := client.Store(imap.UIDSetNum(msgs[0].UID, uid), &storeFlags, &imap.StoreOptions{
+		UnchangedSince: highestModSeq,
+	})
+	stored, err := storeCmd.Collect()
+	if err != nil {
+		t.Fatalf("Store().Collect() = %v", err)
+	}
+	if len(stored) != 1 || stored[0].UID != msgs[0].UID || stored[0].ModSeq <= highestModSeq {
+		t.Errorf("Store().Collect() = %v, want a single message with UID %v and a new mod-sequence", stored, msgs[0].UID)
+	}
+	modified, ok := storeCmd.Modified().(imap.UIDSet)
+	if !ok || modified.String() != imap.UIDSetNum(uid).String() {
+		t.Errorf("Modified() = %v, want %v", storeCmd.Modified(), uid)
+	}
+
+	changed, err := client.Fetch(imap.SeqSetNum(1, 2), &imap.FetchOptions{
+		UID:          true,
+		ChangedSince: highestModSeq,
+	}).Collect()
+	if err != nil {
+		t.Fatalf("Fetch().Collect() = %v", err)
+	} else if len(changed) != 2 {
+		t.Errorf("len(changed) = %v, want 2", len(changed))
+	}
+}
+
+func TestClient_EnableCondStore_select(t *testing.T) {
+	greeting := "* OK [CAPABILITY IMAP4rev1 CONDSTORE] Server ready"
+	commands := make(chan string, 2)
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, args := readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, "* 3 EXISTS\r\n")
+		io.WriteString(w, "* OK [UIDVALIDITY 1] UIDs valid\r\n")
+		io.WriteString(w, "* OK [HIGHESTMODSEQ 715194045007] Highest\r\n")
+		io.WriteString(w, tag+" OK [READ-WRITE] SELECT completed\r\n")
+
+		tag, args = readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, "* 3 FETCH (UID 7 MODSEQ (715194045008) FLAGS (\\Seen))\r\n")
+		io.WriteString(w, tag+" OK [MODIFIED 1:2] Conditional STORE failed\r\n")
+	})
+
+	// Without ENABLE, the CONDSTORE parameter is sent with SELECT
+	if err := client.EnableCondStore(); err != nil {
+		t.Fatalf("EnableCondStore() = %v", err)
+	}
+	data, err := client.Select("INBOX", nil).Wait()
+	if err != nil {
+		t.Fatalf("Select().Wait() = %v", err)
+	}
+	if cmd, want := <-commands, "SELECT INBOX (CONDSTORE)"; cmd != want {
+		t.Errorf("sent %q, want %q", cmd, want)
+	}
+	if data.HighestModSeq != 715194045007 {
+		t.Errorf("data.HighestModSeq = %v, want %v", data.HighestModSeq, uint64(715194045007))
+	}
+
+	storeFlags := imap.StoreFlags{
+		Op:    imap.StoreFlagsAdd,
+		Flags: []imap.Flag{imap.FlagSeen},
+	}
+	storeCmd := client.Store(imap.SeqSetNum(1, 2, 3), &storeFlags, &imap.StoreOptions{
+		UnchangedSince: 715194045007,
+	})
+	msgs, err := storeCmd.Collect()
+	if err != nil {
+		t.Fatalf("Store().Collect() = %v", err)
+	}
+	if cmd, want := <-commands, "STORE 1:3 (UNCHANGEDSINCE 715194045007) +FLAGS (\\Seen)"; cmd != want {
+		t.Errorf("sent %q, want %q", cmd, want)
+	}
+	if len(msgs) != 1 || msgs[0].SeqNum != 3 || msgs[0].ModSeq != 715194045008 {
+		t.Errorf("Store().Collect() = %v, want message 3 with MODSEQ 715194045008", msgs)
+	}
+	if modified, ok := storeCmd.Modified().(imap.SeqSet); !ok || modified.String() != "1:2" {
+		t.Errorf("Modified() = %v, want 1:2", storeCmd.Modified())
+	}
+}
+
+func TestStore_flagCase(t *testing.T) {
+	client, server := newClientServerPair(t, imap.ConnStateSelected)
+	defer client.Close()
+	defer server.Close()
+
+	seqSet := imap.SeqSetNum(1)
+	err := client.Store(seqSet, &imap.StoreFlags{
+		Op:     imap.StoreFlagsAdd,
+		Silent: true,
+		Flags:  []imap.Flag{"\\SEEN", "\\flagged", "Work", "$junk"},
+	}, nil).Close()
+	if err != nil {
+		t.Fatalf("Store().Close() = %v", err)
+	}
+	err = client.Store(seqSet, &imap.StoreFlags{
+		Op:     imap.StoreFlagsDel,
+		Silent: true,
+		Flags:  []imap.Flag{"WORK"},
+	}, nil).Close()
+	if err != nil {
+		t.Fatalf("Store().Close() = %v", err)
+	}
+
+	msgs, err := client.Fetch(seqSet, &imap.FetchOptions{Flags: true}).Collect()
+	if err != nil {
+		t.Fatalf("Fetch().Collect() = %v", err)
+	}
+	flags := msgs[0].Flags
+	for _, flag := range []imap.Flag{imap.FlagSeen, imap.FlagFlagged, imap.FlagJunk} {
+		if !containsFlag(flags, flag) {
+			t.Errorf("flags = %v, want %v", flags, flag)
+		}
+	}
+	for _, flag := range flags {
+		if flag.Canonical() == "work" {
+			t.Errorf("flags = %v, want Work to be removed", flags)
+		}
+	}
+}
+
+func TestStore_invalidFlag(t *testing.T) {
+	client, server := newClientServerPair(t, imap.ConnStateSelected)
+	defer client.Close()
+	defer server.Close()
+
+	err := client.Store(imap.SeqSetNum(1), &imap.StoreFlags{
+		Op:    imap.StoreFlagsAdd,
+		Flags: []imap.Flag{imap.FlagWildcard},
+	}, nil).Close()
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) || imapErr.Type != imap.StatusResponseTypeBad {
+		t.Errorf("Store(\\*).Close() = %v, want BAD", err)
+	}
+
+	// The connection is still usable
+	if err := client.Noop().Wait(); err != nil {
+		t.Errorf("Noop().Wait() = %v", err)
+	}
+}
+
+func TestFlag(t *testing.T) {
+	for _, tc := range []struct {
+		flag, canonical imap.Flag
+		system, valid   bool
+	}{
+		{"\\SEEN", imap.FlagSeen, true, true},
+		{"\\recent", "\\Recent", true, true},
+		{"$mdnsent", imap.FlagMDNSent, false, true},
+		{"$LABEL3", imap.FlagLabel3, false, true},
+		{"Work", "work", false, true},
+		{"my flag", "my flag", false, false},
+		{"(x)", "(x)", false, false},
+		{"\\*", "\\*", true, false},
+		{"", "", false, false},
+	} {
+		if got := tc.flag.Canonical(); got != tc.canonical {
+			t.Errorf("Flag(%q).Canonical() = %q, want %q", tc.flag, got, tc.canonical)
+		}
+		if got := tc.flag.IsSystem(); got != tc.system {
+			t.Errorf("Flag(%q).IsSystem() = %v, want %v", tc.flag, got, tc.system)
+		}
+		if got := tc.flag.Valid(); got != tc.valid {
+			t.Errorf("Flag(%q).Valid() = %v, want %v", tc.flag, got, tc.valid)
+		}
+	}
+
+	if flag, err := imap.Keyword("$Work"); err != nil || flag != "$Work" {
+		t.Errorf("Keyword($Work) = %q, %v", flag, err)
+	}
+	for _, name := range []string{"\\Seen", "two words", "tab\t", ""} {
+		if _, err := imap.Keyword(name); err == nil {
+			t.Errorf("Keyword(%q) = nil error, want an error", name)
+		}
+	}
+}
+
+func TestClient_condStoreSyntax(t *testing.T) {
+	greeting := "* PREAUTH [CAPABILITY IMAP4rev1 CONDSTORE] Server ready"
+	commands := make(chan string, 5)
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, args := readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, "* STATUS blurdybloop (MESSAGES 231 UIDNEXT 7499 HIGHESTMODSEQ 7011231777)\r\n")
+		io.WriteString(w, tag+" OK STATUS completed\r\n")
+
+		tag, args = readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, "* 1 FETCH (UID 4 MODSEQ (65402) FLAGS (\\Seen))\r\n")
+		io.WriteString(w, tag+" OK FETCH completed\r\n")
+
+		tag, args = readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, tag+" OK [MODIFIED 6] Conditional STORE failed\r\n")
+
+		tag, args = readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, tag+" NO [MODIFIED 7,9] Conditional STORE failed\r\n")
+
+		tag, args = readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, "* STATUS blurdybloop (HIGHESTMODSEQ 9223372036854775808)\r\n")
+		io.WriteString(w, tag+" OK STATUS completed\r\n")
+	})
+
+	statusData, err := client.Status("blurdybloop", &imap.StatusOptions{HighestModSeq: true}).Wait()
+	if err != nil {
+		t.Fatalf("Status().Wait() = %v", err)
+	}
+	if cmd, want := <-commands, `STATUS "blurdybloop" (HIGHESTMODSEQ)`; cmd != want {
+		t.Errorf("sent %q, want %q", cmd, want)
+	}
+	if statusData.HighestModSeq != 7011231777 {
+		t.Errorf("HighestModSeq = %v, want 7011231777", statusData.HighestModSeq)
+	}
+
+	msgs, err := client.Fetch(imap.UIDSetNum(4), &imap.FetchOptions{
+		Flags:        true,
+		ChangedSince: 12345,
+	}).Collect()
+	if err != nil {
+		t.Fatalf("Fetch().Collect() = %v", err)
+	}
+	if cmd, want := <-commands, "UID FETCH 4 (UID FLAGS) (CHANGEDSINCE 12345)"; cmd != want {
+		t.Errorf("sent %q, want %q", cmd, want)
+	}
+	if len(msgs) != 1 || msgs[0].ModSeq != 65402 {
+		t.Errorf("Fetch().Collect() = %v, want a message with MODSEQ 65402", msgs)
+	}
+
+	storeFlags := imap.StoreFlags{
+		Op:     imap.StoreFlagsAdd,
+		Silent: true,
+		Flags:  []imap.Flag{imap.FlagDeleted},
+	}
+	storeCmd := client.Store(imap.UIDSetNum(4, 6, 8), &storeFlags, &imap.StoreOptions{
+		UnchangedSince: 12121230045,
+	})
+	if err := storeCmd.Close(); err != nil {
+		t.Fatalf("Store().Close() = %v", err)
+	}
+	if cmd, want := <-commands, "UID STORE 4,6,8 (UNCHANGEDSINCE 12121230045) +FLAGS.SILENT (\\Deleted)"; cmd != want {
+		t.Errorf("sent %q, want %q", cmd, want)
+	}
+	if modified, ok := storeCmd.Modified().(imap.UIDSet); !ok || modified.String() != "6" {
+		t.Errorf("Modified() = %v, want UID set 6", storeCmd.Modified())
+	}
+
+	err = client.Store(imap.SeqSetNum(7, 8, 9), &storeFlags, &imap.StoreOptions{
+		UnchangedSince: 320162338,
+	}).Close()
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeModified || len(imapErr.CodeArgs) != 1 {
+		t.Fatalf("Store().Close() = %v, want a MODIFIED error", err)
+	}
+	<-commands
+	if arg, ok := imapErr.CodeArgs[0].(imap.ModifiedCodeArg); !ok || arg.String() != "7,9" {
+		t.Errorf("CodeArgs[0] = %#v, want a ModifiedCodeArg with 7,9", imapErr.CodeArgs[0])
+	}
+
+	// Mod-sequences are 63-bit
+	_, err = client.Status("blurdybloop", &imap.StatusOptions{HighestModSeq: true}).Wait()
+	if err == nil {
+		t.Errorf("Status().Wait() = nil, want an error for an overflowing HIGHESTMODSEQ")
+	}
+	<-commands
+}
@@ -1,9 +1,11 @@
 package imapclient
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
@@ -11,20 +13,33 @@ import (
 type ThreadOptions struct {
 	Algorithm      imap.ThreadAlgorithm
 	SearchCriteria *imap.SearchCriteria
+	// Charset of the search criteria. If empty, UTF-8 is used.
+	Charset string
 }
 
 func (c *Client) thread(numKind imapwire.NumKind, options *ThreadOptions) *ThreadCommand {
-	cmd := &ThreadCommand{}
+	if err := c.checkCap(imap.Cap("THREAD=" + string(options.Algorithm))); err != nil {
+		return &ThreadCommand{commandBase: failedCommandBase(err)}
+	}
+
+	charset := options.Charset
+	if charset == "" {
+		charset = "UTF-8"
+	}
+
+	cmd := &ThreadCommand{uid: numKind == imapwire.NumKindUID}
 	enc := c.beginCommand(uidCmdName("THREAD", numKind), cmd)
-	enc.SP().Atom(string(options.Algorithm)).SP().Atom("UTF-8").SP()
-	writeSearchKey(enc.Encoder, options.SearchCriteria)
+	enc.SP().Atom(string(options.Algorithm)).SP().AString(charset).SP()
+	writeSearchKey(enc.Encoder, options.SearchCriteria, c.Caps().Has(imap.CapWithin))
 	enc.end()
 	return cmd
 }
 
 // Thread sends a THREAD command.
 //
-// This command requires support for the THREAD extension.
+// This command requires support for the THREAD extension with the requested
+// algorithm. If the server doesn't advertise it, the command fails with a
+// *CapabilityError.
 func (c *Client) Thread(options *ThreadOptions) *ThreadCommand {
 	return c.thread(imapwire.NumKindSeq, options)
 }
@@ -38,12 +53,23 @@ func (c *Client) UIDThread(options *ThreadOptions) *ThreadCommand {
 
 func (c *Client) handleThread() error {
 	cmd := findPendingCmdByType[*ThreadCommand](c)
-	for c.dec.SP() {
-		data, err := readThreadList(c.dec)
+	if !c.dec.SP() {
+		return nil
+	}
+	// Thread lists aren't separated by spaces. Some servers send a trailing
+	// space when there are no results.
+	for c.dec.Special('(') {
+		data, err := internal.ReadThreadList(c.dec)
 		if err != nil {
 			return fmt.Errorf("in thread-list: %v", err)
 		}
 		if cmd != nil {
+			if cmd.uid {
+				data.Walk(func(node *imap.ThreadData, depth int) bool {
+					node.UID = true
+					return true
+				})
+			}
 			cmd.data = append(cmd.data, *data)
 		}
 	}
@@ -53,33 +79,66 @@ func (c *Client) handleThread() error {
 // ThreadCommand is a THREAD command.
 type ThreadCommand struct {
 	commandBase
-	data []ThreadData
+	uid  bool
+	data []imap.ThreadData
 }
 
-func (cmd *ThreadCommand) Wait() ([]ThreadData, error) {
+func (cmd *ThreadCommand) Wait() ([]imap.ThreadData, error) {
 	err := cmd.wait()
 	return cmd.data, err
 }
 
+// WaitContext is like Wait, but closes the connection if ctx is done before
+// the command has completed. See Client.WatchContext.
+func (cmd *ThreadCommand) WaitContext(ctx context.Context) ([]imap.ThreadData, error) {
+	defer cmd.watchContext(ctx)()
+	return cmd.Wait()
+}
+
+// ThreadData is the flat representation of a thread returned by
+// ThreadCommand.Wait in previous versions: a chain of messages, followed by
+// sub-threads if the last message of the chain has several children.
+//
+// ThreadCommand.Wait now returns imap.ThreadData trees instead, which isn't
+// compatible with this type. NewThreadData can be used to convert a tree.
+//
+// Deprecated: use imap.ThreadData instead.
 type ThreadData struct {
 	Chain      []uint32
 	SubThreads []ThreadData
 }
 
-func readThreadList(dec *imapwire.Decoder) (*ThreadData, error) {
+// NewThreadData converts a thread tree to the flat representation.
+//
+// Deprecated: use imap.ThreadData instead.
+func NewThreadData(tree *imap.ThreadData) ThreadData {
+	type item struct {
+		node *imap.ThreadData
+		out  *ThreadData
+	}
 	var data ThreadData
-	err := dec.ExpectList(func() error {
-		var num uint32
-		if len(data.SubThreads) == 0 && dec.Number(&num) {
-			data.Chain = append(data.Chain, num)
-		} else {
-			sub, err := readThreadList(dec)
-			if err != nil {
-				return err
+	stack := []item{{tree, &data}}
+	for len(stack) > 0 {
+		it := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		node := it.node
+		for {
+			if node.Num != 0 {
+				it.out.Chain = append(it.out.Chain, node.Num)
+			}
+			if len(node.Children) != 1 {
+				break
 			}
-			data.SubThreads = append(data.SubThreads, *sub)
+			node = &node.Children[0]
 		}
-		return nil
-	})
-	return &data, err
+
+		if len(node.Children) > 0 {
+			it.out.SubThreads = make([]ThreadData, len(node.Children))
+			for i := range node.Children {
+				stack = append(stack, item{&node.Children[i], &it.out.SubThreads[i]})
+			}
+		}
+	}
+	return data
 }
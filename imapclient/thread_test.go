@@ -0,0 +1,203 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+// Examples from RFC 5256
+var threadTests = []struct {
+	name     string
+	response string
+	want     []imap.ThreadData
+}{
+	{
+		name:     "references",
+		response: "(2)(3 6 (4 23)(44 7 96))",
+		want: []imap.ThreadData{
+			{Num: 2},
+			{Num: 3, Children: []imap.ThreadData{
+				{Num: 6, Children: []imap.ThreadData{
+					{Num: 4, Children: []imap.ThreadData{{Num: 23}}},
+					{Num: 44, Children: []imap.ThreadData{
+						{Num: 7, Children: []imap.ThreadData{{Num: 96}}},
+					}},
+				}},
+			}},
+		},
+	},
+	{
+		name:     "missing_root",
+		response: "((3)(5))",
+		want: []imap.ThreadData{
+			{Children: []imap.ThreadData{{Num: 3}, {Num: 5}}},
+		},
+	},
+	{
+		name:     "orderedsubject",
+		response: "(166)(167)(168)(169)(172)(170)(171)(173)(174 (175)(176)(178)(181)(180))(179)(177 (183)(182)(188)(184)(185)(186)(187)(189))(190)(191)(192)(193)(194 195)(196 (197)(198))(199)(200 202)(201)(203)(204)(205)(206 207)(208)",
+		want: []imap.ThreadData{
+			{Num: 166}, {Num: 167}, {Num: 168}, {Num: 169}, {Num: 172},
+			{Num: 170}, {Num: 171}, {Num: 173},
+			{Num: 174, Children: []imap.ThreadData{
+				{Num: 175}, {Num: 176}, {Num: 178}, {Num: 181}, {Num: 180},
+			}},
+			{Num: 179},
+			{Num: 177, Children: []imap.ThreadData{
+				{Num: 183}, {Num: 182}, {Num: 188}, {Num: 184}, {Num: 185},
+				{Num: 186}, {Num: 187}, {Num: 189},
+			}},
+			{Num: 190}, {Num: 191}, {Num: 192}, {Num: 193},
+			{Num: 194, Children: []imap.ThreadData{{Num: 195}}},
+			{Num: 196, Children: []imap.ThreadData{{Num: 197}, {Num: 198}}},
+			{Num: 199},
+			{Num: 200, Children: []imap.ThreadData{{Num: 202}}},
+			{Num: 201}, {Num: 203}, {Num: 204}, {Num: 205},
+			{Num: 206, Children: []imap.ThreadData{{Num: 207}}},
+			{Num: 208},
+		},
+	},
+	{
+		name:     "empty",
+		response: "",
+		want:     nil,
+	},
+	{
+		name:     "empty_trailing_space",
+		response: " ",
+		want:     nil,
+	},
+}
+
+func TestClient_Thread(t *testing.T) {
+	commands := make(chan string, len(threadTests))
+	greeting := "* OK [CAPABILITY IMAP4rev1 THREAD=ORDEREDSUBJECT THREAD=REFERENCES] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		for _, tc := range threadTests {
+			tag, args := readScriptTaggedCommand(t, br, w)
+			commands <- args
+			resp := "* THREAD"
+			if tc.response != "" {
+				resp += " " + strings.TrimSpace(tc.response)
+			}
+			io.WriteString(w, resp+"\r\n"+tag+" OK THREAD completed\r\n")
+		}
+	})
+
+	for _, tc := range threadTests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := client.UIDThread(&imapclient.ThreadOptions{
+				Algorithm:      imap.ThreadReferences,
+				SearchCriteria: &imap.SearchCriteria{},
+			}).Wait()
+			if err != nil {
+				t.Fatalf("UIDThread().Wait() = %v", err)
+			}
+			if cmd, want := <-commands, "UID THREAD REFERENCES UTF-8 ALL"; cmd != want {
+				t.Errorf("sent %q, want %q", cmd, want)
+			}
+			for i := range got {
+				got[i].Walk(func(node *imap.ThreadData, depth int) bool {
+					if !node.UID {
+						t.Errorf("ThreadData.UID = false for UID THREAD")
+					}
+					node.UID = false
+					return true
+				})
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("UIDThread().Wait() = %#v, want %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestClient_Thread_deep(t *testing.T) {
+	const depth = 100000
+
+	greeting := "* OK [CAPABILITY IMAP4rev1 THREAD=REFERENCES] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, _ := readScriptTaggedCommand(t, br, w)
+		// A long chain of messages, each one a reply to the previous one
+		var sb strings.Builder
+		sb.WriteString("* THREAD (1")
+		for i := 2; i <= depth; i++ {
+			sb.WriteString(" " + strconv.Itoa(i))
+		}
+		sb.WriteString(")\r\n")
+		io.WriteString(w, sb.String()+tag+" OK THREAD completed\r\n")
+
+		// Too many nested lists
+		tag, _ = readScriptTaggedCommand(t, br, w)
+		io.WriteString(w, "* THREAD "+strings.Repeat("((1)", 2000)+strings.Repeat(")", 2000)+"\r\n"+tag+" OK THREAD completed\r\n")
+	})
+
+	options := &imapclient.ThreadOptions{
+		Algorithm:      imap.ThreadReferences,
+		SearchCriteria: &imap.SearchCriteria{},
+	}
+	threads, err := client.Thread(options).Wait()
+	if err != nil {
+		t.Fatalf("Thread().Wait() = %v", err)
+	} else if len(threads) != 1 {
+		t.Fatalf("Thread().Wait() returned %v threads, want 1", len(threads))
+	}
+
+	if n := threads[0].Count(); n != depth {
+		t.Errorf("Count() = %v, want %v", n, depth)
+	}
+
+	var n, maxDepth int
+	threads[0].Walk(func(node *imap.ThreadData, depth int) bool {
+		if node.UID {
+			t.Errorf("ThreadData.UID = true for THREAD")
+		}
+		n++
+		if node.Num != uint32(n) {
+			t.Errorf("node %v has number %v", n, node.Num)
+		}
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+		return true
+	})
+	if n != depth || maxDepth != depth-1 {
+		t.Errorf("walked %v nodes with max depth %v, want %v and %v", n, maxDepth, depth, depth-1)
+	}
+
+	if _, err := client.Thread(options).Wait(); err == nil {
+		t.Errorf("Thread().Wait() succeeded with too many nested lists")
+	}
+}
+
+func TestNewThreadData(t *testing.T) {
+	want := []imapclient.ThreadData{
+		{Chain: []uint32{2}},
+		{Chain: []uint32{3, 6}, SubThreads: []imapclient.ThreadData{
+			{Chain: []uint32{4, 23}},
+			{Chain: []uint32{44, 7, 96}},
+		}},
+	}
+	var got []imapclient.ThreadData
+	for i := range threadTests[0].want {
+		got = append(got, imapclient.NewThreadData(&threadTests[0].want[i]))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NewThreadData() = %#v, want %#v", got, want)
+	}
+
+	want = []imapclient.ThreadData{
+		{SubThreads: []imapclient.ThreadData{{Chain: []uint32{3}}, {Chain: []uint32{5}}}},
+	}
+	got = []imapclient.ThreadData{imapclient.NewThreadData(&threadTests[1].want[0])}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NewThreadData() = %#v, want %#v", got, want)
+	}
+}
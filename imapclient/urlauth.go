@@ -0,0 +1,193 @@
+package imapclient
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// GenURLAuth sends a GENURLAUTH command.
+//
+// The URL must be a rump URLAUTH URL, see imap.URL.Rump. The mechanism is
+// typically "INTERNAL".
+//
+// This command requires support for the URLAUTH extension.
+func (c *Client) GenURLAuth(url string, mechanism string) *GenURLAuthCommand {
+	if err := c.checkCap(imap.CapURLAuth); err != nil {
+		return &GenURLAuthCommand{commandBase: failedCommandBase(err)}
+	}
+
+	cmd := &GenURLAuthCommand{}
+	enc := c.beginCommand("GENURLAUTH", cmd)
+	enc.SP().String(url).SP().Atom(mechanism)
+	enc.end()
+	return cmd
+}
+
+func (c *Client) handleGenURLAuth() error {
+	cmd := findPendingCmdByType[*GenURLAuthCommand](c)
+	for c.dec.SP() {
+		var url string
+		if !c.dec.ExpectAString(&url) {
+			return c.dec.Err()
+		}
+		if cmd != nil && cmd.url == "" {
+			cmd.url = url
+		}
+	}
+	return nil
+}
+
+// GenURLAuthCommand is a GENURLAUTH command.
+type GenURLAuthCommand struct {
+	commandBase
+	url string
+}
+
+// Wait blocks until the command has completed, and returns the authorized
+// URL.
+func (cmd *GenURLAuthCommand) Wait() (string, error) {
+	if err := cmd.wait(); err != nil {
+		return "", err
+	}
+	if cmd.url == "" {
+		return "", fmt.Errorf("imapclient: server didn't return an authorized URL")
+	}
+	return cmd.url, nil
+}
+
+// URLFetch sends a URLFETCH command.
+//
+// This command requires support for the URLAUTH extension.
+func (c *Client) URLFetch(urls ...string) *URLFetchCommand {
+	return c.urlFetch(urls, nil)
+}
+
+// URLFetchTo fetches the data referenced by a URL and writes it to w.
+//
+// The data is streamed from the connection to w, without being buffered in
+// memory. w must not call Client methods. The number of bytes written is
+// returned.
+func (c *Client) URLFetchTo(url string, w io.Writer) (int64, error) {
+	cmd := c.urlFetch([]string{url}, w)
+	if _, err := cmd.Wait(); err != nil {
+		return cmd.n, err
+	} else if cmd.writeErr != nil {
+		return cmd.n, cmd.writeErr
+	} else if !cmd.found {
+		return 0, fmt.Errorf("imapclient: server refused to fetch URL %q", url)
+	}
+	return cmd.n, nil
+}
+
+func (c *Client) urlFetch(urls []string, w io.Writer) *URLFetchCommand {
+	if err := c.checkCap(imap.CapURLAuth); err != nil {
+		return &URLFetchCommand{commandBase: failedCommandBase(err)}
+	}
+
+	cmd := &URLFetchCommand{
+		urls: urls,
+		data: make([][]byte, len(urls)),
+		w:    w,
+	}
+	enc := c.beginCommand("URLFETCH", cmd)
+	for _, url := range urls {
+		enc.SP().String(url)
+	}
+	enc.end()
+	return cmd
+}
+
+func (c *Client) handleURLFetch() error {
+	cmd := findPendingCmdByType[*URLFetchCommand](c)
+	for c.dec.SP() {
+		var url string
+		if !c.dec.ExpectAString(&url) || !c.dec.ExpectSP() {
+			return c.dec.Err()
+		}
+
+		lit, _, ok := c.dec.ExpectNStringReader()
+		if !ok {
+			return c.dec.Err()
+		} else if lit == nil {
+			continue // the server refused to fetch the URL
+		}
+
+		i := -1
+		if cmd != nil {
+			i = cmd.urlIndex(url)
+		}
+
+		c.setReadTimeout(literalReadTimeout)
+		var err error
+		switch {
+		case i < 0:
+			_, err = io.Copy(io.Discard, lit)
+		case cmd.w != nil:
+			cmd.found = true
+			err = cmd.writeTo(lit)
+		default:
+			var b []byte
+			b, err = io.ReadAll(lit)
+			cmd.data[i] = b
+		}
+		c.setReadTimeout(respReadTimeout)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// URLFetchCommand is a URLFETCH command.
+type URLFetchCommand struct {
+	commandBase
+	urls []string
+	data [][]byte
+
+	// For URLFetchTo
+	w        io.Writer
+	n        int64
+	found    bool
+	writeErr error
+}
+
+func (cmd *URLFetchCommand) urlIndex(url string) int {
+	for i, u := range cmd.urls {
+		if u == url {
+			return i
+		}
+	}
+	return -1
+}
+
+// writeTo copies the literal to the writer. Write errors are stored in the
+// command, they don't break the connection.
+func (cmd *URLFetchCommand) writeTo(lit io.Reader) error {
+	var buf [4096]byte
+	for {
+		n, err := lit.Read(buf[:])
+		if n > 0 && cmd.writeErr == nil {
+			var written int
+			written, cmd.writeErr = cmd.w.Write(buf[:n])
+			cmd.n += int64(written)
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// Wait blocks until the command has completed.
+//
+// The data of each URL is returned in the same order as the URLs passed to
+// Client.URLFetch. The data is nil for URLs the server refused to fetch.
+func (cmd *URLFetchCommand) Wait() ([][]byte, error) {
+	if err := cmd.wait(); err != nil {
+		return nil, err
+	}
+	return cmd.data, nil
+}
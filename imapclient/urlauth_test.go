@@ -0,0 +1,92 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+func TestClient_URLAuth(t *testing.T) {
+	const (
+		token = "91354a473744909de610943775f92038"
+		body  = "Hello world"
+	)
+
+	rump := &imap.URL{
+		User: "fred",
+		Host: "example.org",
+		MessageURL: imap.MessageURL{
+			Mailbox:     "INBOX",
+			UIDValidity: 385759045,
+			UID:         20,
+			Section:     "1",
+		},
+		Access: "submit+fred",
+	}
+	const wantRump = "imap://fred@example.org/INBOX;UIDVALIDITY=385759045/;UID=20/;SECTION=1;URLAUTH=submit+fred"
+	if s := rump.String(); s != wantRump {
+		t.Fatalf("URL.String() = %q, want %q", s, wantRump)
+	}
+
+	commands := make(chan string, 3)
+	greeting := "* OK [CAPABILITY IMAP4rev1 URLAUTH] Server ready"
+	client := newScriptedClient(t, greeting, func(br *bufio.Reader, w io.Writer) {
+		tag, args := readScriptTaggedCommand(t, br, w)
+		commands <- args
+		io.WriteString(w, `* GENURLAUTH "`+wantRump+`:INTERNAL:`+token+`"`+"\r\n")
+		io.WriteString(w, tag+" OK GENURLAUTH completed\r\n")
+
+		for i := 0; i < 2; i++ {
+			tag, args = readScriptTaggedCommand(t, br, w)
+			commands <- args
+			io.WriteString(w, `* URLFETCH "`+wantRump+`:INTERNAL:`+token+`" {11}`+"\r\n"+body)
+			if i == 0 {
+				io.WriteString(w, ` "imap://example.org/Private/;UID=1" NIL`)
+			}
+			io.WriteString(w, "\r\n"+tag+" OK URLFETCH completed\r\n")
+		}
+	})
+
+	authURL, err := client.GenURLAuth(rump.String(), "INTERNAL").Wait()
+	if err != nil {
+		t.Fatalf("GenURLAuth().Wait() = %v", err)
+	}
+	if cmd := <-commands; cmd != `GENURLAUTH "`+wantRump+`" INTERNAL` {
+		t.Errorf("command = %q", cmd)
+	}
+
+	u, err := imap.ParseURL(authURL)
+	if err != nil {
+		t.Fatalf("ParseURL() = %v", err)
+	}
+	if u.Mechanism != "INTERNAL" || u.Token != token || u.Access != "submit+fred" || u.User != "fred" || u.Section != "1" || u.UID != 20 {
+		t.Errorf("ParseURL() = %+v", u)
+	}
+	if s := u.String(); s != authURL {
+		t.Errorf("URL.String() = %q, want %q", s, authURL)
+	}
+	if s := u.Rump().String(); s != wantRump {
+		t.Errorf("URL.Rump().String() = %q, want %q", s, wantRump)
+	}
+
+	const privateURL = "imap://example.org/Private/;UID=1"
+	data, err := client.URLFetch(authURL, privateURL).Wait()
+	if err != nil {
+		t.Fatalf("URLFetch().Wait() = %v", err)
+	}
+	<-commands
+	if len(data) != 2 || string(data[0]) != body || data[1] != nil {
+		t.Errorf("URLFetch().Wait() = %q, want [%q nil]", data, body)
+	}
+
+	var sb strings.Builder
+	n, err := client.URLFetchTo(authURL, &sb)
+	if err != nil {
+		t.Fatalf("URLFetchTo() = %v", err)
+	} else if n != int64(len(body)) || sb.String() != body {
+		t.Errorf("URLFetchTo() = %v, %q, want %v, %q", n, sb.String(), len(body), body)
+	}
+}
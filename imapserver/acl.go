@@ -0,0 +1,134 @@
+package imapserver
+
+import (
+	"sort"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+func (c *Conn) handleSetACL(dec *imapwire.Decoder) error {
+	var mailbox, ri, rights string
+	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) || !dec.ExpectSP() || !dec.ExpectAString(&ri) || !dec.ExpectSP() || !dec.ExpectAString(&rights) || !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	session, err := c.aclSession()
+	if err != nil {
+		return err
+	}
+
+	rm, rs := imap.ParseRights(rights)
+	if err := rs.Validate(); err != nil {
+		return &imap.Error{
+			Type: imap.StatusResponseTypeBad,
+			Text: err.Error(),
+		}
+	}
+	return session.SetACL(mailbox, imap.RightsIdentifier(ri), rm, rs)
+}
+
+func (c *Conn) handleDeleteACL(dec *imapwire.Decoder) error {
+	var mailbox, ri string
+	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) || !dec.ExpectSP() || !dec.ExpectAString(&ri) || !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	session, err := c.aclSession()
+	if err != nil {
+		return err
+	}
+
+	return session.DeleteACL(mailbox, imap.RightsIdentifier(ri))
+}
+
+func (c *Conn) handleGetACL(dec *imapwire.Decoder) error {
+	var mailbox string
+	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) || !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	session, err := c.aclSession()
+	if err != nil {
+		return err
+	}
+
+	acl, err := session.GetACL(mailbox)
+	if err != nil {
+		return err
+	}
+
+	identifiers := make([]string, 0, len(acl))
+	for ri := range acl {
+		identifiers = append(identifiers, string(ri))
+	}
+	sort.Strings(identifiers)
+
+	enc := newResponseEncoder(c)
+	defer enc.end()
+	enc.Atom("*").SP().Atom("ACL").SP().Mailbox(mailbox)
+	for _, ri := range identifiers {
+		rs := acl[imap.RightsIdentifier(ri)]
+		enc.SP().String(ri).SP().String(string(rs))
+	}
+	return enc.CRLF()
+}
+
+func (c *Conn) handleListRights(dec *imapwire.Decoder) error {
+	var mailbox, ri string
+	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) || !dec.ExpectSP() || !dec.ExpectAString(&ri) || !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	session, err := c.aclSession()
+	if err != nil {
+		return err
+	}
+
+	required, optional, err := session.ListRights(mailbox, imap.RightsIdentifier(ri))
+	if err != nil {
+		return err
+	}
+
+	enc := newResponseEncoder(c)
+	defer enc.end()
+	enc.Atom("*").SP().Atom("LISTRIGHTS").SP().Mailbox(mailbox).SP().String(ri)
+	enc.SP().String(string(required))
+	for _, rs := range optional {
+		enc.SP().String(string(rs))
+	}
+	return enc.CRLF()
+}
+
+func (c *Conn) handleMyRights(dec *imapwire.Decoder) error {
+	var mailbox string
+	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) || !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	session, err := c.aclSession()
+	if err != nil {
+		return err
+	}
+
+	rights, err := session.MyRights(mailbox)
+	if err != nil {
+		return err
+	}
+
+	enc := newResponseEncoder(c)
+	defer enc.end()
+	enc.Atom("*").SP().Atom("MYRIGHTS").SP().Mailbox(mailbox).SP().String(string(rights))
+	return enc.CRLF()
+}
+
+func (c *Conn) aclSession() (SessionACL, error) {
+	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
+		return nil, err
+	}
+	session, ok := c.session.(SessionACL)
+	if !ok {
+		return nil, newClientBugError("ACL is not supported")
+	}
+	return session, nil
+}
@@ -16,93 +16,220 @@ import (
 const appendLimit = 100 * 1024 * 1024 // 100MiB
 
 func (c *Conn) handleAppend(tag string, dec *imapwire.Decoder) error {
+	var mailbox string
+	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) || !dec.ExpectSP() {
+		return dec.Err()
+	}
+
+	c.setReadTimeout(literalReadTimeout)
+	defer c.setReadTimeout(cmdReadTimeout)
+
+	msg, err := c.readAppendMessage(dec)
+	if err != nil {
+		return err
+	}
+	r := &MultiAppendReader{conn: c, dec: dec, first: msg}
+
+	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
+		r.discard()
+		dec.CRLF()
+		return err
+	}
+
 	var (
-		mailbox string
-		options imap.AppendOptions
+		data      *imap.AppendData
+		appendErr error
 	)
-	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) || !dec.ExpectSP() {
+	if session, ok := c.session.(SessionMultiAppend); ok {
+		data, appendErr = session.MultiAppend(mailbox, r)
+		if err := r.discard(); err != nil {
+			return err
+		}
+	} else {
+		r.first = nil
+		r.cur = msg
+		if msg.err != nil {
+			appendErr = msg.err
+		} else {
+			data, appendErr = c.session.Append(mailbox, msg.r, &msg.options)
+		}
+		if err := r.finish(); err != nil {
+			return err
+		}
+	}
+	if !dec.ExpectCRLF() {
 		return dec.Err()
 	}
+	if r.nul {
+		return errNULInLiteral
+	}
+	if appendErr != nil {
+		return appendErr
+	}
+	if err := c.poll("APPEND"); err != nil {
+		return err
+	}
+	return c.writeAppendOK(tag, data)
+}
+
+// appendMessage is a message sent with the APPEND command.
+type appendMessage struct {
+	options    imap.AppendOptions
+	lit        imap.LiteralReader
+	r          imap.LiteralReader // lit, normalized if necessary
+	normReader *normalizeReader
+	err        error // set if the message must be rejected
+}
+
+// readAppendMessage reads the flags, date-time and literal of a message. The
+// literal data is left unread.
+func (c *Conn) readAppendMessage(dec *imapwire.Decoder) (*appendMessage, error) {
+	msg := &appendMessage{}
 
 	hasFlagList, err := dec.List(func() error {
-		flag, err := internal.ExpectFlag(dec)
+		flag, err := expectMessageFlag(dec)
 		if err != nil {
 			return err
 		}
-		options.Flags = append(options.Flags, flag)
+		msg.options.Flags = append(msg.options.Flags, flag)
 		return nil
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if hasFlagList && !dec.ExpectSP() {
-		return dec.Err()
+		return nil, dec.Err()
 	}
 
-	t, err := internal.DecodeDateTime(dec)
+	t, err := internal.DecodeDateTime(dec, false)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if !t.IsZero() && !dec.ExpectSP() {
-		return dec.Err()
+		return nil, dec.Err()
 	}
-	options.Time = t
+	msg.options.Time = t
 
 	var dataExt string
-	if !dec.Special('~') && dec.Atom(&dataExt) { // ignore literal8 prefix if any for BINARY
+	if dec.Special('~') { // literal8 prefix for BINARY
+		msg.options.Binary = true
+	} else if dec.Atom(&dataExt) {
 		switch strings.ToUpper(dataExt) {
 		case "UTF8":
+			msg.options.UTF8 = true
 			// '~' is the literal8 prefix
 			if !dec.ExpectSP() || !dec.ExpectSpecial('(') || !dec.ExpectSpecial('~') {
-				return dec.Err()
+				return nil, dec.Err()
 			}
 		default:
-			return newClientBugError("Unknown APPEND data extension")
+			return nil, newClientBugError("Unknown APPEND data extension")
 		}
 	}
 
 	lit, nonSync, err := dec.ExpectLiteralReader()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if lit.Size() > appendLimit {
-		return &imap.Error{
+		return nil, &imap.Error{
 			Type: imap.StatusResponseTypeNo,
 			Code: imap.ResponseCodeTooBig,
 			Text: fmt.Sprintf("Literals are limited to %v bytes for this command", appendLimit),
 		}
 	}
 	if err := c.acceptLiteral(lit.Size(), nonSync); err != nil {
-		return err
+		return nil, err
 	}
 
-	c.setReadTimeout(literalReadTimeout)
-	defer c.setReadTimeout(cmdReadTimeout)
+	msg.lit = lit
+	msg.r = lit
+	if msg.options.Binary && !c.server.options.caps().Has(imap.CapBinary) {
+		msg.err = newClientBugError("Literal8 requires BINARY")
+	} else if !msg.options.Binary && !msg.options.UTF8 && !c.server.options.DisableAppendNormalization {
+		msg.normReader = newNormalizeReader(lit)
+		msg.r = msg.normReader
+	}
+	return msg, nil
+}
 
-	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
-		io.Copy(io.Discard, lit)
-		dec.CRLF()
-		return err
+// MultiAppendReader reads the messages of an APPEND command.
+type MultiAppendReader struct {
+	conn  *Conn
+	dec   *imapwire.Decoder
+	first *appendMessage // not yet returned by Next
+	cur   *appendMessage // last message returned by Next
+	nul   bool           // a message contained a NUL byte
+}
+
+// Next returns the next message. io.EOF is returned after the last message.
+//
+// The data of the previous message is discarded if it hasn't been read
+// entirely. Sessions must not store any message before Next has returned
+// io.EOF, since some errors are only detected once a message has been read
+// entirely.
+func (r *MultiAppendReader) Next() (imap.LiteralReader, *imap.AppendOptions, error) {
+	msg, err := r.next()
+	if r.nul {
+		return nil, nil, errNULInLiteral
+	} else if err != nil {
+		return nil, nil, err
+	} else if msg.err != nil {
+		return nil, nil, msg.err
 	}
+	return msg.r, &msg.options, nil
+}
 
-	data, appendErr := c.session.Append(mailbox, lit, &options)
-	if _, discardErr := io.Copy(io.Discard, lit); discardErr != nil {
-		return err
+func (r *MultiAppendReader) next() (*appendMessage, error) {
+	if r.first != nil {
+		r.cur, r.first = r.first, nil
+		return r.cur, nil
 	}
-	if dataExt != "" && !dec.ExpectSpecial(')') {
-		return dec.Err()
+	if r.cur == nil {
+		return nil, io.EOF
 	}
-	if !dec.ExpectCRLF() {
-		return err
+	if err := r.finish(); err != nil {
+		return nil, err
 	}
-	if appendErr != nil {
-		return appendErr
+	if !r.dec.SP() {
+		return nil, io.EOF
 	}
-	if err := c.poll("APPEND"); err != nil {
+	msg, err := r.conn.readAppendMessage(r.dec)
+	if err != nil {
+		return nil, err
+	}
+	r.cur = msg
+	return msg, nil
+}
+
+// finish discards the rest of the current message.
+func (r *MultiAppendReader) finish() error {
+	msg := r.cur
+	r.cur = nil
+	if msg == nil {
+		return nil
+	}
+	if _, err := io.Copy(io.Discard, msg.lit); err != nil {
 		return err
 	}
-	return c.writeAppendOK(tag, data)
+	if msg.options.UTF8 && !r.dec.ExpectSpecial(')') {
+		return r.dec.Err()
+	}
+	if msg.normReader != nil && msg.normReader.err == errNULInLiteral {
+		r.nul = true
+	}
+	return nil
+}
+
+// discard discards all remaining messages.
+func (r *MultiAppendReader) discard() error {
+	for {
+		if _, err := r.next(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
 }
 
 func (c *Conn) writeAppendOK(tag string, data *imap.AppendData) error {
@@ -111,10 +238,77 @@ func (c *Conn) writeAppendOK(tag string, data *imap.AppendData) error {
 
 	enc.Atom(tag).SP().Atom("OK").SP()
 	if data != nil {
-		enc.Special('[')
-		enc.Atom("APPENDUID").SP().Number(data.UIDValidity).SP().UID(data.UID)
-		enc.Special(']').SP()
+		uids := data.UIDs
+		if len(uids) == 0 {
+			uids = imap.UIDSetNum(data.UID)
+		}
+		writeRespCode(enc.Encoder, imap.AppendUIDCode{UIDValidity: data.UIDValidity, UIDs: uids})
 	}
 	enc.Text("APPEND completed")
 	return enc.CRLF()
 }
+
+var errNULInLiteral = &imap.Error{
+	Type: imap.StatusResponseTypeBad,
+	Code: imap.ResponseCodeClientBug,
+	Text: "NUL bytes are only allowed in literal8",
+}
+
+// normalizeReader converts bare CR and LF characters to CRLF, and rejects NUL
+// bytes.
+//
+// Size returns the size of the literal as announced on the wire, which may be
+// smaller than the number of normalized bytes.
+type normalizeReader struct {
+	lit     imap.LiteralReader
+	buf     [4096]byte
+	out     []byte
+	pending []byte
+	cr      bool // last byte read was a CR
+	err     error
+}
+
+func newNormalizeReader(lit imap.LiteralReader) *normalizeReader {
+	return &normalizeReader{lit: lit}
+}
+
+func (r *normalizeReader) Size() int64 {
+	return r.lit.Size()
+}
+
+func (r *normalizeReader) Read(b []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		n, err := r.lit.Read(r.buf[:])
+		r.out = r.out[:0]
+		for _, ch := range r.buf[:n] {
+			switch ch {
+			case '\r':
+				r.out = append(r.out, '\r', '\n')
+				r.cr = true
+				continue
+			case '\n':
+				if !r.cr {
+					r.out = append(r.out, '\r', '\n')
+				}
+			case 0:
+				err = errNULInLiteral
+			default:
+				r.out = append(r.out, ch)
+			}
+			r.cr = false
+			if err == errNULInLiteral {
+				break
+			}
+		}
+		r.pending = r.out
+		r.err = err
+	}
+
+	n := copy(b, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
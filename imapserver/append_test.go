@@ -0,0 +1,54 @@
+package imapserver_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+func TestAppend_deduplicate(t *testing.T) {
+	user := newTestUser()
+	user.SetDeduplicate(true)
+	user.Create("Archive", nil)
+
+	conn := newUserTestConn(t, user)
+	defer conn.Close()
+
+	for _, mailbox := range []string{"INBOX", "Archive"} {
+		conn.expectOK("A", fmt.Sprintf("A APPEND %v {%v+}\r\n%v\r\n", mailbox, len(testRawMessage), testRawMessage))
+	}
+
+	stats := user.StorageStats()
+	// The message added by newTestUser was appended before deduplication
+	// was enabled
+	want := imapmemserver.StorageStats{
+		LogicalBytes: 3 * int64(len(testRawMessage)),
+		UniqueBytes:  2 * int64(len(testRawMessage)),
+	}
+	if stats != want {
+		t.Errorf("StorageStats() = %+v, want %+v", stats, want)
+	}
+
+	conn.expectOK("S", "S SELECT INBOX\r\n")
+	conn.expectOK("T", "T STORE 2 +FLAGS.SILENT (\\Flagged)\r\n")
+	conn.expectOK("S", "S SELECT Archive\r\n")
+	untagged, _ := conn.execLines("F", "F FETCH 1 FLAGS\r\n")
+	if len(untagged) != 1 || !strings.Contains(untagged[0], "FLAGS ()") {
+		t.Errorf("FETCH FLAGS in Archive = %q, want no flags", untagged)
+	}
+
+	conn.expectOK("S", "S SELECT INBOX\r\n")
+	conn.expectOK("T", "T STORE 2 +FLAGS.SILENT (\\Deleted)\r\n")
+	conn.expectOK("E", "E EXPUNGE\r\n")
+
+	stats = user.StorageStats()
+	want = imapmemserver.StorageStats{
+		LogicalBytes: 2 * int64(len(testRawMessage)),
+		UniqueBytes:  2 * int64(len(testRawMessage)),
+	}
+	if stats != want {
+		t.Errorf("StorageStats() after EXPUNGE = %+v, want %+v", stats, want)
+	}
+}
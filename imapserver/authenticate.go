@@ -46,7 +46,10 @@ func (c *Conn) handleAuthenticate(tag string, dec *imapwire.Decoder) error {
 		}
 	}
 
-	var saslServer sasl.Server
+	var (
+		saslServer sasl.Server
+		username   string
+	)
 	if authSess, ok := c.session.(SessionSASL); ok {
 		var err error
 		saslServer, err = authSess.Authenticate(mech)
@@ -60,7 +63,8 @@ func (c *Conn) handleAuthenticate(tag string, dec *imapwire.Decoder) error {
 				Text: "SASL mechanism not supported",
 			}
 		}
-		saslServer = sasl.NewPlainServer(func(identity, username, password string) error {
+		saslServer = sasl.NewPlainServer(func(identity, user, password string) error {
+			username = user
 			if identity != "" && identity != username {
 				return &imap.Error{
 					Type: imap.StatusResponseTypeNo,
@@ -73,15 +77,26 @@ func (c *Conn) handleAuthenticate(tag string, dec *imapwire.Decoder) error {
 	}
 
 	enc := newResponseEncoder(c)
+	if err := c.exchangeSASL(enc, saslServer, initialResp); err != nil {
+		enc.end()
+		return c.authFailed(tag, username, err)
+	}
 	defer enc.end()
 
+	c.authSucceeded(username)
+	c.state = imap.ConnStateAuthenticated
+	text := fmt.Sprintf("%v authentication successful", mech)
+	return writeCapabilityOK(enc.Encoder, tag, c.availableCaps(), text)
+}
+
+func (c *Conn) exchangeSASL(enc *responseEncoder, saslServer sasl.Server, initialResp []byte) error {
 	resp := initialResp
 	for {
 		challenge, done, err := saslServer.Next(resp)
 		if err != nil {
 			return err
 		} else if done {
-			break
+			return nil
 		}
 
 		var challengeStr string
@@ -109,10 +124,6 @@ func (c *Conn) handleAuthenticate(tag string, dec *imapwire.Decoder) error {
 			return err
 		}
 	}
-
-	c.state = imap.ConnStateAuthenticated
-	text := fmt.Sprintf("%v authentication successful", mech)
-	return writeCapabilityOK(enc.Encoder, tag, c.availableCaps(), text)
 }
 
 func decodeSASL(s string) ([]byte, error) {
@@ -64,6 +64,7 @@ func (c *Conn) availableCaps() []imap.Cap {
 				imap.CapEnable,
 				imap.CapIdle,
 				imap.CapUTF8Accept,
+				imap.CapMove,
 			}...)
 			addAvailableCaps(&caps, available, []imap.Cap{
 				imap.CapNamespace,
@@ -72,14 +73,22 @@ func (c *Conn) availableCaps() []imap.Cap {
 				imap.CapSearchRes,
 				imap.CapListExtended,
 				imap.CapListStatus,
-				imap.CapMove,
 				imap.CapStatusSize,
 				imap.CapBinary,
 			})
 		}
+		if c.canCompress() {
+			caps = append(caps, imap.CapCompressDeflate)
+		}
 		addAvailableCaps(&caps, available, []imap.Cap{
+			imap.CapACL,
+			imap.CapCondStore,
 			imap.CapCreateSpecialUse,
 			imap.CapLiteralPlus,
+			imap.CapMultiAppend,
+			imap.CapNotify,
+			imap.CapQResync,
+			imap.CapSpecialUse,
 			imap.CapUnauthenticate,
 		})
 	}
@@ -0,0 +1,108 @@
+package imapserver
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+func (c *Conn) canCompress() bool {
+	return c.server.options.caps().Has(imap.CapCompressDeflate) && !c.compressed
+}
+
+func (c *Conn) handleCompress(tag string, dec *imapwire.Decoder) error {
+	var mechanism string
+	if !dec.ExpectSP() || !dec.ExpectAtom(&mechanism) || !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
+		return err
+	}
+	if !c.server.options.caps().Has(imap.CapCompressDeflate) {
+		return &imap.Error{
+			Type: imap.StatusResponseTypeNo,
+			Text: "COMPRESS not supported",
+		}
+	}
+	if !strings.EqualFold(mechanism, "DEFLATE") {
+		return &imap.Error{
+			Type: imap.StatusResponseTypeBad,
+			Text: "Unsupported compression mechanism",
+		}
+	}
+	if c.compressed {
+		return &imap.Error{
+			Type: imap.StatusResponseTypeNo,
+			Code: imap.ResponseCodeCompressionActive,
+			Text: "Compression is already active",
+		}
+	}
+
+	// Do not allow to write uncompressed data past this point: keep
+	// c.encMutex locked until the end
+	enc := newResponseEncoder(c)
+	defer enc.end()
+
+	err := writeStatusResp(enc.Encoder, tag, &imap.StatusResponse{
+		Type: imap.StatusResponseTypeOK,
+		Text: "DEFLATE active",
+	})
+	if err == nil {
+		err = enc.Flush()
+	}
+	if err != nil {
+		return err
+	}
+
+	// Data buffered after the command is already compressed
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, c.br, int64(c.br.Buffered())); err != nil {
+		panic(err) // unreachable
+	}
+
+	c.mutex.Lock()
+	conn := c.conn
+	c.mutex.Unlock()
+
+	var r io.Reader = conn
+	if buf.Len() > 0 {
+		r = io.MultiReader(&buf, conn)
+	}
+
+	fw, err := flate.NewWriter(conn, flate.DefaultCompression)
+	if err != nil {
+		panic(err) // unreachable
+	}
+
+	rw := c.server.options.wrapReadWriter(struct {
+		io.Reader
+		io.Writer
+	}{
+		Reader: flate.NewReader(r),
+		Writer: &flushWriter{fw},
+	})
+	c.br.Reset(rw)
+	c.bw.Reset(rw)
+	c.compressed = true
+
+	return nil
+}
+
+// flushWriter flushes the compressed stream after each write, so that
+// responses are sent as soon as the bufio.Writer is flushed.
+type flushWriter struct {
+	w *flate.Writer
+}
+
+func (fw *flushWriter) Write(b []byte) (int, error) {
+	n, err := fw.w.Write(b)
+	if err != nil {
+		return n, err
+	}
+	return n, fw.w.Flush()
+}
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
@@ -25,6 +26,8 @@ const (
 	literalWriteTimeout = 5 * time.Minute
 
 	maxCommandSize = 50 * 1024 // RFC 2683 section 3.2.1.5 says 8KiB minimum
+
+	defaultBufferSize = 4096
 )
 
 var internalServerErrorResp = &imap.StatusResponse{
@@ -40,18 +43,25 @@ type Conn struct {
 	bw       *bufio.Writer
 	encMutex sync.Mutex
 
+	lastWrite  time.Time // protected by encMutex
+	coalescing bool      // protected by encMutex
+
 	mutex   sync.Mutex
 	conn    net.Conn
 	enabled imap.CapSet
 
-	state   imap.ConnState
-	session Session
+	state        imap.ConnState
+	readOnly     bool // whether the selected mailbox is read-only
+	compressed   bool // whether COMPRESS=DEFLATE is active
+	authFailures int  // number of failed authentication attempts
+	session      Session
 }
 
 func newConn(c net.Conn, server *Server) *Conn {
 	rw := server.options.wrapReadWriter(c)
-	br := bufio.NewReader(rw)
-	bw := bufio.NewWriter(rw)
+	readSize, writeSize := server.options.bufferSizes()
+	br := bufio.NewReaderSize(rw, readSize)
+	bw := bufio.NewWriterSize(rw, writeSize)
 	return &Conn{
 		conn:    c,
 		server:  server,
@@ -74,10 +84,16 @@ func (c *Conn) NetConn() net.Conn {
 
 // Bye terminates the IMAP connection.
 func (c *Conn) Bye(text string) error {
-	respErr := c.writeStatusResp("", &imap.StatusResponse{
+	enc := newResponseEncoder(c)
+	respErr := writeStatusResp(enc.Encoder, "", &imap.StatusResponse{
 		Type: imap.StatusResponseTypeBye,
 		Text: text,
 	})
+	if respErr == nil {
+		// Responses may have been buffered by a command in progress
+		respErr = enc.Flush()
+	}
+	enc.end()
 	closeErr := c.conn.Close()
 	if respErr != nil {
 		return respErr
@@ -85,6 +101,23 @@ func (c *Conn) Bye(text string) error {
 	return closeErr
 }
 
+// WriteStatusResponse writes an untagged status response.
+//
+// It can be called at any time, for instance to send an alert to the client.
+func (c *Conn) WriteStatusResponse(resp *imap.StatusResponse) error {
+	return c.writeStatusResp("", resp)
+}
+
+// Alert sends an untagged OK response with the ALERT response code. The text
+// must be presented to the user.
+func (c *Conn) Alert(text string) error {
+	return c.WriteStatusResponse(&imap.StatusResponse{
+		Type: imap.StatusResponseTypeOK,
+		Code: imap.ResponseCodeAlert,
+		Text: text,
+	})
+}
+
 func (c *Conn) serve() {
 	defer func() {
 		if v := recover(); v != nil {
@@ -140,8 +173,17 @@ func (c *Conn) serve() {
 	if _, ok := c.session.(SessionNamespace); !ok && caps.Has(imap.CapNamespace) {
 		panic("imapserver: server advertises NAMESPACE but session doesn't support it")
 	}
-	if _, ok := c.session.(SessionMove); !ok && caps.Has(imap.CapMove) {
-		panic("imapserver: server advertises MOVE but session doesn't support it")
+	if _, ok := c.session.(SessionACL); !ok && caps.Has(imap.CapACL) {
+		panic("imapserver: server advertises ACL but session doesn't support it")
+	}
+	if _, ok := c.session.(SessionMultiAppend); !ok && caps.Has(imap.CapMultiAppend) {
+		panic("imapserver: server advertises MULTIAPPEND but session doesn't support it")
+	}
+	if _, ok := c.session.(SessionNotify); !ok && caps.Has(imap.CapNotify) {
+		panic("imapserver: server advertises NOTIFY but session doesn't support it")
+	}
+	if _, ok := c.session.(SessionQResync); !ok && caps.Has(imap.CapQResync) {
+		panic("imapserver: server advertises QRESYNC but session doesn't support it")
 	}
 	if _, ok := c.session.(SessionUnauthenticate); !ok && caps.Has(imap.CapUnauthenticate) {
 		panic("imapserver: server advertises UNAUTHENTICATE but session doesn't support it")
@@ -168,8 +210,13 @@ func (c *Conn) serve() {
 		}
 		c.setReadTimeout(readTimeout)
 
+		c.mutex.Lock()
+		mailboxUTF8 := c.enabled.Has(imap.CapIMAP4rev2) || c.enabled.Has(imap.CapUTF8Accept)
+		c.mutex.Unlock()
+
 		dec := imapwire.NewDecoder(c.br, imapwire.ConnSideServer)
 		dec.MaxSize = maxCommandSize
+		dec.MailboxUTF8 = mailboxUTF8
 		dec.CheckBufferedLiteralFunc = c.checkBufferedLiteral
 
 		if c.state == imap.ConnStateLogout || dec.EOF() {
@@ -177,7 +224,12 @@ func (c *Conn) serve() {
 		}
 
 		c.setReadTimeout(cmdReadTimeout)
-		if err := c.readCommand(dec); err != nil {
+		c.setCoalescing(true)
+		err := c.readCommand(dec)
+		if flushErr := c.setCoalescing(false); err == nil {
+			err = flushErr
+		}
+		if err != nil {
 			if !errors.Is(err, net.ErrClosed) {
 				c.server.logger().Printf("failed to read command: %v", err)
 			}
@@ -189,7 +241,7 @@ func (c *Conn) serve() {
 func (c *Conn) readCommand(dec *imapwire.Decoder) error {
 	var tag, name string
 	if !dec.ExpectAtom(&tag) || !dec.ExpectSP() || !dec.ExpectAtom(&name) {
-		return fmt.Errorf("in command: %w", dec.Err())
+		return c.handleCommandSyntaxError(tag, dec)
 	}
 	name = strings.ToUpper(name)
 
@@ -198,7 +250,7 @@ func (c *Conn) readCommand(dec *imapwire.Decoder) error {
 		numKind = NumKindUID
 		var subName string
 		if !dec.ExpectSP() || !dec.ExpectAtom(&subName) {
-			return fmt.Errorf("in command: %w", dec.Err())
+			return c.handleCommandSyntaxError(tag, dec)
 		}
 		name = "UID " + strings.ToUpper(subName)
 	}
@@ -216,6 +268,9 @@ func (c *Conn) readCommand(dec *imapwire.Decoder) error {
 	case "STARTTLS":
 		err = c.handleStartTLS(tag, dec)
 		sendOK = false
+	case "COMPRESS":
+		err = c.handleCompress(tag, dec)
+		sendOK = false
 	case "AUTHENTICATE":
 		err = c.handleAuthenticate(tag, dec)
 		sendOK = false
@@ -246,6 +301,18 @@ func (c *Conn) readCommand(dec *imapwire.Decoder) error {
 		err = c.handleNamespace(dec)
 	case "IDLE":
 		err = c.handleIdle(dec)
+	case "SETACL":
+		err = c.handleSetACL(dec)
+	case "DELETEACL":
+		err = c.handleDeleteACL(dec)
+	case "GETACL":
+		err = c.handleGetACL(dec)
+	case "LISTRIGHTS":
+		err = c.handleListRights(dec)
+	case "MYRIGHTS":
+		err = c.handleMyRights(dec)
+	case "NOTIFY":
+		err = c.handleNotify(dec)
 	case "SELECT", "EXAMINE":
 		err = c.handleSelect(tag, dec, name == "EXAMINE")
 		sendOK = false
@@ -283,7 +350,9 @@ func (c *Conn) readCommand(dec *imapwire.Decoder) error {
 		}
 	}
 
-	dec.DiscardLine()
+	// If the rest of the command can't be skipped, the connection is closed
+	// after the response has been sent
+	discardErr := dec.DiscardLine()
 
 	var (
 		resp    *imap.StatusResponse
@@ -303,7 +372,7 @@ func (c *Conn) readCommand(dec *imapwire.Decoder) error {
 		resp = internalServerErrorResp
 	} else {
 		if !sendOK {
-			return nil
+			return discardErr
 		}
 		if err := c.poll(name); err != nil {
 			return err
@@ -313,7 +382,31 @@ func (c *Conn) readCommand(dec *imapwire.Decoder) error {
 			Text: fmt.Sprintf("%v completed", name),
 		}
 	}
-	return c.writeStatusResp(tag, resp)
+	if err := c.writeStatusResp(tag, resp); err != nil {
+		return err
+	}
+	return discardErr
+}
+
+// handleCommandSyntaxError handles a command whose tag or name couldn't be
+// decoded: the rest of the line is discarded and a BAD response is sent.
+func (c *Conn) handleCommandSyntaxError(tag string, dec *imapwire.Decoder) error {
+	err := dec.Err()
+	var decErr *imapwire.DecoderExpectError
+	if !errors.As(err, &decErr) {
+		return fmt.Errorf("in command: %w", err)
+	}
+
+	discardErr := dec.DiscardLine()
+	err = c.writeStatusResp(tag, &imap.StatusResponse{
+		Type: imap.StatusResponseTypeBad,
+		Code: imap.ResponseCodeClientBug,
+		Text: "Syntax error: " + decErr.Message,
+	})
+	if err != nil {
+		return err
+	}
+	return discardErr
 }
 
 func (c *Conn) handleNoop(dec *imapwire.Decoder) error {
@@ -421,6 +514,22 @@ func (c *Conn) writeStatusResp(tag string, statusResp *imap.StatusResponse) erro
 	return writeStatusResp(enc.Encoder, tag, statusResp)
 }
 
+// setCoalescing enables or disables write coalescing. While enabled, responses
+// are buffered instead of being flushed line by line. Disabling coalescing
+// flushes buffered responses.
+//
+// Coalescing is enabled while a command is being handled, except while
+// waiting for client data (see writeContReq) and while idling.
+func (c *Conn) setCoalescing(coalescing bool) error {
+	c.encMutex.Lock()
+	defer c.encMutex.Unlock()
+	c.coalescing = coalescing
+	if coalescing {
+		return nil
+	}
+	return c.bw.Flush()
+}
+
 func (c *Conn) writeContReq(text string) error {
 	enc := newResponseEncoder(c)
 	defer enc.end()
@@ -491,6 +600,7 @@ func newResponseEncoder(conn *Conn) *responseEncoder {
 	wireEnc.QuotedUTF8 = quotedUTF8
 
 	conn.encMutex.Lock() // released by responseEncoder.end
+	wireEnc.NoFlush = conn.coalescing
 	conn.setWriteTimeout(respWriteTimeout)
 	return &responseEncoder{
 		Encoder: wireEnc,
@@ -504,6 +614,7 @@ func (enc *responseEncoder) end() {
 	}
 	enc.Encoder = nil
 	enc.conn.setWriteTimeout(0)
+	enc.conn.lastWrite = time.Now()
 	enc.conn.encMutex.Unlock()
 }
 
@@ -515,11 +626,25 @@ func (enc *responseEncoder) Literal(size int64) io.WriteCloser {
 	}
 }
 
+func (enc *responseEncoder) Literal8(size int64) io.WriteCloser {
+	enc.conn.setWriteTimeout(literalWriteTimeout)
+	return literalWriter{
+		WriteCloser: enc.Encoder.Literal8(size, nil),
+		conn:        enc.conn,
+	}
+}
+
 type literalWriter struct {
 	io.WriteCloser
 	conn *Conn
 }
 
+// ReadFrom lets io.Copy use the io.ReaderFrom implementation of the
+// underlying literal writer.
+func (lw literalWriter) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(lw.WriteCloser, r)
+}
+
 func (lw literalWriter) Close() error {
 	lw.conn.setWriteTimeout(respWriteTimeout)
 	return lw.WriteCloser.Close()
@@ -530,8 +655,10 @@ func writeStatusResp(enc *imapwire.Encoder, tag string, statusResp *imap.StatusR
 		tag = "*"
 	}
 	enc.Atom(tag).SP().Atom(string(statusResp.Type)).SP()
-	if statusResp.Code != "" {
-		enc.Atom(fmt.Sprintf("[%v]", statusResp.Code)).SP()
+	// Invalid response code arguments are a bug in the session: send the
+	// status response without its code rather than a malformed one
+	if data, err := statusResp.CodeData(); err == nil && data != nil {
+		writeRespCode(enc, data)
 	}
 	enc.Text(statusResp.Text)
 	return enc.CRLF()
@@ -546,16 +673,27 @@ func writeCapabilityStatus(enc *imapwire.Encoder, tag string, typ imap.StatusRes
 		tag = "*"
 	}
 
-	enc.Atom(tag).SP().Atom(string(typ)).SP().Special('[').Atom("CAPABILITY")
-	for _, c := range caps {
-		enc.SP().Atom(string(c))
-	}
-	enc.Special(']').SP().Text(text)
+	enc.Atom(tag).SP().Atom(string(typ)).SP()
+	writeRespCode(enc, imap.CapabilityCode{Caps: caps})
+	enc.Text(text)
 	return enc.CRLF()
 }
 
+// writeRespCode writes a response code followed by a space. If the response
+// code is invalid, nothing is written.
+func writeRespCode(enc *imapwire.Encoder, data imap.ResponseCodeData) {
+	if err := internal.WriteRespCode(enc, data); err == nil {
+		enc.SP()
+	}
+}
+
+// writeContReq writes a continuation request. Buffered responses are flushed,
+// since the client needs to receive the request before sending more data.
 func writeContReq(enc *imapwire.Encoder, text string) error {
-	return enc.Atom("+").SP().Text(text).CRLF()
+	if err := enc.Atom("+").SP().Text(text).CRLF(); err != nil {
+		return err
+	}
+	return enc.Flush()
 }
 
 func newClientBugError(text string) error {
@@ -580,6 +718,18 @@ func (w *UpdateWriter) WriteExpunge(seqNum uint32) error {
 	return w.conn.writeExpunge(seqNum)
 }
 
+// writeExpungeUID writes a VANISHED response if the client has enabled
+// QRESYNC and the UID is known, and an EXPUNGE response otherwise.
+func (w *UpdateWriter) writeExpungeUID(seqNum uint32, uid imap.UID) error {
+	if uid == 0 || !w.conn.enabled.Has(imap.CapQResync) {
+		return w.WriteExpunge(seqNum)
+	}
+	if !w.allowExpunge {
+		return fmt.Errorf("imapserver: EXPUNGE updates are not allowed in this context")
+	}
+	return w.conn.writeVanished(imap.UIDSetNum(uid), false)
+}
+
 // WriteNumMessages writes an EXISTS response.
 func (w *UpdateWriter) WriteNumMessages(n uint32) error {
 	return w.conn.writeExists(n)
@@ -0,0 +1,413 @@
+package imapserver_test
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+const (
+	testUsername = "test-user"
+	testPassword = "test-password"
+)
+
+const testRawMessage = "Subject: Test\r\n\r\nHello!\r\n"
+
+// panicLogger records panics reported by the server.
+type panicLogger struct {
+	mutex  sync.Mutex
+	panics []string
+}
+
+func (l *panicLogger) Printf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if strings.HasPrefix(msg, "panic") {
+		l.mutex.Lock()
+		l.panics = append(l.panics, msg)
+		l.mutex.Unlock()
+	}
+}
+
+func (l *panicLogger) check(t testing.TB) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for _, msg := range l.panics {
+		t.Errorf("server panicked: %v", msg)
+	}
+}
+
+type testConn struct {
+	t      testing.TB
+	conn   net.Conn
+	br     *bufio.Reader
+	server *imapserver.Server
+	logger *panicLogger
+}
+
+// newTestConn starts a server backed by imapmemserver and returns a raw
+// connection in the selected state.
+func newTestConn(t testing.TB) *testConn {
+	memServer := imapmemserver.New()
+	memServer.AddUser(newTestUser())
+
+	tc := newTestConnWithOptions(t, &imapserver.Options{
+		NewSession: func(conn *imapserver.Conn) (imapserver.Session, *imapserver.GreetingData, error) {
+			return memServer.NewSession(), nil, nil
+		},
+		InsecureAuth: true,
+		Caps: imap.CapSet{
+			imap.CapIMAP4rev1: {},
+			imap.CapIMAP4rev2: {},
+		},
+	})
+	tc.expectOK("L", fmt.Sprintf("L LOGIN %v %v\r\n", testUsername, testPassword))
+	tc.expectOK("S", "S SELECT INBOX\r\n")
+	return tc
+}
+
+func newTestUser() *imapmemserver.User {
+	user := imapmemserver.NewUser(testUsername, testPassword)
+	user.Create("INBOX", nil)
+	user.Append("INBOX", strings.NewReader(testRawMessage), &imap.AppendOptions{})
+	return user
+}
+
+// newTestConnWithOptions starts a server and returns a raw connection, after
+// the greeting has been received.
+func newTestConnWithOptions(t testing.TB, options *imapserver.Options) *testConn {
+	logger := &panicLogger{}
+	options.Logger = logger
+	server := imapserver.New(options)
+
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("net.Listen() = %v", err)
+	}
+	go server.Serve(ln)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		server.Close()
+		t.Fatalf("net.Dial() = %v", err)
+	}
+
+	tc := &testConn{
+		t:      t,
+		conn:   conn,
+		br:     bufio.NewReader(conn),
+		server: server,
+		logger: logger,
+	}
+	tc.readLine() // greeting
+	return tc
+}
+
+func (tc *testConn) Close() {
+	tc.conn.Close()
+	tc.server.Close()
+	tc.logger.check(tc.t)
+}
+
+func (tc *testConn) readLine() string {
+	tc.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := tc.br.ReadString('\n')
+	if err != nil {
+		tc.t.Fatalf("failed to read line: %v", err)
+	}
+	return strings.TrimSuffix(line, "\r\n")
+}
+
+// exec writes raw command data and returns the tagged response line.
+func (tc *testConn) exec(tag, data string) string {
+	_, tagged := tc.execLines(tag, data)
+	return tagged
+}
+
+// execLines writes raw command data and returns the untagged response lines
+// as well as the tagged response line.
+func (tc *testConn) execLines(tag, data string) (untagged []string, tagged string) {
+	if _, err := tc.conn.Write([]byte(data)); err != nil {
+		tc.t.Fatalf("failed to write command: %v", err)
+	}
+	for {
+		line := tc.readLine()
+		if strings.HasPrefix(line, tag+" ") {
+			return untagged, line
+		}
+		untagged = append(untagged, line)
+	}
+}
+
+func (tc *testConn) expectOK(tag, data string) {
+	if line := tc.exec(tag, data); !strings.HasPrefix(line, tag+" OK") {
+		tc.t.Fatalf("unexpected response: %q", line)
+	}
+}
+
+func (tc *testConn) expectNoopOK() {
+	tc.expectOK("N", "N NOOP\r\n")
+}
+
+var malformedCommandTests = []struct {
+	name string
+	tag  string
+	data string
+}{
+	{
+		name: "unterminated quoted string",
+		tag:  "T",
+		data: "T SELECT \"INBOX\r\n",
+	},
+	{
+		name: "literal inside list",
+		tag:  "T",
+		data: "T FETCH 1 (BODY[] {5+}\r\nhello)\r\n",
+	},
+	{
+		name: "unbalanced parentheses",
+		tag:  "T",
+		data: "T FETCH 1 (FLAGS (UID)\r\n",
+	},
+	{
+		name: "unknown command with literal",
+		tag:  "T",
+		data: "T FOO {3+}\r\nabc BAR\r\n",
+	},
+	{
+		name: "too large buffered literal",
+		tag:  "T",
+		data: "T SELECT {5000+}\r\n" + strings.Repeat("a", 5000) + "\r\n",
+	},
+	{
+		name: "long command line",
+		tag:  "T",
+		data: "T SELECT " + strings.Repeat("a", 200*1024) + "\r\n",
+	},
+	{
+		name: "number overflow",
+		tag:  "T",
+		data: "T FETCH 4294967296 FLAGS\r\n",
+	},
+	{
+		name: "invalid UID subcommand",
+		tag:  "T",
+		data: "T UID (\r\n",
+	},
+}
+
+func TestConn_malformedCommand(t *testing.T) {
+	for _, tc := range malformedCommandTests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			conn := newTestConn(t)
+			defer conn.Close()
+
+			if line := conn.exec(tc.tag, tc.data); !strings.HasPrefix(line, tc.tag+" BAD") && !strings.HasPrefix(line, tc.tag+" NO") {
+				t.Errorf("unexpected response: %q", line)
+			}
+			conn.expectNoopOK()
+		})
+	}
+}
+
+func TestConn_invalidTag(t *testing.T) {
+	conn := newTestConn(t)
+	defer conn.Close()
+
+	if line := conn.exec("*", "(\r\n"); !strings.HasPrefix(line, "* BAD") {
+		t.Errorf("unexpected response: %q", line)
+	}
+	conn.expectNoopOK()
+}
+
+func TestConn_malformedCommandNotAuthenticated(t *testing.T) {
+	tests := []struct {
+		tag  string
+		data string
+	}{
+		{"*", "(\r\n"},
+		{"T", "T (\r\n"},
+		{"T", "T UID (\r\n"},
+		{"T", "T LOGIN \"unterminated\r\n"},
+		{"T", "T LOGIN {3+}\r\nabc (\r\n"},
+	}
+	for _, tc := range tests {
+		conn := newTestConnWithOptions(t, &imapserver.Options{
+			NewSession: func(conn *imapserver.Conn) (imapserver.Session, *imapserver.GreetingData, error) {
+				memServer := imapmemserver.New()
+				memServer.AddUser(newTestUser())
+				return memServer.NewSession(), nil, nil
+			},
+			InsecureAuth: true,
+			Caps:         imap.CapSet{imap.CapIMAP4rev1: {}},
+		})
+
+		if line := conn.exec(tc.tag, tc.data); !strings.HasPrefix(line, tc.tag+" BAD") {
+			t.Errorf("%q: unexpected response: %q", tc.data, line)
+		}
+		conn.expectOK("L", fmt.Sprintf("L LOGIN %v %v\r\n", testUsername, testPassword))
+		conn.Close()
+	}
+}
+
+func FuzzConn(f *testing.F) {
+	for _, tc := range malformedCommandTests {
+		cmd := strings.TrimPrefix(strings.SplitN(tc.data, "\r\n", 2)[0], tc.tag+" ")
+		if len(cmd) < 1024 {
+			f.Add(cmd)
+		}
+	}
+	f.Add("FETCH 1:* (FLAGS BODY.PEEK[HEADER.FIELDS (Subject)]<0.10>)")
+	f.Add("UID SEARCH OR (SUBJECT \"x\") NOT DELETED")
+	f.Add("STORE 1 +FLAGS.SILENT (\\Seen)")
+	f.Add("STATUS INBOX (MESSAGES UIDNEXT)")
+
+	f.Fuzz(func(t *testing.T, cmd string) {
+		// Skip commands which require additional client interaction, or which
+		// end the session
+		if strings.ContainsAny(cmd, "\r\n{") {
+			return
+		}
+		name := strings.ToUpper(strings.SplitN(cmd, " ", 2)[0])
+		switch name {
+		case "IDLE", "LOGOUT", "AUTHENTICATE", "STARTTLS", "UNAUTHENTICATE":
+			return
+		}
+
+		conn := newTestConn(t)
+		defer conn.Close()
+
+		conn.exec("F", "F "+cmd+"\r\n")
+		conn.expectNoopOK()
+	})
+}
+
+// errorSession returns a fixed error for CREATE.
+type errorSession struct {
+	*imapmemserver.UserSession
+	err error
+}
+
+func (sess *errorSession) Create(name string, options *imap.CreateOptions) error {
+	return sess.err
+}
+
+func TestConn_respCodeArgs(t *testing.T) {
+	tests := []struct {
+		err  *imapserver.Error
+		want string
+	}{
+		{
+			err: &imapserver.Error{
+				Type:     imap.StatusResponseTypeNo,
+				Code:     imap.ResponseCodeBadCharset,
+				CodeArgs: []interface{}{[]string{"UTF-8", "ISO-8859-1", "x]y"}},
+				Text:     "Unsupported charset",
+			},
+			want: `T NO [BADCHARSET (UTF-8 ISO-8859-1 "x]y")] Unsupported charset`,
+		},
+		{
+			err: &imapserver.Error{
+				Type:     imap.StatusResponseTypeNo,
+				Code:     imap.ResponseCodeCopyUID,
+				CodeArgs: []interface{}{uint32(42), imap.UIDSetNum(1, 3), imap.UIDSetNum(7, 8)},
+				Text:     "Copied",
+			},
+			want: "T NO [COPYUID 42 1,3 7:8] Copied",
+		},
+		{
+			err: &imapserver.Error{
+				Type:     imap.StatusResponseTypeNo,
+				Code:     "X-CUSTOM",
+				CodeArgs: []interface{}{imap.RawResponseCodeArg("foo (bar) 42")},
+				Text:     "Custom",
+			},
+			want: "T NO [X-CUSTOM foo (bar) 42] Custom",
+		},
+		{
+			// Invalid arguments are dropped along with the code
+			err: &imapserver.Error{
+				Type:     imap.StatusResponseTypeNo,
+				Code:     "X-CUSTOM",
+				CodeArgs: []interface{}{imap.RawResponseCodeArg("foo] bar")},
+				Text:     "Custom",
+			},
+			want: "T NO Custom",
+		},
+		{
+			err: &imapserver.Error{
+				Type:     imap.StatusResponseTypeNo,
+				Code:     "X-CUSTOM",
+				CodeArgs: []interface{}{struct{}{}},
+				Text:     "Custom",
+			},
+			want: "T NO Custom",
+		},
+		{
+			err: &imapserver.Error{
+				Type:     imap.StatusResponseTypeOK,
+				Code:     imap.ResponseCodeModified,
+				CodeArgs: []interface{}{imap.ModifiedCodeArg{NumSet: imap.SeqSetNum(7, 9)}},
+				Text:     "Conditional STORE failed",
+			},
+			want: "T OK [MODIFIED 7,9] Conditional STORE failed",
+		},
+		{
+			err: &imapserver.Error{
+				Type:     imap.StatusResponseTypeNo,
+				Code:     imap.ResponseCodeHighestModSeq,
+				CodeArgs: []interface{}{imap.ModSeq(715194045007)},
+				Text:     "Highest",
+			},
+			want: "T NO [HIGHESTMODSEQ 715194045007] Highest",
+		},
+		{
+			err: &imapserver.Error{
+				Type: imap.StatusResponseTypeNo,
+				Code: imap.ResponseCodeOverQuota,
+				Text: "Over quota",
+			},
+			want: "T NO [OVERQUOTA] Over quota",
+		},
+	}
+	for _, tc := range tests {
+		user := newTestUser()
+		conn := newTestConnWithOptions(t, &imapserver.Options{
+			NewSession: func(conn *imapserver.Conn) (imapserver.Session, *imapserver.GreetingData, error) {
+				sess := &errorSession{imapmemserver.NewUserSession(user), fmt.Errorf("wrapped: %w", tc.err)}
+				return sess, &imapserver.GreetingData{PreAuth: true}, nil
+			},
+		})
+		if got := conn.exec("T", "T CREATE foo\r\n"); got != tc.want {
+			t.Errorf("response = %q, want %q", got, tc.want)
+		}
+		conn.Close()
+	}
+}
+
+func TestConn_Alert(t *testing.T) {
+	conns := make(chan *imapserver.Conn, 1)
+	user := newTestUser()
+	conn := newTestConnWithOptions(t, &imapserver.Options{
+		NewSession: func(conn *imapserver.Conn) (imapserver.Session, *imapserver.GreetingData, error) {
+			conns <- conn
+			return imapmemserver.NewUserSession(user), &imapserver.GreetingData{PreAuth: true}, nil
+		},
+	})
+	defer conn.Close()
+
+	if err := (<-conns).Alert("Server going down"); err != nil {
+		t.Fatalf("Alert() = %v", err)
+	}
+	if got, want := conn.readLine(), "* OK [ALERT] Server going down"; got != want {
+		t.Errorf("response = %q, want %q", got, want)
+	}
+}
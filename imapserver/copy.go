@@ -26,10 +26,12 @@ func (c *Conn) handleCopy(tag string, dec *imapwire.Decoder, numKind NumKind) er
 		return err
 	}
 
-	return c.writeCopyOK(tag, data)
+	return c.writeCopyOK(tag, "COPY", data)
 }
 
-func (c *Conn) writeCopyOK(tag string, data *imap.CopyData) error {
+// writeCopyOK writes an OK response with the COPYUID response code for a COPY
+// or MOVE command.
+func (c *Conn) writeCopyOK(tag, cmdName string, data *imap.CopyData) error {
 	enc := newResponseEncoder(c)
 	defer enc.end()
 
@@ -39,11 +41,13 @@ func (c *Conn) writeCopyOK(tag string, data *imap.CopyData) error {
 
 	enc.Atom(tag).SP().Atom("OK").SP()
 	if data != nil {
-		enc.Special('[')
-		enc.Atom("COPYUID").SP().Number(data.UIDValidity).SP().NumSet(data.SourceUIDs).SP().NumSet(data.DestUIDs)
-		enc.Special(']').SP()
+		writeRespCode(enc.Encoder, imap.CopyUIDCode{
+			UIDValidity: data.UIDValidity,
+			SourceUIDs:  data.SourceUIDs,
+			DestUIDs:    data.DestUIDs,
+		})
 	}
-	enc.Text("COPY completed")
+	enc.Text(cmdName + " completed")
 	return enc.CRLF()
 }
 
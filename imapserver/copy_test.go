@@ -0,0 +1,114 @@
+package imapserver_test
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+func newUserTestConn(t testing.TB, user *imapmemserver.User) *testConn {
+	return newTestConnWithOptions(t, &imapserver.Options{
+		NewSession: func(conn *imapserver.Conn) (imapserver.Session, *imapserver.GreetingData, error) {
+			sess := imapmemserver.NewUserSession(user)
+			return sess, &imapserver.GreetingData{PreAuth: true}, nil
+		},
+		Caps: imap.CapSet{imap.CapIMAP4rev1: {}},
+	})
+}
+
+func heapAlloc() uint64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
+
+func TestCopy_sharedContent(t *testing.T) {
+	const (
+		msgSize      = 5 * 1024 * 1024
+		numMailboxes = 50
+	)
+
+	var buf bytes.Buffer
+	buf.WriteString("Subject: Large\r\n\r\n")
+	for buf.Len() < msgSize {
+		buf.WriteString("The quick brown fox jumps over the lazy dog.\r\n")
+	}
+
+	size := buf.Len()
+
+	user := newTestUser()
+	user.Append("INBOX", imap.NewLiteral(buf.Bytes()), &imap.AppendOptions{})
+	for i := 0; i < numMailboxes; i++ {
+		user.Create(fmt.Sprintf("Copy%v", i), nil)
+	}
+	buf = bytes.Buffer{} // the appended message is a copy
+
+	conn := newUserTestConn(t, user)
+	defer conn.Close()
+	conn.expectOK("S", "S SELECT INBOX\r\n")
+
+	before := heapAlloc()
+	for i := 0; i < numMailboxes; i++ {
+		conn.expectOK("C", fmt.Sprintf("C COPY 2 Copy%v\r\n", i))
+	}
+	after := heapAlloc()
+
+	// Duplicating the message would use 250 MiB
+	if after > before && after-before > 25*1024*1024 {
+		t.Errorf("copying a %v byte message to %v mailboxes grew the heap by %v bytes", msgSize, numMailboxes, after-before)
+	}
+
+	conn.expectOK("S", "S SELECT Copy0\r\n")
+	untagged, _ := conn.execLines("F", "F FETCH 1 RFC822.SIZE\r\n")
+	want := fmt.Sprintf("RFC822.SIZE %v", size)
+	if len(untagged) != 1 || !strings.Contains(untagged[0], want) {
+		t.Errorf("FETCH RFC822.SIZE = %q, want %q", untagged, want)
+	}
+}
+
+func TestCopy_concurrentFetch(t *testing.T) {
+	const numMailboxes = 8
+
+	user := newTestUser()
+	for i := 0; i < numMailboxes; i++ {
+		user.Create(fmt.Sprintf("Copy%v", i), nil)
+	}
+
+	conn := newUserTestConn(t, user)
+	conn.expectOK("S", "S SELECT INBOX\r\n")
+	for i := 0; i < numMailboxes; i++ {
+		conn.expectOK("C", fmt.Sprintf("C COPY 1 Copy%v\r\n", i))
+	}
+	conn.Close()
+
+	const fetch = "F FETCH 1 (ENVELOPE BODYSTRUCTURE BODY.PEEK[TEXT])\r\n"
+
+	t.Run("group", func(t *testing.T) {
+		for i := 0; i < numMailboxes; i++ {
+			name := fmt.Sprintf("Copy%v", i)
+			t.Run(name, func(t *testing.T) {
+				t.Parallel()
+
+				conn := newUserTestConn(t, user)
+				defer conn.Close()
+				conn.expectOK("S", "S SELECT "+name+"\r\n")
+
+				untagged, tagged := conn.execLines("F", fetch)
+				if !strings.HasPrefix(tagged, "F OK") {
+					t.Fatalf("FETCH = %q, want OK", tagged)
+				}
+				got := strings.Join(untagged, "\r\n")
+				if !strings.Contains(got, "ENVELOPE (") || !strings.Contains(got, "BODYSTRUCTURE (") || !strings.Contains(got, "Hello!") {
+					t.Errorf("FETCH returned %q", got)
+				}
+			})
+		}
+	})
+}
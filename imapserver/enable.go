@@ -22,11 +22,16 @@ func (c *Conn) handleEnable(dec *imapwire.Decoder) error {
 		return err
 	}
 
+	available := c.server.options.caps()
 	var enabled []imap.Cap
 	for _, req := range requested {
 		switch req {
 		case imap.CapIMAP4rev2, imap.CapUTF8Accept:
 			enabled = append(enabled, req)
+		case imap.CapCondStore, imap.CapQResync:
+			if available.Has(req) {
+				enabled = append(enabled, req)
+			}
 		}
 	}
 
@@ -44,3 +49,16 @@ func (c *Conn) handleEnable(dec *imapwire.Decoder) error {
 	}
 	return enc.CRLF()
 }
+
+// enableCondStore implicitly enables CONDSTORE, as done by CONDSTORE-enabling
+// commands such as SELECT with the CONDSTORE parameter (RFC 7162 section 3.1).
+func (c *Conn) enableCondStore() error {
+	if !c.server.options.caps().Has(imap.CapCondStore) {
+		return newClientBugError("CONDSTORE is not supported")
+	}
+
+	c.mutex.Lock()
+	c.enabled[imap.CapCondStore] = struct{}{}
+	c.mutex.Unlock()
+	return nil
+}
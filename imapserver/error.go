@@ -0,0 +1,13 @@
+package imapserver
+
+import (
+	"github.com/emersion/go-imap/v2"
+)
+
+// Error is an IMAP error returned by a Session.
+//
+// The status response is sent to the client as-is. Errors returned by a
+// Session are unwrapped with errors.As, so an Error can be wrapped with
+// additional context. Other errors are logged and result in a NO response
+// with the SERVERBUG response code.
+type Error = imap.Error
@@ -24,6 +24,9 @@ func (c *Conn) expunge(uids *imap.UIDSet) error {
 	if err := c.checkState(imap.ConnStateSelected); err != nil {
 		return err
 	}
+	if err := c.checkWritable(); err != nil {
+		return err
+	}
 	w := &ExpungeWriter{conn: c}
 	return c.session.Expunge(w, uids)
 }
@@ -35,6 +38,17 @@ func (c *Conn) writeExpunge(seqNum uint32) error {
 	return enc.CRLF()
 }
 
+func (c *Conn) writeVanished(uids imap.UIDSet, earlier bool) error {
+	enc := newResponseEncoder(c)
+	defer enc.end()
+	enc.Atom("*").SP().Atom("VANISHED").SP()
+	if earlier {
+		enc.Special('(').Atom("EARLIER").Special(')').SP()
+	}
+	enc.NumSet(uids)
+	return enc.CRLF()
+}
+
 // ExpungeWriter writes EXPUNGE updates.
 type ExpungeWriter struct {
 	conn *Conn
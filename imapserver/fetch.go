@@ -9,7 +9,6 @@ import (
 	"time"
 
 	"github.com/emersion/go-imap/v2"
-	"github.com/emersion/go-imap/v2/internal"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
@@ -54,20 +53,12 @@ func (c *Conn) handleFetch(dec *imapwire.Decoder, numKind NumKind) error {
 		// Handle macros
 		switch name {
 		case "ALL":
-			options.Flags = true
-			options.InternalDate = true
-			options.RFC822Size = true
-			options.Envelope = true
+			options = *imap.FetchOptionsAll()
 		case "FAST":
-			options.Flags = true
-			options.InternalDate = true
-			options.RFC822Size = true
+			options = *imap.FetchOptionsFast()
 		case "FULL":
-			options.Flags = true
-			options.InternalDate = true
-			options.RFC822Size = true
-			options.Envelope = true
-			handleFetchBodyStructure(&options, &writerOptions, false)
+			options = *imap.FetchOptionsFull()
+			writerOptions.bodyStructure.nonExtended = true
 		default:
 			if err := handleFetchAtt(dec, name, &options, &writerOptions); err != nil {
 				return err
@@ -75,6 +66,12 @@ func (c *Conn) handleFetch(dec *imapwire.Decoder, numKind NumKind) error {
 		}
 	}
 
+	if dec.SP() {
+		if err := readFetchModifiers(dec, &options); err != nil {
+			return err
+		}
+	}
+
 	if !dec.ExpectCRLF() {
 		return dec.Err()
 	}
@@ -87,6 +84,17 @@ func (c *Conn) handleFetch(dec *imapwire.Decoder, numKind NumKind) error {
 		options.UID = true
 	}
 
+	// Once CONDSTORE is enabled, MODSEQ is included in all FETCH responses.
+	// CHANGEDSINCE implies MODSEQ as well.
+	if options.ModSeq || options.ChangedSince != 0 {
+		if err := c.enableCondStore(); err != nil {
+			return err
+		}
+	}
+	if c.enabled.Has(imap.CapCondStore) {
+		options.ModSeq = true
+	}
+
 	w := &FetchWriter{conn: c, options: writerOptions}
 	if err := c.session.Fetch(w, numSet, &options); err != nil {
 		return err
@@ -108,6 +116,8 @@ func handleFetchAtt(dec *imapwire.Decoder, attName string, options *imap.FetchOp
 		options.RFC822Size = true
 	case "UID":
 		options.UID = true
+	case "MODSEQ":
+		options.ModSeq = true
 	case "RFC822": // equivalent to BODY[]
 		bs := &imap.FetchItemBodySection{}
 		writerOptions.obsolete[bs] = attName
@@ -223,7 +233,12 @@ func readSection(dec *imapwire.Decoder, section *imap.FetchItemBodySection) erro
 		}
 
 		switch specifier := imap.PartSpecifier(strings.ToUpper(specifier)); specifier {
-		case imap.PartSpecifierNone, imap.PartSpecifierHeader, imap.PartSpecifierMIME, imap.PartSpecifierText:
+		case imap.PartSpecifierMIME:
+			if len(section.Part) == 0 {
+				return newClientBugError("MIME body section specifier requires a part number")
+			}
+			section.Specifier = specifier
+		case imap.PartSpecifierNone, imap.PartSpecifierHeader, imap.PartSpecifierText:
 			section.Specifier = specifier
 		case "HEADER.FIELDS", "HEADER.FIELDS.NOT":
 			if !dec.ExpectSP() {
@@ -307,6 +322,24 @@ func readSectionBinary(dec *imapwire.Decoder) ([]int, error) {
 	return l, nil
 }
 
+func readFetchModifiers(dec *imapwire.Decoder, options *imap.FetchOptions) error {
+	return dec.ExpectList(func() error {
+		var name string
+		if !dec.ExpectAtom(&name) {
+			return dec.Err()
+		}
+		switch strings.ToUpper(name) {
+		case "CHANGEDSINCE":
+			if !dec.ExpectSP() || !dec.ExpectModSeq(&options.ChangedSince) {
+				return dec.Err()
+			}
+		default:
+			return newClientBugError("Unknown FETCH modifier")
+		}
+		return nil
+	})
+}
+
 func maybeReadPartial(dec *imapwire.Decoder) (*imap.SectionPartial, error) {
 	if !dec.Special('<') {
 		return nil, nil
@@ -354,6 +387,12 @@ func (w *FetchResponseWriter) WriteUID(uid imap.UID) {
 	w.enc.Atom("UID").SP().UID(uid)
 }
 
+// WriteModSeq writes the message's mod-sequence.
+func (w *FetchResponseWriter) WriteModSeq(modSeq imap.ModSeq) {
+	w.writeItemSep()
+	w.enc.Atom("MODSEQ").SP().Special('(').ModSeq(modSeq).Special(')')
+}
+
 // WriteFlags writes the message's flags.
 func (w *FetchResponseWriter) WriteFlags(flags []imap.Flag) {
 	w.writeItemSep()
@@ -371,7 +410,7 @@ func (w *FetchResponseWriter) WriteRFC822Size(size int64) {
 // WriteInternalDate writes the message's internal date.
 func (w *FetchResponseWriter) WriteInternalDate(t time.Time) {
 	w.writeItemSep()
-	w.enc.Atom("INTERNALDATE").SP().String(t.Format(internal.DateTimeLayout))
+	w.enc.Atom("INTERNALDATE").SP().String(imap.FormatDateTime(t))
 }
 
 // WriteBodySection writes a body section.
@@ -392,6 +431,81 @@ func (w *FetchResponseWriter) WriteBodySection(section *imap.FetchItemBodySectio
 	return w.enc.Literal(size)
 }
 
+// WriteBodySectionLiteral writes a body section whose contents are read from
+// lit.
+func (w *FetchResponseWriter) WriteBodySectionLiteral(section *imap.FetchItemBodySection, lit imap.LiteralReader) error {
+	return copyLiteral(w.WriteBodySection(section, lit.Size()), lit)
+}
+
+// WriteRawMessageSection writes a body section whose contents are read
+// directly from msg, without being copied to memory.
+//
+// Only the whole message, its HEADER and its TEXT are supported, possibly
+// partial. For other sections, false is returned and nothing is written: the
+// caller should fall back to WriteBodySectionLiteral.
+func (w *FetchResponseWriter) WriteRawMessageSection(section *imap.FetchItemBodySection, msg *RawMessage) (bool, error) {
+	if len(section.Part) > 0 || len(section.HeaderFields) > 0 || len(section.HeaderFieldsNot) > 0 {
+		return false, nil
+	}
+
+	start, end := int64(0), msg.Size()
+	switch section.Specifier {
+	case imap.PartSpecifierNone:
+		// Whole message
+	case imap.PartSpecifierHeader, imap.PartSpecifierText:
+		headerSize, err := msg.HeaderSize()
+		if err != nil {
+			return false, nil
+		}
+		if section.Specifier == imap.PartSpecifierHeader {
+			end = headerSize
+		} else {
+			start = headerSize
+		}
+	default:
+		return false, nil
+	}
+
+	if partial := section.Partial; partial != nil {
+		if partial.Offset >= end-start {
+			// An empty string is returned if the offset is past the end
+			start = end
+		} else {
+			start += partial.Offset
+			if partial.Size < end-start {
+				end = start + partial.Size
+			}
+		}
+	}
+
+	size := end - start
+	r, err := msg.reader(start, size)
+	if err != nil {
+		return true, err
+	}
+	wc := w.WriteBodySection(section, size)
+	// r is already limited: wrapping it again would prevent sendfile
+	n, copyErr := io.Copy(wc, r)
+	if copyErr == nil && n < size {
+		copyErr = io.ErrUnexpectedEOF
+	}
+	closeErr := wc.Close()
+	if copyErr != nil {
+		return true, copyErr
+	}
+	return true, closeErr
+}
+
+// copyLiteral copies lit to wc, then closes wc.
+func copyLiteral(wc io.WriteCloser, lit imap.LiteralReader) error {
+	_, copyErr := io.CopyN(wc, lit, lit.Size())
+	closeErr := wc.Close()
+	if copyErr != nil {
+		return copyErr
+	}
+	return closeErr
+}
+
 func writeItemBodySection(enc *imapwire.Encoder, section *imap.FetchItemBodySection) {
 	enc.Atom("BODY")
 	enc.Special('[')
@@ -419,7 +533,7 @@ func writeItemBodySection(enc *imapwire.Encoder, section *imap.FetchItemBodySect
 	}
 	enc.Special(']')
 	if partial := section.Partial; partial != nil {
-		enc.Special('<').Number(uint32(partial.Offset)).Special('>')
+		enc.Special('<').Number64(partial.Offset).Special('>')
 	}
 }
 
@@ -434,8 +548,13 @@ func (w *FetchResponseWriter) WriteBinarySection(section *imap.FetchItemBinarySe
 	enc.Atom("BINARY").Special('[')
 	writeSectionPart(enc, section.Part)
 	enc.Special(']').SP()
-	enc.Special('~') // indicates literal8
-	return w.enc.Literal(size)
+	return w.enc.Literal8(size)
+}
+
+// WriteBinarySectionLiteral writes a binary section whose contents are read
+// from lit.
+func (w *FetchResponseWriter) WriteBinarySectionLiteral(section *imap.FetchItemBinarySection, lit imap.LiteralReader) error {
+	return copyLiteral(w.WriteBinarySection(section, lit.Size()), lit)
 }
 
 // WriteBinarySectionSize writes a binary section size.
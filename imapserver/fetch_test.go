@@ -0,0 +1,344 @@
+package imapserver_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+func TestFetch_macros(t *testing.T) {
+	tests := []struct {
+		macro       string
+		want, avoid []string
+	}{
+		{"FAST", []string{"FLAGS ", "INTERNALDATE ", "RFC822.SIZE "}, []string{"ENVELOPE ", "BODY "}},
+		{"ALL", []string{"FLAGS ", "INTERNALDATE ", "RFC822.SIZE ", "ENVELOPE "}, []string{"BODY "}},
+		{"FULL", []string{"FLAGS ", "INTERNALDATE ", "RFC822.SIZE ", "ENVELOPE ", "BODY "}, []string{"BODYSTRUCTURE "}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.macro, func(t *testing.T) {
+			conn := newTestConn(t)
+			defer conn.Close()
+
+			untagged, tagged := conn.execLines("F", "F FETCH 1 "+tc.macro+"\r\n")
+			if !strings.HasPrefix(tagged, "F OK") {
+				t.Fatalf("FETCH %v = %q, want OK", tc.macro, tagged)
+			}
+			if len(untagged) != 1 {
+				t.Fatalf("FETCH %v returned %q, want a single response", tc.macro, untagged)
+			}
+			for _, item := range tc.want {
+				if !strings.Contains(untagged[0], item) {
+					t.Errorf("FETCH %v response %q is missing %q", tc.macro, untagged[0], item)
+				}
+			}
+			for _, item := range tc.avoid {
+				if strings.Contains(untagged[0], item) {
+					t.Errorf("FETCH %v response %q contains %q", tc.macro, untagged[0], item)
+				}
+			}
+		})
+	}
+}
+
+func TestFetch_mimeSpecifier(t *testing.T) {
+	conn := newTestConn(t)
+	defer conn.Close()
+
+	// MIME requires a part number
+	_, tagged := conn.execLines("F", "F FETCH 1 BODY.PEEK[MIME]\r\n")
+	if !strings.HasPrefix(tagged, "F BAD") {
+		t.Errorf("FETCH BODY[MIME] = %q, want BAD", tagged)
+	}
+
+	untagged, tagged := conn.execLines("F", "F FETCH 1 BODY.PEEK[1.MIME]\r\n")
+	if !strings.HasPrefix(tagged, "F OK") {
+		t.Fatalf("FETCH BODY[1.MIME] = %q, want OK", tagged)
+	}
+	if got := strings.Join(untagged, "\r\n"); !strings.Contains(got, "BODY[1.MIME] {") {
+		t.Errorf("FETCH BODY[1.MIME] returned %q", got)
+	}
+}
+
+func BenchmarkFetch_bodySection(b *testing.B) {
+	const numMessages = 1000
+
+	for _, section := range []string{"BODY.PEEK[]", "BODY.PEEK[TEXT]"} {
+		b.Run(section, func(b *testing.B) {
+			user := newTestUser()
+			for i := 1; i < numMessages; i++ {
+				user.Append("INBOX", strings.NewReader(testRawMessage), &imap.AppendOptions{})
+			}
+
+			memServer := imapmemserver.New()
+			memServer.AddUser(user)
+			conn := newTestConnWithOptions(b, &imapserver.Options{
+				NewSession: func(conn *imapserver.Conn) (imapserver.Session, *imapserver.GreetingData, error) {
+					return memServer.NewSession(), nil, nil
+				},
+				InsecureAuth: true,
+				Caps:         imap.CapSet{imap.CapIMAP4rev1: {}},
+			})
+			defer conn.Close()
+			conn.expectOK("L", fmt.Sprintf("L LOGIN %v %v\r\n", testUsername, testPassword))
+			conn.expectOK("S", "S SELECT INBOX\r\n")
+
+			cmd := "F FETCH 1:* " + section + "\r\n"
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				conn.expectOK("F", cmd)
+			}
+		})
+	}
+}
+
+// rawMessageSession serves the first message from a RawMessage.
+type rawMessageSession struct {
+	imapserver.Session
+	r       io.ReaderAt
+	size    int64
+	extract bool // use ExtractBodySection instead of WriteRawMessageSection
+}
+
+func (sess *rawMessageSession) Fetch(w *imapserver.FetchWriter, numSet imap.NumSet, options *imap.FetchOptions) error {
+	respWriter := w.CreateMessage(1)
+	respWriter.WriteUID(1)
+	if options.RFC822Size {
+		respWriter.WriteRFC822Size(sess.size)
+	}
+	msg := imapserver.NewRawMessage(sess.r, sess.size)
+	for _, bs := range options.BodySection {
+		if !sess.extract {
+			if ok, err := respWriter.WriteRawMessageSection(bs, msg); err != nil {
+				return err
+			} else if ok {
+				continue
+			}
+		}
+		b := imapserver.ExtractBodySection(io.NewSectionReader(sess.r, 0, sess.size), bs)
+		if err := respWriter.WriteBodySectionLiteral(bs, imap.NewLiteral(b)); err != nil {
+			return err
+		}
+	}
+	return respWriter.Close()
+}
+
+func newRawMessageTestConn(t testing.TB, r io.ReaderAt, size int64, extract bool) *testConn {
+	user := newTestUser()
+	tc := newTestConnWithOptions(t, &imapserver.Options{
+		NewSession: func(conn *imapserver.Conn) (imapserver.Session, *imapserver.GreetingData, error) {
+			sess := &rawMessageSession{imapmemserver.NewUserSession(user), r, size, extract}
+			return sess, &imapserver.GreetingData{PreAuth: true}, nil
+		},
+		Caps: imap.CapSet{imap.CapIMAP4rev1: {}},
+	})
+	tc.expectOK("S", "S SELECT INBOX\r\n")
+	return tc
+}
+
+func TestFetchResponseWriter_WriteRawMessageSection(t *testing.T) {
+	const raw = "From: <root@nsa.gov>\r\n" +
+		"Subject: Your Name.\r\n" +
+		"\r\n" +
+		"Hello!\r\n" +
+		"This is a test.\r\n"
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "msg.eml"))
+	if err != nil {
+		t.Fatalf("os.Create() = %v", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(raw); err != nil {
+		t.Fatalf("WriteString() = %v", err)
+	}
+
+	sections := []string{
+		"BODY.PEEK[]",
+		"BODY.PEEK[HEADER]",
+		"BODY.PEEK[TEXT]",
+		"BODY.PEEK[]<5.10>",
+		"BODY.PEEK[HEADER]<40.1000>",
+		"BODY.PEEK[TEXT]<1000.5>",
+		"BODY.PEEK[TEXT]<0.0>",
+		"BODY.PEEK[HEADER.FIELDS (Subject)]",
+		"BODY.PEEK[1]",
+		"RFC822.SIZE",
+	}
+	readers := []struct {
+		name string
+		r    io.ReaderAt
+	}{
+		{"file", f},
+		{"bytes", strings.NewReader(raw)},
+	}
+	for _, rd := range readers {
+		t.Run(rd.name, func(t *testing.T) {
+			want := newRawMessageTestConn(t, rd.r, int64(len(raw)), true)
+			defer want.Close()
+			got := newRawMessageTestConn(t, rd.r, int64(len(raw)), false)
+			defer got.Close()
+
+			for _, section := range sections {
+				cmd := "F FETCH 1 " + section + "\r\n"
+				wantLines, _ := want.execLines("F", cmd)
+				gotLines, tagged := got.execLines("F", cmd)
+				if !strings.HasPrefix(tagged, "F OK") {
+					t.Errorf("FETCH %v = %q, want OK", section, tagged)
+				} else if !reflect.DeepEqual(gotLines, wantLines) {
+					t.Errorf("FETCH %v returned %q, want %q", section, gotLines, wantLines)
+				}
+			}
+		})
+	}
+}
+
+// execDiscard writes raw command data and discards the response, including
+// literals.
+func (tc *testConn) execDiscard(tag, data string) {
+	if _, err := tc.conn.Write([]byte(data)); err != nil {
+		tc.t.Fatalf("failed to write command: %v", err)
+	}
+	for {
+		line := tc.readLine()
+		if strings.HasPrefix(line, tag+" ") {
+			return
+		}
+		if i := strings.LastIndexByte(line, '{'); i >= 0 && strings.HasSuffix(line, "}") {
+			n, err := strconv.ParseInt(line[i+1:len(line)-1], 10, 64)
+			if err != nil {
+				tc.t.Fatalf("invalid literal size in %q", line)
+			}
+			if _, err := io.CopyN(io.Discard, tc.br, n); err != nil {
+				tc.t.Fatalf("failed to read literal: %v", err)
+			}
+		}
+	}
+}
+
+func BenchmarkFetchResponseWriter_WriteRawMessageSection(b *testing.B) {
+	const size = 50 * 1024 * 1024
+
+	f, err := os.Create(filepath.Join(b.TempDir(), "msg.eml"))
+	if err != nil {
+		b.Fatalf("os.Create() = %v", err)
+	}
+	defer f.Close()
+	bw := bufio.NewWriter(f)
+	bw.WriteString("Subject: Large\r\n\r\n")
+	for n := 0; n < size; n += len("The quick brown fox jumps over the lazy dog.\r\n") {
+		bw.WriteString("The quick brown fox jumps over the lazy dog.\r\n")
+	}
+	if err := bw.Flush(); err != nil {
+		b.Fatalf("Flush() = %v", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		b.Fatalf("Stat() = %v", err)
+	}
+
+	for _, extract := range []bool{true, false} {
+		name := "raw"
+		if extract {
+			name = "extract"
+		}
+		b.Run(name, func(b *testing.B) {
+			conn := newRawMessageTestConn(b, f, fi.Size(), extract)
+			defer conn.Close()
+
+			b.SetBytes(fi.Size())
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				conn.execDiscard("F", "F FETCH 1 BODY.PEEK[]\r\n")
+			}
+		})
+	}
+}
+
+// countingListener counts the writes on the connections it accepts.
+type countingListener struct {
+	net.Listener
+	writes int64 // atomic
+}
+
+func (ln *countingListener) Accept() (net.Conn, error) {
+	conn, err := ln.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{conn, ln}, nil
+}
+
+type countingConn struct {
+	net.Conn
+	ln *countingListener
+}
+
+func (conn *countingConn) Write(b []byte) (int, error) {
+	atomic.AddInt64(&conn.ln.writes, 1)
+	return conn.Conn.Write(b)
+}
+
+func BenchmarkFetch_writes(b *testing.B) {
+	const numMessages = 10000
+
+	user := newTestUser()
+	for i := 1; i < numMessages; i++ {
+		user.Append("INBOX", strings.NewReader(testRawMessage), &imap.AppendOptions{})
+	}
+
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		b.Fatalf("net.Listen() = %v", err)
+	}
+	countingLn := &countingListener{Listener: ln}
+
+	logger := &panicLogger{}
+	server := imapserver.New(&imapserver.Options{
+		NewSession: func(conn *imapserver.Conn) (imapserver.Session, *imapserver.GreetingData, error) {
+			sess := imapmemserver.NewUserSession(user)
+			return sess, &imapserver.GreetingData{PreAuth: true}, nil
+		},
+		Caps:   imap.CapSet{imap.CapIMAP4rev1: {}},
+		Logger: logger,
+	})
+	go server.Serve(countingLn)
+
+	netConn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		server.Close()
+		b.Fatalf("net.Dial() = %v", err)
+	}
+	conn := &testConn{
+		t:      b,
+		conn:   netConn,
+		br:     bufio.NewReader(netConn),
+		server: server,
+		logger: logger,
+	}
+	defer conn.Close()
+	conn.readLine() // greeting
+	conn.expectOK("S", "S SELECT INBOX\r\n")
+
+	atomic.StoreInt64(&countingLn.writes, 0)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		conn.execDiscard("F", "F FETCH 1:* (UID FLAGS BODY.PEEK[])\r\n")
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(atomic.LoadInt64(&countingLn.writes))/float64(b.N), "writes/op")
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"runtime/debug"
+	"time"
 
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
@@ -18,6 +19,10 @@ func (c *Conn) handleIdle(dec *imapwire.Decoder) error {
 		return err
 	}
 
+	// Updates need to be sent as soon as possible while idling
+	if err := c.setCoalescing(false); err != nil {
+		return err
+	}
 	if err := c.writeContReq("idling"); err != nil {
 		return err
 	}
@@ -35,9 +40,20 @@ func (c *Conn) handleIdle(dec *imapwire.Decoder) error {
 		done <- c.session.Idle(w, stop)
 	}()
 
+	keepAliveDone := make(chan struct{})
+	if interval := c.server.options.IdleKeepAliveInterval; interval > 0 {
+		go func() {
+			defer close(keepAliveDone)
+			c.idleKeepAlive(interval, stop)
+		}()
+	} else {
+		close(keepAliveDone)
+	}
+
 	c.setReadTimeout(idleReadTimeout)
 	line, isPrefix, err := c.br.ReadLine()
 	close(stop)
+	<-keepAliveDone
 	if err == io.EOF {
 		return nil
 	} else if err != nil {
@@ -48,3 +64,35 @@ func (c *Conn) handleIdle(dec *imapwire.Decoder) error {
 
 	return <-done
 }
+
+// idleKeepAlive periodically sends untagged OK responses until stop is
+// closed.
+func (c *Conn) idleKeepAlive(interval time.Duration, stop <-chan struct{}) {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-timer.C:
+		}
+
+		c.encMutex.Lock()
+		elapsed := time.Since(c.lastWrite)
+		c.encMutex.Unlock()
+		if elapsed < interval {
+			timer.Reset(interval - elapsed)
+			continue
+		}
+
+		err := c.writeStatusResp("", &imap.StatusResponse{
+			Type: imap.StatusResponseTypeOK,
+			Text: "Still here",
+		})
+		if err != nil {
+			return
+		}
+		timer.Reset(interval)
+	}
+}
@@ -0,0 +1,41 @@
+package imapserver_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+func TestIdle_keepAlive(t *testing.T) {
+	user := newTestUser()
+	conn := newTestConnWithOptions(t, &imapserver.Options{
+		NewSession: func(conn *imapserver.Conn) (imapserver.Session, *imapserver.GreetingData, error) {
+			return imapmemserver.NewUserSession(user), &imapserver.GreetingData{PreAuth: true}, nil
+		},
+		Caps:                  imap.CapSet{imap.CapIMAP4rev1: {}},
+		IdleKeepAliveInterval: 100 * time.Millisecond,
+	})
+	defer conn.Close()
+
+	conn.expectOK("S", "S SELECT INBOX\r\n")
+
+	if _, err := conn.conn.Write([]byte("I IDLE\r\n")); err != nil {
+		t.Fatalf("failed to write IDLE: %v", err)
+	}
+	if line := conn.readLine(); !strings.HasPrefix(line, "+ ") {
+		t.Fatalf("expected continuation request, got %q", line)
+	}
+
+	for i := 0; i < 2; i++ {
+		if line := conn.readLine(); line != "* OK Still here" {
+			t.Fatalf("expected keep-alive response, got %q", line)
+		}
+	}
+
+	conn.expectOK("I", "DONE\r\n")
+	conn.expectNoopOK()
+}
@@ -0,0 +1,173 @@
+package imapmemserver
+
+import (
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// otherUsersPrefix is the prefix of the namespace containing mailboxes shared
+// by other users, e.g. "Other Users/alice/INBOX".
+const otherUsersPrefix = "Other Users" + string(mailboxDelim)
+
+var errNoPerm = &imap.Error{
+	Type: imap.StatusResponseTypeNo,
+	Code: imap.ResponseCodeNoPerm,
+	Text: "Permission denied",
+}
+
+func (u *User) isOtherUsersMailbox(name string) bool {
+	return u.server != nil && strings.HasPrefix(name, otherUsersPrefix)
+}
+
+// otherUsersMailbox looks up a mailbox owned by another user and checks that
+// the user has the required rights on it. The mailbox is only visible if the
+// other user has granted the lookup right.
+func (u *User) otherUsersMailbox(name string, required imap.RightSet) (*Mailbox, *User, error) {
+	ownerName, mboxName, _ := strings.Cut(strings.TrimPrefix(name, otherUsersPrefix), string(mailboxDelim))
+	owner := u.server.user(ownerName)
+	if owner == nil || owner == u {
+		return nil, nil, errNoSuchMailbox
+	}
+
+	owner.mutex.Lock()
+	mbox := owner.mailboxes[mboxName]
+	owner.mutex.Unlock()
+	if mbox == nil {
+		return nil, nil, errNoSuchMailbox
+	}
+	rights := mbox.rights(u.username)
+	if !rights.Has(imap.RightLookup) {
+		return nil, nil, errNoSuchMailbox
+	} else if !rights.Contains(required) {
+		return nil, nil, errNoPerm
+	}
+	return mbox, owner, nil
+}
+
+// aclMailbox looks up a mailbox and returns the rights the user has on it.
+func (u *User) aclMailbox(name string) (*Mailbox, *User, imap.RightSet, error) {
+	if u.isOtherUsersMailbox(name) {
+		mbox, owner, err := u.otherUsersMailbox(name, nil)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return mbox, owner, mbox.rights(u.username), nil
+	}
+
+	mbox, err := u.mailbox(name, nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return mbox, u, imap.RightSetAll, nil
+}
+
+func (u *User) SetACL(mailbox string, ri imap.RightsIdentifier, rm imap.RightModification, rs imap.RightSet) error {
+	mbox, owner, rights, err := u.aclMailbox(mailbox)
+	if err != nil {
+		return err
+	} else if !rights.Has(imap.RightAdminister) {
+		return errNoPerm
+	} else if string(ri) == owner.username {
+		return &imap.Error{
+			Type: imap.StatusResponseTypeNo,
+			Code: imap.ResponseCodeCannot,
+			Text: "Cannot change the rights of the mailbox owner",
+		}
+	}
+
+	mbox.mutex.Lock()
+	defer mbox.mutex.Unlock()
+	// Stored rights are kept expanded. Virtual rights are derived again after
+	// the modification, so that revoking one of the rights they stand for
+	// revokes them as well.
+	rs = mbox.acl[ri].Modify(rm, rs.Expand())
+	rs = rs.Remove(imap.RightSet{imap.RightCreate, imap.RightDelete}).Expand()
+	if len(rs) == 0 {
+		delete(mbox.acl, ri)
+	} else {
+		if mbox.acl == nil {
+			mbox.acl = make(map[imap.RightsIdentifier]imap.RightSet)
+		}
+		mbox.acl[ri] = rs
+	}
+	return nil
+}
+
+func (u *User) DeleteACL(mailbox string, ri imap.RightsIdentifier) error {
+	return u.SetACL(mailbox, ri, imap.RightModificationReplace, nil)
+}
+
+func (u *User) GetACL(mailbox string) (map[imap.RightsIdentifier]imap.RightSet, error) {
+	mbox, owner, rights, err := u.aclMailbox(mailbox)
+	if err != nil {
+		return nil, err
+	} else if !rights.Has(imap.RightAdminister) {
+		return nil, errNoPerm
+	}
+
+	mbox.mutex.Lock()
+	defer mbox.mutex.Unlock()
+	acl := make(map[imap.RightsIdentifier]imap.RightSet, len(mbox.acl)+1)
+	for ri, rs := range mbox.acl {
+		acl[ri] = rs
+	}
+	acl[imap.RightsIdentifier(owner.username)] = imap.RightSetAll
+	return acl, nil
+}
+
+func (u *User) ListRights(mailbox string, ri imap.RightsIdentifier) (required imap.RightSet, optional []imap.RightSet, err error) {
+	_, owner, rights, err := u.aclMailbox(mailbox)
+	if err != nil {
+		return nil, nil, err
+	} else if !rights.Has(imap.RightAdminister) {
+		return nil, nil, errNoPerm
+	}
+
+	if string(ri) == owner.username {
+		return imap.RightSetAll, nil, nil
+	}
+	// Rights can be granted independently, but virtual rights are grouped
+	// with the rights they stand for, as described in RFC 4314 section 2.1.1
+	var virtualGroups []imap.RightSet
+	for _, virtual := range []imap.Right{imap.RightCreate, imap.RightDelete} {
+		virtualGroups = append(virtualGroups, imap.RightSet{virtual}.Expand())
+	}
+	independent := imap.RightSetAll
+	for _, group := range virtualGroups {
+		independent = independent.Remove(group)
+	}
+	for _, right := range independent {
+		optional = append(optional, imap.RightSet{right})
+	}
+	return nil, append(optional, virtualGroups...), nil
+}
+
+func (u *User) MyRights(mailbox string) (imap.RightSet, error) {
+	_, _, rights, err := u.aclMailbox(mailbox)
+	return rights, err
+}
+
+// storeRights returns the rights needed to change flags, as described in
+// RFC 4314 section 4.
+func storeRights(flags []imap.Flag) imap.RightSet {
+	var rights imap.RightSet
+	for _, flag := range flags {
+		switch flag.Canonical() {
+		case imap.FlagSeen:
+			rights = rights.Add(imap.RightSet{imap.RightSeen})
+		case imap.FlagDeleted:
+			rights = rights.Add(imap.RightSet{imap.RightDeleteMessages})
+		default:
+			rights = rights.Add(imap.RightSet{imap.RightWrite})
+		}
+	}
+	return rights
+}
+
+func (mbox *Mailbox) rights(username string) imap.RightSet {
+	mbox.mutex.Lock()
+	defer mbox.mutex.Unlock()
+	rights := mbox.acl[imap.RightsIdentifierAnyone]
+	return rights.Add(mbox.acl[imap.RightsIdentifier(username)])
+}
@@ -0,0 +1,70 @@
+package imapmemserver
+
+import (
+	"crypto/sha256"
+	"sync"
+)
+
+type contentHash [sha256.Size]byte
+
+// contentStore deduplicates message contents by their SHA-256 hash.
+//
+// Messages referencing a content from a store hold a reference to it. Once
+// the last reference is released, the content is removed from the store.
+type contentStore struct {
+	mutex    sync.Mutex
+	contents map[contentHash]*messageContent
+}
+
+func newContentStore() *contentStore {
+	return &contentStore{contents: make(map[contentHash]*messageContent)}
+}
+
+// get returns a content for buf, shared with existing messages if possible.
+// The caller holds a reference to the returned content.
+func (store *contentStore) get(buf []byte) *messageContent {
+	hash := contentHash(sha256.Sum256(buf))
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	content := store.contents[hash]
+	if content == nil {
+		content = newMessageContent(buf)
+		content.store = store
+		content.hash = hash
+		store.contents[hash] = content
+	}
+	content.refs++
+	return content
+}
+
+func (store *contentStore) len() int {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return len(store.contents)
+}
+
+// acquire takes a reference to the content.
+func (content *messageContent) acquire() {
+	if content.store == nil {
+		return
+	}
+	content.store.mutex.Lock()
+	content.refs++
+	content.store.mutex.Unlock()
+}
+
+// release drops a reference to the content.
+func (content *messageContent) release() {
+	store := content.store
+	if store == nil {
+		return
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	content.refs--
+	if content.refs == 0 && store.contents[content.hash] == content {
+		delete(store.contents, content.hash)
+	}
+}
@@ -0,0 +1,52 @@
+package imapmemserver
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+func TestUser_deduplicate(t *testing.T) {
+	const raw = "Subject: Hi\r\n\r\nHello\r\n"
+
+	user := NewUser("user", "pass")
+	user.SetDeduplicate(true)
+	for _, name := range []string{"INBOX", "Archive"} {
+		user.Create(name, nil)
+	}
+
+	for _, name := range []string{"INBOX", "INBOX", "Archive"} {
+		if _, err := user.Append(name, imap.NewLiteral([]byte(raw)), &imap.AppendOptions{}); err != nil {
+			t.Fatalf("Append(%q) = %v", name, err)
+		}
+	}
+	user.Append("Archive", imap.NewLiteral([]byte(strings.Replace(raw, "Hello", "Bye", 1))), &imap.AppendOptions{})
+
+	if n := user.contents.len(); n != 2 {
+		t.Errorf("after APPEND: %v contents, want 2", n)
+	}
+
+	inbox, _ := user.mailbox("INBOX", nil)
+	inbox.mutex.Lock()
+	if inbox.l[0].content != inbox.l[1].content {
+		t.Errorf("identical messages don't share their content")
+	}
+	inbox.l[0].flags[imap.FlagSeen] = struct{}{}
+	if _, ok := inbox.l[1].flags[imap.FlagSeen]; ok {
+		t.Errorf("flags are shared between identical messages")
+	}
+	inbox.expungeLocked(map[*message]struct{}{inbox.l[0]: {}, inbox.l[1]: {}})
+	inbox.mutex.Unlock()
+
+	if n := user.contents.len(); n != 2 {
+		t.Errorf("after EXPUNGE: %v contents, want 2", n)
+	}
+
+	if err := user.Delete("Archive"); err != nil {
+		t.Fatalf("Delete() = %v", err)
+	}
+	if n := user.contents.len(); n != 0 {
+		t.Errorf("after DELETE: %v contents, want 0", n)
+	}
+}
@@ -21,8 +21,25 @@ type Mailbox struct {
 	mutex      sync.Mutex
 	name       string
 	subscribed bool
+	specialUse []imap.MailboxAttr
 	l          []*message
 	uidNext    imap.UID
+	modSeq     imap.ModSeq // highest mod-sequence
+	expunged   []expungedMessage
+	// Highest mod-sequence of the expunged messages which have been trimmed
+	// from the expunged list
+	expungedTrimmed imap.ModSeq
+	acl             map[imap.RightsIdentifier]imap.RightSet
+}
+
+// maxExpungedMessages is the maximum number of expunged messages remembered
+// for QRESYNC. Clients can ask for changes since any mod-sequence, so older
+// entries are dropped and Vanished falls back to reporting all missing UIDs.
+const maxExpungedMessages = 1024
+
+type expungedMessage struct {
+	uid    imap.UID
+	modSeq imap.ModSeq
 }
 
 // NewMailbox creates a new mailbox.
@@ -32,6 +49,7 @@ func NewMailbox(name string, uidValidity uint32) *Mailbox {
 		uidValidity: uidValidity,
 		name:        name,
 		uidNext:     1,
+		modSeq:      1,
 	}
 }
 
@@ -42,6 +60,9 @@ func (mbox *Mailbox) list(options *imap.ListOptions) *imap.ListData {
 	if options.SelectSubscribed && !mbox.subscribed {
 		return nil
 	}
+	if options.SelectSpecialUse && len(mbox.specialUse) == 0 {
+		return nil
+	}
 
 	data := imap.ListData{
 		Mailbox: mbox.name,
@@ -50,6 +71,7 @@ func (mbox *Mailbox) list(options *imap.ListOptions) *imap.ListData {
 	if mbox.subscribed {
 		data.Attrs = append(data.Attrs, imap.MailboxAttrSubscribed)
 	}
+	data.Attrs = append(data.Attrs, mbox.specialUse...)
 	if options.ReturnStatus != nil {
 		data.Status = mbox.statusDataLocked(options.ReturnStatus)
 	}
@@ -87,13 +109,16 @@ func (mbox *Mailbox) statusDataLocked(options *imap.StatusOptions) *imap.StatusD
 		size := mbox.sizeLocked()
 		data.Size = &size
 	}
+	if options.HighestModSeq {
+		data.HighestModSeq = mbox.modSeq
+	}
 	return &data
 }
 
 func (mbox *Mailbox) countByFlagLocked(flag imap.Flag) uint32 {
 	var n uint32
 	for _, msg := range mbox.l {
-		if _, ok := msg.flags[canonicalFlag(flag)]; ok {
+		if _, ok := msg.flags[flag.Canonical()]; ok {
 			n++
 		}
 	}
@@ -103,30 +128,34 @@ func (mbox *Mailbox) countByFlagLocked(flag imap.Flag) uint32 {
 func (mbox *Mailbox) sizeLocked() int64 {
 	var size int64
 	for _, msg := range mbox.l {
-		size += int64(len(msg.buf))
+		size += int64(len(msg.content.buf))
 	}
 	return size
 }
 
-func (mbox *Mailbox) appendLiteral(r imap.LiteralReader, options *imap.AppendOptions) (*imap.AppendData, error) {
-	var buf bytes.Buffer
+func readLiteral(r imap.LiteralReader) ([]byte, error) {
+	// The literal may grow a little if line endings are normalized to CRLF
+	buf := bytes.NewBuffer(make([]byte, 0, int(r.Size())+bytes.MinRead))
 	if _, err := buf.ReadFrom(r); err != nil {
 		return nil, err
 	}
-	return mbox.appendBytes(buf.Bytes(), options), nil
+	return buf.Bytes(), nil
 }
 
+// copyMsg appends a copy of msg to the mailbox. The message content is
+// shared, not duplicated.
 func (mbox *Mailbox) copyMsg(msg *message) *imap.AppendData {
-	return mbox.appendBytes(msg.buf, &imap.AppendOptions{
+	msg.content.acquire()
+	return mbox.appendMessages([]*message{newMessage(msg.content, &imap.AppendOptions{
 		Time:  msg.t,
 		Flags: msg.flagList(),
-	})
+	})})
 }
 
-func (mbox *Mailbox) appendBytes(buf []byte, options *imap.AppendOptions) *imap.AppendData {
+func newMessage(content *messageContent, options *imap.AppendOptions) *message {
 	msg := &message{
-		flags: make(map[imap.Flag]struct{}),
-		buf:   buf,
+		flags:   make(map[imap.Flag]struct{}),
+		content: content,
 	}
 
 	if options.Time.IsZero() {
@@ -136,21 +165,41 @@ func (mbox *Mailbox) appendBytes(buf []byte, options *imap.AppendOptions) *imap.
 	}
 
 	for _, flag := range options.Flags {
-		msg.flags[canonicalFlag(flag)] = struct{}{}
+		msg.flags[flag.Canonical()] = struct{}{}
 	}
 
+	return msg
+}
+
+// appendMessages atomically appends messages to the mailbox.
+func (mbox *Mailbox) appendMessages(msgs []*message) *imap.AppendData {
 	mbox.mutex.Lock()
 	defer mbox.mutex.Unlock()
 
-	msg.uid = mbox.uidNext
-	mbox.uidNext++
+	data := &imap.AppendData{UIDValidity: mbox.uidValidity}
+	for _, msg := range msgs {
+		msg.uid = mbox.uidNext
+		mbox.uidNext++
+		msg.modSeq = mbox.nextModSeqLocked()
 
-	mbox.l = append(mbox.l, msg)
+		mbox.l = append(mbox.l, msg)
+		data.UIDs.AddNum(msg.uid)
+	}
 	mbox.tracker.QueueNumMessages(uint32(len(mbox.l)))
 
-	return &imap.AppendData{
-		UIDValidity: mbox.uidValidity,
-		UID:         msg.uid,
+	if len(msgs) == 1 {
+		data.UID = msgs[0].uid
+	}
+	return data
+}
+
+// releaseAll releases the contents of all messages, when the mailbox is
+// deleted.
+func (mbox *Mailbox) releaseAll() {
+	mbox.mutex.Lock()
+	defer mbox.mutex.Unlock()
+	for _, msg := range mbox.l {
+		msg.content.release()
 	}
 }
 
@@ -180,9 +229,16 @@ func (mbox *Mailbox) selectDataLocked() *imap.SelectData {
 		NumMessages:    uint32(len(mbox.l)),
 		UIDNext:        mbox.uidNext,
 		UIDValidity:    mbox.uidValidity,
+		HighestModSeq:  mbox.modSeq,
 	}
 }
 
+// nextModSeqLocked allocates a new mod-sequence for a message change.
+func (mbox *Mailbox) nextModSeqLocked() imap.ModSeq {
+	mbox.modSeq++
+	return mbox.modSeq
+}
+
 func (mbox *Mailbox) flagsLocked() []imap.Flag {
 	m := make(map[imap.Flag]struct{})
 	for _, msg := range mbox.l {
@@ -210,7 +266,7 @@ func (mbox *Mailbox) Expunge(w *imapserver.ExpungeWriter, uids *imap.UIDSet) err
 		if uids != nil && !uids.Contains(msg.uid) {
 			continue
 		}
-		if _, ok := msg.flags[canonicalFlag(imap.FlagDeleted)]; ok {
+		if _, ok := msg.flags[imap.FlagDeleted]; ok {
 			expunged[msg] = struct{}{}
 		}
 	}
@@ -235,9 +291,14 @@ func (mbox *Mailbox) expungeLocked(expunged map[*message]struct{}) (seqNums []ui
 	for i := len(mbox.l) - 1; i >= 0; i-- {
 		msg := mbox.l[i]
 		if _, ok := expunged[msg]; ok {
+			msg.content.release()
 			seqNum := uint32(i) + 1
 			seqNums = append(seqNums, seqNum)
-			mbox.tracker.QueueExpunge(seqNum)
+			mbox.tracker.QueueExpungeUID(seqNum, msg.uid)
+			mbox.expunged = append(mbox.expunged, expungedMessage{
+				uid:    msg.uid,
+				modSeq: mbox.nextModSeqLocked(),
+			})
 		} else {
 			filtered = append(filtered, msg)
 		}
@@ -250,10 +311,22 @@ func (mbox *Mailbox) expungeLocked(expunged map[*message]struct{}) (seqNums []ui
 	}
 
 	mbox.l = filtered
+	mbox.trimExpungedLocked()
 
 	return seqNums
 }
 
+func (mbox *Mailbox) trimExpungedLocked() {
+	if len(mbox.expunged) <= maxExpungedMessages {
+		return
+	}
+	// Entries are sorted by mod-sequence. Keep half of the limit, so that
+	// the list isn't trimmed on every expunge.
+	n := len(mbox.expunged) - maxExpungedMessages/2
+	mbox.expungedTrimmed = mbox.expunged[n-1].modSeq
+	mbox.expunged = append([]expungedMessage(nil), mbox.expunged[n:]...)
+}
+
 // NewView creates a new view into this mailbox.
 //
 // Callers must call MailboxView.Close once they are done with the mailbox view.
@@ -284,27 +357,25 @@ func (mbox *MailboxView) Close() {
 }
 
 func (mbox *MailboxView) Fetch(w *imapserver.FetchWriter, numSet imap.NumSet, options *imap.FetchOptions) error {
-	markSeen := false
-	for _, bs := range options.BodySection {
-		if !bs.Peek {
-			markSeen = true
-			break
-		}
-	}
+	markSeen := options.MarksSeen()
 
-	var err error
+	var (
+		fr  fetchReaders
+		err error
+	)
 	mbox.forEach(numSet, func(seqNum uint32, msg *message) {
-		if err != nil {
+		if err != nil || msg.modSeq <= options.ChangedSince {
 			return
 		}
 
 		if markSeen {
-			msg.flags[canonicalFlag(imap.FlagSeen)] = struct{}{}
+			msg.flags[imap.FlagSeen] = struct{}{}
+			msg.modSeq = mbox.nextModSeqLocked()
 			mbox.Mailbox.tracker.QueueMessageFlags(seqNum, msg.uid, msg.flagList(), nil)
 		}
 
 		respWriter := w.CreateMessage(mbox.tracker.EncodeSeqNum(seqNum))
-		err = msg.fetch(respWriter, options)
+		err = msg.fetch(respWriter, options, &fr)
 	})
 	return err
 }
@@ -316,6 +387,9 @@ func (mbox *MailboxView) Search(numKind imapserver.NumKind, criteria *imap.Searc
 	mbox.staticSearchCriteria(criteria)
 
 	data := imap.SearchData{UID: numKind == imapserver.NumKindUID}
+	var count uint32
+
+	matcher := newSearchMatcher(criteria)
 
 	var (
 		seqSet imap.SeqSet
@@ -324,7 +398,7 @@ func (mbox *MailboxView) Search(numKind imapserver.NumKind, criteria *imap.Searc
 	for i, msg := range mbox.l {
 		seqNum := mbox.tracker.EncodeSeqNum(uint32(i) + 1)
 
-		if !msg.search(seqNum, criteria) {
+		if !matcher.match(&searchMessage{message: msg, seqNum: seqNum}) {
 			continue
 		}
 
@@ -348,8 +422,9 @@ func (mbox *MailboxView) Search(numKind imapserver.NumKind, criteria *imap.Searc
 		if data.Max == 0 || num > data.Max {
 			data.Max = num
 		}
-		data.Count++
+		count++
 	}
+	data.Count = &count
 
 	switch numKind {
 	case imapserver.NumKindSeq:
@@ -393,16 +468,77 @@ func (mbox *MailboxView) staticSearchCriteria(criteria *imap.SearchCriteria) {
 }
 
 func (mbox *MailboxView) Store(w *imapserver.FetchWriter, numSet imap.NumSet, flags *imap.StoreFlags, options *imap.StoreOptions) error {
+	// Messages changed since UNCHANGEDSINCE are left as-is and reported in
+	// the MODIFIED response code
+	var (
+		storedSeqNums, modifiedSeqNums []uint32
+		modifiedUIDs                   []imap.UID
+	)
 	mbox.forEach(numSet, func(seqNum uint32, msg *message) {
+		if options.UnchangedSince != 0 && msg.modSeq > options.UnchangedSince {
+			modifiedSeqNums = append(modifiedSeqNums, mbox.tracker.EncodeSeqNum(seqNum))
+			modifiedUIDs = append(modifiedUIDs, msg.uid)
+			return
+		}
+		storedSeqNums = append(storedSeqNums, mbox.tracker.EncodeSeqNum(seqNum))
 		msg.store(flags)
+		msg.modSeq = mbox.nextModSeqLocked()
 		mbox.Mailbox.tracker.QueueMessageFlags(seqNum, msg.uid, msg.flagList(), mbox.tracker)
 	})
-	if !flags.Silent {
-		return mbox.Fetch(w, numSet, &imap.FetchOptions{Flags: true})
+	if !flags.Silent && len(storedSeqNums) > 0 {
+		err := mbox.Fetch(w, imap.SeqSetNum(storedSeqNums...), &imap.FetchOptions{
+			Flags:  true,
+			ModSeq: options.UnchangedSince != 0,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(modifiedSeqNums) > 0 {
+		var modified imap.NumSet = imap.SeqSetNum(modifiedSeqNums...)
+		if _, ok := numSet.(imap.UIDSet); ok {
+			modified = imap.UIDSetNum(modifiedUIDs...)
+		}
+		return &imap.Error{
+			Type:     imap.StatusResponseTypeOK,
+			Code:     imap.ResponseCodeModified,
+			CodeArgs: []interface{}{imap.ModifiedCodeArg{NumSet: modified}},
+			Text:     "Conditional STORE failed",
+		}
 	}
 	return nil
 }
 
+func (mbox *MailboxView) Vanished(modSeq imap.ModSeq) (imap.UIDSet, error) {
+	mbox.mutex.Lock()
+	defer mbox.mutex.Unlock()
+
+	var uids imap.UIDSet
+	if modSeq < mbox.expungedTrimmed {
+		// Some messages expunged since modSeq have been forgotten: report
+		// all UIDs which aren't in the mailbox anymore, as allowed by
+		// RFC 7162 section 3.2.5.2
+		next := imap.UID(1)
+		for _, msg := range mbox.l {
+			if msg.uid > next {
+				uids.AddRange(next, msg.uid-1)
+			}
+			next = msg.uid + 1
+		}
+		if next < mbox.uidNext {
+			uids.AddRange(next, mbox.uidNext-1)
+		}
+		return uids, nil
+	}
+
+	for _, msg := range mbox.expunged {
+		if msg.modSeq > modSeq {
+			uids.AddNum(msg.uid)
+		}
+	}
+	return uids, nil
+}
+
 func (mbox *MailboxView) Poll(w *imapserver.UpdateWriter, allowExpunge bool) error {
 	return mbox.tracker.Poll(w, allowExpunge)
 }
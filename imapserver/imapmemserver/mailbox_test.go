@@ -0,0 +1,54 @@
+package imapmemserver
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+func TestMailbox_vanishedTrimmed(t *testing.T) {
+	const n = 3 * maxExpungedMessages
+
+	user := NewUser("user", "pass")
+	user.Create("INBOX", nil)
+	for i := 0; i < n; i++ {
+		user.Append("INBOX", imap.NewLiteral([]byte("Subject: Hi\r\n\r\nHello\r\n")), &imap.AppendOptions{})
+	}
+	mbox, _ := user.mailbox("INBOX", nil)
+	view := mbox.NewView()
+	defer view.Close()
+
+	// Expunge all messages but the first one and the last one, one at a time
+	var modSeqs []imap.ModSeq
+	for uid := imap.UID(2); uid < n; uid++ {
+		mbox.mutex.Lock()
+		modSeqs = append(modSeqs, mbox.modSeq)
+		mbox.expungeLocked(map[*message]struct{}{mbox.l[1]: {}})
+		mbox.mutex.Unlock()
+	}
+
+	mbox.mutex.Lock()
+	if len(mbox.expunged) > maxExpungedMessages {
+		t.Errorf("%v expunged messages remembered, want at most %v", len(mbox.expunged), maxExpungedMessages)
+	}
+	mbox.mutex.Unlock()
+
+	tests := []struct {
+		modSeq imap.ModSeq
+		want   string
+	}{
+		{modSeqs[0], fmt.Sprintf("2:%v", n-1)},
+		{modSeqs[len(modSeqs)-2], fmt.Sprintf("%v:%v", n-2, n-1)},
+		{modSeqs[len(modSeqs)-1] + 1, ""},
+	}
+	for _, tc := range tests {
+		uids, err := view.Vanished(tc.modSeq)
+		if err != nil {
+			t.Fatalf("Vanished(%v) = %v", tc.modSeq, err)
+		}
+		if got := uids.String(); got != tc.want {
+			t.Errorf("Vanished(%v) = %v, want %v", tc.modSeq, got, tc.want)
+		}
+	}
+}
@@ -4,89 +4,151 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
-	"io"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/imapserver"
 	gomessage "github.com/emersion/go-message"
-	"github.com/emersion/go-message/mail"
 	"github.com/emersion/go-message/textproto"
 )
 
+// messageContent is the immutable content of a message, along with data
+// parsed from it. It's shared by all copies of a message created by COPY and
+// MOVE, and can be accessed concurrently from multiple mailboxes: it must
+// never be mutated.
+type messageContent struct {
+	buf []byte
+
+	// Deduplicated contents are indexed in a store, nil otherwise
+	store *contentStore
+	hash  contentHash
+	refs  int // protected by store.mutex
+
+	envelopeOnce      sync.Once
+	envelope          *imap.Envelope
+	bodyStructureOnce sync.Once
+	bodyStructure     imap.BodyStructure
+}
+
+func newMessageContent(buf []byte) *messageContent {
+	return &messageContent{buf: buf}
+}
+
+// getEnvelope returns the envelope of the message, parsed on first use.
+func (content *messageContent) getEnvelope() *imap.Envelope {
+	content.envelopeOnce.Do(func() {
+		header, err := textproto.ReadHeader(bufio.NewReader(bytes.NewReader(content.buf)))
+		if err == nil {
+			content.envelope = imapserver.ExtractEnvelope(header)
+		}
+	})
+	return content.envelope
+}
+
+// getBodyStructure returns the body structure of the message, parsed on
+// first use.
+func (content *messageContent) getBodyStructure() imap.BodyStructure {
+	content.bodyStructureOnce.Do(func() {
+		content.bodyStructure = imapserver.ExtractBodyStructure(bytes.NewReader(content.buf))
+	})
+	return content.bodyStructure
+}
+
+// message is a message stored in a mailbox. Copies of a message in other
+// mailboxes have their own message, but share its content.
 type message struct {
 	// immutable
-	uid imap.UID
-	buf []byte
-	t   time.Time
+	uid     imap.UID
+	content *messageContent
+	t       time.Time
 
 	// mutable, protected by Mailbox.mutex
-	flags map[imap.Flag]struct{}
+	flags  map[imap.Flag]struct{}
+	modSeq imap.ModSeq
+}
+
+// fetchReaders holds readers reset for each message of a FETCH command, to
+// avoid allocating them over and over again.
+type fetchReaders struct {
+	r   bytes.Reader
+	lit bytes.Reader
+}
+
+// reader returns a reader for b. It's only valid until the next call.
+func (fr *fetchReaders) reader(b []byte) *bytes.Reader {
+	fr.r.Reset(b)
+	return &fr.r
+}
+
+// literal returns a literal for b. It's only valid until the next call.
+func (fr *fetchReaders) literal(b []byte) imap.LiteralReader {
+	fr.lit.Reset(b)
+	return &fr.lit
+}
+
+func (msg *message) bodySection(fr *fetchReaders, item *imap.FetchItemBodySection) []byte {
+	// Avoid copying the message when the whole message is requested
+	if len(item.Part) == 0 && item.Specifier == imap.PartSpecifierNone {
+		b := msg.content.buf
+		if partial := item.Partial; partial != nil {
+			if partial.Offset > int64(len(b)) {
+				return nil
+			}
+			end := partial.Offset + partial.Size
+			if end > int64(len(b)) {
+				end = int64(len(b))
+			}
+			b = b[partial.Offset:end]
+		}
+		return b
+	}
+	return imapserver.ExtractBodySection(fr.reader(msg.content.buf), item)
 }
 
-func (msg *message) fetch(w *imapserver.FetchResponseWriter, options *imap.FetchOptions) error {
+func (msg *message) fetch(w *imapserver.FetchResponseWriter, options *imap.FetchOptions, fr *fetchReaders) error {
 	w.WriteUID(msg.uid)
 
 	if options.Flags {
 		w.WriteFlags(msg.flagList())
 	}
+	if options.ModSeq {
+		w.WriteModSeq(msg.modSeq)
+	}
 	if options.InternalDate {
 		w.WriteInternalDate(msg.t)
 	}
 	if options.RFC822Size {
-		w.WriteRFC822Size(int64(len(msg.buf)))
+		w.WriteRFC822Size(int64(len(msg.content.buf)))
 	}
 	if options.Envelope {
-		w.WriteEnvelope(msg.envelope())
+		w.WriteEnvelope(msg.content.getEnvelope())
 	}
 	if options.BodyStructure != nil {
-		w.WriteBodyStructure(imapserver.ExtractBodyStructure(bytes.NewReader(msg.buf)))
+		w.WriteBodyStructure(msg.content.getBodyStructure())
 	}
 
 	for _, bs := range options.BodySection {
-		buf := imapserver.ExtractBodySection(bytes.NewReader(msg.buf), bs)
-		wc := w.WriteBodySection(bs, int64(len(buf)))
-		_, writeErr := wc.Write(buf)
-		closeErr := wc.Close()
-		if writeErr != nil {
-			return writeErr
-		}
-		if closeErr != nil {
-			return closeErr
+		if err := w.WriteBodySectionLiteral(bs, fr.literal(msg.bodySection(fr, bs))); err != nil {
+			return err
 		}
 	}
 
 	for _, bs := range options.BinarySection {
-		buf := imapserver.ExtractBinarySection(bytes.NewReader(msg.buf), bs)
-		wc := w.WriteBinarySection(bs, int64(len(buf)))
-		_, writeErr := wc.Write(buf)
-		closeErr := wc.Close()
-		if writeErr != nil {
-			return writeErr
-		}
-		if closeErr != nil {
-			return closeErr
+		buf := imapserver.ExtractBinarySection(fr.reader(msg.content.buf), bs)
+		if err := w.WriteBinarySectionLiteral(bs, fr.literal(buf)); err != nil {
+			return err
 		}
 	}
 
 	for _, bss := range options.BinarySectionSize {
-		n := imapserver.ExtractBinarySectionSize(bytes.NewReader(msg.buf), bss)
+		n := imapserver.ExtractBinarySectionSize(fr.reader(msg.content.buf), bss)
 		w.WriteBinarySectionSize(bss, n)
 	}
 
 	return w.Close()
 }
 
-func (msg *message) envelope() *imap.Envelope {
-	br := bufio.NewReader(bytes.NewReader(msg.buf))
-	header, err := textproto.ReadHeader(br)
-	if err != nil {
-		return nil
-	}
-	return imapserver.ExtractEnvelope(header)
-}
-
 func (msg *message) flagList() []imap.Flag {
 	var flags []imap.Flag
 	for flag := range msg.flags {
@@ -102,11 +164,11 @@ func (msg *message) store(store *imap.StoreFlags) {
 		fallthrough
 	case imap.StoreFlagsAdd:
 		for _, flag := range store.Flags {
-			msg.flags[canonicalFlag(flag)] = struct{}{}
+			msg.flags[flag.Canonical()] = struct{}{}
 		}
 	case imap.StoreFlagsDel:
 		for _, flag := range store.Flags {
-			delete(msg.flags, canonicalFlag(flag))
+			delete(msg.flags, flag.Canonical())
 		}
 	default:
 		panic(fmt.Errorf("unknown STORE flag operation: %v", store.Op))
@@ -114,160 +176,9 @@ func (msg *message) store(store *imap.StoreFlags) {
 }
 
 func (msg *message) reader() *gomessage.Entity {
-	r, _ := gomessage.Read(bytes.NewReader(msg.buf))
+	r, _ := gomessage.Read(bytes.NewReader(msg.content.buf))
 	if r == nil {
 		r, _ = gomessage.New(gomessage.Header{}, bytes.NewReader(nil))
 	}
 	return r
 }
-
-func (msg *message) search(seqNum uint32, criteria *imap.SearchCriteria) bool {
-	for _, seqSet := range criteria.SeqNum {
-		if seqNum == 0 || !seqSet.Contains(seqNum) {
-			return false
-		}
-	}
-	for _, uidSet := range criteria.UID {
-		if !uidSet.Contains(msg.uid) {
-			return false
-		}
-	}
-	if !matchDate(msg.t, criteria.Since, criteria.Before) {
-		return false
-	}
-
-	for _, flag := range criteria.Flag {
-		if _, ok := msg.flags[canonicalFlag(flag)]; !ok {
-			return false
-		}
-	}
-	for _, flag := range criteria.NotFlag {
-		if _, ok := msg.flags[canonicalFlag(flag)]; ok {
-			return false
-		}
-	}
-
-	if criteria.Larger != 0 && int64(len(msg.buf)) <= criteria.Larger {
-		return false
-	}
-	if criteria.Smaller != 0 && int64(len(msg.buf)) >= criteria.Smaller {
-		return false
-	}
-
-	header := mail.Header{msg.reader().Header}
-
-	for _, fieldCriteria := range criteria.Header {
-		if !matchHeaderFields(header.FieldsByKey(fieldCriteria.Key), fieldCriteria.Value) {
-			return false
-		}
-	}
-
-	if !criteria.SentSince.IsZero() || !criteria.SentBefore.IsZero() {
-		t, err := header.Date()
-		if err != nil {
-			return false
-		} else if !matchDate(t, criteria.SentSince, criteria.SentBefore) {
-			return false
-		}
-	}
-
-	for _, text := range criteria.Text {
-		if !matchEntity(msg.reader(), text, true) {
-			return false
-		}
-	}
-	for _, body := range criteria.Body {
-		if !matchEntity(msg.reader(), body, false) {
-			return false
-		}
-	}
-
-	for _, not := range criteria.Not {
-		if msg.search(seqNum, &not) {
-			return false
-		}
-	}
-	for _, or := range criteria.Or {
-		if !msg.search(seqNum, &or[0]) && !msg.search(seqNum, &or[1]) {
-			return false
-		}
-	}
-
-	return true
-}
-
-func matchDate(t, since, before time.Time) bool {
-	// We discard time zone information by setting it to UTC.
-	// RFC 3501 explicitly requires zone unaware date comparison.
-	t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
-
-	if !since.IsZero() && t.Before(since) {
-		return false
-	}
-	if !before.IsZero() && !t.Before(before) {
-		return false
-	}
-	return true
-}
-
-func matchHeaderFields(fields gomessage.HeaderFields, pattern string) bool {
-	if pattern == "" {
-		return fields.Len() > 0
-	}
-
-	pattern = strings.ToLower(pattern)
-	for fields.Next() {
-		v, _ := fields.Text()
-		if strings.Contains(strings.ToLower(v), pattern) {
-			return true
-		}
-	}
-	return false
-}
-
-func matchEntity(e *gomessage.Entity, pattern string, includeHeader bool) bool {
-	if pattern == "" {
-		return true
-	}
-
-	if includeHeader && matchHeaderFields(e.Header.Fields(), pattern) {
-		return true
-	}
-
-	if mr := e.MultipartReader(); mr != nil {
-		for {
-			part, err := mr.NextPart()
-			if err == io.EOF {
-				break
-			} else if err != nil {
-				return false
-			}
-
-			if matchEntity(part, pattern, includeHeader) {
-				return true
-			}
-		}
-
-		return false
-	} else {
-		t, _, err := e.Header.ContentType()
-		if err != nil {
-			return false
-		}
-
-		if !strings.HasPrefix(t, "text/") && !strings.HasPrefix(t, "message/") {
-			return false
-		}
-
-		buf, err := io.ReadAll(e.Body)
-		if err != nil {
-			return false
-		}
-
-		return bytes.Contains(bytes.ToLower(buf), bytes.ToLower([]byte(pattern)))
-	}
-}
-
-func canonicalFlag(flag imap.Flag) imap.Flag {
-	return imap.Flag(strings.ToLower(string(flag)))
-}
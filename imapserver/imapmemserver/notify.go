@@ -0,0 +1,229 @@
+package imapmemserver
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+)
+
+var notifyStatusOptions = imap.StatusOptions{
+	NumMessages: true,
+	UIDNext:     true,
+	NumUnseen:   true,
+}
+
+// notifier holds the NOTIFY filter of a session.
+type notifier struct {
+	w      *imapserver.NotifyWriter
+	filter *imap.NotifyFilter
+
+	mutex    sync.Mutex
+	selected *Mailbox
+}
+
+func (n *notifier) setSelected(mbox *Mailbox) {
+	n.mutex.Lock()
+	n.selected = mbox
+	n.mutex.Unlock()
+}
+
+func (n *notifier) isSelected(mbox *Mailbox) bool {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return n.selected == mbox
+}
+
+// wants checks whether the filter requests an event for a mailbox.
+func (n *notifier) wants(name string, subscribed bool, ev imap.NotifyEvent) bool {
+	for _, group := range n.filter.Groups {
+		if matchNotifyGroup(&group, name, subscribed) {
+			// The first matching group wins
+			return hasNotifyEvent(group.Events, ev)
+		}
+	}
+	return false
+}
+
+func matchNotifyGroup(group *imap.NotifyGroup, name string, subscribed bool) bool {
+	switch group.Kind {
+	case imap.NotifyMailboxesPersonal:
+		return true
+	case imap.NotifyMailboxesInboxes:
+		return name == "INBOX"
+	case imap.NotifyMailboxesSubscribed:
+		return subscribed
+	case imap.NotifyMailboxesSubtree:
+		for _, root := range group.Mailboxes {
+			if name == root || strings.HasPrefix(name, root+string(mailboxDelim)) {
+				return true
+			}
+		}
+	case imap.NotifyMailboxesMailboxes:
+		for _, mailbox := range group.Mailboxes {
+			if name == mailbox {
+				return true
+			}
+		}
+	}
+	// SELECTED and SELECTED-DELAYED are covered by regular unilateral updates
+	return false
+}
+
+func hasNotifyEvent(events []imap.NotifyEvent, ev imap.NotifyEvent) bool {
+	for _, e := range events {
+		if e == ev {
+			return true
+		}
+	}
+	return false
+}
+
+func (sess *UserSession) Notify(w *imapserver.NotifyWriter, filter *imap.NotifyFilter) error {
+	if filter != nil {
+		var unsupported []imap.NotifyEvent
+		for _, group := range filter.Groups {
+			for _, ev := range group.Events {
+				switch ev {
+				case imap.NotifyEventMessageNew, imap.NotifyEventMessageExpunge, imap.NotifyEventFlagChange,
+					imap.NotifyEventMailboxName, imap.NotifyEventSubscriptionChange:
+					// supported
+				default:
+					if !hasNotifyEvent(unsupported, ev) {
+						unsupported = append(unsupported, ev)
+					}
+				}
+			}
+		}
+		if len(unsupported) > 0 {
+			return &imap.Error{
+				Type:     imap.StatusResponseTypeNo,
+				Code:     imap.ResponseCodeBadEvent,
+				CodeArgs: []interface{}{unsupported},
+				Text:     "Unsupported NOTIFY events",
+			}
+		}
+	}
+
+	sess.user.removeNotifier(sess.notifier)
+	sess.notifier = nil
+	if filter == nil {
+		return nil
+	}
+
+	n := &notifier{w: w, filter: filter}
+	if sess.mailbox != nil {
+		n.selected = sess.mailbox.Mailbox
+	}
+	sess.notifier = n
+	sess.user.addNotifier(n)
+
+	if !filter.Status {
+		return nil
+	}
+	for _, mbox := range sess.user.notifyMailboxes(n) {
+		data := mbox.StatusData(&notifyStatusOptions)
+		if err := w.WriteStatus(data, &notifyStatusOptions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *User) addNotifier(n *notifier) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if u.notifiers == nil {
+		u.notifiers = make(map[*notifier]struct{})
+	}
+	u.notifiers[n] = struct{}{}
+}
+
+func (u *User) removeNotifier(n *notifier) {
+	if n == nil {
+		return
+	}
+	u.mutex.Lock()
+	delete(u.notifiers, n)
+	u.mutex.Unlock()
+}
+
+// notifyMailboxes returns the mailboxes for which a notifier requests at least
+// one event.
+func (u *User) notifyMailboxes(n *notifier) []*Mailbox {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	var l []*Mailbox
+	for _, mbox := range u.mailboxes {
+		mbox.mutex.Lock()
+		name, subscribed := mbox.name, mbox.subscribed
+		mbox.mutex.Unlock()
+
+		if n.isSelected(mbox) {
+			continue
+		}
+		for _, group := range n.filter.Groups {
+			if len(group.Events) > 0 && matchNotifyGroup(&group, name, subscribed) {
+				l = append(l, mbox)
+				break
+			}
+		}
+	}
+	return l
+}
+
+// notifyMailboxChange sends a STATUS response to the sessions which requested
+// an event for a mailbox, unless the mailbox is selected.
+func (u *User) notifyMailboxChange(mbox *Mailbox, ev imap.NotifyEvent) {
+	mbox.mutex.Lock()
+	name, subscribed := mbox.name, mbox.subscribed
+	mbox.mutex.Unlock()
+
+	u.mutex.Lock()
+	var notifiers []*notifier
+	if u.mailboxes[name] == mbox {
+		for n := range u.notifiers {
+			if !n.isSelected(mbox) && n.wants(name, subscribed, ev) {
+				notifiers = append(notifiers, n)
+			}
+		}
+	}
+	u.mutex.Unlock()
+
+	if len(notifiers) == 0 {
+		return
+	}
+	data := mbox.StatusData(&notifyStatusOptions)
+	for _, n := range notifiers {
+		// Errors are reported when the connection is used next
+		n.w.WriteStatus(data, &notifyStatusOptions)
+	}
+}
+
+// notifyList sends a LIST response to the sessions which requested an event
+// for a mailbox. If the mailbox has been renamed, the sessions which requested
+// an event for the old name are notified as well.
+func (u *User) notifyList(data *imap.ListData, ev imap.NotifyEvent) {
+	subscribed := false
+	for _, attr := range data.Attrs {
+		if attr == imap.MailboxAttrSubscribed {
+			subscribed = true
+		}
+	}
+
+	u.mutex.Lock()
+	var notifiers []*notifier
+	for n := range u.notifiers {
+		if n.wants(data.Mailbox, subscribed, ev) || (data.OldName != "" && n.wants(data.OldName, subscribed, ev)) {
+			notifiers = append(notifiers, n)
+		}
+	}
+	u.mutex.Unlock()
+
+	for _, n := range notifiers {
+		// Errors are reported when the connection is used next
+		n.w.WriteList(data)
+	}
+}
@@ -0,0 +1,307 @@
+package imapmemserver
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	gomessage "github.com/emersion/go-message"
+	"github.com/emersion/go-message/mail"
+)
+
+// searchCost is the amount of work needed to evaluate a search criterion.
+type searchCost int
+
+const (
+	searchCostMetadata searchCost = iota // sequence number, UID, flags, etc
+	searchCostHeader                     // parsing the message header
+	searchCostText                       // decoding the whole message
+)
+
+// searchMatcher matches messages against search criteria. Work which doesn't
+// depend on the message, such as lowercasing patterns, is done once for all
+// messages.
+type searchMatcher struct {
+	criteria *imap.SearchCriteria
+	header   []headerPattern
+	text     [][]byte // lowercase
+	body     [][]byte // lowercase
+	sub      []subMatcher
+	cost     searchCost
+}
+
+type headerPattern struct {
+	key   string
+	value string // lowercase
+}
+
+// subMatcher is a NOT or OR criterion.
+type subMatcher struct {
+	not  *searchMatcher
+	or   [2]*searchMatcher
+	cost searchCost
+}
+
+func newSearchMatcher(criteria *imap.SearchCriteria) *searchMatcher {
+	m := &searchMatcher{criteria: criteria}
+
+	for _, field := range criteria.Header {
+		m.header = append(m.header, headerPattern{
+			key:   field.Key,
+			value: strings.ToLower(field.Value),
+		})
+	}
+	if len(m.header) > 0 || !criteria.SentSince.IsZero() || !criteria.SentBefore.IsZero() {
+		m.cost = searchCostHeader
+	}
+
+	// Empty patterns match all messages
+	for _, text := range criteria.Text {
+		if text != "" {
+			m.text = append(m.text, []byte(strings.ToLower(text)))
+		}
+	}
+	for _, body := range criteria.Body {
+		if body != "" {
+			m.body = append(m.body, []byte(strings.ToLower(body)))
+		}
+	}
+	if len(m.text) > 0 || len(m.body) > 0 {
+		m.cost = searchCostText
+	}
+
+	for i := range criteria.Not {
+		not := newSearchMatcher(&criteria.Not[i])
+		m.sub = append(m.sub, subMatcher{not: not, cost: not.cost})
+	}
+	for i := range criteria.Or {
+		or := [2]*searchMatcher{
+			newSearchMatcher(&criteria.Or[i][0]),
+			newSearchMatcher(&criteria.Or[i][1]),
+		}
+		// Evaluate the cheapest criterion first, the other one can be
+		// skipped if it matches
+		if or[1].cost < or[0].cost {
+			or[0], or[1] = or[1], or[0]
+		}
+		m.sub = append(m.sub, subMatcher{or: or, cost: or[1].cost})
+	}
+	sort.SliceStable(m.sub, func(i, j int) bool {
+		return m.sub[i].cost < m.sub[j].cost
+	})
+	for _, sub := range m.sub {
+		if sub.cost > m.cost {
+			m.cost = sub.cost
+		}
+	}
+
+	return m
+}
+
+func (m *searchMatcher) match(msg *searchMessage) bool {
+	// NOT and OR criteria are evaluated as soon as the data they need has
+	// been checked for the other criteria
+	sub := m.sub
+	matchSub := func(cost searchCost) bool {
+		for len(sub) > 0 && sub[0].cost <= cost {
+			if !sub[0].match(msg) {
+				return false
+			}
+			sub = sub[1:]
+		}
+		return true
+	}
+
+	if !m.matchMetadata(msg) || !matchSub(searchCostMetadata) {
+		return false
+	}
+	if !m.matchHeader(msg) || !matchSub(searchCostHeader) {
+		return false
+	}
+	if !m.matchText(msg) || !matchSub(searchCostText) {
+		return false
+	}
+	return true
+}
+
+func (m *searchMatcher) matchMetadata(msg *searchMessage) bool {
+	criteria := m.criteria
+	for _, seqSet := range criteria.SeqNum {
+		if msg.seqNum == 0 || !seqSet.Contains(msg.seqNum) {
+			return false
+		}
+	}
+	for _, uidSet := range criteria.UID {
+		if !uidSet.Contains(msg.uid) {
+			return false
+		}
+	}
+	if !matchDate(msg.t, criteria.Since, criteria.Before) {
+		return false
+	}
+	now := time.Now()
+	if criteria.Older > 0 && msg.t.After(now.Add(-criteria.Older)) {
+		return false
+	}
+	if criteria.Younger > 0 && msg.t.Before(now.Add(-criteria.Younger)) {
+		return false
+	}
+	if criteria.ModSeq != nil && msg.modSeq < criteria.ModSeq.ModSeq {
+		return false
+	}
+	// Object IDs aren't supported, so no message has one
+	if len(criteria.EmailID) > 0 || len(criteria.ThreadID) > 0 {
+		return false
+	}
+
+	for _, flag := range criteria.Flag {
+		if _, ok := msg.flags[flag.Canonical()]; !ok {
+			return false
+		}
+	}
+	for _, flag := range criteria.NotFlag {
+		if _, ok := msg.flags[flag.Canonical()]; ok {
+			return false
+		}
+	}
+
+	if criteria.Larger != 0 && int64(len(msg.content.buf)) <= criteria.Larger {
+		return false
+	}
+	if criteria.Smaller != 0 && int64(len(msg.content.buf)) >= criteria.Smaller {
+		return false
+	}
+
+	return true
+}
+
+func (m *searchMatcher) matchHeader(msg *searchMessage) bool {
+	criteria := m.criteria
+	if len(m.header) == 0 && criteria.SentSince.IsZero() && criteria.SentBefore.IsZero() {
+		return true
+	}
+
+	header := mail.Header{Header: msg.entity().Header}
+
+	for _, pattern := range m.header {
+		if !matchHeaderFields(header.FieldsByKey(pattern.key), pattern.value) {
+			return false
+		}
+	}
+
+	if !criteria.SentSince.IsZero() || !criteria.SentBefore.IsZero() {
+		// Fall back to the internal date if the Date header field is
+		// missing or malformed
+		t, err := imap.ParseHeaderDate(header.Get("Date"))
+		if err != nil {
+			t = msg.t
+		}
+		if !matchDate(t, criteria.SentSince, criteria.SentBefore) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (m *searchMatcher) matchText(msg *searchMessage) bool {
+	if len(m.text) == 0 && len(m.body) == 0 {
+		return true
+	}
+
+	text := msg.text()
+	for _, pattern := range m.text {
+		if !text.MatchLower(pattern, true) {
+			return false
+		}
+	}
+	for _, pattern := range m.body {
+		if !text.MatchLower(pattern, false) {
+			return false
+		}
+	}
+	return true
+}
+
+func (sub *subMatcher) match(msg *searchMessage) bool {
+	if sub.not != nil {
+		return !sub.not.match(msg)
+	}
+	return sub.or[0].match(msg) || sub.or[1].match(msg)
+}
+
+// searchMessage is a message being searched. The message is parsed lazily,
+// at most once.
+type searchMessage struct {
+	*message
+	seqNum uint32
+
+	e       *gomessage.Entity
+	parsed  bool // e was parsed from the message, its body hasn't been read
+	msgText *imapserver.SearchText
+}
+
+func (msg *searchMessage) entity() *gomessage.Entity {
+	if msg.e == nil {
+		msg.e, _ = gomessage.Read(bytes.NewReader(msg.content.buf))
+		msg.parsed = msg.e != nil
+		if msg.e == nil {
+			msg.e = msg.reader()
+		}
+	}
+	return msg.e
+}
+
+func (msg *searchMessage) text() *imapserver.SearchText {
+	if msg.msgText != nil {
+		return msg.msgText
+	}
+	if e := msg.entity(); msg.parsed {
+		msg.parsed = false
+		if text, ok := imapserver.ExtractEntitySearchText(e); ok {
+			msg.msgText = text
+			return text
+		}
+	}
+	// Search the raw message if it can't be parsed
+	msg.msgText = imapserver.ExtractSearchText(bytes.NewReader(msg.content.buf))
+	return msg.msgText
+}
+
+func matchDate(t, since, before time.Time) bool {
+	// We discard time zone information by setting it to UTC.
+	// RFC 3501 explicitly requires zone unaware date comparison.
+	t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+
+	if !since.IsZero() && t.Before(since) {
+		return false
+	}
+	if !before.IsZero() && !t.Before(before) {
+		return false
+	}
+	return true
+}
+
+// matchHeaderFields checks whether a header field value contains a lowercase
+// pattern. An empty pattern matches if any field is present.
+//
+// The decoded value is matched first. The raw value is matched as well, since
+// some clients search for encoded-words and decoding may fail.
+func matchHeaderFields(fields gomessage.HeaderFields, pattern string) bool {
+	if pattern == "" {
+		return fields.Len() > 0
+	}
+
+	for fields.Next() {
+		if v, err := fields.Text(); err == nil && strings.Contains(strings.ToLower(v), pattern) {
+			return true
+		}
+		if strings.Contains(strings.ToLower(fields.Value()), pattern) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,338 @@
+package imapmemserver
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	gomessage "github.com/emersion/go-message"
+	"github.com/emersion/go-message/mail"
+)
+
+var searchTestWords = []string{"apple", "Banana", "cherry", "DATE", "élan", "fox", "Grape", "needle"}
+
+var searchTestFlags = []imap.Flag{imap.FlagSeen, imap.FlagFlagged, imap.FlagDeleted, "$Junk"}
+
+var searchTestBaseTime = time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+func randomWord(r *rand.Rand) string {
+	return searchTestWords[r.Intn(len(searchTestWords))]
+}
+
+func randomSearchTestMessage(r *rand.Rand, i int) []byte {
+	var buf bytes.Buffer
+	date := searchTestBaseTime.AddDate(0, 0, r.Intn(10)-5)
+	switch r.Intn(6) {
+	case 0: // malformed Date header field
+		fmt.Fprintf(&buf, "Date: %v\r\n", randomWord(r))
+	case 1: // no Date header field
+	default:
+		fmt.Fprintf(&buf, "Date: %v\r\n", date.Format(time.RFC1123Z))
+	}
+	fmt.Fprintf(&buf, "From: %v <%v@example.org>\r\n", randomWord(r), strings.ToLower(randomWord(r)))
+	fmt.Fprintf(&buf, "Subject: Message %v about %v\r\n", i, randomWord(r))
+	if r.Intn(3) == 0 {
+		fmt.Fprintf(&buf, "X-Tag: %v\r\n", randomWord(r))
+	}
+
+	text := fmt.Sprintf("Hello %v and %v!\r\n", randomWord(r), randomWord(r))
+	switch r.Intn(5) {
+	case 0:
+		buf.WriteString("Content-Type: multipart/mixed; boundary=b\r\n\r\n")
+		buf.WriteString("--b\r\nContent-Type: text/plain\r\n\r\n" + text)
+		fmt.Fprintf(&buf, "--b\r\nContent-Type: application/octet-stream\r\nX-Part: %v\r\n\r\n%v\r\n", randomWord(r), randomWord(r))
+		fmt.Fprintf(&buf, "--b\r\nContent-Type: text/html\r\n\r\n<p>%v</p>\r\n", randomWord(r))
+		buf.WriteString("--b--\r\n")
+	case 1: // missing closing boundary
+		buf.WriteString("Content-Type: multipart/alternative; boundary=b\r\n\r\n")
+		buf.WriteString("--b\r\nContent-Type: text/plain\r\n\r\n" + text)
+	case 2:
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n")
+		buf.WriteString(strings.Replace(text, "é", "=C3=A9", -1))
+	case 3: // non-textual body
+		buf.WriteString("Content-Type: image/png\r\n\r\n" + text)
+	default:
+		buf.WriteString("\r\n" + text)
+	}
+	return buf.Bytes()
+}
+
+func randomSearchTestMessages(r *rand.Rand, n int) []*message {
+	msgs := make([]*message, n)
+	for i := range msgs {
+		var flags []imap.Flag
+		for _, flag := range searchTestFlags {
+			if r.Intn(2) == 0 {
+				flags = append(flags, flag)
+			}
+		}
+		msgs[i] = newMessage(newMessageContent(randomSearchTestMessage(r, i)), &imap.AppendOptions{
+			Time:  searchTestBaseTime.AddDate(0, 0, r.Intn(10)-5),
+			Flags: flags,
+		})
+		msgs[i].uid = imap.UID(i + 1)
+	}
+	return msgs
+}
+
+func randomSearchCriteria(r *rand.Rand, depth int) imap.SearchCriteria {
+	var criteria imap.SearchCriteria
+	randomPattern := func() string {
+		switch r.Intn(6) {
+		case 0:
+			return ""
+		case 1:
+			return strings.ToUpper(randomWord(r))
+		default:
+			return randomWord(r)
+		}
+	}
+	randomDate := func() time.Time {
+		t := searchTestBaseTime.AddDate(0, 0, r.Intn(10)-5)
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+
+	for n := 1 + r.Intn(3); n > 0; n-- {
+		switch r.Intn(12) {
+		case 0:
+			criteria.Flag = append(criteria.Flag, searchTestFlags[r.Intn(len(searchTestFlags))])
+		case 1:
+			criteria.NotFlag = append(criteria.NotFlag, searchTestFlags[r.Intn(len(searchTestFlags))])
+		case 2:
+			criteria.Text = append(criteria.Text, randomPattern())
+		case 3:
+			criteria.Body = append(criteria.Body, randomPattern())
+		case 4:
+			key := []string{"Subject", "From", "X-Tag", "X-Part"}[r.Intn(4)]
+			criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{Key: key, Value: randomPattern()})
+		case 5:
+			criteria.Since = randomDate()
+		case 6:
+			criteria.SentBefore = randomDate()
+		case 7:
+			criteria.Larger = int64(100 + r.Intn(300))
+		case 8:
+			start := uint32(1 + r.Intn(50))
+			criteria.SeqNum = append(criteria.SeqNum, imap.SeqSet{{Start: start, Stop: start + uint32(r.Intn(50))}})
+		case 9:
+			start := imap.UID(1 + r.Intn(50))
+			criteria.UID = append(criteria.UID, imap.UIDSet{{Start: start, Stop: start + imap.UID(r.Intn(50))}})
+		case 10:
+			if depth > 0 {
+				criteria.Not = append(criteria.Not, randomSearchCriteria(r, depth-1))
+			}
+		case 11:
+			if depth > 0 {
+				criteria.Or = append(criteria.Or, [2]imap.SearchCriteria{
+					randomSearchCriteria(r, depth-1),
+					randomSearchCriteria(r, depth-1),
+				})
+			}
+		}
+	}
+	return criteria
+}
+
+func TestSearchMatcher(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	msgs := randomSearchTestMessages(r, 100)
+
+	var matched, total int
+	for i := 0; i < 500; i++ {
+		criteria := randomSearchCriteria(r, 2)
+		matcher := newSearchMatcher(&criteria)
+		for j, msg := range msgs {
+			seqNum := uint32(j) + 1
+			want := referenceSearch(msg, seqNum, &criteria)
+			got := matcher.match(&searchMessage{message: msg, seqNum: seqNum})
+			if got != want {
+				t.Fatalf("match(%+v) for message %v = %v, want %v\n%s", criteria, msg.uid, got, want, msg.content.buf)
+			}
+			if got {
+				matched++
+			}
+			total++
+		}
+	}
+
+	// Make sure the random criteria aren't trivial
+	if matched == 0 || matched == total {
+		t.Errorf("%v of %v messages matched", matched, total)
+	}
+}
+
+func TestSearchMatcher_headerEncoding(t *testing.T) {
+	const raw = "Subject: =?UTF-8?Q?Caf=C3=A9_cr=C3=A8me?=\r\n" +
+		"X-Label: =?x-unknown?Q?caf=E9_noir?=\r\n" +
+		"Received: from a.example.org\r\n" +
+		"Received: from b.example.org\r\n" +
+		"\r\n" +
+		"Hello\r\n"
+	msg := newMessage(newMessageContent([]byte(raw)), &imap.AppendOptions{})
+
+	tests := []struct {
+		key, value string
+		want       bool
+	}{
+		// Decoded value
+		{"Subject", "café", true},
+		{"Subject", "CRÈME", true},
+		// Raw value
+		{"Subject", "=?utf-8?q?caf", true},
+		{"Subject", "C3=A8me", true},
+		{"Subject", "coffee", false},
+		// Undecodable charset
+		{"X-Label", "caf=E9_noir", true},
+		{"X-Label", "x-unknown", true},
+		{"X-Label", "café", false},
+		// Fields appearing multiple times
+		{"Received", "", true},
+		{"Received", "b.example.org", true},
+		{"X-Missing", "", false},
+	}
+	for _, tc := range tests {
+		criteria := imap.SearchCriteria{
+			Header: []imap.SearchCriteriaHeaderField{{Key: tc.key, Value: tc.value}},
+		}
+		got := newSearchMatcher(&criteria).match(&searchMessage{message: msg, seqNum: 1})
+		if got != tc.want {
+			t.Errorf("HEADER %v %q = %v, want %v", tc.key, tc.value, got, tc.want)
+		}
+	}
+}
+
+func BenchmarkSearch(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	msgs := randomSearchTestMessages(r, 10000)
+	criteria := imap.SearchCriteria{
+		NotFlag: []imap.Flag{imap.FlagDeleted},
+		Text:    []string{"Needle", "hello"},
+		Or: [][2]imap.SearchCriteria{{
+			{Body: []string{"apple"}},
+			{Flag: []imap.Flag{imap.FlagSeen}},
+		}},
+	}
+
+	b.Run("matcher", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			matcher := newSearchMatcher(&criteria)
+			for j, msg := range msgs {
+				matcher.match(&searchMessage{message: msg, seqNum: uint32(j) + 1})
+			}
+		}
+	})
+	b.Run("reference", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for j, msg := range msgs {
+				referenceSearch(msg, uint32(j)+1, &criteria)
+			}
+		}
+	})
+}
+
+// referenceSearch is the straightforward search implementation which
+// searchMatcher replaces: it parses the message once per criterion.
+func referenceSearch(msg *message, seqNum uint32, criteria *imap.SearchCriteria) bool {
+	for _, seqSet := range criteria.SeqNum {
+		if seqNum == 0 || !seqSet.Contains(seqNum) {
+			return false
+		}
+	}
+	for _, uidSet := range criteria.UID {
+		if !uidSet.Contains(msg.uid) {
+			return false
+		}
+	}
+	if !matchDate(msg.t, criteria.Since, criteria.Before) {
+		return false
+	}
+
+	for _, flag := range criteria.Flag {
+		if _, ok := msg.flags[flag.Canonical()]; !ok {
+			return false
+		}
+	}
+	for _, flag := range criteria.NotFlag {
+		if _, ok := msg.flags[flag.Canonical()]; ok {
+			return false
+		}
+	}
+
+	if criteria.Larger != 0 && int64(len(msg.content.buf)) <= criteria.Larger {
+		return false
+	}
+	if criteria.Smaller != 0 && int64(len(msg.content.buf)) >= criteria.Smaller {
+		return false
+	}
+
+	header := mail.Header{Header: msg.reader().Header}
+
+	for _, fieldCriteria := range criteria.Header {
+		if !referenceMatchHeaderFields(header.FieldsByKey(fieldCriteria.Key), fieldCriteria.Value) {
+			return false
+		}
+	}
+
+	if !criteria.SentSince.IsZero() || !criteria.SentBefore.IsZero() {
+		// Fall back to the internal date if the Date header field is
+		// missing or malformed
+		t, err := imap.ParseHeaderDate(header.Get("Date"))
+		if err != nil {
+			t = msg.t
+		}
+		if !matchDate(t, criteria.SentSince, criteria.SentBefore) {
+			return false
+		}
+	}
+
+	for _, text := range criteria.Text {
+		if !referenceMatchText(msg, text, true) {
+			return false
+		}
+	}
+	for _, body := range criteria.Body {
+		if !referenceMatchText(msg, body, false) {
+			return false
+		}
+	}
+
+	for _, not := range criteria.Not {
+		if referenceSearch(msg, seqNum, &not) {
+			return false
+		}
+	}
+	for _, or := range criteria.Or {
+		if !referenceSearch(msg, seqNum, &or[0]) && !referenceSearch(msg, seqNum, &or[1]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func referenceMatchHeaderFields(fields gomessage.HeaderFields, pattern string) bool {
+	if pattern == "" {
+		return fields.Len() > 0
+	}
+
+	pattern = strings.ToLower(pattern)
+	for fields.Next() {
+		v, _ := fields.Text()
+		if strings.Contains(strings.ToLower(v), pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// referenceMatchText extracts the message text for each criterion. The
+// extraction itself is tested in imapserver.
+func referenceMatchText(msg *message, pattern string, includeHeader bool) bool {
+	text := imapserver.ExtractSearchText(bytes.NewReader(msg.content.buf))
+	return text.Match(pattern, includeHeader)
+}
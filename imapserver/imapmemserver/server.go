@@ -34,8 +34,12 @@ func (s *Server) user(username string) *User {
 }
 
 // AddUser adds a user to the server.
+//
+// Users added to the same server can share mailboxes with each other via
+// ACLs.
 func (s *Server) AddUser(user *User) {
 	s.mutex.Lock()
+	user.server = s
 	s.users[user.username] = user
 	s.mutex.Unlock()
 }
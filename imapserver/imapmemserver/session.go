@@ -17,9 +17,18 @@ type (
 type UserSession struct {
 	*user    // immutable
 	*mailbox // may be nil
+
+	rights   imap.RightSet // rights on the selected mailbox
+	notifier *notifier     // may be nil
 }
 
-var _ imapserver.SessionIMAP4rev2 = (*UserSession)(nil)
+var (
+	_ imapserver.SessionIMAP4rev2   = (*UserSession)(nil)
+	_ imapserver.SessionACL         = (*UserSession)(nil)
+	_ imapserver.SessionQResync     = (*UserSession)(nil)
+	_ imapserver.SessionNotify      = (*UserSession)(nil)
+	_ imapserver.SessionMultiAppend = (*UserSession)(nil)
+)
 
 // NewUserSession creates a new user session.
 func NewUserSession(user *User) *UserSession {
@@ -30,34 +39,75 @@ func (sess *UserSession) Close() error {
 	if sess != nil && sess.mailbox != nil {
 		sess.mailbox.Close()
 	}
+	if sess != nil {
+		sess.user.removeNotifier(sess.notifier)
+	}
 	return nil
 }
 
 func (sess *UserSession) Select(name string, options *imap.SelectOptions) (*imap.SelectData, error) {
-	mbox, err := sess.user.mailbox(name)
+	mbox, _, rights, err := sess.user.aclMailbox(name)
 	if err != nil {
 		return nil, err
+	} else if !rights.Has(imap.RightRead) {
+		return nil, errNoPerm
 	}
 	mbox.mutex.Lock()
 	defer mbox.mutex.Unlock()
 	sess.mailbox = mbox.NewView()
+	sess.rights = rights
+	if sess.notifier != nil {
+		sess.notifier.setSelected(mbox)
+	}
 	return mbox.selectDataLocked(), nil
 }
 
 func (sess *UserSession) Unselect() error {
 	sess.mailbox.Close()
 	sess.mailbox = nil
+	sess.rights = nil
+	if sess.notifier != nil {
+		sess.notifier.setSelected(nil)
+	}
+	return nil
+}
+
+func (sess *UserSession) Store(w *imapserver.FetchWriter, numSet imap.NumSet, flags *imap.StoreFlags, options *imap.StoreOptions) error {
+	if !sess.rights.Contains(storeRights(flags.Flags)) {
+		return errNoPerm
+	}
+	if err := sess.mailbox.Store(w, numSet, flags, options); err != nil {
+		return err
+	}
+	sess.user.notifyMailboxChange(sess.mailbox.Mailbox, imap.NotifyEventFlagChange)
+	return nil
+}
+
+func (sess *UserSession) Fetch(w *imapserver.FetchWriter, numSet imap.NumSet, options *imap.FetchOptions) error {
+	if err := sess.mailbox.Fetch(w, numSet, options); err != nil {
+		return err
+	}
+	if options.MarksSeen() {
+		sess.user.notifyMailboxChange(sess.mailbox.Mailbox, imap.NotifyEventFlagChange)
+	}
+	return nil
+}
+
+func (sess *UserSession) Expunge(w *imapserver.ExpungeWriter, uids *imap.UIDSet) error {
+	if !sess.rights.Has(imap.RightExpunge) {
+		return errNoPerm
+	}
+	if err := sess.mailbox.Expunge(w, uids); err != nil {
+		return err
+	}
+	sess.user.notifyMailboxChange(sess.mailbox.Mailbox, imap.NotifyEventMessageExpunge)
 	return nil
 }
 
 func (sess *UserSession) Copy(numSet imap.NumSet, destName string) (*imap.CopyData, error) {
-	dest, err := sess.user.mailbox(destName)
+	dest, err := sess.user.appendMailbox(destName)
 	if err != nil {
-		return nil, &imap.Error{
-			Type: imap.StatusResponseTypeNo,
-			Code: imap.ResponseCodeTryCreate,
-			Text: "No such mailbox",
-		}
+		return nil, err
 	} else if sess.mailbox != nil && dest == sess.mailbox.Mailbox {
 		return nil, &imap.Error{
 			Type: imap.StatusResponseTypeNo,
@@ -71,6 +121,7 @@ func (sess *UserSession) Copy(numSet imap.NumSet, destName string) (*imap.CopyDa
 		sourceUIDs.AddNum(msg.uid)
 		destUIDs.AddNum(appendData.UID)
 	})
+	sess.user.notifyMailboxChange(dest, imap.NotifyEventMessageNew)
 
 	return &imap.CopyData{
 		UIDValidity: dest.uidValidity,
@@ -80,13 +131,12 @@ func (sess *UserSession) Copy(numSet imap.NumSet, destName string) (*imap.CopyDa
 }
 
 func (sess *UserSession) Move(w *imapserver.MoveWriter, numSet imap.NumSet, destName string) error {
-	dest, err := sess.user.mailbox(destName)
+	if !sess.rights.Contains(imap.RightSet{imap.RightDeleteMessages, imap.RightExpunge}) {
+		return errNoPerm
+	}
+	dest, err := sess.user.appendMailbox(destName)
 	if err != nil {
-		return &imap.Error{
-			Type: imap.StatusResponseTypeNo,
-			Code: imap.ResponseCodeTryCreate,
-			Text: "No such mailbox",
-		}
+		return err
 	} else if sess.mailbox != nil && dest == sess.mailbox.Mailbox {
 		return &imap.Error{
 			Type: imap.StatusResponseTypeNo,
@@ -94,6 +144,10 @@ func (sess *UserSession) Move(w *imapserver.MoveWriter, numSet imap.NumSet, dest
 		}
 	}
 
+	// Deferred calls run once the mailbox is unlocked
+	defer sess.user.notifyMailboxChange(sess.mailbox.Mailbox, imap.NotifyEventMessageExpunge)
+	defer sess.user.notifyMailboxChange(dest, imap.NotifyEventMessageNew)
+
 	sess.mailbox.mutex.Lock()
 	defer sess.mailbox.mutex.Unlock()
 
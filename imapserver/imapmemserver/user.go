@@ -2,6 +2,8 @@ package imapmemserver
 
 import (
 	"crypto/subtle"
+	"fmt"
+	"io"
 	"sort"
 	"strings"
 	"sync"
@@ -12,12 +14,26 @@ import (
 
 const mailboxDelim rune = '/'
 
+var errNoSuchMailbox = &imap.Error{
+	Type: imap.StatusResponseTypeNo,
+	Code: imap.ResponseCodeNonExistent,
+	Text: "No such mailbox",
+}
+
 type User struct {
 	username, password string
+	server             *Server // may be nil
 
 	mutex           sync.Mutex
 	mailboxes       map[string]*Mailbox
 	prevUidValidity uint32
+	notifiers       map[*notifier]struct{}
+	contents        *contentStore // nil if deduplication is disabled
+	// Subscriptions to mailboxes of other users. Subscriptions to the user's
+	// own mailboxes are stored in the mailboxes.
+	otherSubscriptions map[string]struct{}
+	appendLimit        uint32 // zero if unlimited
+	multiAppendLimit   int64  // zero if unlimited
 }
 
 func NewUser(username, password string) *User {
@@ -28,6 +44,97 @@ func NewUser(username, password string) *User {
 	}
 }
 
+// SetDeduplicate enables or disables deduplication of appended messages.
+//
+// When enabled, a message appended with the same contents as an existing
+// message of the user shares its storage. Flags, UIDs and internal dates
+// remain separate.
+func (u *User) SetDeduplicate(enabled bool) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if !enabled {
+		u.contents = nil
+	} else if u.contents == nil {
+		u.contents = newContentStore()
+	}
+}
+
+// SetAppendLimit sets the maximum size of a message appended to a mailbox.
+// Zero means unlimited.
+//
+// The limit is reported in STATUS APPENDLIMIT responses.
+func (u *User) SetAppendLimit(limit uint32) {
+	u.mutex.Lock()
+	u.appendLimit = limit
+	u.mutex.Unlock()
+}
+
+// SetMultiAppendLimit sets the maximum total size of the messages appended
+// with a single APPEND command. Zero means unlimited.
+func (u *User) SetMultiAppendLimit(limit int64) {
+	u.mutex.Lock()
+	u.multiAppendLimit = limit
+	u.mutex.Unlock()
+}
+
+func (u *User) appendLimits() (limit uint32, multiLimit int64) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return u.appendLimit, u.multiAppendLimit
+}
+
+func errAppendTooBig(limit int64) error {
+	return &imap.Error{
+		Type: imap.StatusResponseTypeNo,
+		Code: imap.ResponseCodeTooBig,
+		Text: fmt.Sprintf("Messages are limited to %v bytes", limit),
+	}
+}
+
+// StorageStats contains statistics about the storage used by messages.
+type StorageStats struct {
+	// Sum of the sizes of all messages
+	LogicalBytes int64
+	// Sum of the sizes of the distinct message contents stored
+	UniqueBytes int64
+}
+
+// StorageStats returns statistics about the storage used by the messages of
+// the user.
+func (u *User) StorageStats() StorageStats {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	var stats StorageStats
+	seen := make(map[*messageContent]struct{})
+	for _, mbox := range u.mailboxes {
+		mbox.mutex.Lock()
+		for _, msg := range mbox.l {
+			size := int64(len(msg.content.buf))
+			stats.LogicalBytes += size
+			if _, ok := seen[msg.content]; !ok {
+				seen[msg.content] = struct{}{}
+				stats.UniqueBytes += size
+			}
+		}
+		mbox.mutex.Unlock()
+	}
+	return stats
+}
+
+// newMessageContent returns the content of a new message, deduplicated if
+// enabled. The caller holds a reference to the content.
+func (u *User) newMessageContent(buf []byte) *messageContent {
+	u.mutex.Lock()
+	contents := u.contents
+	u.mutex.Unlock()
+
+	if contents == nil {
+		return newMessageContent(buf)
+	}
+	return contents.get(buf)
+}
+
 func (u *User) Login(username, password string) error {
 	if username != u.username {
 		return imapserver.ErrAuthFailed
@@ -41,27 +148,34 @@ func (u *User) Login(username, password string) error {
 func (u *User) mailboxLocked(name string) (*Mailbox, error) {
 	mbox := u.mailboxes[name]
 	if mbox == nil {
-		return nil, &imap.Error{
-			Type: imap.StatusResponseTypeNo,
-			Code: imap.ResponseCodeNonExistent,
-			Text: "No such mailbox",
-		}
+		return nil, errNoSuchMailbox
 	}
 	return mbox, nil
 }
 
-func (u *User) mailbox(name string) (*Mailbox, error) {
+// mailbox looks up a mailbox. The required rights are only checked for
+// mailboxes of other users: users have all rights on their own mailboxes.
+func (u *User) mailbox(name string, required imap.RightSet) (*Mailbox, error) {
+	if u.isOtherUsersMailbox(name) {
+		mbox, _, err := u.otherUsersMailbox(name, required)
+		return mbox, err
+	}
+
 	u.mutex.Lock()
 	defer u.mutex.Unlock()
 	return u.mailboxLocked(name)
 }
 
 func (u *User) Status(name string, options *imap.StatusOptions) (*imap.StatusData, error) {
-	mbox, err := u.mailbox(name)
+	mbox, err := u.mailbox(name, imap.RightSet{imap.RightRead})
 	if err != nil {
 		return nil, err
 	}
-	return mbox.StatusData(options), nil
+	data := mbox.StatusData(options)
+	if limit, _ := u.appendLimits(); options.AppendLimit && limit != 0 {
+		data.AppendLimit = &limit
+	}
+	return data, nil
 }
 
 func (u *User) List(w *imapserver.ListWriter, ref string, patterns []string, options *imap.ListOptions) error {
@@ -109,25 +223,95 @@ func (u *User) List(w *imapserver.ListWriter, ref string, patterns []string, opt
 	return nil
 }
 
-func (u *User) Append(mailbox string, r imap.LiteralReader, options *imap.AppendOptions) (*imap.AppendData, error) {
-	mbox, err := u.mailbox(mailbox)
-	if err != nil {
+// appendMailbox looks up the destination mailbox of APPEND, COPY or MOVE.
+func (u *User) appendMailbox(name string) (*Mailbox, error) {
+	mbox, err := u.mailbox(name, imap.RightSet{imap.RightInsert})
+	if err == errNoSuchMailbox {
 		return nil, &imap.Error{
 			Type: imap.StatusResponseTypeNo,
 			Code: imap.ResponseCodeTryCreate,
 			Text: "No such mailbox",
 		}
 	}
-	return mbox.appendLiteral(r, options)
+	return mbox, err
 }
 
-func (u *User) Create(name string, options *imap.CreateOptions) error {
-	u.mutex.Lock()
-	defer u.mutex.Unlock()
+func (u *User) Append(mailbox string, r imap.LiteralReader, options *imap.AppendOptions) (*imap.AppendData, error) {
+	mbox, err := u.appendMailbox(mailbox)
+	if err != nil {
+		return nil, err
+	}
+	if limit, _ := u.appendLimits(); limit != 0 && r.Size() > int64(limit) {
+		return nil, errAppendTooBig(int64(limit))
+	}
+	buf, err := readLiteral(r)
+	if err != nil {
+		return nil, err
+	}
+	msg := newMessage(u.newMessageContent(buf), options)
+	data := mbox.appendMessages([]*message{msg})
+	u.notifyMailboxChange(mbox, imap.NotifyEventMessageNew)
+	return data, nil
+}
 
+func (u *User) MultiAppend(mailbox string, r *imapserver.MultiAppendReader) (*imap.AppendData, error) {
+	mbox, err := u.appendMailbox(mailbox)
+	if err != nil {
+		return nil, err
+	}
+
+	limit, multiLimit := u.appendLimits()
+
+	// Read all messages before storing any, so that the command is atomic
+	var (
+		msgs      []*message
+		totalSize int64
+	)
+	releaseAll := func() {
+		for _, msg := range msgs {
+			msg.content.release()
+		}
+	}
+	for {
+		lit, options, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			releaseAll()
+			return nil, err
+		}
+		if limit != 0 && lit.Size() > int64(limit) {
+			releaseAll()
+			return nil, errAppendTooBig(int64(limit))
+		}
+		totalSize += lit.Size()
+		if multiLimit != 0 && totalSize > multiLimit {
+			releaseAll()
+			return nil, &imap.Error{
+				Type: imap.StatusResponseTypeNo,
+				Code: imap.ResponseCodeTooBig,
+				Text: fmt.Sprintf("Appended messages are limited to %v bytes in total", multiLimit),
+			}
+		}
+		buf, err := readLiteral(lit)
+		if err != nil {
+			releaseAll()
+			return nil, err
+		}
+		msgs = append(msgs, newMessage(u.newMessageContent(buf), options))
+	}
+
+	data := mbox.appendMessages(msgs)
+	u.notifyMailboxChange(mbox, imap.NotifyEventMessageNew)
+	return data, nil
+}
+
+func (u *User) Create(name string, options *imap.CreateOptions) error {
 	name = strings.TrimRight(name, string(mailboxDelim))
 
+	u.mutex.Lock()
 	if u.mailboxes[name] != nil {
+		u.mutex.Unlock()
 		return &imap.Error{
 			Type: imap.StatusResponseTypeNo,
 			Code: imap.ResponseCodeAlreadyExists,
@@ -138,34 +322,48 @@ func (u *User) Create(name string, options *imap.CreateOptions) error {
 	// UIDVALIDITY must change if a mailbox is deleted and re-created with the
 	// same name.
 	u.prevUidValidity++
-	u.mailboxes[name] = NewMailbox(name, u.prevUidValidity)
+	mbox := NewMailbox(name, u.prevUidValidity)
+	if options != nil {
+		mbox.specialUse = options.SpecialUse
+	}
+	u.mailboxes[name] = mbox
+	u.mutex.Unlock()
+
+	u.notifyList(mbox.list(&imap.ListOptions{}), imap.NotifyEventMailboxName)
 	return nil
 }
 
 func (u *User) Delete(name string) error {
 	u.mutex.Lock()
-	defer u.mutex.Unlock()
-
-	if _, err := u.mailboxLocked(name); err != nil {
+	mbox, err := u.mailboxLocked(name)
+	if err != nil {
+		u.mutex.Unlock()
 		return err
 	}
 
 	delete(u.mailboxes, name)
+	u.mutex.Unlock()
+
+	data := mbox.list(&imap.ListOptions{})
+	data.Attrs = []imap.MailboxAttr{imap.MailboxAttrNonExistent}
+	mbox.releaseAll()
+
+	u.notifyList(data, imap.NotifyEventMailboxName)
 	return nil
 }
 
 func (u *User) Rename(oldName, newName string) error {
-	u.mutex.Lock()
-	defer u.mutex.Unlock()
-
 	newName = strings.TrimRight(newName, string(mailboxDelim))
 
+	u.mutex.Lock()
 	mbox, err := u.mailboxLocked(oldName)
 	if err != nil {
+		u.mutex.Unlock()
 		return err
 	}
 
 	if u.mailboxes[newName] != nil {
+		u.mutex.Unlock()
 		return &imap.Error{
 			Type: imap.StatusResponseTypeNo,
 			Code: imap.ResponseCodeAlreadyExists,
@@ -176,29 +374,53 @@ func (u *User) Rename(oldName, newName string) error {
 	mbox.rename(newName)
 	u.mailboxes[newName] = mbox
 	delete(u.mailboxes, oldName)
+	u.mutex.Unlock()
+
+	data := mbox.list(&imap.ListOptions{})
+	data.OldName = oldName
+	u.notifyList(data, imap.NotifyEventMailboxName)
 	return nil
 }
 
 func (u *User) Subscribe(name string) error {
-	mbox, err := u.mailbox(name)
-	if err != nil {
-		return err
-	}
-	mbox.SetSubscribed(true)
-	return nil
+	return u.setSubscribed(name, true)
 }
 
 func (u *User) Unsubscribe(name string) error {
-	mbox, err := u.mailbox(name)
+	return u.setSubscribed(name, false)
+}
+
+func (u *User) setSubscribed(name string, subscribed bool) error {
+	mbox, err := u.mailbox(name, imap.RightSet{imap.RightRead})
 	if err != nil {
 		return err
 	}
-	mbox.SetSubscribed(false)
+	if !u.isOtherUsersMailbox(name) {
+		mbox.SetSubscribed(subscribed)
+		u.notifyList(mbox.list(&imap.ListOptions{}), imap.NotifyEventSubscriptionChange)
+		return nil
+	}
+
+	// Don't change the subscription state of the owner
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if !subscribed {
+		delete(u.otherSubscriptions, name)
+		return nil
+	}
+	if u.otherSubscriptions == nil {
+		u.otherSubscriptions = make(map[string]struct{})
+	}
+	u.otherSubscriptions[name] = struct{}{}
 	return nil
 }
 
 func (u *User) Namespace() (*imap.NamespaceData, error) {
-	return &imap.NamespaceData{
+	data := imap.NamespaceData{
 		Personal: []imap.NamespaceDescriptor{{Delim: mailboxDelim}},
-	}, nil
+	}
+	if u.server != nil {
+		data.Other = []imap.NamespaceDescriptor{{Prefix: otherUsersPrefix, Delim: mailboxDelim}}
+	}
+	return &data, nil
 }
@@ -6,7 +6,6 @@ import (
 
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
-	"github.com/emersion/go-imap/v2/internal/utf7"
 )
 
 func (c *Conn) handleList(dec *imapwire.Decoder) error {
@@ -136,6 +135,8 @@ func readListCmd(dec *imapwire.Decoder) (ref string, patterns []string, options
 			options.SelectRemote = true
 		case "RECURSIVEMATCH":
 			options.SelectRecursiveMatch = true
+		case "SPECIAL-USE":
+			options.SelectSpecialUse = true
 		default:
 			return newClientBugError("Unknown LIST select option")
 		}
@@ -205,7 +206,7 @@ func readListMailbox(dec *imapwire.Decoder) (string, error) {
 			return "", dec.Err()
 		}
 	}
-	return utf7.Decode(mailbox)
+	return imap.DecodeMailboxName(mailbox)
 }
 
 func isListChar(ch byte) bool {
@@ -230,6 +231,8 @@ func readReturnOption(dec *imapwire.Decoder, options *imap.ListOptions, recent *
 		options.ReturnSubscribed = true
 	case "CHILDREN":
 		options.ReturnChildren = true
+	case "SPECIAL-USE":
+		options.ReturnSpecialUse = true
 	case "STATUS":
 		if !dec.ExpectSP() {
 			return dec.Err()
@@ -1,6 +1,7 @@
 package imapserver_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/emersion/go-imap/v2/imapserver"
@@ -49,3 +50,31 @@ func TestMatchList(t *testing.T) {
 		}
 	}
 }
+
+func TestConn_List_mailboxNameUTF8(t *testing.T) {
+	conn := newTestConn(t)
+	conn.expectOK("C", "C CREATE \"&U,BTFw- \\\"x\\\"\"\r\n")
+
+	untagged, _ := conn.execLines("L", "L LIST \"\" \"&U,BTFw-*\"\r\n")
+	if want := `"&U,BTFw- \"x\""`; len(untagged) != 1 || !strings.HasSuffix(untagged[0], want) {
+		t.Errorf("LIST returned %q, want a name encoded as %v", untagged, want)
+	}
+
+	// Mailbox names are sent and received as raw UTF-8 once enabled
+	conn.expectOK("E", "E ENABLE UTF8=ACCEPT\r\n")
+	conn.expectOK("C", "C CREATE \"日本語\"\r\n")
+	untagged, _ = conn.execLines("L", "L LIST \"\" \"*語\"\r\n")
+	if want := `"日本語"`; len(untagged) != 1 || !strings.HasSuffix(untagged[0], want) {
+		t.Errorf("LIST returned %q, want a name encoded as %v", untagged, want)
+	}
+	// Names aren't decoded as modified UTF-7, only "&" is escaped
+	conn.expectOK("C", "C CREATE \"&Jjo-\"\r\n")
+	untagged, _ = conn.execLines("L", "L LIST \"\" \"&-*\"\r\n")
+	if want := `"&-Jjo-"`; len(untagged) != 1 || !strings.HasSuffix(untagged[0], want) {
+		t.Errorf("LIST returned %q, want a name encoded as %v", untagged, want)
+	}
+	untagged, _ = conn.execLines("L", "L LIST \"\" \"台北*\"\r\n")
+	if want := `"台北 \"x\""`; len(untagged) != 1 || !strings.HasSuffix(untagged[0], want) {
+		t.Errorf("LIST returned %q, want a name encoded as %v", untagged, want)
+	}
+}
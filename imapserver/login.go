@@ -21,8 +21,9 @@ func (c *Conn) handleLogin(tag string, dec *imapwire.Decoder) error {
 		}
 	}
 	if err := c.session.Login(username, password); err != nil {
-		return err
+		return c.authFailed(tag, username, err)
 	}
+	c.authSucceeded(username)
 	c.state = imap.ConnStateAuthenticated
 	return c.writeCapabilityStatus(tag, imap.StatusResponseTypeOK, "Logged in")
 }
@@ -3,8 +3,12 @@ package imapserver
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"io"
+	"mime"
+	"os"
 	"strings"
+	"sync"
 
 	gomessage "github.com/emersion/go-message"
 	"github.com/emersion/go-message/mail"
@@ -15,14 +19,26 @@ import (
 
 // ExtractBodySection extracts a section of a message body.
 //
+// If the section is partial, only the requested bytes are kept in memory. If
+// r is an io.ReadSeeker, the data preceding a partial section of the whole
+// message or of the message text is skipped without being read.
+//
 // It can be used by server backends to implement Session.Fetch.
 func ExtractBodySection(r io.Reader, item *imap.FetchItemBodySection) []byte {
+	if rs, ok := r.(io.ReadSeeker); ok && item.Partial != nil {
+		if b, ok := extractBodySectionSeek(rs, item); ok {
+			return b
+		}
+	}
+
 	var (
 		header textproto.Header
 		body   io.Reader
 	)
 
-	br := bufio.NewReader(r)
+	br := getBufioReader(r)
+	defer putBufioReader(br)
+
 	header, err := textproto.ReadHeader(br)
 	if err != nil {
 		return nil
@@ -37,55 +53,213 @@ func ExtractBodySection(r io.Reader, item *imap.FetchItemBodySection) []byte {
 	if len(item.Part) > 0 {
 		switch item.Specifier {
 		case imap.PartSpecifierHeader, imap.PartSpecifierText:
-			header, body = openMessagePart(header, body, parentMediaType)
+			// HEADER and TEXT only apply to message parts, the header of
+			// other parts is fetched with MIME
+			var ok bool
+			header, body, ok = openMessagePart(header, body, parentMediaType)
+			if !ok {
+				return nil
+			}
 		}
 	}
 
-	// Filter header fields
-	if len(item.HeaderFields) > 0 {
-		keep := make(map[string]struct{})
-		for _, k := range item.HeaderFields {
-			keep[strings.ToLower(k)] = struct{}{}
+	return extractPartial(item.Partial, func(w io.Writer) error {
+		writeHeader := true
+		switch item.Specifier {
+		case imap.PartSpecifierNone:
+			writeHeader = len(item.Part) == 0
+		case imap.PartSpecifierText:
+			writeHeader = false
 		}
-		for field := header.Fields(); field.Next(); {
-			if _, ok := keep[strings.ToLower(field.Key())]; !ok {
-				field.Del()
+		if writeHeader && (len(item.HeaderFields) > 0 || len(item.HeaderFieldsNot) > 0) {
+			if err := writeHeaderFields(w, header, item.HeaderFields, item.HeaderFieldsNot); err != nil {
+				return err
+			}
+		} else if writeHeader {
+			if err := textproto.WriteHeader(w, header); err != nil {
+				return err
 			}
 		}
-	}
-	for _, k := range item.HeaderFieldsNot {
-		header.Del(k)
+
+		switch item.Specifier {
+		case imap.PartSpecifierNone, imap.PartSpecifierText:
+			if _, err := io.Copy(w, body); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// writeHeaderFields writes the header fields listed in fields, or the ones
+// not listed in fieldsNot, followed by the blank line terminating the header.
+//
+// Fields are written in their original order, with their raw bytes: folding,
+// whitespace and key capitalization are left untouched, which is required for
+// e.g. DKIM verification by clients.
+func writeHeaderFields(w io.Writer, header textproto.Header, fields, fieldsNot []string) error {
+	keep := headerKeySet(fields)
+	drop := headerKeySet(fieldsNot)
+
+	for field := header.Fields(); field.Next(); {
+		k := strings.ToLower(field.Key())
+		if _, ok := keep[k]; len(keep) > 0 && !ok {
+			continue
+		}
+		if _, ok := drop[k]; ok {
+			continue
+		}
+		raw, err := field.Raw()
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(raw); err != nil {
+			return err
+		}
 	}
 
-	// Write the requested data to a buffer
-	var buf bytes.Buffer
+	_, err := io.WriteString(w, "\r\n")
+	return err
+}
 
-	writeHeader := true
-	switch item.Specifier {
-	case imap.PartSpecifierNone:
-		writeHeader = len(item.Part) == 0
-	case imap.PartSpecifierText:
-		writeHeader = false
+func headerKeySet(keys []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(keys))
+	for _, k := range keys {
+		set[strings.ToLower(k)] = struct{}{}
 	}
-	if writeHeader {
-		if err := textproto.WriteHeader(&buf, header); err != nil {
-			return nil
+	return set
+}
+
+// RawMessage provides random access to the raw contents of a message.
+//
+// It can be passed to FetchResponseWriter.WriteRawMessageSection to send
+// sections of the message without copying them to memory.
+type RawMessage struct {
+	r    io.ReaderAt
+	size int64
+
+	headerOnce sync.Once
+	headerSize int64
+	headerErr  error
+}
+
+// NewRawMessage creates a new raw message of size bytes read from r.
+//
+// If r is an *os.File, its offset is used to copy data, which allows the
+// kernel to send it straight to the connection. In that case the file must
+// not be used concurrently.
+func NewRawMessage(r io.ReaderAt, size int64) *RawMessage {
+	return &RawMessage{r: r, size: size}
+}
+
+// Size returns the size of the message, as sent by RFC822.SIZE.
+func (msg *RawMessage) Size() int64 {
+	return msg.size
+}
+
+// HeaderSize returns the size of the message header, including the empty
+// line separating it from the body. The header is only parsed once.
+func (msg *RawMessage) HeaderSize() (int64, error) {
+	msg.headerOnce.Do(func() {
+		cr := &countingReader{r: io.NewSectionReader(msg.r, 0, msg.size)}
+		br := getBufioReader(cr)
+		defer putBufioReader(br)
+
+		if _, err := textproto.ReadHeader(br); err != nil {
+			msg.headerErr = err
+			return
+		}
+		msg.headerSize = cr.n - int64(br.Buffered())
+	})
+	return msg.headerSize, msg.headerErr
+}
+
+// reader returns a reader for n bytes starting at offset.
+func (msg *RawMessage) reader(offset, n int64) (io.Reader, error) {
+	if f, ok := msg.r.(*os.File); ok {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
 		}
+		return &io.LimitedReader{R: f, N: n}, nil
+	}
+	return io.NewSectionReader(msg.r, offset, n), nil
+}
+
+// extractBodySectionSeek extracts a partial section by seeking to its start,
+// if the section is the whole message or its text. Otherwise, false is
+// returned and the read offset of rs is left unchanged.
+func extractBodySectionSeek(rs io.ReadSeeker, item *imap.FetchItemBodySection) ([]byte, bool) {
+	isWhole := len(item.Part) == 0 && item.Specifier == imap.PartSpecifierNone
+	isText := (len(item.Part) == 0 && item.Specifier == imap.PartSpecifierText) ||
+		(len(item.Part) == 1 && item.Part[0] == 1 && item.Specifier == imap.PartSpecifierNone)
+	if !isWhole && !isText {
+		return nil, false
+	}
+
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, false
 	}
 
-	switch item.Specifier {
-	case imap.PartSpecifierNone, imap.PartSpecifierText:
-		if _, err := io.Copy(&buf, body); err != nil {
-			return nil
+	sectionStart := start
+	if isText {
+		cr := &countingReader{r: rs}
+		br := getBufioReader(cr)
+		defer putBufioReader(br)
+
+		header, err := textproto.ReadHeader(br)
+		if err != nil {
+			rs.Seek(start, io.SeekStart)
+			return nil, false
 		}
+		// The first part of a multipart message isn't the message text
+		msgHeader := gomessage.Header{Header: header}
+		mediaType, _, _ := msgHeader.ContentType()
+		if len(item.Part) > 0 && strings.HasPrefix(mediaType, "multipart/") {
+			rs.Seek(start, io.SeekStart)
+			return nil, false
+		}
+		sectionStart += cr.n - int64(br.Buffered())
+	}
+
+	end, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, false
+	}
+
+	offset := sectionStart + item.Partial.Offset
+	if offset >= end {
+		// An empty string is returned if the offset is past the end
+		return []byte{}, true
+	}
+	size := item.Partial.Size
+	if size > end-offset {
+		size = end - offset
 	}
+	if _, err := rs.Seek(offset, io.SeekStart); err != nil {
+		return nil, true
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(rs, b); err != nil {
+		return nil, true
+	}
+	return b, true
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
 
-	return extractPartial(buf.Bytes(), item.Partial)
+func (cr *countingReader) Read(b []byte) (int, error) {
+	n, err := cr.r.Read(b)
+	cr.n += int64(n)
+	return n, err
 }
 
 func findMessagePart(header textproto.Header, body io.Reader, partPath []int) (string, textproto.Header, io.Reader) {
 	// First part of non-multipart message refers to the message itself
-	msgHeader := gomessage.Header{header}
+	msgHeader := gomessage.Header{Header: header}
 	mediaType, _, _ := msgHeader.ContentType()
 	if !strings.HasPrefix(mediaType, "multipart/") && len(partPath) > 0 && partPath[0] == 1 {
 		partPath = partPath[1:]
@@ -95,9 +269,9 @@ func findMessagePart(header textproto.Header, body io.Reader, partPath []int) (s
 	for i := 0; i < len(partPath); i++ {
 		partNum := partPath[i]
 
-		header, body = openMessagePart(header, body, parentMediaType)
+		header, body, _ = openMessagePart(header, body, parentMediaType)
 
-		msgHeader := gomessage.Header{header}
+		msgHeader := gomessage.Header{Header: header}
 		mediaType, typeParams, _ := msgHeader.ContentType()
 		if !strings.HasPrefix(mediaType, "multipart/") {
 			if partNum != 1 {
@@ -130,8 +304,11 @@ func findMessagePart(header textproto.Header, body io.Reader, partPath []int) (s
 	return parentMediaType, header, body
 }
 
-func openMessagePart(header textproto.Header, body io.Reader, parentMediaType string) (textproto.Header, io.Reader) {
-	msgHeader := gomessage.Header{header}
+// openMessagePart reads the header of the message contained in a
+// message/rfc822 part. If the part isn't a message, false is returned along
+// with the part itself.
+func openMessagePart(header textproto.Header, body io.Reader, parentMediaType string) (textproto.Header, io.Reader, bool) {
+	msgHeader := gomessage.Header{Header: header}
 	mediaType, _, _ := msgHeader.ContentType()
 	if !msgHeader.Has("Content-Type") && parentMediaType == "multipart/digest" {
 		mediaType = "message/rfc822"
@@ -139,77 +316,290 @@ func openMessagePart(header textproto.Header, body io.Reader, parentMediaType st
 	if mediaType == "message/rfc822" || mediaType == "message/global" {
 		br := bufio.NewReader(body)
 		header, _ = textproto.ReadHeader(br)
-		return header, br
+		return header, br, true
 	}
-	return header, body
+	return header, body, false
 }
 
-func extractPartial(b []byte, partial *imap.SectionPartial) []byte {
-	if partial == nil {
-		return b
+var errPartialDone = errors.New("imapserver: partial section complete")
+
+// extractPartial returns the bytes of a section written by f. If partial is
+// non-nil, only the requested bytes are kept in memory, and f is interrupted
+// once they've been written.
+func extractPartial(partial *imap.SectionPartial, f func(w io.Writer) error) []byte {
+	if partial != nil && partial.Size <= 0 {
+		return []byte{}
 	}
 
-	end := partial.Offset + partial.Size
-	if partial.Offset > int64(len(b)) {
+	buf := getBuffer()
+	var err error
+	if partial == nil {
+		err = f(buf)
+	} else {
+		pw := &partialWriter{w: buf, skip: partial.Offset, remaining: partial.Size}
+		if err = f(pw); err == errPartialDone {
+			err = nil
+		}
+	}
+	if err != nil {
+		putBuffer(buf)
 		return nil
 	}
-	if end > int64(len(b)) {
-		end = int64(len(b))
+
+	// Large buffers aren't put back into the pool, so their contents can be
+	// returned as-is. Otherwise the pooled buffer is reused, so its contents
+	// are copied out. An empty string is returned if the offset of a partial
+	// section is past the end.
+	if buf.Cap() > maxPooledBufferSize {
+		return buf.Bytes()
 	}
-	return b[partial.Offset:end]
+	b := make([]byte, buf.Len())
+	copy(b, buf.Bytes())
+	putBuffer(buf)
+	return b
+}
+
+// partialWriter discards the first skip bytes written to it, then forwards
+// remaining bytes to w. Once done, writes fail with errPartialDone.
+type partialWriter struct {
+	w               io.Writer
+	skip, remaining int64
 }
 
+func (pw *partialWriter) Write(b []byte) (int, error) {
+	n := len(b)
+	if pw.skip >= int64(n) {
+		pw.skip -= int64(n)
+		return n, nil
+	}
+	b = b[pw.skip:]
+	pw.skip = 0
+	if int64(len(b)) > pw.remaining {
+		b = b[:pw.remaining]
+	}
+	if _, err := pw.w.Write(b); err != nil {
+		return 0, err
+	}
+	pw.remaining -= int64(len(b))
+	if pw.remaining == 0 {
+		return n, errPartialDone
+	}
+	return n, nil
+}
+
+// ExtractBinarySection extracts a section of a message body, decoded
+// according to its Content-Transfer-Encoding.
+//
+// If the section is partial, only the requested bytes are kept in memory.
+//
+// It can be used by server backends to implement Session.Fetch.
 func ExtractBinarySection(r io.Reader, item *imap.FetchItemBinarySection) []byte {
-	var (
-		header textproto.Header
-		body   io.Reader
-	)
+	return extractPartial(item.Partial, func(w io.Writer) error {
+		return writeBinarySection(w, r, item.Part)
+	})
+}
+
+func writeBinarySection(w io.Writer, r io.Reader, partPath []int) error {
+	br := getBufioReader(r)
+	defer putBufioReader(br)
 
-	br := bufio.NewReader(r)
 	header, err := textproto.ReadHeader(br)
 	if err != nil {
-		return nil
+		return err
 	}
-	body = br
 
-	_, header, body = findMessagePart(header, body, item.Part)
+	_, header, body := findMessagePart(header, br, partPath)
 	if body == nil {
-		return nil
+		return errors.New("imapserver: message part not found")
 	}
 
-	part, err := gomessage.New(gomessage.Header{header}, body)
+	part, err := gomessage.New(gomessage.Header{Header: header}, body)
 	if err != nil {
-		return nil
+		return err
 	}
 
-	// Write the requested data to a buffer
-	var buf bytes.Buffer
+	if len(partPath) == 0 {
+		if err := textproto.WriteHeader(w, part.Header.Header); err != nil {
+			return err
+		}
+	}
 
-	if len(item.Part) == 0 {
-		if err := textproto.WriteHeader(&buf, part.Header.Header); err != nil {
-			return nil
+	_, err = io.Copy(w, part.Body)
+	return err
+}
+
+// ExtractBinarySectionSize returns the size of a section of a message body,
+// decoded according to its Content-Transfer-Encoding.
+//
+// The decoded section isn't kept in memory. If r is an io.ReadSeeker, the size
+// of base64-encoded parts is computed without decoding them.
+//
+// It can be used by server backends to implement Session.Fetch.
+func ExtractBinarySectionSize(r io.Reader, item *imap.FetchItemBinarySectionSize) uint32 {
+	if rs, ok := r.(io.ReadSeeker); ok {
+		start, err := rs.Seek(0, io.SeekCurrent)
+		if err == nil {
+			if n, ok := base64SectionSize(rs, item.Part); ok {
+				return uint32(n)
+			}
+			// Decode the section instead
+			if _, err := rs.Seek(start, io.SeekStart); err != nil {
+				return 0
+			}
 		}
 	}
 
-	if _, err := io.Copy(&buf, part.Body); err != nil {
-		return nil
+	var cw countingWriter
+	if err := writeBinarySection(&cw, r, item.Part); err != nil {
+		return 0
+	}
+	return uint32(cw.n)
+}
+
+// base64SectionSize computes the decoded size of a base64-encoded section by
+// counting the characters of its encoded form.
+//
+// False is returned if the section isn't base64-encoded, if a charset
+// conversion applies to it, or if the encoded data isn't well-formed. In that
+// case, the section needs to be decoded to get its size, since decoding may
+// fail midway or output different data.
+func base64SectionSize(r io.Reader, partPath []int) (int64, bool) {
+	br := getBufioReader(r)
+	defer putBufioReader(br)
+
+	header, err := textproto.ReadHeader(br)
+	if err != nil {
+		return 0, false
 	}
 
-	return extractPartial(buf.Bytes(), item.Partial)
+	_, header, body := findMessagePart(header, br, partPath)
+	if body == nil {
+		return 0, false
+	}
+
+	// Mirror the decoding done by gomessage.New
+	msgHeader := gomessage.Header{Header: header}
+	mediaType, mediaParams, _ := msgHeader.ContentType()
+	if strings.HasPrefix(mediaType, "multipart/") || strings.ToLower(header.Get("Content-Transfer-Encoding")) != "base64" {
+		return 0, false
+	}
+	if charset, ok := mediaParams["charset"]; ok && strings.HasPrefix(mediaType, "text/") {
+		switch strings.ToLower(charset) {
+		case "utf-8", "us-ascii":
+			// No conversion
+		default:
+			return 0, false
+		}
+	}
+
+	var n int64
+	if len(partPath) == 0 {
+		var cw countingWriter
+		if err := textproto.WriteHeader(&cw, header); err != nil {
+			return 0, false
+		}
+		n = cw.n
+	}
+
+	size, ok := decodedBase64Size(body)
+	return n + size, ok
 }
 
-func ExtractBinarySectionSize(r io.Reader, item *imap.FetchItemBinarySectionSize) uint32 {
-	// TODO: optimize
-	b := ExtractBinarySection(r, &imap.FetchItemBinarySection{Part: item.Part})
-	return uint32(len(b))
+// base64CharClass classifies the characters of base64-encoded data.
+var base64CharClass = func() (table [256]uint8) {
+	const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+	for i := 0; i < len(alphabet); i++ {
+		table[alphabet[i]] = base64Data
+	}
+	table['='] = base64Padding
+	for _, ch := range []byte("\r\n \t") {
+		table[ch] = base64Ignored
+	}
+	return table
+}()
+
+const (
+	base64Invalid uint8 = iota
+	base64Data
+	base64Padding
+	base64Ignored
+)
+
+// decodedBase64Size returns the number of bytes the base64 data read from r
+// decodes to. Line breaks, spaces and tabs are ignored. False is returned if
+// the data contains other characters, or isn't correctly padded.
+func decodedBase64Size(r io.Reader) (int64, bool) {
+	buf := getCopyBuffer()
+	defer putCopyBuffer(buf)
+
+	var chars, padding int64
+	for {
+		n, err := r.Read(*buf)
+		for _, ch := range (*buf)[:n] {
+			switch base64CharClass[ch] {
+			case base64Data:
+				if padding > 0 {
+					return 0, false // data after padding
+				}
+				chars++
+			case base64Padding:
+				padding++
+			case base64Invalid:
+				return 0, false
+			}
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, false
+		}
+	}
+
+	// Each group of 4 characters decodes to 3 bytes, the last group may be
+	// completed with 1 or 2 padding characters
+	if (chars+padding)%4 != 0 || padding > 2 {
+		return 0, false
+	}
+	return chars/4*3 + []int64{0, 0, 1, 2}[chars%4], true
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	cw.n += int64(len(b))
+	return len(b), nil
+}
+
+// ReadFrom implements io.ReaderFrom, so that io.Copy uses a pooled buffer.
+func (cw *countingWriter) ReadFrom(r io.Reader) (int64, error) {
+	buf := getCopyBuffer()
+	defer putCopyBuffer(buf)
+
+	var total int64
+	for {
+		n, err := r.Read(*buf)
+		total += int64(n)
+		cw.n += int64(n)
+		if err == io.EOF {
+			return total, nil
+		} else if err != nil {
+			return total, err
+		}
+	}
 }
 
 // ExtractEnvelope returns a message envelope from its header.
 //
+// Malformed address lists are parsed leniently. Addresses without a domain
+// have their host set to ".MISSING-HOST-NAME.", since an empty host denotes a
+// group marker.
+//
 // It can be used by server backends to implement Session.Fetch.
 func ExtractEnvelope(h textproto.Header) *imap.Envelope {
-	mh := mail.Header{gomessage.Header{h}}
-	date, _ := mh.Date()
+	mh := mail.Header{Header: gomessage.Header{Header: h}}
+	date, _ := imap.ParseHeaderDate(h.Get("Date"))
 	subject, _ := mh.Subject()
 	inReplyTo, _ := mh.MsgIDList("In-Reply-To")
 	messageID, _ := mh.MessageID()
@@ -227,35 +617,440 @@ func ExtractEnvelope(h textproto.Header) *imap.Envelope {
 	}
 }
 
+const (
+	// maxAddressListLen is the maximum length of an address list header
+	// field value parsed for the envelope. Addresses past this limit are
+	// ignored.
+	maxAddressListLen = 128 * 1024
+	// missingHost is the host of addresses without a domain. An empty host
+	// would indicate a group marker, see imap.Address.IsGroupStart.
+	missingHost = ".MISSING-HOST-NAME."
+)
+
 func parseAddressList(mh mail.Header, k string) []imap.Address {
-	// TODO: handle groups
-	addrs, _ := mh.AddressList(k)
+	v := mh.Get(k)
+	if len(v) > maxAddressListLen {
+		v = v[:maxAddressListLen]
+		if i := strings.LastIndexByte(v, ','); i >= 0 {
+			v = v[:i]
+		}
+	}
+
 	var l []imap.Address
-	for _, addr := range addrs {
-		mailbox, host, ok := strings.Cut(addr.Address, "@")
-		if !ok {
+	for _, part := range splitAddressGroups(v) {
+		if part.group {
+			l = append(l, imap.Address{Mailbox: decodePhrase(part.name)})
+		}
+		l = append(l, parseAddressGroupList(part.list)...)
+		if part.group {
+			l = append(l, imap.Address{})
+		}
+	}
+	return l
+}
+
+// parseAddressGroupList parses a list of addresses. If the list isn't
+// syntactically valid, it's split at commas and each address is parsed
+// leniently.
+func parseAddressGroupList(list string) []imap.Address {
+	var l []imap.Address
+	if addrs, err := mail.ParseAddressList(list); err == nil {
+		for _, addr := range addrs {
+			l = append(l, newEnvelopeAddress(addr.Name, addr.Address))
+		}
+		return l
+	}
+
+	// Commas in unquoted display names split them into items without an
+	// address, e.g. "Doe, John <john@example.org>": these are merged with
+	// the following angle-addr
+	var pending []string
+	flushPending := func() {
+		// Bare local parts, e.g. "undisclosed-recipients"
+		for _, item := range pending {
+			if addr, ok := parseLenientAddress(item); ok {
+				l = append(l, addr)
+			}
+		}
+		pending = nil
+	}
+	for _, item := range splitAddressItems(list) {
+		switch {
+		case strings.Contains(item, "<"):
+			if len(pending) > 0 {
+				item = strings.Join(pending, ", ") + ", " + item
+				pending = nil
+			}
+		case strings.Contains(item, "@"):
+			flushPending()
+		default:
+			pending = append(pending, item)
 			continue
 		}
-		l = append(l, imap.Address{
-			Name:    addr.Name,
-			Mailbox: mailbox,
-			Host:    host,
-		})
+		if addr, ok := parseLenientAddress(item); ok {
+			l = append(l, addr)
+		}
 	}
+	flushPending()
 	return l
 }
 
+// parseLenientAddress parses a single address which may not be syntactically
+// valid. False is returned if it doesn't contain a mailbox.
+func parseLenientAddress(s string) (imap.Address, bool) {
+	if addr, err := mail.ParseAddress(s); err == nil {
+		return newEnvelopeAddress(addr.Name, addr.Address), true
+	}
+
+	var name, spec string
+	if i := strings.IndexByte(s, '<'); i >= 0 {
+		name, spec = s[:i], s[i+1:]
+		if j := strings.IndexByte(spec, '>'); j >= 0 {
+			spec = spec[:j]
+		}
+		// Obsolete route-addr, e.g. "<@relay1,@relay2:john@example.org>"
+		if strings.HasPrefix(spec, "@") {
+			if _, addr, ok := strings.Cut(spec, ":"); ok {
+				spec = addr
+			}
+		}
+	} else {
+		spec = stripComments(s)
+	}
+
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return imap.Address{}, false
+	}
+	return newEnvelopeAddress(decodePhrase(name), spec), true
+}
+
+// newEnvelopeAddress splits an address into its mailbox and host.
+func newEnvelopeAddress(name, addr string) imap.Address {
+	mailbox, host := addr, ""
+	if i := strings.LastIndexByte(addr, '@'); i >= 0 {
+		mailbox, host = addr[:i], addr[i+1:]
+	}
+	if host == "" {
+		host = missingHost
+	}
+	return imap.Address{
+		Name:    name,
+		Mailbox: unquoteLocalPart(mailbox),
+		Host:    host,
+	}
+}
+
+// unquoteLocalPart removes the quotes around a quoted local part.
+func unquoteLocalPart(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	var sb strings.Builder
+	for i := 1; i < len(s)-1; i++ {
+		if s[i] == '\\' && i+1 < len(s)-1 {
+			i++
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// stripComments removes comments from a header field value.
+func stripComments(s string) string {
+	var (
+		sb         strings.Builder
+		inQuote    bool
+		commentLvl int
+	)
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case commentLvl > 0:
+			if ch == '\\' {
+				i++
+			} else if ch == '(' {
+				commentLvl++
+			} else if ch == ')' {
+				commentLvl--
+			}
+			continue
+		case inQuote:
+			if ch == '\\' && i+1 < len(s) {
+				sb.WriteByte(ch)
+				i++
+				ch = s[i]
+			} else if ch == '"' {
+				inQuote = false
+			}
+		case ch == '"':
+			inQuote = true
+		case ch == '(':
+			commentLvl++
+			continue
+		}
+		sb.WriteByte(ch)
+	}
+	return sb.String()
+}
+
+// splitAddressItems splits an address list at commas, outside of quoted
+// strings, comments and angle-addrs. Empty items are skipped.
+func splitAddressItems(list string) []string {
+	var (
+		items      []string
+		start      int
+		inQuote    bool
+		inAngle    bool
+		commentLvl int
+	)
+	appendItem := func(end int) {
+		if item := strings.TrimSpace(list[start:end]); item != "" {
+			items = append(items, item)
+		}
+	}
+	for i := 0; i < len(list); i++ {
+		ch := list[i]
+		switch {
+		case inQuote:
+			if ch == '\\' {
+				i++
+			} else if ch == '"' {
+				inQuote = false
+			}
+			continue
+		case commentLvl > 0:
+			if ch == '\\' {
+				i++
+			} else if ch == '(' {
+				commentLvl++
+			} else if ch == ')' {
+				commentLvl--
+			}
+			continue
+		}
+
+		switch ch {
+		case '"':
+			inQuote = true
+		case '(':
+			commentLvl++
+		case '<':
+			inAngle = angleAddrClosed(list[i+1:])
+		case '>':
+			inAngle = false
+		case ',':
+			if !inAngle {
+				appendItem(i)
+				start = i + 1
+			}
+		}
+	}
+	appendItem(len(list))
+	return items
+}
+
+// angleAddrClosed reports whether the angle-addr starting after a '<' is
+// closed. An unclosed angle-addr ends at the next comma or whitespace, so that
+// it doesn't swallow the rest of the list. Commas followed by '@' are part of
+// an obsolete route.
+func angleAddrClosed(s string) bool {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '>':
+			return true
+		case '<', ' ', '\t', '\r', '\n':
+			return false
+		case ',':
+			if i+1 >= len(s) || s[i+1] != '@' {
+				return false
+			}
+		}
+	}
+	return false
+}
+
+// addressGroup is a part of an address list: either a group, or a list of
+// addresses outside of any group.
+type addressGroup struct {
+	group bool
+	name  string // raw display name of the group
+	list  string // raw address list
+}
+
+// splitAddressGroups splits an address list header field value into groups,
+// as defined in RFC 5322 section 3.4.
+func splitAddressGroups(v string) []addressGroup {
+	var (
+		parts      []addressGroup
+		start      int  // start of the current part
+		itemStart  int  // start of the current top-level item
+		inQuote    bool // inside a quoted string
+		inAngle    bool // inside an angle-addr
+		inGroup    bool
+		commentLvl int
+	)
+	appendList := func(end int) {
+		if list := strings.Trim(v[start:end], " \t\r\n,"); list != "" {
+			parts = append(parts, addressGroup{list: list})
+		}
+	}
+	for i := 0; i < len(v); i++ {
+		ch := v[i]
+		switch {
+		case inQuote:
+			if ch == '\\' {
+				i++
+			} else if ch == '"' {
+				inQuote = false
+			}
+			continue
+		case commentLvl > 0:
+			if ch == '\\' {
+				i++
+			} else if ch == '(' {
+				commentLvl++
+			} else if ch == ')' {
+				commentLvl--
+			}
+			continue
+		}
+
+		switch ch {
+		case '"':
+			inQuote = true
+		case '(':
+			commentLvl++
+		case '<':
+			inAngle = true
+		case '>':
+			inAngle = false
+		case ',':
+			if !inAngle {
+				itemStart = i + 1
+			}
+		case ':':
+			if inAngle || inGroup {
+				break
+			}
+			appendList(itemStart)
+			parts = append(parts, addressGroup{group: true, name: v[itemStart:i]})
+			inGroup = true
+			start = i + 1
+		case ';':
+			if !inGroup {
+				break
+			}
+			parts[len(parts)-1].list = strings.TrimSpace(v[start:i])
+			inGroup = false
+			start = i + 1
+			itemStart = i + 1
+		}
+	}
+	if inGroup {
+		// Missing group terminator
+		parts[len(parts)-1].list = strings.TrimSpace(v[start:])
+	} else {
+		appendList(len(v))
+	}
+	return parts
+}
+
+func decodePhrase(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		var sb strings.Builder
+		for i := 1; i < len(s)-1; i++ {
+			if s[i] == '\\' && i+1 < len(s)-1 {
+				i++
+			}
+			sb.WriteByte(s[i])
+		}
+		s = sb.String()
+	}
+	dec := mime.WordDecoder{CharsetReader: gomessage.CharsetReader}
+	if decoded, err := dec.DecodeHeader(s); err == nil {
+		return decoded
+	}
+	return s
+}
+
+// FormatEnvelopeHeader returns a message header containing the fields of an
+// envelope. It's the inverse of ExtractEnvelope.
+//
+// It can be used by server backends which only store parsed message metadata,
+// e.g. to implement Session.Fetch for HEADER.FIELDS sections. Non-ASCII text
+// is encoded as defined in RFC 2047. Long lines are folded when the header is
+// written.
+func FormatEnvelopeHeader(envelope *imap.Envelope) textproto.Header {
+	var mh mail.Header
+	mh.SetDate(envelope.Date)
+	if envelope.Subject != "" {
+		mh.SetSubject(envelope.Subject)
+	}
+	for _, field := range []struct {
+		k     string
+		addrs []imap.Address
+	}{
+		{"From", envelope.From},
+		{"Sender", envelope.Sender},
+		{"Reply-To", envelope.ReplyTo},
+		{"To", envelope.To},
+		{"Cc", envelope.Cc},
+		{"Bcc", envelope.Bcc},
+	} {
+		if v := imap.FormatAddressList(field.addrs); v != "" {
+			mh.Set(field.k, v)
+		}
+	}
+	mh.SetMsgIDList("In-Reply-To", envelope.InReplyTo)
+	mh.SetMessageID(envelope.MessageID)
+
+	var h textproto.Header
+	fields := mh.Fields()
+	for fields.Next() {
+		h.AddRaw(foldHeaderField(fields.Key(), fields.Value()))
+	}
+	return h
+}
+
+// foldHeaderField formats a header field, folding lines at whitespace so that
+// they don't exceed 76 characters if possible. Unlike textproto.WriteHeader,
+// it can fold before the first word, which is necessary to keep long encoded
+// words intact.
+func foldHeaderField(k, v string) []byte {
+	const maxLen = 76
+
+	var b bytes.Buffer
+	b.WriteString(k)
+	b.WriteByte(':')
+	lineLen := b.Len()
+	for _, word := range strings.Split(v, " ") {
+		if word != "" && lineLen+1+len(word) > maxLen {
+			b.WriteString("\r\n")
+			lineLen = 0
+		}
+		b.WriteByte(' ')
+		b.WriteString(word)
+		lineLen += 1 + len(word)
+	}
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
 // ExtractBodyStructure extracts the structure of a message body.
 //
 // It can be used by server backends to implement Session.Fetch.
 func ExtractBodyStructure(r io.Reader) imap.BodyStructure {
-	br := bufio.NewReader(r)
+	br := getBufioReader(r)
+	defer putBufioReader(br)
+
 	header, _ := textproto.ReadHeader(br)
 	return extractBodyStructure(header, br)
 }
 
 func extractBodyStructure(rawHeader textproto.Header, r io.Reader) imap.BodyStructure {
-	header := gomessage.Header{rawHeader}
+	header := gomessage.Header{Header: rawHeader}
 
 	mediaType, typeParams, _ := header.ContentType()
 	primaryType, subType, _ := strings.Cut(mediaType, "/")
@@ -334,3 +1129,178 @@ func getContentLanguage(header gomessage.Header) []string {
 	}
 	return l
 }
+
+// SearchText contains the text of a message searched by the TEXT and BODY
+// search criteria.
+type SearchText struct {
+	header [][]byte // lowercase header field values, not part of the body
+	body   [][]byte // lowercase decoded body contents
+}
+
+// ExtractSearchText extracts the searchable text of a message.
+//
+// The MIME structure of the message is walked. Textual parts are decoded
+// according to their Content-Transfer-Encoding and charset, and messages
+// attached as message/rfc822 parts are searched as well, their header being
+// part of the body of the enclosing message. The contents of other parts, e.g.
+// binary attachments, aren't searched, but their MIME header is. Charsets other
+// than UTF-8 are only decoded if the application imports
+// github.com/emersion/go-message/charset.
+//
+// If the message can't be parsed, its raw contents are searched as well. If r
+// isn't an io.ReadSeeker, the raw message is kept in memory while parsing.
+//
+// It can be used by server backends to implement Session.Search.
+func ExtractSearchText(r io.Reader) *SearchText {
+	var (
+		raw   bytes.Buffer
+		start int64 = -1
+	)
+	rs, ok := r.(io.ReadSeeker)
+	if ok {
+		if offset, err := rs.Seek(0, io.SeekCurrent); err == nil {
+			start = offset
+		}
+	}
+	if start < 0 {
+		r = io.TeeReader(r, &raw)
+	}
+
+	text := new(SearchText)
+	e, err := gomessage.Read(r)
+	if e != nil && (err == nil || isDecodeError(err)) {
+		if text.populate(e, false) {
+			return text
+		}
+	}
+
+	// Fall back to searching the raw message
+	if start >= 0 {
+		if _, err := rs.Seek(start, io.SeekStart); err != nil {
+			return text
+		}
+		io.Copy(&raw, rs)
+	} else {
+		io.Copy(io.Discard, r)
+	}
+	b := raw.Bytes()
+	if e != nil {
+		// The header has already been parsed
+		if i := bytes.Index(b, []byte("\r\n\r\n")); i >= 0 {
+			b = b[i+4:]
+		} else if i := bytes.Index(b, []byte("\n\n")); i >= 0 {
+			b = b[i+2:]
+		}
+	}
+	text.body = append(text.body, bytes.ToLower(b))
+	return text
+}
+
+// ExtractEntitySearchText extracts the searchable text of a message which has
+// already been parsed, like ExtractSearchText. The body of e is consumed.
+//
+// False is returned if the message can't be parsed. ExtractSearchText should
+// then be called with the raw message, so that its contents are searched.
+func ExtractEntitySearchText(e *gomessage.Entity) (*SearchText, bool) {
+	text := new(SearchText)
+	if !text.populate(e, false) {
+		return nil, false
+	}
+	return text, true
+}
+
+// populate adds the text of an entity. False is returned if the entity can't
+// be parsed.
+func (text *SearchText) populate(e *gomessage.Entity, inBody bool) bool {
+	fields := e.Header.Fields()
+	for fields.Next() {
+		// Match the raw value too, like the HEADER criterion
+		raw := fields.Value()
+		v, err := fields.Text()
+		if err == nil {
+			text.addHeader(v, inBody)
+		}
+		if err != nil || v != raw {
+			text.addHeader(raw, inBody)
+		}
+	}
+
+	if mr := e.MultipartReader(); mr != nil {
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return true
+			} else if part == nil || (err != nil && !isDecodeError(err)) {
+				return false
+			}
+			if !text.populate(part, inBody) {
+				return false
+			}
+		}
+	}
+
+	mediaType, _, err := e.Header.ContentType()
+	if err != nil {
+		// RFC 2045 section 5.2: invalid Content-Type defaults to text/plain
+		mediaType = "text/plain"
+	}
+	switch {
+	case mediaType == "message/rfc822" || mediaType == "message/global":
+		msg, err := gomessage.Read(e.Body)
+		if msg == nil || (err != nil && !isDecodeError(err)) {
+			return false
+		}
+		return text.populate(msg, true)
+	case strings.HasPrefix(mediaType, "text/") || strings.HasPrefix(mediaType, "message/"):
+		b, err := io.ReadAll(e.Body)
+		if err != nil {
+			return false
+		}
+		text.body = append(text.body, bytes.ToLower(b))
+	}
+	return true
+}
+
+func (text *SearchText) addHeader(v string, inBody bool) {
+	b := bytes.ToLower([]byte(v))
+	if inBody {
+		text.body = append(text.body, b)
+	} else {
+		text.header = append(text.header, b)
+	}
+}
+
+// Match reports whether the message contains a string, case-insensitively. An
+// empty string matches all messages.
+// If includeHeader is true, the header is searched as well, as for the TEXT
+// criterion. Otherwise, only the body is searched, as for the BODY criterion.
+func (text *SearchText) Match(s string, includeHeader bool) bool {
+	return text.MatchLower([]byte(strings.ToLower(s)), includeHeader)
+}
+
+// MatchLower is like Match, but pattern must already be lowercase. It avoids
+// lowercasing the same pattern for each message searched.
+func (text *SearchText) MatchLower(pattern []byte, includeHeader bool) bool {
+	if len(pattern) == 0 {
+		return true
+	}
+	if includeHeader {
+		for _, b := range text.header {
+			if bytes.Contains(b, pattern) {
+				return true
+			}
+		}
+	}
+	for _, b := range text.body {
+		if bytes.Contains(b, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDecodeError checks whether an entity was returned along with err, with a
+// body which couldn't be decoded.
+func isDecodeError(err error) bool {
+	return gomessage.IsUnknownCharset(err) || gomessage.IsUnknownEncoding(err)
+}
@@ -0,0 +1,831 @@
+package imapserver_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	gomessage "github.com/emersion/go-message"
+	"github.com/emersion/go-message/textproto"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+)
+
+func TestFormatEnvelopeHeader(t *testing.T) {
+	envelope := &imap.Envelope{
+		Date:    time.Date(2024, time.March, 30, 23, 30, 0, 0, time.FixedZone("", 2*60*60)),
+		Subject: "Réunion: compte-rendu de la semaine, avec un sujet suffisamment long pour être replié",
+		From:    []imap.Address{{Name: "Zoé Durand", Mailbox: "zoe", Host: "example.org"}},
+		ReplyTo: []imap.Address{{Name: `Support "Team"`, Mailbox: "support", Host: "example.org"}},
+		To: []imap.Address{
+			{Mailbox: "bob", Host: "example.com"},
+			{Mailbox: "Project team"},
+			{Name: "Carol", Mailbox: "carol", Host: "example.com"},
+			{Mailbox: "dave", Host: "example.net"},
+			{},
+		},
+		Cc: []imap.Address{
+			{Mailbox: "undisclosed-recipients"},
+			{},
+		},
+		InReplyTo: []string{"parent@example.org", "grandparent@example.org"},
+		MessageID: "child@example.org",
+	}
+
+	h := imapserver.FormatEnvelopeHeader(envelope)
+	var buf bytes.Buffer
+	if err := textproto.WriteHeader(&buf, h); err != nil {
+		t.Fatalf("WriteHeader() = %v", err)
+	}
+	for _, line := range strings.Split(buf.String(), "\r\n") {
+		if len(line) > 78 {
+			t.Errorf("header line is too long: %q", line)
+		}
+		for _, ch := range []byte(line) {
+			if ch >= 0x80 {
+				t.Errorf("header line contains non-ASCII characters: %q", line)
+				break
+			}
+		}
+	}
+
+	parsed, err := textproto.ReadHeader(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatalf("ReadHeader() = %v", err)
+	}
+	got := imapserver.ExtractEnvelope(parsed)
+	if !got.Date.Equal(envelope.Date) {
+		t.Errorf("Date = %v, want %v", got.Date, envelope.Date)
+	}
+	got.Date = envelope.Date
+	if !reflect.DeepEqual(got, envelope) {
+		t.Errorf("ExtractEnvelope(FormatEnvelopeHeader()) = \n%#v\nwant\n%#v", got, envelope)
+	}
+}
+
+func TestExtractEnvelope_groups(t *testing.T) {
+	var h textproto.Header
+	h.Set("To", `alice@example.org, "Team: A": bob@example.org, Carol <carol@example.org>;, Empty:;`)
+	got := imapserver.ExtractEnvelope(h).To
+	want := []imap.Address{
+		{Mailbox: "alice", Host: "example.org"},
+		{Mailbox: "Team: A"},
+		{Mailbox: "bob", Host: "example.org"},
+		{Name: "Carol", Mailbox: "carol", Host: "example.org"},
+		{},
+		{Mailbox: "Empty"},
+		{},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ExtractEnvelope().To = %#v, want %#v", got, want)
+	}
+}
+
+func TestExtractEnvelope_brokenAddresses(t *testing.T) {
+	const missingHost = ".MISSING-HOST-NAME."
+	tests := []struct {
+		value string
+		want  []imap.Address
+	}{
+		{
+			// Unquoted comma in a display name
+			value: `Doe, John <john@example.org>, jane@example.org`,
+			want: []imap.Address{
+				{Name: "Doe, John", Mailbox: "john", Host: "example.org"},
+				{Mailbox: "jane", Host: "example.org"},
+			},
+		},
+		{
+			value: `Doe, Jr., John <john@example.org>`,
+			want: []imap.Address{
+				{Name: "Doe, Jr., John", Mailbox: "john", Host: "example.org"},
+			},
+		},
+		{
+			// Encoded-words abutting angle brackets
+			value: `=?UTF-8?Q?J=C3=B6rg?=<jorg@example.org>, =?UTF-8?B?w4lsb2TDqWU=?=<elodie@example.org>`,
+			want: []imap.Address{
+				{Name: "Jörg", Mailbox: "jorg", Host: "example.org"},
+				{Name: "Élodée", Mailbox: "elodie", Host: "example.org"},
+			},
+		},
+		{
+			// Bare local parts
+			value: `undisclosed-recipients`,
+			want: []imap.Address{
+				{Mailbox: "undisclosed-recipients", Host: missingHost},
+			},
+		},
+		{
+			value: `John <john>, alice@example.org, postmaster`,
+			want: []imap.Address{
+				{Name: "John", Mailbox: "john", Host: missingHost},
+				{Mailbox: "alice", Host: "example.org"},
+				{Mailbox: "postmaster", Host: missingHost},
+			},
+		},
+		{
+			// Obsolete route-addr
+			value: `John <@relay1.example.net,@relay2.example.net:john@example.org>, jane@example.org`,
+			want: []imap.Address{
+				{Name: "John", Mailbox: "john", Host: "example.org"},
+				{Mailbox: "jane", Host: "example.org"},
+			},
+		},
+		{
+			// Null address and missing angle bracket
+			value: `Alice <alice@example.org>, <>, Bob <bob@example.org`,
+			want: []imap.Address{
+				{Name: "Alice", Mailbox: "alice", Host: "example.org"},
+				{Name: "Bob", Mailbox: "bob", Host: "example.org"},
+			},
+		},
+		{
+			// Unclosed angle-addr followed by another address
+			value: `"Quoted Name" <john@example.org, x`,
+			want: []imap.Address{
+				{Name: "Quoted Name", Mailbox: "john", Host: "example.org"},
+				{Mailbox: "x", Host: missingHost},
+			},
+		},
+		{
+			value: `"Quoted local"@example.org, bob@example.org (Bob, the builder), bad"quote@example.org`,
+			want: []imap.Address{
+				{Mailbox: "Quoted local", Host: "example.org"},
+				{Name: "Bob, the builder", Mailbox: "bob", Host: "example.org"},
+				{Mailbox: "bad\"quote", Host: "example.org"},
+			},
+		},
+		{
+			// Broken address in a group
+			value: `Team: Doe, John <john@example.org>, bob;`,
+			want: []imap.Address{
+				{Mailbox: "Team"},
+				{Name: "Doe, John", Mailbox: "john", Host: "example.org"},
+				{Mailbox: "bob", Host: missingHost},
+				{},
+			},
+		},
+	}
+	for _, tc := range tests {
+		var h textproto.Header
+		h.Set("To", tc.value)
+		got := imapserver.ExtractEnvelope(h).To
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ExtractEnvelope(%q).To = %#v, want %#v", tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestExtractEnvelope_largeAddressList(t *testing.T) {
+	const size = 1024 * 1024
+	for _, item := range []string{"user@example.org, ", "Doe, John ", "<", "\"x, "} {
+		v := strings.Repeat(item, size/len(item))
+
+		var h textproto.Header
+		h.Set("To", v)
+		to := imapserver.ExtractEnvelope(h).To
+		if n := len(to) * len(item); n > size/2 {
+			t.Errorf("ExtractEnvelope() with %q returned %v addresses", item, len(to))
+		}
+	}
+}
+
+func TestFormatAddressList(t *testing.T) {
+	addrs := []imap.Address{
+		{Name: "Doe, John", Mailbox: "john", Host: "example.org"},
+		{Mailbox: "nobody", Host: "example.org"},
+		imap.GroupStart("Team"),
+		{Name: "Zoé", Mailbox: "zoe", Host: "example.org"},
+		{Mailbox: "first.last", Host: "example.org"},
+		imap.GroupEnd(),
+		{Name: "Mallory", Mailbox: "odd local", Host: "example.org"},
+	}
+	const want = `"Doe, John" <john@example.org>, nobody@example.org, Team: =?utf-8?q?Zo=C3=A9?= <zoe@example.org>, first.last@example.org;, Mallory <"odd local"@example.org>`
+	s := imap.FormatAddressList(addrs)
+	if s != want {
+		t.Errorf("FormatAddressList() = %q, want %q", s, want)
+	}
+
+	var h textproto.Header
+	h.Set("To", s)
+	if got := imapserver.ExtractEnvelope(h).To; !reflect.DeepEqual(got, addrs) {
+		t.Errorf("ExtractEnvelope().To = %#v, want %#v", got, addrs)
+	}
+
+	if start, end := imap.GroupStart("Team"), imap.GroupEnd(); !start.IsGroupStart() || !end.IsGroupEnd() || start.Addr() != "" || end.Addr() != "" {
+		t.Errorf("invalid group markers: %#v, %#v", start, end)
+	}
+}
+
+const partialTestSinglePart = "From: Mitsuha <mitsuha@example.org>\r\n" +
+	"Subject: Kataware-doki\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Who are you?\r\n" +
+	"I'm looking for someone.\r\n"
+
+const partialTestMultipart = "From: Taki <taki@example.org>\r\n" +
+	"Content-Type: multipart/mixed; boundary=frontier\r\n" +
+	"\r\n" +
+	"--frontier\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Your name is...\r\n" +
+	"--frontier\r\n" +
+	"Content-Type: message/rfc822\r\n" +
+	"\r\n" +
+	"Subject: Nested\r\n" +
+	"\r\n" +
+	"Nested body\r\n" +
+	"--frontier--\r\n"
+
+// nonSeekableReader hides the io.Seeker implementation of a reader.
+type nonSeekableReader struct {
+	io.Reader
+}
+
+func TestExtractBodySection_partial(t *testing.T) {
+	sections := []*imap.FetchItemBodySection{
+		{},
+		{Specifier: imap.PartSpecifierText},
+		{Specifier: imap.PartSpecifierHeader},
+		{Part: []int{1}},
+		{Part: []int{2}},
+		{Part: []int{2}, Specifier: imap.PartSpecifierText},
+		{Specifier: imap.PartSpecifierHeader, HeaderFields: []string{"Subject"}},
+	}
+	for _, msg := range []string{partialTestSinglePart, partialTestMultipart} {
+		for _, section := range sections {
+			full := imapserver.ExtractBodySection(strings.NewReader(msg), section)
+			if full == nil {
+				continue // section doesn't exist
+			}
+
+			for _, offset := range []int64{0, 1, 10, int64(len(full)) - 1, int64(len(full)), int64(len(full)) + 10} {
+				for _, size := range []int64{1, 5, int64(len(full)), int64(len(full)) + 10} {
+					partialSection := *section
+					partialSection.Partial = &imap.SectionPartial{Offset: offset, Size: size}
+
+					end := offset + size
+					if end > int64(len(full)) {
+						end = int64(len(full))
+					}
+					want := []byte{}
+					if offset < int64(len(full)) {
+						want = full[offset:end]
+					}
+
+					for _, r := range []io.Reader{strings.NewReader(msg), nonSeekableReader{strings.NewReader(msg)}} {
+						got := imapserver.ExtractBodySection(r, &partialSection)
+						if got == nil {
+							t.Errorf("ExtractBodySection(%T, %v<%v.%v>) = nil, want empty string", r, section, offset, size)
+						} else if !bytes.Equal(got, want) {
+							t.Errorf("ExtractBodySection(%T, %v<%v.%v>) = %q, want %q", r, section, offset, size, got, want)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestExtractBinarySection_partial(t *testing.T) {
+	const msg = "Content-Type: text/plain\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"SGVsbG8gd29ybGQh\r\n"
+
+	section := &imap.FetchItemBinarySection{
+		Part:    []int{1},
+		Partial: &imap.SectionPartial{Offset: 6, Size: 5},
+	}
+	if got := imapserver.ExtractBinarySection(strings.NewReader(msg), section); string(got) != "world" {
+		t.Errorf("ExtractBinarySection() = %q, want %q", got, "world")
+	}
+	section.Partial.Offset = 100
+	if got := imapserver.ExtractBinarySection(strings.NewReader(msg), section); got == nil || len(got) != 0 {
+		t.Errorf("ExtractBinarySection() = %q, want empty string", got)
+	}
+	sizeSection := &imap.FetchItemBinarySectionSize{Part: []int{1}}
+	if n := imapserver.ExtractBinarySectionSize(strings.NewReader(msg), sizeSection); n != uint32(len("Hello world!")) {
+		t.Errorf("ExtractBinarySectionSize() = %v, want %v", n, len("Hello world!"))
+	}
+}
+
+// base64Lines encodes b in base64, wrapped at lineLen characters with sep.
+func base64Lines(b []byte, lineLen int, sep string) string {
+	enc := base64.StdEncoding.EncodeToString(b)
+	var sb strings.Builder
+	for len(enc) > lineLen {
+		sb.WriteString(enc[:lineLen] + sep)
+		enc = enc[lineLen:]
+	}
+	sb.WriteString(enc + sep)
+	return sb.String()
+}
+
+func TestExtractBinarySectionSize(t *testing.T) {
+	type part struct {
+		name, contentType, encoding, body string
+	}
+	var parts []part
+	for _, n := range []int{0, 1, 2, 3, 4, 5, 57, 1000} {
+		data := make([]byte, n)
+		for i := range data {
+			data[i] = byte(i * 7)
+		}
+		enc := base64.StdEncoding.EncodeToString(data)
+		parts = append(parts,
+			part{fmt.Sprintf("base64-%v", n), "application/octet-stream", "base64", base64Lines(data, 76, "\r\n")},
+			part{fmt.Sprintf("base64-lf-%v", n), "application/octet-stream", "base64", base64Lines(data, 60, "\n")},
+			part{fmt.Sprintf("base64-indented-%v", n), "application/octet-stream", "base64", base64Lines(data, 4, "\r\n \t")},
+			part{fmt.Sprintf("base64-nopadding-%v", n), "application/octet-stream", "base64", strings.TrimRight(enc, "=") + "\r\n"},
+			part{fmt.Sprintf("base64-extrapadding-%v", n), "application/octet-stream", "base64", enc + "=\r\n"},
+			part{fmt.Sprintf("base64-garbage-%v", n), "application/octet-stream", "base64", enc + "\r\nThis isn't base64!\r\n"},
+			part{fmt.Sprintf("base64-invalid-%v", n), "application/octet-stream", "base64", "*" + enc + "\r\n"},
+			part{fmt.Sprintf("base64-concat-%v", n), "application/octet-stream", "base64", enc + enc + "\r\n"},
+			part{fmt.Sprintf("base64-uppercase-%v", n), "application/octet-stream", "BASE64", enc},
+			part{fmt.Sprintf("base64-utf8-%v", n), "text/plain; charset=UTF-8", "base64", enc},
+			part{fmt.Sprintf("base64-latin1-%v", n), "text/plain; charset=iso-8859-1", "base64", enc},
+			part{fmt.Sprintf("base64-unknowncharset-%v", n), "text/plain; charset=x-unknown", "base64", enc},
+		)
+	}
+	parts = append(parts,
+		part{"quoted-printable", "text/plain", "quoted-printable", "Caf=C3=A9 =\r\nau lait\r\n"},
+		part{"7bit", "text/plain", "7bit", "Hello\r\n"},
+		part{"none", "text/plain", "", "Hello\r\n"},
+		part{"unknown", "application/octet-stream", "x-uuencode", "begin 644 x\r\n"},
+	)
+
+	for _, p := range parts {
+		partHeader := "Content-Type: " + p.contentType + "\r\n"
+		if p.encoding != "" {
+			partHeader += "Content-Transfer-Encoding: " + p.encoding + "\r\n"
+		}
+		singlePart := "Subject: Single part\r\n" + partHeader + "\r\n" + p.body
+		multipart := "Subject: Multipart\r\n" +
+			"Content-Type: multipart/mixed; boundary=b\r\n" +
+			"\r\n" +
+			"--b\r\n" +
+			"Content-Type: text/plain\r\n" +
+			"\r\n" +
+			"Attached\r\n" +
+			"--b\r\n" +
+			partHeader +
+			"\r\n" +
+			p.body +
+			"\r\n--b--\r\n"
+
+		tests := []struct {
+			msg  string
+			part []int
+		}{
+			{singlePart, nil},
+			{singlePart, []int{1}},
+			{multipart, []int{1}},
+			{multipart, []int{2}},
+			{multipart, []int{3}},
+		}
+		for _, tc := range tests {
+			want := len(imapserver.ExtractBinarySection(strings.NewReader(tc.msg), &imap.FetchItemBinarySection{Part: tc.part}))
+			section := &imap.FetchItemBinarySectionSize{Part: tc.part}
+			for _, r := range []io.Reader{strings.NewReader(tc.msg), nonSeekableReader{strings.NewReader(tc.msg)}} {
+				if n := imapserver.ExtractBinarySectionSize(r, section); int(n) != want {
+					t.Errorf("%v: ExtractBinarySectionSize(%T, %v) = %v, want %v", p.name, r, tc.part, n, want)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkExtractBinarySectionSize(b *testing.B) {
+	const attachmentSize = 50 * 1024 * 1024
+
+	data := make([]byte, attachmentSize/4*3)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	msg := []byte("Subject: Large attachment\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		base64Lines(data, 76, "\r\n") +
+		"--b--\r\n")
+	section := &imap.FetchItemBinarySectionSize{Part: []int{1}}
+
+	b.Run("seekable", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(msg)))
+		for i := 0; i < b.N; i++ {
+			if n := imapserver.ExtractBinarySectionSize(bytes.NewReader(msg), section); int(n) != len(data) {
+				b.Fatalf("ExtractBinarySectionSize() = %v, want %v", n, len(data))
+			}
+		}
+	})
+	b.Run("reader", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(msg)))
+		for i := 0; i < b.N; i++ {
+			if n := imapserver.ExtractBinarySectionSize(nonSeekableReader{bytes.NewReader(msg)}, section); int(n) != len(data) {
+				b.Fatalf("ExtractBinarySectionSize() = %v, want %v", n, len(data))
+			}
+		}
+	})
+}
+
+// syntheticMessage is a large single-part message generated on the fly.
+type syntheticMessage struct {
+	size, offset int64
+}
+
+const syntheticMessageHeader = "Subject: Large attachment\r\n\r\n"
+
+func (msg *syntheticMessage) Read(b []byte) (int, error) {
+	if msg.offset >= msg.size {
+		return 0, io.EOF
+	}
+	if int64(len(b)) > msg.size-msg.offset {
+		b = b[:msg.size-msg.offset]
+	}
+	for i := range b {
+		if off := msg.offset + int64(i); off < int64(len(syntheticMessageHeader)) {
+			b[i] = syntheticMessageHeader[off]
+		} else if off%78 == 77 {
+			b[i] = '\n'
+		} else if off%78 == 76 {
+			b[i] = '\r'
+		} else {
+			b[i] = 'a'
+		}
+	}
+	msg.offset += int64(len(b))
+	return len(b), nil
+}
+
+func (msg *syntheticMessage) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += msg.offset
+	case io.SeekEnd:
+		offset += msg.size
+	}
+	msg.offset = offset
+	return offset, nil
+}
+
+func BenchmarkExtractBodySection_partialTail(b *testing.B) {
+	const (
+		msgSize  = 500 * 1024 * 1024
+		tailSize = 64 * 1024
+	)
+	section := &imap.FetchItemBodySection{
+		Part:    []int{1},
+		Partial: &imap.SectionPartial{Offset: msgSize - int64(len(syntheticMessageHeader)) - tailSize, Size: tailSize},
+	}
+
+	b.Run("seekable", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf := imapserver.ExtractBodySection(&syntheticMessage{size: msgSize}, section)
+			if len(buf) != tailSize {
+				b.Fatalf("ExtractBodySection() returned %v bytes, want %v", len(buf), tailSize)
+			}
+		}
+	})
+	b.Run("reader", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf := imapserver.ExtractBodySection(nonSeekableReader{&syntheticMessage{size: msgSize}}, section)
+			if len(buf) != tailSize {
+				b.Fatalf("ExtractBodySection() returned %v bytes, want %v", len(buf), tailSize)
+			}
+		}
+	})
+}
+
+// headerFieldsTestMessage has a header with unusual folding, whitespace and
+// capitalization, which must be preserved in HEADER.FIELDS sections.
+const headerFieldsTestMessage = "Received: from mx.example.org\r\n" +
+	"\tby mail.example.com; Mon, 1 Jan 2024 00:00:00 +0000\r\n" +
+	"DKIM-Signature: v=1; a=rsa-sha256;\r\n" +
+	"  d=example.org; s=sel;   \r\n" +
+	"  h=From:Subject\r\n" +
+	"subject :   Folded\r\n" +
+	" \t subject line  \r\n" +
+	"X-Unrelated: foo\r\n" +
+	"FROM:Alice <alice@example.org>\r\n" +
+	"Content-Type: multipart/mixed; boundary=b\r\n" +
+	"Subject: second\r\n" +
+	"X-Empty:\r\n" +
+	"\r\n" +
+	"--b\r\n" +
+	"Content-Type: message/rfc822\r\n" +
+	"\r\n" +
+	"to:  bob@example.org  \r\n" +
+	"X-Nested: a\r\n" +
+	"Subject : nested\r\n" +
+	"\r\n" +
+	"Nested body\r\n" +
+	"--b--\r\n"
+
+func TestExtractBodySection_headerFields(t *testing.T) {
+	tests := []struct {
+		section *imap.FetchItemBodySection
+		want    string
+	}{
+		{
+			section: &imap.FetchItemBodySection{
+				Specifier:    imap.PartSpecifierHeader,
+				HeaderFields: []string{"From", "Subject", "DKIM-Signature", "X-Empty", "X-Missing"},
+			},
+			want: "DKIM-Signature: v=1; a=rsa-sha256;\r\n" +
+				"  d=example.org; s=sel;   \r\n" +
+				"  h=From:Subject\r\n" +
+				"subject :   Folded\r\n" +
+				" \t subject line  \r\n" +
+				"FROM:Alice <alice@example.org>\r\n" +
+				"Subject: second\r\n" +
+				"X-Empty:\r\n" +
+				"\r\n",
+		},
+		{
+			section: &imap.FetchItemBodySection{
+				Specifier:       imap.PartSpecifierHeader,
+				HeaderFieldsNot: []string{"received", "X-UNRELATED", "Content-Type", "X-Missing"},
+			},
+			want: "DKIM-Signature: v=1; a=rsa-sha256;\r\n" +
+				"  d=example.org; s=sel;   \r\n" +
+				"  h=From:Subject\r\n" +
+				"subject :   Folded\r\n" +
+				" \t subject line  \r\n" +
+				"FROM:Alice <alice@example.org>\r\n" +
+				"Subject: second\r\n" +
+				"X-Empty:\r\n" +
+				"\r\n",
+		},
+		{
+			section: &imap.FetchItemBodySection{
+				Part:         []int{1},
+				Specifier:    imap.PartSpecifierHeader,
+				HeaderFields: []string{"Subject", "To"},
+			},
+			want: "to:  bob@example.org  \r\n" +
+				"Subject : nested\r\n" +
+				"\r\n",
+		},
+		{
+			section: &imap.FetchItemBodySection{
+				Part:            []int{1},
+				Specifier:       imap.PartSpecifierHeader,
+				HeaderFieldsNot: []string{"x-nested"},
+			},
+			want: "to:  bob@example.org  \r\n" +
+				"Subject : nested\r\n" +
+				"\r\n",
+		},
+		{
+			section: &imap.FetchItemBodySection{
+				Specifier:    imap.PartSpecifierHeader,
+				HeaderFields: []string{"X-Missing"},
+			},
+			want: "\r\n",
+		},
+	}
+	for _, tc := range tests {
+		got := imapserver.ExtractBodySection(strings.NewReader(headerFieldsTestMessage), tc.section)
+		if string(got) != tc.want {
+			t.Errorf("ExtractBodySection(%v) = \n%q\nwant\n%q", tc.section, got, tc.want)
+		}
+	}
+}
+
+const mimeTestMessage = "Subject: Nested parts\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=inner\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Plain text\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html\r\n" +
+	"Content-ID:  <html@example.org>  \r\n" +
+	"\r\n" +
+	"<p>HTML</p>\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: message/rfc822\r\n" +
+	"Content-Disposition: attachment\r\n" +
+	"\r\n" +
+	"Subject: Forwarded\r\n" +
+	"\r\n" +
+	"Forwarded body\r\n" +
+	"--outer--\r\n"
+
+func TestExtractBodySection_mime(t *testing.T) {
+	tests := []struct {
+		section *imap.FetchItemBodySection
+		want    *string
+	}{
+		{
+			section: &imap.FetchItemBodySection{Part: []int{1, 2}, Specifier: imap.PartSpecifierMIME},
+			want:    strPtr("Content-Type: text/html\r\nContent-ID:  <html@example.org>  \r\n\r\n"),
+		},
+		{
+			section: &imap.FetchItemBodySection{Part: []int{1}, Specifier: imap.PartSpecifierMIME},
+			want:    strPtr("Content-Type: multipart/alternative; boundary=inner\r\n\r\n"),
+		},
+		// MIME is the header of the part, HEADER the header of the message it
+		// contains
+		{
+			section: &imap.FetchItemBodySection{Part: []int{2}, Specifier: imap.PartSpecifierMIME},
+			want:    strPtr("Content-Type: message/rfc822\r\nContent-Disposition: attachment\r\n\r\n"),
+		},
+		{
+			section: &imap.FetchItemBodySection{Part: []int{2}, Specifier: imap.PartSpecifierHeader},
+			want:    strPtr("Subject: Forwarded\r\n\r\n"),
+		},
+		{
+			section: &imap.FetchItemBodySection{Part: []int{2}, Specifier: imap.PartSpecifierText},
+			want:    strPtr("Forwarded body"),
+		},
+		// HEADER and TEXT don't apply to non-message parts
+		{
+			section: &imap.FetchItemBodySection{Part: []int{1, 2}, Specifier: imap.PartSpecifierHeader},
+		},
+		{
+			section: &imap.FetchItemBodySection{Part: []int{1, 1}, Specifier: imap.PartSpecifierText},
+		},
+		{
+			section: &imap.FetchItemBodySection{Part: []int{3}, Specifier: imap.PartSpecifierMIME},
+		},
+	}
+	for _, tc := range tests {
+		got := imapserver.ExtractBodySection(strings.NewReader(mimeTestMessage), tc.section)
+		if tc.want == nil {
+			if got != nil {
+				t.Errorf("ExtractBodySection(%v) = %q, want nil", tc.section, got)
+			}
+		} else if got == nil || string(got) != *tc.want {
+			t.Errorf("ExtractBodySection(%v) = %q, want %q", tc.section, got, *tc.want)
+		}
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+var searchTextTestMessage = "From: Taki <taki@example.org>\r\n" +
+	"Subject: =?utf-8?q?Kataware-doki_=C3=A0_Itomori?=\r\n" +
+	"Content-Type: multipart/mixed; boundary=frontier\r\n" +
+	"\r\n" +
+	"--frontier\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"Meet me at the comet crat=\r\n" +
+	"er, Mitsu=C3=A4!\r\n" +
+	"--frontier\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	base64Lines([]byte("<p>Kuchikamizake en café</p>"), 76, "\r\n") +
+	"--frontier\r\n" +
+	"Content-Type: message/rfc822\r\n" +
+	"\r\n" +
+	"From: Mitsuha <mitsuha@example.org>\r\n" +
+	"Subject: Braided cord\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	base64Lines([]byte("Musubi is the old way of calling the local guardian god."), 76, "\r\n") +
+	"--frontier\r\n" +
+	"Content-Type: application/octet-stream; name=\"shrine.bin\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	base64Lines([]byte("Tiamat fragment"), 76, "\r\n") +
+	"--frontier--\r\n"
+
+func TestExtractSearchText(t *testing.T) {
+	tests := []struct {
+		s          string
+		text, body bool
+	}{
+		{s: "", text: true, body: true},
+		{s: "taki@example.org", text: true, body: false},
+		{s: "kataware-doki à itomori", text: true, body: false},
+		{s: "=?utf-8?q?Kataware-doki", text: true, body: false},
+		// Quoted-printable soft line break
+		{s: "comet crater, mitsuä", text: true, body: true},
+		// Base64 decoding
+		{s: "kuchikamizake en café", text: true, body: true},
+		// Forwarded message: its header is part of the body
+		{s: "braided cord", text: true, body: true},
+		{s: "mitsuha@example.org", text: true, body: true},
+		{s: "local guardian god", text: true, body: true},
+		// Binary attachment: only the MIME header is searched
+		{s: "shrine.bin", text: true, body: false},
+		{s: "tiamat", text: false, body: false},
+		{s: base64.StdEncoding.EncodeToString([]byte("Tiamat fragment")), text: false, body: false},
+	}
+
+	for _, r := range []struct {
+		name string
+		r    func() io.Reader
+	}{
+		{"seeker", func() io.Reader { return strings.NewReader(searchTextTestMessage) }},
+		{"reader", func() io.Reader { return nonSeekableReader{strings.NewReader(searchTextTestMessage)} }},
+	} {
+		text := imapserver.ExtractSearchText(r.r())
+		for _, tc := range tests {
+			if got := text.Match(tc.s, true); got != tc.text {
+				t.Errorf("%v: Match(%q, true) = %v, want %v", r.name, tc.s, got, tc.text)
+			}
+			if got := text.Match(tc.s, false); got != tc.body {
+				t.Errorf("%v: Match(%q, false) = %v, want %v", r.name, tc.s, got, tc.body)
+			}
+		}
+	}
+}
+
+func TestExtractEntitySearchText(t *testing.T) {
+	e, err := gomessage.Read(strings.NewReader(searchTextTestMessage))
+	if err != nil {
+		t.Fatalf("Read() = %v", err)
+	}
+	text, ok := imapserver.ExtractEntitySearchText(e)
+	if !ok {
+		t.Fatalf("ExtractEntitySearchText() = false")
+	}
+	for _, tc := range []struct {
+		pattern    string
+		text, body bool
+	}{
+		{pattern: "kataware-doki à itomori", text: true, body: false},
+		{pattern: "comet crater, mitsuä", text: true, body: true},
+		{pattern: "tiamat", text: false, body: false},
+	} {
+		if got := text.MatchLower([]byte(tc.pattern), true); got != tc.text {
+			t.Errorf("MatchLower(%q, true) = %v, want %v", tc.pattern, got, tc.text)
+		}
+		if got := text.MatchLower([]byte(tc.pattern), false); got != tc.body {
+			t.Errorf("MatchLower(%q, false) = %v, want %v", tc.pattern, got, tc.body)
+		}
+	}
+}
+
+func TestExtractSearchText_fallback(t *testing.T) {
+	tests := []struct {
+		name, raw string
+		text      []string
+		notBody   []string
+	}{
+		{
+			name: "truncated multipart",
+			raw: "Subject: Truncated\r\n" +
+				"Content-Type: multipart/mixed; boundary=b\r\n" +
+				"\r\n" +
+				"--b\r\n" +
+				"Content-Type: text/plain\r\n" +
+				"\r\n" +
+				"Hello needle!\r\n",
+			text:    []string{"needle", "truncated"},
+			notBody: []string{"truncated"},
+		},
+		{
+			name: "malformed header",
+			raw:  "Subject Truncated\r\n\r\nHello needle!\r\n",
+			text: []string{"needle", "subject truncated"},
+		},
+	}
+
+	for _, tc := range tests {
+		for _, r := range []io.Reader{strings.NewReader(tc.raw), nonSeekableReader{strings.NewReader(tc.raw)}} {
+			text := imapserver.ExtractSearchText(r)
+			for _, s := range tc.text {
+				if !text.Match(s, true) {
+					t.Errorf("%v: Match(%q, true) = false, want true", tc.name, s)
+				}
+			}
+			for _, s := range tc.notBody {
+				if text.Match(s, false) {
+					t.Errorf("%v: Match(%q, false) = true, want false", tc.name, s)
+				}
+			}
+		}
+	}
+}
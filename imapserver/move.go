@@ -13,14 +13,92 @@ func (c *Conn) handleMove(dec *imapwire.Decoder, numKind NumKind) error {
 	if err := c.checkState(imap.ConnStateSelected); err != nil {
 		return err
 	}
+	if err := c.checkWritable(); err != nil {
+		return err
+	}
 	session, ok := c.session.(SessionMove)
 	if !ok {
-		return newClientBugError("MOVE is not supported")
+		return c.moveFallback(numSet, dest)
 	}
 	w := &MoveWriter{conn: c}
 	return session.Move(w, numSet, dest)
 }
 
+// moveFallback implements MOVE with COPY, STORE and UID EXPUNGE, for sessions
+// which don't implement SessionMove.
+//
+// The messages are resolved to UIDs first, so that only the moved messages
+// are expunged. If any step fails, the original messages are left in place.
+func (c *Conn) moveFallback(numSet imap.NumSet, dest string) error {
+	var criteria imap.SearchCriteria
+	switch numSet := numSet.(type) {
+	case imap.SeqSet:
+		criteria.SeqNum = []imap.SeqSet{numSet}
+	case imap.UIDSet:
+		criteria.UID = []imap.UIDSet{numSet}
+	}
+	searchData, err := c.session.Search(NumKindUID, &criteria, &imap.SearchOptions{})
+	if err != nil {
+		return err
+	}
+	uids, err := searchData.AllUIDs()
+	if err != nil {
+		return err
+	} else if len(uids) == 0 {
+		return nil
+	}
+	uidSet := imap.UIDSetNum(uids...)
+
+	// Remember which messages were already flagged for deletion, so that
+	// they keep the flag if the expunge step fails
+	searchData, err = c.session.Search(NumKindUID, &imap.SearchCriteria{
+		UID:  []imap.UIDSet{uidSet},
+		Flag: []imap.Flag{imap.FlagDeleted},
+	}, &imap.SearchOptions{})
+	if err != nil {
+		return err
+	}
+	deletedUIDs, err := searchData.AllUIDs()
+	if err != nil {
+		return err
+	}
+
+	copyData, err := c.session.Copy(uidSet, dest)
+	if err != nil {
+		return err
+	}
+
+	storeFlags := imap.StoreFlags{
+		Op:     imap.StoreFlagsAdd,
+		Silent: true,
+		Flags:  []imap.Flag{imap.FlagDeleted},
+	}
+	if err := c.session.Store(&FetchWriter{conn: c}, uidSet, &storeFlags, &imap.StoreOptions{}); err != nil {
+		return err
+	}
+
+	if copyData != nil {
+		if err := c.writeCopyOK("", "MOVE", copyData); err != nil {
+			return err
+		}
+	}
+
+	if err := c.session.Expunge(&ExpungeWriter{conn: c}, &uidSet); err != nil {
+		// Don't leave the messages flagged for deletion, a later EXPUNGE
+		// would remove them from both mailboxes
+		undeleteSet := uidSet
+		if len(deletedUIDs) > 0 {
+			undeleteSet, _ = uidSet.Subtract(imap.UIDSetNum(deletedUIDs...))
+		}
+		if len(undeleteSet) > 0 {
+			storeFlags.Op = imap.StoreFlagsDel
+			c.session.Store(&FetchWriter{conn: c}, undeleteSet, &storeFlags, &imap.StoreOptions{})
+		}
+		return err
+	}
+	return nil
+}
+
 // MoveWriter writes responses for the MOVE command.
 //
 // Servers must first call WriteCopyData once, then call WriteExpunge any
@@ -31,7 +109,7 @@ type MoveWriter struct {
 
 // WriteCopyData writes the untagged COPYUID response for a MOVE command.
 func (w *MoveWriter) WriteCopyData(data *imap.CopyData) error {
-	return w.conn.writeCopyOK("", data)
+	return w.conn.writeCopyOK("", "MOVE", data)
 }
 
 // WriteExpunge writes an EXPUNGE response for a MOVE command.
@@ -0,0 +1,162 @@
+package imapserver_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+// basicSession hides the optional interfaces implemented by the wrapped
+// session, such as SessionMove.
+type basicSession struct {
+	imapserver.Session
+	copyErr, expungeErr error
+}
+
+func (sess *basicSession) Copy(numSet imap.NumSet, dest string) (*imap.CopyData, error) {
+	if sess.copyErr != nil {
+		return nil, sess.copyErr
+	}
+	return sess.Session.Copy(numSet, dest)
+}
+
+func (sess *basicSession) Expunge(w *imapserver.ExpungeWriter, uids *imap.UIDSet) error {
+	if sess.expungeErr != nil {
+		return sess.expungeErr
+	}
+	return sess.Session.Expunge(w, uids)
+}
+
+func newMoveTestConn(t *testing.T, copyErr, expungeErr error) *testConn {
+	user := newTestUser()
+	for i := 0; i < 3; i++ {
+		user.Append("INBOX", strings.NewReader(testRawMessage), &imap.AppendOptions{})
+	}
+	user.Create("Archive", nil)
+
+	tc := newTestConnWithOptions(t, &imapserver.Options{
+		NewSession: func(conn *imapserver.Conn) (imapserver.Session, *imapserver.GreetingData, error) {
+			sess := &basicSession{imapmemserver.NewUserSession(user), copyErr, expungeErr}
+			return sess, &imapserver.GreetingData{PreAuth: true}, nil
+		},
+		Caps: imap.CapSet{imap.CapIMAP4rev1: {}, imap.CapUIDPlus: {}},
+	})
+	tc.expectOK("S", "S SELECT INBOX\r\n")
+	return tc
+}
+
+func TestMove_fallback(t *testing.T) {
+	conn := newMoveTestConn(t, nil, nil)
+	defer conn.Close()
+
+	untagged, _ := conn.execLines("C", "C CAPABILITY\r\n")
+	if len(untagged) != 1 || !strings.Contains(untagged[0], " MOVE") {
+		t.Errorf("CAPABILITY response = %q, want MOVE", untagged)
+	}
+
+	// Flag a message outside of the moved set as deleted, it must not be
+	// expunged
+	conn.expectOK("D", "D STORE 4 +FLAGS.SILENT (\\Deleted)\r\n")
+
+	untagged, tagged := conn.execLines("M", "M MOVE 2:3 Archive\r\n")
+	if !strings.HasPrefix(tagged, "M OK") {
+		t.Fatalf("MOVE response = %q, want OK", tagged)
+	}
+	want := []string{
+		"* OK [COPYUID 2 2:3 1:2] MOVE completed",
+		"* 3 EXPUNGE",
+		"* 2 EXPUNGE",
+	}
+	if !reflect.DeepEqual(untagged, want) {
+		t.Errorf("MOVE untagged responses = %q, want %q", untagged, want)
+	}
+
+	untagged, _ = conn.execLines("T", "T STATUS Archive (MESSAGES)\r\n")
+	if want := []string{`* STATUS "Archive" (MESSAGES 2)`}; !reflect.DeepEqual(untagged, want) {
+		t.Errorf("STATUS response = %q, want %q", untagged, want)
+	}
+
+	untagged, _ = conn.execLines("F", "F FETCH 1:* UID\r\n")
+	want = []string{
+		"* 1 FETCH (UID 1)",
+		"* 2 FETCH (UID 4)",
+	}
+	if !reflect.DeepEqual(untagged, want) {
+		t.Errorf("FETCH responses = %q, want %q", untagged, want)
+	}
+
+	untagged, _ = conn.execLines("S", "S SEARCH DELETED\r\n")
+	if want := []string{"* SEARCH 2"}; !reflect.DeepEqual(untagged, want) {
+		t.Errorf("SEARCH DELETED responses = %q, want %q", untagged, want)
+	}
+}
+
+func TestMove_fallbackCopyError(t *testing.T) {
+	conn := newMoveTestConn(t, &imap.Error{
+		Type: imap.StatusResponseTypeNo,
+		Code: imap.ResponseCodeOverQuota,
+		Text: "Over quota",
+	}, nil)
+	defer conn.Close()
+
+	untagged, tagged := conn.execLines("M", "M UID MOVE 1:* Archive\r\n")
+	if want := "M NO [OVERQUOTA] Over quota"; tagged != want {
+		t.Errorf("MOVE response = %q, want %q", tagged, want)
+	}
+	if len(untagged) != 0 {
+		t.Errorf("MOVE untagged responses = %q, want none", untagged)
+	}
+
+	untagged, _ = conn.execLines("F", "F FETCH 1:* FLAGS\r\n")
+	if len(untagged) != 4 {
+		t.Errorf("got %v messages after failed MOVE, want 4", len(untagged))
+	}
+	for _, line := range untagged {
+		if strings.Contains(strings.ToLower(line), "\\deleted") {
+			t.Errorf("message flagged as deleted after failed MOVE: %q", line)
+		}
+	}
+}
+
+func TestMove_fallbackExpungeError(t *testing.T) {
+	conn := newMoveTestConn(t, nil, &imap.Error{
+		Type: imap.StatusResponseTypeNo,
+		Text: "Expunge failed",
+	})
+	defer conn.Close()
+
+	_, tagged := conn.execLines("M", "M MOVE 2:3 Archive\r\n")
+	if want := "M NO Expunge failed"; tagged != want {
+		t.Errorf("MOVE response = %q, want %q", tagged, want)
+	}
+
+	untagged, _ := conn.execLines("S", "S SEARCH DELETED\r\n")
+	if want := []string{"* SEARCH"}; !reflect.DeepEqual(untagged, want) {
+		t.Errorf("SEARCH DELETED responses = %q, want %q", untagged, want)
+	}
+}
+
+func TestMove_fallbackExpungeErrorKeepsDeleted(t *testing.T) {
+	conn := newMoveTestConn(t, nil, &imap.Error{
+		Type: imap.StatusResponseTypeNo,
+		Text: "Expunge failed",
+	})
+	defer conn.Close()
+
+	// A message flagged as deleted before the MOVE must keep its flag
+	conn.expectOK("D", "D STORE 3 +FLAGS.SILENT (\\Deleted)\r\n")
+
+	_, tagged := conn.execLines("M", "M MOVE 2:3 Archive\r\n")
+	if want := "M NO Expunge failed"; tagged != want {
+		t.Errorf("MOVE response = %q, want %q", tagged, want)
+	}
+
+	untagged, _ := conn.execLines("S", "S SEARCH DELETED\r\n")
+	if want := []string{"* SEARCH 3"}; !reflect.DeepEqual(untagged, want) {
+		t.Errorf("SEARCH DELETED responses = %q, want %q", untagged, want)
+	}
+}
@@ -36,19 +36,24 @@ func (c *Conn) handleNamespace(dec *imapwire.Decoder) error {
 }
 
 func writeNamespace(enc *imapwire.Encoder, l []imap.NamespaceDescriptor) {
-	if l == nil {
+	if len(l) == 0 {
 		enc.NIL()
 		return
 	}
 
 	enc.List(len(l), func(i int) {
 		descr := l[i]
-		enc.Special('(').String(descr.Prefix).SP()
+		enc.Special('(').Mailbox(descr.Prefix).SP()
 		if descr.Delim == 0 {
 			enc.NIL()
 		} else {
 			enc.Quoted(string(descr.Delim))
 		}
+		for _, ext := range descr.Extensions {
+			enc.SP().String(ext.Name).SP().List(len(ext.Values), func(i int) {
+				enc.String(ext.Values[i])
+			})
+		}
 		enc.Special(')')
 	})
 }
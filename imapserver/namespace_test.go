@@ -0,0 +1,48 @@
+package imapserver_test
+
+import (
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+type namespaceSession struct {
+	*imapmemserver.UserSession
+	data *imap.NamespaceData
+}
+
+func (sess *namespaceSession) Namespace() (*imap.NamespaceData, error) {
+	return sess.data, nil
+}
+
+func TestNamespace(t *testing.T) {
+	data := &imap.NamespaceData{
+		Personal: []imap.NamespaceDescriptor{{Prefix: "", Delim: '\\'}},
+		Other:    []imap.NamespaceDescriptor{},
+		Shared: []imap.NamespaceDescriptor{{
+			Prefix: "#public",
+			Extensions: []imap.NamespaceExtension{
+				{Name: "X-PARAM", Values: []string{"FLAG1", "FLAG2"}},
+				{Name: "TRANSLATION", Values: []string{"Public"}},
+			},
+		}},
+	}
+	conn := newTestConnWithOptions(t, &imapserver.Options{
+		NewSession: func(conn *imapserver.Conn) (imapserver.Session, *imapserver.GreetingData, error) {
+			sess := &namespaceSession{imapmemserver.NewUserSession(newTestUser()), data}
+			return sess, &imapserver.GreetingData{PreAuth: true}, nil
+		},
+	})
+	defer conn.Close()
+
+	untagged, tagged := conn.execLines("T", "T NAMESPACE\r\n")
+	if tagged != "T OK NAMESPACE completed" {
+		t.Errorf("tagged response = %q, want OK", tagged)
+	}
+	want := `* NAMESPACE (("" "\\")) NIL (("#public" NIL "X-PARAM" ("FLAG1" "FLAG2") "TRANSLATION" ("Public")))`
+	if len(untagged) != 1 || untagged[0] != want {
+		t.Errorf("untagged responses = %q, want %q", untagged, want)
+	}
+}
@@ -0,0 +1,186 @@
+package imapserver
+
+import (
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+var notifyEvents = []imap.NotifyEvent{
+	imap.NotifyEventMessageNew,
+	imap.NotifyEventMessageExpunge,
+	imap.NotifyEventFlagChange,
+	imap.NotifyEventAnnotationChange,
+	imap.NotifyEventMailboxName,
+	imap.NotifyEventSubscriptionChange,
+	imap.NotifyEventMailboxMetadataChange,
+	imap.NotifyEventServerMetadataChange,
+}
+
+func (c *Conn) handleNotify(dec *imapwire.Decoder) error {
+	var kind string
+	if !dec.ExpectSP() || !dec.ExpectAtom(&kind) {
+		return dec.Err()
+	}
+
+	var filter *imap.NotifyFilter
+	switch strings.ToUpper(kind) {
+	case "NONE":
+		// nothing to parse
+	case "SET":
+		filter = &imap.NotifyFilter{}
+		if !dec.ExpectSP() {
+			return dec.Err()
+		}
+		var status string
+		if dec.Atom(&status) {
+			if !dec.Expect(strings.EqualFold(status, "STATUS"), "STATUS") || !dec.ExpectSP() {
+				return dec.Err()
+			}
+			filter.Status = true
+		}
+		for {
+			var group imap.NotifyGroup
+			if !dec.ExpectSpecial('(') {
+				return dec.Err()
+			}
+			if err := readNotifyGroup(dec, &group); err != nil {
+				return err
+			}
+			if !dec.ExpectSpecial(')') {
+				return dec.Err()
+			}
+			filter.Groups = append(filter.Groups, group)
+			if !dec.SP() {
+				break
+			}
+		}
+	default:
+		return newClientBugError("Unknown NOTIFY kind")
+	}
+
+	if !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
+		return err
+	}
+	session, ok := c.session.(SessionNotify)
+	if !ok {
+		return newClientBugError("NOTIFY is not supported")
+	}
+
+	return session.Notify(&NotifyWriter{conn: c}, filter)
+}
+
+func readNotifyGroup(dec *imapwire.Decoder, group *imap.NotifyGroup) error {
+	var kind string
+	if !dec.ExpectAtom(&kind) || !dec.ExpectSP() {
+		return dec.Err()
+	}
+	group.Kind = imap.NotifyMailboxesKind(strings.ToUpper(kind))
+	switch group.Kind {
+	case imap.NotifyMailboxesSelected, imap.NotifyMailboxesSelectedDelayed, imap.NotifyMailboxesInboxes, imap.NotifyMailboxesPersonal, imap.NotifyMailboxesSubscribed:
+		// no mailbox list
+	case imap.NotifyMailboxesSubtree, imap.NotifyMailboxesMailboxes:
+		isList, err := dec.List(func() error {
+			var mailbox string
+			if !dec.ExpectMailbox(&mailbox) {
+				return dec.Err()
+			}
+			group.Mailboxes = append(group.Mailboxes, mailbox)
+			return nil
+		})
+		if err != nil {
+			return err
+		} else if !isList {
+			var mailbox string
+			if !dec.ExpectMailbox(&mailbox) {
+				return dec.Err()
+			}
+			group.Mailboxes = append(group.Mailboxes, mailbox)
+		}
+		if !dec.ExpectSP() {
+			return dec.Err()
+		}
+	default:
+		return newClientBugError("Unknown NOTIFY filter")
+	}
+
+	if !dec.Special('(') {
+		var none string
+		if !dec.ExpectAtom(&none) || !dec.Expect(strings.EqualFold(none, "NONE"), "NONE") {
+			return dec.Err()
+		}
+		return nil
+	}
+
+	// The event list can't be parsed with Decoder.List, because MessageNew
+	// may be followed by a SP and a fetch attribute list
+	for {
+		var name string
+		if !dec.ExpectAtom(&name) {
+			return dec.Err()
+		}
+		ev := imap.NotifyEvent(name)
+		for _, known := range notifyEvents {
+			if strings.EqualFold(name, string(known)) {
+				ev = known
+				break
+			}
+		}
+		group.Events = append(group.Events, ev)
+
+		if dec.Special(')') {
+			return nil
+		} else if !dec.ExpectSP() {
+			return dec.Err()
+		}
+
+		if ev != imap.NotifyEventMessageNew {
+			continue
+		}
+		options := &imap.FetchOptions{}
+		writerOptions := fetchWriterOptions{obsolete: make(map[*imap.FetchItemBodySection]string)}
+		isList, err := dec.List(func() error {
+			attName, err := readFetchAttName(dec)
+			if err != nil {
+				return err
+			}
+			return handleFetchAtt(dec, attName, options, &writerOptions)
+		})
+		if err != nil {
+			return err
+		} else if !isList {
+			continue
+		}
+		group.MessageNewFetch = options
+		if dec.Special(')') {
+			return nil
+		} else if !dec.ExpectSP() {
+			return dec.Err()
+		}
+	}
+}
+
+// NotifyWriter writes updates requested with the NOTIFY command.
+//
+// Unlike other writers, it can be retained by the session and used from any
+// goroutine until the session is closed or the NOTIFY filter is replaced.
+type NotifyWriter struct {
+	conn *Conn
+}
+
+// WriteStatus writes an unsolicited STATUS response.
+func (w *NotifyWriter) WriteStatus(data *imap.StatusData, options *imap.StatusOptions) error {
+	return w.conn.writeStatus(data, options, false)
+}
+
+// WriteList writes an unsolicited LIST response.
+//
+// This is used for the MailboxName and SubscriptionChange events.
+func (w *NotifyWriter) WriteList(data *imap.ListData) error {
+	return w.conn.writeList(data)
+}
@@ -0,0 +1,64 @@
+package imapserver
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sync"
+)
+
+// maxPooledBufferSize is the maximum capacity of a buffer put back into a
+// pool. Larger buffers are left to the garbage collector, so that a single
+// large message doesn't pin memory.
+const maxPooledBufferSize = 1 << 20
+
+// copyBufferSize is the size of the buffers used to read data which doesn't
+// need to be kept, e.g. to count its bytes.
+const copyBufferSize = 32 * 1024
+
+var (
+	bufferPool = sync.Pool{
+		New: func() interface{} { return new(bytes.Buffer) },
+	}
+	bufioReaderPool sync.Pool
+	copyBufferPool  = sync.Pool{
+		New: func() interface{} {
+			b := make([]byte, copyBufferSize)
+			return &b
+		},
+	}
+)
+
+func getBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+func getBufioReader(r io.Reader) *bufio.Reader {
+	if br, ok := bufioReaderPool.Get().(*bufio.Reader); ok {
+		br.Reset(r)
+		return br
+	}
+	return bufio.NewReader(r)
+}
+
+func putBufioReader(br *bufio.Reader) {
+	// Drop the reference to the underlying reader
+	br.Reset(nil)
+	bufioReaderPool.Put(br)
+}
+
+func getCopyBuffer() *[]byte {
+	return copyBufferPool.Get().(*[]byte)
+}
+
+func putCopyBuffer(b *[]byte) {
+	copyBufferPool.Put(b)
+}
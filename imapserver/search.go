@@ -3,11 +3,10 @@ package imapserver
 import (
 	"fmt"
 	"strings"
-	"time"
 
 	"github.com/emersion/go-imap/v2"
-	"github.com/emersion/go-imap/v2/internal"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
+	"github.com/emersion/go-imap/v2/internal/searchkey"
 )
 
 func (c *Conn) handleSearch(tag string, dec *imapwire.Decoder, numKind NumKind) error {
@@ -51,16 +50,10 @@ func (c *Conn) handleSearch(tag string, dec *imapwire.Decoder, numKind NumKind)
 
 	var criteria imap.SearchCriteria
 	for {
-		var err error
-		if atom != "" {
-			err = readSearchKeyWithAtom(&criteria, dec, atom)
-			atom = ""
-		} else {
-			err = readSearchKey(&criteria, dec)
-		}
-		if err != nil {
+		if err := imap.ReadSearchKey(&criteria, dec, atom); err != nil {
 			return fmt.Errorf("in search-key: %w", err)
 		}
+		atom = ""
 
 		if !dec.SP() {
 			break
@@ -88,7 +81,7 @@ func (c *Conn) handleSearch(tag string, dec *imapwire.Decoder, numKind NumKind)
 	if c.enabled.Has(imap.CapIMAP4rev2) || extended {
 		return c.writeESearch(tag, data, &options)
 	} else {
-		return c.writeSearch(data.All)
+		return c.writeSearch(data.All, data.ModSeq)
 	}
 }
 
@@ -114,8 +107,11 @@ func (c *Conn) writeESearch(tag string, data *imap.SearchData, options *imap.Sea
 	if options.ReturnMax && data.Max > 0 {
 		enc.SP().Atom("MAX").SP().Number(data.Max)
 	}
-	if options.ReturnCount {
-		enc.SP().Atom("COUNT").SP().Number(data.Count)
+	if options.ReturnCount && data.Count != nil {
+		enc.SP().Atom("COUNT").SP().Number(*data.Count)
+	}
+	if data.ModSeq != 0 {
+		enc.SP().Atom("MODSEQ").SP().ModSeq(data.ModSeq)
 	}
 	return enc.CRLF()
 }
@@ -131,7 +127,7 @@ func isNumSetEmpty(numSet imap.NumSet) bool {
 	}
 }
 
-func (c *Conn) writeSearch(numSet imap.NumSet) error {
+func (c *Conn) writeSearch(numSet imap.NumSet, modSeq imap.ModSeq) error {
 	enc := newResponseEncoder(c)
 	defer enc.end()
 
@@ -154,6 +150,9 @@ func (c *Conn) writeSearch(numSet imap.NumSet) error {
 	if !ok {
 		return fmt.Errorf("imapserver: failed to enumerate message numbers in SEARCH response")
 	}
+	if modSeq != 0 {
+		enc.SP().Special('(').Atom("MODSEQ").SP().ModSeq(modSeq).Special(')')
+	}
 	return enc.CRLF()
 }
 
@@ -185,159 +184,5 @@ func readSearchReturnOpts(dec *imapwire.Decoder, options *imap.SearchOptions) er
 }
 
 func maybeReadSearchKeyAtom(dec *imapwire.Decoder, ptr *string) bool {
-	return dec.Func(ptr, func(ch byte) bool {
-		return ch == '*' || imapwire.IsAtomChar(ch)
-	})
-}
-
-func readSearchKey(criteria *imap.SearchCriteria, dec *imapwire.Decoder) error {
-	var key string
-	if maybeReadSearchKeyAtom(dec, &key) {
-		return readSearchKeyWithAtom(criteria, dec, key)
-	}
-	return dec.ExpectList(func() error {
-		return readSearchKey(criteria, dec)
-	})
-}
-
-func readSearchKeyWithAtom(criteria *imap.SearchCriteria, dec *imapwire.Decoder, key string) error {
-	key = strings.ToUpper(key)
-	switch key {
-	case "ALL":
-		// nothing to do
-	case "UID":
-		var uidSet imap.UIDSet
-		if !dec.ExpectSP() || !dec.ExpectUIDSet(&uidSet) {
-			return dec.Err()
-		}
-		criteria.UID = append(criteria.UID, uidSet)
-	case "ANSWERED", "DELETED", "DRAFT", "FLAGGED", "RECENT", "SEEN":
-		criteria.Flag = append(criteria.Flag, searchKeyFlag(key))
-	case "UNANSWERED", "UNDELETED", "UNDRAFT", "UNFLAGGED", "UNSEEN":
-		notKey := strings.TrimPrefix(key, "UN")
-		criteria.NotFlag = append(criteria.NotFlag, searchKeyFlag(notKey))
-	case "NEW":
-		criteria.Flag = append(criteria.Flag, internal.FlagRecent)
-		criteria.NotFlag = append(criteria.Flag, imap.FlagSeen)
-	case "OLD":
-		criteria.NotFlag = append(criteria.NotFlag, internal.FlagRecent)
-	case "KEYWORD", "UNKEYWORD":
-		if !dec.ExpectSP() {
-			return dec.Err()
-		}
-		flag, err := internal.ExpectFlag(dec)
-		if err != nil {
-			return err
-		}
-		switch key {
-		case "KEYWORD":
-			criteria.Flag = append(criteria.Flag, flag)
-		case "UNKEYWORD":
-			criteria.NotFlag = append(criteria.NotFlag, flag)
-		}
-	case "BCC", "CC", "FROM", "SUBJECT", "TO":
-		var value string
-		if !dec.ExpectSP() || !dec.ExpectAString(&value) {
-			return dec.Err()
-		}
-		criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{
-			Key:   strings.Title(strings.ToLower(key)),
-			Value: value,
-		})
-	case "HEADER":
-		var key, value string
-		if !dec.ExpectSP() || !dec.ExpectAString(&key) || !dec.ExpectSP() || !dec.ExpectAString(&value) {
-			return dec.Err()
-		}
-		criteria.Header = append(criteria.Header, imap.SearchCriteriaHeaderField{
-			Key:   key,
-			Value: value,
-		})
-	case "SINCE", "BEFORE", "ON", "SENTSINCE", "SENTBEFORE", "SENTON":
-		if !dec.ExpectSP() {
-			return dec.Err()
-		}
-		t, err := internal.ExpectDate(dec)
-		if err != nil {
-			return err
-		}
-		var dateCriteria imap.SearchCriteria
-		switch key {
-		case "SINCE":
-			dateCriteria.Since = t
-		case "BEFORE":
-			dateCriteria.Before = t
-		case "ON":
-			dateCriteria.Since = t
-			dateCriteria.Before = t.Add(24 * time.Hour)
-		case "SENTSINCE":
-			dateCriteria.SentSince = t
-		case "SENTBEFORE":
-			dateCriteria.SentBefore = t
-		case "SENTON":
-			dateCriteria.SentSince = t
-			dateCriteria.SentBefore = t.Add(24 * time.Hour)
-		}
-		criteria.And(&dateCriteria)
-	case "BODY":
-		var body string
-		if !dec.ExpectSP() || !dec.ExpectAString(&body) {
-			return dec.Err()
-		}
-		criteria.Body = append(criteria.Body, body)
-	case "TEXT":
-		var text string
-		if !dec.ExpectSP() || !dec.ExpectAString(&text) {
-			return dec.Err()
-		}
-		criteria.Text = append(criteria.Text, text)
-	case "LARGER", "SMALLER":
-		var n int64
-		if !dec.ExpectSP() || !dec.ExpectNumber64(&n) {
-			return dec.Err()
-		}
-		switch key {
-		case "LARGER":
-			criteria.And(&imap.SearchCriteria{Larger: n})
-		case "SMALLER":
-			criteria.And(&imap.SearchCriteria{Smaller: n})
-		}
-	case "NOT":
-		if !dec.ExpectSP() {
-			return dec.Err()
-		}
-		var not imap.SearchCriteria
-		if err := readSearchKey(&not, dec); err != nil {
-			return nil
-		}
-		criteria.Not = append(criteria.Not, not)
-	case "OR":
-		if !dec.ExpectSP() {
-			return dec.Err()
-		}
-		var or [2]imap.SearchCriteria
-		if err := readSearchKey(&or[0], dec); err != nil {
-			return nil
-		}
-		if !dec.ExpectSP() {
-			return dec.Err()
-		}
-		if err := readSearchKey(&or[1], dec); err != nil {
-			return nil
-		}
-		criteria.Or = append(criteria.Or, or)
-	case "$":
-		criteria.UID = append(criteria.UID, imap.SearchRes())
-	default:
-		seqSet, err := imapwire.ParseSeqSet(key)
-		if err != nil {
-			return err
-		}
-		criteria.SeqNum = append(criteria.SeqNum, seqSet)
-	}
-	return nil
-}
-
-func searchKeyFlag(key string) imap.Flag {
-	return imap.Flag("\\" + strings.Title(strings.ToLower(key)))
+	return dec.Func(ptr, searchkey.IsKeyChar)
 }
@@ -0,0 +1,61 @@
+package imapserver_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+// searchCriteriaSession records the criteria of SEARCH commands, without
+// evaluating them.
+type searchCriteriaSession struct {
+	*imapmemserver.UserSession
+	criteria chan *imap.SearchCriteria
+}
+
+func (sess *searchCriteriaSession) Search(kind imapserver.NumKind, criteria *imap.SearchCriteria, options *imap.SearchOptions) (*imap.SearchData, error) {
+	sess.criteria <- criteria
+	return &imap.SearchData{All: imap.SeqSet{}}, nil
+}
+
+func TestSearch_criteriaRoundTrip(t *testing.T) {
+	user := newTestUser()
+	criteriaCh := make(chan *imap.SearchCriteria, 1)
+	tc := newTestConnWithOptions(t, &imapserver.Options{
+		NewSession: func(conn *imapserver.Conn) (imapserver.Session, *imapserver.GreetingData, error) {
+			sess := &searchCriteriaSession{imapmemserver.NewUserSession(user), criteriaCh}
+			return sess, &imapserver.GreetingData{PreAuth: true}, nil
+		},
+		Caps: imap.CapSet{imap.CapIMAP4rev1: {}},
+	})
+	defer tc.Close()
+	tc.expectOK("S", "S SELECT INBOX\r\n")
+
+	older := imap.SearchCriteria{Older: 90 * time.Second}
+	for _, s := range []string{
+		`UNSEEN FROM "bob" SINCE 1-Feb-2024 OR SUBJECT hi SUBJECT hello`,
+		`1,3:5 UID 2:* NOT (DELETED KEYWORD foo) LARGER 10 SMALLER 100`,
+		`HEADER X-Foo "a \"b\"" ON 2-Mar-2024 SENTBEFORE "3-Mar-2024" OLDER 5`,
+		`MODSEQ "/flags/\\seen" shared 7 YOUNGER 60 EMAILID M1 THREADID T1 $`,
+		`NEW OLD ANSWERED UNDRAFT TEXT "" BODY x (CC a (BCC b TO c))`,
+		`OR (UNKEYWORD $Junk SENTON 1-Jan-2024) NOT NOT MODSEQ 0`,
+		older.String(),
+	} {
+		want, err := imap.ParseSearchCriteria(s)
+		if err != nil {
+			t.Fatalf("ParseSearchCriteria(%q) = %v", s, err)
+		}
+		cmd := "T SEARCH " + want.String() + "\r\n"
+		if line := tc.exec("T", cmd); !strings.HasPrefix(line, "T OK") {
+			t.Fatalf("%q: unexpected response: %q", cmd, line)
+		}
+		if got := <-criteriaCh; !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: server parsed %#v, want %#v", cmd, got, want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package imapserver
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
@@ -9,7 +10,37 @@ import (
 
 func (c *Conn) handleSelect(tag string, dec *imapwire.Decoder, readOnly bool) error {
 	var mailbox string
-	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) || !dec.ExpectCRLF() {
+	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) {
+		return dec.Err()
+	}
+
+	options := imap.SelectOptions{ReadOnly: readOnly}
+	if dec.SP() {
+		err := dec.ExpectList(func() error {
+			var name string
+			if !dec.ExpectAtom(&name) {
+				return dec.Err()
+			}
+			switch strings.ToUpper(name) {
+			case "CONDSTORE":
+				options.CondStore = true
+			case "QRESYNC":
+				options.QResync = new(imap.SelectQResync)
+				if !dec.ExpectSP() {
+					return dec.Err()
+				}
+				return readSelectQResync(dec, options.QResync)
+			default:
+				return newClientBugError("Unknown SELECT parameter")
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if !dec.ExpectCRLF() {
 		return dec.Err()
 	}
 
@@ -18,21 +49,34 @@ func (c *Conn) handleSelect(tag string, dec *imapwire.Decoder, readOnly bool) er
 	}
 
 	if c.state == imap.ConnStateSelected {
+		// The previous mailbox is implicitly deselected without expunging
+		// messages, like UNSELECT
 		if err := c.session.Unselect(); err != nil {
 			return err
 		}
 		c.state = imap.ConnStateAuthenticated
-		err := c.writeStatusResp("", &imap.StatusResponse{
-			Type: imap.StatusResponseTypeOK,
-			Code: "CLOSED",
-			Text: "Previous mailbox is now closed",
-		})
-		if err != nil {
+		c.readOnly = false
+		if c.enabled.Has(imap.CapIMAP4rev2) || c.enabled.Has(imap.CapQResync) {
+			err := c.writeStatusResp("", &imap.StatusResponse{
+				Type: imap.StatusResponseTypeOK,
+				Code: imap.ResponseCodeClosed,
+				Text: "Previous mailbox is now closed",
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if options.CondStore {
+		if err := c.enableCondStore(); err != nil {
 			return err
 		}
 	}
+	if options.QResync != nil && !c.enabled.Has(imap.CapQResync) {
+		return newClientBugError("QRESYNC must be enabled")
+	}
 
-	options := imap.SelectOptions{ReadOnly: readOnly}
 	data, err := c.session.Select(mailbox, &options)
 	if err != nil {
 		return err
@@ -46,26 +90,46 @@ func (c *Conn) handleSelect(tag string, dec *imapwire.Decoder, readOnly bool) er
 			return err
 		}
 	}
+	if data.FirstUnseen > 0 && !c.enabled.Has(imap.CapIMAP4rev2) {
+		if err := c.writeObsoleteUnseen(data.FirstUnseen); err != nil {
+			return err
+		}
+	}
 	if err := c.writeUIDValidity(data.UIDValidity); err != nil {
 		return err
 	}
-	if err := c.writeUIDNext(data.UIDNext); err != nil {
-		return err
+	if data.UIDNext > 0 {
+		if err := c.writeUIDNext(data.UIDNext); err != nil {
+			return err
+		}
 	}
 	if err := c.writeFlags(data.Flags); err != nil {
 		return err
 	}
-	if err := c.writePermanentFlags(data.PermanentFlags); err != nil {
-		return err
+	if data.PermanentFlags != nil {
+		if err := c.writePermanentFlags(data.PermanentFlags); err != nil {
+			return err
+		}
 	}
 	if data.List != nil {
 		if err := c.writeList(data.List); err != nil {
 			return err
 		}
 	}
+	if data.HighestModSeq != 0 && c.server.options.caps().Has(imap.CapCondStore) {
+		if err := c.writeHighestModSeq(data.HighestModSeq); err != nil {
+			return err
+		}
+	}
+	// The QRESYNC parameter is ignored if UIDVALIDITY has changed
+	if qresync := options.QResync; qresync != nil && qresync.UIDValidity == data.UIDValidity {
+		if err := c.writeQResync(qresync); err != nil {
+			return err
+		}
+	}
 
 	c.state = imap.ConnStateSelected
-	// TODO: forbid write commands in read-only mode
+	c.readOnly = readOnly || data.ReadOnly
 
 	var (
 		cmdName string
@@ -73,10 +137,13 @@ func (c *Conn) handleSelect(tag string, dec *imapwire.Decoder, readOnly bool) er
 	)
 	if readOnly {
 		cmdName = "EXAMINE"
-		code = "READ-ONLY"
 	} else {
 		cmdName = "SELECT"
-		code = "READ-WRITE"
+	}
+	if c.readOnly {
+		code = imap.ResponseCodeReadOnly
+	} else {
+		code = imap.ResponseCodeReadWrite
 	}
 	return c.writeStatusResp(tag, &imap.StatusResponse{
 		Type: imap.StatusResponseTypeOK,
@@ -94,7 +161,9 @@ func (c *Conn) handleUnselect(dec *imapwire.Decoder, expunge bool) error {
 		return err
 	}
 
-	if expunge {
+	// CLOSE silently expunges messages, unless the mailbox is read-only. A
+	// nil connection in ExpungeWriter suppresses EXPUNGE responses.
+	if expunge && !c.readOnly {
 		w := &ExpungeWriter{}
 		if err := c.session.Expunge(w, nil); err != nil {
 			return err
@@ -106,9 +175,78 @@ func (c *Conn) handleUnselect(dec *imapwire.Decoder, expunge bool) error {
 	}
 
 	c.state = imap.ConnStateAuthenticated
+	c.readOnly = false
 	return nil
 }
 
+// checkWritable returns an error if the selected mailbox is read-only.
+func (c *Conn) checkWritable() error {
+	if c.readOnly {
+		return &imap.Error{
+			Type: imap.StatusResponseTypeNo,
+			Text: "Mailbox is read-only",
+		}
+	}
+	return nil
+}
+
+func readSelectQResync(dec *imapwire.Decoder, qresync *imap.SelectQResync) error {
+	if !dec.ExpectSpecial('(') || !dec.ExpectNumber(&qresync.UIDValidity) || !dec.ExpectSP() || !dec.ExpectModSeq(&qresync.ModSeq) {
+		return dec.Err()
+	}
+	if dec.SP() {
+		if !dec.ExpectUIDSet(&qresync.KnownUIDs) {
+			return dec.Err()
+		}
+		// The optional sequence match data is ignored
+		if dec.SP() {
+			var (
+				seqNums imap.NumSet
+				uids    imap.UIDSet
+			)
+			if !dec.ExpectSpecial('(') || !dec.ExpectNumSet(imapwire.NumKindSeq, &seqNums) || !dec.ExpectSP() || !dec.ExpectUIDSet(&uids) || !dec.ExpectSpecial(')') {
+				return dec.Err()
+			}
+		}
+	}
+	if !dec.ExpectSpecial(')') {
+		return dec.Err()
+	}
+	return nil
+}
+
+// writeQResync writes the VANISHED (EARLIER) and FETCH responses for a SELECT
+// command with the QRESYNC parameter.
+func (c *Conn) writeQResync(qresync *imap.SelectQResync) error {
+	vanished, err := c.session.(SessionQResync).Vanished(qresync.ModSeq)
+	if err != nil {
+		return err
+	}
+	if len(qresync.KnownUIDs) > 0 {
+		var known imap.UIDSet
+		nums, _ := vanished.Nums()
+		for _, uid := range nums {
+			if qresync.KnownUIDs.Contains(uid) {
+				known.AddNum(uid)
+			}
+		}
+		vanished = known
+	}
+	if len(vanished) > 0 {
+		if err := c.writeVanished(vanished, true); err != nil {
+			return err
+		}
+	}
+
+	w := &FetchWriter{conn: c}
+	return c.session.Fetch(w, imap.UIDSet{{Start: 1, Stop: 0}}, &imap.FetchOptions{
+		UID:          true,
+		Flags:        true,
+		ModSeq:       true,
+		ChangedSince: qresync.ModSeq,
+	})
+}
+
 func (c *Conn) writeExists(numMessages uint32) error {
 	enc := newResponseEncoder(c)
 	defer enc.end()
@@ -121,12 +259,21 @@ func (c *Conn) writeObsoleteRecent() error {
 	return enc.Atom("*").SP().Number(0).SP().Atom("RECENT").CRLF()
 }
 
+func (c *Conn) writeObsoleteUnseen(seqNum uint32) error {
+	enc := newResponseEncoder(c)
+	defer enc.end()
+	enc.Atom("*").SP().Atom("OK").SP()
+	writeRespCode(enc.Encoder, imap.UnseenCode{SeqNum: seqNum})
+	enc.Text("First unseen message")
+	return enc.CRLF()
+}
+
 func (c *Conn) writeUIDValidity(uidValidity uint32) error {
 	enc := newResponseEncoder(c)
 	defer enc.end()
 	enc.Atom("*").SP().Atom("OK").SP()
-	enc.Special('[').Atom("UIDVALIDITY").SP().Number(uidValidity).Special(']')
-	enc.SP().Text("UIDs valid")
+	writeRespCode(enc.Encoder, imap.UIDValidityCode{UIDValidity: uidValidity})
+	enc.Text("UIDs valid")
 	return enc.CRLF()
 }
 
@@ -134,8 +281,17 @@ func (c *Conn) writeUIDNext(uidNext imap.UID) error {
 	enc := newResponseEncoder(c)
 	defer enc.end()
 	enc.Atom("*").SP().Atom("OK").SP()
-	enc.Special('[').Atom("UIDNEXT").SP().UID(uidNext).Special(']')
-	enc.SP().Text("Predicted next UID")
+	writeRespCode(enc.Encoder, imap.UIDNextCode{UIDNext: uidNext})
+	enc.Text("Predicted next UID")
+	return enc.CRLF()
+}
+
+func (c *Conn) writeHighestModSeq(modSeq imap.ModSeq) error {
+	enc := newResponseEncoder(c)
+	defer enc.end()
+	enc.Atom("*").SP().Atom("OK").SP()
+	writeRespCode(enc.Encoder, imap.HighestModSeqCode{HighestModSeq: modSeq})
+	enc.Text("Highest mod-sequence")
 	return enc.CRLF()
 }
 
@@ -152,9 +308,7 @@ func (c *Conn) writePermanentFlags(flags []imap.Flag) error {
 	enc := newResponseEncoder(c)
 	defer enc.end()
 	enc.Atom("*").SP().Atom("OK").SP()
-	enc.Special('[').Atom("PERMANENTFLAGS").SP().List(len(flags), func(i int) {
-		enc.Flag(flags[i])
-	}).Special(']')
-	enc.SP().Text("Permanent flags")
+	writeRespCode(enc.Encoder, imap.PermanentFlagsCode{Flags: flags})
+	enc.Text("Permanent flags")
 	return enc.CRLF()
 }
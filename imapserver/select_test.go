@@ -0,0 +1,147 @@
+package imapserver_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+// selectDataSession overrides the data returned by SELECT.
+type selectDataSession struct {
+	*imapmemserver.UserSession
+	f func(data *imap.SelectData)
+}
+
+func (sess *selectDataSession) Select(name string, options *imap.SelectOptions) (*imap.SelectData, error) {
+	data, err := sess.UserSession.Select(name, options)
+	if err != nil {
+		return nil, err
+	}
+	sess.f(data)
+	return data, nil
+}
+
+func newSelectTestConn(t *testing.T, f func(data *imap.SelectData)) *testConn {
+	user := newTestUser()
+	return newTestConnWithOptions(t, &imapserver.Options{
+		NewSession: func(conn *imapserver.Conn) (imapserver.Session, *imapserver.GreetingData, error) {
+			sess := &selectDataSession{imapmemserver.NewUserSession(user), f}
+			return sess, &imapserver.GreetingData{PreAuth: true}, nil
+		},
+		Caps: imap.CapSet{imap.CapIMAP4rev1: {}},
+	})
+}
+
+// selectRespCodes returns the response codes returned by a SELECT or EXAMINE
+// command.
+func selectRespCodes(untagged []string, tagged string) []string {
+	var codes []string
+	for _, line := range append(untagged, tagged) {
+		i := strings.IndexByte(line, '[')
+		j := strings.IndexByte(line, ']')
+		if i < 0 || j < i {
+			continue
+		}
+		codes = append(codes, line[i+1:j])
+	}
+	return codes
+}
+
+func TestSelect_permanentFlags(t *testing.T) {
+	conn := newSelectTestConn(t, func(data *imap.SelectData) {
+		data.PermanentFlags = []imap.Flag{imap.FlagSeen, imap.FlagDeleted}
+		data.FirstUnseen = 1
+	})
+	defer conn.Close()
+
+	untagged, tagged := conn.execLines("S", "S SELECT INBOX\r\n")
+	if !strings.HasPrefix(tagged, "S OK") {
+		t.Fatalf("unexpected response: %q", tagged)
+	}
+
+	want := []string{
+		"UNSEEN 1",
+		"UIDVALIDITY 1",
+		"UIDNEXT 2",
+		"PERMANENTFLAGS (\\Seen \\Deleted)",
+		"READ-WRITE",
+	}
+	if got := selectRespCodes(untagged, tagged); !reflect.DeepEqual(got, want) {
+		t.Errorf("response codes = %q, want %q", got, want)
+	}
+}
+
+func TestSelect_examine(t *testing.T) {
+	conn := newSelectTestConn(t, func(data *imap.SelectData) {
+		data.PermanentFlags = nil
+		data.UIDNext = 0
+	})
+	defer conn.Close()
+
+	untagged, tagged := conn.execLines("E", "E EXAMINE INBOX\r\n")
+	if !strings.HasPrefix(tagged, "E OK") {
+		t.Fatalf("unexpected response: %q", tagged)
+	}
+
+	want := []string{"UIDVALIDITY 1", "READ-ONLY"}
+	if got := selectRespCodes(untagged, tagged); !reflect.DeepEqual(got, want) {
+		t.Errorf("response codes = %q, want %q", got, want)
+	}
+}
+
+func TestSelect_readOnlyBackend(t *testing.T) {
+	conn := newSelectTestConn(t, func(data *imap.SelectData) {
+		data.ReadOnly = true
+	})
+	defer conn.Close()
+
+	_, tagged := conn.execLines("S", "S SELECT INBOX\r\n")
+	if !strings.HasPrefix(tagged, "S OK [READ-ONLY]") {
+		t.Errorf("unexpected response: %q", tagged)
+	}
+}
+
+func TestSelect_closed(t *testing.T) {
+	conn := newTestConn(t)
+	defer conn.Close()
+
+	untagged, _ := conn.execLines("S", "S SELECT INBOX\r\n")
+	for _, line := range untagged {
+		if strings.Contains(line, "[CLOSED]") {
+			t.Errorf("unexpected CLOSED response code without IMAP4rev2: %q", line)
+		}
+	}
+
+	conn.expectOK("E", "E ENABLE IMAP4rev2\r\n")
+
+	untagged, _ = conn.execLines("S", "S SELECT INBOX\r\n")
+	if len(untagged) == 0 || untagged[0] != "* OK [CLOSED] Previous mailbox is now closed" {
+		t.Errorf("expected CLOSED response code first, got %q", untagged)
+	}
+}
+
+func TestSelect_readOnlyCommands(t *testing.T) {
+	conn := newTestConn(t)
+	defer conn.Close()
+
+	conn.expectOK("E", "E EXAMINE INBOX\r\n")
+	for _, cmd := range []string{
+		"C1 STORE 1 +FLAGS (\\Deleted)\r\n",
+		"C2 UID STORE 1 -FLAGS (\\Seen)\r\n",
+		"C3 EXPUNGE\r\n",
+		"C4 MOVE 1 INBOX\r\n",
+	} {
+		tag, _, _ := strings.Cut(cmd, " ")
+		_, tagged := conn.execLines(tag, cmd)
+		if want := tag + " NO Mailbox is read-only"; tagged != want {
+			t.Errorf("%q: got %q, want %q", strings.TrimSpace(cmd), tagged, want)
+		}
+	}
+
+	conn.expectOK("S", "S SELECT INBOX\r\n")
+	conn.expectOK("C", "C STORE 1 +FLAGS (\\Deleted)\r\n")
+}
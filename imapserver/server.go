@@ -38,8 +38,22 @@ type Options struct {
 	//   - ESEARCH
 	//   - LIST-EXTENDED
 	//   - LIST-STATUS
-	//   - MOVE
 	//   - STATUS=SIZE
+	//   - BINARY
+	//
+	// The following capabilities can be added, with the listed requirements:
+	//
+	//   - COMPRESS=DEFLATE: none, clients can then compress the connection
+	//   - ACL: sessions implement SessionACL
+	//   - CONDSTORE: sessions track mod-sequences, see below
+	//   - QRESYNC: sessions implement SessionQResync
+	//   - NOTIFY: sessions implement SessionNotify
+	//   - MULTIAPPEND: sessions implement SessionMultiAppend
+	//   - SPECIAL-USE: sessions handle special-use attributes in LIST
+	//
+	// With CONDSTORE, Session.Store reports messages failing the
+	// UNCHANGEDSINCE test by returning an *imap.Error with the OK type, the
+	// MODIFIED response code and an imap.ModifiedCodeArg argument.
 	Caps imap.CapSet
 	// Logger is a logger to print error messages. If nil, log.Default is used.
 	Logger Logger
@@ -49,6 +63,31 @@ type Options struct {
 	// InsecureAuth allows clients to authenticate without TLS. In this mode,
 	// the server is susceptible to man-in-the-middle attacks.
 	InsecureAuth bool
+	// IdleKeepAliveInterval is the interval at which untagged OK responses
+	// are sent to clients in IDLE, to prevent intermediaries from dropping
+	// the connection. The timer is reset whenever a response is sent. If
+	// zero, no keep-alive responses are sent.
+	IdleKeepAliveInterval time.Duration
+	// DisableAppendNormalization disables normalization of APPEND literals.
+	//
+	// By default, bare CR and LF characters in APPEND literals are converted
+	// to CRLF, and NUL bytes are rejected. The reader passed to
+	// Session.Append may then return more bytes than its announced size.
+	// Literal8 data (sent with BINARY) is never normalized.
+	DisableAppendNormalization bool
+	// AuthThrottler is used to delay replies to failed LOGIN and
+	// AUTHENTICATE commands. If nil, failed attempts are not throttled. See
+	// MemoryAuthThrottler for a built-in implementation.
+	AuthThrottler AuthThrottler
+	// MaxAuthFailures is the maximum number of failed authentication
+	// attempts on a single connection. Once reached, the connection is
+	// closed with BYE. If zero, there is no limit.
+	MaxAuthFailures int
+	// ReadBufferSize and WriteBufferSize are the sizes of the buffers used
+	// to read commands and to write responses. Responses to a command are
+	// buffered and sent at once when the command completes, or whenever the
+	// write buffer is full. If zero, 4096 bytes are used.
+	ReadBufferSize, WriteBufferSize int
 	// Raw ingress and egress data will be written to this writer, if any.
 	// Note, this may include sensitive information such as credentials used
 	// during authentication.
@@ -68,6 +107,17 @@ func (options *Options) wrapReadWriter(rw io.ReadWriter) io.ReadWriter {
 	}
 }
 
+func (options *Options) bufferSizes() (read, write int) {
+	read, write = options.ReadBufferSize, options.WriteBufferSize
+	if read <= 0 {
+		read = defaultBufferSize
+	}
+	if write <= 0 {
+		write = defaultBufferSize
+	}
+	return read, write
+}
+
 func (options *Options) caps() imap.CapSet {
 	if options.Caps != nil {
 		return options.Caps
@@ -84,7 +84,68 @@ type SessionNamespace interface {
 	Namespace() (*imap.NamespaceData, error)
 }
 
+// SessionACL is an IMAP session which supports ACL.
+type SessionACL interface {
+	Session
+
+	// Authenticated state
+	SetACL(mailbox string, ri imap.RightsIdentifier, rm imap.RightModification, rs imap.RightSet) error
+	DeleteACL(mailbox string, ri imap.RightsIdentifier) error
+	GetACL(mailbox string) (map[imap.RightsIdentifier]imap.RightSet, error)
+	ListRights(mailbox string, ri imap.RightsIdentifier) (required imap.RightSet, optional []imap.RightSet, err error)
+	MyRights(mailbox string) (imap.RightSet, error)
+}
+
+// SessionQResync is an IMAP session which supports QRESYNC.
+//
+// The session needs to support CONDSTORE as well. Mailbox trackers need to be
+// notified of expunged messages with MailboxTracker.QueueExpungeUID.
+type SessionQResync interface {
+	Session
+
+	// Selected state
+
+	// Vanished returns the UIDs of the messages expunged since the provided
+	// mod-sequence. Sessions which don't keep track of all expunged messages
+	// may return more UIDs.
+	Vanished(modSeq imap.ModSeq) (imap.UIDSet, error)
+}
+
+// SessionNotify is an IMAP session which supports NOTIFY.
+type SessionNotify interface {
+	Session
+
+	// Authenticated state
+
+	// Notify replaces the NOTIFY filter of the session. A nil filter means
+	// that no notification should be sent anymore.
+	//
+	// The NotifyWriter can be retained to send updates until the filter is
+	// replaced or the session is closed.
+	Notify(w *NotifyWriter, filter *imap.NotifyFilter) error
+}
+
+// SessionMultiAppend is an IMAP session which supports MULTIAPPEND.
+//
+// If a session implements this interface, MultiAppend is used instead of
+// Session.Append for all APPEND commands, including the ones with a single
+// message.
+type SessionMultiAppend interface {
+	Session
+
+	// Authenticated state
+
+	// MultiAppend appends one or more messages to a mailbox. Messages are
+	// read with MultiAppendReader.Next until it returns io.EOF. Either all
+	// messages must be appended, or none.
+	MultiAppend(mailbox string, r *MultiAppendReader) (*imap.AppendData, error)
+}
+
 // SessionMove is an IMAP session which supports MOVE.
+//
+// If a session doesn't implement this interface, MOVE is implemented with
+// COPY, STORE and UID EXPUNGE. Sessions should implement it if they can move
+// messages atomically.
 type SessionMove interface {
 	Session
 
@@ -96,7 +157,6 @@ type SessionMove interface {
 type SessionIMAP4rev2 interface {
 	Session
 	SessionNamespace
-	SessionMove
 }
 
 // SessionSASL is an IMAP session which supports its own set of SASL
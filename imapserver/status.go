@@ -49,36 +49,44 @@ func (c *Conn) writeStatus(data *imap.StatusData, options *imap.StatusOptions, r
 	defer enc.end()
 
 	enc.Atom("*").SP().Atom("STATUS").SP().Mailbox(data.Mailbox).SP()
+	// Items requested by the client but left unset by the session are
+	// omitted, except APPENDLIMIT: a nil limit is sent as NIL (unlimited)
 	listEnc := enc.BeginList()
-	if options.NumMessages {
+	if options.NumMessages && data.NumMessages != nil {
 		listEnc.Item().Atom("MESSAGES").SP().Number(*data.NumMessages)
 	}
-	if options.UIDNext {
+	if options.UIDNext && data.UIDNext != 0 {
 		listEnc.Item().Atom("UIDNEXT").SP().UID(data.UIDNext)
 	}
-	if options.UIDValidity {
+	if options.UIDValidity && data.UIDValidity != 0 {
 		listEnc.Item().Atom("UIDVALIDITY").SP().Number(data.UIDValidity)
 	}
-	if options.NumUnseen {
+	if options.NumUnseen && data.NumUnseen != nil {
 		listEnc.Item().Atom("UNSEEN").SP().Number(*data.NumUnseen)
 	}
-	if options.NumDeleted {
+	if options.NumDeleted && data.NumDeleted != nil {
 		listEnc.Item().Atom("DELETED").SP().Number(*data.NumDeleted)
 	}
-	if options.Size {
+	if options.Size && data.Size != nil {
 		listEnc.Item().Atom("SIZE").SP().Number64(*data.Size)
 	}
 	if options.AppendLimit {
 		listEnc.Item().Atom("APPENDLIMIT").SP()
-		if data.AppendLimit != nil {
+		if data.AppendLimit != nil && *data.AppendLimit != ^uint32(0) {
 			enc.Number(*data.AppendLimit)
 		} else {
 			enc.NIL()
 		}
 	}
-	if options.DeletedStorage {
+	if options.DeletedStorage && data.DeletedStorage != nil {
 		listEnc.Item().Atom("DELETED-STORAGE").SP().Number64(*data.DeletedStorage)
 	}
+	if options.HighestModSeq && data.HighestModSeq != 0 {
+		listEnc.Item().Atom("HIGHESTMODSEQ").SP().ModSeq(data.HighestModSeq)
+	}
+	if options.MailboxID && data.MailboxID != "" {
+		listEnc.Item().Atom("MAILBOXID").SP().Special('(').Atom(data.MailboxID).Special(')')
+	}
 	if recent {
 		listEnc.Item().Atom("RECENT").SP().Number(0)
 	}
@@ -109,6 +117,10 @@ func readStatusItem(dec *imapwire.Decoder, options *imap.StatusOptions) (isRecen
 		options.AppendLimit = true
 	case "DELETED-STORAGE":
 		options.DeletedStorage = true
+	case "HIGHESTMODSEQ":
+		options.HighestModSeq = true
+	case "MAILBOXID":
+		options.MailboxID = true
 	case "RECENT":
 		isRecent = true
 	default:
@@ -0,0 +1,58 @@
+package imapserver_test
+
+import (
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+type statusSession struct {
+	*imapmemserver.UserSession
+	data *imap.StatusData
+}
+
+func (sess *statusSession) Status(name string, options *imap.StatusOptions) (*imap.StatusData, error) {
+	data := *sess.data
+	data.Mailbox = name
+	return &data, nil
+}
+
+func TestStatus_partialData(t *testing.T) {
+	numMessages, appendLimit := uint32(42), ^uint32(0)
+	tests := []struct {
+		data *imap.StatusData
+		want string
+	}{
+		{
+			data: &imap.StatusData{NumMessages: &numMessages},
+			want: "* STATUS INBOX (MESSAGES 42 APPENDLIMIT NIL)",
+		},
+		{
+			data: &imap.StatusData{
+				AppendLimit:   &appendLimit,
+				HighestModSeq: 7011231777,
+				MailboxID:     "F2212ea87-6097-4256-9d51-71338625",
+			},
+			want: "* STATUS INBOX (APPENDLIMIT NIL HIGHESTMODSEQ 7011231777 MAILBOXID (F2212ea87-6097-4256-9d51-71338625))",
+		},
+	}
+	for _, tc := range tests {
+		user := newTestUser()
+		conn := newTestConnWithOptions(t, &imapserver.Options{
+			NewSession: func(conn *imapserver.Conn) (imapserver.Session, *imapserver.GreetingData, error) {
+				sess := &statusSession{imapmemserver.NewUserSession(user), tc.data}
+				return sess, &imapserver.GreetingData{PreAuth: true}, nil
+			},
+		})
+		untagged, tagged := conn.execLines("T", "T STATUS INBOX (MESSAGES UNSEEN DELETED SIZE APPENDLIMIT DELETED-STORAGE HIGHESTMODSEQ MAILBOXID)\r\n")
+		if tagged != "T OK STATUS completed" {
+			t.Errorf("tagged response = %q, want OK", tagged)
+		}
+		if len(untagged) != 1 || untagged[0] != tc.want {
+			t.Errorf("untagged responses = %q, want %q", untagged, tc.want)
+		}
+		conn.Close()
+	}
+}
@@ -1,6 +1,7 @@
 package imapserver
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/emersion/go-imap/v2"
@@ -13,12 +14,36 @@ func (c *Conn) handleStore(dec *imapwire.Decoder, numKind NumKind) error {
 		numSet imap.NumSet
 		item   string
 	)
-	if !dec.ExpectSP() || !dec.ExpectNumSet(numKind.wire(), &numSet) || !dec.ExpectSP() || !dec.ExpectAtom(&item) || !dec.ExpectSP() {
+	if !dec.ExpectSP() || !dec.ExpectNumSet(numKind.wire(), &numSet) || !dec.ExpectSP() {
 		return dec.Err()
 	}
-	var flags []imap.Flag
+	var options imap.StoreOptions
 	isList, err := dec.List(func() error {
-		flag, err := internal.ExpectFlag(dec)
+		var name string
+		if !dec.ExpectAtom(&name) {
+			return dec.Err()
+		}
+		switch strings.ToUpper(name) {
+		case "UNCHANGEDSINCE":
+			if !dec.ExpectSP() || !dec.ExpectModSeq(&options.UnchangedSince) {
+				return dec.Err()
+			}
+		default:
+			return newClientBugError("Unknown STORE modifier")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	} else if isList && !dec.ExpectSP() {
+		return dec.Err()
+	}
+	if !dec.ExpectAtom(&item) || !dec.ExpectSP() {
+		return dec.Err()
+	}
+	var flags []imap.Flag
+	isList, err = dec.List(func() error {
+		flag, err := expectMessageFlag(dec)
 		if err != nil {
 			return err
 		}
@@ -29,7 +54,7 @@ func (c *Conn) handleStore(dec *imapwire.Decoder, numKind NumKind) error {
 		return err
 	} else if !isList {
 		for {
-			flag, err := internal.ExpectFlag(dec)
+			flag, err := expectMessageFlag(dec)
 			if err != nil {
 				return err
 			}
@@ -67,12 +92,31 @@ func (c *Conn) handleStore(dec *imapwire.Decoder, numKind NumKind) error {
 	if err := c.checkState(imap.ConnStateSelected); err != nil {
 		return err
 	}
+	if err := c.checkWritable(); err != nil {
+		return err
+	}
+
+	if options.UnchangedSince != 0 {
+		if err := c.enableCondStore(); err != nil {
+			return err
+		}
+	}
 
 	w := &FetchWriter{conn: c}
-	options := imap.StoreOptions{}
 	return c.session.Store(w, numSet, &imap.StoreFlags{
 		Op:     op,
 		Silent: silent,
 		Flags:  flags,
 	}, &options)
 }
+
+// expectMessageFlag reads a flag which can be set on a message.
+func expectMessageFlag(dec *imapwire.Decoder) (imap.Flag, error) {
+	flag, err := internal.ExpectFlag(dec)
+	if err != nil {
+		return "", err
+	} else if !flag.Valid() {
+		return "", newClientBugError(fmt.Sprintf("Invalid flag %q", flag))
+	}
+	return flag, nil
+}
@@ -0,0 +1,216 @@
+package imapserver
+
+import (
+	"errors"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// AuthThrottler keeps track of failed authentication attempts and slows down
+// clients trying to guess credentials.
+//
+// Implementations can store their state in an external database to share it
+// between multiple servers. They must be safe for concurrent use.
+type AuthThrottler interface {
+	// AuthFailed records a failed authentication attempt, and returns the
+	// delay to wait before replying to the client.
+	//
+	// The username may be empty if it isn't known, e.g. for SASL mechanisms
+	// other than PLAIN.
+	AuthFailed(remoteAddr net.Addr, username string) time.Duration
+	// AuthSucceeded resets the failed attempts counters for the remote
+	// address and username.
+	AuthSucceeded(remoteAddr net.Addr, username string)
+}
+
+const (
+	defaultAuthThrottleThreshold = 3
+	defaultAuthThrottleBaseDelay = time.Second
+	defaultAuthThrottleMaxDelay  = 30 * time.Second
+	defaultAuthThrottleWindow    = 15 * time.Minute
+)
+
+// MemoryAuthThrottler is an AuthThrottler which stores failed authentication
+// attempts in memory.
+//
+// Failed attempts are counted per remote IP address and per username. Once
+// more than Threshold failures have been recorded for either of them, each
+// new failure is delayed, starting with BaseDelay and doubling up to
+// MaxDelay. Counters are reset after Window has elapsed since the last
+// failure.
+//
+// The zero value is ready to use.
+type MemoryAuthThrottler struct {
+	// Number of failures allowed without delay. If zero, 3 is used.
+	Threshold int
+	// Delay after the first throttled failure. If zero, 1s is used.
+	BaseDelay time.Duration
+	// Maximum delay. If zero, 30s is used.
+	MaxDelay time.Duration
+	// Duration after which failures are forgotten. If zero, 15min is used.
+	Window time.Duration
+	// Now returns the current time. If nil, time.Now is used.
+	Now func() time.Time
+
+	mutex     sync.Mutex
+	failures  map[string]*authFailures
+	lastPrune time.Time
+}
+
+var _ AuthThrottler = (*MemoryAuthThrottler)(nil)
+
+type authFailures struct {
+	count int
+	last  time.Time
+}
+
+func (t *MemoryAuthThrottler) now() time.Time {
+	if t.Now != nil {
+		return t.Now()
+	}
+	return time.Now()
+}
+
+func (t *MemoryAuthThrottler) window() time.Duration {
+	if t.Window > 0 {
+		return t.Window
+	}
+	return defaultAuthThrottleWindow
+}
+
+// AuthFailed implements AuthThrottler.
+func (t *MemoryAuthThrottler) AuthFailed(remoteAddr net.Addr, username string) time.Duration {
+	now := t.now()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.failures == nil {
+		t.failures = make(map[string]*authFailures)
+	}
+	t.pruneLocked(now)
+
+	count := 0
+	for _, k := range authThrottleKeys(remoteAddr, username) {
+		f := t.failures[k]
+		if f == nil || now.Sub(f.last) >= t.window() {
+			f = &authFailures{}
+			t.failures[k] = f
+		}
+		f.count++
+		f.last = now
+		if f.count > count {
+			count = f.count
+		}
+	}
+
+	return t.delay(count)
+}
+
+// AuthSucceeded implements AuthThrottler.
+func (t *MemoryAuthThrottler) AuthSucceeded(remoteAddr net.Addr, username string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, k := range authThrottleKeys(remoteAddr, username) {
+		delete(t.failures, k)
+	}
+}
+
+// pruneLocked drops expired counters, at most once per window.
+func (t *MemoryAuthThrottler) pruneLocked(now time.Time) {
+	window := t.window()
+	if now.Sub(t.lastPrune) < window {
+		return
+	}
+	for k, f := range t.failures {
+		if now.Sub(f.last) >= window {
+			delete(t.failures, k)
+		}
+	}
+	t.lastPrune = now
+}
+
+func (t *MemoryAuthThrottler) delay(count int) time.Duration {
+	threshold := t.Threshold
+	if threshold <= 0 {
+		threshold = defaultAuthThrottleThreshold
+	}
+	if count <= threshold {
+		return 0
+	}
+
+	baseDelay := t.BaseDelay
+	if baseDelay <= 0 {
+		baseDelay = defaultAuthThrottleBaseDelay
+	}
+	maxDelay := t.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = defaultAuthThrottleMaxDelay
+	}
+
+	n := count - threshold - 1
+	if n >= 62 || float64(baseDelay)*math.Pow(2, float64(n)) >= float64(maxDelay) {
+		return maxDelay
+	}
+	return baseDelay << uint(n)
+}
+
+func authThrottleKeys(remoteAddr net.Addr, username string) []string {
+	var keys []string
+	if remoteAddr != nil {
+		host := remoteAddr.String()
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		keys = append(keys, "addr:"+host)
+	}
+	if username != "" {
+		keys = append(keys, "user:"+username)
+	}
+	return keys
+}
+
+// authFailed handles a failed LOGIN or AUTHENTICATE command.
+//
+// Only NO responses are considered failed attempts. If an AuthThrottler is
+// configured, the reply is delayed. If the connection has reached
+// MaxAuthFailures, the NO response is followed by BYE.
+func (c *Conn) authFailed(tag, username string, err error) error {
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) || imapErr.Type != imap.StatusResponseTypeNo {
+		return err
+	}
+
+	if throttler := c.server.options.AuthThrottler; throttler != nil {
+		if delay := throttler.AuthFailed(c.conn.RemoteAddr(), username); delay > 0 {
+			time.Sleep(delay)
+		}
+	}
+
+	c.authFailures++
+	max := c.server.options.MaxAuthFailures
+	if max <= 0 || c.authFailures < max {
+		return err
+	}
+
+	if err := c.writeStatusResp(tag, (*imap.StatusResponse)(imapErr)); err != nil {
+		return err
+	}
+	c.state = imap.ConnStateLogout
+	return c.writeStatusResp("", &imap.StatusResponse{
+		Type: imap.StatusResponseTypeBye,
+		Text: "Too many authentication failures",
+	})
+}
+
+func (c *Conn) authSucceeded(username string) {
+	c.authFailures = 0
+	if throttler := c.server.options.AuthThrottler; throttler != nil {
+		throttler.AuthSucceeded(c.conn.RemoteAddr(), username)
+	}
+}
@@ -0,0 +1,111 @@
+package imapserver_test
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (clock *fakeClock) Now() time.Time {
+	return clock.now
+}
+
+func (clock *fakeClock) Advance(d time.Duration) {
+	clock.now = clock.now.Add(d)
+}
+
+func TestMemoryAuthThrottler(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	throttler := &imapserver.MemoryAuthThrottler{
+		Threshold: 2,
+		BaseDelay: time.Second,
+		MaxDelay:  5 * time.Second,
+		Window:    time.Hour,
+		Now:       clock.Now,
+	}
+	addr := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1234}
+
+	schedule := []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, want := range schedule {
+		if got := throttler.AuthFailed(addr, "alice"); got != want {
+			t.Errorf("AuthFailed() #%v = %v, want %v", i+1, got, want)
+		}
+		clock.Advance(time.Minute)
+	}
+
+	// Same IP address, another port and username
+	otherPort := &net.TCPAddr{IP: addr.IP, Port: 4321}
+	if got := throttler.AuthFailed(otherPort, "bob"); got != 5*time.Second {
+		t.Errorf("AuthFailed() from same IP = %v, want %v", got, 5*time.Second)
+	}
+
+	throttler.AuthSucceeded(addr, "alice")
+	if got := throttler.AuthFailed(addr, "alice"); got != 0 {
+		t.Errorf("AuthFailed() after success = %v, want 0", got)
+	}
+
+	// Same username, another IP address
+	for i := 0; i < 3; i++ {
+		throttler.AuthFailed(&net.TCPAddr{IP: net.IPv4(198, 51, 100, byte(i))}, "carol")
+	}
+	if got := throttler.AuthFailed(&net.TCPAddr{IP: net.IPv4(203, 0, 113, 1)}, "carol"); got != 2*time.Second {
+		t.Errorf("AuthFailed() for same username = %v, want %v", got, 2*time.Second)
+	}
+
+	clock.Advance(time.Hour)
+	if got := throttler.AuthFailed(addr, "alice"); got != 0 {
+		t.Errorf("AuthFailed() after window = %v, want 0", got)
+	}
+}
+
+func TestConn_maxAuthFailures(t *testing.T) {
+	memServer := imapmemserver.New()
+	memServer.AddUser(newTestUser())
+
+	clock := &fakeClock{now: time.Now()}
+	throttler := &imapserver.MemoryAuthThrottler{
+		Threshold: 1,
+		BaseDelay: time.Millisecond,
+		Now:       clock.Now,
+	}
+	conn := newTestConnWithOptions(t, &imapserver.Options{
+		NewSession: func(conn *imapserver.Conn) (imapserver.Session, *imapserver.GreetingData, error) {
+			return memServer.NewSession(), nil, nil
+		},
+		InsecureAuth:    true,
+		Caps:            imap.CapSet{imap.CapIMAP4rev1: {}},
+		AuthThrottler:   throttler,
+		MaxAuthFailures: 3,
+	})
+	defer conn.Close()
+
+	for i := 0; i < 2; i++ {
+		line := conn.exec("L", fmt.Sprintf("L LOGIN %v wrong\r\n", testUsername))
+		if want := "L NO [AUTHENTICATIONFAILED]"; !strings.HasPrefix(line, want) {
+			t.Fatalf("LOGIN #%v response = %q, want prefix %q", i+1, line, want)
+		}
+	}
+
+	// AUTHENTICATE failures count too
+	line := conn.exec("A", "A AUTHENTICATE PLAIN AHRlc3QtdXNlcgB3cm9uZw==\r\n")
+	if want := "A NO [AUTHENTICATIONFAILED]"; !strings.HasPrefix(line, want) {
+		t.Fatalf("AUTHENTICATE response = %q, want prefix %q", line, want)
+	}
+	if line := conn.readLine(); !strings.HasPrefix(line, "* BYE") {
+		t.Fatalf("response = %q, want BYE", line)
+	}
+	if _, err := conn.br.ReadByte(); err != io.EOF {
+		t.Errorf("ReadByte() = %v, want EOF", err)
+	}
+}
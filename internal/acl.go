@@ -1,13 +0,0 @@
-package internal
-
-import (
-	"github.com/emersion/go-imap/v2"
-)
-
-func FormatRights(rm imap.RightModification, rs imap.RightSet) string {
-	s := ""
-	if rm != imap.RightModificationReplace {
-		s = string(rm)
-	}
-	return s + string(rs)
-}
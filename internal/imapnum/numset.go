@@ -119,7 +119,14 @@ func (s *Set) AddSet(t Set) {
 
 // Dynamic returns true if the set contains "*" or "n:*" values.
 func (s Set) Dynamic() bool {
-	return len(s) > 0 && s[len(s)-1].Stop == 0
+	// In sets built with AddNum, AddRange and AddSet, dynamic values are
+	// last
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i].Start == 0 || s[i].Stop == 0 {
+			return true
+		}
+	}
+	return false
 }
 
 // Contains returns true if the non-zero sequence number or UID q is contained
@@ -145,11 +152,13 @@ func (s Set) Nums() (nums []uint32, ok bool) {
 	return nums, true
 }
 
-// String returns a sorted representation of all contained number values.
+// String returns a sorted and compact representation of all contained number
+// values, see Normalize.
 func (s Set) String() string {
 	if len(s) == 0 {
 		return ""
 	}
+	s = s.Normalize()
 	b := make([]byte, 0, 64)
 	for _, v := range s {
 		b = append(b, ',')
@@ -172,6 +181,16 @@ func (s Set) String() string {
 // insert adds range value v to the set.
 func (ptr *Set) insert(v Range) {
 	s := *ptr
+	// Fast path: static values appended in increasing order
+	if n := len(s); v.Start != 0 && v.Stop != 0 && (n == 0 || (s[n-1].Stop != 0 && s[n-1].Start != 0 && v.Start > s[n-1].Stop)) {
+		if n > 0 && s[n-1].Stop+1 == v.Start {
+			(*ptr)[n-1].Stop = v.Stop
+		} else {
+			*ptr = append(s, v)
+		}
+		return
+	}
+
 	defer func() {
 		*ptr = s
 	}()
@@ -251,6 +270,228 @@ func (s Set) search(q uint32) (i int, ok bool) {
 	return min, s[min].Contains(q)
 }
 
+// Normalize returns a set with the same values as s, in canonical form:
+// ranges are sorted, and neither overlap nor touch. "*" is merged into a
+// trailing "n:*" range, or kept last. s is returned as-is if it's already in
+// canonical form.
+func (s Set) Normalize() Set {
+	if s.isNormalized() {
+		return s
+	}
+	var out Set
+	for _, v := range s {
+		out.AddRange(v.Start, v.Stop)
+	}
+	return out
+}
+
+func (s Set) isNormalized() bool {
+	for i, v := range s {
+		switch {
+		case v.Start == 0:
+			// "*" must be last, and not follow "n:*"
+			if v.Stop != 0 || i != len(s)-1 || (i > 0 && s[i-1].Stop == 0) {
+				return false
+			}
+			continue
+		case v.Stop < v.Start && v.Stop != 0:
+			return false
+		}
+		if i > 0 {
+			prev := s[i-1]
+			if prev.Stop == 0 || prev.Stop == ^uint32(0) || prev.Stop+1 >= v.Start {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// errDynamicSet is returned by operations which are ambiguous when a set
+// contains "*".
+func errDynamicSet(s Set) error {
+	return fmt.Errorf("imap: number set %q contains \"*\", whose value is unknown", s.String())
+}
+
+// Union returns the set of values contained in s or t.
+func (s Set) Union(t Set) Set {
+	s, t = s.Normalize(), t.Normalize()
+	if s.Dynamic() || t.Dynamic() {
+		var out Set
+		out.AddSet(s)
+		out.AddSet(t)
+		return out
+	}
+
+	out := make(Set, 0, len(s)+len(t))
+	i, j := 0, 0
+	for i < len(s) || j < len(t) {
+		var v Range
+		if j == len(t) || (i < len(s) && s[i].Start <= t[j].Start) {
+			v = s[i]
+			i++
+		} else {
+			v = t[j]
+			j++
+		}
+
+		if n := len(out); n > 0 && (out[n-1].Stop == ^uint32(0) || out[n-1].Stop+1 >= v.Start) {
+			if v.Stop > out[n-1].Stop {
+				out[n-1].Stop = v.Stop
+			}
+		} else {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Intersect returns the set of values contained in both s and t.
+//
+// An error is returned if s or t contains "*".
+func (s Set) Intersect(t Set) (Set, error) {
+	if s.Dynamic() {
+		return nil, errDynamicSet(s)
+	} else if t.Dynamic() {
+		return nil, errDynamicSet(t)
+	}
+	s, t = s.Normalize(), t.Normalize()
+
+	var out Set
+	i, j := 0, 0
+	for i < len(s) && j < len(t) {
+		start, stop := s[i].Start, s[i].Stop
+		if t[j].Start > start {
+			start = t[j].Start
+		}
+		if t[j].Stop < stop {
+			stop = t[j].Stop
+		}
+		if start <= stop {
+			out = append(out, Range{start, stop})
+		}
+
+		if s[i].Stop < t[j].Stop {
+			i++
+		} else {
+			j++
+		}
+	}
+	return out, nil
+}
+
+// Subtract returns the set of values contained in s but not in t.
+//
+// An error is returned if s or t contains "*".
+func (s Set) Subtract(t Set) (Set, error) {
+	if s.Dynamic() {
+		return nil, errDynamicSet(s)
+	} else if t.Dynamic() {
+		return nil, errDynamicSet(t)
+	}
+	s, t = s.Normalize(), t.Normalize()
+
+	var out Set
+	j := 0
+	for _, v := range s {
+		// Skip ranges of t ending before v
+		for j < len(t) && t[j].Stop < v.Start {
+			j++
+		}
+
+		start := v.Start
+		covered := false
+		for k := j; k < len(t) && t[k].Start <= v.Stop; k++ {
+			if t[k].Start > start {
+				out = append(out, Range{start, t[k].Start - 1})
+			}
+			if t[k].Stop >= v.Stop {
+				covered = true
+				break
+			}
+			start = t[k].Stop + 1
+		}
+		if !covered {
+			out = append(out, Range{start, v.Stop})
+		}
+	}
+	return out, nil
+}
+
+// Equal returns true if s and t contain the same values.
+//
+// Sets containing "*" are compared symbolically: "1:*" isn't equal to "1:10",
+// even if "*" is 10.
+func (s Set) Equal(t Set) bool {
+	s, t = s.Normalize(), t.Normalize()
+	if len(s) != len(t) {
+		return false
+	}
+	for i := range s {
+		if s[i] != t[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Resolve returns a static set, where "*" is replaced with max. As in IMAP,
+// "n:*" with n > max is equivalent to "max:n". If max is zero, "*" and "n:*"
+// are dropped.
+func (s Set) Resolve(max uint32) Set {
+	var out Set
+	for _, v := range s {
+		if v.Start == 0 || v.Stop == 0 {
+			if max == 0 {
+				continue
+			}
+			if v.Start == 0 {
+				v.Start = max
+			}
+			if v.Stop == 0 {
+				v.Stop = max
+			}
+		}
+		out.AddRange(v.Start, v.Stop)
+	}
+	return out
+}
+
+// Count returns the number of values in the set.
+//
+// An error is returned if the set contains "*".
+func (s Set) Count() (uint64, error) {
+	if s.Dynamic() {
+		return 0, errDynamicSet(s)
+	}
+	var n uint64
+	for _, v := range s.Normalize() {
+		n += uint64(v.Stop-v.Start) + 1
+	}
+	return n, nil
+}
+
+// Each calls f for each value in the set, in increasing order, until f
+// returns false. The values are never stored in memory all at once.
+//
+// An error is returned if the set contains "*".
+func (s Set) Each(f func(v uint32) bool) error {
+	if s.Dynamic() {
+		return errDynamicSet(s)
+	}
+	for _, r := range s.Normalize() {
+		for v := r.Start; ; v++ {
+			if !f(v) {
+				return nil
+			}
+			if v == r.Stop {
+				break
+			}
+		}
+	}
+	return nil
+}
+
 // errBadNumSet is used to report problems with the format of a number set
 // value.
 type errBadNumSet string
@@ -261,12 +502,19 @@ func (err errBadNumSet) Error() string {
 
 // parseNum parses a single seq-number value (non-zero uint32 or "*").
 func parseNum(v string) (uint32, error) {
-	if n, err := strconv.ParseUint(v, 10, 32); err == nil && v[0] != '0' {
-		return uint32(n), nil
-	} else if v == "*" {
+	if v == "*" {
 		return 0, nil
 	}
-	return 0, errBadNumSet(v)
+	n, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+			return 0, fmt.Errorf("imap: number %v overflows 32-bit unsigned integer", v)
+		}
+		return 0, errBadNumSet(v)
+	} else if v[0] == '0' {
+		return 0, fmt.Errorf("imap: number %v must be non-zero without leading zeros", v)
+	}
+	return uint32(n), nil
 }
 
 // parseNumRange creates a new seq instance by parsing strings in the format
@@ -289,7 +537,7 @@ func parseNumRange(v string) (Range, error) {
 			return r, nil
 		}
 	}
-	return r, errBadNumSet(v)
+	return r, err
 }
 
 // ParseSet returns a new Set after parsing the set string.
@@ -722,3 +722,276 @@ func TestNumSetAddNumRangeSet(t *testing.T) {
 		}
 	}
 }
+
+// randomSet returns a random static set of values in [base, base+n), and the
+// values it contains. Ranges may be out of order, overlapping or reversed.
+func randomSet(rng *rand.Rand, base, n uint32) (Set, map[uint32]bool) {
+	var s Set
+	m := make(map[uint32]bool)
+	for i := rng.Intn(5); i > 0; i-- {
+		start := base + uint32(rng.Intn(int(n)))
+		stop := base + uint32(rng.Intn(int(n)))
+		s = append(s, Range{start, stop})
+		if stop < start {
+			start, stop = stop, start
+		}
+		for v := start; ; v++ {
+			m[v] = true
+			if v == stop {
+				break
+			}
+		}
+	}
+	return s, m
+}
+
+func checkSetValues(t *testing.T, op string, s Set, base, n uint32, want func(v uint32) bool) {
+	checkNumSet(s, t)
+	for i := uint32(0); i < n; i++ {
+		v := base + i
+		if got := s.Contains(v); got != want(v) {
+			t.Errorf("%v: Contains(%v) = %v, want %v", op, v, got, want(v))
+		}
+	}
+}
+
+func TestNumSetAlgebra(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	const n = 20
+	for _, base := range []uint32{1, ^uint32(0) - n + 1} {
+		for i := 0; i < 2000; i++ {
+			s, sm := randomSet(rng, base, n)
+			u, um := randomSet(rng, base, n)
+			desc := func(op string) string {
+				return s.String() + " " + op + " " + u.String()
+			}
+
+			union := s.Union(u)
+			checkSetValues(t, desc("∪"), union, base, n, func(v uint32) bool {
+				return sm[v] || um[v]
+			})
+
+			inter, err := s.Intersect(u)
+			if err != nil {
+				t.Fatalf("%v: %v", desc("∩"), err)
+			}
+			checkSetValues(t, desc("∩"), inter, base, n, func(v uint32) bool {
+				return sm[v] && um[v]
+			})
+
+			diff, err := s.Subtract(u)
+			if err != nil {
+				t.Fatalf("%v: %v", desc("-"), err)
+			}
+			checkSetValues(t, desc("-"), diff, base, n, func(v uint32) bool {
+				return sm[v] && !um[v]
+			})
+
+			equal := len(sm) == len(um)
+			for v := range sm {
+				equal = equal && um[v]
+			}
+			if got := s.Equal(u); got != equal {
+				t.Errorf("%v: got %v, want %v", desc("=="), got, equal)
+			}
+			if !s.Equal(s.Union(nil)) {
+				t.Errorf("%q isn't equal to its normalized form %q", s, s.Union(nil))
+			}
+		}
+	}
+}
+
+func TestNumSetAlgebra_large(t *testing.T) {
+	s := Set{{1, 1000000}}
+	u := Set{{10, 20}, {500000, 0}}
+	if _, err := s.Subtract(u); err == nil {
+		t.Errorf("Subtract() with a dynamic set = nil, want an error")
+	}
+	if _, err := u.Intersect(s); err == nil {
+		t.Errorf("Intersect() with a dynamic set = nil, want an error")
+	}
+	if union := s.Union(u); union.String() != "1:*" {
+		t.Errorf("Union() = %q, want %q", union, "1:*")
+	}
+
+	u = Set{{10, 20}, {500000, 999999}}
+	diff, err := s.Subtract(u)
+	if err != nil {
+		t.Fatalf("Subtract() = %v", err)
+	} else if want := "1:9,21:499999,1000000"; diff.String() != want {
+		t.Errorf("Subtract() = %q, want %q", diff, want)
+	}
+	inter, err := s.Intersect(u)
+	if err != nil {
+		t.Fatalf("Intersect() = %v", err)
+	} else if want := "10:20,500000:999999"; inter.String() != want {
+		t.Errorf("Intersect() = %q, want %q", inter, want)
+	}
+
+	if !(Set{{5, 0}}).Equal(Set{{7, 0}, {5, 6}}) {
+		t.Errorf(`"5:*" isn't equal to "5:6,7:*"`)
+	}
+	if (Set{{1, 0}}).Equal(Set{{1, 10}}) {
+		t.Errorf(`"1:*" is equal to "1:10"`)
+	}
+}
+
+func TestNumSetResolve(t *testing.T) {
+	tests := []struct {
+		set   string
+		max   uint32
+		out   string
+		count uint64
+	}{
+		{"*", 3, "3", 1},
+		{"*:*", 3, "3", 1},
+		{"1:*", 3, "1:3", 3},
+		{"5:*", 3, "3:5", 3},
+		{"1:2,*", 2, "1:2", 2},
+		{"1:5,*", 3, "1:5", 5},
+		{"*", 0, "", 0},
+		{"1:*", 0, "", 0},
+		{"2,4:5", 0, "2,4:5", 3},
+	}
+	for _, test := range tests {
+		s, err := ParseSet(test.set)
+		if err != nil {
+			t.Fatalf("ParseSet(%q) = %v", test.set, err)
+		}
+		if _, err := s.Count(); err == nil && s.Dynamic() {
+			t.Errorf("%q.Count() = nil error, want an error", test.set)
+		}
+		if err := s.Each(func(uint32) bool { return true }); err == nil && s.Dynamic() {
+			t.Errorf("%q.Each() = nil error, want an error", test.set)
+		}
+
+		r := s.Resolve(test.max)
+		checkNumSet(r, t)
+		if out := r.String(); out != test.out {
+			t.Errorf("%q.Resolve(%v) = %q, want %q", test.set, test.max, out, test.out)
+		}
+		if count, err := r.Count(); err != nil || count != test.count {
+			t.Errorf("%q.Resolve(%v).Count() = %v, %v, want %v", test.set, test.max, count, err, test.count)
+		}
+	}
+}
+
+func TestNumSetEach(t *testing.T) {
+	s := Set{{5, 7}, {1, 2}, {^uint32(0) - 1, ^uint32(0)}}
+	var got []uint32
+	if err := s.Each(func(v uint32) bool {
+		got = append(got, v)
+		return true
+	}); err != nil {
+		t.Fatalf("Each() = %v", err)
+	}
+	want := []uint32{1, 2, 5, 6, 7, ^uint32(0) - 1, ^uint32(0)}
+	if len(got) != len(want) {
+		t.Fatalf("Each() yielded %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Each() yielded %v, want %v", got, want)
+		}
+	}
+
+	n := 0
+	s.Each(func(v uint32) bool {
+		n++
+		return n < 3
+	})
+	if n != 3 {
+		t.Errorf("Each() called f %v times after it returned false, want 3", n)
+	}
+
+	if count, err := s.Count(); err != nil || count != 7 {
+		t.Errorf("Count() = %v, %v, want 7", count, err)
+	}
+	if count, _ := (Set{{1, ^uint32(0)}}).Count(); count != 1<<32-1 {
+		t.Errorf("Count() = %v, want %v", count, uint64(1<<32-1))
+	}
+}
+
+func TestNumSetEach_allocs(t *testing.T) {
+	s := Set{{1, 10000000}}
+	var sum uint64
+	allocs := testing.AllocsPerRun(3, func() {
+		s.Each(func(v uint32) bool {
+			sum += uint64(v)
+			return true
+		})
+	})
+	if allocs > 1 {
+		t.Errorf("Each() allocated %v times, want O(1)", allocs)
+	}
+}
+
+func TestNumSetNormalize(t *testing.T) {
+	tests := []struct {
+		in  Set
+		out string
+	}{
+		{Set{{5, 5}, {6, 6}, {7, 7}}, "5:7"},
+		{Set{{1, 5}, {3, 9}}, "1:9"},
+		{Set{{3, 9}, {1, 5}}, "1:9"},
+		{Set{{4, 4}, {4, 4}, {2, 2}}, "2,4"},
+		{Set{{7, 7}, {0, 0}, {5, 6}}, "5:7,*"},
+		{Set{{7, 7}, {0, 0}, {5, 0}}, "5:*"},
+		{Set{{0, 0}, {0, 0}}, "*"},
+		{Set{{9, 3}}, "3:9"},
+		{Set{{1, 3}, {5, 0}, {4, 4}}, "1:*"},
+	}
+	for _, test := range tests {
+		s := test.in.Normalize()
+		checkNumSet(s, t)
+		if out := s.String(); out != test.out {
+			t.Errorf("%v.Normalize() = %q, want %q", test.in, out, test.out)
+		}
+		if out := test.in.String(); out != test.out {
+			t.Errorf("%v.String() = %q, want %q", test.in, out, test.out)
+		}
+	}
+}
+
+func TestNumSetAddNum_consecutive(t *testing.T) {
+	var s Set
+	for i := uint32(1); i <= 10000; i++ {
+		s.AddNum(i)
+	}
+	if len(s) != 1 || s.String() != "1:10000" {
+		t.Errorf("String() = %q, want %q", s, "1:10000")
+	}
+
+	var literal Set
+	for i := uint32(10000); i >= 1; i-- {
+		literal = append(literal, Range{i, i})
+	}
+	if out := literal.String(); out != "1:10000" {
+		t.Errorf("String() = %q, want %q", out, "1:10000")
+	}
+}
+
+func FuzzParseSet(f *testing.F) {
+	for _, s := range []string{"1", "*", "1:*", "*:*", "1:5,3:9", "7,*,5:6", "4294967295", "1,3:2,5:*"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, in string) {
+		s, err := ParseSet(in)
+		if err != nil {
+			return
+		}
+		checkNumSet(s, t)
+
+		out := s.String()
+		s2, err := ParseSet(out)
+		if err != nil {
+			t.Fatalf("ParseSet(%q) = %v, formatted from %q", out, err, in)
+		}
+		if !s.Equal(s2) {
+			t.Errorf("ParseSet(%q) = %v, want %v", out, s2, s)
+		}
+		if out2 := s2.String(); out2 != out {
+			t.Errorf("round-trip of %q isn't stable: %q, then %q", in, out, out2)
+		}
+	})
+}
@@ -6,10 +6,10 @@ import (
 	"io"
 	"strconv"
 	"strings"
-	"unicode"
 
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/internal/imapnum"
+	"github.com/emersion/go-imap/v2/internal/searchkey"
 	"github.com/emersion/go-imap/v2/internal/utf7"
 )
 
@@ -18,12 +18,7 @@ const maxListDepth = 1000
 
 // IsAtomChar returns true if ch is an ATOM-CHAR.
 func IsAtomChar(ch byte) bool {
-	switch ch {
-	case '(', ')', '{', ' ', '%', '*', '"', '\\', ']':
-		return false
-	default:
-		return !unicode.IsControl(rune(ch))
-	}
+	return searchkey.IsAtomChar(ch)
 }
 
 // Is non-empty char
@@ -55,11 +50,15 @@ type Decoder struct {
 	// MaxSize defines a maximum number of bytes to be read from the input.
 	// Literals are ignored.
 	MaxSize int64
+	// MailboxUTF8 indicates that mailbox names are UTF-8 instead of modified
+	// UTF-7. This requires IMAP4rev2 or UTF8=ACCEPT.
+	MailboxUTF8 bool
 
 	r         *bufio.Reader
 	side      ConnSide
 	err       error
 	literal   bool
+	nonSync   *io.LimitedReader // open non-synchronizing literal, if any
 	crlf      bool
 	listDepth int
 	readBytes int64
@@ -94,7 +93,7 @@ func (dec *Decoder) returnErr(err error) bool {
 
 func (dec *Decoder) readByte() (byte, bool) {
 	if dec.MaxSize > 0 && dec.readBytes > dec.MaxSize {
-		return 0, dec.returnErr(fmt.Errorf("imapwire: max size exceeded"))
+		return 0, dec.returnErr(&DecoderExpectError{Message: "max size exceeded"})
 	}
 	dec.crlf = false
 	if dec.literal {
@@ -263,13 +262,81 @@ func (dec *Decoder) DiscardUntilByte(untilCh byte) {
 	}
 }
 
-func (dec *Decoder) DiscardLine() {
-	if dec.crlf {
-		return
+// DiscardLine discards the rest of the current line.
+//
+// MaxSize is ignored. Non-synchronizing literals which are still open or which
+// are announced at the end of a discarded line are skipped as well, so that
+// the decoder is positioned at the beginning of the next line afterwards.
+//
+// An open synchronizing literal can't be skipped, since the decoder doesn't
+// know whether the other side has been asked to send it: an error is returned
+// and the connection can't be used anymore.
+func (dec *Decoder) DiscardLine() error {
+	if dec.literal {
+		if dec.nonSync == nil {
+			return fmt.Errorf("imapwire: cannot discard an open synchronizing literal")
+		}
+		if _, err := io.Copy(io.Discard, dec.nonSync); err != nil {
+			return err
+		}
+		dec.literal = false
+		dec.nonSync = nil
+	} else if dec.crlf {
+		return nil
 	}
-	var text string
-	dec.Text(&text)
-	dec.CRLF()
+
+	var tail []byte
+	for {
+		b, err := dec.r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		if b != '\n' {
+			if len(tail) >= maxLiteralAnnouncementLen {
+				tail = tail[1:]
+			}
+			tail = append(tail, b)
+			continue
+		}
+
+		size, ok := parseNonSyncLiteralAnnouncement(tail)
+		if !ok || dec.side != ConnSideServer {
+			break
+		}
+		if _, err := io.CopyN(io.Discard, dec.r, size); err != nil {
+			return err
+		}
+		tail = tail[:0]
+	}
+	dec.crlf = true
+	return nil
+}
+
+// maxLiteralAnnouncementLen is the maximum length of "{<number64>+}\r".
+const maxLiteralAnnouncementLen = len("{9223372036854775807+}\r")
+
+// parseNonSyncLiteralAnnouncement checks whether a line ends with a
+// non-synchronizing literal announcement, and returns the literal size.
+func parseNonSyncLiteralAnnouncement(line []byte) (size int64, ok bool) {
+	s := strings.TrimSuffix(string(line), "\r")
+	if !strings.HasSuffix(s, "+}") {
+		return 0, false
+	}
+	s = strings.TrimSuffix(s, "+}")
+	i := strings.LastIndexByte(s, '{')
+	if i < 0 || i == len(s)-1 {
+		return 0, false
+	}
+	for _, ch := range []byte(s[i+1:]) {
+		if ch < '0' || ch > '9' {
+			return 0, false
+		}
+	}
+	size, err := strconv.ParseInt(s[i+1:], 10, 64)
+	return size, err == nil
 }
 
 func (dec *Decoder) DiscardValue() bool {
@@ -316,6 +383,9 @@ func (dec *Decoder) numberStr() (s string, ok bool) {
 	return sb.String(), true
 }
 
+// Number decodes a 32-bit unsigned number.
+//
+// On overflow, the decoder error is set.
 func (dec *Decoder) Number(ptr *uint32) bool {
 	s, ok := dec.numberStr()
 	if !ok {
@@ -323,7 +393,7 @@ func (dec *Decoder) Number(ptr *uint32) bool {
 	}
 	v64, err := strconv.ParseUint(s, 10, 32)
 	if err != nil {
-		return false // can happen on overflow
+		return dec.returnErr(&DecoderExpectError{Message: fmt.Sprintf("number %v overflows 32-bit unsigned integer", s)})
 	}
 	*ptr = uint32(v64)
 	return true
@@ -344,6 +414,9 @@ func (dec *Decoder) ExpectBodyFldOctets(ptr *uint32) bool {
 	return dec.ExpectNumber(ptr)
 }
 
+// Number64 decodes a 63-bit unsigned number.
+//
+// On overflow, the decoder error is set.
 func (dec *Decoder) Number64(ptr *int64) bool {
 	s, ok := dec.numberStr()
 	if !ok {
@@ -351,7 +424,7 @@ func (dec *Decoder) Number64(ptr *int64) bool {
 	}
 	v, err := strconv.ParseInt(s, 10, 64)
 	if err != nil {
-		return false // can happen on overflow
+		return dec.returnErr(&DecoderExpectError{Message: fmt.Sprintf("number %v overflows 63-bit unsigned integer", s)})
 	}
 	*ptr = v
 	return true
@@ -361,20 +434,23 @@ func (dec *Decoder) ExpectNumber64(ptr *int64) bool {
 	return dec.Expect(dec.Number64(ptr), "number64")
 }
 
-func (dec *Decoder) ModSeq(ptr *uint64) bool {
+// ModSeq decodes a mod-sequence-value, which is a 63-bit unsigned number.
+//
+// On overflow, the decoder error is set.
+func (dec *Decoder) ModSeq(ptr *imap.ModSeq) bool {
 	s, ok := dec.numberStr()
 	if !ok {
 		return false
 	}
-	v, err := strconv.ParseUint(s, 10, 64)
+	v, err := strconv.ParseUint(s, 10, 63)
 	if err != nil {
-		return false // can happen on overflow
+		return dec.returnErr(&DecoderExpectError{Message: fmt.Sprintf("mod-sequence-value %v overflows 63-bit unsigned integer", s)})
 	}
-	*ptr = v
+	*ptr = imap.ModSeq(v)
 	return true
 }
 
-func (dec *Decoder) ExpectModSeq(ptr *uint64) bool {
+func (dec *Decoder) ExpectModSeq(ptr *imap.ModSeq) bool {
 	return dec.Expect(dec.ModSeq(ptr), "mod-sequence-value")
 }
 
@@ -391,6 +467,9 @@ func (dec *Decoder) Quoted(ptr *string) bool {
 
 		if ch == '"' {
 			break
+		} else if ch == '\r' || ch == '\n' {
+			dec.mustUnreadByte()
+			return dec.returnErr(&DecoderExpectError{Message: "unterminated quoted string"})
 		}
 
 		if ch == '\\' {
@@ -471,7 +550,9 @@ func (dec *Decoder) List(f func() error) (isList bool, err error) {
 	}()
 
 	if dec.listDepth >= maxListDepth {
-		return false, fmt.Errorf("imapwire: exceeded max depth")
+		err := &DecoderExpectError{Message: "exceeded max list depth"}
+		dec.returnErr(err)
+		return false, err
 	}
 
 	for {
@@ -517,7 +598,11 @@ func (dec *Decoder) ExpectMailbox(ptr *string) bool {
 		*ptr = "INBOX"
 		return true
 	}
-	name, err := utf7.Decode(name)
+	if dec.MailboxUTF8 {
+		*ptr = utf7.Unescape(name)
+		return true
+	}
+	name, err := imap.DecodeMailboxName(name)
 	if err == nil {
 		*ptr = name
 	}
@@ -533,19 +618,19 @@ func (dec *Decoder) ExpectUID(ptr *imap.UID) bool {
 	return true
 }
 
-func (dec *Decoder) ExpectNumSet(kind NumKind, ptr *imap.NumSet) bool {
+func (dec *Decoder) NumSet(kind NumKind, ptr *imap.NumSet) bool {
 	if dec.Special('$') {
 		*ptr = imap.SearchRes()
 		return true
 	}
 
 	var s string
-	if !dec.Expect(dec.Func(&s, isNumSetChar), "sequence-set") {
+	if !dec.Func(&s, isNumSetChar) {
 		return false
 	}
 	numSet, err := imapnum.ParseSet(s)
 	if err != nil {
-		return dec.returnErr(err)
+		return dec.returnErr(&DecoderExpectError{Message: err.Error()})
 	}
 
 	switch kind {
@@ -557,6 +642,10 @@ func (dec *Decoder) ExpectNumSet(kind NumKind, ptr *imap.NumSet) bool {
 	return true
 }
 
+func (dec *Decoder) ExpectNumSet(kind NumKind, ptr *imap.NumSet) bool {
+	return dec.Expect(dec.NumSet(kind, ptr), "sequence-set")
+}
+
 func (dec *Decoder) ExpectUIDSet(ptr *imap.UIDSet) bool {
 	var numSet imap.NumSet
 	ok := dec.ExpectNumSet(NumKindUID, &numSet)
@@ -566,6 +655,57 @@ func (dec *Decoder) ExpectUIDSet(ptr *imap.UIDSet) bool {
 	return ok
 }
 
+// maxNumListLen is the maximum number of numbers decoded by ExpectNumList, so
+// that a short range such as "1:4294967295" can't exhaust memory.
+const maxNumListLen = 1 << 22
+
+// ExpectNumList decodes a sequence-set and returns its numbers in order,
+// without normalizing the set. A range "n:m" with n > m is expanded in
+// descending order. This is used for ordered results, e.g. for ESORT.
+//
+// At most maxNumListLen numbers are accepted.
+func (dec *Decoder) ExpectNumList(ptr *[]uint32) bool {
+	var s string
+	if !dec.Expect(dec.Func(&s, isNumSetChar), "sequence-set") {
+		return false
+	}
+
+	var nums []uint32
+	for _, part := range strings.Split(s, ",") {
+		startStr, stopStr, isRange := strings.Cut(part, ":")
+		start, err := strconv.ParseUint(startStr, 10, 32)
+		stop := start
+		if err == nil && isRange {
+			stop, err = strconv.ParseUint(stopStr, 10, 32)
+		}
+		if err != nil || start == 0 || stop == 0 {
+			return dec.returnErr(&DecoderExpectError{Message: fmt.Sprintf("invalid number list item %q", part)})
+		}
+
+		count := stop - start
+		if start > stop {
+			count = start - stop
+		}
+		if uint64(len(nums))+count >= maxNumListLen {
+			return dec.returnErr(&DecoderExpectError{Message: "number list too long"})
+		}
+
+		for n := start; ; {
+			nums = append(nums, uint32(n))
+			if n == stop {
+				break
+			} else if n < stop {
+				n++
+			} else {
+				n--
+			}
+		}
+	}
+
+	*ptr = nums
+	return true
+}
+
 func isNumSetChar(ch byte) bool {
 	return ch == '*' || IsAtomChar(ch)
 }
@@ -577,8 +717,10 @@ func (dec *Decoder) Literal(ptr *string) bool {
 	}
 	if dec.CheckBufferedLiteralFunc != nil {
 		if err := dec.CheckBufferedLiteralFunc(lit.Size(), nonSync); err != nil {
-			lit.cancel()
-			return false
+			if !nonSync {
+				lit.cancel()
+			}
+			return dec.returnErr(err)
 		}
 	}
 	var sb strings.Builder
@@ -603,11 +745,15 @@ func (dec *Decoder) LiteralReader() (lit *LiteralReader, nonSync, ok bool) {
 	if !dec.ExpectSpecial('}') || !dec.ExpectCRLF() {
 		return nil, false, false
 	}
+	r := &io.LimitedReader{R: dec.r, N: size}
 	dec.literal = true
+	if nonSync {
+		dec.nonSync = r
+	}
 	lit = &LiteralReader{
 		dec:  dec,
 		size: size,
-		r:    io.LimitReader(dec.r, size),
+		r:    r,
 	}
 	return lit, nonSync, true
 }
@@ -650,5 +796,6 @@ func (lit *LiteralReader) cancel() {
 		return
 	}
 	lit.dec.literal = false
+	lit.dec.nonSync = nil
 	lit.dec = nil
 }
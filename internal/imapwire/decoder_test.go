@@ -0,0 +1,219 @@
+package imapwire
+
+import (
+	"bufio"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+func newTestDecoder(s string) *Decoder {
+	return NewDecoder(bufio.NewReader(strings.NewReader(s)), ConnSideServer)
+}
+
+func TestDecoderNumber(t *testing.T) {
+	tests := []struct {
+		in  string
+		out uint32
+		ok  bool
+	}{
+		{"0", 0, true},
+		{"42", 42, true},
+		{"0042", 42, true},
+		{"4294967295", 4294967295, true},
+		{"4294967296", 0, false},
+		{"9223372036854775807", 0, false},
+		{"", 0, false},
+		{"A", 0, false},
+	}
+	for _, test := range tests {
+		dec := newTestDecoder(test.in + " ")
+		var v uint32
+		ok := dec.Number(&v)
+		if ok != test.ok {
+			t.Errorf("Number(%q) = %v, want %v", test.in, ok, test.ok)
+		} else if ok && v != test.out {
+			t.Errorf("Number(%q) = %v, want %v", test.in, v, test.out)
+		}
+	}
+}
+
+func TestDecoderNumber64(t *testing.T) {
+	tests := []struct {
+		in  string
+		out int64
+		ok  bool
+	}{
+		{"0", 0, true},
+		{"4294967295", 4294967295, true},
+		{"4294967296", 4294967296, true},
+		{"9223372036854775807", 9223372036854775807, true},
+		{"9223372036854775808", 0, false},
+		{"18446744073709551616", 0, false},
+		{"-1", 0, false},
+	}
+	for _, test := range tests {
+		dec := newTestDecoder(test.in + " ")
+		var v int64
+		ok := dec.Number64(&v)
+		if ok != test.ok {
+			t.Errorf("Number64(%q) = %v, want %v", test.in, ok, test.ok)
+		} else if ok && v != test.out {
+			t.Errorf("Number64(%q) = %v, want %v", test.in, v, test.out)
+		}
+	}
+}
+
+func TestDecoderModSeq(t *testing.T) {
+	tests := []struct {
+		in  string
+		out imap.ModSeq
+		ok  bool
+	}{
+		{"1", 1, true},
+		{"4294967296", 4294967296, true},
+		{"9223372036854775807", 9223372036854775807, true},
+		{"9223372036854775808", 0, false},
+	}
+	for _, test := range tests {
+		dec := newTestDecoder(test.in + " ")
+		var v imap.ModSeq
+		ok := dec.ModSeq(&v)
+		if ok != test.ok {
+			t.Errorf("ModSeq(%q) = %v, want %v", test.in, ok, test.ok)
+		} else if ok && v != test.out {
+			t.Errorf("ModSeq(%q) = %v, want %v", test.in, v, test.out)
+		}
+	}
+}
+
+func TestDecoderNumber_overflowError(t *testing.T) {
+	dec := newTestDecoder("4294967296 ")
+	var v uint32
+	if dec.ExpectNumber(&v) {
+		t.Fatalf("ExpectNumber() = true, want false")
+	}
+	var decErr *DecoderExpectError
+	if !errors.As(dec.Err(), &decErr) {
+		t.Fatalf("Err() = %v, want a DecoderExpectError", dec.Err())
+	}
+	if want := "number 4294967296 overflows 32-bit unsigned integer"; decErr.Message != want {
+		t.Errorf("Err().Message = %q, want %q", decErr.Message, want)
+	}
+}
+
+func TestDecoderNumSet_leadingZero(t *testing.T) {
+	dec := newTestDecoder("01:3 ")
+	var numSet imap.NumSet
+	if dec.ExpectNumSet(NumKindSeq, &numSet) {
+		t.Fatalf("ExpectNumSet() = true, want false")
+	}
+	var decErr *DecoderExpectError
+	if !errors.As(dec.Err(), &decErr) {
+		t.Fatalf("Err() = %v, want a DecoderExpectError", dec.Err())
+	}
+}
+
+func isDigits(s string) bool {
+	for _, ch := range []byte(s) {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func FuzzDecoderNumber(f *testing.F) {
+	for _, s := range []string{"0", "4294967295", "4294967296", "9223372036854775807", "9223372036854775808"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		if !isDigits(s) {
+			return
+		}
+
+		var v32 uint32
+		want32, err := strconv.ParseUint(s, 10, 32)
+		if ok := newTestDecoder(s + " ").Number(&v32); ok != (err == nil) {
+			t.Errorf("Number(%q) = %v, want %v", s, ok, err == nil)
+		} else if ok && uint64(v32) != want32 {
+			t.Errorf("Number(%q) = %v, want %v", s, v32, want32)
+		}
+
+		var v64 int64
+		want64, err := strconv.ParseInt(s, 10, 64)
+		if ok := newTestDecoder(s + " ").Number64(&v64); ok != (err == nil) {
+			t.Errorf("Number64(%q) = %v, want %v", s, ok, err == nil)
+		} else if ok && v64 != want64 {
+			t.Errorf("Number64(%q) = %v, want %v", s, v64, want64)
+		}
+
+		var modSeq imap.ModSeq
+		wantModSeq, err := strconv.ParseUint(s, 10, 63)
+		if ok := newTestDecoder(s + " ").ModSeq(&modSeq); ok != (err == nil) {
+			t.Errorf("ModSeq(%q) = %v, want %v", s, ok, err == nil)
+		} else if ok && uint64(modSeq) != wantModSeq {
+			t.Errorf("ModSeq(%q) = %v, want %v", s, modSeq, wantModSeq)
+		}
+	})
+}
+
+func TestDecoderExpectNumList(t *testing.T) {
+	tests := []struct {
+		in  string
+		out []uint32
+	}{
+		{"1", []uint32{1}},
+		{"3,1:2,6:4", []uint32{3, 1, 2, 6, 5, 4}},
+		{"0", nil},
+		{"1:*", nil},
+		{"1:4294967295", nil},
+		{"1:2097152,2097153:4194305", nil},
+	}
+	for _, test := range tests {
+		dec := newTestDecoder(test.in + " ")
+		var nums []uint32
+		ok := dec.ExpectNumList(&nums)
+		if ok != (test.out != nil) {
+			t.Errorf("ExpectNumList(%q) = %v, want %v", test.in, ok, test.out != nil)
+		} else if ok && !reflect.DeepEqual(nums, test.out) {
+			t.Errorf("ExpectNumList(%q) = %v, want %v", test.in, nums, test.out)
+		}
+	}
+}
+
+func TestDecoderDiscardLine(t *testing.T) {
+	tests := []struct {
+		in   string
+		next string
+		ok   bool
+	}{
+		{"A (B\r\nNEXT\r\n", "NEXT", true},
+		{"A {5+}\r\nhello\r\nNEXT\r\n", "NEXT", true},
+		{"A B {3+}\r\nhel\r\nNEXT\r\n", "NEXT", true},
+		// Synchronizing literals can't be skipped
+		{"A {5}\r\nhello\r\nNEXT\r\n", "", false},
+	}
+	for _, test := range tests {
+		dec := newTestDecoder(test.in)
+		var atom string
+		dec.ExpectAtom(&atom)
+		if dec.SP() {
+			dec.LiteralReader()
+		}
+		err := dec.DiscardLine()
+		if (err == nil) != test.ok {
+			t.Errorf("DiscardLine() for %q = %v, want ok = %v", test.in, err, test.ok)
+			continue
+		} else if err != nil {
+			continue
+		}
+		if !dec.ExpectAtom(&atom) || atom != test.next {
+			t.Errorf("DiscardLine() for %q: next atom = %q, want %q", test.in, atom, test.next)
+		}
+	}
+}
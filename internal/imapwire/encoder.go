@@ -31,6 +31,10 @@ type Encoder struct {
 	// NewContinuationRequest creates a new continuation request. This is only
 	// meaningful for clients.
 	NewContinuationRequest func() *ContinuationRequest
+	// NoFlush prevents CRLF from flushing the underlying writer, so that
+	// multiple lines can be sent at once. The caller is responsible for
+	// calling Flush.
+	NoFlush bool
 
 	w       *bufio.Writer
 	side    ConnSide
@@ -63,9 +67,20 @@ func (enc *Encoder) writeString(s string) *Encoder {
 	return enc
 }
 
-// CRLF writes a "\r\n" sequence and flushes the buffered writer.
+// CRLF ends a line. The underlying writer is flushed, unless NoFlush is set.
 func (enc *Encoder) CRLF() error {
 	enc.writeString("\r\n")
+	if enc.err != nil {
+		return enc.err
+	}
+	if enc.NoFlush {
+		return nil
+	}
+	return enc.w.Flush()
+}
+
+// Flush flushes the underlying writer.
+func (enc *Encoder) Flush() error {
 	if enc.err != nil {
 		return enc.err
 	}
@@ -99,10 +114,15 @@ func (enc *Encoder) Quoted(s string) *Encoder {
 	return enc.writeString(sb.String())
 }
 
+// String writes a string. Quoted strings are preferred, literals are used
+// for strings which can't be quoted: strings containing NUL, CR or LF, long
+// strings, and strings containing 8-bit bytes unless QuotedUTF8 is set.
+//
+// On the client side, literals are non-synchronizing if LiteralPlus or
+// LiteralMinus allow it.
 func (enc *Encoder) String(s string) *Encoder {
 	if !enc.validQuoted(s) {
-		enc.stringLiteral(s)
-		return enc
+		return enc.StringLiteral(s)
 	}
 	return enc.Quoted(s)
 }
@@ -128,7 +148,9 @@ func (enc *Encoder) validQuoted(s string) bool {
 	return true
 }
 
-func (enc *Encoder) stringLiteral(s string) {
+// StringLiteral writes a string as a literal, even if it could be written as
+// a quoted string.
+func (enc *Encoder) StringLiteral(s string) *Encoder {
 	var sync *ContinuationRequest
 	if enc.side == ConnSideClient && (!enc.LiteralMinus || len(s) > 4096) && !enc.LiteralPlus {
 		if enc.NewContinuationRequest != nil {
@@ -136,7 +158,7 @@ func (enc *Encoder) stringLiteral(s string) {
 		}
 		if sync == nil {
 			enc.setErr(fmt.Errorf("imapwire: cannot send synchronizing literal"))
-			return
+			return enc
 		}
 	}
 	wc := enc.Literal(int64(len(s)), sync)
@@ -147,8 +169,30 @@ func (enc *Encoder) stringLiteral(s string) {
 	} else if closeErr != nil {
 		enc.setErr(closeErr)
 	}
+	return enc
+}
+
+// AString writes an astring: an atom if possible, a string otherwise.
+func (enc *Encoder) AString(s string) *Encoder {
+	if IsAtom(s) && !strings.EqualFold(s, "NIL") {
+		return enc.Atom(s)
+	}
+	return enc.String(s)
+}
+
+// IsAtom checks whether s can be written as an atom.
+func IsAtom(s string) bool {
+	for i := 0; i < len(s); i++ {
+		// IsAtomChar accepts 8-bit bytes to decode atoms leniently
+		if s[i] > unicode.MaxASCII || !IsAtomChar(s[i]) {
+			return false
+		}
+	}
+	return s != ""
 }
 
+// Mailbox writes a mailbox name, encoded as modified UTF-7 unless QuotedUTF8
+// is set. INBOX is written as an atom, other names are written with String.
 func (enc *Encoder) Mailbox(name string) *Encoder {
 	if strings.EqualFold(name, "INBOX") {
 		return enc.Atom("INBOX")
@@ -156,7 +200,11 @@ func (enc *Encoder) Mailbox(name string) *Encoder {
 		if enc.QuotedUTF8 {
 			name = utf7.Escape(name)
 		} else {
-			name = utf7.Encode(name)
+			var err error
+			if name, err = imap.EncodeMailboxName(name); err != nil {
+				enc.setErr(err)
+				return enc
+			}
 		}
 		return enc.String(name)
 	}
@@ -214,9 +262,15 @@ func (enc *Encoder) Number64(v int64) *Encoder {
 	return enc.writeString(strconv.FormatInt(v, 10))
 }
 
-func (enc *Encoder) ModSeq(v uint64) *Encoder {
-	// TODO: disallow zero values
-	return enc.writeString(strconv.FormatUint(v, 10))
+// ModSeq writes a mod-sequence value.
+//
+// An error is set if the value doesn't fit in 63 bits.
+func (enc *Encoder) ModSeq(v imap.ModSeq) *Encoder {
+	if v > imap.MaxModSeq {
+		enc.setErr(fmt.Errorf("imapwire: mod-sequence-value %v overflows 63-bit unsigned integer", v))
+		return enc
+	}
+	return enc.writeString(strconv.FormatUint(uint64(v), 10))
 }
 
 // List writes a parenthesized list.
@@ -257,11 +311,25 @@ func (enc *Encoder) UID(uid imap.UID) *Encoder {
 // nil to be sent to the channel before writing the literal data. If an error
 // is sent to the channel, the literal will be cancelled.
 func (enc *Encoder) Literal(size int64, sync *ContinuationRequest) io.WriteCloser {
+	return enc.literal8(size, sync, false)
+}
+
+// Literal8 writes a literal8, as defined in RFC 3516. Literal8 may contain
+// NUL bytes.
+//
+// See Literal for the semantics of size and sync.
+func (enc *Encoder) Literal8(size int64, sync *ContinuationRequest) io.WriteCloser {
+	return enc.literal8(size, sync, true)
+}
+
+func (enc *Encoder) literal8(size int64, sync *ContinuationRequest, binary bool) io.WriteCloser {
 	if sync != nil && enc.side == ConnSideServer {
 		panic("imapwire: sync must be nil on a server-side Encoder.Literal")
 	}
 
-	// TODO: literal8
+	if binary {
+		enc.writeString("~")
+	}
 	enc.writeString("{")
 	enc.Number64(size)
 	if sync == nil && enc.side == ConnSideClient {
@@ -272,8 +340,11 @@ func (enc *Encoder) Literal(size int64, sync *ContinuationRequest) io.WriteClose
 	if sync == nil {
 		enc.writeString("\r\n")
 	} else {
+		// The other side needs to receive the literal size before replying
 		if err := enc.CRLF(); err != nil {
 			return errorWriter{err}
+		} else if err := enc.Flush(); err != nil {
+			return errorWriter{err}
 		}
 		if _, err := sync.Wait(); err != nil {
 			enc.setErr(err)
@@ -314,6 +385,30 @@ func (lw *literalWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// ReadFrom copies literal data from r until EOF or until the literal is
+// complete. Data is copied straight to the underlying connection when
+// possible, e.g. with sendfile from an *os.File to a TCP connection.
+//
+// An error is returned if r contains more data than the literal size.
+func (lw *literalWriter) ReadFrom(r io.Reader) (int64, error) {
+	// The connection only recognizes a single level of io.LimitedReader
+	lr, ok := r.(*io.LimitedReader)
+	if !ok || lr.N > lw.n {
+		lr = &io.LimitedReader{R: r, N: lw.n}
+	}
+	n, err := lw.enc.w.ReadFrom(lr)
+	lw.n -= n
+	if err != nil || lw.n > 0 {
+		return n, err
+	}
+
+	var b [1]byte
+	if extra, _ := io.ReadFull(r, b[:]); extra > 0 {
+		return n, fmt.Errorf("wrote too many bytes in literal")
+	}
+	return n, nil
+}
+
 func (lw *literalWriter) Close() error {
 	lw.enc.literal = false
 	if lw.n != 0 {
@@ -0,0 +1,172 @@
+package imapwire
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+func TestEncoderModSeq(t *testing.T) {
+	tests := []struct {
+		in  imap.ModSeq
+		out string
+		ok  bool
+	}{
+		{1, "1\r\n", true},
+		{715194045007, "715194045007\r\n", true},
+		{imap.MaxModSeq, "9223372036854775807\r\n", true},
+		{imap.MaxModSeq + 1, "", false},
+	}
+	for _, test := range tests {
+		var sb strings.Builder
+		bw := bufio.NewWriter(&sb)
+		err := NewEncoder(bw, ConnSideClient).ModSeq(test.in).CRLF()
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("ModSeq(%v) = %v, want ok = %v", uint64(test.in), err, test.ok)
+		} else if sb.String() != test.out {
+			t.Errorf("ModSeq(%v) wrote %q, want %q", uint64(test.in), sb.String(), test.out)
+		}
+	}
+}
+
+func TestLiteralWriterReadFrom(t *testing.T) {
+	tests := []struct {
+		src string
+		ok  bool
+	}{
+		{"hello", true},
+		{"hell", false},
+		{"hello world", false},
+	}
+	for _, test := range tests {
+		var sb strings.Builder
+		bw := bufio.NewWriter(&sb)
+		w := NewEncoder(bw, ConnSideServer).Literal(5, nil)
+		_, err := w.(io.ReaderFrom).ReadFrom(strings.NewReader(test.src))
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("copying %q to a literal of size 5: got error %v, want ok = %v", test.src, err, test.ok)
+		}
+	}
+}
+
+func encodeString(f func(enc *Encoder), quotedUTF8 bool) (string, error) {
+	var sb strings.Builder
+	bw := bufio.NewWriter(&sb)
+	enc := NewEncoder(bw, ConnSideServer)
+	enc.QuotedUTF8 = quotedUTF8
+	f(enc)
+	err := enc.CRLF()
+	return strings.TrimSuffix(sb.String(), "\r\n"), err
+}
+
+func TestEncoderString(t *testing.T) {
+	long := strings.Repeat("a ", 2049)
+	tests := []struct {
+		in         string
+		quotedUTF8 bool
+		astring    string
+		str        string
+		mailbox    string
+	}{
+		{in: "INBOX", astring: "INBOX", str: `"INBOX"`, mailbox: "INBOX"},
+		{in: "inbox", astring: "inbox", str: `"inbox"`, mailbox: "INBOX"},
+		{in: "Drafts", astring: "Drafts", str: `"Drafts"`, mailbox: `"Drafts"`},
+		{in: "", astring: `""`, str: `""`, mailbox: `""`},
+		{in: "NIL", astring: `"NIL"`, str: `"NIL"`, mailbox: `"NIL"`},
+		{in: "a b", astring: `"a b"`, str: `"a b"`, mailbox: `"a b"`},
+		{in: "trailing ", astring: `"trailing "`, str: `"trailing "`, mailbox: `"trailing "`},
+		{in: `a"b\c`, astring: `"a\"b\\c"`, str: `"a\"b\\c"`, mailbox: `"a\"b\\c"`},
+		{in: "50%", astring: `"50%"`, str: `"50%"`, mailbox: `"50%"`},
+		{in: "*", astring: `"*"`, str: `"*"`, mailbox: `"*"`},
+		{in: "a]b", astring: `"a]b"`, str: `"a]b"`, mailbox: `"a]b"`},
+		{in: "a&b", astring: "a&b", str: `"a&b"`, mailbox: `"a&-b"`},
+		{in: "a\r\nb", astring: "{4}\r\na\r\nb", str: "{4}\r\na\r\nb", mailbox: `"a&AA0ACg-b"`},
+		{in: "café", astring: "{5}\r\ncafé", str: "{5}\r\ncafé", mailbox: `"caf&AOk-"`},
+		{in: "café", quotedUTF8: true, astring: `"café"`, str: `"café"`, mailbox: `"café"`},
+		{in: long, astring: "{4098}\r\n" + long, str: "{4098}\r\n" + long, mailbox: "{4098}\r\n" + long},
+	}
+	for _, tc := range tests {
+		for _, item := range []struct {
+			name string
+			f    func(enc *Encoder)
+			want string
+		}{
+			{"AString", func(enc *Encoder) { enc.AString(tc.in) }, tc.astring},
+			{"String", func(enc *Encoder) { enc.String(tc.in) }, tc.str},
+			{"Mailbox", func(enc *Encoder) { enc.Mailbox(tc.in) }, tc.mailbox},
+		} {
+			s, err := encodeString(item.f, tc.quotedUTF8)
+			if err != nil {
+				t.Errorf("%v(%q) = %v", item.name, tc.in, err)
+			} else if s != item.want {
+				t.Errorf("%v(%q) wrote %q, want %q", item.name, tc.in, s, item.want)
+			}
+		}
+	}
+}
+
+func FuzzEncoderString(f *testing.F) {
+	for _, s := range []string{"INBOX", "", "NIL", "a b", "trailing ", `a"b\c`, "50%*", "a]b", "a&b", "a\r\nb", "café", "台北"} {
+		f.Add(s, false)
+		f.Add(s, true)
+	}
+	f.Fuzz(func(t *testing.T, s string, utf8Mode bool) {
+		decode := func(encoded string, mailbox bool) (string, error) {
+			dec := NewDecoder(bufio.NewReader(strings.NewReader(encoded+"\r\n")), ConnSideClient)
+			dec.MailboxUTF8 = utf8Mode
+			var out string
+			var ok bool
+			if mailbox {
+				ok = dec.ExpectMailbox(&out)
+			} else {
+				ok = dec.ExpectAString(&out)
+			}
+			if !ok || !dec.ExpectCRLF() {
+				return "", dec.Err()
+			}
+			return out, nil
+		}
+
+		for _, name := range []string{"AString", "String"} {
+			encoded, err := encodeString(func(enc *Encoder) {
+				if name == "AString" {
+					enc.AString(s)
+				} else {
+					enc.String(s)
+				}
+			}, utf8Mode)
+			if err != nil {
+				t.Fatalf("%v(%q) = %v", name, s, err)
+			}
+			if out, err := decode(encoded, false); err != nil {
+				t.Fatalf("decoding %v(%q) = %q: %v", name, s, encoded, err)
+			} else if out != s {
+				t.Errorf("%v(%q) = %q decoded as %q", name, s, encoded, out)
+			}
+		}
+
+		if !utf8.ValidString(s) {
+			return
+		}
+		encoded, err := encodeString(func(enc *Encoder) { enc.Mailbox(s) }, utf8Mode)
+		if err != nil {
+			t.Fatalf("Mailbox(%q) = %v", s, err)
+		}
+		want := s
+		if strings.EqualFold(s, "INBOX") {
+			want = "INBOX"
+		}
+		if out, err := decode(encoded, true); err != nil {
+			t.Fatalf("decoding Mailbox(%q) = %q: %v", s, encoded, err)
+		} else if out != want {
+			t.Errorf("Mailbox(%q) = %q decoded as %q", s, encoded, out)
+		}
+	})
+}
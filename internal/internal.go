@@ -10,27 +10,24 @@ import (
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
-const (
-	DateTimeLayout = "_2-Jan-2006 15:04:05 -0700"
-	DateLayout     = "2-Jan-2006"
-)
-
 const FlagRecent imap.Flag = "\\Recent" // removed in IMAP4rev2
 
-func DecodeDateTime(dec *imapwire.Decoder) (time.Time, error) {
+// DecodeDateTime decodes a quoted date-time. In lenient mode, malformed
+// date-times are accepted as well, see imap.ParseDateTime.
+func DecodeDateTime(dec *imapwire.Decoder, lenient bool) (time.Time, error) {
 	var s string
 	if !dec.Quoted(&s) {
 		return time.Time{}, nil
 	}
-	t, err := time.Parse(DateTimeLayout, s)
+	t, err := imap.ParseDateTime(s, lenient)
 	if err != nil {
 		return time.Time{}, fmt.Errorf("in date-time: %v", err) // TODO: use imapwire.DecodeExpectError?
 	}
 	return t, err
 }
 
-func ExpectDateTime(dec *imapwire.Decoder) (time.Time, error) {
-	t, err := DecodeDateTime(dec)
+func ExpectDateTime(dec *imapwire.Decoder, lenient bool) (time.Time, error) {
+	t, err := DecodeDateTime(dec, lenient)
 	if err != nil {
 		return t, err
 	}
@@ -45,7 +42,7 @@ func ExpectDate(dec *imapwire.Decoder) (time.Time, error) {
 	if !dec.ExpectAString(&s) {
 		return time.Time{}, dec.Err()
 	}
-	t, err := time.Parse(DateLayout, s)
+	t, err := imap.ParseDate(s)
 	if err != nil {
 		return time.Time{}, fmt.Errorf("in date: %v", err) // use imapwire.DecodeExpectError?
 	}
@@ -104,24 +101,10 @@ func ExpectMailboxAttr(dec *imapwire.Decoder) (imap.MailboxAttr, error) {
 
 var (
 	canonOnce        sync.Once
-	canonFlag        map[string]imap.Flag
 	canonMailboxAttr map[string]imap.MailboxAttr
 )
 
 func canonInit() {
-	flags := []imap.Flag{
-		imap.FlagSeen,
-		imap.FlagAnswered,
-		imap.FlagFlagged,
-		imap.FlagDeleted,
-		imap.FlagDraft,
-		imap.FlagForwarded,
-		imap.FlagMDNSent,
-		imap.FlagJunk,
-		imap.FlagNotJunk,
-		imap.FlagPhishing,
-		imap.FlagImportant,
-	}
 	mailboxAttrs := []imap.MailboxAttr{
 		imap.MailboxAttrNonExistent,
 		imap.MailboxAttrNoInferiors,
@@ -142,20 +125,18 @@ func canonInit() {
 		imap.MailboxAttrImportant,
 	}
 
-	canonFlag = make(map[string]imap.Flag)
-	for _, flag := range flags {
-		canonFlag[strings.ToLower(string(flag))] = flag
-	}
-
 	canonMailboxAttr = make(map[string]imap.MailboxAttr)
 	for _, attr := range mailboxAttrs {
 		canonMailboxAttr[strings.ToLower(string(attr))] = attr
 	}
 }
 
+// canonicalFlag returns the canonical form of well-known flags. Other flags
+// are returned as-is.
 func canonicalFlag(s string) imap.Flag {
-	canonOnce.Do(canonInit)
-	if flag, ok := canonFlag[strings.ToLower(s)]; ok {
+	// Flag.Canonical lower-cases unknown flags, while well-known flags all
+	// contain upper-case letters
+	if flag := imap.Flag(s).Canonical(); string(flag) != strings.ToLower(s) {
 		return flag
 	}
 	return imap.Flag(s)
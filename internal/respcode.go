@@ -0,0 +1,332 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+// metadataRespCodes contains the response codes sent as arguments of the
+// METADATA response code.
+var metadataRespCodes = map[imap.ResponseCode]bool{
+	imap.ResponseCodeLongEntries: true,
+	imap.ResponseCodeMaxSize:     true,
+	imap.ResponseCodeTooMany:     true,
+	imap.ResponseCodeNoPrivate:   true,
+}
+
+// ReadRespCode reads a resp-text-code, after its opening bracket. The closing
+// bracket is left unread.
+//
+// Known response codes are decoded into the types documented in
+// imap.ResponseCodeData. The METADATA response code is flattened: its first
+// argument becomes the returned code. Arguments of other response codes are
+// returned as an imap.RawResponseCode.
+//
+// numKind is the kind of the number set of a MODIFIED response code.
+func ReadRespCode(dec *imapwire.Decoder, numKind imapwire.NumKind) (imap.ResponseCodeData, error) {
+	var name string
+	if !dec.ExpectAtom(&name) {
+		return nil, fmt.Errorf("in resp-text-code: %v", dec.Err())
+	}
+	code := imap.ResponseCode(strings.ToUpper(name))
+
+	switch code {
+	case imap.ResponseCodeCapability:
+		caps, err := ReadCapList(dec)
+		if err != nil {
+			return nil, err
+		} else if len(caps) == 0 {
+			return code, nil
+		}
+		return imap.CapabilityCode{Caps: caps}, nil
+	case imap.ResponseCodePermanentFlags:
+		if !dec.ExpectSP() {
+			return nil, fmt.Errorf("in resp-text-code: %v", dec.Err())
+		}
+		flags, err := ExpectFlagList(dec)
+		if err != nil {
+			return nil, fmt.Errorf("in resp-text-code: %v", err)
+		}
+		return imap.PermanentFlagsCode{Flags: flags}, nil
+	case imap.ResponseCodeUIDNext:
+		var uid imap.UID
+		if !dec.ExpectSP() || !dec.ExpectUID(&uid) {
+			return nil, fmt.Errorf("in resp-text-code: %v", dec.Err())
+		}
+		return imap.UIDNextCode{UIDNext: uid}, nil
+	case imap.ResponseCodeUIDValidity, imap.ResponseCodeUnseen:
+		var n uint32
+		if !dec.ExpectSP() || !dec.ExpectNumber(&n) {
+			return nil, fmt.Errorf("in resp-text-code: %v", dec.Err())
+		}
+		if code == imap.ResponseCodeUnseen {
+			return imap.UnseenCode{SeqNum: n}, nil
+		}
+		return imap.UIDValidityCode{UIDValidity: n}, nil
+	case imap.ResponseCodeAppendUID:
+		var data imap.AppendUIDCode
+		// The UID set contains more than one UID with MULTIAPPEND
+		if !dec.ExpectSP() || !dec.ExpectNumber(&data.UIDValidity) || !dec.ExpectSP() || !dec.ExpectUIDSet(&data.UIDs) {
+			return nil, fmt.Errorf("in resp-code-apnd: %v", dec.Err())
+		}
+		if data.UIDs.Dynamic() {
+			return nil, fmt.Errorf("in resp-code-apnd: unexpected dynamic UID set")
+		}
+		return data, nil
+	case imap.ResponseCodeCopyUID:
+		var data imap.CopyUIDCode
+		if !dec.ExpectSP() || !dec.ExpectNumber(&data.UIDValidity) || !dec.ExpectSP() || !dec.ExpectUIDSet(&data.SourceUIDs) || !dec.ExpectSP() || !dec.ExpectUIDSet(&data.DestUIDs) {
+			return nil, fmt.Errorf("in resp-code-copy: %v", dec.Err())
+		}
+		if data.SourceUIDs.Dynamic() || data.DestUIDs.Dynamic() {
+			return nil, fmt.Errorf("in resp-code-copy: unexpected dynamic UID set")
+		}
+		return data, nil
+	case imap.ResponseCodeBadCharset:
+		// The list of supported charsets is optional
+		if !dec.SP() {
+			return code, nil
+		}
+		var charsets []string
+		err := dec.ExpectList(func() error {
+			var charset string
+			if !dec.ExpectAString(&charset) {
+				return dec.Err()
+			}
+			charsets = append(charsets, charset)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("in resp-text-code: %v", err)
+		}
+		return imap.BadCharsetCode{Charsets: charsets}, nil
+	case imap.ResponseCodeHighestModSeq:
+		var modSeq imap.ModSeq
+		if !dec.ExpectSP() || !dec.ExpectModSeq(&modSeq) {
+			return nil, fmt.Errorf("in resp-text-code: %v", dec.Err())
+		}
+		return imap.HighestModSeqCode{HighestModSeq: modSeq}, nil
+	case imap.ResponseCodeModified:
+		var modified imap.NumSet
+		if !dec.ExpectSP() || !dec.ExpectNumSet(numKind, &modified) {
+			return nil, fmt.Errorf("in resp-code-modified: %v", dec.Err())
+		}
+		return imap.ModifiedCode{NumSet: modified}, nil
+	case imap.ResponseCodeBadEvent:
+		if !dec.ExpectSP() {
+			return nil, fmt.Errorf("in unsupported-events-code: %v", dec.Err())
+		}
+		var events []imap.NotifyEvent
+		err := dec.ExpectList(func() error {
+			var ev string
+			if !dec.ExpectAtom(&ev) {
+				return dec.Err()
+			}
+			events = append(events, imap.NotifyEvent(ev))
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("in unsupported-events-code: %v", err)
+		}
+		return imap.BadEventCode{Events: events}, nil
+	case imap.ResponseCodeMailboxID:
+		var id string
+		if !dec.ExpectSP() || !dec.ExpectSpecial('(') || !dec.ExpectAtom(&id) || !dec.ExpectSpecial(')') {
+			return nil, fmt.Errorf("in resp-code-mailboxid: %v", dec.Err())
+		}
+		return imap.MailboxIDCode{MailboxID: id}, nil
+	case imap.ResponseCodeMetadata:
+		if !dec.ExpectSP() || !dec.ExpectAtom(&name) {
+			return nil, fmt.Errorf("in resp-code-metadata: %v", dec.Err())
+		}
+		code = imap.ResponseCode(strings.ToUpper(name))
+		switch code {
+		case imap.ResponseCodeLongEntries, imap.ResponseCodeMaxSize:
+			var n uint32
+			if !dec.ExpectSP() || !dec.ExpectNumber(&n) {
+				return nil, fmt.Errorf("in resp-code-metadata: %v", dec.Err())
+			}
+			if code == imap.ResponseCodeLongEntries {
+				return imap.LongEntriesCode{Size: n}, nil
+			}
+			return imap.MaxSizeCode{Size: n}, nil
+		}
+		return code, nil
+	}
+
+	// [SP 1*<any TEXT-CHAR except "]">]
+	if !dec.SP() {
+		return code, nil
+	}
+	var arg string
+	if !dec.Func(&arg, isRespCodeArgChar) {
+		return code, nil
+	} else if code == imap.ResponseCodeBadURL {
+		return imap.BadURLCode{URL: arg}, nil
+	}
+	return imap.RawResponseCode{Name: code, Args: imap.RawResponseCodeArg(arg)}, nil
+}
+
+func isRespCodeArgChar(ch byte) bool {
+	return ch != ']' && ch != '\r' && ch != '\n'
+}
+
+// ReadCapList reads a space-separated list of capabilities, each one
+// preceded by a space.
+func ReadCapList(dec *imapwire.Decoder) ([]imap.Cap, error) {
+	var caps []imap.Cap
+	for dec.SP() {
+		// Some IMAP servers send multiple SP between caps:
+		// https://github.com/emersion/go-imap/pull/652
+		for dec.SP() {
+		}
+
+		var name string
+		if !dec.ExpectAtom(&name) {
+			return caps, fmt.Errorf("in capability-data: %v", dec.Err())
+		}
+		caps = append(caps, imap.Cap(name))
+	}
+	return caps, nil
+}
+
+// WriteRespCode writes a resp-text-code, including its brackets.
+//
+// Codes which are arguments of the METADATA response code are prefixed with
+// "METADATA". If the response code is invalid, nothing is written and an
+// error is returned.
+func WriteRespCode(enc *imapwire.Encoder, data imap.ResponseCodeData) error {
+	if err := checkRespCode(data); err != nil {
+		return err
+	}
+
+	code := data.Code()
+	enc.Special('[')
+	if metadataRespCodes[code] {
+		enc.Atom(string(imap.ResponseCodeMetadata)).SP()
+	}
+	enc.Atom(string(code))
+	switch data := data.(type) {
+	case imap.ResponseCode:
+		// no arguments
+	case imap.CapabilityCode:
+		for _, c := range data.Caps {
+			enc.SP().Atom(string(c))
+		}
+	case imap.PermanentFlagsCode:
+		enc.SP().List(len(data.Flags), func(i int) {
+			enc.Flag(data.Flags[i])
+		})
+	case imap.UIDNextCode:
+		enc.SP().UID(data.UIDNext)
+	case imap.UIDValidityCode:
+		enc.SP().Number(data.UIDValidity)
+	case imap.UnseenCode:
+		enc.SP().Number(data.SeqNum)
+	case imap.AppendUIDCode:
+		enc.SP().Number(data.UIDValidity).SP().NumSet(data.UIDs)
+	case imap.CopyUIDCode:
+		enc.SP().Number(data.UIDValidity).SP().NumSet(data.SourceUIDs).SP().NumSet(data.DestUIDs)
+	case imap.BadCharsetCode:
+		if len(data.Charsets) > 0 {
+			enc.SP().List(len(data.Charsets), func(i int) {
+				writeRespCodeString(enc, data.Charsets[i])
+			})
+		}
+	case imap.HighestModSeqCode:
+		enc.SP().ModSeq(data.HighestModSeq)
+	case imap.ModifiedCode:
+		enc.SP().NumSet(data.NumSet)
+	case imap.BadEventCode:
+		enc.SP().List(len(data.Events), func(i int) {
+			enc.Atom(string(data.Events[i]))
+		})
+	case imap.MailboxIDCode:
+		enc.SP().Special('(').Atom(data.MailboxID).Special(')')
+	case imap.LongEntriesCode:
+		enc.SP().Number(data.Size)
+	case imap.MaxSizeCode:
+		enc.SP().Number(data.Size)
+	case imap.BadURLCode:
+		enc.SP().Text(data.URL)
+	case imap.RawResponseCode:
+		enc.SP().Text(string(data.Args))
+	}
+	enc.Special(']')
+	return nil
+}
+
+// checkRespCode checks that a response code can be written.
+func checkRespCode(data imap.ResponseCodeData) error {
+	if data == nil {
+		return fmt.Errorf("imap: missing response code")
+	}
+	if !imapwire.IsAtom(string(data.Code())) {
+		return fmt.Errorf("imap: invalid response code %q", data.Code())
+	}
+	switch data := data.(type) {
+	case imap.ResponseCode:
+		// ok
+	case imap.CapabilityCode:
+		for _, c := range data.Caps {
+			if !imapwire.IsAtom(string(c)) {
+				return fmt.Errorf("imap: invalid capability %q", c)
+			}
+		}
+	case imap.AppendUIDCode:
+		if len(data.UIDs) == 0 {
+			return fmt.Errorf("imap: empty APPENDUID UID set")
+		}
+	case imap.CopyUIDCode:
+		if len(data.SourceUIDs) == 0 || len(data.DestUIDs) == 0 {
+			return fmt.Errorf("imap: empty COPYUID UID set")
+		}
+	case imap.ModifiedCode:
+		if data.NumSet == nil {
+			return fmt.Errorf("imap: missing MODIFIED number set")
+		}
+	case imap.MailboxIDCode:
+		if !imapwire.IsAtom(data.MailboxID) {
+			return fmt.Errorf("imap: invalid mailbox ID %q", data.MailboxID)
+		}
+	case imap.BadURLCode:
+		if !isRespCodeArg(data.URL) {
+			return fmt.Errorf("imap: invalid BADURL argument %q", data.URL)
+		}
+	case imap.RawResponseCode:
+		if !isRespCodeArg(string(data.Args)) {
+			return fmt.Errorf("imap: invalid raw response code argument %q", data.Args)
+		}
+	case imap.PermanentFlagsCode, imap.UIDNextCode, imap.UIDValidityCode, imap.UnseenCode, imap.BadCharsetCode, imap.HighestModSeqCode, imap.BadEventCode, imap.LongEntriesCode, imap.MaxSizeCode:
+		// ok
+	default:
+		return fmt.Errorf("imap: unsupported response code type %T", data)
+	}
+	return nil
+}
+
+// isRespCodeArg checks whether s is a valid raw response code argument.
+func isRespCodeArg(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, ch := range []byte(s) {
+		if !isRespCodeArgChar(ch) {
+			return false
+		}
+	}
+	return true
+}
+
+// writeRespCodeString writes an atom or a quoted string. Literals are not
+// allowed in response codes.
+func writeRespCodeString(enc *imapwire.Encoder, s string) {
+	if imapwire.IsAtom(s) {
+		enc.Atom(s)
+	} else {
+		enc.Quoted(s)
+	}
+}
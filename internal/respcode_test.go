@@ -0,0 +1,288 @@
+package internal
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+func readRespCode(s string, kind imapwire.NumKind) (imap.ResponseCodeData, error) {
+	dec := imapwire.NewDecoder(bufio.NewReader(strings.NewReader(s+"]\r\n")), imapwire.ConnSideClient)
+	data, err := ReadRespCode(dec, kind)
+	if err != nil {
+		return data, err
+	}
+	if !dec.ExpectSpecial(']') || !dec.ExpectCRLF() {
+		return data, dec.Err()
+	}
+	return data, nil
+}
+
+func writeRespCode(data imap.ResponseCodeData) string {
+	var sb strings.Builder
+	bw := bufio.NewWriter(&sb)
+	if err := WriteRespCode(imapwire.NewEncoder(bw, imapwire.ConnSideServer), data); err != nil {
+		return err.Error()
+	}
+	bw.Flush()
+	return strings.TrimSuffix(strings.TrimPrefix(sb.String(), "["), "]")
+}
+
+var respCodeTests = []struct {
+	s    string
+	kind imapwire.NumKind
+	data imap.ResponseCodeData
+}{
+	// Response codes without arguments
+	{s: "ALERT", data: imap.ResponseCodeAlert},
+	{s: "ALREADYEXISTS", data: imap.ResponseCodeAlreadyExists},
+	{s: "AUTHENTICATIONFAILED", data: imap.ResponseCodeAuthenticationFailed},
+	{s: "AUTHORIZATIONFAILED", data: imap.ResponseCodeAuthorizationFailed},
+	{s: "BADCHARSET", data: imap.ResponseCodeBadCharset},
+	{s: "CANNOT", data: imap.ResponseCodeCannot},
+	{s: "CAPABILITY", data: imap.ResponseCodeCapability},
+	{s: "CLIENTBUG", data: imap.ResponseCodeClientBug},
+	{s: "CONTACTADMIN", data: imap.ResponseCodeContactAdmin},
+	{s: "CORRUPTION", data: imap.ResponseCodeCorruption},
+	{s: "EXPIRED", data: imap.ResponseCodeExpired},
+	{s: "EXPUNGEISSUED", data: imap.ResponseCodeExpungeIssued},
+	{s: "HASCHILDREN", data: imap.ResponseCodeHasChildren},
+	{s: "INUSE", data: imap.ResponseCodeInUse},
+	{s: "LIMIT", data: imap.ResponseCodeLimit},
+	{s: "NONEXISTENT", data: imap.ResponseCodeNonExistent},
+	{s: "NOPERM", data: imap.ResponseCodeNoPerm},
+	{s: "OVERQUOTA", data: imap.ResponseCodeOverQuota},
+	{s: "PARSE", data: imap.ResponseCodeParse},
+	{s: "PRIVACYREQUIRED", data: imap.ResponseCodePrivacyRequired},
+	{s: "SERVERBUG", data: imap.ResponseCodeServerBug},
+	{s: "TRYCREATE", data: imap.ResponseCodeTryCreate},
+	{s: "UNAVAILABLE", data: imap.ResponseCodeUnavailable},
+	{s: "UNKNOWN-CTE", data: imap.ResponseCodeUnknownCTE},
+	{s: "METADATA TOOMANY", data: imap.ResponseCodeTooMany},
+	{s: "METADATA NOPRIVATE", data: imap.ResponseCodeNoPrivate},
+	{s: "NOMODSEQ", data: imap.ResponseCodeNoModSeq},
+	{s: "NOTIFICATIONOVERFLOW", data: imap.ResponseCodeNotificationOverflow},
+	{s: "COMPRESSIONACTIVE", data: imap.ResponseCodeCompressionActive},
+	{s: "TOOBIG", data: imap.ResponseCodeTooBig},
+	{s: "NOTSAVED", data: imap.ResponseCodeNotSaved},
+	{s: "USEATTR", data: imap.ResponseCodeUseAttr},
+	{s: "UIDNOTSTICKY", data: imap.ResponseCodeUIDNotSticky},
+	{s: "READ-ONLY", data: imap.ResponseCodeReadOnly},
+	{s: "READ-WRITE", data: imap.ResponseCodeReadWrite},
+	{s: "CLOSED", data: imap.ResponseCodeClosed},
+
+	// Response codes with arguments
+	{
+		s:    "BADCHARSET (UTF-8 ISO-8859-1 \"x]y\")",
+		data: imap.BadCharsetCode{Charsets: []string{"UTF-8", "ISO-8859-1", "x]y"}},
+	},
+	{
+		s:    "CAPABILITY IMAP4rev1 UIDPLUS AUTH=PLAIN",
+		data: imap.CapabilityCode{Caps: []imap.Cap{"IMAP4rev1", imap.CapUIDPlus, "AUTH=PLAIN"}},
+	},
+	{
+		s:    "METADATA LONGENTRIES 2199",
+		data: imap.LongEntriesCode{Size: 2199},
+	},
+	{
+		s:    "METADATA MAXSIZE 1024",
+		data: imap.MaxSizeCode{Size: 1024},
+	},
+	{
+		s:    "HIGHESTMODSEQ 715194045007",
+		data: imap.HighestModSeqCode{HighestModSeq: 715194045007},
+	},
+	{
+		s:    "MODIFIED 7,9",
+		kind: imapwire.NumKindSeq,
+		data: imap.ModifiedCode{NumSet: imap.SeqSetNum(7, 9)},
+	},
+	{
+		s:    "MODIFIED 12:14",
+		kind: imapwire.NumKindUID,
+		data: imap.ModifiedCode{NumSet: imap.UIDSet{{Start: 12, Stop: 14}}},
+	},
+	{
+		s:    "BADEVENT (MessageNew MessageExpunge)",
+		data: imap.BadEventCode{Events: []imap.NotifyEvent{imap.NotifyEventMessageNew, imap.NotifyEventMessageExpunge}},
+	},
+	{
+		s:    "BADURL /INBOX;UIDVALIDITY=785799047/;UID=113330;section=1.5.9",
+		data: imap.BadURLCode{URL: "/INBOX;UIDVALIDITY=785799047/;UID=113330;section=1.5.9"},
+	},
+	{
+		s:    "MAILBOXID (F2212ea87-6097-4256-9d51-71338625)",
+		data: imap.MailboxIDCode{MailboxID: "F2212ea87-6097-4256-9d51-71338625"},
+	},
+	{
+		s:    "APPENDUID 38505 3955",
+		data: imap.AppendUIDCode{UIDValidity: 38505, UIDs: imap.UIDSetNum(3955)},
+	},
+	{
+		s:    "APPENDUID 38505 3955:3957",
+		data: imap.AppendUIDCode{UIDValidity: 38505, UIDs: imap.UIDSet{{Start: 3955, Stop: 3957}}},
+	},
+	{
+		s: "COPYUID 38505 304,319:320 3956:3958",
+		data: imap.CopyUIDCode{
+			UIDValidity: 38505,
+			SourceUIDs:  imap.UIDSet{{Start: 304, Stop: 304}, {Start: 319, Stop: 320}},
+			DestUIDs:    imap.UIDSet{{Start: 3956, Stop: 3958}},
+		},
+	},
+	{
+		s:    "PERMANENTFLAGS (\\Deleted \\Seen \\*)",
+		data: imap.PermanentFlagsCode{Flags: []imap.Flag{imap.FlagDeleted, imap.FlagSeen, imap.FlagWildcard}},
+	},
+	{
+		s:    "PERMANENTFLAGS ()",
+		data: imap.PermanentFlagsCode{},
+	},
+	{
+		s:    "UIDNEXT 4392",
+		data: imap.UIDNextCode{UIDNext: 4392},
+	},
+	{
+		s:    "UIDVALIDITY 3857529045",
+		data: imap.UIDValidityCode{UIDValidity: 3857529045},
+	},
+	{
+		s:    "UNSEEN 12",
+		data: imap.UnseenCode{SeqNum: 12},
+	},
+
+	// Unknown response codes, and unexpected arguments of known ones
+	{s: "X-CUSTOM", data: imap.ResponseCode("X-CUSTOM")},
+	{
+		s:    "X-CUSTOM foo (bar) 42",
+		data: imap.RawResponseCode{Name: "X-CUSTOM", Args: "foo (bar) 42"},
+	},
+	{
+		s:    "ALERT some [text",
+		data: imap.RawResponseCode{Name: imap.ResponseCodeAlert, Args: "some [text"},
+	},
+}
+
+func TestRespCode(t *testing.T) {
+	for _, tc := range respCodeTests {
+		tc := tc
+		t.Run(tc.s, func(t *testing.T) {
+			kind := tc.kind
+			if kind == 0 {
+				kind = imapwire.NumKindSeq
+			}
+			data, err := readRespCode(tc.s, kind)
+			if err != nil {
+				t.Fatalf("ReadRespCode() = %v", err)
+			}
+			if !reflect.DeepEqual(data, tc.data) {
+				t.Errorf("ReadRespCode() = %#v, want %#v", data, tc.data)
+			}
+			if s := writeRespCode(tc.data); s != tc.s {
+				t.Errorf("WriteRespCode() = %q, want %q", s, tc.s)
+			}
+
+			// The untyped representation must hold the same data
+			var resp imap.StatusResponse
+			resp.SetCodeData(tc.data)
+			if data, err := resp.CodeData(); err != nil {
+				t.Errorf("CodeData() = %v", err)
+			} else if !reflect.DeepEqual(data, tc.data) {
+				t.Errorf("CodeData() = %#v, want %#v", data, tc.data)
+			}
+		})
+	}
+}
+
+func TestRespCode_lenient(t *testing.T) {
+	tests := []struct {
+		s    string
+		data imap.ResponseCodeData
+	}{
+		{"read-only", imap.ResponseCodeReadOnly},
+		{"metadata maxsize 1024", imap.MaxSizeCode{Size: 1024}},
+		{"CAPABILITY  IMAP4rev1   IDLE", imap.CapabilityCode{Caps: []imap.Cap{"IMAP4rev1", imap.CapIdle}}},
+		{"PERMANENTFLAGS ( \\Seen)", imap.PermanentFlagsCode{Flags: []imap.Flag{imap.FlagSeen}}},
+		{"X-CUSTOM ", imap.ResponseCode("X-CUSTOM")},
+	}
+	for _, tc := range tests {
+		data, err := readRespCode(tc.s, imapwire.NumKindSeq)
+		if err != nil {
+			t.Errorf("ReadRespCode(%q) = %v", tc.s, err)
+		} else if !reflect.DeepEqual(data, tc.data) {
+			t.Errorf("ReadRespCode(%q) = %#v, want %#v", tc.s, data, tc.data)
+		}
+	}
+}
+
+func TestRespCode_invalid(t *testing.T) {
+	tests := []string{
+		"UIDNEXT",
+		"UIDNEXT foo",
+		"UIDVALIDITY -1",
+		"HIGHESTMODSEQ foo",
+		"PERMANENTFLAGS \\Seen",
+		"APPENDUID 38505",
+		"APPENDUID 38505 1:*",
+		"COPYUID 38505 1:3 $",
+		"MODIFIED",
+		"MAILBOXID F2212ea87",
+		"BADEVENT MessageNew",
+		"METADATA MAXSIZE",
+		"METADATA",
+	}
+	for _, s := range tests {
+		if data, err := readRespCode(s, imapwire.NumKindSeq); err == nil {
+			t.Errorf("ReadRespCode(%q) = %#v, want an error", s, data)
+		}
+	}
+}
+
+func TestWriteRespCode_invalid(t *testing.T) {
+	tests := []imap.ResponseCodeData{
+		nil,
+		imap.ResponseCode(""),
+		imap.ResponseCode("X CUSTOM"),
+		imap.RawResponseCode{Name: "X-CUSTOM", Args: "foo] bar"},
+		imap.RawResponseCode{Name: "X-CUSTOM", Args: "foo\r\n"},
+		imap.RawResponseCode{Name: "X-CUSTOM"},
+		imap.BadURLCode{URL: "imap://x]"},
+		imap.CapabilityCode{Caps: []imap.Cap{"AUTH PLAIN"}},
+		imap.AppendUIDCode{UIDValidity: 42},
+		imap.CopyUIDCode{UIDValidity: 42, SourceUIDs: imap.UIDSetNum(1)},
+		imap.ModifiedCode{},
+		imap.MailboxIDCode{MailboxID: "a b"},
+	}
+	for _, data := range tests {
+		var sb strings.Builder
+		bw := bufio.NewWriter(&sb)
+		if err := WriteRespCode(imapwire.NewEncoder(bw, imapwire.ConnSideServer), data); err == nil {
+			t.Errorf("WriteRespCode(%#v) = nil, want an error", data)
+		}
+		bw.Flush()
+		if sb.Len() > 0 {
+			t.Errorf("WriteRespCode(%#v) wrote %q, want nothing", data, sb.String())
+		}
+	}
+}
+
+func TestStatusResponseCodeData_invalid(t *testing.T) {
+	tests := []imap.StatusResponse{
+		{CodeArgs: []interface{}{uint32(42)}},
+		{Code: imap.ResponseCodeCapability, CodeArgs: []interface{}{"IMAP4rev1"}},
+		{Code: imap.ResponseCodeUIDNext, CodeArgs: []interface{}{uint32(42)}},
+		{Code: imap.ResponseCodeAppendUID, CodeArgs: []interface{}{uint32(42), imap.UID(1)}},
+		{Code: imap.ResponseCodeCopyUID, CodeArgs: []interface{}{uint32(42), imap.UIDSetNum(1)}},
+		{Code: "X-CUSTOM", CodeArgs: []interface{}{"foo"}},
+		{Code: "X-CUSTOM", CodeArgs: []interface{}{imap.RawResponseCodeArg("foo"), imap.RawResponseCodeArg("bar")}},
+	}
+	for _, resp := range tests {
+		if data, err := resp.CodeData(); err == nil {
+			t.Errorf("CodeData() for %v %#v = %#v, want an error", resp.Code, resp.CodeArgs, data)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package searchkey
+
+import (
+	"fmt"
+	"time"
+	"unicode"
+)
+
+// Decoder reads the tokens of search keys. It's implemented by
+// imapwire.Decoder, and by the imap package for ParseSearchCriteria.
+type Decoder interface {
+	Err() error
+	Expect(ok bool, name string) bool
+	SP() bool
+	ExpectSP() bool
+	Special(ch byte) bool
+	ExpectSpecial(ch byte) bool
+	Func(ptr *string, valid func(ch byte) bool) bool
+	ExpectAtom(ptr *string) bool
+	ExpectAString(ptr *string) bool
+	ExpectNumber64(ptr *int64) bool
+}
+
+// Encoder writes the tokens of search keys.
+type Encoder interface {
+	SP()
+	Special(ch byte)
+	// Atom writes a search key name, a number or an atom argument.
+	Atom(s string)
+	// Flag writes the argument of KEYWORD and UNKEYWORD.
+	Flag(s string)
+	// NumSet writes an imap.NumSet.
+	NumSet(set fmt.Stringer)
+	Quoted(s string)
+	String(s string)
+}
+
+// IsAtomChar returns true if ch is an ATOM-CHAR.
+func IsAtomChar(ch byte) bool {
+	switch ch {
+	case '(', ')', '{', ' ', '%', '*', '"', '\\', ']':
+		return false
+	default:
+		return !unicode.IsControl(rune(ch))
+	}
+}
+
+// IsKeyChar returns true if ch can appear in a search key name. Sequence sets
+// are valid search keys, so '*' is allowed.
+func IsKeyChar(ch byte) bool {
+	return ch == '*' || IsAtomChar(ch)
+}
+
+// WithinSeconds converts a duration to seconds for the OLDER and YOUNGER
+// search keys, rounding up.
+func WithinSeconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,68 @@
+// Package searchkey contains the IMAP SEARCH command grammar.
+//
+// It's shared by the client, the server and the textual representation of
+// search criteria in the imap package, so it must not import it. The grammar
+// itself operates on imap.SearchCriteria, so it's implemented by the imap
+// package and exposed via imap.ReadSearchKey and imap.WriteSearchKey, which
+// take a Decoder or an Encoder.
+package searchkey
+
+import (
+	"strings"
+)
+
+var flagKeys = map[string]string{
+	`\Answered`: "ANSWERED",
+	`\Deleted`:  "DELETED",
+	`\Draft`:    "DRAFT",
+	`\Flagged`:  "FLAGGED",
+	`\Seen`:     "SEEN",
+}
+
+var headerKeys = map[string]string{
+	"BCC":     "Bcc",
+	"CC":      "Cc",
+	"FROM":    "From",
+	"SUBJECT": "Subject",
+	"TO":      "To",
+}
+
+// FlagKey returns the search key matching messages with a system flag, e.g.
+// "SEEN" for "\Seen". Prefixing the key with "UN" negates it.
+//
+// An empty string is returned if the flag doesn't have a dedicated search key:
+// KEYWORD needs to be used instead.
+func FlagKey(flag string) string {
+	return flagKeys[flag]
+}
+
+// KeyFlag returns the system flag matched by an upper-case search key, e.g.
+// "\Seen" for "SEEN".
+func KeyFlag(key string) (flag string, ok bool) {
+	for flag, k := range flagKeys {
+		if k == key {
+			return flag, true
+		}
+	}
+	return "", false
+}
+
+// HeaderKey returns the search key matching messages with a header field, e.g.
+// "FROM" for "From".
+//
+// An empty string is returned if the header field doesn't have a dedicated
+// search key: HEADER needs to be used instead.
+func HeaderKey(field string) string {
+	k := strings.ToUpper(field)
+	if _, ok := headerKeys[k]; !ok {
+		return ""
+	}
+	return k
+}
+
+// KeyHeader returns the header field matched by an upper-case search key, e.g.
+// "From" for "FROM".
+func KeyHeader(key string) (field string, ok bool) {
+	field, ok = headerKeys[key]
+	return field, ok
+}
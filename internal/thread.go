@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+// maxThreadNesting is the maximum number of nested parenthesized lists in a
+// THREAD response. Long chains of messages don't count towards this limit.
+const maxThreadNesting = 1000
+
+// ReadThreadList reads a thread-list, after its opening parenthesis.
+//
+// A thread-list contains a chain of messages, each one being the parent of
+// the next one, optionally followed by nested thread-lists which are the
+// children of the last message of the chain. If the chain is empty, the
+// nested thread-lists are grouped under a dummy node.
+func ReadThreadList(dec *imapwire.Decoder) (*imap.ThreadData, error) {
+	return readThreadList(dec, 0)
+}
+
+func readThreadList(dec *imapwire.Decoder, depth int) (*imap.ThreadData, error) {
+	if depth >= maxThreadNesting {
+		return nil, fmt.Errorf("thread-list nested too deeply")
+	}
+
+	var (
+		chain    []uint32
+		children []imap.ThreadData
+	)
+	for {
+		var num uint32
+		if len(children) == 0 && dec.Number(&num) {
+			// Zero is reserved for dummy nodes
+			if num == 0 {
+				return nil, fmt.Errorf("invalid message number 0 in thread-list")
+			}
+			chain = append(chain, num)
+		} else if dec.Special('(') {
+			child, err := readThreadList(dec, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			children = append(children, *child)
+		} else {
+			dec.Expect(false, "thread-list")
+			return nil, dec.Err()
+		}
+
+		if dec.Special(')') {
+			break
+		} else if len(children) == 0 && !dec.ExpectSP() {
+			return nil, dec.Err()
+		}
+		// Nested thread-lists aren't separated by spaces
+	}
+
+	if len(chain) == 0 && len(children) == 0 {
+		return nil, fmt.Errorf("empty thread-list")
+	}
+
+	// Build the chain bottom-up to avoid recursion
+	node := imap.ThreadData{Children: children}
+	if len(chain) > 0 {
+		node.Num = chain[len(chain)-1]
+		for i := len(chain) - 2; i >= 0; i-- {
+			node = imap.ThreadData{Num: chain[i], Children: []imap.ThreadData{node}}
+		}
+	}
+	return &node, nil
+}
@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+func readThreads(s string) ([]imap.ThreadData, error) {
+	dec := imapwire.NewDecoder(bufio.NewReader(strings.NewReader(s+"\r\n")), imapwire.ConnSideClient)
+	var l []imap.ThreadData
+	for dec.Special('(') {
+		data, err := ReadThreadList(dec)
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, *data)
+	}
+	if !dec.ExpectCRLF() {
+		return nil, dec.Err()
+	}
+	return l, nil
+}
+
+func writeThreads(l []imap.ThreadData) string {
+	var sb strings.Builder
+	bw := bufio.NewWriter(&sb)
+	enc := imapwire.NewEncoder(bw, imapwire.ConnSideServer)
+	for i := range l {
+		writeThreadList(enc, &l[i])
+	}
+	bw.Flush()
+	return sb.String()
+}
+
+// writeThreadList writes a thread-list, including its parentheses. It's the
+// reverse of ReadThreadList.
+//
+// A thread with a single message is written as "(1)". Messages with a single
+// child are written as a chain, e.g. "(1 2 3)". A dummy node is written as a
+// thread-list containing only nested thread-lists, e.g. "((1)(2))".
+func writeThreadList(enc *imapwire.Encoder, data *imap.ThreadData) {
+	enc.Special('(')
+	node := data
+	if node.Num != 0 {
+		enc.Number(node.Num)
+		// Walk the chain iteratively, only nested thread-lists recurse
+		for len(node.Children) == 1 && node.Children[0].Num != 0 {
+			node = &node.Children[0]
+			enc.SP().Number(node.Num)
+		}
+		if len(node.Children) > 0 {
+			enc.SP()
+		}
+	}
+	for i := range node.Children {
+		writeThreadList(enc, &node.Children[i])
+	}
+	enc.Special(')')
+}
+
+// Examples from RFC 5256
+var threadListTests = []struct {
+	name    string
+	s       string
+	encoded string // if different from s
+	count   int
+	flat    []uint32
+}{
+	{
+		name:  "single",
+		s:     "(1)",
+		count: 1,
+		flat:  []uint32{1},
+	},
+	{
+		name:  "syntax",
+		s:     "(2)(3 6 (4 23)(44 7 96))",
+		count: 8,
+		flat:  []uint32{2, 3, 6, 4, 23, 44, 7, 96},
+	},
+	{
+		name:  "missing_root",
+		s:     "((3)(5))",
+		count: 2,
+		flat:  []uint32{3, 5},
+	},
+	{
+		name:  "orderedsubject",
+		s:     "(166)(167)(168)(169)(172)(170)(171)(173)(174 (175)(176)(178)(181)(180))(179)(177 (183)(182)(188)(184)(185)(186)(187)(189))(190)(191)(192)(193)(194 195)(196 (197)(198))(199)(200 202)(201)(203)(204)(205)(206 207)(208)",
+		count: 43,
+	},
+	{
+		name: "references",
+		s:    "(166)(167)(168)(169)(172)((170)(179))(171)(173)((174)(175)(176)(178)(181)(180))(177 (183)(182)(188 (184)(185)(186)(187)(189)))(190)(191)(192)(193)((194)(195 (196 (197)(198))))(199)(200 202)(201)(203)(204)(205 206 207)(208)",
+		// A single child isn't written as a nested thread-list
+		encoded: "(166)(167)(168)(169)(172)((170)(179))(171)(173)((174)(175)(176)(178)(181)(180))(177 (183)(182)(188 (184)(185)(186)(187)(189)))(190)(191)(192)(193)((194)(195 196 (197)(198)))(199)(200 202)(201)(203)(204)(205 206 207)(208)",
+		count:   43,
+		flat: []uint32{
+			166, 167, 168, 169, 172, 170, 179, 171, 173, 174, 175, 176, 178,
+			181, 180, 177, 183, 182, 188, 184, 185, 186, 187, 189, 190, 191,
+			192, 193, 194, 195, 196, 197, 198, 199, 200, 202, 201, 203, 204,
+			205, 206, 207, 208,
+		},
+	},
+}
+
+func TestThreadList(t *testing.T) {
+	for _, tc := range threadListTests {
+		t.Run(tc.name, func(t *testing.T) {
+			l, err := readThreads(tc.s)
+			if err != nil {
+				t.Fatalf("ReadThreadList() = %v", err)
+			}
+			want := tc.encoded
+			if want == "" {
+				want = tc.s
+			}
+			if s := writeThreads(l); s != want {
+				t.Errorf("writeThreadList() = %q, want %q", s, want)
+			}
+
+			var (
+				count int
+				flat  []uint32
+			)
+			for i := range l {
+				count += l[i].Count()
+				flat = append(flat, l[i].Flatten()...)
+			}
+			if count != tc.count {
+				t.Errorf("Count() = %v, want %v", count, tc.count)
+			}
+			if tc.flat != nil && !reflect.DeepEqual(flat, tc.flat) {
+				t.Errorf("Flatten() = %v, want %v", flat, tc.flat)
+			}
+		})
+	}
+}
+
+func TestWriteThreadList(t *testing.T) {
+	tests := []struct {
+		data imap.ThreadData
+		s    string
+	}{
+		{imap.ThreadData{Num: 1}, "(1)"},
+		{imap.ThreadData{Num: 1, Children: []imap.ThreadData{{Num: 2}}}, "(1 2)"},
+		{imap.ThreadData{Children: []imap.ThreadData{{Num: 1}, {Num: 2}}}, "((1)(2))"},
+		{imap.ThreadData{Children: []imap.ThreadData{{Num: 1, Children: []imap.ThreadData{{Num: 2}}}}}, "((1 2))"},
+		{
+			imap.ThreadData{Num: 1, Children: []imap.ThreadData{
+				{Children: []imap.ThreadData{{Num: 2}, {Num: 3}}},
+			}},
+			"(1 ((2)(3)))",
+		},
+	}
+	for _, tc := range tests {
+		if s := writeThreads([]imap.ThreadData{tc.data}); s != tc.s {
+			t.Errorf("writeThreadList(%+v) = %q, want %q", tc.data, s, tc.s)
+		}
+	}
+}
+
+func FuzzReadThreadList(f *testing.F) {
+	for _, tc := range threadListTests {
+		f.Add(tc.s)
+	}
+	f.Add("(1 (2))")
+	f.Add("((((1))))")
+	f.Fuzz(func(t *testing.T, s string) {
+		if strings.ContainsAny(s, "\r\n") {
+			return
+		}
+		l, err := readThreads(s)
+		if err != nil {
+			return
+		}
+		// The first encoding may differ from the input, e.g. "(1 (2))" is
+		// written as "(1 2)", but it must be stable
+		encoded := writeThreads(l)
+		l2, err := readThreads(encoded)
+		if err != nil {
+			t.Fatalf("ReadThreadList(%q) = %v", encoded, err)
+		}
+		if !reflect.DeepEqual(l, l2) {
+			t.Errorf("ReadThreadList(%q) = %v, want %v", encoded, l2, l)
+		}
+		if encoded2 := writeThreads(l2); encoded2 != encoded {
+			t.Errorf("writeThreadList() = %q, want %q", encoded2, encoded)
+		}
+	})
+}
@@ -70,6 +70,12 @@ func Decode(src string) (string, error) {
 	return sb.String(), nil
 }
 
+// Unescape passes through raw UTF-8 as-is and unescapes the special UTF-7
+// marker (the ampersand character). It's the inverse of Escape.
+func Unescape(src string) string {
+	return strings.ReplaceAll(src, "&-", "&")
+}
+
 // Extracts UTF-16-BE bytes from base64 data and converts them to UTF-8.
 // A nil slice is returned if the encoding is invalid.
 func decode(b64 []byte) []byte {
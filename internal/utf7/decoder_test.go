@@ -51,6 +51,10 @@ var decode = []struct {
 	{"&AAAAHwB,AIA=-", "", false},
 	{"&AAAAHwB,AIA==-", "", false},
 
+	// Non-zero trailing bits
+	{"&AOl-", "", false},
+	{"&2D3eCh-", "", false},
+
 	// One byte short
 	{"&2A-", "", false},
 	{"&2ADc-", "", false},
@@ -113,3 +117,11 @@ func TestDecoder(t *testing.T) {
 		}
 	}
 }
+
+func TestUnescape(t *testing.T) {
+	for _, in := range []string{"", "abc", "a&b&c", "Входящие & Архив"} {
+		if out := utf7.Unescape(utf7.Escape(in)); out != in {
+			t.Errorf("Unescape(Escape(%+q)) = %+q", in, out)
+		}
+	}
+}
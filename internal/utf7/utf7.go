@@ -10,4 +10,6 @@ const (
 	max = 0x7E // Maximum self-representing UTF-7 value
 )
 
-var b64Enc = base64.NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+,")
+// Strict mode rejects non-zero trailing bits, so that every string has a
+// single valid encoding
+var b64Enc = base64.NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+,").Strict()
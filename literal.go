@@ -0,0 +1,83 @@
+package imap
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// NewLiteral returns a literal reading from b.
+//
+// The returned literal is re-readable, see RewindLiteral.
+func NewLiteral(b []byte) LiteralReader {
+	return bytes.NewReader(b)
+}
+
+// NewFileLiteral returns a literal reading f from its current offset to its
+// end. The size is determined when NewFileLiteral is called.
+//
+// The returned literal is re-readable, see RewindLiteral.
+func NewFileLiteral(f *os.File) (LiteralReader, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	if offset > fi.Size() {
+		return nil, fmt.Errorf("imap: file offset %v is past the end of the file", offset)
+	}
+	return io.NewSectionReader(f, offset, fi.Size()-offset), nil
+}
+
+// NewReaderLiteral returns a literal reading exactly size bytes from r.
+//
+// Reading fails with io.ErrUnexpectedEOF if r ends early. Extra data in r is
+// left unread.
+func NewReaderLiteral(r io.Reader, size int64) LiteralReader {
+	return &readerLiteral{r: r, size: size, remaining: size}
+}
+
+type readerLiteral struct {
+	r               io.Reader
+	size, remaining int64
+}
+
+func (lit *readerLiteral) Read(b []byte) (int, error) {
+	if lit.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(b)) > lit.remaining {
+		b = b[:lit.remaining]
+	}
+	n, err := lit.r.Read(b)
+	lit.remaining -= int64(n)
+	if err == io.EOF {
+		if lit.remaining > 0 {
+			err = io.ErrUnexpectedEOF
+		} else {
+			err = nil
+		}
+	}
+	return n, err
+}
+
+func (lit *readerLiteral) Size() int64 {
+	return lit.size
+}
+
+// RewindLiteral returns a new literal reading the data of lit from the start.
+//
+// Literals implementing io.ReaderAt are re-readable, independently of how
+// much data has already been read from them. For other literals, false is
+// returned.
+func RewindLiteral(lit LiteralReader) (LiteralReader, bool) {
+	ra, ok := lit.(io.ReaderAt)
+	if !ok {
+		return nil, false
+	}
+	return io.NewSectionReader(ra, 0, lit.Size()), true
+}
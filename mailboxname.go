@@ -0,0 +1,33 @@
+package imap
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/emersion/go-imap/v2/internal/utf7"
+)
+
+// EncodeMailboxName encodes a mailbox name with modified UTF-7, as defined in
+// RFC 3501 section 5.1.3.
+//
+// An error is returned if the name isn't valid UTF-8.
+func EncodeMailboxName(name string) (string, error) {
+	if !utf8.ValidString(name) {
+		return "", fmt.Errorf("imap: mailbox name %q isn't valid UTF-8", name)
+	}
+	return utf7.Encode(name), nil
+}
+
+// DecodeMailboxName decodes a mailbox name encoded with modified UTF-7, as
+// defined in RFC 3501 section 5.1.3. Raw UTF-8 is accepted as well.
+//
+// Invalid encodings are rejected, including ones which aren't the shortest
+// form. In that case, the encoded name is returned unchanged along with an
+// error.
+func DecodeMailboxName(encoded string) (string, error) {
+	name, err := utf7.Decode(encoded)
+	if err != nil {
+		return encoded, fmt.Errorf("imap: invalid mailbox name %q: %w", encoded, err)
+	}
+	return name, nil
+}
@@ -1,5 +1,9 @@
 package imap
 
+import (
+	"strings"
+)
+
 // NamespaceData is the data returned by the NAMESPACE command.
 type NamespaceData struct {
 	Personal []NamespaceDescriptor
@@ -7,8 +11,80 @@ type NamespaceData struct {
 	Shared   []NamespaceDescriptor
 }
 
+// PersonalPrefix returns the prefix of the first personal namespace, or an
+// empty string if there is none.
+//
+// This is the prefix under which the user's mailboxes are usually created.
+func (data *NamespaceData) PersonalPrefix() string {
+	if len(data.Personal) == 0 {
+		return ""
+	}
+	return data.Personal[0].Prefix
+}
+
+// MatchPrefix returns the namespace a mailbox belongs to.
+//
+// The namespace with the longest matching prefix wins, so that e.g. with a
+// personal namespace "" and a shared namespace "Shared Folders/", the mailbox
+// "Shared Folders/Sales" belongs to the shared namespace. The prefix without
+// its trailing delimiter, e.g. "Shared Folders", belongs to the namespace as
+// well.
+func (data *NamespaceData) MatchPrefix(mailbox string) (*NamespaceDescriptor, bool) {
+	var (
+		best    *NamespaceDescriptor
+		bestLen = -1
+	)
+	for _, l := range [][]NamespaceDescriptor{data.Personal, data.Other, data.Shared} {
+		for i := range l {
+			descr := &l[i]
+			if descr.match(mailbox) && len(descr.Prefix) > bestLen {
+				best, bestLen = descr, len(descr.Prefix)
+			}
+		}
+	}
+	return best, best != nil
+}
+
 // NamespaceDescriptor describes a namespace.
 type NamespaceDescriptor struct {
-	Prefix string
-	Delim  rune
+	Prefix     string
+	Delim      rune // zero if the namespace has no hierarchy delimiter
+	Extensions []NamespaceExtension
+}
+
+func (descr *NamespaceDescriptor) match(mailbox string) bool {
+	if strings.HasPrefix(mailbox, descr.Prefix) {
+		return true
+	}
+	if descr.Delim == 0 {
+		return false
+	}
+	root := strings.TrimSuffix(descr.Prefix, string(descr.Delim))
+	return root != descr.Prefix && mailbox == root
+}
+
+// Join returns the name of a mailbox in the namespace. The hierarchy
+// delimiter is inserted after the prefix if necessary.
+func (descr *NamespaceDescriptor) Join(name string) string {
+	if descr.Prefix == "" || descr.Delim == 0 || strings.HasSuffix(descr.Prefix, string(descr.Delim)) {
+		return descr.Prefix + name
+	}
+	return descr.Prefix + string(descr.Delim) + name
+}
+
+// Extension returns the values of an extension parameter. Extension names are
+// case-insensitive.
+func (descr *NamespaceDescriptor) Extension(name string) ([]string, bool) {
+	for _, ext := range descr.Extensions {
+		if strings.EqualFold(ext.Name, name) {
+			return ext.Values, true
+		}
+	}
+	return nil, false
+}
+
+// NamespaceExtension is a namespace response extension parameter.
+type NamespaceExtension struct {
+	Name   string
+	Values []string
 }
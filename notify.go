@@ -0,0 +1,48 @@
+package imap
+
+// NotifyEvent is an event which can be requested with the NOTIFY command.
+type NotifyEvent string
+
+const (
+	NotifyEventMessageNew            NotifyEvent = "MessageNew"
+	NotifyEventMessageExpunge        NotifyEvent = "MessageExpunge"
+	NotifyEventFlagChange            NotifyEvent = "FlagChange"
+	NotifyEventAnnotationChange      NotifyEvent = "AnnotationChange"
+	NotifyEventMailboxName           NotifyEvent = "MailboxName"
+	NotifyEventSubscriptionChange    NotifyEvent = "SubscriptionChange"
+	NotifyEventMailboxMetadataChange NotifyEvent = "MailboxMetadataChange"
+	NotifyEventServerMetadataChange  NotifyEvent = "ServerMetadataChange"
+)
+
+// NotifyMailboxesKind describes a set of mailboxes for the NOTIFY command.
+type NotifyMailboxesKind string
+
+const (
+	NotifyMailboxesSelected        NotifyMailboxesKind = "SELECTED"
+	NotifyMailboxesSelectedDelayed NotifyMailboxesKind = "SELECTED-DELAYED"
+	NotifyMailboxesInboxes         NotifyMailboxesKind = "INBOXES"
+	NotifyMailboxesPersonal        NotifyMailboxesKind = "PERSONAL"
+	NotifyMailboxesSubscribed      NotifyMailboxesKind = "SUBSCRIBED"
+	NotifyMailboxesSubtree         NotifyMailboxesKind = "SUBTREE"
+	NotifyMailboxesMailboxes       NotifyMailboxesKind = "MAILBOXES"
+)
+
+// NotifyFilter is a filter for the NOTIFY command.
+type NotifyFilter struct {
+	// Request an initial STATUS response for each mailbox matched by the
+	// groups
+	Status bool
+	Groups []NotifyGroup
+}
+
+// NotifyGroup is a set of events requested for a set of mailboxes.
+type NotifyGroup struct {
+	Kind NotifyMailboxesKind
+	// Mailbox names, for NotifyMailboxesSubtree and NotifyMailboxesMailboxes
+	Mailboxes []string
+	// If empty, no event is requested for these mailboxes
+	Events []NotifyEvent
+	// Data items sent with NotifyEventMessageNew, only allowed for the
+	// selected mailbox
+	MessageNewFetch *FetchOptions
+}
@@ -1,6 +1,7 @@
 package imap
 
 import (
+	"fmt"
 	"unsafe"
 
 	"github.com/emersion/go-imap/v2/internal/imapnum"
@@ -75,6 +76,76 @@ func (s *SeqSet) AddSet(other SeqSet) {
 	s.numSetPtr().AddSet(other.numSet())
 }
 
+// Normalize returns a set containing the same sequence numbers, in canonical
+// form: ranges are sorted, overlapping and adjacent ranges are merged. For
+// instance, "7,*,5:6" becomes "5:7,*", and "3:9,1:5" becomes "1:9".
+//
+// Sets built with AddNum, AddRange and AddSet are always in canonical form.
+// String always returns the canonical form.
+func (s SeqSet) Normalize() SeqSet {
+	return seqSetFromNumSet(s.numSet().Normalize())
+}
+
+// NumsMax is like Nums, except that "*" is replaced with max, the
+// number of messages in the mailbox. As in IMAP, "n:*" with n > max is
+// equivalent to "max:n". If max is zero, "*" and "n:*" match nothing.
+//
+// For instance, "*", "*:*" and "1:*" with max = 3 respectively contain 3, 3
+// and 1, 2, 3.
+func (s SeqSet) NumsMax(max uint32) []uint32 {
+	nums, _ := s.numSet().Resolve(max).Nums()
+	return nums
+}
+
+// Count returns the number of sequence numbers contained in the set.
+//
+// An error is returned if the set is dynamic.
+func (s SeqSet) Count() (uint64, error) {
+	return s.numSet().Count()
+}
+
+// Each calls f for each sequence number contained in the set, in increasing
+// order, until f returns false. Unlike Nums, the sequence numbers are
+// never stored in memory all at once.
+//
+// An error is returned if the set is dynamic.
+func (s SeqSet) Each(f func(num uint32) bool) error {
+	return s.numSet().Each(f)
+}
+
+// Union returns a new set containing the sequence numbers contained in s or
+// other.
+func (s SeqSet) Union(other SeqSet) SeqSet {
+	return seqSetFromNumSet(s.numSet().Union(other.numSet()))
+}
+
+// Intersect returns a new set containing the sequence numbers contained in
+// both s and other.
+//
+// An error is returned if s or other is dynamic, since the value of "*" isn't
+// known.
+func (s SeqSet) Intersect(other SeqSet) (SeqSet, error) {
+	set, err := s.numSet().Intersect(other.numSet())
+	return seqSetFromNumSet(set), err
+}
+
+// Subtract returns a new set containing the sequence numbers contained in s
+// but not in other.
+//
+// An error is returned if s or other is dynamic, since the value of "*" isn't
+// known.
+func (s SeqSet) Subtract(other SeqSet) (SeqSet, error) {
+	set, err := s.numSet().Subtract(other.numSet())
+	return seqSetFromNumSet(set), err
+}
+
+// Equal returns true if s and other contain the same sequence numbers.
+//
+// Dynamic sets are compared symbolically: "1:*" is only equal to "1:*".
+func (s SeqSet) Equal(other SeqSet) bool {
+	return s.numSet().Equal(other.numSet())
+}
+
 // SeqRange is a range of message sequence numbers.
 type SeqRange struct {
 	Start, Stop uint32
@@ -135,6 +206,105 @@ func (s *UIDSet) AddSet(other UIDSet) {
 	s.numSetPtr().AddSet(other.numSet())
 }
 
+// Normalize returns a set containing the same UIDs, in canonical form. See
+// SeqSet.Normalize.
+func (s UIDSet) Normalize() UIDSet {
+	if IsSearchRes(s) {
+		return s
+	}
+	return uidSetFromNumSet(s.numSet().Normalize())
+}
+
+// NumsMax is like Nums, except that "*" is replaced with max, the
+// highest UID in the mailbox. As in IMAP, "n:*" with n > max is equivalent
+// to "max:n". If max is zero, "*" and "n:*" match nothing.
+//
+// For instance, "*", "*:*" and "1:*" with max = 3 respectively contain 3, 3
+// and 1, 2, 3.
+//
+// The SEARCHRES marker contains no UID.
+func (s UIDSet) NumsMax(max UID) []UID {
+	nums, _ := s.numSet().Resolve(uint32(max)).Nums()
+	return uidListFromNumList(nums)
+}
+
+// Count returns the number of UIDs contained in the set.
+//
+// An error is returned if the set is dynamic.
+func (s UIDSet) Count() (uint64, error) {
+	if IsSearchRes(s) {
+		return 0, errSearchResOperand
+	}
+	return s.numSet().Count()
+}
+
+// Each calls f for each UID contained in the set, in increasing order, until
+// f returns false. Unlike Nums, the UIDs are never stored in memory all at
+// once.
+//
+// An error is returned if the set is dynamic.
+func (s UIDSet) Each(f func(uid UID) bool) error {
+	if IsSearchRes(s) {
+		return errSearchResOperand
+	}
+	return s.numSet().Each(func(v uint32) bool {
+		return f(UID(v))
+	})
+}
+
+// Union returns a new set containing the UIDs contained in s or other.
+//
+// s and other must not be the SEARCHRES marker, see SearchRes.
+func (s UIDSet) Union(other UIDSet) UIDSet {
+	return uidSetFromNumSet(s.numSet().Union(other.numSet()))
+}
+
+// Intersect returns a new set containing the UIDs contained in both s and
+// other.
+//
+// An error is returned if s or other is dynamic, since the value of "*" isn't
+// known.
+func (s UIDSet) Intersect(other UIDSet) (UIDSet, error) {
+	if err := checkSearchResOperand(s, other); err != nil {
+		return nil, err
+	}
+	set, err := s.numSet().Intersect(other.numSet())
+	return uidSetFromNumSet(set), err
+}
+
+// Subtract returns a new set containing the UIDs contained in s but not in
+// other. For instance, it can be used to compute the UIDs which have been
+// added to a mailbox since the last synchronization.
+//
+// An error is returned if s or other is dynamic, since the value of "*" isn't
+// known.
+func (s UIDSet) Subtract(other UIDSet) (UIDSet, error) {
+	if err := checkSearchResOperand(s, other); err != nil {
+		return nil, err
+	}
+	set, err := s.numSet().Subtract(other.numSet())
+	return uidSetFromNumSet(set), err
+}
+
+// Equal returns true if s and other contain the same UIDs.
+//
+// Dynamic sets are compared symbolically: "1:*" is only equal to "1:*".
+func (s UIDSet) Equal(other UIDSet) bool {
+	if IsSearchRes(s) || IsSearchRes(other) {
+		return IsSearchRes(s) && IsSearchRes(other)
+	}
+	return s.numSet().Equal(other.numSet())
+}
+
+var errSearchResOperand = fmt.Errorf("imap: the SEARCHRES marker doesn't contain any known UID")
+
+func checkSearchResOperand(s, other UIDSet) error {
+	if IsSearchRes(s) || IsSearchRes(other) {
+		return errSearchResOperand
+	}
+	return nil
+}
+
 // UIDRange is a range of message UIDs.
 type UIDRange struct {
 	Start, Stop UID
@@ -147,3 +317,11 @@ func numListFromUIDList(uids []UID) []uint32 {
 func uidListFromNumList(nums []uint32) []UID {
 	return *(*[]UID)(unsafe.Pointer(&nums))
 }
+
+func seqSetFromNumSet(s imapnum.Set) SeqSet {
+	return *(*SeqSet)(unsafe.Pointer(&s))
+}
+
+func uidSetFromNumSet(s imapnum.Set) UIDSet {
+	return *(*UIDSet)(unsafe.Pointer(&s))
+}
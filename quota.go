@@ -1,5 +1,10 @@
 package imap
 
+import (
+	"math"
+	"strings"
+)
+
 // QuotaResourceType is a QUOTA resource type.
 //
 // See RFC 9208 section 5.
@@ -11,3 +16,76 @@ const (
 	QuotaResourceMailbox           QuotaResourceType = "MAILBOX"
 	QuotaResourceAnnotationStorage QuotaResourceType = "ANNOTATION-STORAGE"
 )
+
+// ParseQuotaResourceType parses a QUOTA resource type. Resource types are
+// case-insensitive: the known ones are returned in their canonical form,
+// unknown ones are returned unchanged.
+func ParseQuotaResourceType(s string) QuotaResourceType {
+	for _, typ := range []QuotaResourceType{
+		QuotaResourceStorage,
+		QuotaResourceMessage,
+		QuotaResourceMailbox,
+		QuotaResourceAnnotationStorage,
+	} {
+		if strings.EqualFold(s, string(typ)) {
+			return typ
+		}
+	}
+	return QuotaResourceType(s)
+}
+
+// QuotaData is the data returned by a QUOTA response.
+type QuotaData struct {
+	Root      string
+	Resources map[QuotaResourceType]QuotaResource
+}
+
+// UsagePercent returns the usage of a resource as a percentage of its limit.
+//
+// ok is false if the resource is missing or has a zero limit.
+func (data *QuotaData) UsagePercent(typ QuotaResourceType) (percent float64, ok bool) {
+	res, ok := data.Resources[typ]
+	if !ok || res.Limit == 0 {
+		return 0, false
+	}
+	return float64(res.Usage) * 100 / float64(res.Limit), true
+}
+
+// QuotaResource contains the usage and limit for a quota resource.
+//
+// The STORAGE resource is expressed in units of 1024 octets, see
+// QuotaStorageFromBytes and QuotaStorageToBytes.
+type QuotaResource struct {
+	Usage int64
+	Limit int64
+}
+
+// QuotaStorageFromBytes converts a number of octets to a STORAGE resource
+// value, in units of 1024 octets.
+//
+// The result is rounded up, so that a non-zero usage is never reported as
+// zero. Negative values are converted to zero.
+func QuotaStorageFromBytes(n int64) int64 {
+	if n <= 0 {
+		return 0
+	}
+	kib := n / 1024
+	if n%1024 != 0 {
+		kib++
+	}
+	return kib
+}
+
+// QuotaStorageToBytes converts a STORAGE resource value, in units of 1024
+// octets, to a number of octets.
+//
+// The result saturates at math.MaxInt64. Negative values are converted to
+// zero.
+func QuotaStorageToBytes(kib int64) int64 {
+	if kib <= 0 {
+		return 0
+	} else if kib > math.MaxInt64/1024 {
+		return math.MaxInt64
+	}
+	return kib * 1024
+}
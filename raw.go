@@ -0,0 +1,34 @@
+package imap
+
+// RawArg is a raw command argument or response value.
+//
+// It's one of RawAtom, RawString or RawList.
+type RawArg interface {
+	rawArg()
+}
+
+var (
+	_ RawArg = RawAtom("")
+	_ RawArg = RawString("")
+	_ RawArg = RawList(nil)
+)
+
+// RawAtom is an atom, a number or NIL.
+//
+// It's written as-is. It must not contain control characters such as CR or LF,
+// nor SP, parentheses, curly braces or double quotes, except inside a
+// bracketed section such as "BODY[HEADER.FIELDS (From)]".
+type RawAtom string
+
+func (RawAtom) rawArg() {}
+
+// RawString is a string, written as a quoted string or as a literal as
+// needed.
+type RawString string
+
+func (RawString) rawArg() {}
+
+// RawList is a parenthesized list.
+type RawList []RawArg
+
+func (RawList) rawArg() {}
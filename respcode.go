@@ -0,0 +1,426 @@
+package imap
+
+import (
+	"fmt"
+)
+
+// ResponseCodeData is a response code along with its arguments.
+//
+// Response codes without arguments are represented by their ResponseCode
+// value. Known response codes with arguments are represented by the *Code
+// types of this package, e.g. CopyUIDCode. Unknown response codes with
+// arguments, and known response codes with unexpected arguments, are
+// represented by RawResponseCode.
+//
+// The METADATA response code is flattened: "[METADATA MAXSIZE 1024]" is
+// represented by MaxSizeCode, and "[METADATA TOOMANY]" by
+// ResponseCodeTooMany.
+type ResponseCodeData interface {
+	// Code returns the response code.
+	Code() ResponseCode
+	// codeArgs returns the arguments in the form of StatusResponse.CodeArgs.
+	codeArgs() []interface{}
+}
+
+var (
+	_ ResponseCodeData = ResponseCode("")
+	_ ResponseCodeData = CapabilityCode{}
+	_ ResponseCodeData = PermanentFlagsCode{}
+	_ ResponseCodeData = UIDNextCode{}
+	_ ResponseCodeData = UIDValidityCode{}
+	_ ResponseCodeData = UnseenCode{}
+	_ ResponseCodeData = AppendUIDCode{}
+	_ ResponseCodeData = CopyUIDCode{}
+	_ ResponseCodeData = BadCharsetCode{}
+	_ ResponseCodeData = HighestModSeqCode{}
+	_ ResponseCodeData = ModifiedCode{}
+	_ ResponseCodeData = BadEventCode{}
+	_ ResponseCodeData = MailboxIDCode{}
+	_ ResponseCodeData = LongEntriesCode{}
+	_ ResponseCodeData = MaxSizeCode{}
+	_ ResponseCodeData = BadURLCode{}
+	_ ResponseCodeData = RawResponseCode{}
+)
+
+// Code implements ResponseCodeData for response codes without arguments.
+func (code ResponseCode) Code() ResponseCode {
+	return code
+}
+
+func (code ResponseCode) codeArgs() []interface{} {
+	return nil
+}
+
+// CapabilityCode is the CAPABILITY response code.
+type CapabilityCode struct {
+	Caps []Cap
+}
+
+func (CapabilityCode) Code() ResponseCode {
+	return ResponseCodeCapability
+}
+
+func (data CapabilityCode) codeArgs() []interface{} {
+	args := make([]interface{}, len(data.Caps))
+	for i, c := range data.Caps {
+		args[i] = c
+	}
+	return args
+}
+
+// PermanentFlagsCode is the PERMANENTFLAGS response code.
+type PermanentFlagsCode struct {
+	Flags []Flag
+}
+
+func (PermanentFlagsCode) Code() ResponseCode {
+	return ResponseCodePermanentFlags
+}
+
+func (data PermanentFlagsCode) codeArgs() []interface{} {
+	return []interface{}{data.Flags}
+}
+
+// UIDNextCode is the UIDNEXT response code.
+type UIDNextCode struct {
+	UIDNext UID
+}
+
+func (UIDNextCode) Code() ResponseCode {
+	return ResponseCodeUIDNext
+}
+
+func (data UIDNextCode) codeArgs() []interface{} {
+	return []interface{}{data.UIDNext}
+}
+
+// UIDValidityCode is the UIDVALIDITY response code.
+type UIDValidityCode struct {
+	UIDValidity uint32
+}
+
+func (UIDValidityCode) Code() ResponseCode {
+	return ResponseCodeUIDValidity
+}
+
+func (data UIDValidityCode) codeArgs() []interface{} {
+	return []interface{}{data.UIDValidity}
+}
+
+// UnseenCode is the UNSEEN response code, containing the sequence number of
+// the first unseen message.
+type UnseenCode struct {
+	SeqNum uint32
+}
+
+func (UnseenCode) Code() ResponseCode {
+	return ResponseCodeUnseen
+}
+
+func (data UnseenCode) codeArgs() []interface{} {
+	return []interface{}{data.SeqNum}
+}
+
+// AppendUIDCode is the APPENDUID response code. The UID set contains more
+// than one UID with MULTIAPPEND.
+type AppendUIDCode struct {
+	UIDValidity uint32
+	UIDs        UIDSet
+}
+
+func (AppendUIDCode) Code() ResponseCode {
+	return ResponseCodeAppendUID
+}
+
+func (data AppendUIDCode) codeArgs() []interface{} {
+	return []interface{}{data.UIDValidity, data.UIDs}
+}
+
+// CopyUIDCode is the COPYUID response code.
+type CopyUIDCode struct {
+	UIDValidity uint32
+	SourceUIDs  UIDSet
+	DestUIDs    UIDSet
+}
+
+func (CopyUIDCode) Code() ResponseCode {
+	return ResponseCodeCopyUID
+}
+
+func (data CopyUIDCode) codeArgs() []interface{} {
+	return []interface{}{data.UIDValidity, data.SourceUIDs, data.DestUIDs}
+}
+
+// BadCharsetCode is the BADCHARSET response code, with the list of supported
+// charsets. The list is optional: a BADCHARSET response code without
+// arguments is represented by ResponseCodeBadCharset.
+type BadCharsetCode struct {
+	Charsets []string
+}
+
+func (BadCharsetCode) Code() ResponseCode {
+	return ResponseCodeBadCharset
+}
+
+func (data BadCharsetCode) codeArgs() []interface{} {
+	if len(data.Charsets) == 0 {
+		return nil
+	}
+	return []interface{}{data.Charsets}
+}
+
+// HighestModSeqCode is the HIGHESTMODSEQ response code.
+type HighestModSeqCode struct {
+	HighestModSeq ModSeq
+}
+
+func (HighestModSeqCode) Code() ResponseCode {
+	return ResponseCodeHighestModSeq
+}
+
+func (data HighestModSeqCode) codeArgs() []interface{} {
+	return []interface{}{data.HighestModSeq}
+}
+
+// ModifiedCode is the MODIFIED response code. See ModifiedCodeArg.
+type ModifiedCode struct {
+	NumSet NumSet
+}
+
+func (ModifiedCode) Code() ResponseCode {
+	return ResponseCodeModified
+}
+
+func (data ModifiedCode) codeArgs() []interface{} {
+	return []interface{}{ModifiedCodeArg{NumSet: data.NumSet}}
+}
+
+// BadEventCode is the BADEVENT response code, with the list of unsupported
+// events.
+type BadEventCode struct {
+	Events []NotifyEvent
+}
+
+func (BadEventCode) Code() ResponseCode {
+	return ResponseCodeBadEvent
+}
+
+func (data BadEventCode) codeArgs() []interface{} {
+	return []interface{}{data.Events}
+}
+
+// MailboxIDCode is the MAILBOXID response code.
+type MailboxIDCode struct {
+	MailboxID string
+}
+
+func (MailboxIDCode) Code() ResponseCode {
+	return ResponseCodeMailboxID
+}
+
+func (data MailboxIDCode) codeArgs() []interface{} {
+	return []interface{}{data.MailboxID}
+}
+
+// LongEntriesCode is the METADATA LONGENTRIES response code, containing the
+// size of the biggest entry which wasn't returned.
+type LongEntriesCode struct {
+	Size uint32
+}
+
+func (LongEntriesCode) Code() ResponseCode {
+	return ResponseCodeLongEntries
+}
+
+func (data LongEntriesCode) codeArgs() []interface{} {
+	return []interface{}{data.Size}
+}
+
+// MaxSizeCode is the METADATA MAXSIZE response code, containing the maximum
+// size of an entry value.
+type MaxSizeCode struct {
+	Size uint32
+}
+
+func (MaxSizeCode) Code() ResponseCode {
+	return ResponseCodeMaxSize
+}
+
+func (data MaxSizeCode) codeArgs() []interface{} {
+	return []interface{}{data.Size}
+}
+
+// BadURLCode is the BADURL response code, containing the rejected URL.
+//
+// The URL must not contain "]", CR or LF characters.
+type BadURLCode struct {
+	URL string
+}
+
+func (BadURLCode) Code() ResponseCode {
+	return ResponseCodeBadURL
+}
+
+func (data BadURLCode) codeArgs() []interface{} {
+	return []interface{}{RawResponseCodeArg(data.URL)}
+}
+
+// RawResponseCode is a response code with arguments which aren't decoded.
+type RawResponseCode struct {
+	Name ResponseCode
+	Args RawResponseCodeArg
+}
+
+func (data RawResponseCode) Code() ResponseCode {
+	return data.Name
+}
+
+func (data RawResponseCode) codeArgs() []interface{} {
+	return []interface{}{data.Args}
+}
+
+// CodeData returns the response code and its arguments. Nil is returned if
+// the status response has no code.
+//
+// An error is returned if the arguments don't have the types documented in
+// StatusResponse.CodeArgs for the response code.
+func (resp *StatusResponse) CodeData() (ResponseCodeData, error) {
+	code, args := resp.Code, resp.CodeArgs
+	if code == "" {
+		if len(args) > 0 {
+			return nil, fmt.Errorf("imap: response code arguments without a response code")
+		}
+		return nil, nil
+	} else if len(args) == 0 {
+		return code, nil
+	}
+
+	var (
+		data ResponseCodeData
+		ok   bool
+	)
+	switch code {
+	case ResponseCodeCapability:
+		caps := make([]Cap, len(args))
+		ok = true
+		for i, arg := range args {
+			caps[i], ok = arg.(Cap)
+			if !ok {
+				break
+			}
+		}
+		data = CapabilityCode{Caps: caps}
+	case ResponseCodePermanentFlags:
+		var flags []Flag
+		if len(args) == 1 {
+			flags, ok = args[0].([]Flag)
+		}
+		data = PermanentFlagsCode{Flags: flags}
+	case ResponseCodeUIDNext:
+		var uid UID
+		if len(args) == 1 {
+			uid, ok = args[0].(UID)
+		}
+		data = UIDNextCode{UIDNext: uid}
+	case ResponseCodeUIDValidity:
+		var uidValidity uint32
+		if len(args) == 1 {
+			uidValidity, ok = args[0].(uint32)
+		}
+		data = UIDValidityCode{UIDValidity: uidValidity}
+	case ResponseCodeUnseen:
+		var seqNum uint32
+		if len(args) == 1 {
+			seqNum, ok = args[0].(uint32)
+		}
+		data = UnseenCode{SeqNum: seqNum}
+	case ResponseCodeAppendUID:
+		var appendUID AppendUIDCode
+		if len(args) == 2 {
+			appendUID.UIDValidity, ok = args[0].(uint32)
+			if ok {
+				appendUID.UIDs, ok = args[1].(UIDSet)
+			}
+		}
+		data = appendUID
+	case ResponseCodeCopyUID:
+		var copyUID CopyUIDCode
+		if len(args) == 3 {
+			copyUID.UIDValidity, ok = args[0].(uint32)
+			if ok {
+				copyUID.SourceUIDs, ok = args[1].(UIDSet)
+			}
+			if ok {
+				copyUID.DestUIDs, ok = args[2].(UIDSet)
+			}
+		}
+		data = copyUID
+	case ResponseCodeBadCharset:
+		var charsets []string
+		if len(args) == 1 {
+			charsets, ok = args[0].([]string)
+		}
+		data = BadCharsetCode{Charsets: charsets}
+	case ResponseCodeHighestModSeq:
+		var modSeq ModSeq
+		if len(args) == 1 {
+			modSeq, ok = args[0].(ModSeq)
+		}
+		data = HighestModSeqCode{HighestModSeq: modSeq}
+	case ResponseCodeModified:
+		var modified ModifiedCodeArg
+		if len(args) == 1 {
+			modified, ok = args[0].(ModifiedCodeArg)
+		}
+		data = ModifiedCode{NumSet: modified.NumSet}
+	case ResponseCodeBadEvent:
+		var events []NotifyEvent
+		if len(args) == 1 {
+			events, ok = args[0].([]NotifyEvent)
+		}
+		data = BadEventCode{Events: events}
+	case ResponseCodeMailboxID:
+		var id string
+		if len(args) == 1 {
+			id, ok = args[0].(string)
+		}
+		data = MailboxIDCode{MailboxID: id}
+	case ResponseCodeLongEntries, ResponseCodeMaxSize:
+		var size uint32
+		if len(args) == 1 {
+			size, ok = args[0].(uint32)
+		}
+		if code == ResponseCodeLongEntries {
+			data = LongEntriesCode{Size: size}
+		} else {
+			data = MaxSizeCode{Size: size}
+		}
+	case ResponseCodeBadURL:
+		var url RawResponseCodeArg
+		if len(args) == 1 {
+			url, ok = args[0].(RawResponseCodeArg)
+		}
+		data = BadURLCode{URL: string(url)}
+	default:
+		var raw RawResponseCodeArg
+		if len(args) == 1 {
+			raw, ok = args[0].(RawResponseCodeArg)
+		}
+		data = RawResponseCode{Name: code, Args: raw}
+	}
+	if !ok {
+		return nil, fmt.Errorf("imap: invalid arguments for response code %v", code)
+	}
+	return data, nil
+}
+
+// SetCodeData sets the response code and its arguments. A nil data removes
+// the response code.
+func (resp *StatusResponse) SetCodeData(data ResponseCodeData) {
+	if data == nil {
+		resp.Code, resp.CodeArgs = "", nil
+		return
+	}
+	resp.Code = data.Code()
+	resp.CodeArgs = data.codeArgs()
+}
@@ -26,10 +26,12 @@ const (
 	ResponseCodeAuthorizationFailed  ResponseCode = "AUTHORIZATIONFAILED"
 	ResponseCodeBadCharset           ResponseCode = "BADCHARSET"
 	ResponseCodeCannot               ResponseCode = "CANNOT"
+	ResponseCodeCapability           ResponseCode = "CAPABILITY"
 	ResponseCodeClientBug            ResponseCode = "CLIENTBUG"
 	ResponseCodeContactAdmin         ResponseCode = "CONTACTADMIN"
 	ResponseCodeCorruption           ResponseCode = "CORRUPTION"
 	ResponseCodeExpired              ResponseCode = "EXPIRED"
+	ResponseCodeExpungeIssued        ResponseCode = "EXPUNGEISSUED"
 	ResponseCodeHasChildren          ResponseCode = "HASCHILDREN"
 	ResponseCodeInUse                ResponseCode = "INUSE"
 	ResponseCodeLimit                ResponseCode = "LIMIT"
@@ -44,20 +46,120 @@ const (
 	ResponseCodeUnknownCTE           ResponseCode = "UNKNOWN-CTE"
 
 	// METADATA
-	ResponseCodeTooMany   ResponseCode = "TOOMANY"
-	ResponseCodeNoPrivate ResponseCode = "NOPRIVATE"
+	//
+	// These are sent as arguments of the METADATA response code, e.g.
+	// "[METADATA MAXSIZE 1024]". Numeric values are decoded as uint32
+	// response code arguments. StatusResponse.Code never contains
+	// ResponseCodeMetadata itself: the response code is flattened when
+	// decoded, and the prefix is added back when encoded.
+	ResponseCodeMetadata    ResponseCode = "METADATA"
+	ResponseCodeLongEntries ResponseCode = "LONGENTRIES"
+	ResponseCodeMaxSize     ResponseCode = "MAXSIZE"
+	ResponseCodeTooMany     ResponseCode = "TOOMANY"
+	ResponseCodeNoPrivate   ResponseCode = "NOPRIVATE"
+
+	// CONDSTORE
+	//
+	// The HIGHESTMODSEQ response code has a ModSeq argument. The MODIFIED
+	// response code has a ModifiedCodeArg argument.
+	ResponseCodeHighestModSeq ResponseCode = "HIGHESTMODSEQ"
+	ResponseCodeNoModSeq      ResponseCode = "NOMODSEQ"
+	ResponseCodeModified      ResponseCode = "MODIFIED"
+
+	// NOTIFY
+	//
+	// The BADEVENT response code has a []NotifyEvent argument.
+	ResponseCodeBadEvent             ResponseCode = "BADEVENT"
+	ResponseCodeNotificationOverflow ResponseCode = "NOTIFICATIONOVERFLOW"
+
+	// COMPRESS
+	ResponseCodeCompressionActive ResponseCode = "COMPRESSIONACTIVE"
 
 	// APPENDLIMIT
 	ResponseCodeTooBig ResponseCode = "TOOBIG"
+
+	// SEARCHRES
+	ResponseCodeNotSaved ResponseCode = "NOTSAVED"
+
+	// SPECIAL-USE
+	ResponseCodeUseAttr ResponseCode = "USEATTR"
+
+	// CATENATE
+	//
+	// The BADURL response code has a RawResponseCodeArg argument containing
+	// the rejected URL.
+	ResponseCodeBadURL ResponseCode = "BADURL"
+
+	// OBJECTID
+	//
+	// The MAILBOXID response code has a string argument.
+	ResponseCodeMailboxID ResponseCode = "MAILBOXID"
+
+	// UIDPLUS
+	//
+	// The APPENDUID response code has a uint32 UIDVALIDITY argument followed
+	// by a UIDSet argument. The COPYUID response code has a uint32
+	// UIDVALIDITY argument followed by the source and destination UIDSet
+	// arguments.
+	ResponseCodeAppendUID    ResponseCode = "APPENDUID"
+	ResponseCodeCopyUID      ResponseCode = "COPYUID"
+	ResponseCodeUIDNotSticky ResponseCode = "UIDNOTSTICKY"
+
+	// Mailbox selection
+	//
+	// The PERMANENTFLAGS response code has a []Flag argument, UIDNEXT has a
+	// UID argument, UIDVALIDITY and UNSEEN have a uint32 argument.
+	ResponseCodeReadOnly       ResponseCode = "READ-ONLY"
+	ResponseCodeReadWrite      ResponseCode = "READ-WRITE"
+	ResponseCodePermanentFlags ResponseCode = "PERMANENTFLAGS"
+	ResponseCodeUIDNext        ResponseCode = "UIDNEXT"
+	ResponseCodeUIDValidity    ResponseCode = "UIDVALIDITY"
+	ResponseCodeUnseen         ResponseCode = "UNSEEN"
+	ResponseCodeClosed         ResponseCode = "CLOSED"
 )
 
+// RawResponseCodeArg is a raw response code argument.
+//
+// It is written as-is, and must not contain "]", CR or LF characters.
+type RawResponseCodeArg string
+
+// ModifiedCodeArg is the argument of the MODIFIED response code.
+//
+// It contains the messages which failed the UNCHANGEDSINCE test of a STORE
+// command. The number set has the same kind as the one passed to the STORE
+// command.
+type ModifiedCodeArg struct {
+	NumSet NumSet
+}
+
+// String returns the IMAP representation of the rejected number set.
+func (arg ModifiedCodeArg) String() string {
+	if arg.NumSet == nil {
+		return ""
+	}
+	return arg.NumSet.String()
+}
+
 // StatusResponse is a generic status response.
 //
 // See RFC 9051 section 7.1.
 type StatusResponse struct {
 	Type StatusResponseType
 	Code ResponseCode
-	Text string
+	// Response code arguments. The arguments of known response codes are
+	// documented alongside their ResponseCode constant, and match the
+	// fields of the corresponding ResponseCodeData type. For instance, the
+	// CAPABILITY response code has one Cap argument per capability, and the
+	// BADCHARSET response code has an optional []string argument. Response
+	// codes which are not documented to take arguments have none.
+	//
+	// Arguments of unknown response codes, and unexpected arguments of
+	// known response codes, are a single RawResponseCodeArg.
+	//
+	// CodeData and SetCodeData convert the response code and its arguments
+	// from and to a typed ResponseCodeData.
+	CodeArgs []interface{}
+	Text     string
 }
 
 // Error is an IMAP error caused by a status response.
@@ -70,7 +172,11 @@ func (err *Error) Error() string {
 	var sb strings.Builder
 	fmt.Fprintf(&sb, "imap: %v", err.Type)
 	if err.Code != "" {
-		fmt.Fprintf(&sb, " [%v]", err.Code)
+		fmt.Fprintf(&sb, " [%v", err.Code)
+		for _, arg := range err.CodeArgs {
+			fmt.Fprintf(&sb, " %v", arg)
+		}
+		sb.WriteString("]")
 	}
 	text := err.Text
 	if text == "" {
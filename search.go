@@ -1,6 +1,7 @@
 package imap
 
 import (
+	"fmt"
 	"reflect"
 	"time"
 )
@@ -14,6 +15,30 @@ type SearchOptions struct {
 	ReturnCount bool
 	// Requires IMAP4rev2 or SEARCHRES
 	ReturnSave bool
+	// Requires PARTIAL
+	ReturnPartial *SearchPartialRange
+}
+
+// SearchPartialRange is a range of positions in a SEARCH result, used with the
+// PARTIAL return option.
+//
+// Positions start at 1. Negative positions count from the end of the result:
+// -1 is the last message. For instance, {1, 500} is the first 500 messages and
+// {-1, -500} is the last 500 messages. First and Last must have the same sign.
+type SearchPartialRange struct {
+	First, Last int32
+}
+
+// String returns the IMAP representation of the range, e.g. "1:500".
+func (r SearchPartialRange) String() string {
+	return fmt.Sprintf("%v:%v", r.First, r.Last)
+}
+
+// SearchPartialData is the result of the PARTIAL return option.
+type SearchPartialData struct {
+	Range SearchPartialRange
+	// Messages at the positions in Range, nil if there are none
+	All NumSet
 }
 
 // SearchCriteria is a criteria for the SEARCH command.
@@ -45,6 +70,12 @@ type SearchCriteria struct {
 	SentSince  time.Time
 	SentBefore time.Time
 
+	// Relative to the current time, rounded up to the second. Requires WITHIN,
+	// otherwise the client converts them to Since and Before: the cutoff is
+	// then truncated to the date, in the client's local timezone.
+	Younger time.Duration
+	Older   time.Duration
+
 	Header []SearchCriteriaHeaderField
 	Body   []string
 	Text   []string
@@ -59,34 +90,206 @@ type SearchCriteria struct {
 	Or  [][2]SearchCriteria
 
 	ModSeq *SearchCriteriaModSeq // requires CONDSTORE
+
+	EmailID  []string // requires OBJECTID
+	ThreadID []string // requires OBJECTID
 }
 
 // And intersects two search criteria.
+//
+// Date bounds and sizes are combined by taking the tighter bound. Duplicate
+// values are removed from the other fields.
 func (criteria *SearchCriteria) And(other *SearchCriteria) {
-	criteria.SeqNum = append(criteria.SeqNum, other.SeqNum...)
-	criteria.UID = append(criteria.UID, other.UID...)
+	criteria.SeqNum = appendUniqueNumSets(criteria.SeqNum, other.SeqNum)
+	criteria.UID = appendUniqueNumSets(criteria.UID, other.UID)
 
 	criteria.Since = intersectSince(criteria.Since, other.Since)
 	criteria.Before = intersectBefore(criteria.Before, other.Before)
 	criteria.SentSince = intersectSince(criteria.SentSince, other.SentSince)
 	criteria.SentBefore = intersectBefore(criteria.SentBefore, other.SentBefore)
 
-	criteria.Header = append(criteria.Header, other.Header...)
-	criteria.Body = append(criteria.Body, other.Body...)
-	criteria.Text = append(criteria.Text, other.Text...)
+	if criteria.Younger == 0 || (other.Younger != 0 && other.Younger < criteria.Younger) {
+		criteria.Younger = other.Younger
+	}
+	if other.Older > criteria.Older {
+		criteria.Older = other.Older
+	}
+
+	criteria.Header = appendUnique(criteria.Header, other.Header)
+	criteria.Body = appendUnique(criteria.Body, other.Body)
+	criteria.Text = appendUnique(criteria.Text, other.Text)
 
-	criteria.Flag = append(criteria.Flag, other.Flag...)
-	criteria.NotFlag = append(criteria.NotFlag, other.NotFlag...)
+	criteria.Flag = appendUnique(criteria.Flag, other.Flag)
+	criteria.NotFlag = appendUnique(criteria.NotFlag, other.NotFlag)
 
-	if criteria.Larger == 0 || other.Larger > criteria.Larger {
+	if other.Larger > criteria.Larger {
 		criteria.Larger = other.Larger
 	}
-	if criteria.Smaller == 0 || other.Smaller < criteria.Smaller {
+	if other.Smaller != 0 && (criteria.Smaller == 0 || other.Smaller < criteria.Smaller) {
 		criteria.Smaller = other.Smaller
 	}
 
 	criteria.Not = append(criteria.Not, other.Not...)
 	criteria.Or = append(criteria.Or, other.Or...)
+
+	if modSeq := other.ModSeq; modSeq != nil {
+		switch cur := criteria.ModSeq; {
+		case cur == nil:
+			m := *modSeq
+			criteria.ModSeq = &m
+		case cur.MetadataName == modSeq.MetadataName && cur.MetadataType == modSeq.MetadataType:
+			if modSeq.ModSeq > cur.ModSeq {
+				m := *cur
+				m.ModSeq = modSeq.ModSeq
+				criteria.ModSeq = &m
+			}
+		default:
+			// A criteria only holds a single MODSEQ key: use a double
+			// negation for the other one
+			criteria.Not = append(criteria.Not, SearchNot(SearchCriteria{ModSeq: modSeq}))
+		}
+	}
+
+	criteria.EmailID = appendUnique(criteria.EmailID, other.EmailID)
+	criteria.ThreadID = appendUnique(criteria.ThreadID, other.ThreadID)
+}
+
+func appendUnique[T comparable](l, other []T) []T {
+	for _, v := range other {
+		found := false
+		for _, cur := range l {
+			if cur == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			l = append(l, v)
+		}
+	}
+	return l
+}
+
+func appendUniqueNumSets[T NumSet](l, other []T) []T {
+	for _, v := range other {
+		found := false
+		for _, cur := range l {
+			if cur.String() == v.String() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			l = append(l, v)
+		}
+	}
+	return l
+}
+
+// SearchAnd returns a criteria matching messages which match all of the
+// criteria. See SearchCriteria.And.
+func SearchAnd(criteria ...SearchCriteria) SearchCriteria {
+	var out SearchCriteria
+	for i := range criteria {
+		out.And(&criteria[i])
+	}
+	return out
+}
+
+// SearchOr returns a criteria matching messages which match any of the
+// criteria. The alternatives are folded into nested OR keys.
+//
+// If no criteria is specified, the returned criteria doesn't match any
+// message.
+func SearchOr(criteria ...SearchCriteria) SearchCriteria {
+	switch len(criteria) {
+	case 0:
+		return SearchNot(SearchCriteria{})
+	case 1:
+		return criteria[0]
+	}
+	// Balance the tree to limit the nesting depth
+	mid := len(criteria) / 2
+	return SearchCriteria{Or: [][2]SearchCriteria{{
+		SearchOr(criteria[:mid]...),
+		SearchOr(criteria[mid:]...),
+	}}}
+}
+
+// SearchNot returns a criteria matching messages which don't match the
+// criteria.
+func SearchNot(criteria SearchCriteria) SearchCriteria {
+	return SearchCriteria{Not: []SearchCriteria{criteria}}
+}
+
+// SearchFlag returns a criteria matching messages with a flag.
+func SearchFlag(flag Flag) SearchCriteria {
+	return SearchCriteria{Flag: []Flag{flag}}
+}
+
+// SearchUnseen returns a criteria matching messages without the \Seen flag.
+func SearchUnseen() SearchCriteria {
+	return SearchCriteria{NotFlag: []Flag{FlagSeen}}
+}
+
+// SearchHeader returns a criteria matching messages with a header field
+// containing a value. If value is empty, all messages with the header field
+// match.
+func SearchHeader(key, value string) SearchCriteria {
+	return SearchCriteria{Header: []SearchCriteriaHeaderField{{Key: key, Value: value}}}
+}
+
+// SearchFrom returns a criteria matching messages whose From header field
+// contains a value.
+func SearchFrom(value string) SearchCriteria {
+	return SearchHeader("From", value)
+}
+
+// SearchTo returns a criteria matching messages whose To header field
+// contains a value.
+func SearchTo(value string) SearchCriteria {
+	return SearchHeader("To", value)
+}
+
+// SearchSubject returns a criteria matching messages whose Subject header
+// field contains a value.
+func SearchSubject(value string) SearchCriteria {
+	return SearchHeader("Subject", value)
+}
+
+// SearchOn returns a criteria matching messages whose internal date is the
+// date of t, in t's location.
+func SearchOn(t time.Time) SearchCriteria {
+	since, before := searchDateRange(t)
+	return SearchCriteria{Since: since, Before: before}
+}
+
+// SearchSentOn returns a criteria matching messages whose Date header is the
+// date of t, in t's location.
+func SearchSentOn(t time.Time) SearchCriteria {
+	since, before := searchDateRange(t)
+	return SearchCriteria{SentSince: since, SentBefore: before}
+}
+
+// SearchYoungerThan returns a criteria matching messages whose internal date
+// is within d of the current time. See SearchCriteria.Younger.
+func SearchYoungerThan(d time.Duration) SearchCriteria {
+	return SearchCriteria{Younger: d}
+}
+
+// SearchOlderThan returns a criteria matching messages whose internal date is
+// older than d. See SearchCriteria.Older.
+func SearchOlderThan(d time.Duration) SearchCriteria {
+	return SearchCriteria{Older: d}
+}
+
+// searchDateRange returns the start of the date of t and the start of the
+// next day. UTC is used so that the range is exactly 24 hours long, even
+// across DST changes.
+func searchDateRange(t time.Time) (since, before time.Time) {
+	y, m, d := t.Date()
+	since = time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	return since, since.AddDate(0, 0, 1)
 }
 
 func intersectSince(t1, t2 time.Time) time.Time {
@@ -120,7 +323,7 @@ type SearchCriteriaHeaderField struct {
 }
 
 type SearchCriteriaModSeq struct {
-	ModSeq       uint64
+	ModSeq       ModSeq
 	MetadataName string
 	MetadataType SearchCriteriaMetadataType
 }
@@ -135,46 +338,79 @@ const (
 
 // SearchData is the data returned by a SEARCH command.
 type SearchData struct {
+	// Matching messages: a SeqSet, or a UIDSet if UID is set
 	All NumSet
 
 	// requires IMAP4rev2 or ESEARCH
 	UID   bool
-	Min   uint32
-	Max   uint32
-	Count uint32
+	Min   uint32  // zero if not returned
+	Max   uint32  // zero if not returned
+	Count *uint32 // nil if not returned
+
+	// Tag of the command the ESEARCH response has been correlated with,
+	// empty if the server didn't include a correlator
+	Tag string
+
+	// Set if the result has been saved and can be referred to with
+	// SearchRes. Requires IMAP4rev2 or SEARCHRES.
+	Saved bool
 
-	// requires CONDSTORE
-	ModSeq uint64
+	// Highest mod-sequence of the matching messages, zero if not returned.
+	// Requires CONDSTORE.
+	ModSeq ModSeq
+
+	// requires PARTIAL
+	Partial *SearchPartialData
 }
 
 // AllSeqNums returns All as a slice of sequence numbers.
-func (data *SearchData) AllSeqNums() []uint32 {
-	seqSet, ok := data.All.(SeqSet)
-	if !ok {
-		return nil
+//
+// An error is returned if the search data contains UIDs.
+func (data *SearchData) AllSeqNums() ([]uint32, error) {
+	var seqSet SeqSet
+	switch all := data.All.(type) {
+	case nil:
+		if data.UID {
+			return nil, fmt.Errorf("imap: SearchData contains UIDs, not sequence numbers")
+		}
+		return nil, nil
+	case SeqSet:
+		seqSet = all
+	default:
+		return nil, fmt.Errorf("imap: SearchData contains UIDs, not sequence numbers")
 	}
 
 	// Note: a dynamic sequence set would be a server bug
 	nums, ok := seqSet.Nums()
 	if !ok {
-		panic("imap: SearchData.All is a dynamic number set")
+		return nil, fmt.Errorf("imap: SearchData.All is a dynamic number set")
 	}
-	return nums
+	return nums, nil
 }
 
 // AllUIDs returns All as a slice of UIDs.
-func (data *SearchData) AllUIDs() []UID {
-	uidSet, ok := data.All.(UIDSet)
-	if !ok {
-		return nil
+//
+// An error is returned if the search data contains sequence numbers.
+func (data *SearchData) AllUIDs() ([]UID, error) {
+	var uidSet UIDSet
+	switch all := data.All.(type) {
+	case nil:
+		if !data.UID {
+			return nil, fmt.Errorf("imap: SearchData contains sequence numbers, not UIDs")
+		}
+		return nil, nil
+	case UIDSet:
+		uidSet = all
+	default:
+		return nil, fmt.Errorf("imap: SearchData contains sequence numbers, not UIDs")
 	}
 
 	// Note: a dynamic sequence set would be a server bug
 	uids, ok := uidSet.Nums()
 	if !ok {
-		panic("imap: SearchData.All is a dynamic number set")
+		return nil, fmt.Errorf("imap: SearchData.All is a dynamic number set")
 	}
-	return uids
+	return uids, nil
 }
 
 // searchRes is a special empty UIDSet which can be used as a marker. It has
@@ -0,0 +1,661 @@
+package imap
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap/v2/internal/imapnum"
+	"github.com/emersion/go-imap/v2/internal/searchkey"
+)
+
+// maxSearchKeyDepth limits the nesting of search keys to prevent stack
+// overflow.
+const maxSearchKeyDepth = 1000
+
+// flagRecent is the \Recent flag, removed in IMAP4rev2.
+const flagRecent Flag = "\\Recent"
+
+// String returns the IMAP representation of the criteria, as sent in a SEARCH
+// command, e.g. `UNSEEN FROM "bob" SINCE "1-Feb-2024"`.
+//
+// Strings which can't be represented as a quoted string are written as
+// literals. Use AppendIMAP to reject them instead.
+func (criteria *SearchCriteria) String() string {
+	enc := searchTextEncoder{lenient: true}
+	writeSearchKey(&enc, criteria)
+	return string(enc.buf)
+}
+
+// AppendIMAP appends the IMAP representation of the criteria to dst. See
+// ParseSearchCriteria for the reverse operation.
+//
+// An error is returned if the criteria contains a string which requires a
+// literal, or an invalid keyword or object ID.
+func (criteria *SearchCriteria) AppendIMAP(dst []byte) ([]byte, error) {
+	enc := searchTextEncoder{buf: dst}
+	writeSearchKey(&enc, criteria)
+	if enc.err != nil {
+		return dst, enc.err
+	}
+	return enc.buf, nil
+}
+
+// ParseSearchCriteria parses the IMAP representation of a search criteria, as
+// sent in a SEARCH command and returned by SearchCriteria.String.
+//
+// Literals aren't supported. Keys are merged with SearchCriteria.And, so
+// redundant keys are removed.
+func ParseSearchCriteria(s string) (*SearchCriteria, error) {
+	dec := searchTextDecoder{s: s}
+	var criteria SearchCriteria
+	for {
+		if err := readSearchKey(&criteria, &dec, "", 0); err != nil {
+			return nil, dec.errorf("%v", err)
+		}
+		if !dec.SP() {
+			break
+		}
+	}
+	if dec.i < len(dec.s) {
+		return nil, dec.errorf("unexpected %q", dec.s[dec.i])
+	}
+	return &criteria, nil
+}
+
+// writeSearchKey writes a search criteria as a list of search keys.
+func writeSearchKey(enc searchkey.Encoder, criteria *SearchCriteria) {
+	firstItem := true
+	item := func(key string) {
+		if !firstItem {
+			enc.SP()
+		}
+		firstItem = false
+		enc.Atom(key)
+	}
+
+	for _, seqSet := range criteria.SeqNum {
+		if !firstItem {
+			enc.SP()
+		}
+		firstItem = false
+		enc.NumSet(seqSet)
+	}
+	for _, uidSet := range criteria.UID {
+		item("UID")
+		enc.SP()
+		enc.NumSet(uidSet)
+	}
+
+	writeDate := func(key string, t time.Time) {
+		item(key)
+		enc.SP()
+		enc.String(FormatDate(t))
+	}
+	if !criteria.Since.IsZero() && !criteria.Before.IsZero() && criteria.Before.Sub(criteria.Since) == 24*time.Hour {
+		writeDate("ON", criteria.Since)
+	} else {
+		if !criteria.Since.IsZero() {
+			writeDate("SINCE", criteria.Since)
+		}
+		if !criteria.Before.IsZero() {
+			writeDate("BEFORE", criteria.Before)
+		}
+	}
+	if criteria.Older > 0 {
+		item("OLDER")
+		enc.SP()
+		enc.Atom(strconv.FormatInt(searchkey.WithinSeconds(criteria.Older), 10))
+	}
+	if criteria.Younger > 0 {
+		item("YOUNGER")
+		enc.SP()
+		enc.Atom(strconv.FormatInt(searchkey.WithinSeconds(criteria.Younger), 10))
+	}
+	if !criteria.SentSince.IsZero() && !criteria.SentBefore.IsZero() && criteria.SentBefore.Sub(criteria.SentSince) == 24*time.Hour {
+		writeDate("SENTON", criteria.SentSince)
+	} else {
+		if !criteria.SentSince.IsZero() {
+			writeDate("SENTSINCE", criteria.SentSince)
+		}
+		if !criteria.SentBefore.IsZero() {
+			writeDate("SENTBEFORE", criteria.SentBefore)
+		}
+	}
+
+	for _, kv := range criteria.Header {
+		if k := searchkey.HeaderKey(kv.Key); k != "" {
+			item(k)
+		} else {
+			item("HEADER")
+			enc.SP()
+			enc.String(kv.Key)
+		}
+		enc.SP()
+		enc.String(kv.Value)
+	}
+
+	for _, s := range criteria.Body {
+		item("BODY")
+		enc.SP()
+		enc.String(s)
+	}
+	for _, s := range criteria.Text {
+		item("TEXT")
+		enc.SP()
+		enc.String(s)
+	}
+
+	for _, flag := range criteria.Flag {
+		if k := searchkey.FlagKey(string(flag)); k != "" {
+			item(k)
+		} else if flag == flagRecent {
+			item("RECENT")
+		} else {
+			item("KEYWORD")
+			enc.SP()
+			enc.Flag(string(flag))
+		}
+	}
+	for _, flag := range criteria.NotFlag {
+		if k := searchkey.FlagKey(string(flag)); k != "" {
+			item("UN" + k)
+		} else if flag == flagRecent {
+			item("OLD")
+		} else {
+			item("UNKEYWORD")
+			enc.SP()
+			enc.Flag(string(flag))
+		}
+	}
+
+	if criteria.Larger > 0 {
+		item("LARGER")
+		enc.SP()
+		enc.Atom(strconv.FormatInt(criteria.Larger, 10))
+	}
+	if criteria.Smaller > 0 {
+		item("SMALLER")
+		enc.SP()
+		enc.Atom(strconv.FormatInt(criteria.Smaller, 10))
+	}
+
+	if modSeq := criteria.ModSeq; modSeq != nil {
+		item("MODSEQ")
+		if modSeq.MetadataName != "" && modSeq.MetadataType != "" {
+			enc.SP()
+			enc.Quoted(modSeq.MetadataName)
+			enc.SP()
+			enc.Atom(string(modSeq.MetadataType))
+		}
+		enc.SP()
+		enc.Atom(strconv.FormatUint(uint64(modSeq.ModSeq), 10))
+	}
+
+	for _, id := range criteria.EmailID {
+		item("EMAILID")
+		enc.SP()
+		enc.Atom(id)
+	}
+	for _, id := range criteria.ThreadID {
+		item("THREADID")
+		enc.SP()
+		enc.Atom(id)
+	}
+
+	for i := range criteria.Not {
+		item("NOT")
+		enc.SP()
+		enc.Special('(')
+		writeSearchKey(enc, &criteria.Not[i])
+		enc.Special(')')
+	}
+	for i := range criteria.Or {
+		item("OR")
+		enc.SP()
+		enc.Special('(')
+		writeSearchKey(enc, &criteria.Or[i][0])
+		enc.Special(')')
+		enc.SP()
+		enc.Special('(')
+		writeSearchKey(enc, &criteria.Or[i][1])
+		enc.Special(')')
+	}
+
+	if firstItem {
+		enc.Atom("ALL")
+	}
+}
+
+// ReadSearchKey reads a search key and merges it into criteria. If key is
+// non-empty, the search key name has already been read.
+//
+// This is used by imapserver to decode SEARCH commands, and isn't meant to be
+// called by other packages.
+func ReadSearchKey(criteria *SearchCriteria, dec searchkey.Decoder, key string) error {
+	return readSearchKey(criteria, dec, key, 0)
+}
+
+// WriteSearchKey writes a search criteria as a list of search keys.
+//
+// This is used by imapclient to encode SEARCH commands, and isn't meant to be
+// called by other packages.
+func WriteSearchKey(enc searchkey.Encoder, criteria *SearchCriteria) {
+	writeSearchKey(enc, criteria)
+}
+
+// readSearchKey reads a search key and merges it into criteria. If key is
+// non-empty, the search key name has already been read.
+func readSearchKey(criteria *SearchCriteria, dec searchkey.Decoder, key string, depth int) error {
+	if depth > maxSearchKeyDepth {
+		return fmt.Errorf("search key nesting too deep")
+	}
+
+	if key == "" {
+		if dec.Special('(') {
+			for {
+				if err := readSearchKey(criteria, dec, "", depth+1); err != nil {
+					return err
+				}
+				if !dec.SP() {
+					break
+				}
+			}
+			if !dec.ExpectSpecial(')') {
+				return dec.Err()
+			}
+			return nil
+		}
+		if !dec.Expect(dec.Func(&key, searchkey.IsKeyChar), "search key") {
+			return dec.Err()
+		}
+	}
+
+	var other SearchCriteria
+	switch key = strings.ToUpper(key); key {
+	case "ALL":
+		// nothing to do
+	case "UID":
+		var s string
+		if !dec.ExpectSP() || !dec.Expect(dec.Func(&s, isNumSetChar), "UID set") {
+			return dec.Err()
+		}
+		if s == "$" {
+			other.UID = []UIDSet{SearchRes()}
+			break
+		}
+		set, err := imapnum.ParseSet(s)
+		if err != nil {
+			return fmt.Errorf("invalid UID set %q", s)
+		}
+		other.UID = []UIDSet{uidSetFromNumSet(set)}
+	case "$":
+		other.UID = []UIDSet{SearchRes()}
+	case "RECENT":
+		other.Flag = []Flag{flagRecent}
+	case "OLD":
+		other.NotFlag = []Flag{flagRecent}
+	case "NEW":
+		other.Flag = []Flag{flagRecent}
+		other.NotFlag = []Flag{FlagSeen}
+	case "KEYWORD", "UNKEYWORD":
+		var s string
+		if !dec.ExpectSP() || !dec.ExpectAtom(&s) {
+			return dec.Err()
+		}
+		if key == "KEYWORD" {
+			other.Flag = []Flag{Flag(s)}
+		} else {
+			other.NotFlag = []Flag{Flag(s)}
+		}
+	case "HEADER":
+		var field, value string
+		if !dec.ExpectSP() || !dec.ExpectAString(&field) || !dec.ExpectSP() || !dec.ExpectAString(&value) {
+			return dec.Err()
+		}
+		// Use the same key as the dedicated search key, if any
+		if k, ok := searchkey.KeyHeader(strings.ToUpper(field)); ok {
+			field = k
+		}
+		other.Header = []SearchCriteriaHeaderField{{Key: field, Value: value}}
+	case "SINCE", "BEFORE", "ON", "SENTSINCE", "SENTBEFORE", "SENTON":
+		var s string
+		if !dec.ExpectSP() || !dec.ExpectAString(&s) {
+			return dec.Err()
+		}
+		t, err := ParseDate(s)
+		if err != nil {
+			return fmt.Errorf("invalid date %q", s)
+		}
+		switch key {
+		case "SINCE":
+			other.Since = t
+		case "BEFORE":
+			other.Before = t
+		case "ON":
+			other.Since, other.Before = t, t.Add(24*time.Hour)
+		case "SENTSINCE":
+			other.SentSince = t
+		case "SENTBEFORE":
+			other.SentBefore = t
+		case "SENTON":
+			other.SentSince, other.SentBefore = t, t.Add(24*time.Hour)
+		}
+	case "OLDER", "YOUNGER":
+		var n int64
+		if !dec.ExpectSP() || !dec.ExpectNumber64(&n) {
+			return dec.Err()
+		} else if n > int64(1<<63-1)/int64(time.Second) {
+			return fmt.Errorf("interval too large")
+		}
+		if key == "OLDER" {
+			other.Older = time.Duration(n) * time.Second
+		} else {
+			other.Younger = time.Duration(n) * time.Second
+		}
+	case "BODY", "TEXT":
+		var s string
+		if !dec.ExpectSP() || !dec.ExpectAString(&s) {
+			return dec.Err()
+		}
+		if key == "BODY" {
+			other.Body = []string{s}
+		} else {
+			other.Text = []string{s}
+		}
+	case "LARGER", "SMALLER":
+		var n int64
+		if !dec.ExpectSP() || !dec.ExpectNumber64(&n) {
+			return dec.Err()
+		}
+		if key == "LARGER" {
+			other.Larger = n
+		} else {
+			other.Smaller = n
+		}
+	case "MODSEQ":
+		if !dec.ExpectSP() {
+			return dec.Err()
+		}
+		modSeq, err := readSearchModSeq(dec)
+		if err != nil {
+			return err
+		}
+		other.ModSeq = modSeq
+	case "EMAILID", "THREADID":
+		var id string
+		if !dec.ExpectSP() || !dec.ExpectAtom(&id) {
+			return dec.Err()
+		}
+		if key == "EMAILID" {
+			other.EmailID = []string{id}
+		} else {
+			other.ThreadID = []string{id}
+		}
+	case "NOT":
+		if !dec.ExpectSP() {
+			return dec.Err()
+		}
+		var not SearchCriteria
+		if err := readSearchKey(&not, dec, "", depth+1); err != nil {
+			return err
+		}
+		other.Not = []SearchCriteria{not}
+	case "OR":
+		var or [2]SearchCriteria
+		for i := range or {
+			if !dec.ExpectSP() {
+				return dec.Err()
+			}
+			if err := readSearchKey(&or[i], dec, "", depth+1); err != nil {
+				return err
+			}
+		}
+		other.Or = [][2]SearchCriteria{or}
+	default:
+		if flag, ok := searchkey.KeyFlag(key); ok {
+			other.Flag = []Flag{Flag(flag)}
+		} else if flag, ok := searchkey.KeyFlag(strings.TrimPrefix(key, "UN")); ok && strings.HasPrefix(key, "UN") {
+			other.NotFlag = []Flag{Flag(flag)}
+		} else if field, ok := searchkey.KeyHeader(key); ok {
+			var value string
+			if !dec.ExpectSP() || !dec.ExpectAString(&value) {
+				return dec.Err()
+			}
+			other.Header = []SearchCriteriaHeaderField{{Key: field, Value: value}}
+		} else {
+			set, err := imapnum.ParseSet(key)
+			if err != nil {
+				return fmt.Errorf("unknown search key %q", key)
+			}
+			other.SeqNum = []SeqSet{seqSetFromNumSet(set)}
+		}
+	}
+
+	criteria.And(&other)
+	return nil
+}
+
+func readSearchModSeq(dec searchkey.Decoder) (*SearchCriteriaModSeq, error) {
+	var modSeq SearchCriteriaModSeq
+	var s string
+	if !dec.Func(&s, isDigit) {
+		var name, typ string
+		if !dec.ExpectAString(&name) || !dec.ExpectSP() || !dec.ExpectAtom(&typ) || !dec.ExpectSP() {
+			return nil, dec.Err()
+		}
+		switch t := SearchCriteriaMetadataType(strings.ToLower(typ)); t {
+		case SearchCriteriaMetadataAll, SearchCriteriaMetadataPrivate, SearchCriteriaMetadataShared:
+			modSeq.MetadataName, modSeq.MetadataType = name, t
+		default:
+			return nil, fmt.Errorf("invalid metadata type %q", typ)
+		}
+		if !dec.Expect(dec.Func(&s, isDigit), "mod-sequence-valzer") {
+			return nil, dec.Err()
+		}
+	}
+	n, err := strconv.ParseUint(s, 10, 63)
+	if err != nil {
+		return nil, fmt.Errorf("mod-sequence %v overflows 63-bit unsigned integer", s)
+	}
+	modSeq.ModSeq = ModSeq(n)
+	return &modSeq, nil
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isNumSetChar(ch byte) bool {
+	return ch == '*' || ch == ':' || ch == ',' || ch == '$' || isDigit(ch)
+}
+
+// searchTextEncoder writes search keys to a byte slice.
+type searchTextEncoder struct {
+	buf     []byte
+	lenient bool // write invalid values as-is instead of failing
+	err     error
+}
+
+var _ searchkey.Encoder = (*searchTextEncoder)(nil)
+
+func (enc *searchTextEncoder) setErr(err error) {
+	if enc.err == nil && !enc.lenient {
+		enc.err = err
+	}
+}
+
+func (enc *searchTextEncoder) SP() {
+	enc.buf = append(enc.buf, ' ')
+}
+
+func (enc *searchTextEncoder) Special(ch byte) {
+	enc.buf = append(enc.buf, ch)
+}
+
+func (enc *searchTextEncoder) Atom(s string) {
+	if !isAtom(s) {
+		enc.setErr(fmt.Errorf("imap: invalid atom %q in search criteria", s))
+	}
+	enc.buf = append(enc.buf, s...)
+}
+
+func (enc *searchTextEncoder) Flag(s string) {
+	if !isAtom(s) {
+		enc.setErr(fmt.Errorf("imap: invalid keyword %q in search criteria", s))
+	}
+	enc.buf = append(enc.buf, s...)
+}
+
+func (enc *searchTextEncoder) NumSet(set fmt.Stringer) {
+	enc.buf = append(enc.buf, set.String()...)
+}
+
+func (enc *searchTextEncoder) Quoted(s string) {
+	enc.String(s)
+}
+
+func (enc *searchTextEncoder) String(s string) {
+	if strings.ContainsAny(s, "\x00\r\n") {
+		enc.setErr(fmt.Errorf("imap: search string %q requires a literal", s))
+		enc.buf = append(enc.buf, '{')
+		enc.buf = strconv.AppendInt(enc.buf, int64(len(s)), 10)
+		enc.buf = append(enc.buf, "}\r\n"...)
+		enc.buf = append(enc.buf, s...)
+		return
+	}
+	enc.buf = append(enc.buf, '"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			enc.buf = append(enc.buf, '\\')
+		}
+		enc.buf = append(enc.buf, s[i])
+	}
+	enc.buf = append(enc.buf, '"')
+}
+
+func isAtom(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !searchkey.IsAtomChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// searchTextDecoder reads search keys from a string. Literals aren't
+// supported.
+type searchTextDecoder struct {
+	s   string
+	i   int
+	err error
+}
+
+var _ searchkey.Decoder = (*searchTextDecoder)(nil)
+
+func (dec *searchTextDecoder) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("imap: invalid search criteria at offset %v: %v", dec.i, fmt.Sprintf(format, args...))
+}
+
+func (dec *searchTextDecoder) returnErr(err error) bool {
+	if dec.err == nil {
+		dec.err = err
+	}
+	return false
+}
+
+func (dec *searchTextDecoder) Err() error {
+	return dec.err
+}
+
+func (dec *searchTextDecoder) Expect(ok bool, name string) bool {
+	if !ok {
+		return dec.returnErr(fmt.Errorf("expected %v", name))
+	}
+	return true
+}
+
+func (dec *searchTextDecoder) Special(ch byte) bool {
+	if dec.i < len(dec.s) && dec.s[dec.i] == ch {
+		dec.i++
+		return true
+	}
+	return false
+}
+
+func (dec *searchTextDecoder) ExpectSpecial(ch byte) bool {
+	return dec.Expect(dec.Special(ch), fmt.Sprintf("'%c'", ch))
+}
+
+func (dec *searchTextDecoder) SP() bool {
+	return dec.Special(' ')
+}
+
+func (dec *searchTextDecoder) ExpectSP() bool {
+	return dec.Expect(dec.SP(), "SP")
+}
+
+func (dec *searchTextDecoder) Func(ptr *string, valid func(ch byte) bool) bool {
+	start := dec.i
+	for dec.i < len(dec.s) && valid(dec.s[dec.i]) {
+		dec.i++
+	}
+	if dec.i == start {
+		return false
+	}
+	*ptr = dec.s[start:dec.i]
+	return true
+}
+
+func (dec *searchTextDecoder) ExpectAtom(ptr *string) bool {
+	return dec.Expect(dec.Func(ptr, searchkey.IsAtomChar), "atom")
+}
+
+func (dec *searchTextDecoder) ExpectNumber64(ptr *int64) bool {
+	var s string
+	if !dec.Expect(dec.Func(&s, isDigit), "number") {
+		return false
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return dec.returnErr(fmt.Errorf("number %v overflows 63-bit unsigned integer", s))
+	}
+	*ptr = n
+	return true
+}
+
+func (dec *searchTextDecoder) ExpectAString(ptr *string) bool {
+	if dec.i < len(dec.s) && dec.s[dec.i] == '{' {
+		return dec.returnErr(fmt.Errorf("literals are not supported"))
+	}
+	if !dec.Special('"') {
+		return dec.Expect(dec.Func(ptr, func(ch byte) bool {
+			return searchkey.IsAtomChar(ch) || ch == ']'
+		}), "string")
+	}
+
+	var sb strings.Builder
+	for dec.i < len(dec.s) {
+		ch := dec.s[dec.i]
+		dec.i++
+		switch ch {
+		case '"':
+			*ptr = sb.String()
+			return true
+		case '\\':
+			if dec.i >= len(dec.s) || (dec.s[dec.i] != '"' && dec.s[dec.i] != '\\') {
+				return dec.returnErr(fmt.Errorf("invalid escape in quoted string"))
+			}
+			ch = dec.s[dec.i]
+			dec.i++
+		case 0, '\r', '\n':
+			return dec.returnErr(fmt.Errorf("invalid character in quoted string"))
+		}
+		sb.WriteByte(ch)
+	}
+	return dec.returnErr(fmt.Errorf("unterminated quoted string"))
+}
@@ -3,7 +3,19 @@ package imap
 // SelectOptions contains options for the SELECT or EXAMINE command.
 type SelectOptions struct {
 	ReadOnly  bool
-	CondStore bool // requires CONDSTORE
+	CondStore bool           // requires CONDSTORE
+	QResync   *SelectQResync // requires ENABLE QRESYNC
+}
+
+// SelectQResync contains the QRESYNC parameter for the SELECT command.
+//
+// The server sends a VANISHED (EARLIER) response for expunged messages and
+// FETCH responses for messages changed since ModSeq, unless UIDValidity
+// doesn't match the current UIDVALIDITY of the mailbox.
+type SelectQResync struct {
+	UIDValidity uint32
+	ModSeq      ModSeq
+	KnownUIDs   UIDSet // optional
 }
 
 // SelectData is the data returned by a SELECT command.
@@ -12,14 +24,28 @@ type SelectOptions struct {
 type SelectData struct {
 	// Flags defined for this mailbox
 	Flags []Flag
-	// Flags that the client can change permanently
+	// Flags that the client can change permanently. FlagWildcard indicates
+	// that new keywords can be created. If nil, the PERMANENTFLAGS response
+	// code is omitted.
 	PermanentFlags []Flag
 	// Number of messages in this mailbox (aka. "EXISTS")
 	NumMessages uint32
+	// Predicted next UID. If zero, the UIDNEXT response code is omitted.
 	UIDNext     UID
 	UIDValidity uint32
+	// Whether the mailbox has been opened in read-only mode
+	ReadOnly bool
+	// Sequence number of the first unseen message, if any. Obsolete in
+	// IMAP4rev2.
+	FirstUnseen uint32
 
 	List *ListData // requires IMAP4rev2
 
-	HighestModSeq uint64 // requires CONDSTORE
+	HighestModSeq ModSeq // requires CONDSTORE
+
+	// The mailbox doesn't support persistent UIDs: UIDs may change across
+	// sessions and must not be cached. Requires UIDPLUS.
+	UIDNotSticky bool
+
+	MailboxID string // requires OBJECTID
 }
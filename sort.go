@@ -0,0 +1,24 @@
+package imap
+
+// SortKey is a key used to sort messages.
+type SortKey string
+
+const (
+	SortKeyArrival SortKey = "ARRIVAL"
+	SortKeyCc      SortKey = "CC"
+	SortKeyDate    SortKey = "DATE"
+	SortKeyFrom    SortKey = "FROM"
+	SortKeySize    SortKey = "SIZE"
+	SortKeySubject SortKey = "SUBJECT"
+	SortKeyTo      SortKey = "TO"
+
+	// Requires SORT=DISPLAY
+	SortKeyDisplayFrom SortKey = "DISPLAYFROM"
+	SortKeyDisplayTo   SortKey = "DISPLAYTO"
+)
+
+// SortCriterion is a criterion for the SORT command.
+type SortCriterion struct {
+	Key     SortKey
+	Reverse bool
+}
@@ -12,11 +12,14 @@ type StatusOptions struct {
 	AppendLimit    bool // requires APPENDLIMIT
 	DeletedStorage bool // requires QUOTA=RES-STORAGE
 	HighestModSeq  bool // requires CONDSTORE
+	MailboxID      bool // requires OBJECTID
 }
 
 // StatusData is the data returned by a STATUS command.
 //
-// The mailbox name is always populated. The remaining fields are optional.
+// The mailbox name is always populated. The remaining fields are optional:
+// nil pointers, zero numbers and empty strings indicate that the item hasn't
+// been returned.
 type StatusData struct {
 	Mailbox string
 
@@ -24,10 +27,11 @@ type StatusData struct {
 	UIDNext     UID
 	UIDValidity uint32
 	NumUnseen   *uint32
-	NumDeleted  *uint32
-	Size        *int64
+	NumDeleted  *uint32 // requires IMAP4rev2 or QUOTA
+	Size        *int64  // requires IMAP4rev2 or STATUS=SIZE
 
-	AppendLimit    *uint32
-	DeletedStorage *int64
-	HighestModSeq  uint64
+	AppendLimit    *uint32 // requires APPENDLIMIT, ^uint32(0) if unlimited
+	DeletedStorage *int64  // requires QUOTA=RES-STORAGE
+	HighestModSeq  ModSeq  // requires CONDSTORE
+	MailboxID      string  // requires OBJECTID
 }
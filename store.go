@@ -1,8 +1,17 @@
 package imap
 
+// ModSeq is a mod-sequence value, as defined in the CONDSTORE extension.
+//
+// Mod-sequences are 63-bit unsigned integers. Zero indicates that the
+// mod-sequence is absent.
+type ModSeq uint64
+
+// MaxModSeq is the largest valid mod-sequence value.
+const MaxModSeq ModSeq = 1<<63 - 1
+
 // StoreOptions contains options for the STORE command.
 type StoreOptions struct {
-	UnchangedSince uint64 // requires CONDSTORE
+	UnchangedSince ModSeq // requires CONDSTORE
 }
 
 // StoreFlagsOp is a flag operation: set, add or delete.
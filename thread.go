@@ -7,3 +7,63 @@ const (
 	ThreadOrderedSubject ThreadAlgorithm = "ORDEREDSUBJECT"
 	ThreadReferences     ThreadAlgorithm = "REFERENCES"
 )
+
+// ThreadData is a node in a thread tree, as returned by the THREAD command.
+//
+// When the parent of some messages is missing, the server groups them under
+// a dummy node: its Num is zero.
+type ThreadData struct {
+	Num      uint32
+	UID      bool // Num is a UID rather than a sequence number
+	Children []ThreadData
+}
+
+// Walk calls f for each node of the tree in depth-first order, starting with
+// the node itself. The depth of the node itself is zero. If f returns false,
+// the children of the node are skipped.
+//
+// Walk doesn't use recursion, so it can be used on arbitrarily deep trees.
+func (data *ThreadData) Walk(f func(node *ThreadData, depth int) bool) {
+	type item struct {
+		node  *ThreadData
+		depth int
+	}
+	stack := []item{{data, 0}}
+	for len(stack) > 0 {
+		it := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !f(it.node, it.depth) {
+			continue
+		}
+		// Push children in reverse order so that they are visited in order
+		for i := len(it.node.Children) - 1; i >= 0; i-- {
+			stack = append(stack, item{&it.node.Children[i], it.depth + 1})
+		}
+	}
+}
+
+// Flatten returns the message numbers of the tree in thread order, i.e. in
+// depth-first order. Dummy nodes are skipped.
+func (data *ThreadData) Flatten() []uint32 {
+	var l []uint32
+	data.Walk(func(node *ThreadData, depth int) bool {
+		if node.Num != 0 {
+			l = append(l, node.Num)
+		}
+		return true
+	})
+	return l
+}
+
+// Count returns the number of messages in the tree. Dummy nodes aren't
+// counted.
+func (data *ThreadData) Count() int {
+	n := 0
+	data.Walk(func(node *ThreadData, depth int) bool {
+		if node.Num != 0 {
+			n++
+		}
+		return true
+	})
+	return n
+}
@@ -0,0 +1,152 @@
+package imap
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// URL is an absolute IMAP URL referencing a message or a body section of a
+// message, optionally carrying URLAUTH authorization.
+//
+// See RFC 5092 and RFC 4467.
+type URL struct {
+	// User name, optional. Required by URLAUTH.
+	User string
+	// Host name, with an optional port
+	Host string
+
+	MessageURL
+
+	// URLAUTH components. Access is e.g. "anonymous", "authuser" or
+	// "submit+user". Expire is optional. Mechanism and Token are only set
+	// in authorized URLs, as returned by the GENURLAUTH command.
+	Expire    time.Time
+	Access    string
+	Mechanism string
+	Token     string
+}
+
+// String formats the URL, e.g.
+// "imap://user@example.org/INBOX;UIDVALIDITY=42/;UID=1;URLAUTH=anonymous".
+func (u *URL) String() string {
+	var sb strings.Builder
+	sb.WriteString("imap://")
+	if u.User != "" {
+		sb.WriteString(escapeURLUser(u.User))
+		sb.WriteByte('@')
+	}
+	sb.WriteString(u.Host)
+	sb.WriteString(u.MessageURL.String())
+	if !u.Expire.IsZero() {
+		sb.WriteString(";EXPIRE=")
+		sb.WriteString(u.Expire.Format(time.RFC3339))
+	}
+	if u.Access != "" {
+		sb.WriteString(";URLAUTH=")
+		sb.WriteString(u.Access)
+		if u.Mechanism != "" {
+			fmt.Fprintf(&sb, ":%v:%v", u.Mechanism, u.Token)
+		}
+	}
+	return sb.String()
+}
+
+// Rump returns a copy of the URL without the URLAUTH mechanism and token.
+//
+// This is the form expected by the GENURLAUTH command.
+func (u *URL) Rump() *URL {
+	rump := *u
+	rump.Mechanism = ""
+	rump.Token = ""
+	return &rump
+}
+
+// ParseURL parses an absolute IMAP URL referencing a message or a body section
+// of a message.
+func ParseURL(s string) (*URL, error) {
+	rest, ok := cutPrefixFold(s, "imap://")
+	if !ok {
+		return nil, fmt.Errorf("imap: URL %q must start with \"imap://\"", s)
+	}
+
+	var u URL
+	authority, path := rest, ""
+	if i := strings.IndexByte(rest, '/'); i >= 0 {
+		authority, path = rest[:i], rest[i:]
+	}
+	if userinfo, host, ok := cutLast(authority, "@"); ok {
+		// Discard the optional ";AUTH=" parameter
+		user, _, _ := strings.Cut(userinfo, ";")
+		var err error
+		if u.User, err = url.PathUnescape(user); err != nil {
+			return nil, fmt.Errorf("imap: invalid user in URL: %v", err)
+		}
+		authority = host
+	}
+	if authority == "" {
+		return nil, fmt.Errorf("imap: URL %q has no host", s)
+	}
+	u.Host = authority
+
+	// URLAUTH components come last
+	upper := strings.ToUpper(path)
+	if i := strings.LastIndex(upper, ";URLAUTH="); i >= 0 {
+		auth := strings.SplitN(path[i+len(";URLAUTH="):], ":", 3)
+		u.Access = auth[0]
+		switch len(auth) {
+		case 1:
+			// rump URL
+		case 3:
+			u.Mechanism, u.Token = auth[1], auth[2]
+		default:
+			return nil, fmt.Errorf("imap: invalid URLAUTH in URL: %q", path[i:])
+		}
+		path, upper = path[:i], upper[:i]
+	}
+	if i := strings.LastIndex(upper, ";EXPIRE="); i >= 0 {
+		t, err := time.Parse(time.RFC3339, path[i+len(";EXPIRE="):])
+		if err != nil {
+			return nil, fmt.Errorf("imap: invalid EXPIRE in URL: %v", err)
+		}
+		u.Expire = t
+		path = path[:i]
+	}
+
+	msgURL, err := ParseMessageURL(path)
+	if err != nil {
+		return nil, err
+	}
+	u.MessageURL = *msgURL
+	return &u, nil
+}
+
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) < len(prefix) || !strings.EqualFold(s[:len(prefix)], prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// escapeURLUser percent-encodes all characters but achar, as defined in
+// RFC 5092.
+func escapeURLUser(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if isURLBChar(ch) && ch != '@' && ch != '/' && ch != ':' {
+			sb.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", ch)
+		}
+	}
+	return sb.String()
+}